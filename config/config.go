@@ -1,6 +1,8 @@
 package config
 
 import (
+	"time"
+
 	"github.com/kelseyhightower/envconfig"
 	"github.com/pkg/errors"
 )
@@ -10,6 +12,11 @@ type Config struct {
 
 	ListenAddress string `envconfig:"LISTEN_ADDRESS" default:"127.0.0.1:8080"`
 	CanonicalURL  string `envconfig:"CANONICAL_URL"  default:"http://localhost:8080"`
+	FrontendURL   string `envconfig:"FRONTEND_URL"   default:"https://steemit.com"`
+
+	// TrailingSlashRedirect makes web requests without a trailing slash redirect.
+	// API requests are never redirected.
+	TrailingSlashRedirect bool `envconfig:"TRAILING_SLASH_REDIRECT"`
 
 	FacebookClientId     string `envconfig:"FACEBOOK_CLIENT_ID"     required:"true"`
 	FacebookClientSecret string `envconfig:"FACEBOOK_CLIENT_SECRET" required:"true"`
@@ -32,7 +39,152 @@ type Config struct {
 	SteemdDisabled             bool     `envconfig:"STEEMD_DISABLED"`
 	SteemdRPCEndpointAddresses []string `envconfig:"STEEMD_RPC_ENDPOINT_ADDRESSES" default:"ws://localhost:8090"`
 
-	BlockProcessorWorkerCount uint `envconfig:"BLOCK_PROCESSOR_WORKER_COUNT" default:"10"`
+	BlockProcessorWorkerCount uint          `envconfig:"BLOCK_PROCESSOR_WORKER_COUNT" default:"10"`
+	NotifierConcurrency       uint          `envconfig:"NOTIFIER_CONCURRENCY"         default:"4"`
+	NotifierBreakerThreshold  uint          `envconfig:"NOTIFIER_BREAKER_THRESHOLD"   default:"5"`
+	NotifierBreakerCooldown   time.Duration `envconfig:"NOTIFIER_BREAKER_COOLDOWN"    default:"5m"`
+
+	// FanoutLimit is the number of users an event is dispatched to at once. The dispatches
+	// to more users go out in batches of FanoutLimit, FanoutSpread apart. 0 disables the limit.
+	FanoutLimit  uint          `envconfig:"FANOUT_LIMIT"  default:"500"`
+	FanoutSpread time.Duration `envconfig:"FANOUT_SPREAD" default:"1s"`
+
+	// NotifierTimeouts and NotifierRetries override the per-notifier-type defaults,
+	// e.g. "slack:10s,matrix:1m" and "slack:3,telegram:0".
+	NotifierTimeouts map[string]time.Duration `envconfig:"NOTIFIER_TIMEOUTS"`
+	NotifierRetries  map[string]uint          `envconfig:"NOTIFIER_RETRIES"`
+
+	// NotifierMaxLengths overrides the message length limits of the providers,
+	// e.g. "telegram:4000,irc:400". The longer messages are cut.
+	NotifierMaxLengths map[string]uint `envconfig:"NOTIFIER_MAX_LENGTHS"`
+
+	// DisabledOpTypes are the operation types never mined, e.g. "vote,custom_json".
+	// The events mined from them only are disabled as well.
+	DisabledOpTypes []string `envconfig:"DISABLED_OP_TYPES"`
+
+	// PayoutLeadTimes specifies how long before a post payout the post.payout_approaching event is sent.
+	PayoutLeadTimes []time.Duration `envconfig:"PAYOUT_LEAD_TIMES" default:"12h,1h"`
+
+	// FeedStaleThreshold is how long a witness can go without publishing the price feed
+	// before witness.feed_stale is sent. Set to 0 to disable.
+	FeedStaleThreshold time.Duration `envconfig:"FEED_STALE_THRESHOLD" default:"1h"`
+
+	// WarmupGrace is for how long after startup the events from blocks older than WarmupMaxAge
+	// are only recorded to the history and not delivered. Set to 0 to disable.
+	WarmupGrace  time.Duration `envconfig:"WARMUP_GRACE"   default:"15m"`
+	WarmupMaxAge time.Duration `envconfig:"WARMUP_MAX_AGE" default:"10m"`
+
+	// HistoryRetention is for how long the history entries are kept by default.
+	// The users can choose their own retention up to HistoryMaxRetention, 0 means no cap.
+	HistoryRetention    time.Duration `envconfig:"HISTORY_RETENTION"     default:"720h"`
+	HistoryMaxRetention time.Duration `envconfig:"HISTORY_MAX_RETENTION" default:"2160h"`
+
+	// PayerRetention is how long a payer is remembered for the new payer detection.
+	PayerRetention time.Duration `envconfig:"PAYER_RETENTION" default:"8760h"`
+
+	// FirehoseRateLimit is the default number of custom_json firehose events per minute per user.
+	FirehoseRateLimit uint `envconfig:"FIREHOSE_RATE_LIMIT" default:"600"`
+
+	// ActivityRateLimit is the number of account.activity events per minute per user.
+	ActivityRateLimit uint `envconfig:"ACTIVITY_RATE_LIMIT" default:"120"`
+
+	// FollowChurnWindow is for how long the follow status changes are held so that
+	// the changes quickly reversed by the follow bots are dropped. 0 disables coalescing.
+	FollowChurnWindow time.Duration `envconfig:"FOLLOW_CHURN_WINDOW" default:"0"`
+
+	// SuppressSelfTransfers drops the transfers from an account to itself.
+	SuppressSelfTransfers bool `envconfig:"SUPPRESS_SELF_TRANSFERS" default:"false"`
+
+	// RoundTripWindow is for how long the transfers are held so that a transfer sent back
+	// within the window is delivered together with the original one. 0 disables the detection.
+	RoundTripWindow time.Duration `envconfig:"ROUND_TRIP_WINDOW" default:"0"`
+
+	// DedupWindow is for how long the dispatched events are remembered to prevent duplicate delivery.
+	// DedupPersist stores them in MongoDB as well so that they survive a restart,
+	// turn it off to keep them in memory only.
+	DedupWindow  time.Duration `envconfig:"DEDUP_WINDOW"  default:"1h"`
+	DedupPersist bool          `envconfig:"DEDUP_PERSIST" default:"true"`
+
+	// ConfigCacheTTL is for how long the block processor caches the user configuration, 0 disables the cache.
+	// The cache is invalidated when the configuration is changed through the API.
+	ConfigCacheTTL time.Duration `envconfig:"CONFIG_CACHE_TTL" default:"1m"`
+
+	// CollapseWindow is for how long an event identical to the previous event sent to the user
+	// is suppressed. Set to 0 to disable.
+	CollapseWindow time.Duration `envconfig:"COLLAPSE_WINDOW" default:"10s"`
+
+	// ExchangeAccounts replaces the built-in exchange account list, e.g. "bittrex:Bittrex,poloniex:Poloniex".
+	ExchangeAccounts map[string]string `envconfig:"EXCHANGE_ACCOUNTS"`
+
+	// MaxListEntries is the maximum number of entries in a single watch list and
+	// MaxUserEntries is the maximum number of entries in all the lists of a user, 0 means no limit.
+	MaxListEntries uint `envconfig:"MAX_LIST_ENTRIES" default:"1000"`
+	MaxUserEntries uint `envconfig:"MAX_USER_ENTRIES" default:"5000"`
+
+	// AccountOverviewTTL is for how long the account overviews shown on the dashboard are cached.
+	AccountOverviewTTL time.Duration `envconfig:"ACCOUNT_OVERVIEW_TTL" default:"1m"`
+
+	// StreamTokenTTL is for how long the single-use event stream tokens are valid, 0 disables them.
+	StreamTokenTTL time.Duration `envconfig:"STREAM_TOKEN_TTL" default:"30s"`
+
+	// StreamMaxIdle is for how long an event stream connection can be idle before it is closed,
+	// 0 disables it. The clients keep quiet connections alive by sending pings.
+	StreamMaxIdle time.Duration `envconfig:"STREAM_MAX_IDLE" default:"0"`
+
+	// StreamReplaceGrace is for how long an event stream connection replaced by a quick reconnect
+	// of the same client is kept open, 0 closes it right away.
+	StreamReplaceGrace time.Duration `envconfig:"STREAM_REPLACE_GRACE" default:"5s"`
+
+	// StreamMaxBackfill is the maximum number of events a connected client can ask to be replayed
+	// from the history, 0 disables the backfill.
+	StreamMaxBackfill uint `envconfig:"STREAM_MAX_BACKFILL" default:"100"`
+
+	// IngestSecret enables the ingest endpoint for events forwarded by other instances.
+	IngestSecret string `envconfig:"INGEST_SECRET"`
+	// ForwardURLs are the ingest endpoints of other instances to forward all events to.
+	ForwardURLs   []string `envconfig:"FORWARD_URLS"`
+	ForwardSecret string   `envconfig:"FORWARD_SECRET"`
+
+	// NATSURL enables publishing all events to NATS, see eventstream.Publisher.
+	// Either the token or the user and password can be used for authentication.
+	NATSURL        string `envconfig:"NATS_URL"`
+	NATSUser       string `envconfig:"NATS_USER"`
+	NATSPassword   string `envconfig:"NATS_PASSWORD"`
+	NATSToken      string `envconfig:"NATS_TOKEN"`
+	NATSBufferSize int    `envconfig:"NATS_BUFFER_SIZE" default:"8388608"`
+
+	// AuditSink is one of "", "file" or "mongodb".
+	AuditSink           string        `envconfig:"AUDIT_SINK"`
+	AuditFile           string        `envconfig:"AUDIT_FILE"             default:"audit.log"`
+	AuditFileMaxSizeMB  int64         `envconfig:"AUDIT_FILE_MAX_SIZE_MB" default:"100"`
+	AuditFileMaxBackups int           `envconfig:"AUDIT_FILE_MAX_BACKUPS" default:"10"`
+	AuditRetention      time.Duration `envconfig:"AUDIT_RETENTION"        default:"720h"`
+
+	// TrustedProxies are the CIDR ranges of the reverse proxies in front of the server.
+	// X-Forwarded-For and X-Real-IP are ignored for requests coming from anywhere else.
+	TrustedProxies []string `envconfig:"TRUSTED_PROXIES"`
+
+	// DefaultSubscriptionsFile is a JSON file with the subscriptions applied to the new users,
+	// see subscriptions.Template. No defaults are applied when not set.
+	DefaultSubscriptionsFile string `envconfig:"DEFAULT_SUBSCRIPTIONS_FILE"`
+
+	// InfoAccess is one of "public", "authenticated" or "disabled".
+	// It applies to the info endpoint only, the health endpoint is always public.
+	InfoAccess string `envconfig:"INFO_ACCESS" default:"public"`
+
+	// AdminSecret enables the admin API, the secret is expected in the X-Steemwatch-Admin-Secret header.
+	AdminSecret string `envconfig:"ADMIN_SECRET"`
+
+	// FaultInjection enables the admin endpoint simulating notifier outages in production.
+	// It is always enabled in the other environments.
+	FaultInjection bool `envconfig:"FAULT_INJECTION"`
+
+	// Maintenance starts the server in maintenance mode.
+	Maintenance        bool   `envconfig:"MAINTENANCE"`
+	MaintenanceMessage string `envconfig:"MAINTENANCE_MESSAGE"`
+	// MaintenanceFile is checked on SIGHUP. Maintenance mode is enabled when the file exists,
+	// using the file content as the message, and disabled otherwise.
+	MaintenanceFile string `envconfig:"MAINTENANCE_FILE" default:"maintenance"`
 }
 
 func Load() (*Config, error) {
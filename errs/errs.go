@@ -3,3 +3,7 @@ package errs
 import "errors"
 
 var ErrClosing = errors.New("closing")
+
+// ErrCredentialsRejected is returned by the notifiers when the service
+// refused the stored credentials, e.g. because the access token expired.
+var ErrCredentialsRejected = errors.New("credentials rejected")
@@ -0,0 +1,64 @@
+package links
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const DefaultBaseURL = "https://steemit.com"
+
+// Builder builds links pointing to the configured Steem front-end.
+// All links to posts and accounts should be assembled using a Builder
+// so that there is a single place to change when the front-end changes.
+type Builder struct {
+	baseURL string
+}
+
+func NewBuilder(baseURL string) (*Builder, error) {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid front-end URL: %v", baseURL)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, errors.Errorf("invalid front-end URL: %v", baseURL)
+	}
+
+	return &Builder{strings.TrimSuffix(baseURL, "/")}, nil
+}
+
+func MustNewBuilder(baseURL string) *Builder {
+	builder, err := NewBuilder(baseURL)
+	if err != nil {
+		panic(err)
+	}
+	return builder
+}
+
+// BaseURL returns the front-end URL with no trailing slash.
+func (builder *Builder) BaseURL() string {
+	return builder.baseURL
+}
+
+// Account returns the link to the given account's profile.
+func (builder *Builder) Account(account string) string {
+	return builder.baseURL + "/@" + account
+}
+
+// Content returns the link for the given content path, i.e. database.Content.URL.
+func (builder *Builder) Content(path string) string {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return builder.baseURL + path
+}
+
+// Favicon returns the link to the front-end icon, used as the thumbnail of the messages.
+func (builder *Builder) Favicon() string {
+	return builder.baseURL + "/images/favicons/favicon-96x96.png"
+}
@@ -1,18 +1,23 @@
 package main
 
 import (
+	"io/ioutil"
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/tchap/steemwatch/config"
 	"github.com/tchap/steemwatch/notifications"
+	"github.com/tchap/steemwatch/notifications/audit"
 	"github.com/tchap/steemwatch/notifications/notifiers/discord"
 	"github.com/tchap/steemwatch/server"
+	"github.com/tchap/steemwatch/server/routes/api/eventstream"
 
 	"github.com/go-steem/rpc"
+	"github.com/go-steem/rpc/interfaces"
 	"github.com/go-steem/rpc/transports/websocket"
 	"github.com/pkg/errors"
 	"github.com/steemwatch/blockfetcher"
@@ -54,16 +59,102 @@ func _main() error {
 		return err
 	}
 
+	// Discord shares the session with the web server.
+	discordOpts := []discord.NotifierOption{discord.SetLinkBuilder(serverCtx.Links)}
+	if n := cfg.NotifierMaxLengths["discord"]; n != 0 {
+		discordOpts = append(discordOpts, discord.SetMaxMessageLength(n))
+	}
+
 	// Start notifications.
-	notificationsCtx, client, err := runNotifications(nDB, cfg,
+	opts := []notifications.Option{
 		notifications.SetWorkerCount(cfg.BlockProcessorWorkerCount),
-		notifications.AddStandardNotifier("discord", discord.NewNotifier(dg)),
-		notifications.AddNotifier("websocket", serverCtx.EventStreamManager))
+		notifications.SetNotifierConcurrency(cfg.NotifierConcurrency),
+		notifications.SetCircuitBreaker(cfg.NotifierBreakerThreshold, cfg.NotifierBreakerCooldown),
+		notifications.SetFanoutLimit(cfg.FanoutLimit, cfg.FanoutSpread),
+		notifications.SetNotifierPolicies(cfg.NotifierTimeouts, cfg.NotifierRetries, cfg.NotifierMaxLengths),
+		notifications.SetLinkBuilder(serverCtx.Links),
+		notifications.SetPauseSwitch(serverCtx.Pipeline),
+		notifications.SetDBMonitor(serverCtx.DBHealth),
+		notifications.SetFaultInjector(serverCtx.Faults),
+		notifications.SetConfigCache(cfg.ConfigCacheTTL, serverCtx.ConfigChanges),
+		notifications.SetExchangeAccounts(cfg.ExchangeAccounts),
+		notifications.SetDisabledOpTypes(cfg.DisabledOpTypes),
+		notifications.SetPayoutLeadTimes(cfg.PayoutLeadTimes),
+		notifications.SetFeedStaleThreshold(cfg.FeedStaleThreshold),
+		notifications.SetWarmup(cfg.WarmupGrace, cfg.WarmupMaxAge),
+		notifications.SetHistoryRetention(cfg.HistoryRetention, cfg.HistoryMaxRetention),
+		notifications.SetPayerRetention(cfg.PayerRetention),
+		notifications.SetFirehoseRateLimit(cfg.FirehoseRateLimit),
+		notifications.SetActivityRateLimit(cfg.ActivityRateLimit),
+		notifications.SetFollowChurnWindow(cfg.FollowChurnWindow),
+		notifications.SetSuppressSelfTransfers(cfg.SuppressSelfTransfers),
+		notifications.SetRoundTripWindow(cfg.RoundTripWindow),
+		notifications.SetDedup(cfg.DedupPersist, cfg.DedupWindow),
+		notifications.SetCollapseWindow(cfg.CollapseWindow),
+		notifications.AddStandardNotifier("discord",
+			discord.NewNotifier(dg, discordOpts...)),
+		notifications.AddNotifier("websocket", serverCtx.EventStreamManager),
+	}
+	if len(cfg.ForwardURLs) != 0 {
+		opts = append(opts, notifications.AddNotifier("forward",
+			eventstream.NewForwarder(serverCtx.Links, cfg.ForwardURLs, cfg.ForwardSecret)))
+	}
+	if cfg.IngestSecret != "" {
+		opts = append(opts, notifications.SetIngestSource(serverCtx.EventStreamManager))
+	}
+	if cfg.NATSURL != "" {
+		publisher, err := eventstream.NewPublisher(serverCtx.Links, &eventstream.PublisherConfig{
+			URL:        cfg.NATSURL,
+			User:       cfg.NATSUser,
+			Password:   cfg.NATSPassword,
+			Token:      cfg.NATSToken,
+			BufferSize: cfg.NATSBufferSize,
+		})
+		if err != nil {
+			return err
+		}
+		opts = append(opts, notifications.AddNotifier("nats", publisher))
+	}
+
+	auditSink, err := newAuditSink(nDB, cfg)
+	if err != nil {
+		return err
+	}
+	if auditSink != nil {
+		opts = append(opts, notifications.SetAuditSink(auditSink))
+	}
+
+	notificationsCtx, client, caller, err := runNotifications(nDB, cfg, opts...)
 	if err != nil {
 		return err
 	}
 	defer client.Close()
 
+	// The dashboard account overviews need steemd as well.
+	if client != nil {
+		serverCtx.AccountOverviews.SetClient(client, caller)
+	}
+
+	// Check the maintenance file on SIGHUP.
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+	defer signal.Stop(hupCh)
+	go func() {
+		for range hupCh {
+			message, err := ioutil.ReadFile(cfg.MaintenanceFile)
+			switch {
+			case err == nil:
+				log.Println("Maintenance file found, entering maintenance mode")
+				serverCtx.Maintenance.Set(true, strings.TrimSpace(string(message)))
+			case os.IsNotExist(err):
+				log.Println("Maintenance file not found, leaving maintenance mode")
+				serverCtx.Maintenance.Set(false, "")
+			default:
+				log.Printf("failed to read the maintenance file: %v", err)
+			}
+		}
+	}()
+
 	// Start processing signals.
 	go func() {
 		<-signalCh
@@ -106,17 +197,33 @@ func _main() error {
 	return nil
 }
 
+func newAuditSink(db *mgo.Database, cfg *config.Config) (audit.Sink, error) {
+	switch cfg.AuditSink {
+	case "":
+		return nil, nil
+	case "file":
+		return audit.NewFileSink(cfg.AuditFile,
+			audit.SetMaxFileSize(cfg.AuditFileMaxSizeMB*1024*1024),
+			audit.SetMaxFileBackups(cfg.AuditFileMaxBackups))
+	case "mongodb":
+		return audit.NewMongoSink(db.C("audit"), cfg.AuditRetention)
+	default:
+		return nil, errors.New("invalid audit sink: " + cfg.AuditSink)
+	}
+}
+
 func runNotifications(
 	db *mgo.Database,
 	cfg *config.Config,
 	opts ...notifications.Option,
-) (*blockfetcher.Context, *rpc.Client, error) {
+) (*blockfetcher.Context, *rpc.Client, interfaces.Caller, error) {
 
 	if cfg.SteemdDisabled {
-		return nil, nil, nil
+		return nil, nil, nil, nil
 	}
 
-	connect := func() (*rpc.Client, error) {
+	// dial also returns the transport, which is needed for the calls go-steem/rpc has no method for.
+	dial := func() (*rpc.Client, *websocket.Transport, error) {
 		// Monitor the connection to steemd.
 		monitorChan := make(chan interface{})
 		go func() {
@@ -134,25 +241,29 @@ func runNotifications(
 			websocket.SetAutoReconnectMaxDelay(1*time.Minute),
 			websocket.SetMonitor(monitorChan))
 		if err != nil {
-			return nil, errors.Wrap(
+			return nil, nil, errors.Wrap(
 				err, "failed to connect initialize WebSocket transport")
 		}
 		client, err := rpc.NewClient(t)
 		if err != nil {
-			return nil, errors.Wrapf(err, "failed to instantiate the steemd RPC client")
+			return nil, nil, errors.Wrapf(err, "failed to instantiate the steemd RPC client")
 		}
-		return client, nil
+		return client, t, nil
+	}
+	connect := func() (*rpc.Client, error) {
+		client, _, err := dial()
+		return client, err
 	}
 
 	// Start the block processor.
-	client, err := connect()
+	client, t, err := dial()
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 	ctx, err := notifications.Run(client, connect, db, opts...)
 	if err != nil {
 		client.Close()
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
-	return ctx, client, nil
+	return ctx, client, t, nil
 }
@@ -0,0 +1,139 @@
+package accounts
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/go-steem/rpc"
+	"github.com/pkg/errors"
+)
+
+// DefaultCacheSize is the number of accounts the cache keeps before it starts over.
+const DefaultCacheSize = 10000
+
+// Cache remembers account properties that never change once the account exists,
+// so that they don't have to be fetched from steemd for every event.
+type Cache struct {
+	client *rpc.Client
+	size   int
+
+	created map[string]time.Time
+	lock    *sync.Mutex
+}
+
+func NewCache(client *rpc.Client, size int) *Cache {
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+	return &Cache{
+		client:  client,
+		size:    size,
+		created: make(map[string]time.Time),
+		lock:    &sync.Mutex{},
+	}
+}
+
+// Created returns the creation time of the given account.
+func (cache *Cache) Created(account string) (time.Time, error) {
+	cache.lock.Lock()
+	created, ok := cache.created[account]
+	cache.lock.Unlock()
+	if ok {
+		return created, nil
+	}
+
+	fetched, err := fetchCreated(cache.client, []string{account})
+	if err != nil {
+		return time.Time{}, err
+	}
+	created, ok = fetched[account]
+	if !ok {
+		return time.Time{}, errors.Errorf("account not found: %v", account)
+	}
+
+	cache.lock.Lock()
+	cache.put(account, created)
+	cache.lock.Unlock()
+
+	return created, nil
+}
+
+// fetchCreated returns the creation times of the given accounts.
+// The accounts that don't exist are missing in the result.
+func fetchCreated(client *rpc.Client, accounts []string) (map[string]time.Time, error) {
+	raw, err := client.Database.GetAccountsRaw(accounts)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get accounts: %v", accounts)
+	}
+
+	var result []struct {
+		Name    string `json:"name"`
+		Created string `json:"created"`
+	}
+	if err := json.Unmarshal([]byte(*raw), &result); err != nil {
+		return nil, errors.Wrap(err, "failed to decode accounts")
+	}
+
+	created := make(map[string]time.Time, len(result))
+	for _, account := range result {
+		t, err := time.ParseInLocation(steemdTimeLayout, account.Created, time.UTC)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid creation time of account %v", account.Name)
+		}
+		created[account.Name] = t
+	}
+	return created, nil
+}
+
+// MaxBatchSize is the maximum number of accounts requested in a single call.
+const MaxBatchSize = 100
+
+// Prefetch loads the accounts that are not cached yet using as few calls as possible.
+func (cache *Cache) Prefetch(accounts []string) error {
+	cache.lock.Lock()
+	missing := make([]string, 0, len(accounts))
+	for _, account := range accounts {
+		if _, ok := cache.created[account]; !ok {
+			missing = append(missing, account)
+		}
+	}
+	cache.lock.Unlock()
+
+	for len(missing) != 0 {
+		batch := missing
+		if len(batch) > MaxBatchSize {
+			batch = batch[:MaxBatchSize]
+		}
+		missing = missing[len(batch):]
+
+		fetched, err := fetchCreated(cache.client, batch)
+		if err != nil {
+			return err
+		}
+
+		cache.lock.Lock()
+		for account, created := range fetched {
+			cache.put(account, created)
+		}
+		cache.lock.Unlock()
+	}
+	return nil
+}
+
+// put must be called with the lock held.
+func (cache *Cache) put(account string, created time.Time) {
+	if len(cache.created) >= cache.size {
+		cache.created = make(map[string]time.Time)
+	}
+	cache.created[account] = created
+}
+
+// Age returns how long ago the given account was created.
+func (cache *Cache) Age(account string) (time.Duration, error) {
+	created, err := cache.Created(account)
+	if err != nil {
+		return 0, err
+	}
+	return time.Since(created), nil
+}
@@ -0,0 +1,228 @@
+package accounts
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-steem/rpc"
+	"github.com/go-steem/rpc/interfaces"
+	"github.com/pkg/errors"
+)
+
+// DefaultOverviewTTL is for how long the account overviews are cached by default.
+const DefaultOverviewTTL = time.Minute
+
+// ErrOverviewsUnavailable is returned when there is no connection to steemd to get the overviews from,
+// e.g. when the block processor is disabled.
+var ErrOverviewsUnavailable = errors.New("account overviews not available")
+
+// Overview is a compact snapshot of an account as shown on the dashboard.
+type Overview struct {
+	Account        string         `json:"account"`
+	Balance        string         `json:"balance"`
+	SBDBalance     string         `json:"sbdBalance"`
+	VestingShares  string         `json:"vestingShares"`
+	Reputation     float64        `json:"reputation"`
+	FollowerCount  uint32         `json:"followerCount"`
+	FollowingCount uint32         `json:"followingCount"`
+	LastActivityAt *time.Time     `json:"lastActivityAt,omitempty"`
+	PendingRewards PendingRewards `json:"pendingRewards"`
+	FetchedAt      time.Time      `json:"fetchedAt"`
+}
+
+// PendingRewards are the rewards that were paid out but not claimed yet.
+type PendingRewards struct {
+	SBD     string `json:"sbd"`
+	STEEM   string `json:"steem"`
+	Vesting string `json:"vesting"`
+}
+
+// Overviews fetches the account overviews from steemd and caches them for the TTL.
+// The client is set once connected, until then ErrOverviewsUnavailable is returned.
+type Overviews struct {
+	ttl    time.Duration
+	size   int
+	client *rpc.Client
+	caller interfaces.Caller
+
+	cached map[string]*Overview
+	lock   sync.Mutex
+}
+
+func NewOverviews(ttl time.Duration, size int) *Overviews {
+	if ttl <= 0 {
+		ttl = DefaultOverviewTTL
+	}
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+	return &Overviews{
+		ttl:    ttl,
+		size:   size,
+		cached: make(map[string]*Overview),
+	}
+}
+
+// SetClient sets the steemd client to get the overviews from. The caller is the transport
+// of the client, go-steem/rpc has no method to get the follow counts.
+func (overviews *Overviews) SetClient(client *rpc.Client, caller interfaces.Caller) {
+	overviews.lock.Lock()
+	overviews.client = client
+	overviews.caller = caller
+	overviews.lock.Unlock()
+}
+
+// Get returns the overviews of the given accounts in the same order,
+// the accounts that do not exist are skipped. The accounts not cached
+// are fetched in batches of MaxBatchSize.
+func (overviews *Overviews) Get(accounts []string) ([]*Overview, error) {
+	now := time.Now()
+
+	overviews.lock.Lock()
+	client, caller := overviews.client, overviews.caller
+	missing := make([]string, 0, len(accounts))
+	for _, account := range accounts {
+		if overview, ok := overviews.cached[account]; !ok || now.Sub(overview.FetchedAt) > overviews.ttl {
+			missing = append(missing, account)
+		}
+	}
+	overviews.lock.Unlock()
+
+	if len(missing) != 0 && client == nil {
+		return nil, ErrOverviewsUnavailable
+	}
+
+	for len(missing) != 0 {
+		batch := missing
+		if len(batch) > MaxBatchSize {
+			batch = batch[:MaxBatchSize]
+		}
+		missing = missing[len(batch):]
+
+		fetched, err := fetchOverviews(client, caller, batch)
+		if err != nil {
+			return nil, err
+		}
+
+		overviews.lock.Lock()
+		if len(overviews.cached)+len(fetched) > overviews.size {
+			overviews.cached = make(map[string]*Overview)
+		}
+		for _, overview := range fetched {
+			overviews.cached[overview.Account] = overview
+		}
+		overviews.lock.Unlock()
+	}
+
+	overviews.lock.Lock()
+	defer overviews.lock.Unlock()
+
+	result := make([]*Overview, 0, len(accounts))
+	for _, account := range accounts {
+		if overview, ok := overviews.cached[account]; ok {
+			result = append(result, overview)
+		}
+	}
+	return result, nil
+}
+
+// steemdTimeLayout is how steemd formats the times, always in UTC.
+const steemdTimeLayout = "2006-01-02T15:04:05"
+
+func fetchOverviews(client *rpc.Client, caller interfaces.Caller, accounts []string) ([]*Overview, error) {
+	raw, err := client.Database.GetAccountsRaw(accounts)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get accounts: %v", accounts)
+	}
+
+	var result []struct {
+		Name                 string          `json:"name"`
+		Balance              string          `json:"balance"`
+		SBDBalance           string          `json:"sbd_balance"`
+		VestingShares        string          `json:"vesting_shares"`
+		Reputation           json.RawMessage `json:"reputation"`
+		LastPost             string          `json:"last_post"`
+		LastRootPost         string          `json:"last_root_post"`
+		LastVoteTime         string          `json:"last_vote_time"`
+		RewardSBDBalance     string          `json:"reward_sbd_balance"`
+		RewardSteemBalance   string          `json:"reward_steem_balance"`
+		RewardVestingBalance string          `json:"reward_vesting_balance"`
+	}
+	if err := json.Unmarshal([]byte(*raw), &result); err != nil {
+		return nil, errors.Wrap(err, "failed to decode accounts")
+	}
+
+	now := time.Now()
+	overviews := make([]*Overview, 0, len(result))
+	for _, account := range result {
+		overview := &Overview{
+			Account:        account.Name,
+			Balance:        account.Balance,
+			SBDBalance:     account.SBDBalance,
+			VestingShares:  account.VestingShares,
+			Reputation:     reputationScore(account.Reputation),
+			LastActivityAt: latestTime(account.LastPost, account.LastRootPost, account.LastVoteTime),
+			PendingRewards: PendingRewards{
+				SBD:     account.RewardSBDBalance,
+				STEEM:   account.RewardSteemBalance,
+				Vesting: account.RewardVestingBalance,
+			},
+			FetchedAt: now,
+		}
+
+		// The follow counts are not part of the account object and cannot be requested in batches.
+		var count struct {
+			FollowerCount  uint32 `json:"follower_count"`
+			FollowingCount uint32 `json:"following_count"`
+		}
+		params := []interface{}{"follow_api", "get_follow_count", []interface{}{account.Name}}
+		if err := caller.Call("call", params, &count); err != nil {
+			return nil, errors.Wrapf(err, "failed to get follow count: %v", account.Name)
+		}
+		overview.FollowerCount = count.FollowerCount
+		overview.FollowingCount = count.FollowingCount
+
+		overviews = append(overviews, overview)
+	}
+	return overviews, nil
+}
+
+// reputationScore turns the raw reputation into the score shown by the Steem frontends, e.g. 25.
+// steemd sends the raw reputation either as a number or as a string.
+func reputationScore(raw json.RawMessage) float64 {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		s = string(raw)
+	}
+	rep, err := strconv.ParseFloat(s, 64)
+	if err != nil || rep == 0 {
+		return 25
+	}
+
+	score := math.Log10(math.Abs(rep)) - 9
+	if score < 0 {
+		score = 0
+	}
+	if rep < 0 {
+		score = -score
+	}
+	return math.Floor((score*9+25)*100) / 100
+}
+
+// latestTime returns the latest of the steemd times, nil when none is set.
+func latestTime(values ...string) *time.Time {
+	var latest *time.Time
+	for _, value := range values {
+		t, err := time.Parse(steemdTimeLayout, value)
+		if err != nil || t.Year() <= 1970 {
+			continue
+		}
+		if latest == nil || t.After(*latest) {
+			latest = &t
+		}
+	}
+	return latest
+}
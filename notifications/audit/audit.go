@@ -0,0 +1,22 @@
+package audit
+
+import (
+	"io"
+	"time"
+)
+
+// Entry describes a single successful dispatch of an event to a user.
+type Entry struct {
+	UserId    string    `json:"userId"    bson:"userId"`
+	EventKind string    `json:"eventKind" bson:"eventKind"`
+	EventId   string    `json:"eventId"   bson:"eventId"`
+	Channels  []string  `json:"channels"  bson:"channels"`
+	Timestamp time.Time `json:"timestamp" bson:"timestamp"`
+}
+
+// Sink stores audit entries. Record must be safe to call from multiple goroutines.
+type Sink interface {
+	Record(entry *Entry) error
+
+	io.Closer
+}
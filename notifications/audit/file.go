@@ -0,0 +1,209 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultMaxFileSize    = 100 * 1024 * 1024
+	DefaultMaxFileBackups = 10
+)
+
+// FileSink appends entries to a file as JSON lines.
+//
+// The file is rotated when it grows beyond the configured size,
+// keeping at most the configured number of rotated files around.
+// Writes are buffered and flushed every second.
+type FileSink struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	file *os.File
+	w    *bufio.Writer
+	size int64
+	lock *sync.Mutex
+
+	termCh chan struct{}
+	doneCh chan struct{}
+}
+
+type FileSinkOption func(*FileSink)
+
+func SetMaxFileSize(size int64) FileSinkOption {
+	return func(sink *FileSink) {
+		sink.maxSize = size
+	}
+}
+
+func SetMaxFileBackups(n int) FileSinkOption {
+	return func(sink *FileSink) {
+		sink.maxBackups = n
+	}
+}
+
+func NewFileSink(path string, opts ...FileSinkOption) (*FileSink, error) {
+	sink := &FileSink{
+		path:       path,
+		maxSize:    DefaultMaxFileSize,
+		maxBackups: DefaultMaxFileBackups,
+		lock:       &sync.Mutex{},
+		termCh:     make(chan struct{}),
+		doneCh:     make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(sink)
+	}
+
+	if err := sink.open(); err != nil {
+		return nil, err
+	}
+
+	go sink.flusher()
+	return sink, nil
+}
+
+func (sink *FileSink) Record(entry *Entry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal audit entry")
+	}
+	line = append(line, '\n')
+
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+
+	if sink.file == nil {
+		return errors.New("audit file sink closed")
+	}
+
+	if sink.maxSize > 0 && sink.size+int64(len(line)) > sink.maxSize {
+		if err := sink.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := sink.w.Write(line)
+	sink.size += int64(n)
+	return errors.Wrap(err, "failed to write audit entry")
+}
+
+func (sink *FileSink) Close() error {
+	close(sink.termCh)
+	<-sink.doneCh
+
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	return sink.close()
+}
+
+func (sink *FileSink) flusher() {
+	defer close(sink.doneCh)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			sink.lock.Lock()
+			if sink.w != nil {
+				sink.w.Flush()
+			}
+			sink.lock.Unlock()
+
+		case <-sink.termCh:
+			return
+		}
+	}
+}
+
+func (sink *FileSink) open() error {
+	file, err := os.OpenFile(sink.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open audit file %v", sink.path)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return errors.Wrapf(err, "failed to stat audit file %v", sink.path)
+	}
+
+	sink.file = file
+	sink.w = bufio.NewWriter(file)
+	sink.size = info.Size()
+	return nil
+}
+
+func (sink *FileSink) close() error {
+	if sink.file == nil {
+		return nil
+	}
+
+	flushErr := sink.w.Flush()
+	closeErr := sink.file.Close()
+	sink.file = nil
+	sink.w = nil
+
+	if flushErr != nil {
+		return errors.Wrap(flushErr, "failed to flush audit file")
+	}
+	return errors.Wrap(closeErr, "failed to close audit file")
+}
+
+func (sink *FileSink) rotate() error {
+	if err := sink.close(); err != nil {
+		if err := sink.open(); err != nil {
+			return err
+		}
+		return err
+	}
+
+	rotated := fmt.Sprintf("%v.%v", sink.path, time.Now().UTC().Format("20060102T150405.000"))
+	if err := os.Rename(sink.path, rotated); err != nil {
+		// Keep writing into the current file, the rotation is tried again on the next entry.
+		if err := sink.open(); err != nil {
+			return err
+		}
+		return errors.Wrapf(err, "failed to rotate audit file %v", sink.path)
+	}
+
+	if err := sink.open(); err != nil {
+		return err
+	}
+	return sink.removeOldBackups()
+}
+
+func (sink *FileSink) removeOldBackups() error {
+	if sink.maxBackups <= 0 {
+		return nil
+	}
+
+	backups, err := filepath.Glob(sink.path + ".*")
+	if err != nil {
+		return errors.Wrap(err, "failed to list audit file backups")
+	}
+	if len(backups) <= sink.maxBackups {
+		return nil
+	}
+
+	// The timestamp suffix makes the lexical order chronological.
+	sort.Strings(backups)
+	for _, backup := range backups[:len(backups)-sink.maxBackups] {
+		if err := os.Remove(backup); err != nil {
+			return errors.Wrapf(err, "failed to remove audit file backup %v", backup)
+		}
+	}
+	return nil
+}
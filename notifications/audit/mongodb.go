@@ -0,0 +1,47 @@
+package audit
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2"
+)
+
+// MongoSink inserts entries into a MongoDB collection.
+// Entries older than the retention period are removed by MongoDB using a TTL index.
+type MongoSink struct {
+	collection *mgo.Collection
+}
+
+func NewMongoSink(collection *mgo.Collection, retention time.Duration) (*MongoSink, error) {
+	indexes := []mgo.Index{
+		{
+			Key:        []string{"userId", "-timestamp"},
+			Background: true,
+		},
+	}
+	if retention > 0 {
+		indexes = append(indexes, mgo.Index{
+			Key:         []string{"timestamp"},
+			Background:  true,
+			ExpireAfter: retention,
+		})
+	}
+
+	for _, index := range indexes {
+		if err := collection.EnsureIndex(index); err != nil {
+			return nil, errors.Wrapf(err, "failed to create index for %v.%v",
+				collection.Name, index.Key)
+		}
+	}
+
+	return &MongoSink{collection}, nil
+}
+
+func (sink *MongoSink) Record(entry *Entry) error {
+	return errors.Wrap(sink.collection.Insert(entry), "failed to insert audit entry")
+}
+
+func (sink *MongoSink) Close() error {
+	return nil
+}
@@ -5,7 +5,17 @@ import (
 	"sync"
 	"time"
 
+	"github.com/tchap/steemwatch/links"
+	"github.com/tchap/steemwatch/notifications/accounts"
+	"github.com/tchap/steemwatch/notifications/audit"
+	"github.com/tchap/steemwatch/notifications/dbhealth"
 	"github.com/tchap/steemwatch/notifications/events"
+	"github.com/tchap/steemwatch/notifications/exchanges"
+	"github.com/tchap/steemwatch/notifications/faults"
+	"github.com/tchap/steemwatch/notifications/metrics"
+	"github.com/tchap/steemwatch/notifications/pause"
+	"github.com/tchap/steemwatch/server/changes"
+	"github.com/tchap/steemwatch/server/db"
 
 	"github.com/go-steem/rpc"
 	"github.com/go-steem/rpc/apis/database"
@@ -39,9 +49,58 @@ type BlockProcessor struct {
 	db         *mgo.Database
 	config     *BlockProcessorConfig
 	numWorkers uint
-
-	eventMiners         map[types.OpType][]EventMiner
-	additionalNotifiers map[string]Notifier
+	links      *links.Builder
+	exchanges  *exchanges.Directory
+	accounts   *accounts.Cache
+	audit      audit.Sink
+	breakers   *circuitBreakers
+	votes      *voteCache
+	sequencer  *sequencer
+	warmup     *warmup
+	traced     *tracedUsers
+	firehose   *firehoseLimiter
+	pipeline   *pause.Switch
+	faults     *faults.Injector
+	dedup      *dedupSet
+	collapser  *collapser
+	prices     *priceCache
+	sampler    *sampler
+	activity   *firehoseLimiter
+	follows    *followChurn
+	trips      *roundTrips
+	configs    *configCache
+	history    *historyWriter
+	fanout     *fanoutLimiter
+	watches    *watchIndex
+	dbHealth   *dbhealth.Monitor
+	feeds      *feedMonitor
+	ingest     IngestSource
+
+	digestLock sync.Mutex
+
+	payoutLeadTimes []time.Duration
+
+	defaultHistoryRetention time.Duration
+	maxHistoryRetention     time.Duration
+	payerRetention          time.Duration
+	firehoseRateLimit       uint
+	activityRateLimit       uint
+	dedupPersist            bool
+	dedupWindow             time.Duration
+	followChurnWindow       time.Duration
+	roundTripWindow         time.Duration
+	suppressSelfTransfers   bool
+	configCacheTTL          time.Duration
+	fanoutLimit             uint
+	fanoutSpread            time.Duration
+	feedStaleThreshold      time.Duration
+	configChanges           *changes.Feed
+
+	eventMiners                map[types.OpType][]EventMiner
+	disabledOpTypes            map[types.OpType]bool
+	additionalNotifiers        map[string]Notifier
+	defaultNotifierConcurrency uint
+	notifierPolicies           map[string]NotifierPolicy
 
 	blockCh             chan *database.Block
 	blockProcessingLock *sync.Mutex
@@ -70,6 +129,224 @@ func AddStandardNotifier(id string, notifier Notifier) Option {
 	}
 }
 
+func SetNotifierConcurrency(concurrency uint) Option {
+	return func(processor *BlockProcessor) {
+		processor.defaultNotifierConcurrency = concurrency
+	}
+}
+
+func SetLinkBuilder(lb *links.Builder) Option {
+	return func(processor *BlockProcessor) {
+		processor.links = lb
+	}
+}
+
+func SetExchangeAccounts(accounts map[string]string) Option {
+	return func(processor *BlockProcessor) {
+		processor.exchanges = exchanges.NewDirectory(accounts)
+	}
+}
+
+// SetCircuitBreaker configures the per-notifier circuit breakers.
+// Setting threshold to 0 disables them.
+func SetCircuitBreaker(threshold uint, cooldown time.Duration) Option {
+	return func(processor *BlockProcessor) {
+		processor.breakers = newCircuitBreakers(threshold, cooldown)
+	}
+}
+
+// SetAuditSink makes the processor record every successful dispatch into the given sink.
+func SetAuditSink(sink audit.Sink) Option {
+	return func(processor *BlockProcessor) {
+		processor.audit = sink
+	}
+}
+
+// SetPayoutLeadTimes specifies how long before the payout of a tracked post
+// the owners are notified. Setting no lead times disables PayoutApproaching.
+func SetPayoutLeadTimes(leadTimes []time.Duration) Option {
+	return func(processor *BlockProcessor) {
+		processor.payoutLeadTimes = leadTimes
+	}
+}
+
+// SetFeedStaleThreshold specifies how long a witness can go without publishing the price feed
+// before the watchers are notified. Setting the threshold to 0 disables the feed monitor.
+func SetFeedStaleThreshold(threshold time.Duration) Option {
+	return func(processor *BlockProcessor) {
+		processor.feedStaleThreshold = threshold
+	}
+}
+
+// SetWarmup specifies for how long after startup the events mined from blocks older than maxAge
+// are only recorded to the history and not delivered. Setting grace to 0 disables the warmup.
+func SetWarmup(grace, maxAge time.Duration) Option {
+	return func(processor *BlockProcessor) {
+		processor.warmup = newWarmup(grace, maxAge)
+	}
+}
+
+// SetHistoryRetention specifies for how long the history entries are kept by default
+// and the maximum retention the users can choose. Setting max to 0 removes the cap.
+func SetHistoryRetention(defaultRetention, max time.Duration) Option {
+	return func(processor *BlockProcessor) {
+		if defaultRetention != 0 {
+			processor.defaultHistoryRetention = defaultRetention
+		}
+		processor.maxHistoryRetention = max
+	}
+}
+
+// SetPayerRetention specifies how long a payer is remembered for the new payer detection
+// after the last transfer from the payer.
+func SetPayerRetention(retention time.Duration) Option {
+	return func(processor *BlockProcessor) {
+		processor.payerRetention = retention
+	}
+}
+
+// SetFirehoseRateLimit specifies how many custom_json firehose events per minute
+// a user receives at most by default. Setting the limit to 0 removes it.
+func SetFirehoseRateLimit(ratePerMinute uint) Option {
+	return func(processor *BlockProcessor) {
+		processor.firehoseRateLimit = ratePerMinute
+	}
+}
+
+// SetActivityRateLimit specifies how many account.activity events per minute
+// a user receives at most. Setting the limit to 0 removes it.
+func SetActivityRateLimit(ratePerMinute uint) Option {
+	return func(processor *BlockProcessor) {
+		processor.activityRateLimit = ratePerMinute
+	}
+}
+
+// SetFollowChurnWindow makes the follow status changes of the same follower
+// be held for the given window so that the changes reversed within the window are dropped
+// and only the last one of the remaining changes is delivered. Coalescing is disabled by default.
+func SetFollowChurnWindow(window time.Duration) Option {
+	return func(processor *BlockProcessor) {
+		processor.followChurnWindow = window
+	}
+}
+
+// SetSuppressSelfTransfers makes the transfers from an account to itself be dropped.
+// The self-transfers are delivered by default.
+func SetSuppressSelfTransfers(suppress bool) Option {
+	return func(processor *BlockProcessor) {
+		processor.suppressSelfTransfers = suppress
+	}
+}
+
+// SetRoundTripWindow makes the transfers be held for the given window so that a transfer
+// sent back within the window is delivered together with the original one as a single event.
+// Detection is disabled by default.
+func SetRoundTripWindow(window time.Duration) Option {
+	return func(processor *BlockProcessor) {
+		processor.roundTripWindow = window
+	}
+}
+
+// SetConfigCache makes the user configuration read when dispatching be cached for the given TTL.
+// The cached configuration of a user is dropped when the change is reported by the feed.
+// The cache is disabled by default.
+func SetConfigCache(ttl time.Duration, feed *changes.Feed) Option {
+	return func(processor *BlockProcessor) {
+		processor.configCacheTTL = ttl
+		processor.configChanges = feed
+	}
+}
+
+// SetDisabledOpTypes makes the processor skip the operations of the given types,
+// disabling the events mined from them.
+func SetDisabledOpTypes(opTypes []string) Option {
+	return func(processor *BlockProcessor) {
+		processor.disabledOpTypes = make(map[types.OpType]bool, len(opTypes))
+		for _, opType := range opTypes {
+			processor.disabledOpTypes[types.OpType(opType)] = true
+		}
+	}
+}
+
+// SetPauseSwitch makes the pipeline pausable using the given switch.
+// While paused, no blocks are processed and nothing is dispatched.
+func SetPauseSwitch(s *pause.Switch) Option {
+	return func(processor *BlockProcessor) {
+		processor.pipeline = s
+	}
+}
+
+// SetFanoutLimit makes the dispatches of an event reaching more than limit users
+// go out in batches of limit, spread apart. Setting limit to 0 disables it.
+func SetFanoutLimit(limit uint, spread time.Duration) Option {
+	return func(processor *BlockProcessor) {
+		processor.fanoutLimit = limit
+		processor.fanoutSpread = spread
+	}
+}
+
+// SetDBMonitor makes the processor report the database availability using the given monitor.
+func SetDBMonitor(monitor *dbhealth.Monitor) Option {
+	return func(processor *BlockProcessor) {
+		processor.dbHealth = monitor
+	}
+}
+
+// SetFaultInjector makes the deliveries fail as injected using the admin API,
+// see faults.Injector. It is meant for testing the alerting built around the delivery status.
+func SetFaultInjector(injector *faults.Injector) Option {
+	return func(processor *BlockProcessor) {
+		processor.faults = injector
+	}
+}
+
+// SetDedup specifies for how long the dispatched events are remembered so that they are
+// not delivered again when mined again. When persist is set, the events are stored
+// in the database as well so that they are remembered across restarts.
+func SetDedup(persist bool, window time.Duration) Option {
+	return func(processor *BlockProcessor) {
+		processor.dedupPersist = persist
+		if window != 0 {
+			processor.dedupWindow = window
+		}
+	}
+}
+
+// SetCollapseWindow specifies for how long an event identical to the previous event
+// dispatched to the same user is suppressed. Setting the window to 0 disables the check.
+func SetCollapseWindow(window time.Duration) Option {
+	return func(processor *BlockProcessor) {
+		processor.collapser = newCollapser(window)
+	}
+}
+
+// SetNotifierPolicies overrides the default timeouts, retry counts and message length limits
+// for the given notifier types. The notifier types missing in the maps keep the default values.
+func SetNotifierPolicies(
+	timeouts map[string]time.Duration,
+	retries map[string]uint,
+	maxLengths map[string]uint,
+) Option {
+
+	return func(processor *BlockProcessor) {
+		for id, timeout := range timeouts {
+			policy := processor.notifierPolicies[id]
+			policy.Timeout = timeout
+			processor.notifierPolicies[id] = policy
+		}
+		for id, n := range retries {
+			policy := processor.notifierPolicies[id]
+			policy.Retries = n
+			processor.notifierPolicies[id] = policy
+		}
+		for id, n := range maxLengths {
+			policy := processor.notifierPolicies[id]
+			policy.MaxLength = n
+			processor.notifierPolicies[id] = policy
+		}
+	}
+}
+
 func SetWorkerCount(numWorkers uint) Option {
 	return func(processor *BlockProcessor) {
 		processor.numWorkers = numWorkers
@@ -98,6 +375,7 @@ func New(
 		{"authors", true},
 		{"voters", true},
 		{"parentAuthors", true},
+		{"ids", true},
 	}
 
 	for _, index := range indexes {
@@ -123,6 +401,191 @@ func New(
 		}
 	}
 
+	log.Println("Creating index for deliveryStatus ...")
+	if err := db.C("deliveryStatus").EnsureIndex(mgo.Index{
+		Key:        []string{"ownerId", "notifierId"},
+		Unique:     true,
+		Background: true,
+	}); err != nil {
+		log.Printf("Failed creating index for deliveryStatus: %v", err)
+	}
+
+	log.Println("Creating index for deadLetters ...")
+	if err := db.C("deadLetters").EnsureIndex(mgo.Index{
+		Key:        []string{"ownerId", "notifierId"},
+		Background: true,
+	}); err != nil {
+		log.Printf("Failed creating index for deadLetters: %v", err)
+	}
+
+	log.Println("Creating index for heldEvents ...")
+	if err := db.C("heldEvents").EnsureIndex(mgo.Index{
+		Key:        []string{"ownerId", "heldAt"},
+		Background: true,
+	}); err != nil {
+		log.Printf("Failed creating index for heldEvents: %v", err)
+	}
+
+	log.Println("Creating indexes for history ...")
+	// The retention used to be global, using a TTL index on createdAt.
+	// It is per-user now, so the entries expire according to expiresAt.
+	if err := db.C("history").DropIndex("createdAt"); err != nil && !isIndexNotFound(err) {
+		log.Printf("Failed dropping index history.createdAt: %v", err)
+	}
+	for _, index := range []mgo.Index{
+		{
+			Key:        []string{"ownerId", "-createdAt"},
+			Background: true,
+		},
+		{
+			// The entries stored before the numbering was introduced have no number,
+			// they sort as the oldest.
+			Key:        []string{"ownerId", "-seq", "-createdAt"},
+			Background: true,
+		},
+		{
+			Key:         []string{"expiresAt"},
+			Background:  true,
+			ExpireAfter: time.Second,
+		},
+	} {
+		if err := db.C("history").EnsureIndex(index); err != nil {
+			log.Printf("Failed creating index for history.%v: %v", index.Key, err)
+		}
+	}
+
+	// The numbers are unique per user. The entries stored before the numbering was introduced
+	// have no number, mgo cannot create a partial index, hence the command.
+	err := db.Run(bson.D{
+		{Name: "createIndexes", Value: "history"},
+		{Name: "indexes", Value: []bson.M{{
+			"key":    bson.D{{Name: "ownerId", Value: 1}, {Name: "seq", Value: 1}},
+			"name":   "ownerId_1_seq_1",
+			"unique": true,
+			"partialFilterExpression": bson.M{
+				"seq": bson.M{"$exists": true},
+			},
+			"background": true,
+		}}},
+	}, nil)
+	if err != nil {
+		log.Printf("Failed creating index for history.[ownerId seq]: %v", err)
+	}
+
+	log.Println("Creating indexes for threadSubscriptions ...")
+	for _, index := range []mgo.Index{
+		{
+			Key:        []string{"ownerId", "rootAuthor", "rootPermlink"},
+			Unique:     true,
+			Background: true,
+		},
+		{
+			Key:        []string{"rootAuthor", "rootPermlink"},
+			Background: true,
+		},
+		{
+			Key:         []string{"expiresAt"},
+			Background:  true,
+			ExpireAfter: time.Second,
+		},
+	} {
+		if err := db.C("threadSubscriptions").EnsureIndex(index); err != nil {
+			log.Printf("Failed creating index for threadSubscriptions.%v: %v", index.Key, err)
+		}
+	}
+
+	log.Println("Creating indexes for trackedPosts ...")
+	for _, index := range []mgo.Index{
+		{
+			Key:        []string{"author", "permlink"},
+			Unique:     true,
+			Background: true,
+		},
+		{
+			Key:        []string{"cashoutTime"},
+			Background: true,
+		},
+	} {
+		if err := db.C("trackedPosts").EnsureIndex(index); err != nil {
+			log.Printf("Failed creating index for trackedPosts.%v: %v", index.Key, err)
+		}
+	}
+
+	log.Println("Creating indexes for payers ...")
+	if err := db.C("payers").EnsureIndex(mgo.Index{
+		Key:         []string{"expiresAt"},
+		Background:  true,
+		ExpireAfter: time.Second,
+	}); err != nil {
+		log.Printf("Failed creating index for payers.expiresAt: %v", err)
+	}
+
+	log.Println("Creating indexes for dedup ...")
+	if err := db.C("dedup").EnsureIndex(mgo.Index{
+		Key:         []string{"expiresAt"},
+		Background:  true,
+		ExpireAfter: time.Second,
+	}); err != nil {
+		log.Printf("Failed creating index for dedup.expiresAt: %v", err)
+	}
+
+	log.Println("Creating indexes for productionRewards ...")
+	if err := db.C("productionRewards").EnsureIndex(mgo.Index{
+		Key:        []string{"day"},
+		Background: true,
+	}); err != nil {
+		log.Printf("Failed creating index for productionRewards.day: %v", err)
+	}
+
+	log.Println("Creating indexes for traces ...")
+	for _, index := range []mgo.Index{
+		{
+			Key:        []string{"ownerId", "-createdAt"},
+			Background: true,
+		},
+		{
+			Key:         []string{"createdAt"},
+			Background:  true,
+			ExpireAfter: TraceRetention,
+		},
+	} {
+		if err := db.C("traces").EnsureIndex(index); err != nil {
+			log.Printf("Failed creating index for traces.%v: %v", index.Key, err)
+		}
+	}
+
+	log.Println("Creating indexes for digestFlushes ...")
+	for _, index := range []mgo.Index{
+		{
+			Key:        []string{"processedAt", "requestedAt"},
+			Background: true,
+		},
+		{
+			Key:        []string{"ownerId", "requestedAt"},
+			Background: true,
+		},
+	} {
+		if err := db.C("digestFlushes").EnsureIndex(index); err != nil {
+			log.Printf("Failed creating index for digestFlushes.%v: %v", index.Key, err)
+		}
+	}
+
+	log.Println("Creating indexes for redeliveries ...")
+	for _, index := range []mgo.Index{
+		{
+			Key:        []string{"processedAt", "requestedAt"},
+			Background: true,
+		},
+		{
+			Key:        []string{"ownerId", "requestedAt"},
+			Background: true,
+		},
+	} {
+		if err := db.C("redeliveries").EnsureIndex(index); err != nil {
+			log.Printf("Failed creating index for redeliveries.%v: %v", index.Key, err)
+		}
+	}
+
 	// Load config from the database.
 	var config BlockProcessorConfig
 	if err := db.C("configuration").FindId("BlockProcessor").One(&config); err != nil {
@@ -140,6 +603,7 @@ func New(
 	}
 
 	// Instantiate event miners.
+	// The miners registered for AnyOpType are run for every operation.
 	eventMiners := map[types.OpType][]EventMiner{
 		types.TypeAccountUpdate: []EventMiner{
 			events.NewAccountUpdatedEventMiner(),
@@ -149,6 +613,7 @@ func New(
 		},
 		types.TypeTransfer: []EventMiner{
 			events.NewTransferMadeEventMiner(),
+			events.NewNewPayerDetectedEventMiner(),
 		},
 		types.TypeComment: []EventMiner{
 			events.NewUserMentionedEventMiner(),
@@ -161,6 +626,27 @@ func New(
 		},
 		types.TypeCustomJSON: []EventMiner{
 			events.NewUserFollowStatusChangedEventMiner(),
+			events.NewCommunityEventMiner(),
+			events.NewCustomJSONBroadcastEventMiner(),
+			events.NewRCDelegationEventMiner(),
+		},
+		events.TypeClaimAccount: []EventMiner{
+			events.NewAccountCreationTokenClaimedEventMiner(),
+		},
+		events.TypeWitnessSetProperties: []EventMiner{
+			events.NewWitnessPropertiesSetEventMiner(),
+		},
+		events.TypeProducerReward: []EventMiner{
+			events.NewBlockProductionRewardReceivedEventMiner(),
+		},
+		events.TypeHardfork: []EventMiner{
+			events.NewHardforkActivatedEventMiner(),
+		},
+		events.TypeAccountCreateWithDelegation: []EventMiner{
+			events.NewAccountCreatedEventMiner(),
+		},
+		AnyOpType: []EventMiner{
+			events.NewAccountActivityEventMiner(),
 		},
 	}
 
@@ -170,9 +656,38 @@ func New(
 		db:          db,
 		config:      &config,
 		numWorkers:  DefaultWorkerCount,
+		links:       links.MustNewBuilder(links.DefaultBaseURL),
+		exchanges:   exchanges.NewDirectory(exchanges.DefaultAccounts),
+		accounts:    accounts.NewCache(client, accounts.DefaultCacheSize),
+		breakers:    newCircuitBreakers(DefaultBreakerThreshold, DefaultBreakerCooldown),
+		votes:       newVoteCache(DefaultVoteCacheSize),
+		warmup:      newWarmup(DefaultWarmupGrace, DefaultWarmupMaxAge),
+		traced:      newTracedUsers(),
+		firehose:    newFirehoseLimiter(),
+		pipeline:    pause.NewSwitch(),
+		dbHealth:    dbhealth.NewMonitor(),
+		collapser:   newCollapser(DefaultCollapseWindow),
+		prices:      newPriceCache(),
+		sampler:     newSampler(),
+		activity:    newFirehoseLimiter(),
 		eventMiners: eventMiners,
 		blockAckCh:  make(chan *database.Block),
 		t:           new(tomb.Tomb),
+
+		payoutLeadTimes:            DefaultPayoutLeadTimes,
+		defaultHistoryRetention:    DefaultHistoryRetention,
+		maxHistoryRetention:        DefaultHistoryMaxRetention,
+		payerRetention:             DefaultPayerRetention,
+		firehoseRateLimit:          DefaultFirehoseRateLimit,
+		activityRateLimit:          DefaultActivityRateLimit,
+		dedupWindow:                DefaultDedupWindow,
+		fanoutSpread:               DefaultFanoutSpread,
+		feedStaleThreshold:         DefaultFeedStaleThreshold,
+		defaultNotifierConcurrency: DefaultNotifierConcurrency,
+		notifierPolicies:           make(map[string]NotifierPolicy, len(DefaultNotifierPolicies)),
+	}
+	for id, policy := range DefaultNotifierPolicies {
+		processor.notifierPolicies[id] = policy
 	}
 
 	// Apply the options.
@@ -180,6 +695,105 @@ func New(
 		opt(processor)
 	}
 
+	processor.disableOpTypes()
+
+	processor.sequencer = newSequencer(processor.t, db, processor.config.NextBlockNum)
+	processor.dedup = newDedupSet(db, processor.dedupPersist, processor.dedupWindow)
+	processor.follows = newFollowChurn(processor.followChurnWindow)
+	processor.trips = newRoundTrips(processor.roundTripWindow)
+	processor.configs = newConfigCache(processor.configCacheTTL)
+	processor.history = newHistoryWriter(&mgoHistoryStore{db})
+	processor.fanout = newFanoutLimiter(processor.fanoutLimit, processor.fanoutSpread)
+	if processor.feedStaleThreshold != 0 {
+		feeds, err := loadFeedMonitor(db, processor.feedStaleThreshold)
+		if err != nil {
+			return nil, err
+		}
+		processor.feeds = feeds
+	}
+	processor.configs.stale = processor.dbHealth.Check
+	if processor.configChanges != nil {
+		// The watch index is only kept when the changes are reported,
+		// otherwise it would lag behind until the next rebuild.
+		processor.watches = newWatchIndex()
+		processor.configChanges.OnChange(func(userId string) {
+			processor.configs.invalidate(userId)
+			processor.reindexUser(userId)
+		})
+	}
+	if processor.ingest != nil {
+		processor.ingest.OnIngest(processor.dispatchIngested)
+	}
+
+	// Instantiate the standard notifiers.
+	initNotifiers(db, processor.links, processor.configChanges, processor.notifierPolicies)
+
+	// Let the web server know what is being watched.
+	processor.storeCapabilities()
+
+	// Start the digest sender.
+	processor.t.Go(processor.digestSender)
+
+	// Start removing the history entries without expiration.
+	processor.t.Go(processor.historySweeper)
+
+	// Start filling the gaps left in the history by the failed writes.
+	processor.t.Go(processor.historyGapRepairer)
+
+	// Start checking whether the database is back when it becomes unavailable.
+	processor.t.Go(processor.dbWatcher)
+
+	// Start dropping the expired user configuration.
+	if processor.configs.ttl != 0 {
+		processor.t.Go(processor.configCacheSweeper)
+	}
+
+	// Start building the watch index.
+	if processor.watches != nil {
+		processor.t.Go(processor.watchIndexer)
+	}
+
+	// Start processing digest flush requests.
+	processor.t.Go(processor.digestFlusher)
+
+	// Start processing redelivery requests.
+	processor.t.Go(processor.redeliverer)
+
+	// Start the payout tracker.
+	processor.t.Go(processor.payoutTracker)
+
+	// Start sending the daily block production reward totals.
+	processor.t.Go(processor.productionRewardSender)
+
+	// Start sending the daily summaries.
+	processor.t.Go(processor.summarySender)
+
+	// Start checking the witness price feeds for staleness.
+	if processor.feeds != nil {
+		processor.t.Go(processor.feedChecker)
+	}
+
+	// Start reloading the users in trace mode.
+	processor.t.Go(processor.traceRefresher)
+
+	// Start fetching the price feed for the USD thresholds.
+	processor.t.Go(processor.priceRefresher)
+
+	// Start tracking the head block of the node.
+	processor.t.Go(processor.syncTracker)
+
+	// Start passing on the transfers held by the round-trip detection.
+	processor.t.Go(func() error {
+		processor.trips.run(processor.t.Dying(), processor.flushTransferMadeEvent)
+		return nil
+	})
+
+	// Start passing on the follow status changes held by the churn coalescing.
+	processor.t.Go(func() error {
+		processor.follows.run(processor.t.Dying(), processor.flushUserFollowStatusChangedEvent)
+		return nil
+	})
+
 	// Start the config flusher.
 	processor.blockAckCh = make(chan *database.Block, processor.numWorkers)
 	processor.t.Go(processor.configFlusher)
@@ -201,6 +815,12 @@ func (processor *BlockProcessor) BlockRange() (from, to uint32) {
 }
 
 func (processor *BlockProcessor) ProcessBlock(block *database.Block) error {
+	// Holding the block here stops the block fetcher as well,
+	// so the processing continues with this very block on resume.
+	if !processor.pipeline.Wait(processor.t.Dying()) {
+		return processor.t.Wait()
+	}
+
 	select {
 	case processor.blockCh <- block:
 		return nil
@@ -229,54 +849,108 @@ func (processor *BlockProcessor) worker(connect ConnectFunc) error {
 	for {
 		select {
 		case block := <-processor.blockCh:
-			for _, tx := range block.Transactions {
-				for _, op := range tx.Operations {
-					// Fetch the associated content in case
-					// this is a content-related operation.
+			// The blocks already queued wait for the pipeline to be resumed.
+			if !processor.pipeline.Wait(processor.t.Dying()) {
+				return nil
+			}
+
+			// Fetch the content associated with the content-related operations.
+			contents, err := processor.prefetch(client, block)
+			if err != nil {
+				if !processor.t.Alive() {
+					return nil
+				}
+				return err
+			}
+
+			var blockTime time.Time
+			if ts := block.Timestamp.Time; ts != nil {
+				blockTime = *ts
+			}
+
+			var index uint32
+			mine := func(op types.Operation, content *database.Content) error {
+				if !processor.opTypeEnabled(op.Type()) {
+					return nil
+				}
+				// Get miners associated with the given operation
+				// followed by the miners interested in all operations.
+				miners := processor.eventMiners[op.Type()]
+				if anyMiners := processor.eventMiners[AnyOpType]; len(anyMiners) != 0 {
+					miners = append(miners[:len(miners):len(miners)], anyMiners...)
+				}
+				if len(miners) == 0 {
+					return nil
+				}
+				// Mine events and handle them.
+				for _, eventMiner := range miners {
 					var (
-						content *database.Content
-						err     error
+						events []interface{}
+						err    error
 					)
-					switch body := op.Data().(type) {
-					case *types.CommentOperation:
-						content, err = client.Database.GetContent(body.Author, body.Permlink)
-						err = errors.Wrapf(err, "block %v: failed to get content: @%v/%v",
-							block.Number, body.Author, body.Permlink)
-					case *types.VoteOperation:
-						content, err = client.Database.GetContent(body.Author, body.Permlink)
-						err = errors.Wrapf(err, "block %v: failed to get content: @%v/%v",
-							block.Number, body.Author, body.Permlink)
+					if blockMiner, ok := eventMiner.(BlockEventMiner); ok {
+						events, err = blockMiner.MineBlockEvent(op, content, blockTime)
+					} else {
+						events, err = eventMiner.MineEvent(op, content)
 					}
-					if err != nil {
-						if !processor.t.Alive() {
-							return nil
+					if err == nil {
+						for _, event := range events {
+							processor.sequencer.track(event, eventPosition{
+								block:     block.Number,
+								index:     index,
+								timestamp: blockTime,
+								op:        op,
+							})
+							index++
+
+							err = processor.handleEvent(event)
+							if err != nil {
+								break
+							}
 						}
+					}
+					if err != nil {
+						return errors.Wrapf(err, "block %v: %v", block.Number, err.Error())
+					}
+				}
+				return nil
+			}
+
+			for _, tx := range block.Transactions {
+				for _, op := range tx.Operations {
+					var content *database.Content
+					if key, ok := operationContentKey(op); ok {
+						content = contents[key]
+					}
+					if err := mine(op, content); err != nil {
 						return err
 					}
+					if err := processor.observeFeed(op, blockTime); err != nil {
+						return errors.Wrapf(err, "block %v: %v", block.Number, err.Error())
+					}
+				}
+			}
 
-					// Get miners associated with the given operation.
-					miners, ok := processor.eventMiners[op.Type()]
-					if !ok {
-						continue
+			// Virtual operations are not part of the block, they need to be fetched.
+			if processor.needsVirtualOps() {
+				ops, err := virtualOps(client, block.Number)
+				if err != nil {
+					if !processor.t.Alive() {
+						return nil
 					}
-					// Mine events and handle them.
-					for _, eventMiner := range miners {
-						events, err := eventMiner.MineEvent(op, content)
-						if err == nil {
-							for _, event := range events {
-								err = processor.handleEvent(event)
-								if err != nil {
-									break
-								}
-							}
-						}
-						if err != nil {
-							return errors.Wrapf(err, "block %v: %v", block.Number, err.Error())
-						}
+					return err
+				}
+				for _, op := range ops {
+					if err := mine(op, nil); err != nil {
+						return err
 					}
 				}
 			}
 
+			if processor.feeds != nil {
+				processor.feeds.advance(blockTime)
+			}
+
 			processor.blockAckCh <- block
 
 		case <-processor.t.Dying():
@@ -295,7 +969,15 @@ func (processor *BlockProcessor) Finalize() error {
 		notifier.Close()
 	}
 
-	return processor.t.Wait()
+	err := processor.t.Wait()
+
+	if processor.audit != nil {
+		if ex := processor.audit.Close(); ex != nil {
+			log.Printf("failed to close audit sink: %+v", ex)
+		}
+	}
+
+	return err
 }
 
 func (processor *BlockProcessor) configFlusher() error {
@@ -346,11 +1028,13 @@ func (processor *BlockProcessor) configFlusher() error {
 				}
 			} else {
 				updateConfig(block)
+				processor.sequencer.ack(config.NextBlockNum)
 			}
 
 		// Flush config every minute.
 		case <-timeoutCh:
-			if err := processor.flushConfig(config); err != nil {
+			// The next flush stores the current configuration anyway.
+			if err := processor.skipUnavailable("configuration flush", processor.flushConfig(config)); err != nil {
 				return err
 			}
 			resetTimeout()
@@ -369,7 +1053,18 @@ func (processor *BlockProcessor) flushConfig(config *BlockProcessorConfig) error
 // Event handling
 //==============================================================================
 
+// handleEvent handles the mined event. While the database is unavailable and the handler
+// fails to get the target users, the event is skipped rather than stopping the processor.
 func (processor *BlockProcessor) handleEvent(event interface{}) error {
+	defer processor.fanout.track(event)()
+
+	if err := processor.handleEventByType(event); err != nil {
+		return processor.skipUnavailable(eventKind(event)+" event", err)
+	}
+	return nil
+}
+
+func (processor *BlockProcessor) handleEventByType(event interface{}) error {
 	switch event := event.(type) {
 	case *events.AccountUpdated:
 		return processor.HandleAccountUpdatedEvent(event)
@@ -389,6 +1084,38 @@ func (processor *BlockProcessor) handleEvent(event interface{}) error {
 		return processor.HandleCommentPublishedEvent(event)
 	case *events.CommentVoted:
 		return processor.HandleCommentVotedEvent(event)
+	case *events.AccountCreationTokenClaimed:
+		return processor.HandleAccountCreationTokenClaimedEvent(event)
+	case *events.PayoutApproaching:
+		return processor.HandlePayoutApproachingEvent(event)
+	case *events.PostPaidOut:
+		return processor.HandlePostPaidOutEvent(event)
+	case *events.WitnessPropertiesSet:
+		return processor.HandleWitnessPropertiesSetEvent(event)
+	case *events.BlockProductionRewardReceived:
+		return processor.HandleBlockProductionRewardReceivedEvent(event)
+	case *events.CommunitySubscriptionChanged:
+		return processor.HandleCommunitySubscriptionChangedEvent(event)
+	case *events.CommunityRoleChanged:
+		return processor.HandleCommunityRoleChangedEvent(event)
+	case *events.NewPayerDetected:
+		return processor.HandleNewPayerDetectedEvent(event)
+	case *events.CustomJSONBroadcast:
+		return processor.HandleCustomJSONBroadcastEvent(event)
+	case *events.AccountCreated:
+		return processor.HandleAccountCreatedEvent(event)
+	case *events.HardforkActivated:
+		return processor.HandleHardforkActivatedEvent(event)
+	case *events.AccountActivity:
+		return processor.HandleAccountActivityEvent(event)
+	case *events.RCDelegated:
+		return processor.HandleRCDelegatedEvent(event)
+	case *events.RCDelegationRemoved:
+		return processor.HandleRCDelegationRemovedEvent(event)
+	case *events.WitnessFeedStale:
+		return processor.HandleWitnessFeedStaleEvent(event)
+	case *events.WitnessFeedRecovered:
+		return processor.HandleWitnessFeedRecoveredEvent(event)
 	default:
 		return errors.Errorf("unknown event type: %T", event)
 	}
@@ -396,16 +1123,21 @@ func (processor *BlockProcessor) handleEvent(event interface{}) error {
 
 func (processor *BlockProcessor) HandleAccountUpdatedEvent(event *events.AccountUpdated) error {
 	query := bson.M{
-		"kind":     "account.updated",
-		"accounts": event.Op.Account,
+		"kind":            "account.updated",
+		"accounts":        event.Op.Account,
+		"paused.accounts": bson.M{"$ne": event.Op.Account},
 	}
 
-	log.Println(query)
-
+	if !processor.narrowToWatchers(query, watchKeys("account.updated", "accounts", event.Op.Account)...) {
+		return nil
+	}
+
+	log.Println(query)
+
 	var result struct {
 		OwnerId bson.ObjectId `bson:"ownerId"`
 	}
-	iter := processor.db.C("events").Find(query).Iter()
+	iter := processor.findEvents(query)
 	for iter.Next(&result) {
 		processor.DispatchAccountUpdatedEvent(result.OwnerId.Hex(), event)
 	}
@@ -416,21 +1148,24 @@ func (processor *BlockProcessor) HandleAccountWitnessVotedEvent(event *events.Ac
 	query := bson.M{
 		"kind": "account.witness_voted",
 		"$or": []interface{}{
-			bson.M{
-				"accounts": event.Op.Account,
-			},
-			bson.M{
-				"witnesses": event.Op.Witness,
-			},
+			watching("accounts", event.Op.Account),
+			watching("witnesses", event.Op.Witness),
 		},
 	}
 
+	if !processor.narrowToWatchers(query, append(
+		watchKeys("account.witness_voted", "accounts", event.Op.Account),
+		watchKeys("account.witness_voted", "witnesses", event.Op.Witness)...,
+	)...) {
+		return nil
+	}
+
 	log.Println(query)
 
 	var result struct {
 		OwnerId bson.ObjectId `bson:"ownerId"`
 	}
-	iter := processor.db.C("events").Find(query).Iter()
+	iter := processor.findEvents(query)
 	for iter.Next(&result) {
 		processor.DispatchAccountWitnessVotedEvent(result.OwnerId.Hex(), event)
 	}
@@ -438,25 +1173,91 @@ func (processor *BlockProcessor) HandleAccountWitnessVotedEvent(event *events.Ac
 }
 
 func (processor *BlockProcessor) HandleTransferMadeEvent(event *events.TransferMade) error {
+	if processor.suppressSelfTransfers && event.SelfTransfer() {
+		return nil
+	}
+	// The block of a held transfer is not released until the transfer is passed on,
+	// so that its position is still known and the ordered delivery waits for it.
+	coalesced := processor.trips.hold(event, processor.sequencer.begin(event))
+	if coalesced == nil {
+		return nil
+	}
+	// The round trip is positioned at the transfer that completed it.
+	if coalesced != event {
+		if pos, ok := processor.sequencer.position(event); ok {
+			processor.sequencer.track(coalesced, *pos)
+		}
+	}
+	return processor.handleTransferMadeEvent(coalesced)
+}
+
+// flushTransferMadeEvent handles the transfer that was held by the round-trip detection.
+// It is called on shutdown as well, for the transfers still held.
+func (processor *BlockProcessor) flushTransferMadeEvent(event *events.TransferMade) {
+	if err := processor.handleTransferMadeEvent(event); err != nil {
+		log.Printf("failed to handle a held transfer: %+v", err)
+	}
+}
+
+func (processor *BlockProcessor) handleTransferMadeEvent(event *events.TransferMade) error {
+	// The held and the coalesced transfers are counted once handled.
+	defer processor.fanout.track(event)()
+
 	query := bson.M{
 		"kind": "transfer.made",
 		"$or": []interface{}{
-			bson.M{
-				"from": event.Op.From,
-			},
-			bson.M{
-				"to": event.Op.To,
-			},
+			watching("from", event.Op.From),
+			watching("to", event.Op.To),
+			watching("accounts", event.Op.From),
+			watching("accounts", event.Op.To),
 		},
 	}
 
+	keys := watchKeys("transfer.made", "from", event.Op.From)
+	keys = append(keys, watchKeys("transfer.made", "to", event.Op.To)...)
+	keys = append(keys, watchKeys("transfer.made", "accounts", event.Op.From, event.Op.To)...)
+	if !processor.narrowToWatchers(query, keys...) {
+		return nil
+	}
+
 	log.Println(query)
 
+	// An amount that cannot be parsed only matches the users not filtering by asset.
+	asset, err := event.Asset()
+	if err != nil {
+		log.Printf("transfer.made: %v", err)
+	}
+
 	var result struct {
-		OwnerId bson.ObjectId `bson:"ownerId"`
+		OwnerId  bson.ObjectId `bson:"ownerId"`
+		Settings db.Settings   `bson:"settings"`
+		Accounts []string      `bson:"accounts"`
+		Paused   struct {
+			Accounts []string `bson:"accounts"`
+		} `bson:"paused"`
 	}
-	iter := processor.db.C("events").Find(query).Iter()
+	iter := processor.findEvents(query)
 	for iter.Next(&result) {
+		if !result.Settings.MatchesAsset(asset) {
+			processor.traceRejected(result.OwnerId.Hex(), event, "assets",
+				"%v not in %v", asset, result.Settings.Assets)
+			continue
+		}
+		if ok, detail := processor.matchesAmount(&result.Settings, event.Op.Amount); !ok {
+			processor.traceRejected(result.OwnerId.Hex(), event, "minAmount", "%v", detail)
+			continue
+		}
+		// Tell the users watching the accounts list which side of the transfer matched.
+		if match := transferMatch(event, result.Accounts, result.Paused.Accounts); match != nil {
+			matched := *event
+			matched.Match = match
+			processor.fanout.copied(event, &matched)
+			if pos, ok := processor.sequencer.position(event); ok {
+				processor.sequencer.track(&matched, *pos)
+			}
+			processor.DispatchTransferMadeEvent(result.OwnerId.Hex(), &matched)
+			continue
+		}
 		processor.DispatchTransferMadeEvent(result.OwnerId.Hex(), event)
 	}
 	return errors.Wrap(iter.Err(), "failed get target users for transfer.made")
@@ -466,16 +1267,27 @@ func (processor *BlockProcessor) HandleUserMentionedEvent(event *events.UserMent
 	query := bson.M{
 		"kind":            "user.mentioned",
 		"users":           event.User,
+		"paused.users":    bson.M{"$ne": event.User},
 		"authorBlacklist": bson.M{"$ne": event.Content.Author},
 	}
 
+	if !processor.narrowToWatchers(query, watchKeys("user.mentioned", "users", event.User)...) {
+		return nil
+	}
+
 	log.Println(query)
 
 	var result struct {
-		OwnerId bson.ObjectId `bson:"ownerId"`
+		OwnerId  bson.ObjectId `bson:"ownerId"`
+		Settings db.Settings   `bson:"settings"`
 	}
-	iter := processor.db.C("events").Find(query).Iter()
+	iter := processor.findEvents(query)
 	for iter.Next(&result) {
+		if processor.isYoungAccount(event.Content.Author, result.Settings.MinAccountAgeDays) {
+			processor.traceRejected(result.OwnerId.Hex(), event, "minAccountAge",
+				"@%v younger than %v days", event.Content.Author, *result.Settings.MinAccountAgeDays)
+			continue
+		}
 		processor.DispatchUserMentionedEvent(result.OwnerId.Hex(), event)
 	}
 	return errors.Wrap(iter.Err(), "failed get target users for user.mentioned")
@@ -485,9 +1297,36 @@ func (processor *BlockProcessor) HandleUserFollowStatusChangedEvent(
 	event *events.UserFollowStatusChanged,
 ) error {
 
+	// The block of a held change is not released until the change is passed on,
+	// so that its position is still known and the ordered delivery waits for it.
+	if processor.follows.hold(event, processor.sequencer.begin(event)) {
+		return nil
+	}
+	return processor.handleUserFollowStatusChangedEvent(event)
+}
+
+// flushUserFollowStatusChangedEvent handles the event that was held by the churn coalescing.
+// It is called on shutdown as well, for the changes still held.
+func (processor *BlockProcessor) flushUserFollowStatusChangedEvent(event *events.UserFollowStatusChanged) {
+	if err := processor.handleUserFollowStatusChangedEvent(event); err != nil {
+		log.Printf("failed to handle a coalesced follow status change: %+v", err)
+	}
+}
+
+func (processor *BlockProcessor) handleUserFollowStatusChangedEvent(
+	event *events.UserFollowStatusChanged,
+) error {
+	// The coalesced events are counted once handled.
+	defer processor.fanout.track(event)()
+
 	query := bson.M{
-		"kind":  "user.follow_changed",
-		"users": event.Op.Following,
+		"kind":         "user.follow_changed",
+		"users":        event.Op.Following,
+		"paused.users": bson.M{"$ne": event.Op.Following},
+	}
+
+	if !processor.narrowToWatchers(query, watchKeys("user.follow_changed", "users", event.Op.Following)...) {
+		return nil
 	}
 
 	log.Println(query)
@@ -495,7 +1334,7 @@ func (processor *BlockProcessor) HandleUserFollowStatusChangedEvent(
 	var result struct {
 		OwnerId bson.ObjectId `bson:"ownerId"`
 	}
-	iter := processor.db.C("events").Find(query).Iter()
+	iter := processor.findEvents(query)
 	for iter.Next(&result) {
 		processor.DispatchUserFollowStatusChangedEvent(result.OwnerId.Hex(), event)
 	}
@@ -505,50 +1344,88 @@ func (processor *BlockProcessor) HandleUserFollowStatusChangedEvent(
 func (processor *BlockProcessor) HandleStoryPublishedEvent(event *events.StoryPublished) error {
 	query := bson.M{
 		"kind": "story.published",
-		"$or": []interface{}{
-			bson.M{
-				"authors": event.Content.Author,
-			},
-			bson.M{
-				"tags": bson.M{
-					"$in": event.Content.JsonMetadata.Tags,
-				},
-			},
-		},
+		"$or": append(
+			[]interface{}{watching("authors", event.Content.Author)},
+			watchingAny("tags", event.Content.JsonMetadata.Tags)...,
+		),
+	}
+	if event.Edited {
+		query["settings.skipEdits"] = bson.M{"$ne": true}
+	}
+
+	if !processor.narrowToWatchers(query, append(
+		watchKeys("story.published", "authors", event.Content.Author),
+		watchKeys("story.published", "tags", event.Content.JsonMetadata.Tags...)...,
+	)...) {
+		return nil
 	}
 
 	log.Println(query)
 
-	var result struct {
-		OwnerId bson.ObjectId `bson:"ownerId"`
-	}
-	iter := processor.db.C("events").Find(query).Iter()
+	var (
+		result struct {
+			OwnerId  bson.ObjectId `bson:"ownerId"`
+			Settings db.Settings   `bson:"settings"`
+		}
+		ownerIds []bson.ObjectId
+	)
+	iter := processor.findEvents(query)
 	for iter.Next(&result) {
+		ownerIds = append(ownerIds, result.OwnerId)
+		if !processor.sampler.sample(result.OwnerId.Hex(), "story.published", &result.Settings) {
+			processor.traceRejected(result.OwnerId.Hex(), event, "sampling", "")
+			continue
+		}
 		processor.DispatchStoryPublishedEvent(result.OwnerId.Hex(), event)
 	}
-	return errors.Wrap(iter.Err(), "failed get target users for story.published")
+	if err := iter.Err(); err != nil {
+		return errors.Wrap(err, "failed get target users for story.published")
+	}
+
+	// Track the payout so that the owners can be notified when it is approaching.
+	if !event.Edited {
+		processor.trackPost(event.Content, ownerIds)
+	}
+	return nil
 }
 
 func (processor *BlockProcessor) HandleStoryVotedEvent(event *events.StoryVoted) error {
+	pos, _ := processor.sequencer.position(event)
+	if previous, ok := processor.votes.record(event.Op, pos); ok && event.Op.Weight != 0 {
+		event.SetPreviousWeight(previous)
+	}
+
 	query := bson.M{
 		"kind": "story.voted",
 		"$or": []interface{}{
-			bson.M{
-				"authors": event.Content.Author,
-			},
-			bson.M{
-				"voters": event.Op.Voter,
-			},
+			watching("authors", event.Content.Author),
+			watching("voters", event.Op.Voter),
 		},
 	}
+	if event.Revote != nil {
+		query["settings.skipRevotes"] = bson.M{"$ne": true}
+	}
+
+	if !processor.narrowToWatchers(query, append(
+		watchKeys("story.voted", "authors", event.Content.Author),
+		watchKeys("story.voted", "voters", event.Op.Voter)...,
+	)...) {
+		return nil
+	}
 
 	log.Println(query)
 
 	var result struct {
-		OwnerId bson.ObjectId `bson:"ownerId"`
+		OwnerId  bson.ObjectId `bson:"ownerId"`
+		Settings db.Settings   `bson:"settings"`
 	}
-	iter := processor.db.C("events").Find(query).Iter()
+	iter := processor.findEvents(query)
 	for iter.Next(&result) {
+		if processor.isYoungAccount(event.Op.Voter, result.Settings.MinAccountAgeDays) {
+			processor.traceRejected(result.OwnerId.Hex(), event, "minAccountAge",
+				"@%v younger than %v days", event.Op.Voter, *result.Settings.MinAccountAgeDays)
+			continue
+		}
 		processor.DispatchStoryVotedEvent(result.OwnerId.Hex(), event)
 	}
 	return errors.Wrap(iter.Err(), "failed get target users for story.voted")
@@ -558,185 +1435,1017 @@ func (processor *BlockProcessor) HandleCommentPublishedEvent(event *events.Comme
 	query := bson.M{
 		"kind": "comment.published",
 		"$or": []interface{}{
-			bson.M{
-				"authors": event.Content.Author,
-			},
-			bson.M{
-				"parentAuthors": event.Content.ParentAuthor,
-			},
+			watching("authors", event.Content.Author),
+			watching("parentAuthors", event.Content.ParentAuthor),
 		},
 	}
+	if event.Edited {
+		query["settings.skipEdits"] = bson.M{"$ne": true}
+	}
 
 	log.Println(query)
 
+	// Nobody watching the authors still leaves the watched threads.
+	notified := make(map[bson.ObjectId]struct{})
+	if !processor.narrowToWatchers(query, append(
+		watchKeys("comment.published", "authors", event.Content.Author),
+		watchKeys("comment.published", "parentAuthors", event.Content.ParentAuthor)...,
+	)...) {
+		return processor.handleThreads(event, notified)
+	}
+
 	var result struct {
-		OwnerId bson.ObjectId `bson:"ownerId"`
+		OwnerId  bson.ObjectId `bson:"ownerId"`
+		Settings db.Settings   `bson:"settings"`
 	}
-	iter := processor.db.C("events").Find(query).Iter()
+	iter := processor.findEvents(query)
 	for iter.Next(&result) {
+		if processor.isYoungAccount(event.Content.Author, result.Settings.MinAccountAgeDays) {
+			processor.traceRejected(result.OwnerId.Hex(), event, "minAccountAge",
+				"@%v younger than %v days", event.Content.Author, *result.Settings.MinAccountAgeDays)
+			continue
+		}
+		notified[result.OwnerId] = struct{}{}
 		processor.DispatchCommentPublishedEvent(result.OwnerId.Hex(), event)
 	}
 	if err := iter.Err(); err != nil {
 		return errors.Wrap(err, "failed get target users for comment.published")
 	}
 
-	return nil
+	// Threads watched automatically.
+	return processor.handleThreads(event, notified)
 }
 
 func (processor *BlockProcessor) HandleCommentVotedEvent(event *events.CommentVoted) error {
+	pos, _ := processor.sequencer.position(event)
+	if previous, ok := processor.votes.record(event.Op, pos); ok && event.Op.Weight != 0 {
+		event.SetPreviousWeight(previous)
+	}
+
 	query := bson.M{
 		"kind": "comment.voted",
 		"$or": []interface{}{
-			bson.M{
-				"authors": event.Content.Author,
-			},
-			bson.M{
-				"voters": event.Op.Voter,
-			},
+			watching("authors", event.Content.Author),
+			watching("voters", event.Op.Voter),
 		},
 	}
+	if event.Revote != nil {
+		query["settings.skipRevotes"] = bson.M{"$ne": true}
+	}
+
+	if !processor.narrowToWatchers(query, append(
+		watchKeys("comment.voted", "authors", event.Content.Author),
+		watchKeys("comment.voted", "voters", event.Op.Voter)...,
+	)...) {
+		return nil
+	}
 
 	log.Println(query)
 
 	var result struct {
-		OwnerId bson.ObjectId `bson:"ownerId"`
+		OwnerId  bson.ObjectId `bson:"ownerId"`
+		Settings db.Settings   `bson:"settings"`
 	}
-	iter := processor.db.C("events").Find(query).Iter()
+	iter := processor.findEvents(query)
 	for iter.Next(&result) {
+		if processor.isYoungAccount(event.Op.Voter, result.Settings.MinAccountAgeDays) {
+			processor.traceRejected(result.OwnerId.Hex(), event, "minAccountAge",
+				"@%v younger than %v days", event.Op.Voter, *result.Settings.MinAccountAgeDays)
+			continue
+		}
 		processor.DispatchCommentVotedEvent(result.OwnerId.Hex(), event)
 	}
 	return errors.Wrap(iter.Err(), "failed get target users for comment.voted")
 }
 
-//==============================================================================
-// Notification dispatch
-//==============================================================================
+func (processor *BlockProcessor) HandleAccountCreationTokenClaimedEvent(
+	event *events.AccountCreationTokenClaimed,
+) error {
 
-type NotifierDoc struct {
-	NotifierId string   `bson:"notifierId"`
-	Settings   bson.Raw `bson:"settings"`
+	query := bson.M{
+		"kind":            "account.creation_token_claimed",
+		"accounts":        event.Op.Creator,
+		"paused.accounts": bson.M{"$ne": event.Op.Creator},
+	}
+
+	if !processor.narrowToWatchers(query, watchKeys("account.creation_token_claimed", "accounts", event.Op.Creator)...) {
+		return nil
+	}
+
+	log.Println(query)
+
+	var result struct {
+		OwnerId bson.ObjectId `bson:"ownerId"`
+	}
+	iter := processor.findEvents(query)
+	for iter.Next(&result) {
+		processor.DispatchAccountCreationTokenClaimedEvent(result.OwnerId.Hex(), event)
+	}
+	return errors.Wrap(iter.Err(), "failed get target users for account.creation_token_claimed")
 }
 
-func (processor *BlockProcessor) getActiveNotifiersForUser(userId string) ([]*NotifierDoc, error) {
+func (processor *BlockProcessor) HandlePayoutApproachingEvent(event *events.PayoutApproaching) error {
+	owners, err := processor.trackedPostOwners(event.Content.Author, event.Content.Permlink)
+	if err != nil {
+		return err
+	}
+	if len(owners) == 0 {
+		return nil
+	}
+
 	query := bson.M{
-		"ownerId": bson.ObjectIdHex(userId),
-		"enabled": true,
+		"kind":           "post.payout_approaching",
+		"ownerId":        bson.M{"$in": owners},
+		"paused.authors": bson.M{"$ne": event.Content.Author},
 	}
 
-	var result []*NotifierDoc
-	if err := processor.db.C("notifiers").Find(query).All(&result); err != nil {
-		return nil, err
+	log.Println(query)
+
+	var result struct {
+		OwnerId bson.ObjectId `bson:"ownerId"`
+	}
+	iter := processor.findEvents(query)
+	for iter.Next(&result) {
+		processor.DispatchPayoutApproachingEvent(result.OwnerId.Hex(), event)
 	}
-	return result, nil
+	return errors.Wrap(iter.Err(), "failed get target users for post.payout_approaching")
 }
 
-func (processor *BlockProcessor) dispatchEvent(userId string, dispatch func(Notifier, bson.Raw) error) error {
-	notifiers, err := processor.getActiveNotifiersForUser(userId)
+func (processor *BlockProcessor) HandlePostPaidOutEvent(event *events.PostPaidOut) error {
+	owners, err := processor.trackedPostOwners(event.Content.Author, event.Content.Permlink)
 	if err != nil {
-		return errors.Wrapf(err, "failed to get notifiers for user %v", userId)
+		return err
+	}
+	if len(owners) == 0 {
+		return nil
 	}
 
-	for _, notifier := range notifiers {
-		id := notifier.NotifierId
+	query := bson.M{
+		"kind":           "post.paid_out",
+		"ownerId":        bson.M{"$in": owners},
+		"paused.authors": bson.M{"$ne": event.Content.Author},
+	}
 
-		dispatcher, ok := availableNotifiers[id]
-		if !ok {
-			dispatcher, ok = processor.additionalNotifiers[id]
-			if !ok {
-				log.Printf("dispatcher not found: id=%v", id)
-				continue
-			}
-		}
+	log.Println(query)
 
-		if err := dispatch(dispatcher, notifier.Settings); err != nil {
-			log.Printf("dispatcher %v failed: %+v", id, err)
-		}
+	var result struct {
+		OwnerId bson.ObjectId `bson:"ownerId"`
+	}
+	iter := processor.findEvents(query)
+	for iter.Next(&result) {
+		processor.DispatchPostPaidOutEvent(result.OwnerId.Hex(), event)
 	}
+	return errors.Wrap(iter.Err(), "failed get target users for post.paid_out")
+}
 
-	var settings bson.Raw
-	for id, dispatcher := range processor.additionalNotifiers {
-		if err := dispatch(dispatcher, settings); err != nil {
-			log.Printf("dispatcher %v failed: %+v", id, err)
-		}
+func (processor *BlockProcessor) HandleWitnessPropertiesSetEvent(event *events.WitnessPropertiesSet) error {
+	query := bson.M{
+		"kind":             "witness.properties_set",
+		"witnesses":        event.Op.Owner,
+		"paused.witnesses": bson.M{"$ne": event.Op.Owner},
 	}
 
-	return nil
-}
+	if !processor.narrowToWatchers(query, watchKeys("witness.properties_set", "witnesses", event.Op.Owner)...) {
+		return nil
+	}
 
-func (processor *BlockProcessor) DispatchAccountUpdatedEvent(userId string, event *events.AccountUpdated) {
-	processor.t.Go(func() error {
-		return processor.dispatchEvent(userId, func(notifier Notifier, settings bson.Raw) error {
-			return notifier.DispatchAccountUpdatedEvent(userId, settings, event)
-		})
-	})
-}
+	log.Println(query)
 
-func (processor *BlockProcessor) DispatchAccountWitnessVotedEvent(
-	userId string,
-	event *events.AccountWitnessVoted,
-) {
-	processor.t.Go(func() error {
-		return processor.dispatchEvent(userId, func(notifier Notifier, settings bson.Raw) error {
-			return notifier.DispatchAccountWitnessVotedEvent(userId, settings, event)
-		})
-	})
+	var result struct {
+		OwnerId bson.ObjectId `bson:"ownerId"`
+	}
+	iter := processor.findEvents(query)
+	for iter.Next(&result) {
+		processor.DispatchWitnessPropertiesSetEvent(result.OwnerId.Hex(), event)
+	}
+	return errors.Wrap(iter.Err(), "failed get target users for witness.properties_set")
 }
 
-func (processor *BlockProcessor) DispatchTransferMadeEvent(userId string, event *events.TransferMade) {
-	processor.t.Go(func() error {
-		return processor.dispatchEvent(userId, func(notifier Notifier, settings bson.Raw) error {
-			return notifier.DispatchTransferMadeEvent(userId, settings, event)
-		})
-	})
-}
+func (processor *BlockProcessor) HandleBlockProductionRewardReceivedEvent(
+	event *events.BlockProductionRewardReceived,
+) error {
+	query := bson.M{
+		"kind":             "witness.production_reward",
+		"witnesses":        event.Op.Producer,
+		"paused.witnesses": bson.M{"$ne": event.Op.Producer},
+	}
 
-func (processor *BlockProcessor) DispatchUserMentionedEvent(userId string, event *events.UserMentioned) {
-	processor.t.Go(func() error {
-		return processor.dispatchEvent(userId, func(notifier Notifier, settings bson.Raw) error {
-			return notifier.DispatchUserMentionedEvent(userId, settings, event)
-		})
-	})
-}
+	if !processor.narrowToWatchers(query, watchKeys("witness.production_reward", "witnesses", event.Op.Producer)...) {
+		return nil
+	}
 
-func (processor *BlockProcessor) DispatchUserFollowStatusChangedEvent(
-	userId string,
-	event *events.UserFollowStatusChanged,
-) {
-	processor.t.Go(func() error {
-		return processor.dispatchEvent(userId, func(notifier Notifier, settings bson.Raw) error {
-			return notifier.DispatchUserFollowStatusChangedEvent(userId, settings, event)
-		})
-	})
+	var result struct {
+		OwnerId  bson.ObjectId `bson:"ownerId"`
+		Settings struct {
+			PerBlockRewards bool `bson:"perBlockRewards"`
+		} `bson:"settings"`
+	}
+	iter := processor.findEvents(query)
+	for iter.Next(&result) {
+		// Witnesses produce a block every few minutes, so the rewards are summed up
+		// into a daily total unless the user asked for every single block.
+		if result.Settings.PerBlockRewards {
+			processor.DispatchBlockProductionRewardReceivedEvent(result.OwnerId.Hex(), event)
+			continue
+		}
+		if err := processor.aggregateProductionReward(result.OwnerId, event); err != nil {
+			log.Printf("failed to aggregate production reward for user %v: %+v", result.OwnerId.Hex(), err)
+		}
+	}
+	return errors.Wrap(iter.Err(), "failed get target users for witness.production_reward")
 }
 
-func (processor *BlockProcessor) DispatchStoryPublishedEvent(userId string, event *events.StoryPublished) {
-	processor.t.Go(func() error {
-		return processor.dispatchEvent(userId, func(notifier Notifier, settings bson.Raw) error {
-			return notifier.DispatchStoryPublishedEvent(userId, settings, event)
-		})
-	})
-}
+func (processor *BlockProcessor) HandleCommunitySubscriptionChangedEvent(
+	event *events.CommunitySubscriptionChanged,
+) error {
 
-func (processor *BlockProcessor) DispatchStoryVotedEvent(userId string, event *events.StoryVoted) {
-	processor.t.Go(func() error {
-		return processor.dispatchEvent(userId, func(notifier Notifier, settings bson.Raw) error {
-			return notifier.DispatchStoryVotedEvent(userId, settings, event)
-		})
-	})
-}
+	query := bson.M{
+		"kind": "community.subscription_changed",
+		"$or": []interface{}{
+			watching("accounts", event.Op.Account),
+			watching("communities", event.Op.Community),
+		},
+	}
 
-func (processor *BlockProcessor) DispatchCommentPublishedEvent(userId string, event *events.CommentPublished) {
-	processor.t.Go(func() error {
-		return processor.dispatchEvent(userId, func(notifier Notifier, settings bson.Raw) error {
-			return notifier.DispatchCommentPublishedEvent(userId, settings, event)
-		})
-	})
+	if !processor.narrowToWatchers(query, append(
+		watchKeys("community.subscription_changed", "accounts", event.Op.Account),
+		watchKeys("community.subscription_changed", "communities", event.Op.Community)...,
+	)...) {
+		return nil
+	}
+
+	log.Println(query)
+
+	var result struct {
+		OwnerId bson.ObjectId `bson:"ownerId"`
+	}
+	iter := processor.findEvents(query)
+	for iter.Next(&result) {
+		processor.DispatchCommunitySubscriptionChangedEvent(result.OwnerId.Hex(), event)
+	}
+	return errors.Wrap(iter.Err(), "failed get target users for community.subscription_changed")
 }
 
-func (processor *BlockProcessor) DispatchCommentVotedEvent(userId string, event *events.CommentVoted) {
-	processor.t.Go(func() error {
-		return processor.dispatchEvent(userId, func(notifier Notifier, settings bson.Raw) error {
-			return notifier.DispatchCommentVotedEvent(userId, settings, event)
+func (processor *BlockProcessor) HandleCommunityRoleChangedEvent(event *events.CommunityRoleChanged) error {
+	query := bson.M{
+		"kind": "community.role_changed",
+		"$or": []interface{}{
+			watching("accounts", event.Op.Account),
+			watching("accounts", event.Op.Target),
+			watching("communities", event.Op.Community),
+		},
+	}
+
+	if !processor.narrowToWatchers(query, append(
+		watchKeys("community.role_changed", "accounts", event.Op.Account, event.Op.Target),
+		watchKeys("community.role_changed", "communities", event.Op.Community)...,
+	)...) {
+		return nil
+	}
+
+	log.Println(query)
+
+	var result struct {
+		OwnerId bson.ObjectId `bson:"ownerId"`
+	}
+	iter := processor.findEvents(query)
+	for iter.Next(&result) {
+		processor.DispatchCommunityRoleChangedEvent(result.OwnerId.Hex(), event)
+	}
+	return errors.Wrap(iter.Err(), "failed get target users for community.role_changed")
+}
+
+func (processor *BlockProcessor) HandleNewPayerDetectedEvent(event *events.NewPayerDetected) error {
+	query := bson.M{
+		"kind":          "transfer.new_payer",
+		"payees":        event.Op.To,
+		"paused.payees": bson.M{"$ne": event.Op.To},
+	}
+
+	if !processor.narrowToWatchers(query, watchKeys("transfer.new_payer", "payees", event.Op.To)...) {
+		return nil
+	}
+
+	log.Println(query)
+
+	var (
+		result struct {
+			OwnerId  bson.ObjectId `bson:"ownerId"`
+			Settings db.Settings   `bson:"settings"`
+		}
+		targets []bson.ObjectId
+		limits  []uint
+	)
+	iter := processor.findEvents(query)
+	for iter.Next(&result) {
+		targets = append(targets, result.OwnerId)
+		limits = append(limits, result.Settings.NewPayerTransferCount())
+	}
+	if err := iter.Err(); err != nil {
+		return errors.Wrap(err, "failed get target users for transfer.new_payer")
+	}
+
+	// Payers are only tracked for the accounts somebody is watching.
+	if len(targets) == 0 {
+		return nil
+	}
+
+	transfers, err := processor.recordPayer(event.Op.To, event.Op.From)
+	if err != nil {
+		return err
+	}
+	event.Transfers = transfers
+
+	for i, ownerId := range targets {
+		if transfers <= limits[i] {
+			processor.DispatchNewPayerDetectedEvent(ownerId.Hex(), event)
+		}
+	}
+	return nil
+}
+
+func (processor *BlockProcessor) HandleCustomJSONBroadcastEvent(event *events.CustomJSONBroadcast) error {
+	patterns := customJSONPatterns(event.Op.ID)
+	query := bson.M{
+		"kind":       "custom_json.firehose",
+		"ids":        bson.M{"$in": patterns},
+		"paused.ids": bson.M{"$nin": patterns},
+	}
+
+	if !processor.narrowToWatchers(query, watchKeys("custom_json.firehose", "ids", patterns...)...) {
+		return nil
+	}
+
+	var (
+		result struct {
+			OwnerId  bson.ObjectId `bson:"ownerId"`
+			Settings db.Settings   `bson:"settings"`
+		}
+		ownerIds []bson.ObjectId
+		push     = make(map[bson.ObjectId]bool)
+	)
+	iter := processor.findEvents(query)
+	for iter.Next(&result) {
+		if !processor.sampler.sample(result.OwnerId.Hex(), "custom_json.firehose", &result.Settings) {
+			continue
+		}
+		ownerIds = append(ownerIds, result.OwnerId)
+		push[result.OwnerId] = result.Settings.FirehosePush != nil && *result.Settings.FirehosePush
+	}
+	if err := iter.Err(); err != nil {
+		return errors.Wrap(err, "failed get target users for custom_json.firehose")
+	}
+	if len(ownerIds) == 0 {
+		return nil
+	}
+
+	// The firehose is only available to the users it was granted to.
+	grants, err := processor.firehoseGrants(ownerIds)
+	if err != nil {
+		return err
+	}
+	for ownerId, grant := range grants {
+		userId := ownerId.Hex()
+		if !processor.firehose.allow(userId, processor.firehoseRate(grant)) {
+			continue
+		}
+		if push[ownerId] {
+			processor.DispatchCustomJSONBroadcastEvent(userId, event)
+		} else {
+			processor.streamEvent(userId, event)
+		}
+	}
+	return nil
+}
+
+func (processor *BlockProcessor) HandleAccountCreatedEvent(event *events.AccountCreated) error {
+	query := bson.M{
+		"kind": "account.created",
+		"$or": []interface{}{
+			watching("accounts", event.Op.Creator),
+			watching("accounts", event.Op.NewAccountName),
+		},
+	}
+
+	if !processor.narrowToWatchers(query, watchKeys("account.created", "accounts", event.Op.Creator, event.Op.NewAccountName)...) {
+		return nil
+	}
+
+	log.Println(query)
+
+	var result struct {
+		OwnerId bson.ObjectId `bson:"ownerId"`
+	}
+	iter := processor.findEvents(query)
+	for iter.Next(&result) {
+		processor.DispatchAccountCreatedEvent(result.OwnerId.Hex(), event)
+	}
+	return errors.Wrap(iter.Err(), "failed get target users for account.created")
+}
+
+// HandleHardforkActivatedEvent broadcasts the event, there are no subscriptions for it.
+func (processor *BlockProcessor) HandleHardforkActivatedEvent(event *events.HardforkActivated) error {
+	log.Printf("hardfork %v activated", event.Op.HardforkId)
+	processor.broadcast(event)
+	return nil
+}
+
+func (processor *BlockProcessor) HandleAccountActivityEvent(event *events.AccountActivity) error {
+	query := bson.M{
+		"kind": "account.activity",
+		"$or":  watchingAny("accounts", event.Accounts),
+	}
+
+	if !processor.narrowToWatchers(query, watchKeys("account.activity", "accounts", event.Accounts...)...) {
+		return nil
+	}
+
+	var result struct {
+		OwnerId bson.ObjectId `bson:"ownerId"`
+	}
+	iter := processor.findEvents(query)
+	for iter.Next(&result) {
+		// Very active accounts produce a lot, so the activity is rate limited per user.
+		userId := result.OwnerId.Hex()
+		if !processor.activity.allow(userId, processor.activityRateLimit) {
+			processor.traceRejected(userId, event, "rateLimit", "%v per minute", processor.activityRateLimit)
+			continue
+		}
+		processor.DispatchAccountActivityEvent(userId, event)
+	}
+	return errors.Wrap(iter.Err(), "failed get target users for account.activity")
+}
+
+func (processor *BlockProcessor) HandleRCDelegatedEvent(event *events.RCDelegated) error {
+	query := bson.M{
+		"kind": "rc.delegated",
+		"$or": []interface{}{
+			watching("accounts", event.Op.Delegator),
+			watching("accounts", event.Op.Delegatee),
+		},
+	}
+
+	if !processor.narrowToWatchers(query, watchKeys("rc.delegated", "accounts", event.Op.Delegator, event.Op.Delegatee)...) {
+		return nil
+	}
+
+	log.Println(query)
+
+	var result struct {
+		OwnerId bson.ObjectId `bson:"ownerId"`
+	}
+	iter := processor.findEvents(query)
+	for iter.Next(&result) {
+		processor.DispatchRCDelegatedEvent(result.OwnerId.Hex(), event)
+	}
+	return errors.Wrap(iter.Err(), "failed get target users for rc.delegated")
+}
+
+func (processor *BlockProcessor) HandleRCDelegationRemovedEvent(event *events.RCDelegationRemoved) error {
+	query := bson.M{
+		"kind": "rc.delegation_removed",
+		"$or": []interface{}{
+			watching("accounts", event.Op.Delegator),
+			watching("accounts", event.Op.Delegatee),
+		},
+	}
+
+	if !processor.narrowToWatchers(query, watchKeys("rc.delegation_removed", "accounts", event.Op.Delegator, event.Op.Delegatee)...) {
+		return nil
+	}
+
+	log.Println(query)
+
+	var result struct {
+		OwnerId bson.ObjectId `bson:"ownerId"`
+	}
+	iter := processor.findEvents(query)
+	for iter.Next(&result) {
+		processor.DispatchRCDelegationRemovedEvent(result.OwnerId.Hex(), event)
+	}
+	return errors.Wrap(iter.Err(), "failed get target users for rc.delegation_removed")
+}
+
+func (processor *BlockProcessor) HandleWitnessFeedStaleEvent(event *events.WitnessFeedStale) error {
+	query := bson.M{
+		"kind":             "witness.feed_stale",
+		"witnesses":        event.Witness,
+		"paused.witnesses": bson.M{"$ne": event.Witness},
+	}
+
+	if !processor.narrowToWatchers(query, watchKeys("witness.feed_stale", "witnesses", event.Witness)...) {
+		return nil
+	}
+
+	log.Println(query)
+
+	var result struct {
+		OwnerId bson.ObjectId `bson:"ownerId"`
+	}
+	iter := processor.findEvents(query)
+	for iter.Next(&result) {
+		processor.DispatchWitnessFeedStaleEvent(result.OwnerId.Hex(), event)
+	}
+	return errors.Wrap(iter.Err(), "failed get target users for witness.feed_stale")
+}
+
+func (processor *BlockProcessor) HandleWitnessFeedRecoveredEvent(event *events.WitnessFeedRecovered) error {
+	query := bson.M{
+		"kind":             "witness.feed_recovered",
+		"witnesses":        event.Witness,
+		"paused.witnesses": bson.M{"$ne": event.Witness},
+	}
+
+	if !processor.narrowToWatchers(query, watchKeys("witness.feed_recovered", "witnesses", event.Witness)...) {
+		return nil
+	}
+
+	log.Println(query)
+
+	var result struct {
+		OwnerId bson.ObjectId `bson:"ownerId"`
+	}
+	iter := processor.findEvents(query)
+	for iter.Next(&result) {
+		processor.DispatchWitnessFeedRecoveredEvent(result.OwnerId.Hex(), event)
+	}
+	return errors.Wrap(iter.Err(), "failed get target users for witness.feed_recovered")
+}
+
+//==============================================================================
+// Notification dispatch
+//==============================================================================
+
+type NotifierDoc struct {
+	NotifierId string   `bson:"notifierId"`
+	Settings   bson.Raw `bson:"settings"`
+}
+
+func (processor *BlockProcessor) getActiveNotifiersForUser(userId string) ([]*NotifierDoc, error) {
+	v, err := processor.configs.get(userId, "notifiers", func() (interface{}, error) {
+		query := bson.M{
+			"ownerId": bson.ObjectIdHex(userId),
+			"enabled": true,
+		}
+
+		var result []*NotifierDoc
+		if err := processor.db.C("notifiers").Find(query).All(&result); err != nil {
+			return nil, err
+		}
+		return result, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]*NotifierDoc), nil
+}
+
+func (processor *BlockProcessor) dispatchEvent(
+	userId string,
+	event interface{},
+	dispatch func(Notifier, bson.Raw, *UserDoc) error,
+) error {
+	return processor.dispatchUserEvent(userId, event, false, dispatch)
+}
+
+// dispatchUserEvent dispatches the event to the user. The ingested events,
+// i.e. the events forwarded by other instances, are not forwarded again.
+func (processor *BlockProcessor) dispatchUserEvent(
+	userId string,
+	event interface{},
+	ingested bool,
+	dispatch func(Notifier, bson.Raw, *UserDoc) error,
+) error {
+
+	trace := processor.startTrace(userId, event)
+
+	if processor.duplicate(userId, event) {
+		trace.reject("dedup", "already dispatched")
+		return nil
+	}
+	if processor.collapser.repeated(userId, event) {
+		trace.reject("collapse", "identical to the previous event")
+		return nil
+	}
+
+	user, err := processor.getUser(userId)
+	if err != nil {
+		trace.reject("user", "%v", err)
+		return errors.Wrapf(err, "failed to get user %v", userId)
+	}
+	if user.mutes(event) {
+		trace.reject("mutedWords", "")
+		return nil
+	}
+	trace.step("mutedWords", TracePassed, "")
+	if actor, ok := eventActor(event); ok {
+		if processor.isYoungAccount(actor, user.Settings.MinAccountAgeDays) {
+			trace.reject("minAccountAge", "@%v younger than %v days", actor, *user.Settings.MinAccountAgeDays)
+			return nil
+		}
+		trace.step("minAccountAge", TracePassed, "")
+	}
+
+	match := processor.matchedBy(userId, event)
+	if match.reason != "" {
+		trace.step("matchedBy", TracePassed, "%v", match.reason)
+	}
+
+	historyId := processor.recordHistory(userId, user, event, match.labels)
+
+	// Outside of the schedule of the subscription, the event only goes to the history.
+	if !match.active(time.Now()) {
+		trace.reject("schedule", "outside the schedule of %v", match.reason)
+		return nil
+	}
+
+	// Catching up after startup, the event only goes to the history.
+	if processor.suppressedByWarmup(event) {
+		trace.reject("warmup", "stale block processed during the warmup")
+		return nil
+	}
+
+	var targets []*deliveryTarget
+
+	// Outside of the active window the event is held for the user's notifiers
+	// to be delivered later as a digest. The event stream still gets it right away.
+	if user.Settings.ActiveWindow.Contains(time.Now()) {
+		targets, err = processor.getUserTargets(userId)
+		if err != nil {
+			trace.reject("notifiers", "%v", err)
+			return err
+		}
+		trace.step("activeWindow", TracePassed, "%v notifiers enabled", len(targets))
+	} else if err := processor.holdEvent(userId, event); err != nil {
+		trace.step("activeWindow", TraceFailed, "failed to hold the event: %v", err)
+		trace.save()
+		return errors.Wrapf(err, "failed to hold event for user %v", userId)
+	} else {
+		trace.step("activeWindow", TraceHeld, "held for the digest")
+	}
+
+	var settings bson.Raw
+	for id, dispatcher := range processor.additionalNotifiers {
+		targets = append(targets, &deliveryTarget{
+			notifierId: id,
+			dispatcher: dispatcher,
+			settings:   settings,
+		})
+	}
+
+	if ingested {
+		targets = skipForwarders(targets)
+	}
+
+	// The position is looked up now, it is forgotten once the block is acknowledged.
+	pos, _ := processor.sequencer.position(event)
+
+	// With ordered delivery the event waits until all the preceding events are delivered.
+	if user.Settings.OrderedDelivery != nil && *user.Settings.OrderedDelivery {
+		if pos != nil {
+			trace.step("orderedDelivery", TracePassed, "waiting for block %v, index %v", pos.block, pos.index)
+		}
+		processor.sequencer.submit(userId, pos, func(seq uint64) {
+			processor.deliverTargets(userId, event, user, historyId, match, targets, pos, seq, dispatch, trace)
+		})
+		return nil
+	}
+
+	processor.deliverTargets(userId, event, user, historyId, match, targets, pos, 0, dispatch, trace)
+	return nil
+}
+
+// deliverTargets delivers the event to the targets according to the user's delivery mode.
+// The sequence number is passed on to the notifiers that support it, unless it is 0.
+// The delivery latency is measured from the timestamp of the block at pos, which can be nil.
+func (processor *BlockProcessor) deliverTargets(
+	userId string,
+	event interface{},
+	user *UserDoc,
+	historyId bson.ObjectId,
+	match subscriptionMatch,
+	targets []*deliveryTarget,
+	pos *eventPosition,
+	seq uint64,
+	dispatch func(Notifier, bson.Raw, *UserDoc) error,
+	trace *eventTrace,
+) {
+	defer trace.save()
+
+	title := user.eventTitle(userId, event)
+
+	send := func(target *deliveryTarget) error {
+		notifier, settings := target.dispatcher, target.settings
+		if sn, ok := notifier.(SequencedNotifier); ok && seq != 0 {
+			notifier = sn.Sequenced(seq)
+		}
+		notifier = matchedNotifier(notifier, match)
+		notifier = operationNotifier(notifier, pos)
+
+		// The filtered event is a copy, so it goes through the generic path.
+		if filter := user.Settings.PayloadFields[target.notifierId]; !filter.Empty() {
+			filtered, err := filterFields(processor.userEvent(user, event), filter)
+			if err != nil {
+				return errors.Wrapf(err, "failed to filter fields for notifier %v", target.notifierId)
+			}
+			if tn, ok := notifier.(TitledNotifier); ok {
+				return tn.DispatchTitled(userId, settings, filtered, user.eventTitle(userId, filtered))
+			}
+			return notify(notifier, userId, settings, filtered)
+		}
+
+		if tn, ok := notifier.(TitledNotifier); ok {
+			return tn.DispatchTitled(userId, settings, processor.userEvent(user, event), title)
+		}
+		return dispatch(notifier, settings, user)
+	}
+
+	fn := func(target *deliveryTarget) error {
+		err := send(target)
+		if err == nil && pos != nil && !pos.timestamp.IsZero() {
+			metrics.ObserveDelivery(eventKind(event), target.notifierId, pos.timestamp)
+		}
+		return err
+	}
+
+	// In the fallback mode the user's notifiers are tried one by one
+	// while the additional notifiers still receive the event in parallel.
+	var delivered []string
+	if user.usesFallback() {
+		var userTargets, otherTargets []*deliveryTarget
+		for _, target := range targets {
+			if target.record {
+				userTargets = append(userTargets, target)
+			} else {
+				otherTargets = append(otherTargets, target)
+			}
+		}
+
+		if len(userTargets) != 0 {
+			orderTargets(userTargets, user.Settings.FallbackChain)
+			delivered = processor.deliverFirst(userId, event, userTargets, fn, trace)
+			if len(delivered) != 0 {
+				processor.recordDeliveredVia(historyId, delivered[0])
+			}
+		}
+		targets = otherTargets
+	}
+
+	delivered = append(delivered,
+		processor.deliver(userId, event, targets, processor.notifierConcurrency(user), fn, trace)...)
+
+	if processor.audit != nil && len(delivered) != 0 {
+		processor.recordAudit(userId, event, delivered)
+	}
+}
+
+// goDispatch runs the dispatch in the background.
+// The sequencer is told synchronously so that it knows the dispatch is in flight.
+// The dispatch failing on the database being unavailable, e.g. for a user not cached yet,
+// is skipped so that the processor keeps running.
+// The dispatch delayed by the fan-out limiter goes out right away when the processor is stopped,
+// the same way the held round-trip transfers are passed on, so that it is not lost.
+func (processor *BlockProcessor) goDispatch(event interface{}, dispatch func() error) {
+	done := processor.sequencer.begin(event)
+	delay := processor.fanout.begin(event)
+	processor.t.Go(func() error {
+		defer done()
+		if delay != 0 {
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+			case <-processor.t.Dying():
+				timer.Stop()
+			}
+		}
+		return processor.skipUnavailable(eventKind(event)+" dispatch", dispatch())
+	})
+}
+
+// getUserTargets returns the delivery targets for the notifiers enabled by the user.
+func (processor *BlockProcessor) getUserTargets(userId string) ([]*deliveryTarget, error) {
+	notifiers, err := processor.getActiveNotifiersForUser(userId)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get notifiers for user %v", userId)
+	}
+
+	targets := make([]*deliveryTarget, 0, len(notifiers)+len(processor.additionalNotifiers))
+	for _, notifier := range notifiers {
+		id := notifier.NotifierId
+
+		dispatcher, ok := availableNotifiers[id]
+		if !ok {
+			dispatcher, ok = processor.additionalNotifiers[id]
+			if !ok {
+				log.Printf("dispatcher not found: id=%v", id)
+				continue
+			}
+		}
+
+		targets = append(targets, &deliveryTarget{
+			notifierId: id,
+			dispatcher: dispatcher,
+			settings:   notifier.Settings,
+			record:     true,
+		})
+	}
+	return targets, nil
+}
+
+func (processor *BlockProcessor) DispatchAccountUpdatedEvent(userId string, event *events.AccountUpdated) {
+	processor.goDispatch(event, func() error {
+		return processor.dispatchEvent(userId, event, func(notifier Notifier, settings bson.Raw, _ *UserDoc) error {
+			return notifier.DispatchAccountUpdatedEvent(userId, settings, event)
+		})
+	})
+}
+
+func (processor *BlockProcessor) DispatchAccountWitnessVotedEvent(
+	userId string,
+	event *events.AccountWitnessVoted,
+) {
+	processor.goDispatch(event, func() error {
+		return processor.dispatchEvent(userId, event, func(notifier Notifier, settings bson.Raw, _ *UserDoc) error {
+			return notifier.DispatchAccountWitnessVotedEvent(userId, settings, event)
+		})
+	})
+}
+
+func (processor *BlockProcessor) DispatchTransferMadeEvent(userId string, event *events.TransferMade) {
+	processor.goDispatch(event, func() error {
+		return processor.dispatchEvent(userId, event, func(notifier Notifier, settings bson.Raw, user *UserDoc) error {
+			return notifier.DispatchTransferMadeEvent(userId, settings, processor.annotateTransfer(user, event))
+		})
+	})
+}
+
+func (processor *BlockProcessor) DispatchUserMentionedEvent(userId string, event *events.UserMentioned) {
+	processor.goDispatch(event, func() error {
+		return processor.dispatchEvent(userId, event, func(notifier Notifier, settings bson.Raw, _ *UserDoc) error {
+			return notifier.DispatchUserMentionedEvent(userId, settings, event)
+		})
+	})
+}
+
+func (processor *BlockProcessor) DispatchUserFollowStatusChangedEvent(
+	userId string,
+	event *events.UserFollowStatusChanged,
+) {
+	processor.goDispatch(event, func() error {
+		return processor.dispatchEvent(userId, event, func(notifier Notifier, settings bson.Raw, _ *UserDoc) error {
+			return notifier.DispatchUserFollowStatusChangedEvent(userId, settings, event)
+		})
+	})
+}
+
+func (processor *BlockProcessor) DispatchStoryPublishedEvent(userId string, event *events.StoryPublished) {
+	processor.goDispatch(event, func() error {
+		return processor.dispatchEvent(userId, event, func(notifier Notifier, settings bson.Raw, _ *UserDoc) error {
+			return notifier.DispatchStoryPublishedEvent(userId, settings, event)
+		})
+	})
+}
+
+func (processor *BlockProcessor) DispatchStoryVotedEvent(userId string, event *events.StoryVoted) {
+	processor.goDispatch(event, func() error {
+		return processor.dispatchEvent(userId, event, func(notifier Notifier, settings bson.Raw, _ *UserDoc) error {
+			return notifier.DispatchStoryVotedEvent(userId, settings, event)
+		})
+	})
+}
+
+func (processor *BlockProcessor) DispatchCommentPublishedEvent(userId string, event *events.CommentPublished) {
+	processor.goDispatch(event, func() error {
+		return processor.dispatchEvent(userId, event, func(notifier Notifier, settings bson.Raw, _ *UserDoc) error {
+			return notifier.DispatchCommentPublishedEvent(userId, settings, event)
+		})
+	})
+}
+
+func (processor *BlockProcessor) DispatchCommentVotedEvent(userId string, event *events.CommentVoted) {
+	processor.goDispatch(event, func() error {
+		return processor.dispatchEvent(userId, event, func(notifier Notifier, settings bson.Raw, _ *UserDoc) error {
+			return notifier.DispatchCommentVotedEvent(userId, settings, event)
+		})
+	})
+}
+
+func (processor *BlockProcessor) DispatchAccountCreationTokenClaimedEvent(userId string, event *events.AccountCreationTokenClaimed) {
+	processor.goDispatch(event, func() error {
+		return processor.dispatchEvent(userId, event, func(notifier Notifier, settings bson.Raw, _ *UserDoc) error {
+			return notifier.DispatchAccountCreationTokenClaimedEvent(userId, settings, event)
+		})
+	})
+}
+
+func (processor *BlockProcessor) DispatchPayoutApproachingEvent(userId string, event *events.PayoutApproaching) {
+	processor.goDispatch(event, func() error {
+		return processor.dispatchEvent(userId, event, func(notifier Notifier, settings bson.Raw, _ *UserDoc) error {
+			return notifier.DispatchPayoutApproachingEvent(userId, settings, event)
+		})
+	})
+}
+
+func (processor *BlockProcessor) DispatchPostPaidOutEvent(userId string, event *events.PostPaidOut) {
+	processor.goDispatch(event, func() error {
+		return processor.dispatchEvent(userId, event, func(notifier Notifier, settings bson.Raw, _ *UserDoc) error {
+			return notifier.DispatchPostPaidOutEvent(userId, settings, event)
+		})
+	})
+}
+
+func (processor *BlockProcessor) DispatchWitnessPropertiesSetEvent(userId string, event *events.WitnessPropertiesSet) {
+	processor.goDispatch(event, func() error {
+		return processor.dispatchEvent(userId, event, func(notifier Notifier, settings bson.Raw, _ *UserDoc) error {
+			return notifier.DispatchWitnessPropertiesSetEvent(userId, settings, event)
+		})
+	})
+}
+
+func (processor *BlockProcessor) DispatchBlockProductionRewardReceivedEvent(userId string, event *events.BlockProductionRewardReceived) {
+	processor.goDispatch(event, func() error {
+		return processor.dispatchEvent(userId, event, func(notifier Notifier, settings bson.Raw, _ *UserDoc) error {
+			return notifier.DispatchBlockProductionRewardReceivedEvent(userId, settings, event)
+		})
+	})
+}
+
+func (processor *BlockProcessor) DispatchCommunitySubscriptionChangedEvent(userId string, event *events.CommunitySubscriptionChanged) {
+	processor.goDispatch(event, func() error {
+		return processor.dispatchEvent(userId, event, func(notifier Notifier, settings bson.Raw, _ *UserDoc) error {
+			return notifier.DispatchCommunitySubscriptionChangedEvent(userId, settings, event)
+		})
+	})
+}
+
+func (processor *BlockProcessor) DispatchCommunityRoleChangedEvent(userId string, event *events.CommunityRoleChanged) {
+	processor.goDispatch(event, func() error {
+		return processor.dispatchEvent(userId, event, func(notifier Notifier, settings bson.Raw, _ *UserDoc) error {
+			return notifier.DispatchCommunityRoleChangedEvent(userId, settings, event)
+		})
+	})
+}
+
+func (processor *BlockProcessor) DispatchNewPayerDetectedEvent(userId string, event *events.NewPayerDetected) {
+	processor.goDispatch(event, func() error {
+		return processor.dispatchEvent(userId, event, func(notifier Notifier, settings bson.Raw, _ *UserDoc) error {
+			return notifier.DispatchNewPayerDetectedEvent(userId, settings, event)
+		})
+	})
+}
+
+func (processor *BlockProcessor) DispatchCustomJSONBroadcastEvent(userId string, event *events.CustomJSONBroadcast) {
+	processor.goDispatch(event, func() error {
+		return processor.dispatchEvent(userId, event, func(notifier Notifier, settings bson.Raw, _ *UserDoc) error {
+			return notifier.DispatchCustomJSONBroadcastEvent(userId, settings, event)
+		})
+	})
+}
+
+func (processor *BlockProcessor) DispatchAccountCreatedEvent(userId string, event *events.AccountCreated) {
+	processor.goDispatch(event, func() error {
+		return processor.dispatchEvent(userId, event, func(notifier Notifier, settings bson.Raw, _ *UserDoc) error {
+			return notifier.DispatchAccountCreatedEvent(userId, settings, event)
+		})
+	})
+}
+
+func (processor *BlockProcessor) DispatchAccountActivityEvent(userId string, event *events.AccountActivity) {
+	processor.goDispatch(event, func() error {
+		return processor.dispatchEvent(userId, event, func(notifier Notifier, settings bson.Raw, _ *UserDoc) error {
+			return notifier.DispatchAccountActivityEvent(userId, settings, event)
+		})
+	})
+}
+
+func (processor *BlockProcessor) DispatchRCDelegatedEvent(userId string, event *events.RCDelegated) {
+	processor.goDispatch(event, func() error {
+		return processor.dispatchEvent(userId, event, func(notifier Notifier, settings bson.Raw, _ *UserDoc) error {
+			return notifier.DispatchRCDelegatedEvent(userId, settings, event)
+		})
+	})
+}
+
+func (processor *BlockProcessor) DispatchRCDelegationRemovedEvent(userId string, event *events.RCDelegationRemoved) {
+	processor.goDispatch(event, func() error {
+		return processor.dispatchEvent(userId, event, func(notifier Notifier, settings bson.Raw, _ *UserDoc) error {
+			return notifier.DispatchRCDelegationRemovedEvent(userId, settings, event)
+		})
+	})
+}
+
+func (processor *BlockProcessor) DispatchWitnessFeedStaleEvent(userId string, event *events.WitnessFeedStale) {
+	processor.goDispatch(event, func() error {
+		return processor.dispatchEvent(userId, event, func(notifier Notifier, settings bson.Raw, _ *UserDoc) error {
+			return notifier.DispatchWitnessFeedStaleEvent(userId, settings, event)
+		})
+	})
+}
+
+func (processor *BlockProcessor) DispatchWitnessFeedRecoveredEvent(userId string, event *events.WitnessFeedRecovered) {
+	processor.goDispatch(event, func() error {
+		return processor.dispatchEvent(userId, event, func(notifier Notifier, settings bson.Raw, _ *UserDoc) error {
+			return notifier.DispatchWitnessFeedRecoveredEvent(userId, settings, event)
 		})
 	})
 }
@@ -0,0 +1,112 @@
+package notifications
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = 5 * time.Minute
+)
+
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// circuitBreaker stops deliveries to an endpoint that keeps failing.
+//
+// It opens after threshold consecutive failures. Once the cooldown passes,
+// a single delivery is let through to test whether the endpoint recovered.
+type circuitBreaker struct {
+	state    string
+	failures uint
+	openedAt time.Time
+	probing  bool
+}
+
+type circuitBreakers struct {
+	threshold uint
+	cooldown  time.Duration
+
+	breakers map[string]*circuitBreaker
+	lock     *sync.Mutex
+}
+
+func newCircuitBreakers(threshold uint, cooldown time.Duration) *circuitBreakers {
+	return &circuitBreakers{
+		threshold: threshold,
+		cooldown:  cooldown,
+		breakers:  make(map[string]*circuitBreaker),
+		lock:      &sync.Mutex{},
+	}
+}
+
+func breakerKey(userId, notifierId string) string {
+	return userId + "/" + notifierId
+}
+
+// allow returns false when the delivery is to be short-circuited.
+func (cbs *circuitBreakers) allow(key string) bool {
+	if cbs.threshold == 0 {
+		return true
+	}
+
+	cbs.lock.Lock()
+	defer cbs.lock.Unlock()
+
+	cb, ok := cbs.breakers[key]
+	if !ok {
+		return true
+	}
+
+	switch cb.state {
+	case BreakerOpen:
+		if time.Since(cb.openedAt) < cbs.cooldown {
+			return false
+		}
+		cb.state = BreakerHalfOpen
+		cb.probing = true
+		return true
+	case BreakerHalfOpen:
+		// Only a single probe at a time.
+		if cb.probing {
+			return false
+		}
+		cb.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// report updates the breaker with the delivery result and returns the new state.
+func (cbs *circuitBreakers) report(key string, err error) string {
+	if cbs.threshold == 0 {
+		return ""
+	}
+
+	cbs.lock.Lock()
+	defer cbs.lock.Unlock()
+
+	if err == nil {
+		delete(cbs.breakers, key)
+		return BreakerClosed
+	}
+
+	cb, ok := cbs.breakers[key]
+	if !ok {
+		cb = &circuitBreaker{state: BreakerClosed}
+		cbs.breakers[key] = cb
+	}
+
+	cb.failures++
+	cb.probing = false
+	if cb.state == BreakerHalfOpen || cb.failures >= cbs.threshold {
+		cb.state = BreakerOpen
+		cb.openedAt = time.Now()
+	}
+	return cb.state
+}
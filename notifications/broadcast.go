@@ -0,0 +1,29 @@
+package notifications
+
+import (
+	"log"
+)
+
+// Broadcaster is implemented by the additional notifiers that can send an event
+// to all their users at once, e.g. the event stream sending it to all connected users.
+// The global events nobody subscribes to are only delivered this way.
+type Broadcaster interface {
+	Broadcast(event interface{}) error
+}
+
+// broadcast sends the event using all the additional notifiers that are broadcasters.
+// The event is not recorded in the history.
+func (processor *BlockProcessor) broadcast(event interface{}) {
+	// Catching up after startup, the global events are old news.
+	if processor.suppressedByWarmup(event) {
+		return
+	}
+
+	for id, notifier := range processor.additionalNotifiers {
+		if broadcaster, ok := notifier.(Broadcaster); ok {
+			if err := broadcaster.Broadcast(event); err != nil {
+				log.Printf("broadcaster %v failed: %+v", id, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package notifications
+
+import (
+	"log"
+	"sort"
+	"time"
+
+	"github.com/tchap/steemwatch/notifications/events"
+)
+
+// Capabilities describes what the block processor of this deployment is watching for.
+// The document is stored in the configuration collection on startup
+// so that the web server can report it.
+type Capabilities struct {
+	Id         string          `json:"-"          bson:"_id"`
+	OpTypes    []string        `json:"opTypes"    bson:"opTypes"`
+	EventKinds []string        `json:"eventKinds" bson:"eventKinds"`
+	Notifiers  []string        `json:"notifiers"  bson:"notifiers"`
+	Features   map[string]bool `json:"features"   bson:"features"`
+	UpdatedAt  time.Time       `json:"updatedAt"  bson:"updatedAt"`
+}
+
+const CapabilitiesId = "Capabilities"
+
+func (processor *BlockProcessor) capabilities() *Capabilities {
+	opTypes := make([]string, 0, len(processor.eventMiners))
+	for opType, miners := range processor.eventMiners {
+		if len(miners) != 0 {
+			opTypes = append(opTypes, string(opType))
+		}
+	}
+	sort.Strings(opTypes)
+
+	kinds := make([]string, 0, len(events.Types))
+	for kind := range events.Types {
+		if processor.eventKindEnabled(kind) {
+			kinds = append(kinds, kind)
+		}
+	}
+	sort.Strings(kinds)
+
+	notifiers := make([]string, 0, len(availableNotifiers)+len(processor.additionalNotifiers))
+	for id := range availableNotifiers {
+		notifiers = append(notifiers, id)
+	}
+	for id := range processor.additionalNotifiers {
+		notifiers = append(notifiers, id)
+	}
+	sort.Strings(notifiers)
+
+	return &Capabilities{
+		Id:         CapabilitiesId,
+		OpTypes:    opTypes,
+		EventKinds: kinds,
+		Notifiers:  notifiers,
+		Features: map[string]bool{
+			"audit":           processor.audit != nil,
+			"circuitBreakers": processor.breakers.threshold != 0,
+			// Only the irreversible blocks are processed, see Run.
+			"irreversibleOnly": true,
+			"payoutReminders":  len(processor.payoutLeadTimes) != 0,
+		},
+		UpdatedAt: time.Now(),
+	}
+}
+
+func (processor *BlockProcessor) storeCapabilities() {
+	caps := processor.capabilities()
+	if _, err := processor.db.C("configuration").UpsertId(caps.Id, caps); err != nil {
+		log.Printf("failed to store capabilities: %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package notifications
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultCollapseWindow is for how long an event identical to the previous one
+// dispatched to the same user is suppressed.
+const DefaultCollapseWindow = 10 * time.Second
+
+// collapseSize is the number of users tracked before the expired records are dropped.
+const collapseSize = 10000
+
+type lastEvent struct {
+	id string
+	at time.Time
+}
+
+// collapser suppresses an event identical to the one dispatched to the user right before,
+// which is what a double push caused by a replay looks like. Unlike the dedup set
+// it only compares the content of the events, so it works for any event.
+type collapser struct {
+	window time.Duration
+	last   map[string]lastEvent
+	lock   *sync.Mutex
+}
+
+func newCollapser(window time.Duration) *collapser {
+	return &collapser{
+		window: window,
+		last:   make(map[string]lastEvent),
+		lock:   &sync.Mutex{},
+	}
+}
+
+// repeated records the event as the last one dispatched to the user and returns true
+// when the previous event was identical and it was dispatched within the window.
+// Setting the window to 0 disables the check.
+func (c *collapser) repeated(userId string, event interface{}) bool {
+	if c.window == 0 {
+		return false
+	}
+
+	var (
+		id  = eventId(event)
+		now = time.Now()
+	)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	previous, ok := c.last[userId]
+	if ok && previous.id == id && now.Sub(previous.at) < c.window {
+		return true
+	}
+
+	if !ok && len(c.last) >= collapseSize {
+		for k, v := range c.last {
+			if now.Sub(v.at) >= c.window {
+				delete(c.last, k)
+			}
+		}
+	}
+	c.last[userId] = lastEvent{id, now}
+	return false
+}
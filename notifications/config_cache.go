@@ -0,0 +1,142 @@
+package notifications
+
+import (
+	"sync"
+	"time"
+)
+
+// configCache keeps the per-user configuration read when dispatching, i.e. the user document,
+// the active notifiers and the event documents, so that the database is not hit for every event.
+//
+// The entries are dropped when the user changes the configuration. The TTL bounds
+// how stale an entry can get when the change is not reported, e.g. when a chat bot
+// links a notifier. A TTL of 0 disables the cache.
+//
+// When stale is set and returns true for the error of a load, the expired entry is served
+// instead, e.g. while the database is unavailable.
+type configCache struct {
+	ttl   time.Duration
+	users map[string]*userConfig
+	stale func(error) bool
+	lock  sync.Mutex
+}
+
+type userConfig struct {
+	values map[string]*cachedConfig
+}
+
+type cachedConfig struct {
+	value     interface{}
+	expiresAt time.Time
+}
+
+func newConfigCache(ttl time.Duration) *configCache {
+	return &configCache{
+		ttl:   ttl,
+		users: make(map[string]*userConfig),
+	}
+}
+
+// get returns the cached value for the user and key, calling load when it is not cached.
+// The values are shared by all the dispatches, they must not be modified.
+func (cache *configCache) get(userId, key string, load func() (interface{}, error)) (interface{}, error) {
+	if cache.ttl == 0 {
+		return load()
+	}
+
+	cache.lock.Lock()
+	config, ok := cache.users[userId]
+	if !ok {
+		config = &userConfig{
+			values: make(map[string]*cachedConfig),
+		}
+		cache.users[userId] = config
+	}
+	cached, ok := config.values[key]
+	if ok && time.Now().Before(cached.expiresAt) {
+		cache.lock.Unlock()
+		return cached.value, nil
+	}
+	cache.lock.Unlock()
+
+	value, err := load()
+	if err != nil {
+		if ok && cache.stale != nil && cache.stale(err) {
+			return cached.value, nil
+		}
+		return nil, err
+	}
+
+	// The configuration may have changed while loading, in which case the user entry
+	// was replaced and the value, possibly read before the change, is not stored.
+	cache.lock.Lock()
+	if cache.users[userId] == config {
+		config.values[key] = &cachedConfig{
+			value:     value,
+			expiresAt: time.Now().Add(cache.ttl),
+		}
+	}
+	cache.lock.Unlock()
+	return value, nil
+}
+
+// peek returns the value cached for the user and key, expired or not, without loading it.
+func (cache *configCache) peek(userId, key string) (interface{}, bool) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	config, ok := cache.users[userId]
+	if !ok {
+		return nil, false
+	}
+	cached, ok := config.values[key]
+	if !ok {
+		return nil, false
+	}
+	return cached.value, true
+}
+
+// invalidate drops everything cached for the user.
+func (cache *configCache) invalidate(userId string) {
+	cache.lock.Lock()
+	delete(cache.users, userId)
+	cache.lock.Unlock()
+}
+
+// sweep drops the users with all the entries expired so that the inactive users do not pile up.
+func (cache *configCache) sweep() {
+	now := time.Now()
+
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	for userId, config := range cache.users {
+		expired := true
+		for _, cached := range config.values {
+			if now.Before(cached.expiresAt) {
+				expired = false
+				break
+			}
+		}
+		if expired {
+			delete(cache.users, userId)
+		}
+	}
+}
+
+func (processor *BlockProcessor) configCacheSweeper() error {
+	ticker := time.NewTicker(processor.configs.ttl)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// The expired entries are kept as long as they may be needed as a fallback.
+			if !processor.dbHealth.Degraded() {
+				processor.configs.sweep()
+			}
+		case <-processor.t.Dying():
+			return nil
+		}
+	}
+}
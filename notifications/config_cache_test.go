@@ -0,0 +1,67 @@
+package notifications
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2"
+)
+
+func TestConfigCacheGet(t *testing.T) {
+	unavailable := errors.New("no reachable servers")
+
+	testCases := []struct {
+		name    string
+		cached  bool
+		expired bool
+		loadErr error
+		want    interface{}
+		failed  bool
+		loaded  bool
+	}{
+		{name: "fresh", cached: true, want: "cached"},
+		{name: "expired", cached: true, expired: true, want: "loaded", loaded: true},
+		{name: "stale while unavailable", cached: true, expired: true, loadErr: unavailable, want: "cached", loaded: true},
+		{name: "stale on another error", cached: true, expired: true, loadErr: mgo.ErrCursor, failed: true, loaded: true},
+		{name: "not cached while unavailable", loadErr: unavailable, failed: true, loaded: true},
+		{name: "not cached", want: "loaded", loaded: true},
+	}
+
+	for _, tc := range testCases {
+		cache := newConfigCache(time.Minute)
+		cache.stale = func(err error) bool { return err == unavailable }
+
+		if tc.cached {
+			cache.get("user", "notifiers", func() (interface{}, error) { return "cached", nil })
+			if tc.expired {
+				cache.users["user"].values["notifiers"].expiresAt = time.Now().Add(-time.Second)
+			}
+		}
+
+		var loaded bool
+		v, err := cache.get("user", "notifiers", func() (interface{}, error) {
+			loaded = true
+			if tc.loadErr != nil {
+				return nil, tc.loadErr
+			}
+			return "loaded", nil
+		})
+		if (err != nil) != tc.failed {
+			t.Errorf("%v: got error %v, want failed %v", tc.name, err, tc.failed)
+		}
+		if !tc.failed && v != tc.want {
+			t.Errorf("%v: got %v, want %v", tc.name, v, tc.want)
+		}
+		if loaded != tc.loaded {
+			t.Errorf("%v: got loaded %v, want %v", tc.name, loaded, tc.loaded)
+		}
+
+		// The stale entry is kept, so it is still there for the next failure.
+		if tc.cached && tc.loadErr == unavailable {
+			if v, ok := cache.peek("user", "notifiers"); !ok || v != "cached" {
+				t.Errorf("%v: got %v, %v peeked, want the stale entry", tc.name, v, ok)
+			}
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package dbhealth
+
+import (
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// MaxPendingWrites limits the number of writes kept for retrying while degraded.
+// The oldest writes are dropped first.
+const MaxPendingWrites = 10000
+
+// Status describes whether the database is reachable.
+type Status struct {
+	Degraded      bool       `json:"degraded"`
+	Reason        string     `json:"reason,omitempty"`
+	Since         *time.Time `json:"since,omitempty"`
+	PendingWrites int        `json:"pendingWrites,omitempty"`
+	DroppedWrites uint64     `json:"droppedWrites,omitempty"`
+}
+
+// Monitor tracks the database availability and keeps the writes that failed
+// while the database was unavailable so that they can be retried once it recovers.
+// It is shared by the block processor, the API keeping the configuration changes
+// and the health endpoint. The processor pings the database and retries the writes.
+type Monitor struct {
+	status   Status
+	pending  []func() error
+	retrying int
+	lock     sync.Mutex
+}
+
+func NewMonitor() *Monitor {
+	return &Monitor{}
+}
+
+// Unavailable returns true when the error means that the database cannot be reached,
+// i.e. the connection was lost, timed out or no server is reachable.
+// Any other error, e.g. a missing document or a failed handler, is not a connectivity failure.
+// The wrapped errors are checked by their cause.
+func Unavailable(err error) bool {
+	err = errors.Cause(err)
+	if err == nil {
+		return false
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return true
+	}
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+	switch err.Error() {
+	case "no reachable servers", "Closed explicitly", "Session already closed":
+		return true
+	}
+	return false
+}
+
+// Check records the result of a database operation. True is returned when the database
+// is unavailable, then the monitor is degraded until Recovered is called.
+func (m *Monitor) Check(err error) bool {
+	if !Unavailable(err) {
+		return false
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if !m.status.Degraded {
+		now := time.Now()
+		m.status.Degraded = true
+		m.status.Since = &now
+		log.Printf("database unavailable: %v", err)
+	}
+	m.status.Reason = err.Error()
+	return true
+}
+
+// Retry keeps the write to be retried once the database recovers.
+func (m *Monitor) Retry(write func() error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if len(m.pending) == MaxPendingWrites {
+		m.pending = m.pending[1:]
+		m.status.DroppedWrites++
+	}
+	m.pending = append(m.pending, write)
+}
+
+// Recovered clears the degraded state and retries the pending writes in order.
+// The writes failing again stay pending, in which case the monitor is degraded again.
+func (m *Monitor) Recovered() {
+	m.lock.Lock()
+	wasDegraded := m.status.Degraded
+	m.status.Degraded = false
+	m.status.Reason = ""
+	m.status.Since = nil
+	pending := m.pending
+	m.pending = nil
+	m.retrying = len(pending)
+	m.lock.Unlock()
+
+	defer func() {
+		m.lock.Lock()
+		m.retrying = 0
+		m.lock.Unlock()
+	}()
+
+	if wasDegraded {
+		log.Printf("database available again, retrying %v pending writes", len(pending))
+	}
+
+	for i, write := range pending {
+		err := write()
+		if err == nil {
+			continue
+		}
+		if m.Check(err) {
+			// Keep the rest for the next recovery, in front of the writes queued meanwhile.
+			m.lock.Lock()
+			m.pending = append(append([]func() error{}, pending[i:]...), m.pending...)
+			if n := len(m.pending) - MaxPendingWrites; n > 0 {
+				m.pending = m.pending[n:]
+				m.status.DroppedWrites += uint64(n)
+			}
+			m.lock.Unlock()
+			return
+		}
+		log.Printf("failed to retry a pending write: %v", err)
+	}
+}
+
+func (m *Monitor) Status() Status {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	status := m.status
+	status.PendingWrites = len(m.pending) + m.retrying
+	return status
+}
+
+func (m *Monitor) Degraded() bool {
+	return m.Status().Degraded
+}
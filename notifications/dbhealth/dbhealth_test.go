@@ -0,0 +1,131 @@
+package dbhealth
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2"
+)
+
+func TestUnavailable(t *testing.T) {
+	testCases := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{mgo.ErrNotFound, false},
+		{&mgo.QueryError{Message: "bad query"}, false},
+		{errors.New("no reachable servers"), true},
+		{errors.Wrap(errors.New("no reachable servers"), "failed to get user"), true},
+		{errors.Wrap(mgo.ErrNotFound, "failed to get user"), false},
+		{io.EOF, true},
+		{&net.OpError{Op: "read", Err: errors.New("connection reset by peer")}, true},
+		{errors.New("Closed explicitly"), true},
+		{errors.New("unknown event type"), false},
+		{&json.SyntaxError{}, false},
+		{errors.Wrap(errors.New("rpc call failed"), "failed to get account"), false},
+	}
+
+	for _, tc := range testCases {
+		if got := Unavailable(tc.err); got != tc.want {
+			t.Errorf("Unavailable(%v): got %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestMonitorRecovered(t *testing.T) {
+	unavailable := errors.New("no reachable servers")
+
+	testCases := []struct {
+		name string
+		// failures are the errors returned by the writes on their first run.
+		failures map[int]error
+		// queued is the write queued while retrying the given one.
+		queued  map[int]int
+		writes  int
+		first   []int
+		second  []int
+		pending int
+	}{
+		{
+			name:   "all retried",
+			writes: 3,
+			first:  []int{1, 2, 3},
+		},
+		{
+			name:     "unavailable again",
+			writes:   4,
+			failures: map[int]error{2: unavailable},
+			first:    []int{1, 2},
+			second:   []int{2, 3, 4},
+			pending:  3,
+		},
+		{
+			name:     "queued meanwhile",
+			writes:   4,
+			failures: map[int]error{3: unavailable},
+			queued:   map[int]int{2: 5},
+			first:    []int{1, 2, 3},
+			second:   []int{3, 4, 5},
+			pending:  3,
+		},
+		{
+			name:     "failed for good",
+			writes:   3,
+			failures: map[int]error{2: mgo.ErrNotFound},
+			first:    []int{1, 2, 3},
+		},
+	}
+
+	for _, tc := range testCases {
+		var (
+			m    = NewMonitor()
+			runs []int
+			ran  = make(map[int]bool)
+		)
+		var write func(i int) func() error
+		write = func(i int) func() error {
+			return func() error {
+				runs = append(runs, i)
+				if next, ok := tc.queued[i]; ok && !ran[i] {
+					m.Retry(write(next))
+				}
+				defer func() { ran[i] = true }()
+				if err := tc.failures[i]; err != nil && !ran[i] {
+					return err
+				}
+				return nil
+			}
+		}
+
+		m.Check(unavailable)
+		for i := 1; i <= tc.writes; i++ {
+			m.Retry(write(i))
+		}
+
+		m.Recovered()
+		if !reflect.DeepEqual(runs, tc.first) {
+			t.Errorf("%v: got the writes %v retried, want %v", tc.name, runs, tc.first)
+		}
+		status := m.Status()
+		if status.PendingWrites != tc.pending {
+			t.Errorf("%v: got %v writes pending, want %v", tc.name, status.PendingWrites, tc.pending)
+		}
+		if status.Degraded != (tc.pending != 0) {
+			t.Errorf("%v: got degraded %v with %v writes pending", tc.name, status.Degraded, tc.pending)
+		}
+
+		runs = nil
+		m.Recovered()
+		if !reflect.DeepEqual(runs, tc.second) {
+			t.Errorf("%v: got the writes %v retried on the second recovery, want %v", tc.name, runs, tc.second)
+		}
+		if status := m.Status(); status.Degraded || status.PendingWrites != 0 {
+			t.Errorf("%v: got %+v after the second recovery", tc.name, status)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package notifications
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"gopkg.in/mgo.v2"
+)
+
+const (
+	// DefaultDedupWindow is for how long a dispatched event is remembered.
+	DefaultDedupWindow = time.Hour
+
+	// DefaultDedupCacheSize is the number of events remembered in memory before the cache starts over.
+	DefaultDedupCacheSize = 100000
+)
+
+// DedupEntry is stored for every event dispatched to a user when the dedup set is persisted.
+type DedupEntry struct {
+	Id        string    `bson:"_id"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
+
+// dedupSet remembers the events dispatched recently so that the events mined again
+// from the same block, e.g. when the block is processed again after a restart,
+// are not delivered twice. The events are identified by their position in the blockchain,
+// so equal events from different operations are not affected.
+//
+// The set is kept in memory and optionally also in the database, which is what makes it
+// survive a restart of the process.
+type dedupSet struct {
+	db      *mgo.Database
+	persist bool
+	window  time.Duration
+	size    int
+
+	expiresAt map[string]time.Time
+	lock      *sync.Mutex
+}
+
+func newDedupSet(db *mgo.Database, persist bool, window time.Duration) *dedupSet {
+	if window <= 0 {
+		window = DefaultDedupWindow
+	}
+	return &dedupSet{
+		db:        db,
+		persist:   persist,
+		window:    window,
+		size:      DefaultDedupCacheSize,
+		expiresAt: make(map[string]time.Time),
+		lock:      &sync.Mutex{},
+	}
+}
+
+// seen records the event for the user and returns true when it was already recorded before.
+func (set *dedupSet) seen(userId string, pos *eventPosition, event interface{}) bool {
+	var (
+		key = fmt.Sprintf("%v:%v:%v:%v", userId, pos.block, pos.index, eventKind(event))
+		now = time.Now()
+	)
+
+	set.lock.Lock()
+	if until, ok := set.expiresAt[key]; ok && now.Before(until) {
+		set.lock.Unlock()
+		return true
+	}
+	if len(set.expiresAt) >= set.size {
+		set.expiresAt = make(map[string]time.Time)
+	}
+	set.expiresAt[key] = now.Add(set.window)
+	set.lock.Unlock()
+
+	if !set.persist {
+		return false
+	}
+
+	// The insert fails for the events recorded before the restart.
+	err := set.db.C("dedup").Insert(&DedupEntry{
+		Id:        key,
+		ExpiresAt: now.Add(set.window),
+	})
+	switch {
+	case err == nil:
+		return false
+	case mgo.IsDup(err):
+		return true
+	default:
+		// Rather deliver twice than not at all.
+		log.Printf("failed to store dedup entry %v: %v", key, err)
+		return false
+	}
+}
+
+// duplicate returns true when the event was already dispatched to the user.
+// The events without a known position, e.g. those not mined from a block, are never duplicates.
+func (processor *BlockProcessor) duplicate(userId string, event interface{}) bool {
+	pos, ok := processor.sequencer.position(event)
+	if !ok {
+		return false
+	}
+	return processor.dedup.seen(userId, pos, event)
+}
@@ -0,0 +1,320 @@
+package notifications
+
+import (
+	"log"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// DBCheckInterval is how often the database is pinged while it is unavailable.
+const DBCheckInterval = 5 * time.Second
+
+// dbWatcher pings the database while it is unavailable and retries the pending writes
+// once it is back. Meanwhile the events are dispatched using the cached user configuration.
+func (processor *BlockProcessor) dbWatcher() error {
+	ticker := time.NewTicker(DBCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !processor.dbHealth.Degraded() {
+				continue
+			}
+			// mgo keeps failing on the broken socket until the session is refreshed.
+			session := processor.db.Session
+			session.Refresh()
+			if err := session.Ping(); err != nil {
+				processor.dbHealth.Check(err)
+				continue
+			}
+			processor.dbHealth.Recovered()
+
+		case <-processor.t.Dying():
+			return nil
+		}
+	}
+}
+
+// persist runs the write. When the database is unavailable, the write is kept
+// to be retried once the database recovers and nil is returned.
+func (processor *BlockProcessor) persist(what string, write func() error) error {
+	err := write()
+	if err != nil && processor.dbHealth.Check(err) {
+		log.Printf("database unavailable, %v kept for retrying", what)
+		processor.dbHealth.Retry(write)
+		return nil
+	}
+	return err
+}
+
+// skipUnavailable logs and drops the error when it means that the database is unavailable,
+// so that the goroutines of the processor keep running until it recovers.
+func (processor *BlockProcessor) skipUnavailable(what string, err error) error {
+	if err != nil && processor.dbHealth.Check(err) {
+		log.Printf("database unavailable, %v skipped: %v", what, err)
+		return nil
+	}
+	return err
+}
+
+// eventsIter iterates over the event documents returned for the query of a handler.
+type eventsIter interface {
+	Next(result interface{}) bool
+	Err() error
+}
+
+// findEvents runs the query of a handler against the events collection.
+//
+// When the database is unavailable and the query is limited to the given owners,
+// e.g. by narrowToWatchers, the query is answered from the watch index instead.
+// The query is evaluated against the event documents last cached for the owners watching the kind,
+// see matchQuery, so the paused entries and the filters of the users still apply.
+func (processor *BlockProcessor) findEvents(query bson.M) eventsIter {
+	return &fallbackIter{
+		iter:  processor.db.C("events").Find(query).Iter(),
+		check: processor.dbHealth.Check,
+		fallback: func() ([]bson.M, bool) {
+			return processor.cachedEventDocs(query)
+		},
+	}
+}
+
+// cachedEventDocs returns the event documents of the owners the query is limited to
+// that match the query, as far as they can be told without the database.
+// False is returned when they can't, e.g. when the query cannot be evaluated in memory.
+// The owners with no event document cached are skipped, their filters are not known.
+func (processor *BlockProcessor) cachedEventDocs(query bson.M) ([]bson.M, bool) {
+	if processor.watches == nil {
+		return nil, false
+	}
+	kind, _ := query["kind"].(string)
+	owners, _ := query["ownerId"].(bson.M)
+	ownerIds, ok := owners["$in"].([]bson.ObjectId)
+	if kind == "" || !ok {
+		return nil, false
+	}
+
+	var docs []bson.M
+	for _, ownerId := range ownerIds {
+		watching, ok := processor.watches.watchingKind(ownerId, kind)
+		if !ok {
+			return nil, false
+		}
+		if !watching {
+			continue
+		}
+		doc, ok := processor.cachedEventDoc(ownerId, kind)
+		if !ok {
+			log.Printf("database unavailable, no %v event document cached for user %v", kind, ownerId.Hex())
+			continue
+		}
+		matched, err := matchQuery(doc, query)
+		if err != nil {
+			log.Printf("database unavailable, %v query not evaluated: %v", kind, err)
+			return nil, false
+		}
+		if matched {
+			docs = append(docs, doc)
+		}
+	}
+	return docs, true
+}
+
+// cachedEventDoc returns the event document of the given kind last cached for the user.
+func (processor *BlockProcessor) cachedEventDoc(ownerId bson.ObjectId, kind string) (bson.M, bool) {
+	v, ok := processor.configs.peek(ownerId.Hex(), "events:"+kind)
+	if !ok {
+		return nil, false
+	}
+	raw, err := bson.Marshal(v.(*eventDoc))
+	if err != nil {
+		return nil, false
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return nil, false
+	}
+	doc["ownerId"] = ownerId
+	doc["kind"] = kind
+	return doc, true
+}
+
+// matchQuery returns true when the document matches the query the way MongoDB would match it.
+// Only the operators used by the handlers are supported, an error is returned for the others.
+func matchQuery(doc bson.M, query bson.M) (bool, error) {
+	matched := true
+	for key, cond := range query {
+		var (
+			ok  bool
+			err error
+		)
+		switch {
+		case key == "$or":
+			ok, err = matchAnyQuery(doc, cond)
+		case strings.HasPrefix(key, "$"):
+			err = errors.Errorf("unsupported query operator %v", key)
+		default:
+			value, present := lookupField(doc, key)
+			ok, err = matchField(value, present, cond)
+		}
+		if err != nil {
+			return false, err
+		}
+		matched = matched && ok
+	}
+	return matched, nil
+}
+
+// matchAnyQuery returns true when the document matches any of the $or branches.
+func matchAnyQuery(doc bson.M, branches interface{}) (bool, error) {
+	queries, ok := branches.([]interface{})
+	if !ok {
+		return false, errors.Errorf("unsupported $or branches %T", branches)
+	}
+	matched := false
+	for _, branch := range queries {
+		query, ok := branch.(bson.M)
+		if !ok {
+			return false, errors.Errorf("unsupported $or branch %T", branch)
+		}
+		ok, err := matchQuery(doc, query)
+		if err != nil {
+			return false, err
+		}
+		matched = matched || ok
+	}
+	return matched, nil
+}
+
+// matchField returns true when the field value matches the condition,
+// i.e. it is equal to the condition or it is an array containing it,
+// unless the condition is made of $ne, $in, $nin or $exists.
+func matchField(value interface{}, present bool, cond interface{}) (bool, error) {
+	ops, ok := cond.(bson.M)
+	if !ok {
+		return fieldContains(value, cond), nil
+	}
+
+	matched := true
+	for op, arg := range ops {
+		var ok bool
+		switch op {
+		case "$ne":
+			ok = !fieldContains(value, arg)
+		case "$in", "$nin":
+			args := reflect.ValueOf(arg)
+			if args.Kind() != reflect.Slice {
+				return false, errors.Errorf("unsupported %v argument %T", op, arg)
+			}
+			for i := 0; i < args.Len(); i++ {
+				if fieldContains(value, args.Index(i).Interface()) {
+					ok = true
+					break
+				}
+			}
+			if op == "$nin" {
+				ok = !ok
+			}
+		case "$exists":
+			exists, isBool := arg.(bool)
+			if !isBool {
+				return false, errors.Errorf("unsupported $exists argument %T", arg)
+			}
+			ok = present == exists
+		default:
+			return false, errors.Errorf("unsupported query operator %v", op)
+		}
+		matched = matched && ok
+	}
+	return matched, nil
+}
+
+// fieldContains returns true when the value is equal to x or it is an array containing x.
+func fieldContains(value, x interface{}) bool {
+	if values, ok := value.([]interface{}); ok {
+		for _, v := range values {
+			if reflect.DeepEqual(v, x) {
+				return true
+			}
+		}
+		return false
+	}
+	return value != nil && reflect.DeepEqual(value, x)
+}
+
+// lookupField returns the value of the field at the dotted path, e.g. paused.accounts.
+func lookupField(doc bson.M, path string) (interface{}, bool) {
+	var value interface{} = doc
+	for _, key := range strings.Split(path, ".") {
+		m, ok := value.(bson.M)
+		if !ok {
+			return nil, false
+		}
+		value, ok = m[key]
+		if !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// fallbackIter returns the documents from fallback when iter fails before returning any
+// and check says the database is unavailable.
+type fallbackIter struct {
+	iter     eventsIter
+	check    func(error) bool
+	fallback func() ([]bson.M, bool)
+
+	returned bool
+	fellBack bool
+	docs     []bson.M
+	err      error
+}
+
+func (it *fallbackIter) Next(result interface{}) bool {
+	if !it.fellBack {
+		if it.iter.Next(result) {
+			it.returned = true
+			return true
+		}
+		it.err = it.iter.Err()
+		if it.err == nil || it.returned || !it.check(it.err) {
+			return false
+		}
+		docs, ok := it.fallback()
+		if !ok {
+			return false
+		}
+		log.Printf("database unavailable, %v event documents taken from the watch index", len(docs))
+		it.fellBack, it.docs, it.err = true, docs, nil
+	}
+
+	if len(it.docs) == 0 {
+		return false
+	}
+	doc := it.docs[0]
+	it.docs = it.docs[1:]
+
+	raw, err := bson.Marshal(doc)
+	if err == nil {
+		// The result is reused by the handlers, the fields not in the document are cleared.
+		v := reflect.ValueOf(result).Elem()
+		v.Set(reflect.Zero(v.Type()))
+		err = bson.Unmarshal(raw, result)
+	}
+	if err != nil {
+		it.err = errors.Wrap(err, "failed to decode a cached event document")
+		it.docs = nil
+		return false
+	}
+	return true
+}
+
+func (it *fallbackIter) Err() error {
+	return it.err
+}
@@ -0,0 +1,269 @@
+package notifications
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tchap/steemwatch/server/db"
+
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// docsIter returns the documents and then fails with err, if set.
+type docsIter struct {
+	docs []bson.M
+	err  error
+}
+
+func (iter *docsIter) Next(result interface{}) bool {
+	if len(iter.docs) == 0 {
+		return false
+	}
+	raw, _ := bson.Marshal(iter.docs[0])
+	iter.docs = iter.docs[1:]
+	return bson.Unmarshal(raw, result) == nil
+}
+
+func (iter *docsIter) Err() error {
+	return iter.err
+}
+
+func TestFallbackIter(t *testing.T) {
+	var (
+		unavailable = errors.New("no reachable servers")
+		alice       = bson.NewObjectId()
+		bob         = bson.NewObjectId()
+		skipEdits   = true
+		cached      = []bson.M{{"ownerId": bob, "settings": db.Settings{SkipEdits: &skipEdits}}}
+	)
+
+	testCases := []struct {
+		name     string
+		iter     *docsIter
+		fallback bool
+		want     []bson.ObjectId
+		edits    []bool
+		failed   bool
+	}{
+		{
+			name:     "available",
+			iter:     &docsIter{docs: []bson.M{{"ownerId": alice}}},
+			fallback: true,
+			want:     []bson.ObjectId{alice},
+			edits:    []bool{false},
+		},
+		{
+			name:     "unavailable",
+			iter:     &docsIter{err: unavailable},
+			fallback: true,
+			want:     []bson.ObjectId{bob},
+			edits:    []bool{true},
+		},
+		{
+			name:     "unavailable, no fallback",
+			iter:     &docsIter{err: unavailable},
+			fallback: false,
+			failed:   true,
+		},
+		{
+			name:     "unavailable after a document",
+			iter:     &docsIter{docs: []bson.M{{"ownerId": alice}}, err: unavailable},
+			fallback: true,
+			want:     []bson.ObjectId{alice},
+			edits:    []bool{false},
+			failed:   true,
+		},
+		{
+			name:     "query error",
+			iter:     &docsIter{err: &mgo.QueryError{Message: "bad query"}},
+			fallback: true,
+			failed:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		fallback := tc.fallback
+		iter := &fallbackIter{
+			iter:  tc.iter,
+			check: func(err error) bool { return err == unavailable },
+			fallback: func() ([]bson.M, bool) {
+				return cached, fallback
+			},
+		}
+
+		var (
+			result struct {
+				OwnerId  bson.ObjectId `bson:"ownerId"`
+				Settings db.Settings   `bson:"settings"`
+			}
+			got   []bson.ObjectId
+			edits []bool
+		)
+		for iter.Next(&result) {
+			got = append(got, result.OwnerId)
+			edits = append(edits, result.Settings.SkipEdits != nil && *result.Settings.SkipEdits)
+		}
+		if !reflect.DeepEqual(got, tc.want) || !reflect.DeepEqual(edits, tc.edits) {
+			t.Errorf("%v: got owners %v with skipEdits %v, want %v with %v", tc.name, got, edits, tc.want, tc.edits)
+		}
+		if err := iter.Err(); (err != nil) != tc.failed {
+			t.Errorf("%v: got error %v, want failed %v", tc.name, err, tc.failed)
+		}
+	}
+}
+
+func TestCachedEventDocs(t *testing.T) {
+	var (
+		alice     = bson.NewObjectId()
+		bob       = bson.NewObjectId()
+		carol     = bson.NewObjectId()
+		dan       = bson.NewObjectId()
+		skipEdits = true
+	)
+
+	processor := &BlockProcessor{
+		watches: newWatchIndex(),
+		configs: newConfigCache(time.Minute),
+	}
+	for ownerId, keys := range map[bson.ObjectId][]watchKey{
+		alice: watchKeys("story.published", "authors", "dave"),
+		bob:   watchKeys("story.published", "tags", "photography"),
+		carol: watchKeys("story.voted", "authors", "dave"),
+		dan:   watchKeys("story.published", "authors", "dave"),
+	} {
+		processor.watches.replace(ownerId, processor.watches.changed(ownerId), keys, false)
+	}
+	for ownerId, doc := range map[bson.ObjectId]*eventDoc{
+		alice: {
+			Lists: map[string]interface{}{"authors": []interface{}{"dave"}},
+		},
+		bob: {
+			Settings: db.Settings{SkipEdits: &skipEdits},
+			Paused:   map[string][]string{"tags": {"photography"}},
+			Lists:    map[string]interface{}{"tags": []interface{}{"photography", "travel"}},
+		},
+	} {
+		doc := doc
+		processor.configs.get(ownerId.Hex(), "events:story.published", func() (interface{}, error) {
+			return doc, nil
+		})
+	}
+
+	query := func(kind string, edited bool, ownerIds ...bson.ObjectId) bson.M {
+		q := bson.M{
+			"kind": kind,
+			"$or": []interface{}{
+				watching("authors", "dave"),
+				watching("tags", "photography"),
+				watching("tags", "travel"),
+			},
+		}
+		if edited {
+			q["settings.skipEdits"] = bson.M{"$ne": true}
+		}
+		if ownerIds != nil {
+			q["ownerId"] = bson.M{"$in": ownerIds}
+		}
+		return q
+	}
+
+	unsupported := query("story.published", false, alice, bob)
+	unsupported["createdAt"] = bson.M{"$gt": time.Now()}
+
+	testCases := []struct {
+		name  string
+		ready bool
+		query bson.M
+		want  []bson.ObjectId
+		ok    bool
+	}{
+		{
+			name:  "index not ready",
+			query: query("story.published", false, alice, bob),
+		},
+		{
+			name:  "not narrowed",
+			ready: true,
+			query: query("story.published", false),
+		},
+		{
+			name:  "watchers",
+			ready: true,
+			query: query("story.published", false, alice, bob, carol, dan),
+			want:  []bson.ObjectId{alice, bob},
+			ok:    true,
+		},
+		{
+			name:  "edits skipped",
+			ready: true,
+			query: query("story.published", true, alice, bob),
+			want:  []bson.ObjectId{alice},
+			ok:    true,
+		},
+		{
+			name:  "nobody watching the kind",
+			ready: true,
+			query: query("comment.published", false, alice, carol),
+			ok:    true,
+		},
+		{
+			name:  "unsupported query",
+			ready: true,
+			query: unsupported,
+		},
+	}
+
+	for _, tc := range testCases {
+		processor.watches.ready = tc.ready
+
+		docs, ok := processor.cachedEventDocs(tc.query)
+		if ok != tc.ok {
+			t.Errorf("%v: got ok %v, want %v", tc.name, ok, tc.ok)
+		}
+		var got []bson.ObjectId
+		for _, doc := range docs {
+			got = append(got, doc["ownerId"].(bson.ObjectId))
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%v: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestMatchQuery(t *testing.T) {
+	doc := bson.M{
+		"kind":     "transfer.made",
+		"accounts": []interface{}{"alice", "bob"},
+		"paused":   bson.M{"accounts": []interface{}{"bob"}},
+		"settings": bson.M{"skipEdits": true},
+	}
+
+	testCases := []struct {
+		name  string
+		query bson.M
+		want  bool
+		err   bool
+	}{
+		{"watching", watching("accounts", "alice"), true, false},
+		{"paused", watching("accounts", "bob"), false, false},
+		{"not watching", watching("accounts", "carol"), false, false},
+		{"$or", bson.M{"$or": watchingAny("accounts", []string{"bob", "alice"})}, true, false},
+		{"$ne", bson.M{"settings.skipEdits": bson.M{"$ne": true}}, false, false},
+		{"$in", bson.M{"accounts": bson.M{"$in": []string{"carol", "bob"}}}, true, false},
+		{"$nin", bson.M{"paused.accounts": bson.M{"$nin": []string{"bob"}}}, false, false},
+		{"$exists", bson.M{"authorBlacklist": bson.M{"$exists": false}}, true, false},
+		{"missing field", bson.M{"authorBlacklist": bson.M{"$ne": "dave"}}, true, false},
+		{"unsupported", bson.M{"accounts": bson.M{"$regex": "^a"}}, false, true},
+		{"unsupported after a mismatch", bson.M{"kind": "x", "$where": "true"}, false, true},
+	}
+
+	for _, tc := range testCases {
+		got, err := matchQuery(doc, tc.query)
+		if got != tc.want || (err != nil) != tc.err {
+			t.Errorf("%v: got %v, %v; want %v, error %v", tc.name, got, err, tc.want, tc.err)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package notifications
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/tchap/steemwatch/errs"
+	"github.com/tchap/steemwatch/notifications/audit"
+
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	DefaultNotifierConcurrency = 4
+	MaxNotifierConcurrency     = 16
+)
+
+// DeliveryStatus is stored for every (user, notifier) pair
+// and it is updated every time an event is delivered to the notifier.
+type DeliveryStatus struct {
+	OwnerId             bson.ObjectId `bson:"ownerId"`
+	NotifierId          string        `bson:"notifierId"`
+	LastAttemptAt       time.Time     `bson:"lastAttemptAt"`
+	LastSuccessAt       *time.Time    `bson:"lastSuccessAt,omitempty"`
+	LastError           string        `bson:"lastError,omitempty"`
+	ConsecutiveFailures int           `bson:"consecutiveFailures"`
+	BreakerState        string        `bson:"breakerState,omitempty"`
+}
+
+// DeadLetter is stored for every delivery that was not attempted
+// because the circuit breaker for the notifier was open.
+type DeadLetter struct {
+	OwnerId    bson.ObjectId `bson:"ownerId"`
+	NotifierId string        `bson:"notifierId"`
+	EventKind  string        `bson:"eventKind"`
+	EventId    string        `bson:"eventId"`
+	Event      string        `bson:"event"`
+	Reason     string        `bson:"reason"`
+	CreatedAt  time.Time     `bson:"createdAt"`
+}
+
+type deliveryTarget struct {
+	notifierId string
+	dispatcher Notifier
+	settings   bson.Raw
+	// record is set for the notifiers configured by the user.
+	// The additional notifiers are delivered to for every event, so we don't track them.
+	record bool
+}
+
+// deliver dispatches the event to all the targets, running at most concurrency
+// deliveries at once. A failing target does not affect delivery to the others.
+// The IDs of the notifiers the event was successfully delivered to are returned.
+// The delivery results are added to the trace, which can be nil.
+func (processor *BlockProcessor) deliver(
+	userId string,
+	event interface{},
+	targets []*deliveryTarget,
+	concurrency uint,
+	dispatch func(*deliveryTarget) error,
+	trace *eventTrace,
+) []string {
+	if concurrency == 0 {
+		concurrency = 1
+	}
+
+	var (
+		semaphore = make(chan struct{}, concurrency)
+		wg        sync.WaitGroup
+
+		delivered     []string
+		deliveredLock sync.Mutex
+	)
+	for _, target := range targets {
+		semaphore <- struct{}{}
+		wg.Add(1)
+		go func(target *deliveryTarget) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+
+			var key string
+			if target.record {
+				key = breakerKey(userId, target.notifierId)
+				if !processor.breakers.allow(key) {
+					trace.step("notifier:"+target.notifierId, TraceSkipped, "circuit breaker open")
+					processor.deadLetter(userId, target.notifierId, event, "circuit breaker open")
+					return
+				}
+			}
+
+			// The injected faults go through the retries and the circuit breaker like real failures.
+			attempt := func() error {
+				if err := processor.faults.Check(userId, target.notifierId); err != nil {
+					return err
+				}
+				return dispatch(target)
+			}
+
+			var err error
+			if target.record {
+				err = processor.dispatchWithRetries(processor.notifierPolicy(target.notifierId).Retries, attempt)
+			} else {
+				err = attempt()
+			}
+			if err != nil {
+				trace.step("notifier:"+target.notifierId, TraceFailed, "%v", err)
+				log.Printf("dispatcher %v failed: %+v", target.notifierId, err)
+				if target.record && errors.Cause(err) == errs.ErrCredentialsRejected {
+					processor.disableNotifier(userId, target.notifierId)
+				}
+			} else {
+				trace.step("notifier:"+target.notifierId, TraceDelivered, "")
+				deliveredLock.Lock()
+				delivered = append(delivered, target.notifierId)
+				deliveredLock.Unlock()
+			}
+			if target.record {
+				state := processor.breakers.report(key, err)
+				processor.recordDelivery(userId, target.notifierId, state, err)
+			}
+		}(target)
+	}
+	wg.Wait()
+	return delivered
+}
+
+func (processor *BlockProcessor) recordDelivery(
+	userId string,
+	notifierId string,
+	breakerState string,
+	deliveryErr error,
+) {
+	now := time.Now()
+
+	selector := bson.M{
+		"ownerId":    bson.ObjectIdHex(userId),
+		"notifierId": notifierId,
+	}
+
+	var update bson.M
+	if deliveryErr == nil {
+		update = bson.M{
+			"$set": bson.M{
+				"lastAttemptAt":       now,
+				"lastSuccessAt":       now,
+				"consecutiveFailures": 0,
+				"breakerState":        breakerState,
+			},
+			"$unset": bson.M{
+				"lastError": "",
+			},
+		}
+	} else {
+		update = bson.M{
+			"$set": bson.M{
+				"lastAttemptAt": now,
+				"lastError":     deliveryErr.Error(),
+				"breakerState":  breakerState,
+			},
+			"$inc": bson.M{
+				"consecutiveFailures": 1,
+			},
+		}
+	}
+
+	if _, err := processor.db.C("deliveryStatus").Upsert(selector, update); err != nil {
+		log.Printf("failed to record delivery status for user %v, notifier %v: %v",
+			userId, notifierId, err)
+	}
+}
+
+// disableNotifier turns the notifier off for the user. It is used when the stored
+// credentials are no longer accepted so that we stop retrying until the user fixes them.
+func (processor *BlockProcessor) disableNotifier(userId, notifierId string) {
+	selector := bson.M{
+		"ownerId":    bson.ObjectIdHex(userId),
+		"notifierId": notifierId,
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"enabled": false,
+		},
+	}
+	err := processor.persist("notifier update", func() error {
+		return processor.db.C("notifiers").Update(selector, update)
+	})
+	if err != nil {
+		log.Printf("failed to disable notifier %v for user %v: %v", notifierId, userId, err)
+		return
+	}
+	processor.configs.invalidate(userId)
+	log.Printf("notifier %v disabled for user %v: credentials rejected", notifierId, userId)
+}
+
+func (processor *BlockProcessor) deadLetter(userId, notifierId string, event interface{}, reason string) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("failed to marshal dead letter for user %v, notifier %v: %v",
+			userId, notifierId, err)
+		return
+	}
+
+	letter := &DeadLetter{
+		OwnerId:    bson.ObjectIdHex(userId),
+		NotifierId: notifierId,
+		EventKind:  eventKind(event),
+		EventId:    eventId(event),
+		Event:      string(body),
+		Reason:     reason,
+		CreatedAt:  time.Now(),
+	}
+	if err := processor.db.C("deadLetters").Insert(letter); err != nil {
+		log.Printf("failed to store dead letter for user %v, notifier %v: %v",
+			userId, notifierId, err)
+	}
+
+	selector := bson.M{
+		"ownerId":    letter.OwnerId,
+		"notifierId": notifierId,
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"breakerState": BreakerOpen,
+		},
+	}
+	if _, err := processor.db.C("deliveryStatus").Upsert(selector, update); err != nil {
+		log.Printf("failed to record delivery status for user %v, notifier %v: %v",
+			userId, notifierId, err)
+	}
+}
+
+func (processor *BlockProcessor) recordAudit(userId string, event interface{}, channels []string) {
+	entry := &audit.Entry{
+		UserId:    userId,
+		EventKind: eventKind(event),
+		EventId:   eventId(event),
+		Channels:  channels,
+		Timestamp: time.Now(),
+	}
+	if err := processor.audit.Record(entry); err != nil {
+		log.Printf("failed to record audit entry for user %v: %+v", userId, err)
+	}
+}
+
+// notifierConcurrency returns the number of notifiers the event can be delivered to in parallel.
+func (processor *BlockProcessor) notifierConcurrency(user *UserDoc) uint {
+	concurrency := processor.defaultNotifierConcurrency
+	if v := user.Settings.NotifierConcurrency; v != nil && *v != 0 {
+		concurrency = *v
+	}
+	if concurrency > MaxNotifierConcurrency {
+		concurrency = MaxNotifierConcurrency
+	}
+	return concurrency
+}
@@ -0,0 +1,230 @@
+package notifications
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/tchap/steemwatch/notifications/events"
+
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	// DigestCheckInterval specifies how often the held events are checked for delivery.
+	DigestCheckInterval = time.Minute
+
+	// DigestFlushPollInterval specifies how often pending digest flush requests are picked up.
+	DigestFlushPollInterval = 5 * time.Second
+)
+
+// HeldEvent is an event received outside of the user's active window.
+type HeldEvent struct {
+	Id        bson.ObjectId `bson:"_id,omitempty"`
+	OwnerId   bson.ObjectId `bson:"ownerId"`
+	EventKind string        `bson:"eventKind"`
+	Event     string        `bson:"event"`
+	HeldAt    time.Time     `bson:"heldAt"`
+}
+
+// DigestFlush is a request to send the user's held events right away,
+// no matter the active window. The requests are inserted by the API
+// and processed by the block processor.
+type DigestFlush struct {
+	Id          bson.ObjectId `bson:"_id,omitempty"`
+	OwnerId     bson.ObjectId `bson:"ownerId"`
+	RequestedAt time.Time     `bson:"requestedAt"`
+	ProcessedAt *time.Time    `bson:"processedAt,omitempty"`
+	Error       string        `bson:"error,omitempty"`
+}
+
+func (processor *BlockProcessor) holdEvent(userId string, event interface{}) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal event")
+	}
+
+	held := &HeldEvent{
+		OwnerId:   bson.ObjectIdHex(userId),
+		EventKind: eventKind(event),
+		Event:     string(body),
+		HeldAt:    time.Now(),
+	}
+	return processor.persist("held event", func() error {
+		return processor.db.C("heldEvents").Insert(held)
+	})
+}
+
+func (processor *BlockProcessor) digestSender() error {
+	ticker := time.NewTicker(DigestCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// Nothing is dispatched while the pipeline is paused.
+			if processor.pipeline.Paused() {
+				continue
+			}
+			if err := processor.sendDigests(); err != nil {
+				log.Printf("failed to send digests: %+v", err)
+			}
+
+		case <-processor.t.Dying():
+			return nil
+		}
+	}
+}
+
+// sendDigests delivers the held events to the users whose active window is open.
+func (processor *BlockProcessor) sendDigests() error {
+	var ownerIds []bson.ObjectId
+	if err := processor.db.C("heldEvents").Find(nil).Distinct("ownerId", &ownerIds); err != nil {
+		return errors.Wrap(err, "failed to get users with held events")
+	}
+
+	now := time.Now()
+	for _, ownerId := range ownerIds {
+		userId := ownerId.Hex()
+
+		user, err := processor.getUser(userId)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get user %v", userId)
+		}
+		if !user.Settings.ActiveWindow.Contains(now) {
+			continue
+		}
+
+		if err := processor.sendDigest(userId, user); err != nil {
+			log.Printf("failed to send digest to user %v: %+v", userId, err)
+		}
+	}
+	return nil
+}
+
+func (processor *BlockProcessor) digestFlusher() error {
+	ticker := time.NewTicker(DigestFlushPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// Nothing is dispatched while the pipeline is paused.
+			if processor.pipeline.Paused() {
+				continue
+			}
+			if err := processor.processDigestFlushes(); err != nil {
+				log.Printf("failed to process digest flushes: %+v", err)
+			}
+
+		case <-processor.t.Dying():
+			return nil
+		}
+	}
+}
+
+func (processor *BlockProcessor) processDigestFlushes() error {
+	for {
+		// Claim the next pending request.
+		change := mgo.Change{
+			Update: bson.M{
+				"$set": bson.M{
+					"processedAt": time.Now(),
+				},
+			},
+			ReturnNew: true,
+		}
+		query := bson.M{
+			"processedAt": bson.M{"$exists": false},
+		}
+
+		var req DigestFlush
+		_, err := processor.db.C("digestFlushes").Find(query).Sort("requestedAt").Apply(change, &req)
+		if err != nil {
+			if err == mgo.ErrNotFound {
+				return nil
+			}
+			return errors.Wrap(err, "failed to get pending digest flush")
+		}
+
+		if err := processor.flushDigest(req.OwnerId.Hex()); err != nil {
+			log.Printf("digest flush %v failed: %+v", req.Id.Hex(), err)
+
+			update := bson.M{
+				"$set": bson.M{
+					"error": err.Error(),
+				},
+			}
+			if err := processor.db.C("digestFlushes").UpdateId(req.Id, update); err != nil {
+				log.Printf("failed to update digest flush %v: %v", req.Id.Hex(), err)
+			}
+		}
+
+		select {
+		case <-processor.t.Dying():
+			return nil
+		default:
+		}
+	}
+}
+
+// flushDigest sends the user's held events right away.
+func (processor *BlockProcessor) flushDigest(userId string) error {
+	user, err := processor.getUser(userId)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get user %v", userId)
+	}
+	return processor.sendDigest(userId, user)
+}
+
+// sendDigest delivers the user's held events as a single digest and removes them.
+// Only one digest is being sent at a time so that a flush request
+// racing the digest sender does not deliver the events twice.
+func (processor *BlockProcessor) sendDigest(userId string, user *UserDoc) error {
+	processor.digestLock.Lock()
+	defer processor.digestLock.Unlock()
+
+	var held []*HeldEvent
+	query := bson.M{
+		"ownerId": bson.ObjectIdHex(userId),
+	}
+	if err := processor.db.C("heldEvents").Find(query).Sort("heldAt").All(&held); err != nil {
+		return errors.Wrap(err, "failed to get held events")
+	}
+	if len(held) == 0 {
+		return nil
+	}
+
+	digest := &events.Digest{
+		Since: held[0].HeldAt,
+		Until: held[len(held)-1].HeldAt,
+	}
+	ids := make([]bson.ObjectId, 0, len(held))
+	for _, doc := range held {
+		ids = append(ids, doc.Id)
+
+		event, err := decodeEvent(doc.EventKind, []byte(doc.Event))
+		if err != nil {
+			log.Printf("dropping held event %v: %+v", doc.Id.Hex(), err)
+			continue
+		}
+		digest.Events = append(digest.Events, event)
+	}
+
+	if len(digest.Events) != 0 {
+		targets, err := processor.getUserTargets(userId)
+		if err != nil {
+			return err
+		}
+
+		processor.deliver(userId, digest, targets, processor.notifierConcurrency(user),
+			func(target *deliveryTarget) error {
+				return target.dispatcher.DispatchDigest(userId, target.settings, digest)
+			}, nil)
+	}
+
+	_, err := processor.db.C("heldEvents").RemoveAll(bson.M{"_id": bson.M{"$in": ids}})
+	return errors.Wrap(err, "failed to remove held events")
+}
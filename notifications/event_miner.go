@@ -1,10 +1,21 @@
 package notifications
 
 import (
+	"time"
+
 	"github.com/go-steem/rpc/apis/database"
 	"github.com/go-steem/rpc/types"
 )
 
+// AnyOpType is the key of the event miners that are run for every operation.
+const AnyOpType types.OpType = "*"
+
 type EventMiner interface {
 	MineEvent(types.Operation, *database.Content) (events []interface{}, err error)
 }
+
+// BlockEventMiner is implemented by the event miners that need the time of the block
+// including the operation. MineBlockEvent is called instead of MineEvent then.
+type BlockEventMiner interface {
+	MineBlockEvent(types.Operation, *database.Content, time.Time) (events []interface{}, err error)
+}
@@ -0,0 +1,117 @@
+package events
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/go-steem/rpc/apis/database"
+	"github.com/go-steem/rpc/types"
+	"github.com/pkg/errors"
+)
+
+// AccountActivityExcerptLength is the length of the operation body excerpt in the notifications.
+const AccountActivityExcerptLength = 300
+
+// accountFields are the operation fields holding accounts, in any role.
+var accountFields = map[string]bool{
+	"account":                true,
+	"agent":                  true,
+	"author":                 true,
+	"comment_owner":          true,
+	"creator":                true,
+	"curator":                true,
+	"delegatee":              true,
+	"delegator":              true,
+	"follower":               true,
+	"following":              true,
+	"from":                   true,
+	"from_account":           true,
+	"new_account_name":       true,
+	"owner":                  true,
+	"parent_author":          true,
+	"producer":               true,
+	"proxy":                  true,
+	"publisher":              true,
+	"receiver":               true,
+	"required_auths":         true,
+	"required_posting_auths": true,
+	"to":                     true,
+	"to_account":             true,
+	"voter":                  true,
+	"witness":                true,
+}
+
+// AccountActivity is emitted for any operation, once for all the accounts involved.
+// It carries the raw operation so that the subscribers get everything the accounts do.
+type AccountActivity struct {
+	OpType   string
+	Accounts []string
+	Body     json.RawMessage
+}
+
+// Excerpt returns the beginning of the operation body.
+func (event *AccountActivity) Excerpt() string {
+	return Excerpt(string(event.Body), AccountActivityExcerptLength)
+}
+
+type AccountActivityEventMiner struct{}
+
+func NewAccountActivityEventMiner() *AccountActivityEventMiner {
+	return &AccountActivityEventMiner{}
+}
+
+func (miner *AccountActivityEventMiner) MineEvent(
+	operation types.Operation,
+	content *database.Content, // nil
+) ([]interface{}, error) {
+
+	body, err := json.Marshal(operation.Data())
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to marshal %v operation", operation.Type())
+	}
+
+	accounts := OperationAccounts(body)
+	if len(accounts) == 0 {
+		return nil, nil
+	}
+	return []interface{}{&AccountActivity{
+		OpType:   string(operation.Type()),
+		Accounts: accounts,
+		Body:     body,
+	}}, nil
+}
+
+// OperationAccounts returns the accounts appearing in the top-level account fields
+// of the given operation body, sorted and without duplicates.
+func OperationAccounts(body []byte) []string {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	add := func(v interface{}) {
+		if account, ok := v.(string); ok && account != "" {
+			seen[account] = true
+		}
+	}
+	for key, value := range fields {
+		if !accountFields[key] {
+			continue
+		}
+		if list, ok := value.([]interface{}); ok {
+			for _, v := range list {
+				add(v)
+			}
+		} else {
+			add(value)
+		}
+	}
+
+	accounts := make([]string, 0, len(seen))
+	for account := range seen {
+		accounts = append(accounts, account)
+	}
+	sort.Strings(accounts)
+	return accounts
+}
@@ -0,0 +1,38 @@
+package events
+
+import (
+	"github.com/go-steem/rpc/apis/database"
+	"github.com/go-steem/rpc/types"
+)
+
+type AccountCreateWithDelegationOperation struct {
+	Fee            string `json:"fee"`
+	Delegation     string `json:"delegation"`
+	Creator        string `json:"creator"`
+	NewAccountName string `json:"new_account_name"`
+}
+
+// AccountCreated is emitted when an account is created using account_create_with_delegation.
+// Apart from the fee it carries the VESTS delegated by the creator to the new account.
+type AccountCreated struct {
+	Op *AccountCreateWithDelegationOperation
+}
+
+type AccountCreatedEventMiner struct{}
+
+func NewAccountCreatedEventMiner() *AccountCreatedEventMiner {
+	return &AccountCreatedEventMiner{}
+}
+
+func (miner *AccountCreatedEventMiner) MineEvent(
+	operation types.Operation,
+	content *database.Content, // nil
+) ([]interface{}, error) {
+
+	var op AccountCreateWithDelegationOperation
+	ok, err := unmarshalUnknownOp(operation, TypeAccountCreateWithDelegation, &op)
+	if !ok || err != nil {
+		return nil, err
+	}
+	return []interface{}{&AccountCreated{&op}}, nil
+}
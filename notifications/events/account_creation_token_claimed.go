@@ -0,0 +1,48 @@
+package events
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/go-steem/rpc/apis/database"
+	"github.com/go-steem/rpc/types"
+)
+
+type ClaimAccountOperation struct {
+	Creator string `json:"creator"`
+	Fee     string `json:"fee"`
+}
+
+type AccountCreationTokenClaimed struct {
+	Op *ClaimAccountOperation
+}
+
+// PaidWithRC returns true when no fee was paid for the token,
+// which means it was claimed using resource credits.
+func (event *AccountCreationTokenClaimed) PaidWithRC() bool {
+	parts := strings.Fields(event.Op.Fee)
+	if len(parts) == 0 {
+		return true
+	}
+	amount, err := strconv.ParseFloat(parts[0], 64)
+	return err == nil && amount == 0
+}
+
+type AccountCreationTokenClaimedEventMiner struct{}
+
+func NewAccountCreationTokenClaimedEventMiner() *AccountCreationTokenClaimedEventMiner {
+	return &AccountCreationTokenClaimedEventMiner{}
+}
+
+func (miner *AccountCreationTokenClaimedEventMiner) MineEvent(
+	operation types.Operation,
+	content *database.Content, // nil
+) ([]interface{}, error) {
+
+	var op ClaimAccountOperation
+	ok, err := unmarshalUnknownOp(operation, TypeClaimAccount, &op)
+	if !ok || err != nil {
+		return nil, err
+	}
+	return []interface{}{&AccountCreationTokenClaimed{&op}}, nil
+}
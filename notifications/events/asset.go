@@ -0,0 +1,62 @@
+package events
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// assetAliases maps the symbols used on the testnet and the legacy names to the canonical ones.
+var assetAliases = map[string]string{
+	"TESTS": "STEEM",
+	"TBD":   "SBD",
+}
+
+// AssetSymbol extracts the asset symbol from an amount such as "1.000 STEEM".
+// The symbol is returned upper-cased with the known aliases resolved.
+func AssetSymbol(amount string) (string, error) {
+	fields := strings.Fields(amount)
+	if len(fields) != 2 {
+		return "", errors.Errorf("invalid amount: %q", amount)
+	}
+
+	if _, err := strconv.ParseFloat(fields[0], 64); err != nil {
+		return "", errors.Errorf("invalid amount: %q", amount)
+	}
+
+	symbol := strings.ToUpper(fields[1])
+	for _, r := range symbol {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return "", errors.Errorf("invalid asset symbol in amount: %q", amount)
+		}
+	}
+	return NormalizeAssetSymbol(symbol), nil
+}
+
+// ParseAmount splits an amount such as "1.000 STEEM" into the value and the asset symbol.
+func ParseAmount(amount string) (float64, string, error) {
+	symbol, err := AssetSymbol(amount)
+	if err != nil {
+		return 0, "", err
+	}
+	value, err := strconv.ParseFloat(strings.Fields(amount)[0], 64)
+	if err != nil {
+		return 0, "", errors.Wrapf(err, "invalid amount: %q", amount)
+	}
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, "", errors.Errorf("invalid amount: %q", amount)
+	}
+	return value, symbol, nil
+}
+
+// NormalizeAssetSymbol upper-cases the symbol and resolves the known aliases.
+func NormalizeAssetSymbol(symbol string) string {
+	symbol = strings.ToUpper(strings.TrimSpace(symbol))
+	if canonical, ok := assetAliases[symbol]; ok {
+		return canonical
+	}
+	return symbol
+}
@@ -0,0 +1,35 @@
+package events
+
+import (
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+	testCases := []struct {
+		amount string
+		value  float64
+		symbol string
+		valid  bool
+	}{
+		{"1.000 STEEM", 1, "STEEM", true},
+		{"0.500 sbd", 0.5, "SBD", true},
+		{"2.000 TESTS", 2, "STEEM", true},
+		{"1.000", 0, "", false},
+		{"one STEEM", 0, "", false},
+		{"1.0.0 STEEM", 0, "", false},
+		{"NaN STEEM", 0, "", false},
+		{"Inf STEEM", 0, "", false},
+		{"1.000 STEEM!", 0, "", false},
+	}
+
+	for _, tc := range testCases {
+		value, symbol, err := ParseAmount(tc.amount)
+		if (err == nil) != tc.valid {
+			t.Errorf("%q: got error %v, valid %v", tc.amount, err, tc.valid)
+			continue
+		}
+		if value != tc.value || symbol != tc.symbol {
+			t.Errorf("%q: got %v %v, want %v %v", tc.amount, value, symbol, tc.value, tc.symbol)
+		}
+	}
+}
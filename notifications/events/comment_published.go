@@ -1,6 +1,8 @@
 package events
 
 import (
+	"time"
+
 	"github.com/go-steem/rpc/apis/database"
 	"github.com/go-steem/rpc/types"
 )
@@ -8,6 +10,7 @@ import (
 type CommentPublished struct {
 	Op      *types.CommentOperation
 	Content *database.Content
+	Edited  bool
 }
 
 type CommentPublishedEventMiner struct{}
@@ -21,6 +24,16 @@ func (miner *CommentPublishedEventMiner) MineEvent(
 	content *database.Content,
 ) ([]interface{}, error) {
 
+	return miner.MineBlockEvent(operation, content, time.Time{})
+}
+
+// MineBlockEvent uses the block time to tell a new comment from an edit.
+func (miner *CommentPublishedEventMiner) MineBlockEvent(
+	operation types.Operation,
+	content *database.Content,
+	blockTime time.Time,
+) ([]interface{}, error) {
+
 	if content.IsStory() {
 		return nil, nil
 	}
@@ -30,5 +43,5 @@ func (miner *CommentPublishedEventMiner) MineEvent(
 		return nil, nil
 	}
 
-	return []interface{}{&CommentPublished{op, content}}, nil
+	return []interface{}{&CommentPublished{op, content, isEdit(content, blockTime)}}, nil
 }
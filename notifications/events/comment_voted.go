@@ -8,6 +8,8 @@ import (
 type CommentVoted struct {
 	Op      *types.VoteOperation
 	Content *database.Content
+	// Revote is set when an existing vote was changed.
+	Revote *VoteChange
 }
 
 type CommentVotedEventMiner struct{}
@@ -30,5 +32,5 @@ func (miner *CommentVotedEventMiner) MineEvent(
 		return nil, nil
 	}
 
-	return []interface{}{&CommentVoted{op, content}}, nil
+	return []interface{}{&CommentVoted{Op: op, Content: content}}, nil
 }
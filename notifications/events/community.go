@@ -0,0 +1,122 @@
+package events
+
+import (
+	"encoding/json"
+
+	"github.com/go-steem/rpc/apis/database"
+	"github.com/go-steem/rpc/types"
+	"github.com/pkg/errors"
+)
+
+// CommunityCustomJSONID is the custom_json ID used by the community operations.
+const CommunityCustomJSONID = "community"
+
+const (
+	CommunityActionSubscribe   = "subscribe"
+	CommunityActionUnsubscribe = "unsubscribe"
+	CommunityActionSetRole     = "setRole"
+)
+
+// CommunityOperation is a community operation decoded from custom_json.
+// The JSON payload is a pair of the action and its parameters,
+// e.g. ["setRole", {"community": "hive-123456", "account": "alice", "role": "mod"}].
+type CommunityOperation struct {
+	// Account is the account that broadcast the operation.
+	Account   string `json:"account"`
+	Action    string `json:"action"`
+	Community string `json:"community"`
+	// Target is the account whose role is being set.
+	Target string `json:"target,omitempty"`
+	Role   string `json:"role,omitempty"`
+}
+
+type CommunitySubscriptionChanged struct {
+	Op *CommunityOperation
+}
+
+func (event *CommunitySubscriptionChanged) Subscribed() bool {
+	return event.Op.Action == CommunityActionSubscribe
+}
+
+type CommunityRoleChanged struct {
+	Op *CommunityOperation
+}
+
+type CommunityEventMiner struct{}
+
+func NewCommunityEventMiner() *CommunityEventMiner {
+	return &CommunityEventMiner{}
+}
+
+func (miner *CommunityEventMiner) MineEvent(
+	operation types.Operation,
+	content *database.Content, // nil
+) ([]interface{}, error) {
+
+	op, ok := operation.Data().(*types.CustomJSONOperation)
+	if !ok || op.ID != CommunityCustomJSONID {
+		return nil, nil
+	}
+
+	communityOp, err := parseCommunityOperation(op)
+	if err != nil || communityOp == nil {
+		return nil, err
+	}
+
+	switch communityOp.Action {
+	case CommunityActionSubscribe, CommunityActionUnsubscribe:
+		return []interface{}{&CommunitySubscriptionChanged{communityOp}}, nil
+	case CommunityActionSetRole:
+		return []interface{}{&CommunityRoleChanged{communityOp}}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// parseCommunityOperation decodes the custom_json payload.
+// nil is returned for the operations that are not signed by a single account.
+func parseCommunityOperation(op *types.CustomJSONOperation) (*CommunityOperation, error) {
+	account := signer(op)
+	if account == "" {
+		return nil, nil
+	}
+
+	var payload []json.RawMessage
+	if err := json.Unmarshal([]byte(op.JSON), &payload); err != nil || len(payload) != 2 {
+		return nil, errors.Errorf("invalid community operation: %v", op.JSON)
+	}
+
+	var action string
+	if err := json.Unmarshal(payload[0], &action); err != nil {
+		return nil, errors.Errorf("invalid community operation: %v", op.JSON)
+	}
+
+	var params struct {
+		Community string `json:"community"`
+		Account   string `json:"account"`
+		Role      string `json:"role"`
+	}
+	if err := json.Unmarshal(payload[1], &params); err != nil || params.Community == "" {
+		return nil, errors.Errorf("invalid community operation: %v", op.JSON)
+	}
+
+	return &CommunityOperation{
+		Account:   account,
+		Action:    action,
+		Community: params.Community,
+		Target:    params.Account,
+		Role:      params.Role,
+	}, nil
+}
+
+// signer returns the account that broadcast the custom_json operation.
+func signer(op *types.CustomJSONOperation) string {
+	switch {
+	case len(op.RequiredPostingAuths) == 1:
+		return op.RequiredPostingAuths[0]
+	case len(op.RequiredAuths) == 1:
+		return op.RequiredAuths[0]
+	default:
+		return ""
+	}
+}
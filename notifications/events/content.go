@@ -0,0 +1,22 @@
+package events
+
+import (
+	"time"
+
+	"github.com/go-steem/rpc/apis/database"
+)
+
+// isEdit returns true when the comment operation included in the block at blockTime
+// modified content that had been created in an earlier block.
+//
+// The content is only fetched once the block becomes irreversible, so its last update
+// timestamp may already reflect a later edit. The creation timestamp is the time
+// of the block that created the content, which makes it safe to compare against.
+// Nothing is reported as an edit when the block time is not known.
+func isEdit(content *database.Content, blockTime time.Time) bool {
+	created := content.Created
+	if created == nil || created.Time == nil || blockTime.IsZero() {
+		return false
+	}
+	return created.Before(blockTime)
+}
@@ -0,0 +1,48 @@
+package events
+
+import (
+	"unicode/utf8"
+
+	"github.com/go-steem/rpc/apis/database"
+	"github.com/go-steem/rpc/types"
+)
+
+// CustomJSONExcerptLength is the length the JSON payload is shortened to for the notifiers.
+const CustomJSONExcerptLength = 300
+
+// CustomJSONBroadcast carries any custom_json operation
+// for the users watching its ID regardless of the account involved.
+type CustomJSONBroadcast struct {
+	Op *types.CustomJSONOperation
+}
+
+// Account returns the account that broadcast the operation, if there is a single one.
+func (event *CustomJSONBroadcast) Account() string {
+	return signer(event.Op)
+}
+
+type CustomJSONBroadcastEventMiner struct{}
+
+func NewCustomJSONBroadcastEventMiner() *CustomJSONBroadcastEventMiner {
+	return &CustomJSONBroadcastEventMiner{}
+}
+
+func (miner *CustomJSONBroadcastEventMiner) MineEvent(
+	operation types.Operation,
+	content *database.Content, // nil
+) ([]interface{}, error) {
+
+	op, ok := operation.Data().(*types.CustomJSONOperation)
+	if !ok {
+		return nil, nil
+	}
+	return []interface{}{&CustomJSONBroadcast{op}}, nil
+}
+
+// Excerpt shortens the text to at most n characters, marking the cut with an ellipsis.
+func Excerpt(text string, n int) string {
+	if utf8.RuneCountInString(text) <= n {
+		return text
+	}
+	return string([]rune(text)[:n]) + "…"
+}
@@ -0,0 +1,12 @@
+package events
+
+import (
+	"time"
+)
+
+// Digest groups the events that were held back for a user and are delivered at once.
+type Digest struct {
+	Events []interface{}
+	Since  time.Time
+	Until  time.Time
+}
@@ -0,0 +1,103 @@
+package events
+
+// Display contains the visual metadata for an event type
+// so that all delivery channels render the events consistently.
+type Display struct {
+	Icon  string `json:"icon"`
+	Color string `json:"color"`
+	Label string `json:"label"`
+}
+
+var (
+	displayAccountUpdated              = &Display{"user", "#DC143C", "Account Updated"}
+	displayAccountWitnessVoted         = &Display{"check-square", "#8A2BE2", "Witness Vote"}
+	displayTransferMade                = &Display{"exchange", "#00B2EE", "Transfer"}
+	displayUserMentioned               = &Display{"at", "#FF6347", "Mention"}
+	displayUserFollowStatusChanged     = &Display{"user-plus", "#3D9140", "Follow"}
+	displayStoryPublished              = &Display{"file-text", "#00C957", "Story"}
+	displayStoryVoted                  = &Display{"thumbs-up", "#BDFCC9", "Story Vote"}
+	displayCommentPublished            = &Display{"comment", "#FF9912", "Comment"}
+	displayCommentVoted                = &Display{"thumbs-o-up", "#FFEBCD", "Comment Vote"}
+	displayAccountCreationTokenClaimed = &Display{"ticket", "#00B2EE", "Account Token"}
+	displayAccountCreated              = &Display{"user-plus", "#00B2EE", "Account Created"}
+	displayPayoutApproaching           = &Display{"clock-o", "#FFD700", "Payout Soon"}
+	displayPostPaidOut                 = &Display{"money", "#FFD700", "Paid Out"}
+	displayWitnessPropertiesSet        = &Display{"cogs", "#8A2BE2", "Witness Update"}
+	displayBlockProductionReward       = &Display{"cubes", "#8A2BE2", "Production Reward"}
+	displayWitnessFeedStale            = &Display{"exclamation-triangle", "#DC143C", "Stale Price Feed"}
+	displayWitnessFeedRecovered        = &Display{"check-circle", "#3D9140", "Price Feed Recovered"}
+	displayCommunitySubscription       = &Display{"users", "#1E90FF", "Community Subscription"}
+	displayCommunityRole               = &Display{"shield", "#1E90FF", "Community Role"}
+	displayNewPayerDetected            = &Display{"handshake-o", "#00B2EE", "New Payer"}
+	displayCustomJSONBroadcast         = &Display{"code", "#708090", "Custom JSON"}
+	displayHardforkActivated           = &Display{"code-fork", "#8A2BE2", "Hardfork"}
+	displayAccountActivity             = &Display{"bolt", "#708090", "Account Activity"}
+	displayRCDelegated                 = &Display{"battery-three-quarters", "#20B2AA", "RC Delegation"}
+	displayRCDelegationRemoved         = &Display{"battery-empty", "#20B2AA", "RC Delegation Removed"}
+	displayDigest                      = &Display{"inbox", "#708090", "Digest"}
+	displayDailySummary                = &Display{"calendar", "#708090", "Daily Summary"}
+	displayDefault                     = &Display{"bell", "#708090", "Event"}
+)
+
+// DisplayOf returns the display metadata for the given event.
+// The returned value is shared and must not be modified.
+func DisplayOf(event interface{}) *Display {
+	switch event.(type) {
+	case *AccountUpdated:
+		return displayAccountUpdated
+	case *AccountWitnessVoted:
+		return displayAccountWitnessVoted
+	case *TransferMade:
+		return displayTransferMade
+	case *UserMentioned:
+		return displayUserMentioned
+	case *UserFollowStatusChanged:
+		return displayUserFollowStatusChanged
+	case *StoryPublished:
+		return displayStoryPublished
+	case *StoryVoted:
+		return displayStoryVoted
+	case *CommentPublished:
+		return displayCommentPublished
+	case *CommentVoted:
+		return displayCommentVoted
+	case *AccountCreationTokenClaimed:
+		return displayAccountCreationTokenClaimed
+	case *AccountCreated:
+		return displayAccountCreated
+	case *AccountActivity:
+		return displayAccountActivity
+	case *RCDelegated:
+		return displayRCDelegated
+	case *RCDelegationRemoved:
+		return displayRCDelegationRemoved
+	case *HardforkActivated:
+		return displayHardforkActivated
+	case *PayoutApproaching:
+		return displayPayoutApproaching
+	case *PostPaidOut:
+		return displayPostPaidOut
+	case *WitnessPropertiesSet:
+		return displayWitnessPropertiesSet
+	case *WitnessFeedStale:
+		return displayWitnessFeedStale
+	case *WitnessFeedRecovered:
+		return displayWitnessFeedRecovered
+	case *BlockProductionRewardReceived:
+		return displayBlockProductionReward
+	case *CommunitySubscriptionChanged:
+		return displayCommunitySubscription
+	case *CommunityRoleChanged:
+		return displayCommunityRole
+	case *NewPayerDetected:
+		return displayNewPayerDetected
+	case *CustomJSONBroadcast:
+		return displayCustomJSONBroadcast
+	case *Digest:
+		return displayDigest
+	case *DailySummary:
+		return displayDailySummary
+	default:
+		return displayDefault
+	}
+}
@@ -0,0 +1,35 @@
+package events
+
+import (
+	"github.com/go-steem/rpc/apis/database"
+	"github.com/go-steem/rpc/types"
+)
+
+type HardforkOperation struct {
+	HardforkId uint32 `json:"hardfork_id"`
+}
+
+// HardforkActivated is emitted when a hardfork becomes active.
+// It is a global event, it is broadcast instead of being matched against the subscriptions.
+type HardforkActivated struct {
+	Op *HardforkOperation
+}
+
+type HardforkActivatedEventMiner struct{}
+
+func NewHardforkActivatedEventMiner() *HardforkActivatedEventMiner {
+	return &HardforkActivatedEventMiner{}
+}
+
+func (miner *HardforkActivatedEventMiner) MineEvent(
+	operation types.Operation,
+	content *database.Content, // nil
+) ([]interface{}, error) {
+
+	var op HardforkOperation
+	ok, err := unmarshalUnknownOp(operation, TypeHardfork, &op)
+	if !ok || err != nil {
+		return nil, err
+	}
+	return []interface{}{&HardforkActivated{&op}}, nil
+}
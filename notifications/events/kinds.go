@@ -0,0 +1,30 @@
+package events
+
+// Types maps the kinds used in the events collection to the event types.
+var Types = map[string]func() interface{}{
+	"account.updated":                func() interface{} { return &AccountUpdated{} },
+	"account.witness_voted":          func() interface{} { return &AccountWitnessVoted{} },
+	"transfer.made":                  func() interface{} { return &TransferMade{} },
+	"user.mentioned":                 func() interface{} { return &UserMentioned{} },
+	"user.follow_changed":            func() interface{} { return &UserFollowStatusChanged{} },
+	"story.published":                func() interface{} { return &StoryPublished{} },
+	"story.voted":                    func() interface{} { return &StoryVoted{} },
+	"comment.published":              func() interface{} { return &CommentPublished{} },
+	"comment.voted":                  func() interface{} { return &CommentVoted{} },
+	"account.creation_token_claimed": func() interface{} { return &AccountCreationTokenClaimed{} },
+	"post.payout_approaching":        func() interface{} { return &PayoutApproaching{} },
+	"post.paid_out":                  func() interface{} { return &PostPaidOut{} },
+	"witness.properties_set":         func() interface{} { return &WitnessPropertiesSet{} },
+	"witness.feed_stale":             func() interface{} { return &WitnessFeedStale{} },
+	"witness.feed_recovered":         func() interface{} { return &WitnessFeedRecovered{} },
+	"witness.production_reward":      func() interface{} { return &BlockProductionRewardReceived{} },
+	"community.subscription_changed": func() interface{} { return &CommunitySubscriptionChanged{} },
+	"community.role_changed":         func() interface{} { return &CommunityRoleChanged{} },
+	"transfer.new_payer":             func() interface{} { return &NewPayerDetected{} },
+	"custom_json.firehose":           func() interface{} { return &CustomJSONBroadcast{} },
+	"account.created":                func() interface{} { return &AccountCreated{} },
+	"chain.hardfork_activated":       func() interface{} { return &HardforkActivated{} },
+	"account.activity":               func() interface{} { return &AccountActivity{} },
+	"rc.delegated":                   func() interface{} { return &RCDelegated{} },
+	"rc.delegation_removed":          func() interface{} { return &RCDelegationRemoved{} },
+}
@@ -0,0 +1,32 @@
+package events
+
+import (
+	"github.com/go-steem/rpc/apis/database"
+	"github.com/go-steem/rpc/types"
+)
+
+// NewPayerDetected is emitted for a transfer to a watched account
+// from an account that has not transferred to it before.
+type NewPayerDetected struct {
+	Op *types.TransferOperation
+	// Transfers is the number of transfers from the payer including this one.
+	Transfers uint
+}
+
+type NewPayerDetectedEventMiner struct{}
+
+func NewNewPayerDetectedEventMiner() *NewPayerDetectedEventMiner {
+	return &NewPayerDetectedEventMiner{}
+}
+
+func (miner *NewPayerDetectedEventMiner) MineEvent(
+	operation types.Operation,
+	content *database.Content, // nil
+) ([]interface{}, error) {
+
+	op, ok := operation.Data().(*types.TransferOperation)
+	if !ok || op.From == op.To {
+		return nil, nil
+	}
+	return []interface{}{&NewPayerDetected{Op: op}}, nil
+}
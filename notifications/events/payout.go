@@ -0,0 +1,40 @@
+package events
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-steem/rpc/apis/database"
+)
+
+// PayoutApproaching is emitted by the payout tracker when a tracked post
+// is going to be paid out within LeadTime.
+type PayoutApproaching struct {
+	Content  *database.Content
+	LeadTime time.Duration
+}
+
+// TimeLeft returns the lead time in the form used in the notifications, e.g. "12 hours".
+func (event *PayoutApproaching) TimeLeft() string {
+	if event.LeadTime >= time.Hour {
+		hours := int(event.LeadTime / time.Hour)
+		if hours == 1 {
+			return "1 hour"
+		}
+		return fmt.Sprintf("%v hours", hours)
+	}
+
+	minutes := int(event.LeadTime / time.Minute)
+	if minutes == 1 {
+		return "1 minute"
+	}
+	return fmt.Sprintf("%v minutes", minutes)
+}
+
+// PostPaidOut is emitted by the payout tracker once a tracked post is paid out.
+// Content is fetched after the payout, so it contains the final payout values.
+type PostPaidOut struct {
+	Content *database.Content
+	// CuratorPayout is the curator payout value, which is not part of database.Content.
+	CuratorPayout string
+}
@@ -0,0 +1,83 @@
+package events
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-steem/rpc/apis/database"
+	"github.com/go-steem/rpc/types"
+	"github.com/pkg/errors"
+)
+
+// ProducerRewardOperation is the virtual operation emitted for every block produced.
+type ProducerRewardOperation struct {
+	Producer      string `json:"producer"`
+	VestingShares string `json:"vesting_shares"`
+}
+
+// VestsPrecision is the number of decimal places used for VESTS amounts.
+const VestsPrecision = 6
+
+type BlockProductionRewardReceived struct {
+	Op *ProducerRewardOperation
+	// Blocks is the number of blocks the reward is summed over, 1 for a single block.
+	Blocks uint
+	// Day is set for the daily totals, formatted as 2006-01-02 (UTC).
+	Day string `json:",omitempty"`
+}
+
+// Aggregated returns true for the daily totals.
+func (event *BlockProductionRewardReceived) Aggregated() bool {
+	return event.Day != ""
+}
+
+type BlockProductionRewardReceivedEventMiner struct{}
+
+func NewBlockProductionRewardReceivedEventMiner() *BlockProductionRewardReceivedEventMiner {
+	return &BlockProductionRewardReceivedEventMiner{}
+}
+
+func (miner *BlockProductionRewardReceivedEventMiner) MineEvent(
+	operation types.Operation,
+	content *database.Content, // nil
+) ([]interface{}, error) {
+
+	var op ProducerRewardOperation
+	ok, err := unmarshalUnknownOp(operation, TypeProducerReward, &op)
+	if !ok || err != nil {
+		return nil, err
+	}
+
+	return []interface{}{&BlockProductionRewardReceived{Op: &op, Blocks: 1}}, nil
+}
+
+// ParseVests turns a VESTS amount such as "1234.567890 VESTS" into millionths of VESTS.
+func ParseVests(amount string) (int64, error) {
+	value := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(amount), "VESTS"))
+
+	parts := strings.SplitN(value, ".", 2)
+	whole, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, errors.Errorf("invalid VESTS amount: %v", amount)
+	}
+
+	var fraction int64
+	if len(parts) == 2 {
+		digits := parts[1]
+		if len(digits) > VestsPrecision {
+			return 0, errors.Errorf("invalid VESTS amount: %v", amount)
+		}
+		digits += strings.Repeat("0", VestsPrecision-len(digits))
+		fraction, err = strconv.ParseInt(digits, 10, 64)
+		if err != nil {
+			return 0, errors.Errorf("invalid VESTS amount: %v", amount)
+		}
+	}
+	return whole*1000000 + fraction, nil
+}
+
+// FormatVests is the inverse of ParseVests.
+func FormatVests(micro int64) string {
+	return fmt.Sprintf("%d.%06d VESTS", micro/1000000, micro%1000000)
+}
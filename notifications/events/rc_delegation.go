@@ -0,0 +1,111 @@
+package events
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/go-steem/rpc/apis/database"
+	"github.com/go-steem/rpc/types"
+)
+
+// RCCustomJSONID is the custom_json ID used by the resource credit operations.
+const RCCustomJSONID = "rc"
+
+const RCActionDelegate = "delegate_rc"
+
+// RCDelegationOperation is a single delegation decoded from the delegate_rc custom_json,
+// e.g. ["delegate_rc", {"from": "alice", "delegatees": ["bob"], "max_rc": 1000000000}].
+// The operation can list multiple delegatees, there is one RCDelegationOperation for each.
+type RCDelegationOperation struct {
+	Delegator string `json:"delegator"`
+	Delegatee string `json:"delegatee"`
+	MaxRC     int64  `json:"max_rc"`
+}
+
+// RCDelegated is emitted when RC are delegated or the delegation is changed.
+type RCDelegated struct {
+	Op *RCDelegationOperation
+}
+
+// RCDelegationRemoved is emitted when the delegation is set to 0.
+type RCDelegationRemoved struct {
+	Op *RCDelegationOperation
+}
+
+type RCDelegationEventMiner struct{}
+
+func NewRCDelegationEventMiner() *RCDelegationEventMiner {
+	return &RCDelegationEventMiner{}
+}
+
+func (miner *RCDelegationEventMiner) MineEvent(
+	operation types.Operation,
+	content *database.Content, // nil
+) ([]interface{}, error) {
+
+	op, ok := operation.Data().(*types.CustomJSONOperation)
+	if !ok || op.ID != RCCustomJSONID {
+		return nil, nil
+	}
+
+	// Anybody can broadcast anything, so malformed payloads are simply ignored.
+	ops := parseRCDelegation(op)
+
+	evs := make([]interface{}, 0, len(ops))
+	for _, delegation := range ops {
+		if delegation.MaxRC == 0 {
+			evs = append(evs, &RCDelegationRemoved{delegation})
+		} else {
+			evs = append(evs, &RCDelegated{delegation})
+		}
+	}
+	return evs, nil
+}
+
+// parseRCDelegation decodes the custom_json payload, returning nil when it's not a valid delegation.
+func parseRCDelegation(op *types.CustomJSONOperation) []*RCDelegationOperation {
+	account := signer(op)
+	if account == "" {
+		return nil
+	}
+
+	var payload []json.RawMessage
+	if err := json.Unmarshal([]byte(op.JSON), &payload); err != nil || len(payload) != 2 {
+		return nil
+	}
+
+	var action string
+	if err := json.Unmarshal(payload[0], &action); err != nil || action != RCActionDelegate {
+		return nil
+	}
+
+	var params struct {
+		From       string      `json:"from"`
+		Delegatees []string    `json:"delegatees"`
+		MaxRC      json.Number `json:"max_rc"`
+	}
+	if err := json.Unmarshal(payload[1], &params); err != nil {
+		return nil
+	}
+	// The delegation can only be made from the account that signed the operation.
+	if params.From != account || len(params.Delegatees) == 0 {
+		return nil
+	}
+	maxRC, err := strconv.ParseInt(params.MaxRC.String(), 10, 64)
+	if err != nil || maxRC < 0 {
+		return nil
+	}
+
+	ops := make([]*RCDelegationOperation, 0, len(params.Delegatees))
+	for _, delegatee := range params.Delegatees {
+		if delegatee == "" {
+			continue
+		}
+		ops = append(ops, &RCDelegationOperation{
+			Delegator: account,
+			Delegatee: delegatee,
+			MaxRC:     maxRC,
+		})
+	}
+	return ops
+}
@@ -1,6 +1,8 @@
 package events
 
 import (
+	"time"
+
 	"github.com/go-steem/rpc/apis/database"
 	"github.com/go-steem/rpc/types"
 )
@@ -8,6 +10,14 @@ import (
 type StoryPublished struct {
 	Op      *types.CommentOperation
 	Content *database.Content
+	Edited  bool
+}
+
+func (event *StoryPublished) Verb() string {
+	if event.Edited {
+		return "updated"
+	}
+	return "published"
 }
 
 type StoryPublishedEventMiner struct{}
@@ -21,6 +31,16 @@ func (miner *StoryPublishedEventMiner) MineEvent(
 	content *database.Content,
 ) ([]interface{}, error) {
 
+	return miner.MineBlockEvent(operation, content, time.Time{})
+}
+
+// MineBlockEvent uses the block time to tell a new post from an edit.
+func (miner *StoryPublishedEventMiner) MineBlockEvent(
+	operation types.Operation,
+	content *database.Content,
+	blockTime time.Time,
+) ([]interface{}, error) {
+
 	if !content.IsStory() {
 		return nil, nil
 	}
@@ -30,5 +50,5 @@ func (miner *StoryPublishedEventMiner) MineEvent(
 		return nil, nil
 	}
 
-	return []interface{}{&StoryPublished{op, content}}, nil
+	return []interface{}{&StoryPublished{op, content, isEdit(content, blockTime)}}, nil
 }
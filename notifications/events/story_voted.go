@@ -8,6 +8,8 @@ import (
 type StoryVoted struct {
 	Op      *types.VoteOperation
 	Content *database.Content
+	// Revote is set when an existing vote was changed.
+	Revote *VoteChange
 }
 
 type StoryVotedEventMiner struct{}
@@ -30,5 +32,5 @@ func (miner *StoryVotedEventMiner) MineEvent(
 		return nil, nil
 	}
 
-	return []interface{}{&StoryVoted{op, content}}, nil
+	return []interface{}{&StoryVoted{Op: op, Content: content}}, nil
 }
@@ -0,0 +1,140 @@
+package events
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// The sections of the daily summary. All of them are included unless the user chooses some.
+const (
+	SummarySectionMentions  = "mentions"
+	SummarySectionTransfers = "transfers"
+	SummarySectionVoters    = "voters"
+	SummarySectionRewards   = "rewards"
+	SummarySectionNotable   = "notable"
+)
+
+var SummarySections = []string{
+	SummarySectionMentions,
+	SummarySectionTransfers,
+	SummarySectionVoters,
+	SummarySectionRewards,
+	SummarySectionNotable,
+}
+
+// DailySummary reports the activity of a user's day, delivered once per day at the time chosen
+// by the user. Unlike the digest, it sums the events up instead of listing them.
+// The sections not chosen by the user are left empty.
+type DailySummary struct {
+	// Day is the date the summary is sent on in the user's time zone, formatted as 2006-01-02.
+	Day      string
+	Since    time.Time
+	Until    time.Time
+	Events   uint
+	Sections []string
+
+	Mentions  uint
+	Flows     []*AssetFlow
+	TopVoters []*VoterCount
+	Rewards   []*AssetTotal
+	// Notable contains the titles of the events worth a closer look, e.g. the account updates.
+	Notable []string
+}
+
+// AssetFlow sums up the transfers from and to the user's accounts in a single asset.
+type AssetFlow struct {
+	Symbol string  `json:"symbol"`
+	In     float64 `json:"in"`
+	Out    float64 `json:"out"`
+}
+
+func (flow *AssetFlow) Net() float64 {
+	return flow.In - flow.Out
+}
+
+type VoterCount struct {
+	Voter string `json:"voter"`
+	Votes uint   `json:"votes"`
+}
+
+type AssetTotal struct {
+	Symbol string  `json:"symbol"`
+	Amount float64 `json:"amount"`
+}
+
+func (total *AssetTotal) String() string {
+	return formatAssetAmount(total.Amount, total.Symbol)
+}
+
+func formatAssetAmount(amount float64, symbol string) string {
+	if symbol == "VESTS" {
+		return fmt.Sprintf("%.*f %v", VestsPrecision, amount, symbol)
+	}
+	return fmt.Sprintf("%.3f %v", amount, symbol)
+}
+
+// Includes returns true when the section was chosen by the user.
+func (summary *DailySummary) Includes(section string) bool {
+	if len(summary.Sections) == 0 {
+		return true
+	}
+	for _, s := range summary.Sections {
+		if s == section {
+			return true
+		}
+	}
+	return false
+}
+
+// SummaryPart is a section of the summary rendered as plain text.
+type SummaryPart struct {
+	Title string
+	Text  string
+}
+
+// Parts renders the sections with something to report, in the order of SummarySections,
+// so that all the channels report the same numbers the same way.
+func (summary *DailySummary) Parts() []*SummaryPart {
+	var parts []*SummaryPart
+	add := func(section, title, text string) {
+		if text != "" && summary.Includes(section) {
+			parts = append(parts, &SummaryPart{title, text})
+		}
+	}
+
+	if summary.Mentions != 0 {
+		add(SummarySectionMentions, "Mentions", fmt.Sprint(summary.Mentions))
+	}
+
+	flows := make([]string, 0, len(summary.Flows))
+	for _, flow := range summary.Flows {
+		net := formatAssetAmount(flow.Net(), flow.Symbol)
+		if flow.Net() >= 0 {
+			net = "+" + net
+		}
+		flows = append(flows, fmt.Sprintf("%v (in %v, out %v)", net,
+			formatAssetAmount(flow.In, flow.Symbol), formatAssetAmount(flow.Out, flow.Symbol)))
+	}
+	add(SummarySectionTransfers, "Transfers", strings.Join(flows, "\n"))
+
+	voters := make([]string, 0, len(summary.TopVoters))
+	for _, voter := range summary.TopVoters {
+		voters = append(voters, fmt.Sprintf("@%v (%v)", voter.Voter, voter.Votes))
+	}
+	add(SummarySectionVoters, "Top voters", strings.Join(voters, ", "))
+
+	rewards := make([]string, 0, len(summary.Rewards))
+	for _, reward := range summary.Rewards {
+		rewards = append(rewards, reward.String())
+	}
+	add(SummarySectionRewards, "Rewards", strings.Join(rewards, ", "))
+
+	notable := make([]string, 0, len(summary.Notable))
+	for _, title := range summary.Notable {
+		notable = append(notable, "- "+title)
+	}
+	add(SummarySectionNotable, "Notable", strings.Join(notable, "\n"))
+
+	return parts
+}
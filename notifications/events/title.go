@@ -0,0 +1,195 @@
+package events
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+// MaxTitleLength is the maximum length of a rendered title.
+const MaxTitleLength = 120
+
+// MaxTitleTemplateLength is the maximum length of a title template.
+const MaxTitleTemplateLength = 500
+
+// DefaultTitle returns the short title used by the channels that show a title
+// separately from the message body, e.g. the Slack attachment title.
+func DefaultTitle(event interface{}) string {
+	switch event := event.(type) {
+	case *AccountUpdated:
+		return fmt.Sprintf("Account @%v updated", event.Op.Account)
+	case *AccountWitnessVoted:
+		if event.Op.Approve {
+			return fmt.Sprintf("@%v approved witness @%v", event.Op.Account, event.Op.Witness)
+		}
+		return fmt.Sprintf("@%v unapproved witness @%v", event.Op.Account, event.Op.Witness)
+	case *TransferMade:
+		if event.RoundTrip != nil {
+			return fmt.Sprintf("@%v sent %v to @%v and back", event.Op.From, event.Op.Amount, event.Op.To)
+		}
+		return fmt.Sprintf("@%v sent %v to @%v", event.Op.From, event.Op.Amount, event.Op.To)
+	case *UserMentioned:
+		return fmt.Sprintf("New mention from @%v", event.Content.Author)
+	case *UserFollowStatusChanged:
+		switch {
+		case event.Followed():
+			return fmt.Sprintf("@%v followed @%v", event.Op.Follower, event.Op.Following)
+		case event.Muted():
+			return fmt.Sprintf("@%v muted @%v", event.Op.Follower, event.Op.Following)
+		default:
+			return fmt.Sprintf("@%v unfollowed @%v", event.Op.Follower, event.Op.Following)
+		}
+	case *StoryPublished:
+		return fmt.Sprintf("Story %v by @%v", event.Verb(), event.Content.Author)
+	case *StoryVoted:
+		return fmt.Sprintf("@%v %v on a story by @%v", event.Op.Voter, event.Verb(), event.Op.Author)
+	case *CommentPublished:
+		return fmt.Sprintf("New comment from @%v", event.Content.Author)
+	case *CommentVoted:
+		return fmt.Sprintf("@%v %v on a comment by @%v", event.Op.Voter, event.Verb(), event.Op.Author)
+	case *AccountCreationTokenClaimed:
+		return fmt.Sprintf("@%v claimed an account creation token", event.Op.Creator)
+	case *HardforkActivated:
+		return fmt.Sprintf("Hardfork %v activated", event.Op.HardforkId)
+	case *AccountCreated:
+		return fmt.Sprintf("@%v created account @%v", event.Op.Creator, event.Op.NewAccountName)
+	case *AccountActivity:
+		return fmt.Sprintf("%v operation by @%v", event.OpType, strings.Join(event.Accounts, ", @"))
+	case *RCDelegated:
+		return fmt.Sprintf("@%v delegated %v RC to @%v", event.Op.Delegator, event.Op.MaxRC, event.Op.Delegatee)
+	case *RCDelegationRemoved:
+		return fmt.Sprintf("@%v removed the RC delegation to @%v", event.Op.Delegator, event.Op.Delegatee)
+	case *PayoutApproaching:
+		return fmt.Sprintf("Payout in %v: %v", event.TimeLeft(), event.Content.Title)
+	case *PostPaidOut:
+		return fmt.Sprintf("Paid out: %v", event.Content.Title)
+	case *WitnessPropertiesSet:
+		return fmt.Sprintf("Witness @%v updated its properties", event.Op.Owner)
+	case *WitnessFeedStale:
+		return fmt.Sprintf("Witness @%v has not published the price feed for %v", event.Witness, event.Age())
+	case *WitnessFeedRecovered:
+		return fmt.Sprintf("Witness @%v published the price feed again", event.Witness)
+	case *BlockProductionRewardReceived:
+		if event.Aggregated() {
+			return fmt.Sprintf("Witness @%v produced %v blocks", event.Op.Producer, event.Blocks)
+		}
+		return fmt.Sprintf("Witness @%v produced a block", event.Op.Producer)
+	case *CommunitySubscriptionChanged:
+		if event.Subscribed() {
+			return fmt.Sprintf("@%v subscribed to %v", event.Op.Account, event.Op.Community)
+		}
+		return fmt.Sprintf("@%v unsubscribed from %v", event.Op.Account, event.Op.Community)
+	case *CommunityRoleChanged:
+		return fmt.Sprintf("@%v is now %v in %v", event.Op.Target, event.Op.Role, event.Op.Community)
+	case *NewPayerDetected:
+		return fmt.Sprintf("New payer @%v sent %v", event.Op.From, event.Op.Amount)
+	case *CustomJSONBroadcast:
+		return fmt.Sprintf("custom_json %v by @%v", event.Op.ID, event.Account())
+	case *Digest:
+		return fmt.Sprintf("%v events since %v", len(event.Events),
+			event.Since.UTC().Format("Jan 2 15:04 MST"))
+	case *DailySummary:
+		return fmt.Sprintf("Daily summary for %v: %v events", event.Day, event.Events)
+	default:
+		return DisplayOf(event).Label
+	}
+}
+
+// ParseTitleTemplate parses a user-defined title template.
+// The template is executed with the event as the data, e.g. "{{.Op.From}} sent {{.Op.Amount}}".
+func ParseTitleTemplate(text string) (*template.Template, error) {
+	if len(text) > MaxTitleTemplateLength {
+		return nil, errors.Errorf("title template too long, the limit is %v bytes", MaxTitleTemplateLength)
+	}
+	tmpl, err := template.New("title").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid title template")
+	}
+	return tmpl, nil
+}
+
+// CompileTitleTemplate parses the title template for the given event kind and checks
+// that the template renders, i.e. that it only refers to what the event provides,
+// by executing it with an empty event of the kind.
+func CompileTitleTemplate(kind, text string) (*template.Template, error) {
+	newEvent, ok := Types[kind]
+	if !ok {
+		return nil, errors.Errorf("unknown event kind: %v", kind)
+	}
+
+	tmpl, err := ParseTitleTemplate(text)
+	if err != nil {
+		return nil, err
+	}
+
+	// The methods of the event, e.g. Asset, may fail on an empty event,
+	// only the references to what the event does not provide are rejected.
+	event := newEvent()
+	fillEmpty(reflect.ValueOf(event).Elem(), 0)
+	if err := tmpl.Execute(ioutil.Discard, event); err != nil && !strings.Contains(err.Error(), "error calling ") {
+		return nil, errors.Wrap(err, "invalid title template")
+	}
+	return tmpl, nil
+}
+
+// fillEmpty allocates the nil pointers of the struct so that the template can reach
+// all the fields of an empty event. The recursive types are only filled a few levels deep.
+func fillEmpty(v reflect.Value, depth int) {
+	if depth > 8 {
+		return
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		fillEmpty(v.Elem(), depth+1)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if field := v.Field(i); field.CanSet() {
+				fillEmpty(field, depth+1)
+			}
+		}
+	}
+}
+
+// Title renders the title for the event using the given template.
+// The default title is returned when the template is empty or fails to render.
+func Title(event interface{}, text string) (string, error) {
+	if text == "" {
+		return DefaultTitle(event), nil
+	}
+
+	tmpl, err := ParseTitleTemplate(text)
+	if err != nil {
+		return DefaultTitle(event), err
+	}
+	return RenderTitle(event, tmpl)
+}
+
+// RenderTitle is Title for the template parsed already, see CompileTitleTemplate.
+// The default title is returned when the template is nil.
+func RenderTitle(event interface{}, tmpl *template.Template) (string, error) {
+	if tmpl == nil {
+		return DefaultTitle(event), nil
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, event); err != nil {
+		return DefaultTitle(event), errors.Wrap(err, "failed to render title template")
+	}
+
+	title := strings.Join(strings.Fields(buf.String()), " ")
+	if title == "" {
+		return DefaultTitle(event), nil
+	}
+	if runes := []rune(title); len(runes) > MaxTitleLength {
+		title = string(runes[:MaxTitleLength-1]) + "…"
+	}
+	return title, nil
+}
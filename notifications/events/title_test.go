@@ -0,0 +1,28 @@
+package events
+
+import (
+	"testing"
+)
+
+func TestCompileTitleTemplate(t *testing.T) {
+	testCases := []struct {
+		name  string
+		kind  string
+		text  string
+		valid bool
+	}{
+		{"operation field", "transfer.made", "{{.Op.From}} sent {{.Op.Amount}}", true},
+		{"optional part", "transfer.made", "{{if .RoundTrip}}round trip{{end}}", true},
+		{"method", "transfer.made", "{{.Asset}} received", true},
+		{"unknown field", "transfer.made", "{{.Op.Nope}}", false},
+		{"field of another kind", "transfer.made", "{{.Op.Voter}}", false},
+		{"unknown kind", "transfer.sent", "{{.Op.From}}", false},
+		{"syntax error", "transfer.made", "{{.Op.From", false},
+	}
+
+	for _, tc := range testCases {
+		if _, err := CompileTitleTemplate(tc.kind, tc.text); (err == nil) != tc.valid {
+			t.Errorf("%v: got error %v, valid %v", tc.name, err, tc.valid)
+		}
+	}
+}
@@ -1,12 +1,84 @@
 package events
 
 import (
+	"fmt"
+
 	"github.com/go-steem/rpc/apis/database"
 	"github.com/go-steem/rpc/types"
 )
 
 type TransferMade struct {
 	Op *types.TransferOperation
+
+	// Exchange is set when either side of the transfer is a known exchange account.
+	Exchange *TransferExchange
+
+	// Match is set per user when the transfer matched the user's accounts list,
+	// which is watched for the transfers in both directions.
+	Match *TransferMatch
+
+	// RoundTrip is set when the same amount was sent back within the round-trip window.
+	// Both transfers are delivered as this single event then.
+	RoundTrip *TransferRoundTrip
+}
+
+// Asset returns the symbol of the transferred asset, e.g. STEEM or SBD.
+func (event *TransferMade) Asset() (string, error) {
+	return AssetSymbol(event.Op.Amount)
+}
+
+type TransferExchange struct {
+	Account string
+	Label   string
+	// Deposit is true when the transfer goes to the exchange.
+	Deposit bool
+}
+
+// MemoRequired returns true for exchange deposits,
+// which cannot be credited to the right exchange user without a memo.
+func (exchange *TransferExchange) MemoRequired() bool {
+	return exchange.Deposit
+}
+
+func (exchange *TransferExchange) Describe() string {
+	if exchange.Deposit {
+		return fmt.Sprintf("Deposit to %v (@%v), memo required", exchange.Label, exchange.Account)
+	}
+	return fmt.Sprintf("Withdrawal from %v (@%v)", exchange.Label, exchange.Account)
+}
+
+// TransferRoundTrip is the transfer that sent the amount back.
+type TransferRoundTrip struct {
+	Return *types.TransferOperation
+}
+
+func (trip *TransferRoundTrip) Describe() string {
+	if trip.Return.Memo != "" {
+		return fmt.Sprintf("Sent back by @%v using memo %q", trip.Return.From, trip.Return.Memo)
+	}
+	return fmt.Sprintf("Sent back by @%v", trip.Return.From)
+}
+
+// SelfTransfer returns true when the account transferred the amount to itself.
+func (event *TransferMade) SelfTransfer() bool {
+	return event.Op.From == event.Op.To
+}
+
+// TransferMatch tells which side of the transfer is the watched account.
+type TransferMatch struct {
+	Account string
+	// Incoming is true when the watched account is the recipient.
+	Incoming bool
+	// Internal is true when both sides are watched, Account is the recipient then.
+	Internal bool
+}
+
+// Direction returns "incoming" or "outgoing" relative to the watched account.
+func (match *TransferMatch) Direction() string {
+	if match.Incoming {
+		return "incoming"
+	}
+	return "outgoing"
 }
 
 type TransferMadeEventMiner struct{}
@@ -24,5 +96,5 @@ func (miner *TransferMadeEventMiner) MineEvent(
 	if !ok {
 		return nil, nil
 	}
-	return []interface{}{&TransferMade{op}}, nil
+	return []interface{}{&TransferMade{Op: op}}, nil
 }
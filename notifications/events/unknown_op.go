@@ -0,0 +1,36 @@
+package events
+
+import (
+	"encoding/json"
+
+	"github.com/go-steem/rpc/types"
+	"github.com/pkg/errors"
+)
+
+// Operation types that the RPC library does not know about.
+// Such operations are passed through undecoded.
+const (
+	TypeClaimAccount                types.OpType = "claim_account"
+	TypeAccountCreateWithDelegation types.OpType = "account_create_with_delegation"
+	TypeWitnessSetProperties        types.OpType = "witness_set_properties"
+	TypeProducerReward              types.OpType = "producer_reward"
+	TypeHardfork                    types.OpType = "hardfork"
+)
+
+// unmarshalUnknownOp decodes the body of an operation the RPC library does not know about.
+// It returns false when the operation is not of the given type.
+func unmarshalUnknownOp(operation types.Operation, opType types.OpType, v interface{}) (bool, error) {
+	if operation.Type() != opType {
+		return false, nil
+	}
+
+	raw, ok := operation.Data().(*json.RawMessage)
+	if !ok || raw == nil {
+		return false, nil
+	}
+
+	if err := json.Unmarshal([]byte(*raw), v); err != nil {
+		return false, errors.Wrapf(err, "failed to unmarshal %v operation", opType)
+	}
+	return true, nil
+}
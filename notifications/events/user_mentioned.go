@@ -2,6 +2,7 @@ package events
 
 import (
 	"regexp"
+	"strings"
 
 	"github.com/go-steem/rpc/apis/database"
 	"github.com/go-steem/rpc/types"
@@ -19,7 +20,9 @@ type UserMentionedEventMiner struct {
 
 func NewUserMentionedEventMiner() *UserMentionedEventMiner {
 	return &UserMentionedEventMiner{
-		re: regexp.MustCompile(`@([a-z0-9\-]+)`),
+		// Case and trailing punctuation are dealt with in NormalizeMention,
+		// the character preceding the mention in MineEvent.
+		re: regexp.MustCompile(`@([A-Za-z0-9][A-Za-z0-9.\-]*)`),
 	}
 }
 
@@ -33,11 +36,49 @@ func (miner *UserMentionedEventMiner) MineEvent(
 		return nil, nil
 	}
 
-	match := miner.re.FindAllStringSubmatch(content.Body, -1)
+	body := content.Body
+	match := miner.re.FindAllStringSubmatchIndex(body, -1)
 
-	events := make([]interface{}, 0, len(match))
+	// The content is a single post or comment, so an account mentioned several times
+	// in it, possibly spelled differently, e.g. @Alice and @alice, is only mentioned once.
+	var (
+		events    = make([]interface{}, 0, len(match))
+		mentioned = make(map[string]bool, len(match))
+	)
 	for _, m := range match {
-		events = append(events, &UserMentioned{op, content, m[1]})
+		// The mention must not be preceded by a word character so that e-mail addresses are skipped.
+		// The character is checked here rather than matched, otherwise it would be consumed
+		// and adjacent mentions, e.g. @alice.@bob, would be missed.
+		if m[0] > 0 && isWordByte(body[m[0]-1]) {
+			continue
+		}
+		user, ok := NormalizeMention(body[m[2]:m[3]])
+		if !ok || mentioned[user] {
+			continue
+		}
+		mentioned[user] = true
+		events = append(events, &UserMentioned{op, content, user})
 	}
 	return events, nil
 }
+
+func isWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_'
+}
+
+// NormalizeMention turns the text following @ into an account name.
+// Account names are lowercase, so the case is folded, and any punctuation
+// following the mention, e.g. `@alice.` or `@alice-`, is stripped.
+// It returns false when the result cannot be a valid account name.
+func NormalizeMention(token string) (string, bool) {
+	name := strings.TrimRight(strings.ToLower(token), ".-")
+	if len(name) < 3 || len(name) > 16 {
+		return "", false
+	}
+	for _, segment := range strings.Split(name, ".") {
+		if segment == "" || segment[0] < 'a' || segment[0] > 'z' {
+			return "", false
+		}
+	}
+	return name, true
+}
@@ -0,0 +1,89 @@
+package events
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-steem/rpc/apis/database"
+	"github.com/go-steem/rpc/types"
+)
+
+func TestUserMentionedEventMiner(t *testing.T) {
+	testCases := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{"plain", "thanks @alice", []string{"alice"}},
+		{"start of the body", "@alice thanks", []string{"alice"}},
+		{"dots and dashes", "ping @name.with-dots", []string{"name.with-dots"}},
+		{"trailing period", "thanks @alice.", []string{"alice"}},
+		{"trailing comma", "@alice, @bob-charlie: hi", []string{"alice", "bob-charlie"}},
+		{"trailing dash", "and @alice- too", []string{"alice"}},
+		{"parentheses", "(cc @alice)", []string{"alice"}},
+		{"uppercase", "Hey @Alice and @BOB.SMITH", []string{"alice", "bob.smith"}},
+		{"adjacent after comma", "@alice,@bob", []string{"alice", "bob"}},
+		{"adjacent after period", "@alice.@bob", []string{"alice", "bob"}},
+		{"adjacent after dash", "@alice-@bob", []string{"alice", "bob"}},
+		{"email", "write to alice@example.com", nil},
+		{"email and mention", "alice@example.com or @bob", []string{"bob"}},
+		{"url", "see https://steemit.com/@alice/my-post", []string{"alice"}},
+		{"too short", "@al is not an account", nil},
+		{"digit first", "@1alice is not an account", nil},
+		{"empty segment", "@alice..bob", nil},
+		{"repeated", "@alice, thanks @alice! @alice", []string{"alice"}},
+		{"repeated in different case", "@Alice @alice @ALICE.", []string{"alice"}},
+		{"repeated among others", "@alice @bob @alice @bob @carol", []string{"alice", "bob", "carol"}},
+	}
+
+	miner := NewUserMentionedEventMiner()
+	for _, tc := range testCases {
+		op := &types.CommentOperation{Author: "author", Permlink: "permlink", Body: tc.body}
+		content := &database.Content{Author: "author", Permlink: "permlink", Body: tc.body}
+
+		events, err := miner.MineEvent(op, content)
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", tc.name, err)
+			continue
+		}
+
+		var got []string
+		for _, event := range events {
+			got = append(got, event.(*UserMentioned).User)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%v: %q: got %v, want %v", tc.name, tc.body, got, tc.want)
+		}
+	}
+}
+
+func TestNormalizeMention(t *testing.T) {
+	testCases := []struct {
+		token string
+		want  string
+		ok    bool
+	}{
+		{"alice", "alice", true},
+		{"Alice", "alice", true},
+		{"alice.", "alice", true},
+		{"alice...", "alice", true},
+		{"alice-", "alice", true},
+		{"alice.-", "alice", true},
+		{"name.with-dots", "name.with-dots", true},
+		{"Name.With-Dots.", "name.with-dots", true},
+		{"al", "", false},
+		{"al.", "", false},
+		{"abcdefghijklmnopq", "", false},
+		{"1alice", "", false},
+		{"alice.1bob", "", false},
+		{"alice..bob", "", false},
+		{"-alice", "", false},
+	}
+
+	for _, tc := range testCases {
+		got, ok := NormalizeMention(tc.token)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("NormalizeMention(%q): got (%q, %v), want (%q, %v)", tc.token, got, ok, tc.want, tc.ok)
+		}
+	}
+}
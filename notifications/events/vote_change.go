@@ -0,0 +1,59 @@
+package events
+
+import "fmt"
+
+// VoteChange is set on the vote events when the voter changed the weight
+// of a vote that was already cast on the content.
+type VoteChange struct {
+	PreviousWeight int16
+	Delta          int16
+}
+
+func newVoteChange(previous, current int16) *VoteChange {
+	return &VoteChange{
+		PreviousWeight: previous,
+		Delta:          current - previous,
+	}
+}
+
+// SetPreviousWeight marks the event as a re-vote when the previous weight is known.
+func (event *StoryVoted) SetPreviousWeight(previous int16) {
+	event.Revote = newVoteChange(previous, int16(event.Op.Weight))
+}
+
+// SetPreviousWeight marks the event as a re-vote when the previous weight is known.
+func (event *CommentVoted) SetPreviousWeight(previous int16) {
+	event.Revote = newVoteChange(previous, int16(event.Op.Weight))
+}
+
+func (event *StoryVoted) Verb() string {
+	return voteVerb(event.Revote)
+}
+
+// WeightText returns the vote weight, including the previous weight for a re-vote.
+func (event *StoryVoted) WeightText() string {
+	return voteWeightText(int16(event.Op.Weight), event.Revote)
+}
+
+func (event *CommentVoted) Verb() string {
+	return voteVerb(event.Revote)
+}
+
+// WeightText returns the vote weight, including the previous weight for a re-vote.
+func (event *CommentVoted) WeightText() string {
+	return voteWeightText(int16(event.Op.Weight), event.Revote)
+}
+
+func voteVerb(change *VoteChange) string {
+	if change != nil {
+		return "changed a vote"
+	}
+	return "cast a vote"
+}
+
+func voteWeightText(weight int16, change *VoteChange) string {
+	if change == nil {
+		return fmt.Sprintf("%v", weight)
+	}
+	return fmt.Sprintf("%v → %v (%+d)", change.PreviousWeight, weight, change.Delta)
+}
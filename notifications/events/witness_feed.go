@@ -0,0 +1,75 @@
+package events
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-steem/rpc/types"
+)
+
+// WitnessFeedStale is emitted by the feed monitor when a witness has not published
+// the price feed for longer than Threshold. It is not emitted again until the feed recovers.
+type WitnessFeedStale struct {
+	Witness     string
+	LastPublish time.Time
+	Threshold   time.Duration
+}
+
+// Age returns the threshold in the form used in the notifications, e.g. "1 hour".
+func (event *WitnessFeedStale) Age() string {
+	return formatHours(event.Threshold)
+}
+
+// WitnessFeedRecovered is emitted by the feed monitor when a stale witness publishes the feed again.
+type WitnessFeedRecovered struct {
+	Witness     string
+	LastPublish time.Time
+	PublishedAt time.Time
+}
+
+// Stale returns for how long the feed was not published, e.g. "3 hours".
+func (event *WitnessFeedRecovered) Stale() string {
+	return formatHours(event.PublishedAt.Sub(event.LastPublish))
+}
+
+func formatHours(d time.Duration) string {
+	if d < time.Hour {
+		minutes := int(d / time.Minute)
+		if minutes == 1 {
+			return "1 minute"
+		}
+		return fmt.Sprintf("%v minutes", minutes)
+	}
+
+	hours := int(d / time.Hour)
+	if hours == 1 {
+		return "1 hour"
+	}
+	return fmt.Sprintf("%v hours", hours)
+}
+
+// FeedPublisher returns the witness publishing the price feed in the operation.
+// The feed is published either using feed_publish or, since HF20,
+// using witness_set_properties with sbd_exchange_rate.
+func FeedPublisher(operation types.Operation) (string, bool) {
+	switch operation.Type() {
+	case types.TypeFeedPublish:
+		op, ok := operation.Data().(*types.FeedPublishOperation)
+		if !ok {
+			return "", false
+		}
+		return op.Publisher, true
+
+	case TypeWitnessSetProperties:
+		var op WitnessSetPropertiesOperation
+		ok, err := unmarshalUnknownOp(operation, TypeWitnessSetProperties, &op)
+		if !ok || err != nil {
+			return "", false
+		}
+		if _, ok := op.Props["sbd_exchange_rate"]; !ok {
+			return "", false
+		}
+		return op.Owner, true
+	}
+	return "", false
+}
@@ -0,0 +1,237 @@
+package events
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+
+	"github.com/go-steem/rpc/apis/database"
+	"github.com/go-steem/rpc/types"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ripemd160"
+)
+
+// WitnessSetPropertiesOperation is how witnesses update their properties since HF20.
+// The props are serialized using the chain binary format and hex-encoded.
+type WitnessSetPropertiesOperation struct {
+	Owner string            `json:"owner"`
+	Props WitnessPropsField `json:"props"`
+}
+
+// WitnessPropsField accepts both the [[key, value], ...] and the {key: value} form.
+type WitnessPropsField map[string]string
+
+func (props *WitnessPropsField) UnmarshalJSON(data []byte) error {
+	var pairs [][2]string
+	if err := json.Unmarshal(data, &pairs); err == nil {
+		m := make(WitnessPropsField, len(pairs))
+		for _, pair := range pairs {
+			m[pair[0]] = pair[1]
+		}
+		*props = m
+		return nil
+	}
+
+	var m map[string]string
+	if err := json.Unmarshal(data, &m); err != nil {
+		return errors.Wrap(err, "failed to unmarshal witness props")
+	}
+	*props = m
+	return nil
+}
+
+// WitnessProperty is a single decoded witness property.
+// Value is the raw hex value for the keys that are not known.
+type WitnessProperty struct {
+	Key     string `json:"key"`
+	Value   string `json:"value"`
+	Decoded bool   `json:"decoded"`
+}
+
+type WitnessPropertiesSet struct {
+	Op         *WitnessSetPropertiesOperation
+	Properties []*WitnessProperty
+}
+
+// Property returns the decoded value of the given property, if it was set.
+func (event *WitnessPropertiesSet) Property(key string) (string, bool) {
+	for _, prop := range event.Properties {
+		if prop.Key == key {
+			return prop.Value, true
+		}
+	}
+	return "", false
+}
+
+type WitnessPropertiesSetEventMiner struct{}
+
+func NewWitnessPropertiesSetEventMiner() *WitnessPropertiesSetEventMiner {
+	return &WitnessPropertiesSetEventMiner{}
+}
+
+func (miner *WitnessPropertiesSetEventMiner) MineEvent(
+	operation types.Operation,
+	content *database.Content, // nil
+) ([]interface{}, error) {
+
+	var op WitnessSetPropertiesOperation
+	ok, err := unmarshalUnknownOp(operation, TypeWitnessSetProperties, &op)
+	if !ok || err != nil {
+		return nil, err
+	}
+
+	// The signing key is always included to authenticate the operation,
+	// it is only a change when passed as new_signing_key.
+	keys := make([]string, 0, len(op.Props))
+	for key := range op.Props {
+		if key != "key" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	props := make([]*WitnessProperty, 0, len(keys))
+	for _, key := range keys {
+		props = append(props, decodeWitnessProperty(key, op.Props[key]))
+	}
+
+	return []interface{}{&WitnessPropertiesSet{&op, props}}, nil
+}
+
+func decodeWitnessProperty(key, value string) *WitnessProperty {
+	prop := &WitnessProperty{
+		Key:   key,
+		Value: value,
+	}
+
+	raw, err := hex.DecodeString(value)
+	if err != nil {
+		return prop
+	}
+	r := bytes.NewReader(raw)
+
+	var decoded string
+	switch key {
+	case "account_creation_fee":
+		decoded, err = readAsset(r)
+	case "sbd_exchange_rate":
+		decoded, err = readPrice(r)
+	case "new_signing_key":
+		decoded, err = readPublicKey(r)
+	case "url":
+		decoded, err = readString(r)
+	case "maximum_block_size", "account_subsidy_decay":
+		var v uint32
+		err = binary.Read(r, binary.LittleEndian, &v)
+		decoded = fmt.Sprintf("%v", v)
+	case "account_subsidy_budget":
+		var v int32
+		err = binary.Read(r, binary.LittleEndian, &v)
+		decoded = fmt.Sprintf("%v", v)
+	case "sbd_interest_rate":
+		var v uint16
+		err = binary.Read(r, binary.LittleEndian, &v)
+		decoded = fmt.Sprintf("%.2f%%", float64(v)/100)
+	default:
+		// Unknown or future property, pass it through.
+		return prop
+	}
+	if err != nil {
+		return prop
+	}
+
+	prop.Value = decoded
+	prop.Decoded = true
+	return prop
+}
+
+func readAsset(r *bytes.Reader) (string, error) {
+	var asset struct {
+		Amount    int64
+		Precision uint8
+		Symbol    [7]byte
+	}
+	if err := binary.Read(r, binary.LittleEndian, &asset); err != nil {
+		return "", err
+	}
+
+	amount := new(big.Rat).SetFrac(
+		big.NewInt(asset.Amount),
+		new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(asset.Precision)), nil))
+	symbol := string(bytes.TrimRight(asset.Symbol[:], "\x00"))
+	return amount.FloatString(int(asset.Precision)) + " " + symbol, nil
+}
+
+func readPrice(r *bytes.Reader) (string, error) {
+	base, err := readAsset(r)
+	if err != nil {
+		return "", err
+	}
+	quote, err := readAsset(r)
+	if err != nil {
+		return "", err
+	}
+	return base + " / " + quote, nil
+}
+
+func readString(r *bytes.Reader) (string, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return "", err
+	}
+	if n > uint64(r.Len()) {
+		return "", errors.New("string length out of range")
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+const publicKeyPrefix = "STM"
+
+func readPublicKey(r *bytes.Reader) (string, error) {
+	key := make([]byte, 33)
+	if _, err := io.ReadFull(r, key); err != nil {
+		return "", err
+	}
+
+	h := ripemd160.New()
+	h.Write(key)
+	checksum := h.Sum(nil)[:4]
+
+	return publicKeyPrefix + base58(append(key, checksum...)), nil
+}
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+func base58(data []byte) string {
+	var (
+		n    = new(big.Int).SetBytes(data)
+		zero = big.NewInt(0)
+		base = big.NewInt(58)
+		mod  = new(big.Int)
+		out  []byte
+	)
+	for n.Cmp(zero) > 0 {
+		n.DivMod(n, base, mod)
+		out = append(out, base58Alphabet[mod.Int64()])
+	}
+	for _, b := range data {
+		if b != 0 {
+			break
+		}
+		out = append(out, base58Alphabet[0])
+	}
+
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
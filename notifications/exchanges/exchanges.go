@@ -0,0 +1,102 @@
+package exchanges
+
+import (
+	"sort"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// DefaultAccounts maps well-known exchange accounts to human-readable labels.
+var DefaultAccounts = map[string]string{
+	"bittrex":         "Bittrex",
+	"poloniex":        "Poloniex",
+	"blocktrades":     "Blocktrades",
+	"openledger-dex":  "OpenLedger",
+	"binance-hot":     "Binance",
+	"huobi-pro":       "Huobi",
+	"upbit-exchange":  "Upbit",
+	"hitbtc-exchange": "HitBTC",
+	"changelly":       "Changelly",
+	"deepcrypto8":     "Binance",
+}
+
+// Account labels an exchange account. The per-user overrides are stored as a list
+// of these, the account names can contain dots and cannot be used as document keys.
+type Account struct {
+	Account string `json:"account" bson:"account"`
+	Label   string `json:"label"   bson:"label"`
+}
+
+// Accounts is the list of the per-user exchange account overrides.
+type Accounts []*Account
+
+// SetBSON also accepts the overrides stored as a map of the account names to the labels
+// before they were changed to a list.
+func (accounts *Accounts) SetBSON(raw bson.Raw) error {
+	if raw.Kind != 0x03 {
+		var list []*Account
+		if err := raw.Unmarshal(&list); err != nil {
+			return err
+		}
+		*accounts = list
+		return nil
+	}
+
+	var labels map[string]string
+	if err := raw.Unmarshal(&labels); err != nil {
+		return err
+	}
+	list := make(Accounts, 0, len(labels))
+	for account, label := range labels {
+		list = append(list, &Account{account, label})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Account < list[j].Account
+	})
+	*accounts = list
+	return nil
+}
+
+// Directory resolves account names to exchange labels.
+type Directory struct {
+	labels map[string]string
+}
+
+func NewDirectory(accounts map[string]string) *Directory {
+	if len(accounts) == 0 {
+		accounts = DefaultAccounts
+	}
+
+	labels := make(map[string]string, len(accounts))
+	for account, label := range accounts {
+		labels[account] = label
+	}
+	return &Directory{labels}
+}
+
+// Label returns the exchange label for the given account, if known.
+func (directory *Directory) Label(account string) (string, bool) {
+	label, ok := directory.labels[account]
+	return label, ok
+}
+
+// Override returns a new directory with the given accounts applied on top.
+// An empty label removes the account from the directory.
+func (directory *Directory) Override(accounts Accounts) *Directory {
+	if len(accounts) == 0 {
+		return directory
+	}
+
+	labels := make(map[string]string, len(directory.labels)+len(accounts))
+	for account, label := range directory.labels {
+		labels[account] = label
+	}
+	for _, account := range accounts {
+		if account.Label == "" {
+			delete(labels, account.Account)
+		} else {
+			labels[account.Account] = account.Label
+		}
+	}
+	return &Directory{labels}
+}
@@ -0,0 +1,57 @@
+package notifications
+
+import (
+	"log"
+	"sort"
+
+	"github.com/tchap/steemwatch/server/routes/api/profile"
+)
+
+func (user *UserDoc) usesFallback() bool {
+	return user.Settings.DeliveryMode == profile.DeliveryModeFallback
+}
+
+// orderTargets sorts the targets according to the fallback chain.
+// The targets missing from the chain go last, sorted by the notifier ID.
+func orderTargets(targets []*deliveryTarget, chain []string) {
+	rank := make(map[string]int, len(chain))
+	for i, id := range chain {
+		if _, ok := rank[id]; !ok {
+			rank[id] = i
+		}
+	}
+
+	sort.SliceStable(targets, func(i, j int) bool {
+		ri, iok := rank[targets[i].notifierId]
+		rj, jok := rank[targets[j].notifierId]
+		switch {
+		case iok && jok:
+			return ri < rj
+		case iok != jok:
+			return iok
+		default:
+			return targets[i].notifierId < targets[j].notifierId
+		}
+	})
+}
+
+// deliverFirst tries the targets in order and stops at the first successful delivery.
+// The ID of the notifier that delivered the event is returned, if any.
+func (processor *BlockProcessor) deliverFirst(
+	userId string,
+	event interface{},
+	targets []*deliveryTarget,
+	dispatch func(*deliveryTarget) error,
+	trace *eventTrace,
+) []string {
+
+	for _, target := range targets {
+		// Delivering one at a time is the same as running with concurrency 1.
+		delivered := processor.deliver(userId, event, []*deliveryTarget{target}, 1, dispatch, trace)
+		if len(delivered) != 0 {
+			return delivered
+		}
+		log.Printf("fallback: notifier %v failed for user %v, trying the next one", target.notifierId, userId)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package notifications
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/tchap/steemwatch/notifications/metrics"
+)
+
+// DefaultFanoutSpread is the delay between the batches of the dispatches of an event
+// reaching more users than the fan-out limit.
+const DefaultFanoutSpread = time.Second
+
+// fanoutLimiter spreads the dispatches of an event reaching many users at once,
+// e.g. a post by an account watched by thousands, so that the notifier providers
+// are not hit by all of them at the same time. The first limit dispatches go out
+// right away, the next limit are delayed by spread, and so on.
+//
+// The users matched by an event are counted while the event is being handled,
+// i.e. while looping over the target users, and the fan-out is recorded as a metric
+// once the handling is finished. The dispatches of the events not being handled,
+// e.g. the ingested ones, are neither delayed nor counted.
+// A limit of 0 disables the spreading, the fan-out is still recorded.
+type fanoutLimiter struct {
+	limit  uint
+	spread time.Duration
+
+	events map[interface{}]*fanout
+	lock   sync.Mutex
+}
+
+type fanout struct {
+	kind     string
+	handlers uint
+	total    uint
+	// keys are the events the dispatches are counted for, i.e. the event and its copies.
+	keys []interface{}
+}
+
+func newFanoutLimiter(limit uint, spread time.Duration) *fanoutLimiter {
+	return &fanoutLimiter{
+		limit:  limit,
+		spread: spread,
+		events: make(map[interface{}]*fanout),
+	}
+}
+
+// track starts counting the dispatches of the event. It returns the function to be called
+// once the event is handled, the fan-out is recorded then. The calls can be nested,
+// the fan-out is recorded when the outermost handling is finished.
+func (limiter *fanoutLimiter) track(event interface{}) func() {
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+
+	f, ok := limiter.events[event]
+	if !ok {
+		f = &fanout{kind: eventKind(event), keys: []interface{}{event}}
+		limiter.events[event] = f
+	}
+	f.handlers++
+
+	return func() {
+		limiter.lock.Lock()
+		defer limiter.lock.Unlock()
+
+		if f.handlers--; f.handlers != 0 {
+			return
+		}
+		for _, key := range f.keys {
+			delete(limiter.events, key)
+		}
+		if f.total != 0 {
+			metrics.ObserveFanout(f.kind, f.total)
+		}
+	}
+}
+
+// copied counts the dispatches of the annotated copy towards the fan-out of the event,
+// e.g. a transfer annotated for the particular user.
+func (limiter *fanoutLimiter) copied(event, annotated interface{}) {
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+
+	if f, ok := limiter.events[event]; ok {
+		f.keys = append(f.keys, annotated)
+		limiter.events[annotated] = f
+	}
+}
+
+// begin counts a dispatch of the event. It returns for how long the dispatch is to be delayed.
+func (limiter *fanoutLimiter) begin(event interface{}) time.Duration {
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+
+	f, ok := limiter.events[event]
+	if !ok {
+		return 0
+	}
+	f.total++
+
+	if limiter.limit == 0 || f.total <= limiter.limit {
+		return 0
+	}
+	if f.total == limiter.limit+1 {
+		log.Printf("%v event reaching more than %v users, spreading the delivery", f.kind, limiter.limit)
+	}
+	return time.Duration((f.total-1)/limiter.limit) * limiter.spread
+}
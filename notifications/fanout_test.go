@@ -0,0 +1,70 @@
+package notifications
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tchap/steemwatch/notifications/events"
+)
+
+func TestFanoutLimiter(t *testing.T) {
+	testCases := []struct {
+		name   string
+		limit  uint
+		users  int
+		delays []time.Duration
+	}{
+		{"disabled", 0, 3, []time.Duration{0, 0, 0}},
+		{"within the limit", 2, 2, []time.Duration{0, 0}},
+		{"over the limit", 2, 5, []time.Duration{0, 0, time.Second, time.Second, 2 * time.Second}},
+	}
+
+	for _, tc := range testCases {
+		limiter := newFanoutLimiter(tc.limit, time.Second)
+		event := &events.AccountUpdated{}
+
+		done := limiter.track(event)
+		for i := 0; i < tc.users; i++ {
+			if delay := limiter.begin(event); delay != tc.delays[i] {
+				t.Errorf("%v: dispatch %v: got delay %v, want %v", tc.name, i, delay, tc.delays[i])
+			}
+		}
+		if f := limiter.events[event]; f == nil || f.total != uint(tc.users) {
+			t.Errorf("%v: fan-out not counted: %+v", tc.name, f)
+		}
+		done()
+		if len(limiter.events) != 0 {
+			t.Errorf("%v: event not forgotten", tc.name)
+		}
+	}
+}
+
+func TestFanoutLimiterCopies(t *testing.T) {
+	limiter := newFanoutLimiter(1, time.Second)
+	event := &events.TransferMade{}
+	annotated := *event
+
+	done := limiter.track(event)
+	// Nested handling of the same event, e.g. a transfer that was not held.
+	nestedDone := limiter.track(event)
+	limiter.copied(event, &annotated)
+
+	if delay := limiter.begin(event); delay != 0 {
+		t.Errorf("first dispatch: got delay %v, want 0", delay)
+	}
+	if delay := limiter.begin(&annotated); delay != time.Second {
+		t.Errorf("annotated dispatch: got delay %v, want %v", delay, time.Second)
+	}
+
+	nestedDone()
+	if _, ok := limiter.events[event]; !ok {
+		t.Error("event forgotten before the outermost handling finished")
+	}
+	done()
+	if len(limiter.events) != 0 {
+		t.Errorf("events not forgotten: %v", limiter.events)
+	}
+	if delay := limiter.begin(event); delay != 0 {
+		t.Errorf("untracked dispatch: got delay %v, want 0", delay)
+	}
+}
@@ -0,0 +1,107 @@
+package faults
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultDuration is how long a fault is injected when no duration is requested.
+	DefaultDuration = 5 * time.Minute
+
+	// MaxDuration limits how long a fault can be injected at once.
+	MaxDuration = time.Hour
+)
+
+// Fault makes the deliveries to the notifier fail until it expires.
+// The fault applies to all the users when UserId is empty.
+type Fault struct {
+	NotifierId string    `json:"notifierId"`
+	UserId     string    `json:"userId,omitempty"`
+	Message    string    `json:"message,omitempty"`
+	Until      time.Time `json:"until"`
+}
+
+// Injector keeps the faults injected using the admin API.
+// It is shared by the block processor and the admin API.
+type Injector struct {
+	faults map[string]*Fault
+	lock   sync.RWMutex
+}
+
+func NewInjector() *Injector {
+	return &Injector{
+		faults: make(map[string]*Fault),
+	}
+}
+
+func faultKey(notifierId, userId string) string {
+	return notifierId + "/" + userId
+}
+
+// Set injects the fault, replacing the fault for the same notifier and user.
+func (injector *Injector) Set(fault *Fault) {
+	injector.lock.Lock()
+	defer injector.lock.Unlock()
+	injector.faults[faultKey(fault.NotifierId, fault.UserId)] = fault
+}
+
+// Clear removes the fault. It returns false when there was no fault to remove.
+func (injector *Injector) Clear(notifierId, userId string) bool {
+	injector.lock.Lock()
+	defer injector.lock.Unlock()
+
+	key := faultKey(notifierId, userId)
+	_, ok := injector.faults[key]
+	delete(injector.faults, key)
+	return ok
+}
+
+// List returns the faults that have not expired yet, ordered by the notifier and the user.
+func (injector *Injector) List() []*Fault {
+	injector.lock.Lock()
+	defer injector.lock.Unlock()
+
+	now := time.Now()
+	list := make([]*Fault, 0, len(injector.faults))
+	for key, fault := range injector.faults {
+		if !now.Before(fault.Until) {
+			delete(injector.faults, key)
+			continue
+		}
+		list = append(list, fault)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].NotifierId != list[j].NotifierId {
+			return list[i].NotifierId < list[j].NotifierId
+		}
+		return list[i].UserId < list[j].UserId
+	})
+	return list
+}
+
+// Check returns the synthetic failure for the delivery to the notifier, if any.
+// It can be called on nil, which is what the processor gets when fault injection is disabled.
+func (injector *Injector) Check(userId, notifierId string) error {
+	if injector == nil {
+		return nil
+	}
+
+	injector.lock.RLock()
+	defer injector.lock.RUnlock()
+
+	now := time.Now()
+	for _, key := range []string{faultKey(notifierId, userId), faultKey(notifierId, "")} {
+		if fault, ok := injector.faults[key]; ok && now.Before(fault.Until) {
+			msg := fault.Message
+			if msg == "" {
+				msg = "simulated outage"
+			}
+			return errors.Errorf("injected fault: %v", msg)
+		}
+	}
+	return nil
+}
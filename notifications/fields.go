@@ -0,0 +1,145 @@
+package notifications
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/tchap/steemwatch/server/routes/api/profile"
+
+	"github.com/pkg/errors"
+)
+
+// filterFields returns a copy of the event with the fields removed according to the filter.
+// The copy is made using a JSON round trip, so the filter works for any event type
+// and the event shared with the other users and notifiers is left untouched.
+//
+// Only the text fields are actually emptied. Numbers, flags and timestamps are kept
+// so that the notifiers can still render the event.
+func filterFields(event interface{}, filter *profile.FieldFilter) (interface{}, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal event")
+	}
+	filtered, err := decodeEvent(eventKind(event), body)
+	if err != nil {
+		return nil, err
+	}
+
+	v := reflect.ValueOf(filtered)
+	if len(filter.Allow) != 0 {
+		allowFields(v, "", lowerPaths(filter.Allow))
+	}
+	for _, path := range lowerPaths(filter.Deny) {
+		denyField(v, strings.Split(path, "."))
+	}
+	return filtered, nil
+}
+
+func lowerPaths(paths []string) []string {
+	lower := make([]string, len(paths))
+	for i, path := range paths {
+		lower[i] = strings.ToLower(path)
+	}
+	return lower
+}
+
+// allowFields empties all the fields of v except for the allowed paths and their subtrees.
+func allowFields(v reflect.Value, prefix string, allowed []string) {
+	jsonFields(v, func(name string, field reflect.Value) {
+		path := prefix + name
+		for _, p := range allowed {
+			if p == path {
+				return
+			}
+		}
+		for _, p := range allowed {
+			if strings.HasPrefix(p, path+".") {
+				allowFields(field, path+".", allowed)
+				return
+			}
+		}
+		emptyField(field)
+	})
+}
+
+// denyField empties the field of v at the given path.
+func denyField(v reflect.Value, path []string) {
+	jsonFields(v, func(name string, field reflect.Value) {
+		if name != path[0] {
+			return
+		}
+		if len(path) == 1 {
+			emptyField(field)
+		} else {
+			denyField(field, path[1:])
+		}
+	})
+}
+
+// emptyField clears the text in the field, recursively for structs and slices of structs.
+func emptyField(field reflect.Value) {
+	switch field.Kind() {
+	case reflect.String:
+		if field.CanSet() {
+			field.SetString("")
+		}
+	case reflect.Slice, reflect.Map:
+		if field.Type().Elem().Kind() == reflect.String {
+			if field.CanSet() {
+				field.Set(reflect.Zero(field.Type()))
+			}
+			return
+		}
+		if field.Kind() == reflect.Slice {
+			for i := 0; i < field.Len(); i++ {
+				emptyField(field.Index(i))
+			}
+		}
+	case reflect.Ptr, reflect.Interface, reflect.Struct:
+		jsonFields(field, func(_ string, f reflect.Value) {
+			emptyField(f)
+		})
+	}
+}
+
+// jsonFields calls fn for the exported fields of the struct v (possibly) points to,
+// passing the lowercased JSON name of the field. Embedded structs are flattened
+// the same way encoding/json does it.
+func jsonFields(v reflect.Value, fn func(name string, field reflect.Value)) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		name := f.Name
+		if tag := f.Tag.Get("json"); tag != "" {
+			if tag == "-" {
+				continue
+			}
+			if n := strings.Split(tag, ",")[0]; n != "" {
+				name = n
+			} else if f.Anonymous {
+				name = ""
+			}
+		} else if f.Anonymous {
+			name = ""
+		}
+
+		switch {
+		case name == "":
+			jsonFields(v.Field(i), fn)
+		case f.PkgPath == "":
+			fn(strings.ToLower(name), v.Field(i))
+		}
+	}
+}
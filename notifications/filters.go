@@ -0,0 +1,157 @@
+package notifications
+
+import (
+	"log"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/tchap/steemwatch/notifications/events"
+	"github.com/tchap/steemwatch/server/routes/api/profile"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// UserDoc is the part of the user document that is consulted when dispatching.
+type UserDoc struct {
+	MutedWords []string         `bson:"mutedWords"`
+	Settings   profile.Settings `bson:"settings"`
+	Firehose   FirehoseGrant    `bson:"firehose"`
+
+	// mutePatterns match the muted words as whole words. They are compiled once
+	// when the document is loaded, so they are cached together with it.
+	mutePatterns []*regexp.Regexp
+	// titleTemplates are the title templates by event kind, parsed once as well, see eventTitle.
+	titleTemplates map[string]*template.Template
+}
+
+func (processor *BlockProcessor) getUser(userId string) (*UserDoc, error) {
+	v, err := processor.configs.get(userId, "user", func() (interface{}, error) {
+		selector := bson.M{
+			"mutedWords": 1,
+			"settings":   1,
+			"firehose":   1,
+		}
+
+		var doc UserDoc
+		err := processor.db.C("users").FindId(bson.ObjectIdHex(userId)).Select(selector).One(&doc)
+		if err != nil && err != mgo.ErrNotFound {
+			return nil, err
+		}
+		doc.compileMutes()
+		doc.compileTitles(userId)
+		return &doc, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*UserDoc), nil
+}
+
+// eventTexts returns the user-written texts carried by the given event.
+func eventTexts(event interface{}) []string {
+	switch event := event.(type) {
+	case *events.TransferMade:
+		return []string{event.Op.Memo}
+	case *events.NewPayerDetected:
+		return []string{event.Op.Memo}
+	case *events.UserMentioned:
+		return []string{event.Content.Title, event.Content.Body}
+	case *events.StoryPublished:
+		return []string{event.Content.Title, event.Content.Body}
+	case *events.CommentPublished:
+		return []string{event.Content.Body}
+	default:
+		return nil
+	}
+}
+
+// wordBoundary matches what may surround a whole word. Unlike \b,
+// it treats the non-ASCII letters and digits as part of the word.
+const wordBoundary = `[^\p{L}\p{N}_]`
+
+// compileMutes compiles the whole-word patterns of the muted words.
+func (user *UserDoc) compileMutes() {
+	user.mutePatterns = user.mutePatterns[:0]
+	for _, word := range user.MutedWords {
+		word = strings.ToLower(word)
+		if word == "" {
+			continue
+		}
+		re, err := regexp.Compile(`(^|` + wordBoundary + `)` + regexp.QuoteMeta(word) + `($|` + wordBoundary + `)`)
+		if err != nil {
+			log.Printf("invalid muted word %q: %v", word, err)
+			continue
+		}
+		user.mutePatterns = append(user.mutePatterns, re)
+	}
+}
+
+// mutes returns true when the event contains any of the user's muted words.
+func (user *UserDoc) mutes(event interface{}) bool {
+	if len(user.MutedWords) == 0 {
+		return false
+	}
+
+	texts := eventTexts(event)
+	if len(texts) == 0 {
+		return false
+	}
+
+	wholeWords := user.Settings.MuteWholeWordsOnly != nil && *user.Settings.MuteWholeWordsOnly
+
+	for _, text := range texts {
+		text = strings.ToLower(text)
+
+		if wholeWords {
+			for _, re := range user.mutePatterns {
+				if re.MatchString(text) {
+					return true
+				}
+			}
+			continue
+		}
+
+		for _, word := range user.MutedWords {
+			word = strings.ToLower(word)
+			if word != "" && strings.Contains(text, word) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// eventActor returns the account that caused the event
+// for the event kinds that are subject to the minimum account age filter.
+func eventActor(event interface{}) (string, bool) {
+	switch event := event.(type) {
+	case *events.UserMentioned:
+		return event.Content.Author, true
+	case *events.CommentPublished:
+		return event.Content.Author, true
+	case *events.StoryVoted:
+		return event.Op.Voter, true
+	case *events.CommentVoted:
+		return event.Op.Voter, true
+	default:
+		return "", false
+	}
+}
+
+// isYoungAccount returns true when the account was created less than minAgeDays ago.
+// The filter is disabled when minAgeDays is not set. Lookup failures let the event through.
+func (processor *BlockProcessor) isYoungAccount(account string, minAgeDays *uint) bool {
+	if minAgeDays == nil || *minAgeDays == 0 {
+		return false
+	}
+
+	age, err := processor.accounts.Age(account)
+	if err != nil {
+		log.Printf("failed to get account age for @%v: %+v", account, err)
+		return false
+	}
+	return age < time.Duration(*minAgeDays)*24*time.Hour
+}
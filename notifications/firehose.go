@@ -0,0 +1,138 @@
+package notifications
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// DefaultFirehoseRateLimit is the number of custom_json firehose events
+// a user receives per minute at most, unless the grant says otherwise.
+const DefaultFirehoseRateLimit = 600
+
+// DefaultActivityRateLimit is the number of account.activity events
+// a user receives per minute at most by default.
+const DefaultActivityRateLimit = 120
+
+// FirehoseGrant is stored in the user document by the admin API.
+// The custom_json firehose is only delivered to the users it was granted to.
+type FirehoseGrant struct {
+	Enabled bool `json:"enabled" bson:"enabled"`
+	// RatePerMinute overrides the default rate limit when set.
+	RatePerMinute uint `json:"ratePerMinute,omitempty" bson:"ratePerMinute,omitempty"`
+}
+
+// customJSONPatterns returns the list entries matching the given custom_json ID,
+// which is the ID itself and the prefixes of the ID followed by *, e.g. sm_*.
+func customJSONPatterns(id string) []string {
+	patterns := make([]string, 0, len(id)+1)
+	patterns = append(patterns, id)
+	for i := 1; i <= len(id); i++ {
+		patterns = append(patterns, id[:i]+"*")
+	}
+	return patterns
+}
+
+// firehoseGrants returns the grants of the given users that have the firehose enabled.
+// The grants are read from the cached user documents, see getUser.
+func (processor *BlockProcessor) firehoseGrants(ownerIds []bson.ObjectId) (map[bson.ObjectId]*FirehoseGrant, error) {
+	grants := make(map[bson.ObjectId]*FirehoseGrant)
+	for _, ownerId := range ownerIds {
+		user, err := processor.getUser(ownerId.Hex())
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get firehose grants")
+		}
+		if user.Firehose.Enabled {
+			grants[ownerId] = &user.Firehose
+		}
+	}
+	return grants, nil
+}
+
+func (processor *BlockProcessor) firehoseRate(grant *FirehoseGrant) uint {
+	if grant.RatePerMinute != 0 {
+		return grant.RatePerMinute
+	}
+	return processor.firehoseRateLimit
+}
+
+// streamEvent sends the event to the additional notifiers only, i.e. the event stream.
+// The event is not recorded in the history and none of the user's filters apply.
+func (processor *BlockProcessor) streamEvent(userId string, event interface{}) {
+	targets := make([]*deliveryTarget, 0, len(processor.additionalNotifiers))
+	for id, dispatcher := range processor.additionalNotifiers {
+		targets = append(targets, &deliveryTarget{
+			notifierId: id,
+			dispatcher: dispatcher,
+		})
+	}
+	if len(targets) == 0 {
+		return
+	}
+
+	processor.goDispatch(event, func() error {
+		match := processor.matchedBy(userId, event)
+		processor.deliver(userId, event, targets, uint(len(targets)),
+			func(target *deliveryTarget) error {
+				return notify(matchedNotifier(target.dispatcher, match), userId, target.settings, event)
+			}, nil)
+		return nil
+	})
+}
+
+// firehoseLimiter is a token bucket per user, refilled continuously.
+type firehoseLimiter struct {
+	buckets map[string]*firehoseBucket
+	lock    sync.Mutex
+}
+
+type firehoseBucket struct {
+	tokens   float64
+	filledAt time.Time
+	dropped  uint
+}
+
+func newFirehoseLimiter() *firehoseLimiter {
+	return &firehoseLimiter{
+		buckets: make(map[string]*firehoseBucket),
+	}
+}
+
+// allow takes a token from the user's bucket holding up to ratePerMinute tokens.
+func (limiter *firehoseLimiter) allow(userId string, ratePerMinute uint) bool {
+	if ratePerMinute == 0 {
+		return true
+	}
+
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+
+	now := time.Now()
+	capacity := float64(ratePerMinute)
+
+	bucket, ok := limiter.buckets[userId]
+	if !ok {
+		bucket = &firehoseBucket{tokens: capacity, filledAt: now}
+		limiter.buckets[userId] = bucket
+	}
+
+	bucket.tokens += now.Sub(bucket.filledAt).Minutes() * capacity
+	if bucket.tokens > capacity {
+		bucket.tokens = capacity
+	}
+	bucket.filledAt = now
+
+	if bucket.tokens < 1 {
+		// Log once per 100 dropped events not to make things worse.
+		if bucket.dropped%100 == 0 {
+			log.Printf("firehose: rate limit of %v/min reached for user %v", ratePerMinute, userId)
+		}
+		bucket.dropped++
+		return false
+	}
+	bucket.tokens--
+	return true
+}
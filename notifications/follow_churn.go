@@ -0,0 +1,150 @@
+package notifications
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tchap/steemwatch/notifications/events"
+)
+
+// followChurn holds the follow status changes for a (watched, follower) pair for the window
+// and only passes on the last one, so that the follow bots quickly following and unfollowing
+// the watched accounts don't end up in the notifications.
+//
+// A change reversed within the window, e.g. a follow followed by an unfollow, is dropped.
+// Every change is expected to flip the status, so a change is considered reversed
+// when exactly one of the first and the last change in the window is a reset.
+//
+// The changes are passed on by run once the window is over, run also passes on
+// all the changes still held when it is stopped, the same way as roundTrips.
+type followChurn struct {
+	window  time.Duration
+	pending map[string]*pendingFollow
+	next    uint64
+	stopped bool
+	lock    *sync.Mutex
+
+	dueCh     chan *pendingFollow
+	stoppedCh chan struct{}
+}
+
+type pendingFollow struct {
+	// seq orders the pending changes the way they were made.
+	seq     uint64
+	key     string
+	first   *events.UserFollowStatusChanged
+	last    *events.UserFollowStatusChanged
+	changes int
+	timer   *time.Timer
+	// done is called once the last change is passed on or dropped.
+	done func()
+}
+
+func newFollowChurn(window time.Duration) *followChurn {
+	return &followChurn{
+		window:    window,
+		pending:   make(map[string]*pendingFollow),
+		lock:      &sync.Mutex{},
+		dueCh:     make(chan *pendingFollow),
+		stoppedCh: make(chan struct{}),
+	}
+}
+
+// hold returns false when coalescing is disabled, i.e. the window is 0, or run is stopped already,
+// and the event is to be handled right away. Otherwise the event is taken over and passed on
+// by run once the window is over, unless it was reversed. done is called once the event
+// is passed on or dropped, i.e. right away unless the event is held, so that the caller
+// can keep the block of the event from being released.
+func (churn *followChurn) hold(event *events.UserFollowStatusChanged, done func()) bool {
+	if churn.window == 0 {
+		done()
+		return false
+	}
+
+	key := event.Op.Following + ":" + event.Op.Follower
+
+	churn.lock.Lock()
+	defer churn.lock.Unlock()
+
+	if churn.stopped {
+		done()
+		return false
+	}
+
+	// Only the last change is passed on, so only its block is kept from being released.
+	if p, ok := churn.pending[key]; ok {
+		p.done()
+		p.last = event
+		p.done = done
+		p.changes++
+		return true
+	}
+
+	churn.next++
+	p := &pendingFollow{
+		seq:     churn.next,
+		key:     key,
+		first:   event,
+		last:    event,
+		changes: 1,
+		done:    done,
+	}
+	p.timer = time.AfterFunc(churn.window, func() {
+		select {
+		case churn.dueCh <- p:
+		case <-churn.stoppedCh:
+		}
+	})
+	churn.pending[key] = p
+	return true
+}
+
+// run passes the pending changes on to flush once their window is over until dying is closed.
+// The changes still pending then are passed on right away, hold does not hold any more.
+func (churn *followChurn) run(dying <-chan struct{}, flush func(*events.UserFollowStatusChanged)) {
+	for {
+		select {
+		case p := <-churn.dueCh:
+			churn.lock.Lock()
+			delete(churn.pending, p.key)
+			churn.lock.Unlock()
+
+			churn.pass(p, flush)
+
+		case <-dying:
+			churn.lock.Lock()
+			pending := make([]*pendingFollow, 0, len(churn.pending))
+			for _, p := range churn.pending {
+				p.timer.Stop()
+				pending = append(pending, p)
+			}
+			churn.pending = make(map[string]*pendingFollow)
+			churn.stopped = true
+			close(churn.stoppedCh)
+			churn.lock.Unlock()
+
+			// Keep the order the changes were made in.
+			sort.Slice(pending, func(i, j int) bool {
+				return pending[i].seq < pending[j].seq
+			})
+			for _, p := range pending {
+				churn.pass(p, flush)
+			}
+			return
+		}
+	}
+}
+
+// pass passes the last change on unless it was reversed within the window.
+func (churn *followChurn) pass(p *pendingFollow, flush func(*events.UserFollowStatusChanged)) {
+	defer p.done()
+
+	if p.changes > 1 && p.first.Reset() != p.last.Reset() {
+		log.Printf("follow churn: %v changes of @%v following @%v suppressed",
+			p.changes, p.first.Op.Follower, p.first.Op.Following)
+		return
+	}
+	flush(p.last)
+}
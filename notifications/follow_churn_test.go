@@ -0,0 +1,68 @@
+package notifications
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tchap/steemwatch/notifications/events"
+
+	"github.com/go-steem/rpc/types"
+)
+
+func followEvent(follower, following string, what ...string) *events.UserFollowStatusChanged {
+	return &events.UserFollowStatusChanged{
+		Op: &types.FollowOperation{Follower: follower, Following: following, What: what},
+	}
+}
+
+func TestFollowChurnRun(t *testing.T) {
+	churn := newFollowChurn(time.Hour)
+	var (
+		flushed []*events.UserFollowStatusChanged
+		done    int
+		dying   = make(chan struct{})
+		stopped = make(chan struct{})
+	)
+	go func() {
+		churn.run(dying, func(event *events.UserFollowStatusChanged) { flushed = append(flushed, event) })
+		close(stopped)
+	}()
+
+	// Followed and unfollowed, dropped.
+	churn.hold(followEvent("bot", "alice", "blog"), func() { done++ })
+	churn.hold(followEvent("bot", "alice"), func() { done++ })
+
+	// Muted, then followed, only the last change is passed on.
+	churn.hold(followEvent("carol", "alice", "ignore"), func() { done++ })
+	last := followEvent("carol", "alice", "blog")
+	churn.hold(last, func() { done++ })
+
+	// Followed.
+	single := followEvent("dave", "alice", "blog")
+	churn.hold(single, func() { done++ })
+
+	// Stopping passes on the changes still held in the order they were made.
+	close(dying)
+	<-stopped
+
+	want := []*events.UserFollowStatusChanged{last, single}
+	if len(flushed) != len(want) {
+		t.Fatalf("got %v changes passed on, want %v", len(flushed), len(want))
+	}
+	for i := range want {
+		if flushed[i] != want[i] {
+			t.Errorf("change %v: got %v, want %v", i, flushed[i].Op, want[i].Op)
+		}
+	}
+	if done != 5 {
+		t.Errorf("got %v changes done, want 5", done)
+	}
+
+	// Once stopped, nothing is held.
+	if churn.hold(followEvent("bot", "alice", "blog"), func() { done++ }) {
+		t.Error("change held after stopped")
+	}
+	if done != 6 {
+		t.Errorf("got %v changes done, want 6", done)
+	}
+}
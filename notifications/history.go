@@ -0,0 +1,159 @@
+package notifications
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	// DefaultHistoryRetention is how long the history entries are kept
+	// for the users that have not chosen otherwise.
+	DefaultHistoryRetention = 30 * 24 * time.Hour
+
+	// DefaultHistoryMaxRetention caps the retention chosen by the users.
+	DefaultHistoryMaxRetention = 90 * 24 * time.Hour
+
+	// HistorySweepInterval is how often the entries without expiration are removed.
+	HistorySweepInterval = time.Hour
+)
+
+// HistoryEntry is stored for every event dispatched to a user.
+type HistoryEntry struct {
+	Id        bson.ObjectId `json:"id"        bson:"_id,omitempty"`
+	OwnerId   bson.ObjectId `json:"-"         bson:"ownerId"`
+	EventKind string        `json:"eventKind" bson:"eventKind"`
+	EventId   string        `json:"eventId"   bson:"eventId"`
+	Event     string        `json:"event"     bson:"event"`
+	CreatedAt time.Time     `json:"createdAt" bson:"createdAt"`
+	ExpiresAt time.Time     `json:"expiresAt" bson:"expiresAt"`
+
+	// Seq numbers the entries of the user in the dispatch order, see historyWriter.
+	// The history is to be read sorted by it.
+	Seq uint64 `json:"seq,omitempty" bson:"seq,omitempty"`
+
+	// DeliveredVia is the notifier that delivered the event in the fallback delivery mode.
+	DeliveredVia string `json:"deliveredVia,omitempty" bson:"deliveredVia,omitempty"`
+
+	// Labels are the labels of the subscription that caused the event.
+	Labels []string `json:"labels,omitempty" bson:"labels,omitempty"`
+}
+
+// recordHistory stores the event in the history and returns the ID of the entry.
+// An empty ID is returned when the entry could not be stored.
+func (processor *BlockProcessor) recordHistory(
+	userId string,
+	user *UserDoc,
+	event interface{},
+	labels []string,
+) bson.ObjectId {
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("failed to marshal history entry for user %v: %v", userId, err)
+		return ""
+	}
+
+	now := time.Now()
+	entry := &HistoryEntry{
+		Id:        bson.NewObjectId(),
+		OwnerId:   bson.ObjectIdHex(userId),
+		EventKind: eventKind(event),
+		EventId:   eventId(event),
+		Event:     string(body),
+		Labels:    labels,
+		CreatedAt: now,
+		ExpiresAt: now.Add(processor.historyRetention(user)),
+	}
+	if err := processor.writeHistory(entry); err != nil {
+		log.Printf("failed to store history entry for user %v: %v", userId, err)
+		return ""
+	}
+	return entry.Id
+}
+
+// historyRetention returns for how long the user's history entries are kept.
+func (processor *BlockProcessor) historyRetention(user *UserDoc) time.Duration {
+	retention := processor.defaultHistoryRetention
+	if days := user.Settings.HistoryRetentionDays; days != nil && *days != 0 {
+		retention = time.Duration(*days) * 24 * time.Hour
+	}
+	if max := processor.maxHistoryRetention; max != 0 && retention > max {
+		retention = max
+	}
+	return retention
+}
+
+// historySweeper removes the entries stored before the expiration was recorded,
+// which the TTL index does not cover.
+func (processor *BlockProcessor) historySweeper() error {
+	ticker := time.NewTicker(HistorySweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := processor.sweepHistory(); err != nil {
+				log.Printf("failed to sweep history: %+v", err)
+			}
+
+		case <-processor.t.Dying():
+			return nil
+		}
+	}
+}
+
+func (processor *BlockProcessor) sweepHistory() error {
+	selector := bson.M{
+		"expiresAt": bson.M{"$exists": false},
+		"createdAt": bson.M{"$lt": time.Now().Add(-processor.defaultHistoryRetention)},
+	}
+	_, err := processor.db.C("history").RemoveAll(selector)
+	return errors.Wrap(err, "failed to remove history entries without expiration")
+}
+
+// Decode returns the event stored in the entry.
+func (entry *HistoryEntry) Decode() (interface{}, error) {
+	return decodeEvent(entry.EventKind, []byte(entry.Event))
+}
+
+func (processor *BlockProcessor) recordDeliveredVia(historyId bson.ObjectId, notifierId string) {
+	if historyId == "" {
+		return
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"deliveredVia": notifierId,
+		},
+	}
+	err := processor.persist("history entry update", func() error {
+		return processor.db.C("history").UpdateId(historyId, update)
+	})
+	if err != nil {
+		log.Printf("failed to update history entry %v: %v", historyId.Hex(), err)
+	}
+}
+
+// isIndexNotFound returns true when the index to be dropped does not exist.
+// mgo only passes on the server error message for dropIndexes.
+func isIndexNotFound(err error) bool {
+	return strings.Contains(err.Error(), "index not found")
+}
+
+func (processor *BlockProcessor) getHistoryEntry(userId string, id bson.ObjectId) (*HistoryEntry, error) {
+	query := bson.M{
+		"_id":     id,
+		"ownerId": bson.ObjectIdHex(userId),
+	}
+
+	var entry HistoryEntry
+	if err := processor.db.C("history").Find(query).One(&entry); err != nil {
+		return nil, errors.Wrapf(err, "failed to get history entry %v", id.Hex())
+	}
+	return &entry, nil
+}
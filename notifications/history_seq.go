@@ -0,0 +1,389 @@
+package notifications
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/tchap/steemwatch/notifications/dbhealth"
+
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// HistoryGapKind is the event kind of the placeholder entries filling the gaps
+// left in the history sequence by the entries that could not be stored.
+const HistoryGapKind = "history.gap"
+
+// HistoryGapCheckInterval is how often the history of the users with failed writes
+// is checked for gaps.
+const HistoryGapCheckInterval = time.Minute
+
+// historyWriter numbers the history entries of every user in the order they are recorded.
+// The entries of a user are numbered and written one at a time, so that the numbers
+// follow the dispatch order no matter how many dispatches run concurrently, and the
+// history read sorted by the number is exactly the dispatch order.
+//
+// The last number of a user is kept in the user document and incremented for every entry,
+// so that the numbers are never reused, not even once all the entries of the user expired,
+// and the processes sharing the database do not hand out the same number.
+// The entries of a user are queued and stored in order. When the database is unavailable,
+// the queue is kept to be flushed once it recovers, see flushHistory, the entries recorded
+// meanwhile wait behind. The users with an entry that could not be stored or that was kept
+// for retrying are checked for gaps later on, see repairHistoryGaps.
+type historyWriter struct {
+	store   historyStore
+	users   map[string]*historyUser
+	suspect map[string]bool
+	lock    sync.Mutex
+}
+
+type historyUser struct {
+	// seq is the last number assigned by this process.
+	seq uint64
+	// seeded is set once the counter is known to start after the entries numbered
+	// before the counter was introduced.
+	seeded bool
+	// queue are the entries to be stored, in order.
+	queue []*HistoryEntry
+	// retrying is set while the queue is kept for retrying, see dbhealth.Monitor.
+	retrying bool
+	lock     sync.Mutex
+}
+
+func newHistoryWriter(store historyStore) *historyWriter {
+	return &historyWriter{
+		store:   store,
+		users:   make(map[string]*historyUser),
+		suspect: make(map[string]bool),
+	}
+}
+
+func (writer *historyWriter) user(userId string) *historyUser {
+	writer.lock.Lock()
+	defer writer.lock.Unlock()
+
+	user, ok := writer.users[userId]
+	if !ok {
+		user = &historyUser{}
+		writer.users[userId] = user
+	}
+	return user
+}
+
+func (writer *historyWriter) markSuspect(userId string) {
+	writer.lock.Lock()
+	writer.suspect[userId] = true
+	writer.lock.Unlock()
+}
+
+func (writer *historyWriter) takeSuspects() []string {
+	writer.lock.Lock()
+	defer writer.lock.Unlock()
+
+	userIds := make([]string, 0, len(writer.suspect))
+	for userId := range writer.suspect {
+		userIds = append(userIds, userId)
+	}
+	writer.suspect = make(map[string]bool)
+	return userIds
+}
+
+// writeHistory queues the entry behind the entries of the user not stored yet and stores them.
+// The entry is never stored without a number. While the database is unavailable, the entry
+// is kept for retrying and nil is returned.
+func (processor *BlockProcessor) writeHistory(entry *HistoryEntry) error {
+	userId := entry.OwnerId.Hex()
+	user := processor.history.user(userId)
+	user.lock.Lock()
+	defer user.lock.Unlock()
+
+	// The oldest entries are dropped first, as with the other writes kept for retrying.
+	if len(user.queue) == dbhealth.MaxPendingWrites {
+		user.queue = user.queue[1:]
+		processor.history.markSuspect(userId)
+	}
+	user.queue = append(user.queue, entry)
+
+	// The queued entries are flushed once the database recovers, nothing to try meanwhile.
+	if len(user.queue) > 1 && processor.dbHealth.Degraded() {
+		return nil
+	}
+
+	unavailable, err := processor.flushHistory(userId, user, entry)
+	if unavailable != nil {
+		log.Printf("database unavailable, %v history entries of user %v kept for retrying", len(user.queue), userId)
+		processor.history.markSuspect(userId)
+		if !user.retrying {
+			user.retrying = true
+			processor.dbHealth.Retry(func() error {
+				return processor.retryHistory(userId)
+			})
+		}
+	}
+	return err
+}
+
+// retryHistory flushes the entries of the user kept while the database was unavailable.
+func (processor *BlockProcessor) retryHistory(userId string) error {
+	user := processor.history.user(userId)
+	user.lock.Lock()
+	defer user.lock.Unlock()
+
+	unavailable, _ := processor.flushHistory(userId, user, nil)
+	if unavailable != nil {
+		// Kept for the next recovery.
+		return unavailable
+	}
+	user.retrying = false
+	return nil
+}
+
+// flushHistory numbers and stores the queued entries of the user in order, user.lock must be held.
+//
+// It stops at the first entry that cannot be stored since the database is unavailable
+// and returns the error as unavailable, the entry and the ones behind it stay queued.
+// The entries failing otherwise are dropped and the user is checked for gaps later on.
+// The error is returned as err when it is the given entry that failed, it is logged otherwise.
+func (processor *BlockProcessor) flushHistory(
+	userId string,
+	user *historyUser,
+	entry *HistoryEntry,
+) (unavailable, err error) {
+
+	for len(user.queue) != 0 {
+		next := user.queue[0]
+		writeErr := processor.insertHistory(user, next)
+		if writeErr != nil && processor.dbHealth.Check(writeErr) {
+			return writeErr, nil
+		}
+		user.queue = user.queue[1:]
+		if writeErr == nil {
+			continue
+		}
+
+		processor.history.markSuspect(userId)
+		if next == entry {
+			err = writeErr
+		} else {
+			log.Printf("failed to store history entry for user %v: %v", userId, writeErr)
+		}
+	}
+	user.queue = nil
+	return nil, err
+}
+
+// insertHistory numbers the entry unless numbered already, i.e. when retried, and inserts it.
+func (processor *BlockProcessor) insertHistory(user *historyUser, entry *HistoryEntry) error {
+	store := processor.history.store
+
+	if entry.Seq == 0 {
+		// The numbers used to be derived from the history, the counter starts after them.
+		if !user.seeded {
+			last, err := store.lastSeq(entry.OwnerId)
+			if err != nil {
+				return err
+			}
+			if err := store.seed(entry.OwnerId, last); err != nil {
+				return err
+			}
+			user.seeded = true
+		}
+
+		seq, err := store.nextSeq(entry.OwnerId)
+		if err != nil {
+			return err
+		}
+		entry.Seq = seq
+		if seq > user.seq {
+			user.seq = seq
+		}
+	}
+
+	return store.insert(entry)
+}
+
+// historyGapRepairer checks the history of the users with failed writes for gaps.
+func (processor *BlockProcessor) historyGapRepairer() error {
+	ticker := time.NewTicker(HistoryGapCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// The pending writes would only be reported as gaps.
+			if status := processor.dbHealth.Status(); status.Degraded || status.PendingWrites != 0 {
+				continue
+			}
+			for _, userId := range processor.history.takeSuspects() {
+				if err := processor.repairHistoryGaps(userId); err != nil {
+					log.Printf("%+v", err)
+					processor.history.markSuspect(userId)
+				}
+			}
+
+		case <-processor.t.Dying():
+			return nil
+		}
+	}
+}
+
+// repairHistoryGaps fills the gaps in the numbering of the history of the user with placeholders,
+// so that the readers can tell the entries were lost rather than not yet written.
+//
+// The entries may as well be missing since they expired, not necessarily the oldest ones,
+// e.g. when the user shortened the retention. A lost entry was created no later than the entry
+// following it, so the numbers are skipped when the entry would have expired by now even then.
+// The placeholders expire when the lost entries would have at the latest.
+func (processor *BlockProcessor) repairHistoryGaps(userId string) error {
+	user := processor.history.user(userId)
+	user.lock.Lock()
+	defer user.lock.Unlock()
+
+	// The queued entries would only be reported as gaps.
+	if len(user.queue) != 0 {
+		return nil
+	}
+
+	doc, err := processor.getUser(userId)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get user %v", userId)
+	}
+	retention := processor.historyRetention(doc)
+
+	ownerId := bson.ObjectIdHex(userId)
+	entries, err := processor.history.store.numbered(ownerId)
+	if err != nil {
+		return err
+	}
+
+	var (
+		now      = time.Now()
+		expected uint64
+		missing  []*HistoryEntry
+		expired  int
+	)
+	addGaps := func(from, to uint64, createdAt time.Time) {
+		if !createdAt.Add(retention).After(now) {
+			expired += int(to - from)
+			return
+		}
+		for seq := from; seq < to; seq++ {
+			missing = append(missing, &HistoryEntry{
+				Id:        bson.NewObjectId(),
+				OwnerId:   ownerId,
+				Seq:       seq,
+				EventKind: HistoryGapKind,
+				Event:     "{}",
+				CreatedAt: createdAt,
+				ExpiresAt: createdAt.Add(retention),
+			})
+		}
+	}
+	for _, entry := range entries {
+		if expected != 0 && expected < entry.Seq {
+			addGaps(expected, entry.Seq, entry.CreatedAt)
+		}
+		expected = entry.Seq + 1
+	}
+	// The newest entries are lost as well when the numbers were assigned beyond the last one stored.
+	if expected != 0 && expected <= user.seq {
+		addGaps(expected, user.seq+1, now)
+	}
+	if expired != 0 {
+		log.Printf("skipping %v expired gaps in the history of user %v", expired, userId)
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	log.Printf("filling %v gaps in the history of user %v", len(missing), userId)
+	for _, gap := range missing {
+		if err := processor.history.store.insert(gap); err != nil {
+			return errors.Wrapf(err, "failed to fill the history gap %v of user %v", gap.Seq, userId)
+		}
+	}
+	return nil
+}
+
+// historyStore is where the history entries are kept, see mgoHistoryStore.
+type historyStore interface {
+	// lastSeq returns the highest number of the user's entries, 0 when there is none.
+	lastSeq(ownerId bson.ObjectId) (uint64, error)
+	// seed makes the counter of the user start after seq unless it is past it already.
+	seed(ownerId bson.ObjectId, seq uint64) error
+	// nextSeq increments and returns the counter of the user.
+	nextSeq(ownerId bson.ObjectId) (uint64, error)
+	insert(entry *HistoryEntry) error
+	// numbered returns the numbered entries of the user in the ascending order,
+	// only Seq and CreatedAt are set.
+	numbered(ownerId bson.ObjectId) ([]*HistoryEntry, error)
+}
+
+// mgoHistoryStore keeps the history entries in the history collection
+// and the counters in the user documents.
+type mgoHistoryStore struct {
+	db *mgo.Database
+}
+
+func (store *mgoHistoryStore) lastSeq(ownerId bson.ObjectId) (uint64, error) {
+	var last HistoryEntry
+	err := store.db.C("history").Find(bson.M{"ownerId": ownerId}).Sort("-seq").One(&last)
+	if err != nil && err != mgo.ErrNotFound {
+		return 0, errors.Wrapf(err, "failed to get the last history entry of user %v", ownerId.Hex())
+	}
+	return last.Seq, nil
+}
+
+func (store *mgoHistoryStore) seed(ownerId bson.ObjectId, seq uint64) error {
+	update := bson.M{
+		"$max": bson.M{
+			"historySeq": int64(seq),
+		},
+	}
+
+	err := store.db.C("users").UpdateId(ownerId, update)
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return errors.Wrapf(err, "failed to seed the history counter of user %v", ownerId.Hex())
+}
+
+func (store *mgoHistoryStore) nextSeq(ownerId bson.ObjectId) (uint64, error) {
+	change := mgo.Change{
+		Update: bson.M{
+			"$inc": bson.M{
+				"historySeq": 1,
+			},
+		},
+		ReturnNew: true,
+	}
+
+	var doc struct {
+		HistorySeq int64 `bson:"historySeq"`
+	}
+	if _, err := store.db.C("users").FindId(ownerId).Apply(change, &doc); err != nil {
+		return 0, errors.Wrapf(err, "failed to increment the history counter of user %v", ownerId.Hex())
+	}
+	return uint64(doc.HistorySeq), nil
+}
+
+func (store *mgoHistoryStore) insert(entry *HistoryEntry) error {
+	return store.db.C("history").Insert(entry)
+}
+
+func (store *mgoHistoryStore) numbered(ownerId bson.ObjectId) ([]*HistoryEntry, error) {
+	query := bson.M{
+		"ownerId": ownerId,
+		"seq":     bson.M{"$gt": 0},
+	}
+	selector := bson.M{
+		"seq":       1,
+		"createdAt": 1,
+	}
+
+	var entries []*HistoryEntry
+	err := store.db.C("history").Find(query).Select(selector).Sort("seq").All(&entries)
+	return entries, errors.Wrapf(err, "failed to check the history of user %v for gaps", ownerId.Hex())
+}
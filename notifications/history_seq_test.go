@@ -0,0 +1,285 @@
+package notifications
+
+import (
+	"io"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tchap/steemwatch/notifications/dbhealth"
+	"github.com/tchap/steemwatch/server/routes/api/profile"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// memHistoryStore keeps the entries in memory. The writes fail while down
+// and according to fail, called with the number of the write, unless it is nil.
+type memHistoryStore struct {
+	entries  []*HistoryEntry
+	counters map[bson.ObjectId]uint64
+	writes   int
+	down     bool
+	fail     func(write int) error
+	lock     sync.Mutex
+}
+
+func (store *memHistoryStore) lastSeq(ownerId bson.ObjectId) (uint64, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if store.down {
+		return 0, io.EOF
+	}
+	var last uint64
+	for _, entry := range store.entries {
+		if entry.OwnerId == ownerId && entry.Seq > last {
+			last = entry.Seq
+		}
+	}
+	return last, nil
+}
+
+func (store *memHistoryStore) seed(ownerId bson.ObjectId, seq uint64) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if store.down {
+		return io.EOF
+	}
+	if store.counters == nil {
+		store.counters = make(map[bson.ObjectId]uint64)
+	}
+	if seq > store.counters[ownerId] {
+		store.counters[ownerId] = seq
+	}
+	return nil
+}
+
+func (store *memHistoryStore) nextSeq(ownerId bson.ObjectId) (uint64, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if store.down {
+		return 0, io.EOF
+	}
+	if store.counters == nil {
+		store.counters = make(map[bson.ObjectId]uint64)
+	}
+	store.counters[ownerId]++
+	return store.counters[ownerId], nil
+}
+
+func (store *memHistoryStore) insert(entry *HistoryEntry) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	store.writes++
+	if store.down {
+		return io.EOF
+	}
+	if store.fail != nil {
+		if err := store.fail(store.writes); err != nil {
+			return err
+		}
+	}
+	store.entries = append(store.entries, entry)
+	return nil
+}
+
+func (store *memHistoryStore) numbered(ownerId bson.ObjectId) ([]*HistoryEntry, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	var entries []*HistoryEntry
+	for _, entry := range store.entries {
+		if entry.OwnerId == ownerId && entry.Seq != 0 {
+			entries = append(entries, &HistoryEntry{Seq: entry.Seq, CreatedAt: entry.CreatedAt})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Seq < entries[j].Seq })
+	return entries, nil
+}
+
+// withUser makes the processor find the user document in the config cache.
+func withUser(processor *BlockProcessor, ownerId bson.ObjectId, user *UserDoc) *BlockProcessor {
+	processor.configs = newConfigCache(time.Minute)
+	processor.configs.get(ownerId.Hex(), "user", func() (interface{}, error) { return user, nil })
+	return processor
+}
+
+func TestHistoryGapless(t *testing.T) {
+	const numEntries = 100
+
+	testCases := []struct {
+		name string
+		// down makes the database unavailable from the start, including the first numbering.
+		down bool
+		fail func(write int) error
+	}{
+		{
+			name: "all stored",
+		},
+		{
+			name: "some lost",
+			fail: func(write int) error {
+				if write%10 == 5 {
+					return &mgo.LastError{Err: "write failed"}
+				}
+				return nil
+			},
+		},
+		{
+			name: "some retried",
+			fail: func(write int) error {
+				if write%10 == 5 {
+					return io.EOF
+				}
+				return nil
+			},
+		},
+		{
+			name: "unavailable at first",
+			down: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		store := &memHistoryStore{down: tc.down, fail: tc.fail}
+		ownerId := bson.NewObjectId()
+		processor := withUser(&BlockProcessor{
+			history:                 newHistoryWriter(store),
+			dbHealth:                dbhealth.NewMonitor(),
+			defaultHistoryRetention: DefaultHistoryRetention,
+		}, ownerId, &UserDoc{})
+
+		var wg sync.WaitGroup
+		for i := 0; i < numEntries; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				processor.writeHistory(&HistoryEntry{Id: bson.NewObjectId(), OwnerId: ownerId, CreatedAt: time.Now()})
+			}()
+		}
+		wg.Wait()
+
+		store.lock.Lock()
+		store.down, store.fail = false, nil
+		store.lock.Unlock()
+		processor.dbHealth.Recovered()
+
+		if err := processor.repairHistoryGaps(ownerId.Hex()); err != nil {
+			t.Fatalf("%v: unexpected error: %+v", tc.name, err)
+		}
+
+		entries, _ := store.numbered(ownerId)
+		if len(entries) != numEntries {
+			t.Errorf("%v: got %v entries, want %v", tc.name, len(entries), numEntries)
+		}
+		for i, entry := range entries {
+			if entry.Seq != uint64(i+1) {
+				t.Errorf("%v: got seq %v at %v, want %v", tc.name, entry.Seq, i, i+1)
+				break
+			}
+		}
+		for _, entry := range store.entries {
+			if entry.Seq == 0 {
+				t.Errorf("%v: entry %v stored without a number", tc.name, entry.Id.Hex())
+			}
+		}
+	}
+}
+
+func TestHistoryGapsExpired(t *testing.T) {
+	var (
+		store   = &memHistoryStore{}
+		ownerId = bson.NewObjectId()
+		now     = time.Now()
+		day     = uint(1)
+	)
+	processor := withUser(&BlockProcessor{
+		history:                 newHistoryWriter(store),
+		dbHealth:                dbhealth.NewMonitor(),
+		defaultHistoryRetention: DefaultHistoryRetention,
+	}, ownerId, &UserDoc{Settings: profile.Settings{HistoryRetentionDays: &day}})
+
+	// The retention was shortened, 1 and 3 were kept longer than 2.
+	// 4 and 6 were lost, 6 after the last entry stored.
+	for _, entry := range []*HistoryEntry{
+		{Seq: 1, CreatedAt: now.Add(-72 * time.Hour)},
+		{Seq: 3, CreatedAt: now.Add(-48 * time.Hour)},
+		{Seq: 5, CreatedAt: now.Add(-time.Hour)},
+	} {
+		entry.Id, entry.OwnerId = bson.NewObjectId(), ownerId
+		store.entries = append(store.entries, entry)
+	}
+	processor.history.user(ownerId.Hex()).seq = 6
+
+	if err := processor.repairHistoryGaps(ownerId.Hex()); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	gaps := make(map[uint64]*HistoryEntry)
+	for _, entry := range store.entries {
+		if entry.EventKind == HistoryGapKind {
+			gaps[entry.Seq] = entry
+		}
+	}
+	if len(gaps) != 2 || gaps[4] == nil || gaps[6] == nil {
+		t.Fatalf("got gaps %v, want 4 and 6", gaps)
+	}
+	// The placeholders expire according to the retention of the user.
+	if want := now.Add(23 * time.Hour); !gaps[4].ExpiresAt.Equal(want) {
+		t.Errorf("gap 4 expires at %v, want %v", gaps[4].ExpiresAt, want)
+	}
+	if expiresAt := gaps[6].ExpiresAt; expiresAt.Before(now.Add(24*time.Hour)) || expiresAt.After(now.Add(25*time.Hour)) {
+		t.Errorf("gap 6 expires at %v, want in a day", expiresAt)
+	}
+}
+
+func TestHistoryNumbersNotReused(t *testing.T) {
+	var (
+		store   = &memHistoryStore{}
+		ownerId = bson.NewObjectId()
+	)
+	write := func(writer *historyWriter) uint64 {
+		processor := &BlockProcessor{
+			history:  writer,
+			dbHealth: dbhealth.NewMonitor(),
+		}
+		entry := &HistoryEntry{Id: bson.NewObjectId(), OwnerId: ownerId}
+		if err := processor.writeHistory(entry); err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+		return entry.Seq
+	}
+
+	// The entries numbered before the counter was introduced are taken into account.
+	store.entries = append(store.entries, &HistoryEntry{Id: bson.NewObjectId(), OwnerId: ownerId, Seq: 7})
+	if seq := write(newHistoryWriter(store)); seq != 8 {
+		t.Errorf("got seq %v after the numbered entries, want 8", seq)
+	}
+
+	// All the entries expired, then the process restarted.
+	store.entries = nil
+	if seq := write(newHistoryWriter(store)); seq != 9 {
+		t.Errorf("got seq %v after the entries expired, want 9", seq)
+	}
+
+	// Two processes sharing the database.
+	var (
+		first  = newHistoryWriter(store)
+		second = newHistoryWriter(store)
+		seqs   = make(map[uint64]bool)
+	)
+	for i := 0; i < 10; i++ {
+		for _, writer := range []*historyWriter{first, second} {
+			seq := write(writer)
+			if seqs[seq] {
+				t.Fatalf("seq %v handed out twice", seq)
+			}
+			seqs[seq] = true
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package notifications
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+
+	"github.com/tchap/steemwatch/notifications/events"
+
+	"github.com/pkg/errors"
+)
+
+var eventKinds = func() map[reflect.Type]string {
+	kinds := make(map[reflect.Type]string, len(events.Types))
+	for kind, newEvent := range events.Types {
+		kinds[reflect.TypeOf(newEvent())] = kind
+	}
+	return kinds
+}()
+
+// eventKind returns the kind the event is registered under in the events collection.
+func eventKind(event interface{}) string {
+	return eventKinds[reflect.TypeOf(event)]
+}
+
+// eventId returns an identifier that is the same for equal events.
+func eventId(event interface{}) string {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return ""
+	}
+	sum := sha1.Sum(append([]byte(eventKind(event)+":"), body...))
+	return hex.EncodeToString(sum[:])
+}
+
+// decodeEvent turns an event stored as JSON back into the event object.
+func decodeEvent(kind string, data []byte) (interface{}, error) {
+	newEvent, ok := events.Types[kind]
+	if !ok {
+		return nil, errors.Errorf("unknown event kind: %v", kind)
+	}
+
+	event := newEvent()
+	if err := json.Unmarshal(data, event); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode %v event", kind)
+	}
+	return event, nil
+}
@@ -0,0 +1,56 @@
+package notifications
+
+import (
+	"github.com/tchap/steemwatch/notifications/events"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// IngestSource passes on the events forwarded by other steemwatch instances.
+// The event is the JSON of the mined event of the given kind, as stored in the history.
+type IngestSource interface {
+	OnIngest(listener func(userId, kind string, event []byte) error)
+}
+
+// SetIngestSource makes the processor dispatch the events received from the source
+// to the notifiers of the target user, as if the events were mined locally.
+func SetIngestSource(source IngestSource) Option {
+	return func(processor *BlockProcessor) {
+		processor.ingest = source
+	}
+}
+
+// dispatchIngested dispatches the forwarded event to the target user.
+// The event is not matched against the user's subscriptions, the forwarding instance did that.
+func (processor *BlockProcessor) dispatchIngested(userId, kind string, data []byte) error {
+	event, err := decodeEvent(kind, data)
+	if err != nil {
+		return err
+	}
+
+	processor.goDispatch(event, func() error {
+		return processor.dispatchUserEvent(userId, event, true, func(notifier Notifier, settings bson.Raw, user *UserDoc) error {
+			if transfer, ok := event.(*events.TransferMade); ok {
+				return notifier.DispatchTransferMadeEvent(userId, settings, processor.annotateTransfer(user, transfer))
+			}
+			return notify(notifier, userId, settings, event)
+		})
+	})
+	return nil
+}
+
+// EventForwarder is implemented by the notifiers forwarding the events to other instances.
+// The ingested events are not dispatched to them, otherwise they would be sent back.
+type EventForwarder interface {
+	ForwardsEvents()
+}
+
+func skipForwarders(targets []*deliveryTarget) []*deliveryTarget {
+	kept := targets[:0]
+	for _, target := range targets {
+		if _, ok := target.dispatcher.(EventForwarder); !ok {
+			kept = append(kept, target)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,24 @@
+package notifications
+
+import (
+	"gopkg.in/mgo.v2/bson"
+)
+
+// watching returns the query matching the event documents where value is in the given list
+// and the entry is not paused. Paused entries are kept in paused.<list>.
+func watching(list, value string) bson.M {
+	return bson.M{
+		list:             value,
+		"paused." + list: bson.M{"$ne": value},
+	}
+}
+
+// watchingAny returns the $or branches matching the event documents
+// where any of values is in the given list and the entry is not paused.
+func watchingAny(list string, values []string) []interface{} {
+	branches := make([]interface{}, 0, len(values))
+	for _, value := range values {
+		branches = append(branches, watching(list, value))
+	}
+	return branches
+}
@@ -0,0 +1,328 @@
+package notifications
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/tchap/steemwatch/notifications/events"
+	"github.com/tchap/steemwatch/server/db"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// MatchedByNotifier is implemented by the notifiers that can tell the user
+// which subscription caused the notification, e.g. "mention of @alice".
+// MatchedBy returns a view of the notifier that adds the reason to the messages.
+// The view is returned as interface{} since the notifier packages cannot import
+// this package, but it must implement Notifier.
+type MatchedByNotifier interface {
+	MatchedBy(reason string) interface{}
+}
+
+// LabeledNotifier is implemented by the notifiers that can carry the labels
+// the user put on the matched subscription, e.g. "clients", see MatchedByNotifier.
+type LabeledNotifier interface {
+	Labeled(labels []string) interface{}
+}
+
+// subscriptionMatch describes the subscription that caused the event.
+type subscriptionMatch struct {
+	reason string
+	labels []string
+	// schedules are the schedules of all the matching entries, nil for the entries without one.
+	schedules []*db.Schedule
+}
+
+// active returns true when any of the matching entries is within its schedule at t.
+// An event not matched by any entry has no schedule, so it is always active.
+func (match subscriptionMatch) active(t time.Time) bool {
+	if len(match.schedules) == 0 {
+		return true
+	}
+	for _, schedule := range match.schedules {
+		if schedule.Active(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchedNotifier returns the view of the notifier annotating the events with the match,
+// or the notifier itself when it does not support the annotation.
+func matchedNotifier(notifier Notifier, match subscriptionMatch) Notifier {
+	if mn, ok := notifier.(MatchedByNotifier); ok && match.reason != "" {
+		if view, ok := mn.MatchedBy(match.reason).(Notifier); ok {
+			notifier = view
+		}
+	}
+	if ln, ok := notifier.(LabeledNotifier); ok && len(match.labels) != 0 {
+		if view, ok := ln.Labeled(match.labels).(Notifier); ok {
+			notifier = view
+		}
+	}
+	return notifier
+}
+
+// matchRule is a way the event can match an event document: value being in the list.
+// The handlers look up the target users using the same lists.
+type matchRule struct {
+	list   string
+	value  string
+	reason string
+}
+
+func newMatchRule(list, value, format string) matchRule {
+	return matchRule{list, value, fmt.Sprintf(format, value)}
+}
+
+// matchRules returns the rules the event can match, most specific first.
+func matchRules(event interface{}) []matchRule {
+	switch event := event.(type) {
+	case *events.AccountUpdated:
+		return []matchRule{
+			newMatchRule("accounts", event.Op.Account, "account @%v"),
+		}
+	case *events.AccountWitnessVoted:
+		return []matchRule{
+			newMatchRule("accounts", event.Op.Account, "witness vote by @%v"),
+			newMatchRule("witnesses", event.Op.Witness, "witness vote for @%v"),
+		}
+	case *events.TransferMade:
+		// The amount filter is added by transferReason.
+		return []matchRule{
+			newMatchRule("to", event.Op.To, "to @%v"),
+			newMatchRule("from", event.Op.From, "from @%v"),
+			newMatchRule("accounts", event.Op.To, "incoming to watched @%v"),
+			newMatchRule("accounts", event.Op.From, "outgoing from watched @%v"),
+		}
+	case *events.UserMentioned:
+		return []matchRule{
+			newMatchRule("users", event.User, "mention of @%v"),
+		}
+	case *events.UserFollowStatusChanged:
+		return []matchRule{
+			newMatchRule("users", event.Op.Following, "followers of @%v"),
+		}
+	case *events.StoryPublished:
+		rules := []matchRule{
+			newMatchRule("authors", event.Content.Author, "author @%v"),
+		}
+		for _, tag := range event.Content.JsonMetadata.Tags {
+			rules = append(rules, newMatchRule("tags", tag, "tag:%v"))
+		}
+		return rules
+	case *events.StoryVoted:
+		return []matchRule{
+			newMatchRule("authors", event.Content.Author, "votes on posts by @%v"),
+			newMatchRule("voters", event.Op.Voter, "votes by @%v"),
+		}
+	case *events.CommentPublished:
+		return []matchRule{
+			newMatchRule("parentAuthors", event.Content.ParentAuthor, "reply to @%v"),
+			newMatchRule("authors", event.Content.Author, "comment by @%v"),
+		}
+	case *events.CommentVoted:
+		return []matchRule{
+			newMatchRule("authors", event.Content.Author, "votes on comments by @%v"),
+			newMatchRule("voters", event.Op.Voter, "votes by @%v"),
+		}
+	case *events.AccountCreationTokenClaimed:
+		return []matchRule{
+			newMatchRule("accounts", event.Op.Creator, "account @%v"),
+		}
+	case *events.WitnessPropertiesSet:
+		return []matchRule{
+			newMatchRule("witnesses", event.Op.Owner, "witness @%v"),
+		}
+	case *events.BlockProductionRewardReceived:
+		return []matchRule{
+			newMatchRule("witnesses", event.Op.Producer, "witness @%v"),
+		}
+	case *events.WitnessFeedStale:
+		return []matchRule{
+			newMatchRule("witnesses", event.Witness, "witness @%v"),
+		}
+	case *events.WitnessFeedRecovered:
+		return []matchRule{
+			newMatchRule("witnesses", event.Witness, "witness @%v"),
+		}
+	case *events.CommunitySubscriptionChanged:
+		return []matchRule{
+			newMatchRule("accounts", event.Op.Account, "account @%v"),
+			newMatchRule("communities", event.Op.Community, "community %v"),
+		}
+	case *events.CommunityRoleChanged:
+		return []matchRule{
+			newMatchRule("accounts", event.Op.Target, "account @%v"),
+			newMatchRule("accounts", event.Op.Account, "account @%v"),
+			newMatchRule("communities", event.Op.Community, "community %v"),
+		}
+	case *events.NewPayerDetected:
+		return []matchRule{
+			newMatchRule("payees", event.Op.To, "new payers of @%v"),
+		}
+	case *events.CustomJSONBroadcast:
+		var rules []matchRule
+		for _, pattern := range customJSONPatterns(event.Op.ID) {
+			rules = append(rules, newMatchRule("ids", pattern, "custom_json id %v"))
+		}
+		return rules
+	case *events.AccountCreated:
+		return []matchRule{
+			newMatchRule("accounts", event.Op.Creator, "accounts created by @%v"),
+			newMatchRule("accounts", event.Op.NewAccountName, "account @%v"),
+		}
+	case *events.AccountActivity:
+		var rules []matchRule
+		for _, account := range event.Accounts {
+			rules = append(rules, newMatchRule("accounts", account, "activity of @%v"))
+		}
+		return rules
+	case *events.RCDelegated:
+		return []matchRule{
+			newMatchRule("accounts", event.Op.Delegatee, "account @%v"),
+			newMatchRule("accounts", event.Op.Delegator, "account @%v"),
+		}
+	case *events.RCDelegationRemoved:
+		return []matchRule{
+			newMatchRule("accounts", event.Op.Delegatee, "account @%v"),
+			newMatchRule("accounts", event.Op.Delegator, "account @%v"),
+		}
+	default:
+		return nil
+	}
+}
+
+// defaultReason describes the events that are not matched using the lists,
+// or that are also delivered for other reasons, e.g. the replies in watched threads.
+func defaultReason(event interface{}) string {
+	switch event := event.(type) {
+	case *events.PayoutApproaching:
+		return "tracked post by @" + event.Content.Author
+	case *events.PostPaidOut:
+		return "tracked post by @" + event.Content.Author
+	case *events.CommentPublished:
+		return "watched thread"
+	default:
+		return ""
+	}
+}
+
+// matchedBy returns the user's subscription that caused the event, described
+// e.g. as "mention of @alice" or "tag:photography", with the labels of the list entry.
+// It checks the rules against the user's event document the same way the handlers do,
+// see matchDoc. The reason is empty when there is nothing to tell.
+func (processor *BlockProcessor) matchedBy(userId string, event interface{}) subscriptionMatch {
+	rules := matchRules(event)
+	if len(rules) == 0 {
+		return subscriptionMatch{reason: defaultReason(event)}
+	}
+
+	kind := eventKind(event)
+	v, err := processor.configs.get(userId, "events:"+kind, func() (interface{}, error) {
+		query := bson.M{
+			"ownerId": bson.ObjectIdHex(userId),
+			"kind":    kind,
+		}
+
+		var doc eventDoc
+		err := processor.db.C("events").Find(query).One(&doc)
+		if err != nil && err != mgo.ErrNotFound {
+			return nil, err
+		}
+		return &doc, nil
+	})
+	if err != nil {
+		log.Printf("failed to get the event document for user %v: %v", userId, err)
+		return subscriptionMatch{reason: defaultReason(event)}
+	}
+	return matchDoc(v.(*eventDoc), event, rules, time.Now())
+}
+
+// matchDoc matches the rules against the event document. The first rule that is watched
+// and not paused wins, unless it is outside its schedule at now while another one is not.
+// The schedules of all the matching rules are collected, so the event is only held back
+// by the schedules when all the matching entries are outside of them.
+func matchDoc(doc *eventDoc, event interface{}, rules []matchRule, now time.Time) subscriptionMatch {
+	var (
+		match     subscriptionMatch
+		matched   bool
+		schedules []*db.Schedule
+	)
+	for _, rule := range rules {
+		if !listContains(doc.Lists[rule.list], rule.value) || stringInSlice(doc.Paused[rule.list], rule.value) {
+			continue
+		}
+		schedule := db.ScheduleOf(doc.Schedules, rule.list, rule.value)
+		schedules = append(schedules, schedule)
+
+		if matched && (match.active(now) || !schedule.Active(now)) {
+			continue
+		}
+		match = subscriptionMatch{
+			reason:    rule.reason,
+			labels:    db.LabelsOf(doc.Labels, rule.list, rule.value),
+			schedules: []*db.Schedule{schedule},
+		}
+		matched = true
+		if transfer, ok := event.(*events.TransferMade); ok {
+			match.reason = transferReason(&doc.Settings, transfer, rule.reason)
+		}
+	}
+	if !matched {
+		return subscriptionMatch{reason: defaultReason(event)}
+	}
+	match.schedules = schedules
+	return match
+}
+
+// eventDoc is the event document of a user as used to describe the match.
+type eventDoc struct {
+	Settings  db.Settings            `bson:"settings"`
+	Paused    map[string][]string    `bson:"paused"`
+	Labels    []db.EntryLabels       `bson:"labels"`
+	Schedules []db.EntrySchedule     `bson:"schedules"`
+	Lists     map[string]interface{} `bson:",inline"`
+}
+
+// transferReason adds the amount filter to the transfer rule reason,
+// e.g. "transfer > 100 STEEM to @bob".
+func transferReason(settings *db.Settings, event *events.TransferMade, reason string) string {
+	parts := []string{"transfer"}
+
+	_, symbol, err := events.ParseAmount(event.Op.Amount)
+	switch {
+	case settings.MinValueUSD != nil && *settings.MinValueUSD > 0:
+		parts = append(parts, fmt.Sprintf("> $%v", *settings.MinValueUSD))
+	case err == nil && settings.MinAmount(symbol) > 0:
+		parts = append(parts, fmt.Sprintf("> %v %v", settings.MinAmount(symbol), symbol))
+	}
+
+	return strings.Join(append(parts, reason), " ")
+}
+
+// listContains returns true when the list decoded from an event document contains value.
+func listContains(list interface{}, value string) bool {
+	values, ok := list.([]interface{})
+	if !ok {
+		return false
+	}
+	for _, v := range values {
+		if s, ok := v.(string); ok && s == value {
+			return true
+		}
+	}
+	return false
+}
+
+func stringInSlice(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,155 @@
+package notifications
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tchap/steemwatch/notifications/events"
+	"github.com/tchap/steemwatch/server/db"
+
+	"github.com/go-steem/rpc/apis/database"
+)
+
+func entrySchedule(list, value string, schedule *db.Schedule) db.EntrySchedule {
+	return db.EntrySchedule{List: list, Value: value, Schedule: schedule}
+}
+
+func TestMatchDocSchedules(t *testing.T) {
+	// Noon UTC on a Monday.
+	now := time.Date(2026, 10, 12, 12, 0, 0, 0, time.UTC)
+	var (
+		daytime = &db.Schedule{Start: "09:00", End: "17:00", Timezone: "UTC"}
+		night   = &db.Schedule{Start: "22:00", End: "06:00", Timezone: "UTC"}
+	)
+
+	event := &events.StoryPublished{
+		Content: &database.Content{
+			Author:       "alice",
+			JsonMetadata: &database.ContentMetadata{Tags: []string{"photography", "travel"}},
+		},
+	}
+
+	testCases := []struct {
+		name      string
+		authors   []interface{}
+		tags      []interface{}
+		paused    map[string][]string
+		schedules []db.EntrySchedule
+		reason    string
+		active    bool
+	}{
+		{
+			name:    "no schedule",
+			authors: []interface{}{"alice"},
+			reason:  "author @alice",
+			active:  true,
+		},
+		{
+			name:      "within the schedule",
+			authors:   []interface{}{"alice"},
+			schedules: []db.EntrySchedule{entrySchedule("authors", "alice", daytime)},
+			reason:    "author @alice",
+			active:    true,
+		},
+		{
+			name:      "outside the schedule",
+			authors:   []interface{}{"alice"},
+			schedules: []db.EntrySchedule{entrySchedule("authors", "alice", night)},
+			reason:    "author @alice",
+			active:    false,
+		},
+		{
+			name:      "author outside the schedule, tag always",
+			authors:   []interface{}{"alice"},
+			tags:      []interface{}{"travel"},
+			schedules: []db.EntrySchedule{entrySchedule("authors", "alice", night)},
+			reason:    "tag:travel",
+			active:    true,
+		},
+		{
+			name:      "author outside the schedule, tag within",
+			authors:   []interface{}{"alice"},
+			tags:      []interface{}{"photography"},
+			schedules: []db.EntrySchedule{entrySchedule("authors", "alice", night), entrySchedule("tags", "photography", daytime)},
+			reason:    "tag:photography",
+			active:    true,
+		},
+		{
+			name:    "all outside the schedules",
+			authors: []interface{}{"alice"},
+			tags:    []interface{}{"photography", "travel"},
+			schedules: []db.EntrySchedule{
+				entrySchedule("authors", "alice", night),
+				entrySchedule("tags", "photography", night),
+				entrySchedule("tags", "travel", night),
+			},
+			reason: "author @alice",
+			active: false,
+		},
+		{
+			name:      "unscheduled tag paused",
+			authors:   []interface{}{"alice"},
+			tags:      []interface{}{"travel"},
+			paused:    map[string][]string{"tags": {"travel"}},
+			schedules: []db.EntrySchedule{entrySchedule("authors", "alice", night)},
+			reason:    "author @alice",
+			active:    false,
+		},
+		{
+			name:   "not matched",
+			tags:   []interface{}{"food"},
+			reason: "",
+			active: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		doc := &eventDoc{
+			Paused:    tc.paused,
+			Schedules: tc.schedules,
+			Lists:     map[string]interface{}{},
+		}
+		if tc.authors != nil {
+			doc.Lists["authors"] = tc.authors
+		}
+		if tc.tags != nil {
+			doc.Lists["tags"] = tc.tags
+		}
+
+		match := matchDoc(doc, event, matchRules(event), now)
+		if match.reason != tc.reason {
+			t.Errorf("%v: got reason %q, want %q", tc.name, match.reason, tc.reason)
+		}
+		if active := match.active(now); active != tc.active {
+			t.Errorf("%v: got active %v, want %v", tc.name, active, tc.active)
+		}
+	}
+}
+
+func TestSubscriptionMatchActive(t *testing.T) {
+	now := time.Date(2026, 10, 12, 12, 0, 0, 0, time.UTC)
+	var (
+		daytime = &db.Schedule{Start: "09:00", End: "17:00", Timezone: "UTC"}
+		night   = &db.Schedule{Start: "22:00", End: "06:00", Timezone: "UTC"}
+	)
+
+	testCases := []struct {
+		schedules []*db.Schedule
+		want      bool
+	}{
+		{nil, true},
+		{[]*db.Schedule{nil}, true},
+		{[]*db.Schedule{daytime}, true},
+		{[]*db.Schedule{night}, false},
+		{[]*db.Schedule{night, nil}, true},
+		{[]*db.Schedule{night, daytime}, true},
+		{[]*db.Schedule{night, night}, false},
+	}
+
+	for _, tc := range testCases {
+		match := subscriptionMatch{schedules: tc.schedules}
+		if got := match.active(now); got != tc.want {
+			t.Errorf("%v: got %v, want %v", tc.schedules, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+// Package metrics contains the Prometheus metrics exported by the block processor.
+// They are served by the web server on /metrics.
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DeliveryLatency is the time from the timestamp of the block an event was mined from
+// to the event being delivered, per event kind and channel.
+var DeliveryLatency = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Namespace: "steemwatch",
+		Name:      "delivery_latency_seconds",
+		Help:      "Time from the block timestamp to the event being delivered.",
+		Buckets:   []float64{1, 3, 5, 10, 20, 30, 60, 120, 300, 600, 1800, 3600},
+	},
+	[]string{"kind", "channel"},
+)
+
+// Fanout is the number of users an event was dispatched to, per event kind.
+var Fanout = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Namespace: "steemwatch",
+		Name:      "event_fanout_users",
+		Help:      "Number of users an event was dispatched to.",
+		Buckets:   []float64{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000, 2000, 5000},
+	},
+	[]string{"kind"},
+)
+
+func init() {
+	prometheus.MustRegister(DeliveryLatency)
+	prometheus.MustRegister(Fanout)
+}
+
+// ObserveDelivery records the delivery of an event mined from a block with the given timestamp.
+func ObserveDelivery(kind, channel string, blockTime time.Time) {
+	DeliveryLatency.WithLabelValues(kind, channel).Observe(time.Since(blockTime).Seconds())
+}
+
+// ObserveFanout records the number of users an event was dispatched to.
+func ObserveFanout(kind string, users uint) {
+	Fanout.WithLabelValues(kind).Observe(float64(users))
+}
@@ -2,23 +2,51 @@ package notifications
 
 import (
 	"io"
+	"log"
+	"net/http"
 	"os"
+	"strconv"
+	"time"
 
+	"github.com/tchap/steemwatch/links"
 	"github.com/tchap/steemwatch/notifications/events"
+	"github.com/tchap/steemwatch/notifications/notifiers/irc"
+	"github.com/tchap/steemwatch/notifications/notifiers/matrix"
+	"github.com/tchap/steemwatch/notifications/notifiers/push"
 	"github.com/tchap/steemwatch/notifications/notifiers/slack"
 	"github.com/tchap/steemwatch/notifications/notifiers/steemitchat"
 	"github.com/tchap/steemwatch/notifications/notifiers/telegram"
+	"github.com/tchap/steemwatch/notifications/notifiers/xmpp"
+	"github.com/tchap/steemwatch/server/changes"
+	pushapi "github.com/tchap/steemwatch/server/routes/api/notifiers/push"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
 
-var availableNotifiers = map[string]Notifier{
-	"slack": slack.NewNotifier(),
-}
+var availableNotifiers = map[string]Notifier{}
 
 // XXX: Ugly. Would be better to pass the values directly somehow.
-func initNotifiers() {
+func initNotifiers(db *mgo.Database, lb *links.Builder, feed *changes.Feed, policies map[string]NotifierPolicy) {
+	timeout := func(id string) time.Duration {
+		return policies[id].Timeout
+	}
+	maxLength := func(id string) uint {
+		return policies[id].MaxLength
+	}
+
+	// Slack
+	slackOpts := []slack.NotifierOption{slack.SetLinkBuilder(lb)}
+	if t := timeout("slack"); t != 0 {
+		slackOpts = append(slackOpts, slack.SetWebhookTimeout(t))
+	}
+	if n := maxLength("slack"); n != 0 {
+		slackOpts = append(slackOpts, slack.SetMaxMessageLength(n))
+	}
+	availableNotifiers["slack"] = slack.NewNotifier(slackOpts...)
+
 	mustGetenv := func(key string) string {
 		// steemit.chat
 		v := os.Getenv(key)
@@ -31,7 +59,14 @@ func initNotifiers() {
 	userID := mustGetenv("STEEMWATCH_STEEMIT_CHAT_USER_ID")
 	authToken := mustGetenv("STEEMWATCH_STEEMIT_CHAT_AUTH_TOKEN")
 
-	availableNotifiers["steemit-chat"] = steemitchat.NewNotifier(userID, authToken)
+	steemitChatOpts := []steemitchat.NotifierOption{steemitchat.SetLinkBuilder(lb)}
+	if t := timeout("steemit-chat"); t != 0 {
+		steemitChatOpts = append(steemitChatOpts, steemitchat.SetWebhookTimeout(t))
+	}
+	if n := maxLength("steemit-chat"); n != 0 {
+		steemitChatOpts = append(steemitChatOpts, steemitchat.SetMaxMessageLength(n))
+	}
+	availableNotifiers["steemit-chat"] = steemitchat.NewNotifier(userID, authToken, steemitChatOpts...)
 
 	// Telegram
 	botToken := mustGetenv("STEEMWATCH_TELEGRAM_BOT_TOKEN")
@@ -39,8 +74,98 @@ func initNotifiers() {
 	if err != nil {
 		panic(err)
 	}
+	if t := timeout("telegram"); t != 0 {
+		bot.Client = &http.Client{Timeout: t}
+	}
+
+	telegramOpts := []telegram.NotifierOption{telegram.SetLinkBuilder(lb)}
+	if n := maxLength("telegram"); n != 0 {
+		telegramOpts = append(telegramOpts, telegram.SetMaxMessageLength(n))
+	}
+	availableNotifiers["telegram"] = telegram.NewNotifier(bot, telegramOpts...)
 
-	availableNotifiers["telegram"] = telegram.NewNotifier(bot)
+	// Matrix
+	matrixOpts := []matrix.NotifierOption{matrix.SetLinkBuilder(lb)}
+	if t := timeout("matrix"); t != 0 {
+		matrixOpts = append(matrixOpts, matrix.SetRequestTimeout(t))
+	}
+	if n := maxLength("matrix"); n != 0 {
+		matrixOpts = append(matrixOpts, matrix.SetMaxMessageLength(n))
+	}
+	availableNotifiers["matrix"] = matrix.NewNotifier(matrixOpts...)
+
+	// IRC, only enabled when the server is configured.
+	if addr := os.Getenv("STEEMWATCH_IRC_SERVER"); addr != "" {
+		useTLS, _ := strconv.ParseBool(os.Getenv("STEEMWATCH_IRC_TLS"))
+		ircOpts := []irc.NotifierOption{irc.SetLinkBuilder(lb), irc.SetTLS(useTLS)}
+		if t := timeout("irc"); t != 0 {
+			ircOpts = append(ircOpts, irc.SetRequestTimeout(t))
+		}
+		if n := maxLength("irc"); n != 0 {
+			ircOpts = append(ircOpts, irc.SetMaxMessageLength(n))
+		}
+		availableNotifiers["irc"] = irc.NewNotifier(
+			addr,
+			mustGetenv("STEEMWATCH_IRC_NICK"),
+			os.Getenv("STEEMWATCH_IRC_PASSWORD"),
+			ircOpts...,
+		)
+	}
+
+	// XMPP, only enabled when the bot account is configured.
+	if jid := os.Getenv("STEEMWATCH_XMPP_JID"); jid != "" {
+		xmppOpts := []xmpp.NotifierOption{xmpp.SetLinkBuilder(lb)}
+		if t := timeout("xmpp"); t != 0 {
+			xmppOpts = append(xmppOpts, xmpp.SetRequestTimeout(t))
+		}
+		if n := maxLength("xmpp"); n != 0 {
+			xmppOpts = append(xmppOpts, xmpp.SetMaxMessageLength(n))
+		}
+		availableNotifiers["xmpp"] = xmpp.NewNotifier(
+			mustGetenv("STEEMWATCH_XMPP_SERVER"),
+			jid,
+			mustGetenv("STEEMWATCH_XMPP_PASSWORD"),
+			xmppOpts...,
+		)
+	}
+
+	// Push notifications for the native apps, only enabled when the gateway is configured.
+	pushOpts := func(id string) []push.NotifierOption {
+		opts := []push.NotifierOption{
+			push.SetLinkBuilder(lb),
+			push.SetPruneFunc(func(userId, deviceToken string) error {
+				log.Printf("removing invalid %v device token for user %v", id, userId)
+				return pushapi.RemoveDeviceToken(db, feed, userId, id, deviceToken)
+			}),
+		}
+		if t := timeout(id); t != 0 {
+			opts = append(opts, push.SetRequestTimeout(t))
+		}
+		return opts
+	}
+
+	if keyFile := os.Getenv("STEEMWATCH_APNS_KEY_FILE"); keyFile != "" {
+		sandbox, _ := strconv.ParseBool(os.Getenv("STEEMWATCH_APNS_SANDBOX"))
+		gateway, err := push.NewAPNs(
+			keyFile,
+			mustGetenv("STEEMWATCH_APNS_KEY_ID"),
+			mustGetenv("STEEMWATCH_APNS_TEAM_ID"),
+			mustGetenv("STEEMWATCH_APNS_TOPIC"),
+			sandbox,
+		)
+		if err != nil {
+			panic(err)
+		}
+		availableNotifiers[pushapi.NotifierIDAPNs] = push.NewNotifier(gateway, pushOpts(pushapi.NotifierIDAPNs)...)
+	}
+
+	if credentialsFile := os.Getenv("STEEMWATCH_FCM_CREDENTIALS_FILE"); credentialsFile != "" {
+		gateway, err := push.NewFCM(credentialsFile)
+		if err != nil {
+			panic(err)
+		}
+		availableNotifiers[pushapi.NotifierIDFCM] = push.NewNotifier(gateway, pushOpts(pushapi.NotifierIDFCM)...)
+	}
 }
 
 type Notifier interface {
@@ -53,6 +178,83 @@ type Notifier interface {
 	DispatchStoryVotedEvent(userId string, userSettings bson.Raw, event *events.StoryVoted) error
 	DispatchCommentPublishedEvent(userId string, userSettings bson.Raw, event *events.CommentPublished) error
 	DispatchCommentVotedEvent(userId string, userSettings bson.Raw, event *events.CommentVoted) error
+	DispatchAccountCreationTokenClaimedEvent(userId string, userSettings bson.Raw, event *events.AccountCreationTokenClaimed) error
+	DispatchPayoutApproachingEvent(userId string, userSettings bson.Raw, event *events.PayoutApproaching) error
+	DispatchPostPaidOutEvent(userId string, userSettings bson.Raw, event *events.PostPaidOut) error
+	DispatchWitnessPropertiesSetEvent(userId string, userSettings bson.Raw, event *events.WitnessPropertiesSet) error
+	DispatchBlockProductionRewardReceivedEvent(userId string, userSettings bson.Raw, event *events.BlockProductionRewardReceived) error
+	DispatchCommunitySubscriptionChangedEvent(userId string, userSettings bson.Raw, event *events.CommunitySubscriptionChanged) error
+	DispatchCommunityRoleChangedEvent(userId string, userSettings bson.Raw, event *events.CommunityRoleChanged) error
+	DispatchNewPayerDetectedEvent(userId string, userSettings bson.Raw, event *events.NewPayerDetected) error
+	DispatchCustomJSONBroadcastEvent(userId string, userSettings bson.Raw, event *events.CustomJSONBroadcast) error
+	DispatchAccountCreatedEvent(userId string, userSettings bson.Raw, event *events.AccountCreated) error
+	DispatchAccountActivityEvent(userId string, userSettings bson.Raw, event *events.AccountActivity) error
+	DispatchRCDelegatedEvent(userId string, userSettings bson.Raw, event *events.RCDelegated) error
+	DispatchRCDelegationRemovedEvent(userId string, userSettings bson.Raw, event *events.RCDelegationRemoved) error
+	DispatchWitnessFeedStaleEvent(userId string, userSettings bson.Raw, event *events.WitnessFeedStale) error
+	DispatchWitnessFeedRecoveredEvent(userId string, userSettings bson.Raw, event *events.WitnessFeedRecovered) error
+	DispatchDigest(userId string, userSettings bson.Raw, digest *events.Digest) error
+	DispatchDailySummary(userId string, userSettings bson.Raw, summary *events.DailySummary) error
 
 	io.Closer
 }
+
+// notify calls the notifier method matching the event type.
+func notify(notifier Notifier, userId string, settings bson.Raw, event interface{}) error {
+	switch event := event.(type) {
+	case *events.AccountUpdated:
+		return notifier.DispatchAccountUpdatedEvent(userId, settings, event)
+	case *events.AccountWitnessVoted:
+		return notifier.DispatchAccountWitnessVotedEvent(userId, settings, event)
+	case *events.TransferMade:
+		return notifier.DispatchTransferMadeEvent(userId, settings, event)
+	case *events.UserMentioned:
+		return notifier.DispatchUserMentionedEvent(userId, settings, event)
+	case *events.UserFollowStatusChanged:
+		return notifier.DispatchUserFollowStatusChangedEvent(userId, settings, event)
+	case *events.StoryPublished:
+		return notifier.DispatchStoryPublishedEvent(userId, settings, event)
+	case *events.StoryVoted:
+		return notifier.DispatchStoryVotedEvent(userId, settings, event)
+	case *events.CommentPublished:
+		return notifier.DispatchCommentPublishedEvent(userId, settings, event)
+	case *events.CommentVoted:
+		return notifier.DispatchCommentVotedEvent(userId, settings, event)
+	case *events.AccountCreationTokenClaimed:
+		return notifier.DispatchAccountCreationTokenClaimedEvent(userId, settings, event)
+	case *events.PayoutApproaching:
+		return notifier.DispatchPayoutApproachingEvent(userId, settings, event)
+	case *events.PostPaidOut:
+		return notifier.DispatchPostPaidOutEvent(userId, settings, event)
+	case *events.WitnessPropertiesSet:
+		return notifier.DispatchWitnessPropertiesSetEvent(userId, settings, event)
+	case *events.BlockProductionRewardReceived:
+		return notifier.DispatchBlockProductionRewardReceivedEvent(userId, settings, event)
+	case *events.CommunitySubscriptionChanged:
+		return notifier.DispatchCommunitySubscriptionChangedEvent(userId, settings, event)
+	case *events.CommunityRoleChanged:
+		return notifier.DispatchCommunityRoleChangedEvent(userId, settings, event)
+	case *events.NewPayerDetected:
+		return notifier.DispatchNewPayerDetectedEvent(userId, settings, event)
+	case *events.CustomJSONBroadcast:
+		return notifier.DispatchCustomJSONBroadcastEvent(userId, settings, event)
+	case *events.AccountCreated:
+		return notifier.DispatchAccountCreatedEvent(userId, settings, event)
+	case *events.AccountActivity:
+		return notifier.DispatchAccountActivityEvent(userId, settings, event)
+	case *events.RCDelegated:
+		return notifier.DispatchRCDelegatedEvent(userId, settings, event)
+	case *events.RCDelegationRemoved:
+		return notifier.DispatchRCDelegationRemovedEvent(userId, settings, event)
+	case *events.WitnessFeedStale:
+		return notifier.DispatchWitnessFeedStaleEvent(userId, settings, event)
+	case *events.WitnessFeedRecovered:
+		return notifier.DispatchWitnessFeedRecoveredEvent(userId, settings, event)
+	case *events.Digest:
+		return notifier.DispatchDigest(userId, settings, event)
+	case *events.DailySummary:
+		return notifier.DispatchDailySummary(userId, settings, event)
+	default:
+		return errors.Errorf("unknown event type: %T", event)
+	}
+}
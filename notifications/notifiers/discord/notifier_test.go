@@ -0,0 +1,69 @@
+package discord
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/tchap/steemwatch/notifications/events"
+	"github.com/tchap/steemwatch/notifications/notifiers/truncate"
+
+	"github.com/go-steem/rpc/apis/database"
+)
+
+func TestMessageOverLimit(t *testing.T) {
+	const entities = "*bold text* _italic text_ [a link](https://steemit.com) "
+	line := strings.Repeat(entities, 25)
+	event := &events.CommentPublished{
+		Content: &database.Content{
+			Author:         "alice",
+			ParentAuthor:   "bob",
+			ParentPermlink: "a-story",
+			URL:            "/steem/@bob/a-story#@alice/re-a-story",
+			Body:           strings.Repeat(line+"\n", 5),
+		},
+	}
+
+	testCases := []struct {
+		name      string
+		limit     uint
+		matchedBy string
+	}{
+		{"default limit", DefaultMaxMessageLength, ""},
+		{"short limit", 300, ""},
+		{"matched by", 300, "author @alice"},
+	}
+
+	for _, tc := range testCases {
+		// Every cut position within the repeated entities is tried.
+		for limit := tc.limit; limit < tc.limit+uint(len(entities)); limit++ {
+			notifier := NewNotifier(nil, SetMaxMessageLength(limit))
+			if tc.matchedBy != "" {
+				notifier = notifier.MatchedBy(tc.matchedBy).(*Notifier)
+			}
+
+			text := notifier.message(event, renderCommentPublishedEvent(notifier.links, event))
+			if n := utf8.RuneCountInString(text); n > int(limit) {
+				t.Errorf("%v: got %v characters, limit %v", tc.name, n, limit)
+			}
+			more := markdownEscaper.Replace(truncate.ContentLink(notifier.links, event))
+			if !strings.HasSuffix(text, more) {
+				t.Errorf("%v: link to the full content missing: %q", tc.name, text)
+			}
+			if !balanced(text) {
+				t.Errorf("%v: entity left open with limit %v: %q", tc.name, limit, text)
+			}
+		}
+	}
+}
+
+// balanced returns true when every Markdown entity is closed, otherwise the message cannot be parsed.
+func balanced(text string) bool {
+	text = strings.NewReplacer("\\_", "", "\\*", "", "\\`", "", "\\[", "").Replace(text)
+	for _, marker := range []string{"*", "_", "`"} {
+		if strings.Count(text, marker)%2 != 0 {
+			return false
+		}
+	}
+	return strings.Count(text, "[") == strings.Count(text, "]")
+}
@@ -2,9 +2,11 @@ package discord
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"strings"
 
+	"github.com/tchap/steemwatch/links"
 	"github.com/tchap/steemwatch/notifications/events"
 )
 
@@ -18,7 +20,7 @@ func steemdLink(account string) string {
 
 // AccountUpdated
 
-func renderAccountUpdatedEvent(event *events.AccountUpdated) string {
+func renderAccountUpdatedEvent(lb *links.Builder, event *events.AccountUpdated) string {
 	return fmt.Sprintf(`
 **-----**
 Account update detected for %v.
@@ -29,7 +31,7 @@ Account update detected for %v.
 
 // AccountWitnessVoted
 
-func renderAccountWitnessVotedEvent(event *events.AccountWitnessVoted) string {
+func renderAccountWitnessVotedEvent(lb *links.Builder, event *events.AccountWitnessVoted) string {
 	var verb string
 	if event.Op.Approve {
 		verb = "approved"
@@ -49,44 +51,55 @@ func renderAccountWitnessVotedEvent(event *events.AccountWitnessVoted) string {
 
 // TransferMade
 
-func renderTransferMadeEvent(event *events.TransferMade) string {
+func renderTransferMadeEvent(lb *links.Builder, event *events.TransferMade) string {
 	op := event.Op
+
+	var notes string
+	if event.Exchange != nil {
+		notes = "\n" + event.Exchange.Describe() + "."
+	}
+	if event.RoundTrip != nil {
+		notes += "\n" + event.RoundTrip.Describe() + "."
+	}
+
 	if op.Memo != "" {
 		return fmt.Sprintf(`
 **-----**
-%v transferred %v to %v using memo %v.
+%v transferred %v to %v using memo %v.%v
 `,
 			steemitLink(op.From),
 			op.Amount,
 			steemitLink(op.To),
 			op.Memo,
+			notes,
 		)
 	}
 	return fmt.Sprintf(
-		"%v transferred %v to %v.",
+		"%v transferred %v to %v.%v",
 		steemitLink(op.From),
 		op.Amount,
 		steemitLink(op.To),
+		notes,
 	)
 }
 
 // UserMentioned
 
-func renderUserMentionedEvent(event *events.UserMentioned) string {
+func renderUserMentionedEvent(lb *links.Builder, event *events.UserMentioned) string {
 	c := event.Content
 	return fmt.Sprintf(`
 **-----**
-%v was mentioned by %v in https://steemit.com%v.
+%v was mentioned by %v in %v.
 `,
 		steemitLink(event.User),
 		steemitLink(c.Author),
-		c.URL,
+		lb.Content(c.URL),
 	)
 }
 
 // UserFollowStatusChanged
 
-func renderUserFollowStatusChangedEvent(event *events.UserFollowStatusChanged) string {
+func renderUserFollowStatusChangedEvent(lb *links.Builder, event *events.UserFollowStatusChanged) string {
 	op := event.Op
 
 	follower := steemitLink(op.Follower)
@@ -107,51 +120,53 @@ func renderUserFollowStatusChangedEvent(event *events.UserFollowStatusChanged) s
 
 // StoryPublished
 
-func renderStoryPublishedEvent(event *events.StoryPublished) string {
+func renderStoryPublishedEvent(lb *links.Builder, event *events.StoryPublished) string {
 	c := event.Content
 
 	return fmt.Sprintf(`
 **-----**
-%v has published or updated a story.
+%v has %v a story.
 
 **Title:** %v
 **Tags:** %v
-**Link:** https://steemit.com%v
+**Link:** %v
 `,
 		steemitLink(c.Author),
+		event.Verb(),
 		c.Title,
 		c.JsonMetadata.Tags,
-		c.URL,
+		lb.Content(c.URL),
 	)
 }
 
 // StoryVoted
 
-func renderStoryVotedEvent(event *events.StoryVoted) string {
+func renderStoryVotedEvent(lb *links.Builder, event *events.StoryVoted) string {
 	o := event.Op
 	c := event.Content
 
 	return fmt.Sprintf(`
 **-----**
-%v cast a vote on a story by %v.
+%v %v on a story by %v.
 
 **Title:** %v
-**Link:** https://steemit.com%v
+**Link:** %v
 **Vote weight:** %v
 **Pending Payout:** %v
 `,
 		steemitLink(o.Voter),
+		event.Verb(),
 		steemitLink(o.Author),
 		c.Title,
-		c.URL,
-		o.Weight,
+		lb.Content(c.URL),
+		event.WeightText(),
 		c.PendingPayoutValue,
 	)
 }
 
 // CommentPublished
 
-func renderCommentPublishedEvent(event *events.CommentPublished) string {
+func renderCommentPublishedEvent(lb *links.Builder, event *events.CommentPublished) string {
 	c := event.Content
 
 	commentLines := make([]string, 0, 5)
@@ -167,42 +182,318 @@ func renderCommentPublishedEvent(event *events.CommentPublished) string {
 
 	extract := strings.Join(extractLines, "\n")
 	if len(commentLines) > 5 {
-		extract += fmt.Sprintf("\n<https://steemit.com%v|Read more...>", c.URL)
+		extract += fmt.Sprintf("\n<%v|Read more...>", lb.Content(c.URL))
 	}
 
 	return fmt.Sprintf(`
 **-----**
 %v commented on @%v/%v.
 
+**Link:** %v
 **Content:** %v
 `,
 		steemitLink(c.Author),
-		c.URL,
 		c.ParentAuthor,
 		c.ParentPermlink,
+		lb.Content(c.URL),
 		extract,
 	)
 }
 
 // CommentVoted
 
-func renderCommentVotedEvent(event *events.CommentVoted) string {
+func renderCommentVotedEvent(lb *links.Builder, event *events.CommentVoted) string {
 	o := event.Op
 	c := event.Content
 
 	return fmt.Sprintf(`
 **-----**
-%v cast a vote on a comment @%v/%v.
+%v %v on a comment @%v/%v.
 
-**Link:** https://steemit.com%v
+**Link:** %v
 **Weight:** %v
 **Pending Payout:** %v
 `,
 		steemitLink(o.Voter),
+		event.Verb(),
 		c.Author,
 		c.Permlink,
-		c.URL,
-		o.Weight,
+		lb.Content(c.URL),
+		event.WeightText(),
 		c.PendingPayoutValue,
 	)
 }
+
+// AccountCreationTokenClaimed
+
+func renderAccountCreationTokenClaimedEvent(
+	lb *links.Builder,
+	event *events.AccountCreationTokenClaimed,
+) string {
+
+	payment := event.Op.Fee
+	if event.PaidWithRC() {
+		payment = "resource credits"
+	}
+
+	return fmt.Sprintf(`
+**-----**
+%v claimed an account creation token, paid with %v.
+`,
+		steemitLink(event.Op.Creator),
+		payment,
+	)
+}
+
+// PayoutApproaching
+
+func renderPayoutApproachingEvent(lb *links.Builder, event *events.PayoutApproaching) string {
+	c := event.Content
+
+	return fmt.Sprintf(`
+**-----**
+A story by %v is going to be paid out in %v.
+
+**Title:** %v
+**Link:** %v
+**Pending Payout:** %v
+`,
+		steemitLink(c.Author),
+		event.TimeLeft(),
+		c.Title,
+		lb.Content(c.URL),
+		c.PendingPayoutValue,
+	)
+}
+
+// PostPaidOut
+
+func renderPostPaidOutEvent(lb *links.Builder, event *events.PostPaidOut) string {
+	c := event.Content
+
+	return fmt.Sprintf(`
+**-----**
+A story by %v has been paid out.
+
+**Title:** %v
+**Link:** %v
+**Total Payout:** %v
+**Curator Payout:** %v
+`,
+		steemitLink(c.Author),
+		c.Title,
+		lb.Content(c.URL),
+		c.TotalPayoutValue,
+		event.CuratorPayout,
+	)
+}
+
+// WitnessPropertiesSet
+
+func renderWitnessPropertiesSetEvent(lb *links.Builder, event *events.WitnessPropertiesSet) string {
+	var props bytes.Buffer
+	for _, prop := range event.Properties {
+		fmt.Fprintf(&props, "**%v:** %v\n", prop.Key, prop.Value)
+	}
+
+	return fmt.Sprintf(`
+**-----**
+Witness %v updated its properties.
+
+%v`,
+		steemitLink(event.Op.Owner),
+		props.String(),
+	)
+}
+
+// BlockProductionRewardReceived
+
+func renderBlockProductionRewardReceivedEvent(
+	lb *links.Builder,
+	event *events.BlockProductionRewardReceived,
+) string {
+
+	if event.Aggregated() {
+		return fmt.Sprintf(`
+**-----**
+Witness %v produced %v blocks on %v.
+
+**Reward:** %v
+`,
+			steemitLink(event.Op.Producer),
+			event.Blocks,
+			event.Day,
+			event.Op.VestingShares,
+		)
+	}
+	return fmt.Sprintf(`
+**-----**
+Witness %v produced a block, earning %v.
+`,
+		steemitLink(event.Op.Producer),
+		event.Op.VestingShares,
+	)
+}
+
+// CommunitySubscriptionChanged
+
+func renderCommunitySubscriptionChangedEvent(
+	lb *links.Builder,
+	event *events.CommunitySubscriptionChanged,
+) string {
+
+	verb := "unsubscribed from"
+	if event.Subscribed() {
+		verb = "subscribed to"
+	}
+	return fmt.Sprintf(`
+**-----**
+%v %v community %v.
+`,
+		steemitLink(event.Op.Account),
+		verb,
+		event.Op.Community,
+	)
+}
+
+// CommunityRoleChanged
+
+func renderCommunityRoleChangedEvent(lb *links.Builder, event *events.CommunityRoleChanged) string {
+	return fmt.Sprintf(`
+**-----**
+%v set the role of %v in community %v.
+
+**Role:** %v
+`,
+		steemitLink(event.Op.Account),
+		steemitLink(event.Op.Target),
+		event.Op.Community,
+		event.Op.Role,
+	)
+}
+
+// NewPayerDetected
+
+func renderNewPayerDetectedEvent(lb *links.Builder, event *events.NewPayerDetected) string {
+	op := event.Op
+
+	var memo string
+	if op.Memo != "" {
+		memo = "\n\n**Memo:** " + op.Memo
+	}
+	return fmt.Sprintf(`
+**-----**
+New payer %v transferred %v to %v.%v
+`,
+		steemitLink(op.From),
+		op.Amount,
+		steemitLink(op.To),
+		memo,
+	)
+}
+
+// CustomJSONBroadcast
+
+func renderCustomJSONBroadcastEvent(lb *links.Builder, event *events.CustomJSONBroadcast) string {
+	return fmt.Sprintf(`
+**-----**
+custom_json %v broadcast by %v:
+`+"```"+`
+%v
+`+"```"+`
+`,
+		event.Op.ID,
+		steemitLink(event.Account()),
+		events.Excerpt(event.Op.JSON, events.CustomJSONExcerptLength),
+	)
+}
+
+// AccountCreated
+
+func renderAccountCreatedEvent(lb *links.Builder, event *events.AccountCreated) string {
+	op := event.Op
+
+	return fmt.Sprintf(`
+**-----**
+%v created account %v, paid %v and delegated %v.
+`,
+		steemitLink(op.Creator),
+		steemitLink(op.NewAccountName),
+		op.Fee,
+		op.Delegation,
+	)
+}
+
+// AccountActivity
+
+func renderAccountActivityEvent(lb *links.Builder, event *events.AccountActivity) string {
+	accounts := make([]string, len(event.Accounts))
+	for i, account := range event.Accounts {
+		accounts[i] = steemitLink(account)
+	}
+
+	return fmt.Sprintf(`
+**-----**
+%v operation by %v
+%v
+`,
+		event.OpType,
+		strings.Join(accounts, ", "),
+		"```"+event.Excerpt()+"```",
+	)
+}
+
+// RCDelegated
+
+func renderRCDelegatedEvent(lb *links.Builder, event *events.RCDelegated) string {
+	op := event.Op
+
+	return fmt.Sprintf(`
+**-----**
+%v delegated %v RC to %v.
+`,
+		steemitLink(op.Delegator),
+		op.MaxRC,
+		steemitLink(op.Delegatee),
+	)
+}
+
+// RCDelegationRemoved
+
+func renderRCDelegationRemovedEvent(lb *links.Builder, event *events.RCDelegationRemoved) string {
+	op := event.Op
+
+	return fmt.Sprintf(`
+**-----**
+%v removed the RC delegation to %v.
+`,
+		steemitLink(op.Delegator),
+		steemitLink(op.Delegatee),
+	)
+}
+
+// WitnessFeedStale
+
+func renderWitnessFeedStaleEvent(lb *links.Builder, event *events.WitnessFeedStale) string {
+	return fmt.Sprintf(`
+**-----**
+Witness %v has not published the price feed for %v.
+The last feed was published at %v.
+`,
+		steemitLink(event.Witness),
+		event.Age(),
+		event.LastPublish.UTC().Format("Jan 2 15:04 MST"),
+	)
+}
+
+// WitnessFeedRecovered
+
+func renderWitnessFeedRecoveredEvent(lb *links.Builder, event *events.WitnessFeedRecovered) string {
+	return fmt.Sprintf(`
+**-----**
+Witness %v published the price feed again after %v.
+`,
+		steemitLink(event.Witness),
+		event.Stale(),
+	)
+}
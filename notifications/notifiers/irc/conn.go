@@ -0,0 +1,342 @@
+package irc
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/textproto"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/tchap/steemwatch/errs"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultFloodInterval is the minimal delay between two lines sent to the server.
+	// Most servers start dropping or kicking clients sending more than a line every two seconds.
+	DefaultFloodInterval = 2 * time.Second
+
+	// DefaultFloodBurst is the number of lines that can be sent at once
+	// before the flood interval starts to be applied.
+	DefaultFloodBurst = 5
+
+	// MaxLineLength leaves space for the command and the channel name
+	// in the 512 bytes allowed for an IRC message.
+	MaxLineLength = 400
+
+	minReconnectDelay = time.Second
+	maxReconnectDelay = 5 * time.Minute
+)
+
+type line struct {
+	channel string
+	text    string
+	errCh   chan error
+}
+
+// conn is the managed connection to the IRC server.
+// It keeps reconnecting until closed, joins channels on demand
+// and paces the outgoing lines so that the flood protection is not triggered.
+type conn struct {
+	addr     string
+	useTLS   bool
+	nick     string
+	password string
+
+	floodInterval time.Duration
+	floodBurst    int
+
+	lineCh chan *line
+	termCh chan struct{}
+}
+
+func newConn(addr, nick, password string, useTLS bool) *conn {
+	return &conn{
+		addr:          addr,
+		useTLS:        useTLS,
+		nick:          nick,
+		password:      password,
+		floodInterval: DefaultFloodInterval,
+		floodBurst:    DefaultFloodBurst,
+		lineCh:        make(chan *line),
+		termCh:        make(chan struct{}),
+	}
+}
+
+// loop connects to the server and serves the connection, reconnecting on failure.
+func (c *conn) loop() {
+	delay := minReconnectDelay
+	for {
+		connectedAt := time.Now()
+		err := c.serve()
+		if err == errs.ErrClosing {
+			return
+		}
+		log.Printf("IRC connection to %v lost: %+v", c.addr, err)
+
+		// Reset the delay when the connection was alive for a while.
+		if time.Since(connectedAt) > maxReconnectDelay {
+			delay = minReconnectDelay
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-c.termCh:
+			return
+		}
+
+		delay *= 2
+		if delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
+
+func (c *conn) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	if c.useTLS {
+		return tls.DialWithDialer(dialer, "tcp", c.addr, nil)
+	}
+	return dialer.Dial("tcp", c.addr)
+}
+
+func (c *conn) serve() error {
+	nc, err := c.dial()
+	if err != nil {
+		return errors.Wrapf(err, "failed to connect to %v", c.addr)
+	}
+	defer nc.Close()
+
+	var (
+		w       = bufio.NewWriter(nc)
+		readErr = make(chan error, 1)
+		// The server sends PING regularly, the connection is considered dead
+		// when nothing arrives for a while.
+		readTimeout = 5 * time.Minute
+	)
+
+	write := func(format string, args ...interface{}) error {
+		nc.SetWriteDeadline(time.Now().Add(30 * time.Second))
+		if _, err := fmt.Fprintf(w, format+"\r\n", args...); err != nil {
+			return err
+		}
+		return w.Flush()
+	}
+
+	// Register.
+	if c.password != "" {
+		if err := write("PASS %v", c.password); err != nil {
+			return errors.Wrap(err, "failed to send PASS")
+		}
+	}
+	if err := write("NICK %v", c.nick); err != nil {
+		return errors.Wrap(err, "failed to send NICK")
+	}
+	if err := write("USER %v 0 * :SteemWatch", c.nick); err != nil {
+		return errors.Wrap(err, "failed to send USER")
+	}
+
+	// Read the incoming messages. Only PING and the registration replies are interesting.
+	var (
+		pingCh       = make(chan string, 1)
+		registeredCh = make(chan struct{})
+	)
+	go func() {
+		r := textproto.NewReader(bufio.NewReader(nc))
+		registered := false
+		for {
+			nc.SetReadDeadline(time.Now().Add(readTimeout))
+			msg, err := r.ReadLine()
+			if err != nil {
+				readErr <- err
+				return
+			}
+
+			_, command, params := parseMessage(msg)
+			switch command {
+			case "PING":
+				select {
+				case pingCh <- params:
+				default:
+				}
+			case "001":
+				if !registered {
+					registered = true
+					close(registeredCh)
+				}
+			case "433":
+				readErr <- errors.Errorf("nickname %v is already in use", c.nick)
+				return
+			case "ERROR":
+				readErr <- errors.Errorf("server error: %v", params)
+				return
+			}
+		}
+	}()
+
+	// Wait for the registration to complete.
+	registrationTimeoutCh := time.After(time.Minute)
+	for registered := false; !registered; {
+		select {
+		case <-registeredCh:
+			registered = true
+		case ping := <-pingCh:
+			if err := write("PONG %v", ping); err != nil {
+				return errors.Wrap(err, "failed to send PONG")
+			}
+		case err := <-readErr:
+			return err
+		case <-registrationTimeoutCh:
+			return errors.New("registration timed out")
+		case <-c.termCh:
+			write("QUIT :Shutting down")
+			return errs.ErrClosing
+		}
+	}
+
+	log.Printf("IRC connection to %v established", c.addr)
+
+	var (
+		joined = make(map[string]bool)
+		tokens = c.floodBurst
+		ticker = time.NewTicker(c.floodInterval)
+	)
+	defer ticker.Stop()
+
+	// send writes a single line, waiting for a token when the burst is used up.
+	send := func(format string, args ...interface{}) error {
+		for tokens == 0 {
+			select {
+			case <-ticker.C:
+				tokens++
+			case <-c.termCh:
+				return errs.ErrClosing
+			}
+		}
+		tokens--
+		return write(format, args...)
+	}
+
+	for {
+		// Only accept new lines when there is a token available,
+		// the dispatchers wait in the meantime.
+		var lineCh chan *line
+		if tokens > 0 {
+			lineCh = c.lineCh
+		}
+
+		select {
+		case <-ticker.C:
+			if tokens < c.floodBurst {
+				tokens++
+			}
+
+		case ping := <-pingCh:
+			if err := write("PONG %v", ping); err != nil {
+				return errors.Wrap(err, "failed to send PONG")
+			}
+
+		case l := <-lineCh:
+			err := func() error {
+				if !joined[l.channel] {
+					if err := send("JOIN %v", l.channel); err != nil {
+						return err
+					}
+					joined[l.channel] = true
+				}
+				return send("PRIVMSG %v :%v", l.channel, l.text)
+			}()
+			l.errCh <- err
+			if err != nil {
+				return err
+			}
+
+		case err := <-readErr:
+			return err
+
+		case <-c.termCh:
+			write("QUIT :Shutting down")
+			return errs.ErrClosing
+		}
+	}
+}
+
+// send queues the message to be sent to the channel, line by line.
+func (c *conn) send(channel, msg string, timeout time.Duration) error {
+	timeoutCh := time.After(timeout)
+	for _, text := range splitLines(msg) {
+		l := &line{
+			channel: channel,
+			text:    text,
+			errCh:   make(chan error, 1),
+		}
+
+		select {
+		case c.lineCh <- l:
+		case <-timeoutCh:
+			return errors.Errorf("timed out waiting to send a message to %v", channel)
+		case <-c.termCh:
+			return errs.ErrClosing
+		}
+
+		if err := <-l.errCh; err != nil {
+			return errors.Wrapf(err, "failed to send a message to %v", channel)
+		}
+	}
+	return nil
+}
+
+func (c *conn) close() {
+	close(c.termCh)
+}
+
+// parseMessage splits the IRC message into the prefix, the command and the parameters.
+func parseMessage(msg string) (prefix, command, params string) {
+	if strings.HasPrefix(msg, ":") {
+		i := strings.IndexByte(msg, ' ')
+		if i == -1 {
+			return msg[1:], "", ""
+		}
+		prefix, msg = msg[1:i], msg[i+1:]
+	}
+
+	i := strings.IndexByte(msg, ' ')
+	if i == -1 {
+		return prefix, msg, ""
+	}
+	return prefix, msg[:i], msg[i+1:]
+}
+
+// splitLines turns the message into non-empty lines that fit an IRC message.
+// Control characters would break the protocol, so they are dropped.
+func splitLines(msg string) []string {
+	var lines []string
+	for _, text := range strings.Split(msg, "\n") {
+		text = strings.Map(func(r rune) rune {
+			if r < 0x20 || r == 0x7f {
+				return -1
+			}
+			return r
+		}, text)
+
+		text = strings.TrimSpace(text)
+		for len(text) > MaxLineLength {
+			// Cut at a rune boundary.
+			i := MaxLineLength
+			for i > 0 && !utf8.RuneStart(text[i]) {
+				i--
+			}
+			lines = append(lines, text[:i])
+			text = text[i:]
+		}
+		if text != "" {
+			lines = append(lines, text)
+		}
+	}
+	return lines
+}
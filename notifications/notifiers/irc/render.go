@@ -0,0 +1,408 @@
+package irc
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/tchap/steemwatch/links"
+	"github.com/tchap/steemwatch/notifications/events"
+)
+
+// steemitLink only prints the account name, the links would make the messages too long.
+func steemitLink(lb *links.Builder, account string) string {
+	return "@" + account
+}
+
+func contentLink(lb *links.Builder, url, text string) string {
+	return fmt.Sprintf("%v <%v>", text, lb.Content(url))
+}
+
+// AccountUpdated
+
+func renderAccountUpdatedEvent(lb *links.Builder, event *events.AccountUpdated) string {
+	return fmt.Sprintf("Account update detected for %v.", steemitLink(lb, event.Op.Account))
+}
+
+// AccountWitnessVoted
+
+func renderAccountWitnessVotedEvent(lb *links.Builder, event *events.AccountWitnessVoted) string {
+	var verb string
+	if event.Op.Approve {
+		verb = "approved"
+	} else {
+		verb = "unapproved"
+	}
+
+	return fmt.Sprintf("%v %v witness %v.",
+		steemitLink(lb, event.Op.Account),
+		verb,
+		steemitLink(lb, event.Op.Witness),
+	)
+}
+
+// TransferMade
+
+func renderTransferMadeEvent(lb *links.Builder, event *events.TransferMade) string {
+	op := event.Op
+
+	var notes string
+	if event.Exchange != nil {
+		notes = " " + event.Exchange.Describe() + "."
+	}
+	if event.RoundTrip != nil {
+		notes += " " + event.RoundTrip.Describe() + "."
+	}
+
+	if op.Memo != "" {
+		return fmt.Sprintf("%v transferred %v to %v using memo \"%v\".%v",
+			steemitLink(lb, op.From),
+			op.Amount,
+			steemitLink(lb, op.To),
+			op.Memo,
+			notes,
+		)
+	}
+	return fmt.Sprintf("%v transferred %v to %v.%v",
+		steemitLink(lb, op.From),
+		op.Amount,
+		steemitLink(lb, op.To),
+		notes,
+	)
+}
+
+// UserMentioned
+
+func renderUserMentionedEvent(lb *links.Builder, event *events.UserMentioned) string {
+	c := event.Content
+	return fmt.Sprintf("%v was %v by %v in %v.",
+		steemitLink(lb, event.User),
+		contentLink(lb, c.URL, "mentioned"),
+		steemitLink(lb, c.Author),
+		c.Permlink,
+	)
+}
+
+// UserFollowStatusChanged
+
+func renderUserFollowStatusChangedEvent(lb *links.Builder, event *events.UserFollowStatusChanged) string {
+	op := event.Op
+
+	follower := steemitLink(lb, op.Follower)
+	following := steemitLink(lb, op.Following)
+
+	var text string
+	switch {
+	case event.Followed():
+		text = fmt.Sprintf("%v started following %v.", follower, following)
+	case event.Muted():
+		text = fmt.Sprintf("%v muted %v.", follower, following)
+	case event.Reset():
+		text = fmt.Sprintf("%v reset the follow status for %v.", follower, following)
+	}
+
+	return text
+}
+
+// StoryPublished
+
+func renderStoryPublishedEvent(lb *links.Builder, event *events.StoryPublished) string {
+	c := event.Content
+
+	summary, _ := bufio.NewReader(strings.NewReader(c.Body)).ReadString('\n')
+
+	return fmt.Sprintf(`%v has %v a %v.
+Title: %v
+Summary: %v
+Tags: %v`,
+		steemitLink(lb, c.Author),
+		event.Verb(),
+		contentLink(lb, c.URL, "story"),
+		c.Title,
+		strings.TrimSpace(summary),
+		strings.Join(c.JsonMetadata.Tags, ", "),
+	)
+}
+
+// StoryVoted
+
+func renderStoryVotedEvent(lb *links.Builder, event *events.StoryVoted) string {
+	o := event.Op
+	c := event.Content
+
+	return fmt.Sprintf(`%v %v on a %v by %v.
+Title: %v
+Vote weight: %v
+Pending Payout: %v`,
+		steemitLink(lb, o.Voter),
+		event.Verb(),
+		contentLink(lb, c.URL, "story"),
+		steemitLink(lb, o.Author),
+		c.Title,
+		event.WeightText(),
+		c.PendingPayoutValue,
+	)
+}
+
+// CommentPublished
+
+func renderCommentPublishedEvent(lb *links.Builder, event *events.CommentPublished) string {
+	c := event.Content
+
+	commentLines := make([]string, 0, 5)
+	scanner := bufio.NewScanner(strings.NewReader(c.Body))
+	for scanner.Scan() {
+		commentLines = append(commentLines, scanner.Text())
+	}
+
+	extractLines := commentLines
+	if len(extractLines) > 5 {
+		extractLines = extractLines[:5]
+	}
+
+	extract := strings.Join(extractLines, "\n")
+	if len(commentLines) > 5 {
+		extract += "\n" + contentLink(lb, c.URL, "Read more...")
+	}
+
+	return fmt.Sprintf(`%v added a %v to @%v/%v.
+%v`,
+		steemitLink(lb, c.Author),
+		contentLink(lb, c.URL, "comment"),
+		c.ParentAuthor,
+		c.ParentPermlink,
+		extract,
+	)
+}
+
+// CommentVoted
+
+func renderCommentVotedEvent(lb *links.Builder, event *events.CommentVoted) string {
+	o := event.Op
+	c := event.Content
+
+	return fmt.Sprintf(`%v %v on a %v by %v.
+Weight: %v
+Pending Payout: %v`,
+		steemitLink(lb, o.Voter),
+		event.Verb(),
+		contentLink(lb, c.URL, "comment"),
+		steemitLink(lb, o.Author),
+		event.WeightText(),
+		c.PendingPayoutValue,
+	)
+}
+
+// AccountCreationTokenClaimed
+
+func renderAccountCreationTokenClaimedEvent(
+	lb *links.Builder,
+	event *events.AccountCreationTokenClaimed,
+) string {
+
+	payment := event.Op.Fee
+	if event.PaidWithRC() {
+		payment = "resource credits"
+	}
+
+	return fmt.Sprintf("%v claimed an account creation token, paid with %v.",
+		steemitLink(lb, event.Op.Creator),
+		payment,
+	)
+}
+
+// PayoutApproaching
+
+func renderPayoutApproachingEvent(lb *links.Builder, event *events.PayoutApproaching) string {
+	c := event.Content
+
+	return fmt.Sprintf(`A %v by %v is going to be paid out in %v.
+Title: %v
+Pending Payout: %v`,
+		contentLink(lb, c.URL, "story"),
+		steemitLink(lb, c.Author),
+		event.TimeLeft(),
+		c.Title,
+		c.PendingPayoutValue,
+	)
+}
+
+// PostPaidOut
+
+func renderPostPaidOutEvent(lb *links.Builder, event *events.PostPaidOut) string {
+	c := event.Content
+
+	return fmt.Sprintf(`A %v by %v has been paid out.
+Title: %v
+Total Payout: %v
+Curator Payout: %v`,
+		contentLink(lb, c.URL, "story"),
+		steemitLink(lb, c.Author),
+		c.Title,
+		c.TotalPayoutValue,
+		event.CuratorPayout,
+	)
+}
+
+// WitnessPropertiesSet
+
+func renderWitnessPropertiesSetEvent(lb *links.Builder, event *events.WitnessPropertiesSet) string {
+	var props bytes.Buffer
+	for _, prop := range event.Properties {
+		fmt.Fprintf(&props, "\n%v: %v", prop.Key, prop.Value)
+	}
+
+	return fmt.Sprintf("Witness %v updated its properties.%v",
+		steemitLink(lb, event.Op.Owner),
+		props.String(),
+	)
+}
+
+// BlockProductionRewardReceived
+
+func renderBlockProductionRewardReceivedEvent(
+	lb *links.Builder,
+	event *events.BlockProductionRewardReceived,
+) string {
+
+	if event.Aggregated() {
+		return fmt.Sprintf(`Witness %v produced %v blocks on %v.
+Reward: %v`,
+			steemitLink(lb, event.Op.Producer),
+			event.Blocks,
+			event.Day,
+			event.Op.VestingShares,
+		)
+	}
+	return fmt.Sprintf("Witness %v produced a block, earning %v.",
+		steemitLink(lb, event.Op.Producer),
+		event.Op.VestingShares,
+	)
+}
+
+// CommunitySubscriptionChanged
+
+func renderCommunitySubscriptionChangedEvent(
+	lb *links.Builder,
+	event *events.CommunitySubscriptionChanged,
+) string {
+
+	verb := "unsubscribed from"
+	if event.Subscribed() {
+		verb = "subscribed to"
+	}
+	return fmt.Sprintf("%v %v community %v.",
+		steemitLink(lb, event.Op.Account),
+		verb,
+		event.Op.Community,
+	)
+}
+
+// CommunityRoleChanged
+
+func renderCommunityRoleChangedEvent(lb *links.Builder, event *events.CommunityRoleChanged) string {
+	return fmt.Sprintf(`%v set the role of %v in community %v.
+Role: %v`,
+		steemitLink(lb, event.Op.Account),
+		steemitLink(lb, event.Op.Target),
+		event.Op.Community,
+		event.Op.Role,
+	)
+}
+
+// NewPayerDetected
+
+func renderNewPayerDetectedEvent(lb *links.Builder, event *events.NewPayerDetected) string {
+	op := event.Op
+
+	text := fmt.Sprintf("New payer %v transferred %v to %v.",
+		steemitLink(lb, op.From),
+		op.Amount,
+		steemitLink(lb, op.To),
+	)
+	if op.Memo != "" {
+		text += "\nMemo: " + op.Memo
+	}
+	return text
+}
+
+// CustomJSONBroadcast
+
+func renderCustomJSONBroadcastEvent(lb *links.Builder, event *events.CustomJSONBroadcast) string {
+	return fmt.Sprintf("custom_json %v broadcast by %v: %v",
+		event.Op.ID,
+		steemitLink(lb, event.Account()),
+		events.Excerpt(event.Op.JSON, events.CustomJSONExcerptLength),
+	)
+}
+
+// AccountCreated
+
+func renderAccountCreatedEvent(lb *links.Builder, event *events.AccountCreated) string {
+	op := event.Op
+
+	return fmt.Sprintf("%v created account %v, paid %v and delegated %v.",
+		steemitLink(lb, op.Creator),
+		steemitLink(lb, op.NewAccountName),
+		op.Fee,
+		op.Delegation,
+	)
+}
+
+// AccountActivity
+
+func renderAccountActivityEvent(lb *links.Builder, event *events.AccountActivity) string {
+	accounts := make([]string, len(event.Accounts))
+	for i, account := range event.Accounts {
+		accounts[i] = steemitLink(lb, account)
+	}
+
+	return fmt.Sprintf("%v operation by %v\n%v",
+		event.OpType,
+		strings.Join(accounts, ", "),
+		event.Excerpt(),
+	)
+}
+
+// RCDelegated
+
+func renderRCDelegatedEvent(lb *links.Builder, event *events.RCDelegated) string {
+	op := event.Op
+
+	return fmt.Sprintf("%v delegated %v RC to %v.",
+		steemitLink(lb, op.Delegator),
+		op.MaxRC,
+		steemitLink(lb, op.Delegatee),
+	)
+}
+
+// RCDelegationRemoved
+
+func renderRCDelegationRemovedEvent(lb *links.Builder, event *events.RCDelegationRemoved) string {
+	op := event.Op
+
+	return fmt.Sprintf("%v removed the RC delegation to %v.",
+		steemitLink(lb, op.Delegator),
+		steemitLink(lb, op.Delegatee),
+	)
+}
+
+// WitnessFeedStale
+
+func renderWitnessFeedStaleEvent(lb *links.Builder, event *events.WitnessFeedStale) string {
+	return fmt.Sprintf("Witness %v has not published the price feed for %v, the last feed was published at %v.",
+		steemitLink(lb, event.Witness),
+		event.Age(),
+		event.LastPublish.UTC().Format("Jan 2 15:04 MST"),
+	)
+}
+
+// WitnessFeedRecovered
+
+func renderWitnessFeedRecoveredEvent(lb *links.Builder, event *events.WitnessFeedRecovered) string {
+	return fmt.Sprintf("Witness %v published the price feed again after %v.",
+		steemitLink(lb, event.Witness),
+		event.Stale(),
+	)
+}
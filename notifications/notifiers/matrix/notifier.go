@@ -0,0 +1,483 @@
+package matrix
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/url"
+	"time"
+	"unicode/utf8"
+
+	"github.com/tchap/steemwatch/errs"
+	"github.com/tchap/steemwatch/links"
+	"github.com/tchap/steemwatch/notifications/events"
+	"github.com/tchap/steemwatch/notifications/notifiers/truncate"
+	"github.com/tchap/steemwatch/server/routes/api/notifiers/matrix"
+
+	"github.com/pkg/errors"
+	"github.com/valyala/fasthttp"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const DefaultMaxConcurrentRequests = 1000
+
+// DefaultMaxMessageLength is the default length limit of the messages.
+// The homeservers reject the events over 64 KiB, the formatted body included.
+const DefaultMaxMessageLength = 30000
+
+//
+// Matrix message
+//
+
+const htmlFormat = "org.matrix.custom.html"
+
+type Message struct {
+	MsgType       string `json:"msgtype"`
+	Body          string `json:"body"`
+	Format        string `json:"format,omitempty"`
+	FormattedBody string `json:"formatted_body,omitempty"`
+}
+
+//
+// Notifier
+//
+
+type Notifier struct {
+	requestTimeout        time.Duration
+	links                 *links.Builder
+	maxConcurrentRequests uint
+	requestSemaphore      chan struct{}
+	maxMessageLength      uint
+	termCh                chan struct{}
+
+	// matchedBy is only set on the views returned by MatchedBy.
+	matchedBy string
+}
+
+func NewNotifier(opts ...NotifierOption) *Notifier {
+	notifier := &Notifier{
+		requestTimeout:        30 * time.Second,
+		links:                 links.MustNewBuilder(links.DefaultBaseURL),
+		maxConcurrentRequests: DefaultMaxConcurrentRequests,
+		maxMessageLength:      DefaultMaxMessageLength,
+		termCh:                make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(notifier)
+	}
+
+	notifier.requestSemaphore = make(chan struct{}, notifier.maxConcurrentRequests)
+
+	return notifier
+}
+
+type NotifierOption func(*Notifier)
+
+func SetLinkBuilder(lb *links.Builder) NotifierOption {
+	return func(notifier *Notifier) {
+		notifier.links = lb
+	}
+}
+
+// SetMaxMessageLength sets the maximum number of characters in a message.
+// The longer messages are cut and the link to the full content is appended.
+func SetMaxMessageLength(length uint) NotifierOption {
+	return func(notifier *Notifier) {
+		notifier.maxMessageLength = length
+	}
+}
+
+func SetRequestTimeout(timeout time.Duration) NotifierOption {
+	return func(notifier *Notifier) {
+		notifier.requestTimeout = timeout
+	}
+}
+
+func SetMaxConcurrentRequests(maxConcurrentRequests uint) NotifierOption {
+	return func(notifier *Notifier) {
+		notifier.maxConcurrentRequests = maxConcurrentRequests
+	}
+}
+
+func (notifier *Notifier) DispatchAccountUpdatedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.AccountUpdated,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderAccountUpdatedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchAccountWitnessVotedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.AccountWitnessVoted,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderAccountWitnessVotedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchTransferMadeEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.TransferMade,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderTransferMadeEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchUserMentionedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.UserMentioned,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderUserMentionedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchUserFollowStatusChangedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.UserFollowStatusChanged,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderUserFollowStatusChangedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchStoryPublishedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.StoryPublished,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderStoryPublishedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchStoryVotedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.StoryVoted,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderStoryVotedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchCommentPublishedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.CommentPublished,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderCommentPublishedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchCommentVotedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.CommentVoted,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderCommentVotedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchAccountCreationTokenClaimedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.AccountCreationTokenClaimed,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderAccountCreationTokenClaimedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchPayoutApproachingEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.PayoutApproaching,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderPayoutApproachingEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchPostPaidOutEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.PostPaidOut,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderPostPaidOutEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchWitnessPropertiesSetEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.WitnessPropertiesSet,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderWitnessPropertiesSetEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchBlockProductionRewardReceivedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.BlockProductionRewardReceived,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderBlockProductionRewardReceivedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchCommunitySubscriptionChangedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.CommunitySubscriptionChanged,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderCommunitySubscriptionChangedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchCommunityRoleChangedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.CommunityRoleChanged,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderCommunityRoleChangedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchNewPayerDetectedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.NewPayerDetected,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderNewPayerDetectedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchCustomJSONBroadcastEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.CustomJSONBroadcast,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderCustomJSONBroadcastEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchAccountCreatedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.AccountCreated,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderAccountCreatedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchAccountActivityEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.AccountActivity,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderAccountActivityEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchRCDelegatedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.RCDelegated,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderRCDelegatedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchRCDelegationRemovedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.RCDelegationRemoved,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderRCDelegationRemovedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchWitnessFeedStaleEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.WitnessFeedStale,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderWitnessFeedStaleEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchWitnessFeedRecoveredEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.WitnessFeedRecovered,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderWitnessFeedRecoveredEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchDigest(
+	userId string,
+	userSettings bson.Raw,
+	digest *events.Digest,
+) error {
+	return notifier.dispatch(userId, userSettings, digest, func() string {
+		return renderDigest(notifier.links, digest)
+	})
+}
+
+func (notifier *Notifier) DispatchDailySummary(
+	userId string,
+	userSettings bson.Raw,
+	summary *events.DailySummary,
+) error {
+	return notifier.dispatch(userId, userSettings, summary, func() string {
+		return renderDailySummary(notifier.links, summary)
+	})
+}
+
+// MatchedBy returns a view of the notifier that appends the reason to the messages.
+func (notifier *Notifier) MatchedBy(reason string) interface{} {
+	view := *notifier
+	view.matchedBy = reason
+	return &view
+}
+
+func (notifier *Notifier) dispatch(
+	userId string,
+	userSettings bson.Raw,
+	event interface{},
+	render func() string,
+) error {
+	var settings matrix.Settings
+	if err := userSettings.Unmarshal(&settings); err != nil {
+		return errors.Wrapf(err, "failed to unmarshal Matrix settings for user %v", userId)
+	}
+
+	formatted := render()
+	if notifier.matchedBy != "" {
+		formatted += "<br><em>Matched by " + html.EscapeString(notifier.matchedBy) + "</em>"
+	}
+	body := plainText(formatted)
+	// HTML cannot be cut safely, the cut plain text is sent formatted as well instead.
+	if limit := int(notifier.maxMessageLength); limit > 0 && utf8.RuneCountInString(formatted) > limit {
+		text, more := body, truncate.ContentLink(notifier.links, event)
+		body = truncate.Fit(text, limit, more)
+		formatted = formatPlainText(body)
+		// The escaping makes the text longer, the cut is moved back by as much.
+		if n := utf8.RuneCountInString(formatted); n > limit {
+			body = truncate.Fit(text, limit-(n-utf8.RuneCountInString(body)), more)
+			formatted = formatPlainText(body)
+		}
+	}
+	msg := &Message{
+		MsgType: "m.notice",
+		Body:    body,
+	}
+	if !settings.PlainText {
+		msg.Format = htmlFormat
+		msg.FormattedBody = formatted
+	}
+
+	txnId, err := transactionId(userId, event)
+	if err != nil {
+		return err
+	}
+	return notifier.send(&settings, msg, txnId)
+}
+
+// send sends the message as the given transaction. The homeserver drops the message
+// in case the very same transaction is sent again.
+func (notifier *Notifier) send(settings *matrix.Settings, msg *Message, txnId string) error {
+	// Acquire a request slot.
+	select {
+	case notifier.requestSemaphore <- struct{}{}:
+		defer func() {
+			<-notifier.requestSemaphore
+		}()
+	case <-notifier.termCh:
+		return errs.ErrClosing
+	}
+
+	// Marshal the message.
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(msg); err != nil {
+		return errors.Wrap(err, "failed to encode Matrix message")
+	}
+
+	endpoint := settings.HomeserverURL + "/_matrix/client/r0/rooms/" +
+		url.PathEscape(settings.RoomId) + "/send/m.room.message/" + txnId
+
+	req := fasthttp.AcquireRequest()
+	res := fasthttp.AcquireResponse()
+	defer func() {
+		fasthttp.ReleaseRequest(req)
+		fasthttp.ReleaseResponse(res)
+	}()
+
+	req.Header.SetMethod("PUT")
+	req.Header.SetContentType("application/json; charset=utf-8")
+	req.Header.Set("Authorization", "Bearer "+settings.AccessToken)
+	req.SetRequestURI(endpoint)
+	req.SetBody(body.Bytes())
+
+	if err := fasthttp.DoTimeout(req, res, notifier.requestTimeout); err != nil {
+		return errors.Wrap(err, "failed to send Matrix message")
+	}
+
+	switch code := res.StatusCode(); {
+	case code == fasthttp.StatusUnauthorized:
+		return errors.Wrap(errs.ErrCredentialsRejected, "Matrix access token rejected")
+	case code < 200 || code >= 300:
+		return errors.Errorf("PUT %v -> %v", settings.HomeserverURL, code)
+	}
+	return nil
+}
+
+// transactionId identifies the message by the user and the event, so that the retries
+// of a send that went through but timed out reuse the transaction.
+func transactionId(userId string, event interface{}) (string, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to generate transaction ID")
+	}
+	sum := sha1.Sum(append([]byte(fmt.Sprintf("%v:%T:", userId, event)), body...))
+	return "steemwatch-" + hex.EncodeToString(sum[:]), nil
+}
+
+func (notifier *Notifier) Close() error {
+	select {
+	case <-notifier.termCh:
+		return errs.ErrClosing
+	default:
+		close(notifier.termCh)
+		return nil
+	}
+}
@@ -0,0 +1,122 @@
+package matrix
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/tchap/steemwatch/notifications/events"
+	"github.com/tchap/steemwatch/server/routes/api/notifiers/matrix"
+
+	"github.com/go-steem/rpc/apis/database"
+	"github.com/go-steem/rpc/types"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestTransactionId(t *testing.T) {
+	var txnIds []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		txnIds = append(txnIds, path.Base(r.URL.Path))
+	}))
+	defer server.Close()
+
+	settings, err := bson.Marshal(&matrix.Settings{
+		HomeserverURL: server.URL,
+		AccessToken:   "token",
+		RoomId:        "!room:example.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := bson.Raw{Kind: 0x03, Data: settings}
+
+	transfer := func(amount string) *events.TransferMade {
+		return &events.TransferMade{
+			Op: &types.TransferOperation{From: "alice", To: "bob", Amount: amount},
+		}
+	}
+
+	testCases := []struct {
+		name   string
+		userId string
+		event  *events.TransferMade
+		same   bool
+	}{
+		{"first send", "user", transfer("1.000 STEEM"), false},
+		{"retry", "user", transfer("1.000 STEEM"), true},
+		{"another event", "user", transfer("2.000 STEEM"), false},
+		{"another user", "other", transfer("1.000 STEEM"), false},
+	}
+
+	notifier := NewNotifier()
+	seen := make(map[string]bool)
+	for _, tc := range testCases {
+		if err := notifier.DispatchTransferMadeEvent(tc.userId, raw, tc.event); err != nil {
+			t.Fatalf("%v: unexpected error: %v", tc.name, err)
+		}
+		txnId := txnIds[len(txnIds)-1]
+		if seen[txnId] != tc.same {
+			t.Errorf("%v: transaction %v reused: %v, want %v", tc.name, txnId, seen[txnId], tc.same)
+		}
+		seen[txnId] = true
+	}
+}
+
+func TestDispatchOverLimit(t *testing.T) {
+	var msg Message
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		msg = Message{}
+		json.NewDecoder(r.Body).Decode(&msg)
+	}))
+	defer server.Close()
+
+	settings, err := bson.Marshal(&matrix.Settings{
+		HomeserverURL: server.URL,
+		AccessToken:   "token",
+		RoomId:        "!room:example.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := bson.Raw{Kind: 0x03, Data: settings}
+
+	testCases := []struct {
+		name  string
+		line  string
+		limit uint
+	}{
+		{"default limit", strings.Repeat("a line of the comment ", 300), DefaultMaxMessageLength},
+		{"short limit", strings.Repeat("a line of the comment ", 100), 300},
+		{"escaped", strings.Repeat("Q&A <3 ", 100), 300},
+	}
+
+	for _, tc := range testCases {
+		notifier := NewNotifier(SetMaxMessageLength(tc.limit))
+		event := &events.CommentPublished{
+			Content: &database.Content{
+				Author:         "alice",
+				ParentAuthor:   "bob",
+				ParentPermlink: "a-story",
+				URL:            "/steem/@bob/a-story#@alice/re-a-story",
+				Body:           strings.Repeat(tc.line+"\n", 5),
+			},
+		}
+		if err := notifier.DispatchCommentPublishedEvent("user", raw, event); err != nil {
+			t.Fatalf("%v: unexpected error: %v", tc.name, err)
+		}
+
+		if n := utf8.RuneCountInString(msg.Body); n > int(tc.limit) {
+			t.Errorf("%v: got %v characters of the body, limit %v", tc.name, n, tc.limit)
+		}
+		if n := utf8.RuneCountInString(msg.FormattedBody); n > int(tc.limit) {
+			t.Errorf("%v: got %v characters of the formatted body, limit %v", tc.name, n, tc.limit)
+		}
+		if !strings.HasSuffix(msg.Body, "Full content: "+notifier.links.Content(event.Content.URL)) {
+			t.Errorf("%v: link to the full content missing: %q", tc.name, msg.Body)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package push
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	APNsProductionURL = "https://api.push.apple.com"
+	APNsSandboxURL    = "https://api.sandbox.push.apple.com"
+)
+
+// apnsTokenLifetime is for how long a provider token is used.
+// APNs rejects the tokens older than an hour.
+const apnsTokenLifetime = 50 * time.Minute
+
+// APNs sends the notifications through the Apple Push Notification service
+// using token-based authentication, i.e. the .p8 signing key of the team.
+type APNs struct {
+	baseURL string
+	topic   string
+	keyId   string
+	teamId  string
+	key     *ecdsa.PrivateKey
+
+	token     string
+	tokenTime time.Time
+	tokenLock sync.Mutex
+}
+
+// NewAPNs loads the signing key from the given .p8 file.
+// The topic is the bundle ID of the app.
+func NewAPNs(keyFile, keyId, teamId, topic string, sandbox bool) (*APNs, error) {
+	raw, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read APNs signing key")
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, errors.New("APNs signing key is not PEM encoded")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse APNs signing key")
+	}
+	key, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("APNs signing key is not an ECDSA key")
+	}
+
+	baseURL := APNsProductionURL
+	if sandbox {
+		baseURL = APNsSandboxURL
+	}
+	return &APNs{
+		baseURL: baseURL,
+		topic:   topic,
+		keyId:   keyId,
+		teamId:  teamId,
+		key:     key,
+	}, nil
+}
+
+type apnsPayload struct {
+	APS struct {
+		Alert struct {
+			Title string `json:"title"`
+			Body  string `json:"body,omitempty"`
+		} `json:"alert"`
+		Sound string `json:"sound,omitempty"`
+	} `json:"aps"`
+	URL string `json:"url,omitempty"`
+}
+
+func (gateway *APNs) Send(client *http.Client, deviceToken string, msg *Message) error {
+	var payload apnsPayload
+	payload.APS.Alert.Title = msg.Title
+	payload.APS.Alert.Body = msg.Body
+	payload.APS.Sound = "default"
+	payload.URL = msg.URL
+
+	body, err := json.Marshal(&payload)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode APNs payload")
+	}
+
+	token, err := gateway.providerToken()
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", gateway.baseURL+"/3/device/"+url.PathEscape(deviceToken), bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "failed to create APNs request")
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Authorization", "bearer "+token)
+	req.Header.Set("apns-topic", gateway.topic)
+	req.Header.Set("apns-push-type", "alert")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to send APNs notification")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	var reply struct {
+		Reason string `json:"reason"`
+	}
+	json.NewDecoder(res.Body).Decode(&reply)
+
+	switch {
+	case res.StatusCode == http.StatusGone,
+		reply.Reason == "BadDeviceToken",
+		reply.Reason == "DeviceTokenNotForTopic":
+		return errors.Wrap(ErrInvalidToken, reply.Reason)
+	default:
+		return errors.Errorf("POST %v -> %v %v", gateway.baseURL, res.StatusCode, reply.Reason)
+	}
+}
+
+// providerToken returns the signed JWT used to authenticate with APNs, renewed as needed.
+func (gateway *APNs) providerToken() (string, error) {
+	gateway.tokenLock.Lock()
+	defer gateway.tokenLock.Unlock()
+
+	now := time.Now()
+	if gateway.token != "" && now.Sub(gateway.tokenTime) < apnsTokenLifetime {
+		return gateway.token, nil
+	}
+
+	header, _ := json.Marshal(map[string]string{
+		"alg": "ES256",
+		"kid": gateway.keyId,
+	})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss": gateway.teamId,
+		"iat": now.Unix(),
+	})
+
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(unsigned))
+	r, s, err := ecdsa.Sign(rand.Reader, gateway.key, digest[:])
+	if err != nil {
+		return "", errors.Wrap(err, "failed to sign APNs provider token")
+	}
+	// ES256 signature is r || s, both padded to 32 bytes.
+	signature := make([]byte, 64)
+	copyPadded(signature[:32], r)
+	copyPadded(signature[32:], s)
+
+	gateway.token = unsigned + "." + enc.EncodeToString(signature)
+	gateway.tokenTime = now
+	return gateway.token, nil
+}
+
+func copyPadded(dst []byte, n *big.Int) {
+	b := n.Bytes()
+	copy(dst[len(dst)-len(b):], b)
+}
@@ -0,0 +1,138 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	FCMBaseURL = "https://fcm.googleapis.com"
+
+	// FCMScope is the OAuth2 scope the service account is authorized for to send the messages.
+	FCMScope = "https://www.googleapis.com/auth/firebase.messaging"
+)
+
+// FCM sends the notifications through the Firebase Cloud Messaging HTTP v1 API
+// authenticated as a service account of the Firebase project.
+type FCM struct {
+	sendURL string
+	tokens  oauth2.TokenSource
+}
+
+// NewFCM loads the service account key from the given JSON file, as downloaded
+// from the Firebase console. The messages are sent within the project of the account.
+func NewFCM(credentialsFile string) (*FCM, error) {
+	raw, err := ioutil.ReadFile(credentialsFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read FCM service account key")
+	}
+	config, err := google.JWTConfigFromJSON(raw, FCMScope)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse FCM service account key")
+	}
+
+	var key struct {
+		ProjectId string `json:"project_id"`
+	}
+	if err := json.Unmarshal(raw, &key); err != nil {
+		return nil, errors.Wrap(err, "failed to parse FCM service account key")
+	}
+	if key.ProjectId == "" {
+		return nil, errors.New("FCM service account key is missing the project ID")
+	}
+
+	return &FCM{
+		sendURL: FCMBaseURL + "/v1/projects/" + key.ProjectId + "/messages:send",
+		// The access token is cached and renewed once expired.
+		tokens: config.TokenSource(context.Background()),
+	}, nil
+}
+
+type fcmMessage struct {
+	Token        string `json:"token"`
+	Notification struct {
+		Title string `json:"title"`
+		Body  string `json:"body,omitempty"`
+	} `json:"notification"`
+	// Data values must be strings.
+	Data map[string]string `json:"data,omitempty"`
+}
+
+type fcmPayload struct {
+	Message fcmMessage `json:"message"`
+}
+
+// fcmError is the error reported in the body, the error code is in the details.
+type fcmError struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+		Details []struct {
+			ErrorCode string `json:"errorCode"`
+		} `json:"details"`
+	} `json:"error"`
+}
+
+func (gateway *FCM) Send(client *http.Client, deviceToken string, msg *Message) error {
+	var payload fcmPayload
+	payload.Message.Token = deviceToken
+	payload.Message.Notification.Title = msg.Title
+	payload.Message.Notification.Body = msg.Body
+	if msg.URL != "" {
+		payload.Message.Data = map[string]string{"url": msg.URL}
+	}
+
+	body, err := json.Marshal(&payload)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode FCM payload")
+	}
+
+	token, err := gateway.tokens.Token()
+	if err != nil {
+		return errors.Wrap(err, "failed to get FCM access token")
+	}
+
+	req, err := http.NewRequest("POST", gateway.sendURL, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "failed to create FCM request")
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	token.SetAuthHeader(req)
+
+	res, err := client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to send FCM notification")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	var reply fcmError
+	json.NewDecoder(res.Body).Decode(&reply)
+
+	reason := reply.Error.Status
+	for _, detail := range reply.Error.Details {
+		if detail.ErrorCode != "" {
+			reason = detail.ErrorCode
+		}
+	}
+
+	// INVALID_ARGUMENT is returned for a malformed payload as well, e.g. an oversized data field,
+	// so only the tokens reported as unregistered are pruned.
+	switch {
+	case res.StatusCode == http.StatusNotFound, reason == "UNREGISTERED":
+		return errors.Wrap(ErrInvalidToken, reason)
+	default:
+		return errors.Errorf("POST %v -> %v %v: %v", gateway.sendURL, res.StatusCode, reason, reply.Error.Message)
+	}
+}
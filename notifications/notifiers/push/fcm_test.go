@@ -0,0 +1,122 @@
+package push
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+)
+
+func TestFCMSend(t *testing.T) {
+	testCases := []struct {
+		name    string
+		status  int
+		reply   string
+		invalid bool
+		failed  bool
+	}{
+		{"sent", http.StatusOK, `{"name": "projects/steemwatch/messages/1"}`, false, false},
+		{"unregistered", http.StatusNotFound,
+			`{"error": {"code": 404, "status": "NOT_FOUND", "details": [{"errorCode": "UNREGISTERED"}]}}`, true, true},
+		{"not found", http.StatusNotFound, ``, true, true},
+		{"invalid argument", http.StatusBadRequest,
+			`{"error": {"code": 400, "status": "INVALID_ARGUMENT", "details": [{"errorCode": "INVALID_ARGUMENT"}]}}`, false, true},
+		{"unavailable", http.StatusServiceUnavailable,
+			`{"error": {"code": 503, "status": "UNAVAILABLE", "details": [{"errorCode": "UNAVAILABLE"}]}}`, false, true},
+	}
+
+	var (
+		req     *http.Request
+		payload fcmPayload
+		status  int
+		reply   string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req = r
+		payload = fcmPayload{}
+		json.NewDecoder(r.Body).Decode(&payload)
+		w.WriteHeader(status)
+		w.Write([]byte(reply))
+	}))
+	defer server.Close()
+
+	gateway := &FCM{
+		sendURL: server.URL + "/v1/projects/steemwatch/messages:send",
+		tokens:  oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "access-token"}),
+	}
+	msg := &Message{Title: "Title", Body: "Body", URL: "https://steemit.com"}
+
+	for _, tc := range testCases {
+		status, reply = tc.status, tc.reply
+
+		err := gateway.Send(server.Client(), "device-token", msg)
+		if (err != nil) != tc.failed {
+			t.Errorf("%v: got error %v, want failed %v", tc.name, err, tc.failed)
+		}
+		if invalid := errors.Cause(err) == ErrInvalidToken; invalid != tc.invalid {
+			t.Errorf("%v: got invalid token %v, want %v", tc.name, invalid, tc.invalid)
+		}
+
+		if req.URL.Path != "/v1/projects/steemwatch/messages:send" {
+			t.Errorf("%v: got path %v", tc.name, req.URL.Path)
+		}
+		if auth := req.Header.Get("Authorization"); auth != "Bearer access-token" {
+			t.Errorf("%v: got Authorization %q", tc.name, auth)
+		}
+		if payload.Message.Token != "device-token" || payload.Message.Notification.Title != "Title" ||
+			payload.Message.Data["url"] != "https://steemit.com" {
+			t.Errorf("%v: got payload %+v", tc.name, payload)
+		}
+	}
+}
+
+func TestNewFCM(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fcm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	testCases := []struct {
+		name    string
+		key     string
+		sendURL string
+	}{
+		{
+			"service account",
+			`{"type": "service_account", "project_id": "steemwatch", "client_email": "push@steemwatch.iam.gserviceaccount.com", "private_key": "key"}`,
+			FCMBaseURL + "/v1/projects/steemwatch/messages:send",
+		},
+		{"missing project", `{"type": "service_account", "client_email": "push@steemwatch.iam.gserviceaccount.com"}`, ""},
+		{"not a service account", `{"installed": {}}`, ""},
+	}
+
+	for i, tc := range testCases {
+		path := filepath.Join(dir, strconv.Itoa(i)+".json")
+		if err := ioutil.WriteFile(path, []byte(tc.key), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		gateway, err := NewFCM(path)
+		if tc.sendURL == "" {
+			if err == nil {
+				t.Errorf("%v: error expected", tc.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", tc.name, err)
+			continue
+		}
+		if gateway.sendURL != tc.sendURL {
+			t.Errorf("%v: got send URL %v, want %v", tc.name, gateway.sendURL, tc.sendURL)
+		}
+	}
+}
@@ -0,0 +1,382 @@
+package push
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tchap/steemwatch/errs"
+	"github.com/tchap/steemwatch/links"
+	"github.com/tchap/steemwatch/notifications/events"
+	"github.com/tchap/steemwatch/server/routes/api/notifiers/push"
+
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const DefaultMaxConcurrentRequests = 1000
+
+// ErrInvalidToken is returned by the gateways when the device token is no longer valid,
+// e.g. because the app was uninstalled. Such tokens are pruned.
+var ErrInvalidToken = errors.New("invalid device token")
+
+// Message is the gateway independent push notification.
+type Message struct {
+	Title string
+	Body  string
+	URL   string
+}
+
+// Gateway sends a push notification to a single device.
+type Gateway interface {
+	Send(client *http.Client, deviceToken string, msg *Message) error
+}
+
+// PruneFunc is called for every device token reported as invalid by the gateway.
+type PruneFunc func(userId, deviceToken string) error
+
+//
+// Notifier
+//
+
+type Notifier struct {
+	gateway               Gateway
+	client                *http.Client
+	links                 *links.Builder
+	prune                 PruneFunc
+	maxConcurrentRequests uint
+	requestSemaphore      chan struct{}
+	termCh                chan struct{}
+
+	// matchedBy is only set on the views returned by MatchedBy.
+	matchedBy string
+}
+
+func NewNotifier(gateway Gateway, opts ...NotifierOption) *Notifier {
+	notifier := &Notifier{
+		gateway:               gateway,
+		client:                &http.Client{Timeout: 30 * time.Second},
+		links:                 links.MustNewBuilder(links.DefaultBaseURL),
+		prune:                 func(string, string) error { return nil },
+		maxConcurrentRequests: DefaultMaxConcurrentRequests,
+		termCh:                make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(notifier)
+	}
+
+	notifier.requestSemaphore = make(chan struct{}, notifier.maxConcurrentRequests)
+
+	return notifier
+}
+
+type NotifierOption func(*Notifier)
+
+func SetLinkBuilder(lb *links.Builder) NotifierOption {
+	return func(notifier *Notifier) {
+		notifier.links = lb
+	}
+}
+
+func SetRequestTimeout(timeout time.Duration) NotifierOption {
+	return func(notifier *Notifier) {
+		notifier.client = &http.Client{Timeout: timeout}
+	}
+}
+
+func SetMaxConcurrentRequests(maxConcurrentRequests uint) NotifierOption {
+	return func(notifier *Notifier) {
+		notifier.maxConcurrentRequests = maxConcurrentRequests
+	}
+}
+
+// SetPruneFunc sets the function removing the invalid device tokens from the user settings.
+func SetPruneFunc(prune PruneFunc) NotifierOption {
+	return func(notifier *Notifier) {
+		notifier.prune = prune
+	}
+}
+
+func (notifier *Notifier) DispatchAccountUpdatedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.AccountUpdated,
+) error {
+	return notifier.DispatchTitled(userId, userSettings, event, events.DefaultTitle(event))
+}
+
+func (notifier *Notifier) DispatchAccountWitnessVotedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.AccountWitnessVoted,
+) error {
+	return notifier.DispatchTitled(userId, userSettings, event, events.DefaultTitle(event))
+}
+
+func (notifier *Notifier) DispatchTransferMadeEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.TransferMade,
+) error {
+	return notifier.DispatchTitled(userId, userSettings, event, events.DefaultTitle(event))
+}
+
+func (notifier *Notifier) DispatchUserMentionedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.UserMentioned,
+) error {
+	return notifier.DispatchTitled(userId, userSettings, event, events.DefaultTitle(event))
+}
+
+func (notifier *Notifier) DispatchUserFollowStatusChangedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.UserFollowStatusChanged,
+) error {
+	return notifier.DispatchTitled(userId, userSettings, event, events.DefaultTitle(event))
+}
+
+func (notifier *Notifier) DispatchStoryPublishedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.StoryPublished,
+) error {
+	return notifier.DispatchTitled(userId, userSettings, event, events.DefaultTitle(event))
+}
+
+func (notifier *Notifier) DispatchStoryVotedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.StoryVoted,
+) error {
+	return notifier.DispatchTitled(userId, userSettings, event, events.DefaultTitle(event))
+}
+
+func (notifier *Notifier) DispatchCommentPublishedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.CommentPublished,
+) error {
+	return notifier.DispatchTitled(userId, userSettings, event, events.DefaultTitle(event))
+}
+
+func (notifier *Notifier) DispatchCommentVotedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.CommentVoted,
+) error {
+	return notifier.DispatchTitled(userId, userSettings, event, events.DefaultTitle(event))
+}
+
+func (notifier *Notifier) DispatchAccountCreationTokenClaimedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.AccountCreationTokenClaimed,
+) error {
+	return notifier.DispatchTitled(userId, userSettings, event, events.DefaultTitle(event))
+}
+
+func (notifier *Notifier) DispatchPayoutApproachingEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.PayoutApproaching,
+) error {
+	return notifier.DispatchTitled(userId, userSettings, event, events.DefaultTitle(event))
+}
+
+func (notifier *Notifier) DispatchPostPaidOutEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.PostPaidOut,
+) error {
+	return notifier.DispatchTitled(userId, userSettings, event, events.DefaultTitle(event))
+}
+
+func (notifier *Notifier) DispatchWitnessPropertiesSetEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.WitnessPropertiesSet,
+) error {
+	return notifier.DispatchTitled(userId, userSettings, event, events.DefaultTitle(event))
+}
+
+func (notifier *Notifier) DispatchBlockProductionRewardReceivedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.BlockProductionRewardReceived,
+) error {
+	return notifier.DispatchTitled(userId, userSettings, event, events.DefaultTitle(event))
+}
+
+func (notifier *Notifier) DispatchCommunitySubscriptionChangedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.CommunitySubscriptionChanged,
+) error {
+	return notifier.DispatchTitled(userId, userSettings, event, events.DefaultTitle(event))
+}
+
+func (notifier *Notifier) DispatchCommunityRoleChangedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.CommunityRoleChanged,
+) error {
+	return notifier.DispatchTitled(userId, userSettings, event, events.DefaultTitle(event))
+}
+
+func (notifier *Notifier) DispatchNewPayerDetectedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.NewPayerDetected,
+) error {
+	return notifier.DispatchTitled(userId, userSettings, event, events.DefaultTitle(event))
+}
+
+func (notifier *Notifier) DispatchCustomJSONBroadcastEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.CustomJSONBroadcast,
+) error {
+	return notifier.DispatchTitled(userId, userSettings, event, events.DefaultTitle(event))
+}
+
+func (notifier *Notifier) DispatchAccountCreatedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.AccountCreated,
+) error {
+	return notifier.DispatchTitled(userId, userSettings, event, events.DefaultTitle(event))
+}
+
+func (notifier *Notifier) DispatchAccountActivityEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.AccountActivity,
+) error {
+	return notifier.DispatchTitled(userId, userSettings, event, events.DefaultTitle(event))
+}
+
+func (notifier *Notifier) DispatchRCDelegatedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.RCDelegated,
+) error {
+	return notifier.DispatchTitled(userId, userSettings, event, events.DefaultTitle(event))
+}
+
+func (notifier *Notifier) DispatchRCDelegationRemovedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.RCDelegationRemoved,
+) error {
+	return notifier.DispatchTitled(userId, userSettings, event, events.DefaultTitle(event))
+}
+
+func (notifier *Notifier) DispatchWitnessFeedStaleEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.WitnessFeedStale,
+) error {
+	return notifier.DispatchTitled(userId, userSettings, event, events.DefaultTitle(event))
+}
+
+func (notifier *Notifier) DispatchWitnessFeedRecoveredEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.WitnessFeedRecovered,
+) error {
+	return notifier.DispatchTitled(userId, userSettings, event, events.DefaultTitle(event))
+}
+
+func (notifier *Notifier) DispatchDigest(
+	userId string,
+	userSettings bson.Raw,
+	digest *events.Digest,
+) error {
+	return notifier.DispatchTitled(userId, userSettings, digest, events.DefaultTitle(digest))
+}
+
+func (notifier *Notifier) DispatchDailySummary(
+	userId string,
+	userSettings bson.Raw,
+	summary *events.DailySummary,
+) error {
+	return notifier.DispatchTitled(userId, userSettings, summary, events.DefaultTitle(summary))
+}
+
+// MatchedBy returns a view of the notifier that appends the reason to the notification body.
+func (notifier *Notifier) MatchedBy(reason string) interface{} {
+	view := *notifier
+	view.matchedBy = reason
+	return &view
+}
+
+// DispatchTitled pushes the event to all the devices of the user.
+// It only fails when the notification could not be delivered to any device.
+func (notifier *Notifier) DispatchTitled(
+	userId string,
+	userSettings bson.Raw,
+	event interface{},
+	title string,
+) error {
+	var settings push.Settings
+	if err := userSettings.Unmarshal(&settings); err != nil {
+		return errors.Wrapf(err, "failed to unmarshal push settings for user %v", userId)
+	}
+	if len(settings.DeviceTokens) == 0 {
+		return nil
+	}
+
+	msg := renderMessage(notifier.links, event, title)
+	if notifier.matchedBy != "" {
+		msg.Body = strings.TrimSpace(msg.Body + "\nMatched by " + notifier.matchedBy)
+	}
+
+	var (
+		delivered bool
+		lastErr   error
+	)
+	for _, token := range settings.DeviceTokens {
+		err := notifier.send(token, msg)
+		switch {
+		case err == nil:
+			delivered = true
+		case errors.Cause(err) == ErrInvalidToken:
+			if ex := notifier.prune(userId, token); ex != nil {
+				lastErr = ex
+			}
+		default:
+			lastErr = err
+		}
+	}
+	if delivered {
+		return nil
+	}
+	return lastErr
+}
+
+func (notifier *Notifier) send(deviceToken string, msg *Message) error {
+	// Acquire a request slot.
+	select {
+	case notifier.requestSemaphore <- struct{}{}:
+		defer func() {
+			<-notifier.requestSemaphore
+		}()
+	case <-notifier.termCh:
+		return errs.ErrClosing
+	}
+
+	return notifier.gateway.Send(notifier.client, deviceToken, msg)
+}
+
+func (notifier *Notifier) Close() error {
+	select {
+	case <-notifier.termCh:
+		return errs.ErrClosing
+	default:
+		close(notifier.termCh)
+		return nil
+	}
+}
@@ -0,0 +1,58 @@
+package push
+
+import (
+	"strings"
+
+	"github.com/go-steem/rpc/apis/database"
+	"github.com/tchap/steemwatch/links"
+	"github.com/tchap/steemwatch/notifications/events"
+)
+
+// MaxBodyLength is the maximum length of the notification body.
+// The gateways limit the payload size and the devices only show a few lines anyway.
+const MaxBodyLength = 180
+
+// lineJoiner puts the lines of the daily summary sections on a single line.
+var lineJoiner = strings.NewReplacer("\n- ", ", ", "\n", ", ")
+
+// renderMessage turns the event into a push notification. The title is the one rendered
+// from the user's title template, the body is a short excerpt when the event has one.
+func renderMessage(lb *links.Builder, event interface{}, title string) *Message {
+	msg := &Message{Title: title}
+
+	var content *database.Content
+	switch event := event.(type) {
+	case *events.UserMentioned:
+		content = event.Content
+	case *events.StoryPublished:
+		content = event.Content
+	case *events.CommentPublished:
+		content = event.Content
+	case *events.StoryVoted:
+		content = event.Content
+	case *events.CommentVoted:
+		content = event.Content
+	case *events.PayoutApproaching:
+		content = event.Content
+	case *events.PostPaidOut:
+		content = event.Content
+	case *events.TransferMade:
+		msg.Body = events.Excerpt(event.Op.Memo, MaxBodyLength)
+		msg.URL = lb.Account(event.Op.From)
+	case *events.Digest:
+		msg.Body = events.DisplayOf(event).Label
+	case *events.DailySummary:
+		parts := make([]string, 0, len(event.Parts()))
+		for _, part := range event.Parts() {
+			text := strings.TrimPrefix(part.Text, "- ")
+			parts = append(parts, part.Title+": "+lineJoiner.Replace(text))
+		}
+		msg.Body = events.Excerpt(strings.Join(parts, "; "), MaxBodyLength)
+	}
+
+	if content != nil {
+		msg.Body = events.Excerpt(content.Body, MaxBodyLength)
+		msg.URL = lb.Content(content.URL)
+	}
+	return msg
+}
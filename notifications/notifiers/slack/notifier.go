@@ -7,7 +7,9 @@ import (
 	"time"
 
 	"github.com/tchap/steemwatch/errs"
+	"github.com/tchap/steemwatch/links"
 	"github.com/tchap/steemwatch/notifications/events"
+	"github.com/tchap/steemwatch/notifications/notifiers/truncate"
 
 	"github.com/pkg/errors"
 	"github.com/valyala/fasthttp"
@@ -16,6 +18,10 @@ import (
 
 const DefaultMaxConcurrentRequests = 1000
 
+// DefaultMaxMessageLength is the default length limit of the attachment texts and field values.
+// Slack cuts the longer texts and collapses the attachment.
+const DefaultMaxMessageLength = 3000
+
 //
 // Settings
 //
@@ -61,15 +67,22 @@ func UnmarshalSettings(userId string, raw bson.Raw) (*Settings, error) {
 
 type Notifier struct {
 	webhookTimeout        time.Duration
+	links                 *links.Builder
 	maxConcurrentRequests uint
 	requestSemaphore      chan struct{}
+	maxMessageLength      uint
 	termCh                chan struct{}
+
+	// matchedBy is only set on the views returned by MatchedBy.
+	matchedBy string
 }
 
 func NewNotifier(opts ...NotifierOption) *Notifier {
 	notifier := &Notifier{
 		webhookTimeout:        30 * time.Second,
+		links:                 links.MustNewBuilder(links.DefaultBaseURL),
 		maxConcurrentRequests: DefaultMaxConcurrentRequests,
+		maxMessageLength:      DefaultMaxMessageLength,
 		termCh:                make(chan struct{}),
 	}
 
@@ -84,6 +97,20 @@ func NewNotifier(opts ...NotifierOption) *Notifier {
 
 type NotifierOption func(*Notifier)
 
+func SetLinkBuilder(lb *links.Builder) NotifierOption {
+	return func(notifier *Notifier) {
+		notifier.links = lb
+	}
+}
+
+// SetMaxMessageLength sets the maximum number of characters in an attachment text
+// or a field value. The longer ones are cut, the attachment title links to the full content.
+func SetMaxMessageLength(length uint) NotifierOption {
+	return func(notifier *Notifier) {
+		notifier.maxMessageLength = length
+	}
+}
+
 func SetWebhookTimeout(timeout time.Duration) NotifierOption {
 	return func(notifier *Notifier) {
 		notifier.webhookTimeout = timeout
@@ -102,7 +129,7 @@ func (notifier *Notifier) DispatchAccountUpdatedEvent(
 	event *events.AccountUpdated,
 ) error {
 	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
-		return renderAccountUpdatedEvent(event)
+		return renderAccountUpdatedEvent(notifier.links, event)
 	})
 }
 
@@ -112,7 +139,7 @@ func (notifier *Notifier) DispatchAccountWitnessVotedEvent(
 	event *events.AccountWitnessVoted,
 ) error {
 	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
-		return renderAccountWitnessVotedEvent(event)
+		return renderAccountWitnessVotedEvent(notifier.links, event)
 	})
 }
 
@@ -122,7 +149,7 @@ func (notifier *Notifier) DispatchTransferMadeEvent(
 	event *events.TransferMade,
 ) error {
 	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
-		return renderTransferMadeEvent(event)
+		return renderTransferMadeEvent(notifier.links, event)
 	})
 }
 
@@ -132,7 +159,7 @@ func (notifier *Notifier) DispatchUserMentionedEvent(
 	event *events.UserMentioned,
 ) error {
 	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
-		return renderUserMentionedEvent(event)
+		return renderUserMentionedEvent(notifier.links, event)
 	})
 }
 
@@ -142,7 +169,7 @@ func (notifier *Notifier) DispatchUserFollowStatusChangedEvent(
 	event *events.UserFollowStatusChanged,
 ) error {
 	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
-		return renderUserFollowStatusChangedEvent(event)
+		return renderUserFollowStatusChangedEvent(notifier.links, event)
 	})
 }
 
@@ -152,7 +179,7 @@ func (notifier *Notifier) DispatchStoryPublishedEvent(
 	event *events.StoryPublished,
 ) error {
 	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
-		return renderStoryPublishedEvent(event)
+		return renderStoryPublishedEvent(notifier.links, event)
 	})
 }
 
@@ -162,7 +189,7 @@ func (notifier *Notifier) DispatchStoryVotedEvent(
 	event *events.StoryVoted,
 ) error {
 	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
-		return renderStoryVotedEvent(event)
+		return renderStoryVotedEvent(notifier.links, event)
 	})
 }
 
@@ -172,7 +199,7 @@ func (notifier *Notifier) DispatchCommentPublishedEvent(
 	event *events.CommentPublished,
 ) error {
 	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
-		return renderCommentPublishedEvent(event)
+		return renderCommentPublishedEvent(notifier.links, event)
 	})
 }
 
@@ -182,10 +209,206 @@ func (notifier *Notifier) DispatchCommentVotedEvent(
 	event *events.CommentVoted,
 ) error {
 	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
-		return renderCommentVotedEvent(event)
+		return renderCommentVotedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchAccountCreationTokenClaimedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.AccountCreationTokenClaimed,
+) error {
+	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
+		return renderAccountCreationTokenClaimedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchPayoutApproachingEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.PayoutApproaching,
+) error {
+	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
+		return renderPayoutApproachingEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchPostPaidOutEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.PostPaidOut,
+) error {
+	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
+		return renderPostPaidOutEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchWitnessPropertiesSetEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.WitnessPropertiesSet,
+) error {
+	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
+		return renderWitnessPropertiesSetEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchBlockProductionRewardReceivedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.BlockProductionRewardReceived,
+) error {
+	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
+		return renderBlockProductionRewardReceivedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchCommunitySubscriptionChangedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.CommunitySubscriptionChanged,
+) error {
+	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
+		return renderCommunitySubscriptionChangedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchCommunityRoleChangedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.CommunityRoleChanged,
+) error {
+	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
+		return renderCommunityRoleChangedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchNewPayerDetectedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.NewPayerDetected,
+) error {
+	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
+		return renderNewPayerDetectedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchCustomJSONBroadcastEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.CustomJSONBroadcast,
+) error {
+	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
+		return renderCustomJSONBroadcastEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchAccountCreatedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.AccountCreated,
+) error {
+	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
+		return renderAccountCreatedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchAccountActivityEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.AccountActivity,
+) error {
+	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
+		return renderAccountActivityEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchRCDelegatedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.RCDelegated,
+) error {
+	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
+		return renderRCDelegatedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchRCDelegationRemovedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.RCDelegationRemoved,
+) error {
+	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
+		return renderRCDelegationRemovedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchWitnessFeedStaleEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.WitnessFeedStale,
+) error {
+	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
+		return renderWitnessFeedStaleEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchWitnessFeedRecoveredEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.WitnessFeedRecovered,
+) error {
+	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
+		return renderWitnessFeedRecoveredEvent(notifier.links, event)
 	})
 }
 
+func (notifier *Notifier) DispatchDigest(
+	userId string,
+	userSettings bson.Raw,
+	digest *events.Digest,
+) error {
+	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
+		return renderDigest(notifier.links, digest)
+	})
+}
+
+func (notifier *Notifier) DispatchDailySummary(
+	userId string,
+	userSettings bson.Raw,
+	summary *events.DailySummary,
+) error {
+	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
+		return renderDailySummary(notifier.links, summary)
+	})
+}
+
+// DispatchTitled renders the event using the given attachment title.
+func (notifier *Notifier) DispatchTitled(
+	userId string,
+	userSettings bson.Raw,
+	event interface{},
+	title string,
+) error {
+	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
+		payload, err := renderEvent(notifier.links, event)
+		if err != nil {
+			return nil, err
+		}
+		if len(payload.Attachments) != 0 && title != "" {
+			payload.Attachments[0].Title = title
+		}
+		return payload, nil
+	})
+}
+
+// MatchedBy returns a view of the notifier that puts the reason into the footer of the message.
+func (notifier *Notifier) MatchedBy(reason string) interface{} {
+	view := *notifier
+	view.matchedBy = reason
+	return &view
+}
+
 func (notifier *Notifier) dispatch(
 	userId string,
 	userSettings bson.Raw,
@@ -200,6 +423,16 @@ func (notifier *Notifier) dispatch(
 	if err != nil {
 		return err
 	}
+	if notifier.matchedBy != "" && len(payload.Attachments) != 0 {
+		payload.Attachments[len(payload.Attachments)-1].Footer = "Matched by " + notifier.matchedBy
+	}
+	limit := int(notifier.maxMessageLength)
+	for _, attachment := range payload.Attachments {
+		attachment.Text = truncate.Fit(attachment.Text, limit, "")
+		for _, field := range attachment.Fields {
+			field.Value = truncate.Fit(field.Value, limit, "")
+		}
+	}
 
 	return notifier.send(settings.WebhookURL, payload)
 }
@@ -231,7 +464,7 @@ func (notifier *Notifier) send(webhookURL string, payload *Payload) error {
 	}
 
 	req.Header.SetMethod("POST")
-	req.Header.SetContentType("application/json")
+	req.Header.SetContentType("application/json; charset=utf-8")
 	req.SetRequestURI(webhookURL)
 	req.SetBodyStream(&body, body.Len())
 	req.SetConnectionClose()
@@ -0,0 +1,86 @@
+package slack
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/tchap/steemwatch/notifications/events"
+
+	"github.com/go-steem/rpc/types"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestDispatchTransferMadeEventEncoding(t *testing.T) {
+	testCases := []struct {
+		name      string
+		memo      string
+		maxLength uint
+		want      string
+	}{
+		{"ascii", "thanks", 0, "thanks"},
+		{"accents", "Díky za článek, ještě jednou!", 0, "Díky za článek, ještě jednou!"},
+		{"japanese", "記事をありがとう", 0, "記事をありがとう"},
+		{"emoji", "gm 👋🏽 see you 🚀", 0, "gm 👋🏽 see you 🚀"},
+		{"cut", "ありがとうございました", 5, "ありがとう"},
+	}
+
+	var (
+		contentType string
+		body        []byte
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	settings, err := bson.Marshal(&Settings{WebhookURL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := bson.Raw{Kind: 0x03, Data: settings}
+
+	for _, tc := range testCases {
+		notifier := NewNotifier(SetMaxMessageLength(tc.maxLength))
+
+		event := &events.TransferMade{
+			Op: &types.TransferOperation{
+				From:   "alice",
+				To:     "bob",
+				Amount: "1.000 STEEM",
+				Memo:   tc.memo,
+			},
+		}
+		if err := notifier.DispatchTransferMadeEvent("user", raw, event); err != nil {
+			t.Errorf("%v: unexpected error: %v", tc.name, err)
+			continue
+		}
+
+		if contentType != "application/json; charset=utf-8" {
+			t.Errorf("%v: got Content-Type %q", tc.name, contentType)
+		}
+		if !utf8.Valid(body) {
+			t.Errorf("%v: got invalid UTF-8 body %q", tc.name, body)
+			continue
+		}
+
+		var payload Payload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Errorf("%v: failed to decode the body: %v", tc.name, err)
+			continue
+		}
+		var memo string
+		for _, field := range payload.Attachments[0].Fields {
+			if field.Title == "Memo" {
+				memo = field.Value
+			}
+		}
+		if memo != tc.want {
+			t.Errorf("%v: got memo %q, want %q", tc.name, memo, tc.want)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"strings"
 
+	"github.com/tchap/steemwatch/links"
 	"github.com/tchap/steemwatch/notifications/events"
 
 	"github.com/pkg/errors"
@@ -56,20 +57,20 @@ func makeMessage(attachment *Attachment) *Payload {
 
 // AccountUpdated
 
-func renderAccountUpdatedEvent(event *events.AccountUpdated) (*Payload, error) {
+func renderAccountUpdatedEvent(lb *links.Builder, event *events.AccountUpdated) (*Payload, error) {
 	summary := fmt.Sprintf("@%v's account was updated", event.Op.Account)
 
 	return makeMessage(&Attachment{
 		Title:    "Account Update Detected",
 		Fallback: summary,
-		Color:    "#DC143C",
+		Color:    events.DisplayOf(event).Color,
 		Text:     summary,
 	}), nil
 }
 
 // AccountWitnessVoted
 
-func renderAccountWitnessVotedEvent(event *events.AccountWitnessVoted) (*Payload, error) {
+func renderAccountWitnessVotedEvent(lb *links.Builder, event *events.AccountWitnessVoted) (*Payload, error) {
 	var verb string
 	if event.Op.Approve {
 		verb = "approved"
@@ -86,14 +87,14 @@ func renderAccountWitnessVotedEvent(event *events.AccountWitnessVoted) (*Payload
 
 // TransferMade
 
-func renderTransferMadeEvent(event *events.TransferMade) (*Payload, error) {
+func renderTransferMadeEvent(lb *links.Builder, event *events.TransferMade) (*Payload, error) {
 	op := event.Op
 
 	summary := fmt.Sprintf("@%v transferred %v to @%v", op.From, op.Amount, op.To)
 
 	attachment := &Attachment{
 		Fallback: summary,
-		Color:    "#00B2EE",
+		Color:    events.DisplayOf(event).Color,
 		Pretext:  "A transfer you are interested in was made.",
 		Fields: []*Field{
 			{
@@ -119,16 +120,28 @@ func renderTransferMadeEvent(event *events.TransferMade) (*Payload, error) {
 			Value: op.Memo,
 		})
 	}
+	if event.Exchange != nil {
+		attachment.Fields = append(attachment.Fields, &Field{
+			Title: "Exchange",
+			Value: event.Exchange.Describe(),
+		})
+	}
+	if event.RoundTrip != nil {
+		attachment.Fields = append(attachment.Fields, &Field{
+			Title: "Round trip",
+			Value: event.RoundTrip.Describe(),
+		})
+	}
 	return makeMessage(attachment), nil
 }
 
 // UserMentioned
 
-func renderUserMentionedEvent(event *events.UserMentioned) (*Payload, error) {
+func renderUserMentionedEvent(lb *links.Builder, event *events.UserMentioned) (*Payload, error) {
 	c := event.Content
 
-	txt := fmt.Sprintf("@%v was <https://steemit.com%v|mentioned> by @%v in %v",
-		event.User, c.URL, c.Author, c.Permlink)
+	txt := fmt.Sprintf("@%v was <%v|mentioned> by @%v in %v",
+		event.User, lb.Content(c.URL), c.Author, c.Permlink)
 
 	return &Payload{
 		Text: txt,
@@ -137,7 +150,7 @@ func renderUserMentionedEvent(event *events.UserMentioned) (*Payload, error) {
 
 // UserFollowStatusChanged
 
-func renderUserFollowStatusChangedEvent(event *events.UserFollowStatusChanged) (*Payload, error) {
+func renderUserFollowStatusChangedEvent(lb *links.Builder, event *events.UserFollowStatusChanged) (*Payload, error) {
 	op := event.Op
 
 	var txt string
@@ -157,7 +170,7 @@ func renderUserFollowStatusChangedEvent(event *events.UserFollowStatusChanged) (
 
 // StoryPublished
 
-func renderStoryPublishedEvent(event *events.StoryPublished) (*Payload, error) {
+func renderStoryPublishedEvent(lb *links.Builder, event *events.StoryPublished) (*Payload, error) {
 	c := event.Content
 	r := bufio.NewReader(strings.NewReader(c.Body))
 
@@ -173,11 +186,11 @@ func renderStoryPublishedEvent(event *events.StoryPublished) (*Payload, error) {
 	}
 
 	return makeMessage(&Attachment{
-		Fallback:  fmt.Sprintf(`@%v has published "%v".`, c.Author, c.Title),
-		Color:     "#00C957",
-		Pretext:   fmt.Sprintf("@%v has published or updated a story.", c.Author),
+		Fallback:  fmt.Sprintf(`@%v has %v "%v".`, c.Author, event.Verb(), c.Title),
+		Color:     events.DisplayOf(event).Color,
+		Pretext:   fmt.Sprintf("@%v has %v a story.", c.Author, event.Verb()),
 		Title:     c.Title,
-		TitleLink: "https://steemit.com" + c.URL,
+		TitleLink: lb.Content(c.URL),
 		Fields: []*Field{
 			{
 				Title: "Summary",
@@ -188,28 +201,28 @@ func renderStoryPublishedEvent(event *events.StoryPublished) (*Payload, error) {
 				Value: fmt.Sprintf("%v", c.JsonMetadata.Tags),
 			},
 		},
-		ThumbURL: "https://steemit.com/images/favicons/favicon-96x96.png",
+		ThumbURL: lb.Favicon(),
 	}), nil
 }
 
 // StoryVoted
 
-func renderStoryVotedEvent(event *events.StoryVoted) (*Payload, error) {
+func renderStoryVotedEvent(lb *links.Builder, event *events.StoryVoted) (*Payload, error) {
 	o := event.Op
 	c := event.Content
 
-	evt := fmt.Sprintf("@%v cast a vote on a story by @%v.", o.Voter, o.Author)
+	evt := fmt.Sprintf("@%v %v on a story by @%v.", o.Voter, event.Verb(), o.Author)
 
 	return makeMessage(&Attachment{
 		Fallback:  evt,
-		Color:     "#BDFCC9",
+		Color:     events.DisplayOf(event).Color,
 		Pretext:   evt,
 		Title:     c.Title,
-		TitleLink: "https://steemit.com" + c.URL,
+		TitleLink: lb.Content(c.URL),
 		Fields: []*Field{
 			{
 				Title: "Vote Weight",
-				Value: fmt.Sprintf("%v", o.Weight),
+				Value: event.WeightText(),
 				Short: true,
 			},
 			{
@@ -223,7 +236,7 @@ func renderStoryVotedEvent(event *events.StoryVoted) (*Payload, error) {
 
 // CommentPublished
 
-func renderCommentPublishedEvent(event *events.CommentPublished) (*Payload, error) {
+func renderCommentPublishedEvent(lb *links.Builder, event *events.CommentPublished) (*Payload, error) {
 	c := event.Content
 
 	commentLines := make([]string, 0, 5)
@@ -242,16 +255,16 @@ func renderCommentPublishedEvent(event *events.CommentPublished) (*Payload, erro
 
 	extract := strings.Join(extractLines, "\n")
 	if len(commentLines) > 5 {
-		extract += fmt.Sprintf("\n<https://steemit.com%v|Read more...>", c.URL)
+		extract += fmt.Sprintf("\n<%v|Read more...>", lb.Content(c.URL))
 	}
 
 	evt := fmt.Sprintf("@%v commented on @%v/%v", c.Author, c.ParentAuthor, c.ParentPermlink)
-	pre := fmt.Sprintf("@%v <https://steemit.com%v|commented> on @%v/%v",
-		c.Author, c.URL, c.ParentAuthor, c.ParentPermlink)
+	pre := fmt.Sprintf("@%v <%v|commented> on @%v/%v",
+		c.Author, lb.Content(c.URL), c.ParentAuthor, c.ParentPermlink)
 
 	return makeMessage(&Attachment{
 		Fallback: evt,
-		Color:    "#FF9912",
+		Color:    events.DisplayOf(event).Color,
 		Pretext:  pre,
 		Fields: []*Field{
 			{
@@ -264,22 +277,22 @@ func renderCommentPublishedEvent(event *events.CommentPublished) (*Payload, erro
 
 // CommentVoted
 
-func renderCommentVotedEvent(event *events.CommentVoted) (*Payload, error) {
+func renderCommentVotedEvent(lb *links.Builder, event *events.CommentVoted) (*Payload, error) {
 	o := event.Op
 	c := event.Content
 
-	evt := fmt.Sprintf("@%v cast a vote on comment @%v/%v", o.Voter, o.Author, o.Permlink)
+	evt := fmt.Sprintf("@%v %v on comment @%v/%v", o.Voter, event.Verb(), o.Author, o.Permlink)
 
 	return makeMessage(&Attachment{
 		Fallback:  evt,
-		Color:     "#FFEBCD",
+		Color:     events.DisplayOf(event).Color,
 		Pretext:   evt,
 		Title:     fmt.Sprintf("@%v/%v", c.Author, c.Permlink),
-		TitleLink: "https://steemit.com" + c.URL,
+		TitleLink: lb.Content(c.URL),
 		Fields: []*Field{
 			{
 				Title: "Vote Weight",
-				Value: fmt.Sprintf("%v", o.Weight),
+				Value: event.WeightText(),
 				Short: true,
 			},
 			{
@@ -290,3 +303,324 @@ func renderCommentVotedEvent(event *events.CommentVoted) (*Payload, error) {
 		},
 	}), nil
 }
+
+// AccountCreationTokenClaimed
+
+func renderAccountCreationTokenClaimedEvent(
+	lb *links.Builder,
+	event *events.AccountCreationTokenClaimed,
+) (*Payload, error) {
+
+	payment := event.Op.Fee
+	if event.PaidWithRC() {
+		payment = "resource credits"
+	}
+
+	summary := fmt.Sprintf("@%v claimed an account creation token", event.Op.Creator)
+
+	return makeMessage(&Attachment{
+		Title:    "Account Creation Token Claimed",
+		Fallback: summary,
+		Color:    events.DisplayOf(event).Color,
+		Text:     summary,
+		Fields: []*Field{
+			{
+				Title: "Paid With",
+				Value: payment,
+				Short: true,
+			},
+		},
+	}), nil
+}
+
+// PayoutApproaching
+
+func renderPayoutApproachingEvent(lb *links.Builder, event *events.PayoutApproaching) (*Payload, error) {
+	c := event.Content
+
+	evt := fmt.Sprintf("A story by @%v is going to be paid out in %v.", c.Author, event.TimeLeft())
+
+	return makeMessage(&Attachment{
+		Fallback:  evt,
+		Color:     events.DisplayOf(event).Color,
+		Pretext:   evt,
+		Title:     c.Title,
+		TitleLink: lb.Content(c.URL),
+		Fields: []*Field{
+			{
+				Title: "Story Pending Payout",
+				Value: c.PendingPayoutValue,
+				Short: true,
+			},
+		},
+	}), nil
+}
+
+// PostPaidOut
+
+func renderPostPaidOutEvent(lb *links.Builder, event *events.PostPaidOut) (*Payload, error) {
+	c := event.Content
+
+	evt := fmt.Sprintf("A story by @%v has been paid out.", c.Author)
+
+	return makeMessage(&Attachment{
+		Fallback:  evt,
+		Color:     events.DisplayOf(event).Color,
+		Pretext:   evt,
+		Title:     c.Title,
+		TitleLink: lb.Content(c.URL),
+		Fields: []*Field{
+			{
+				Title: "Total Payout",
+				Value: c.TotalPayoutValue,
+				Short: true,
+			},
+			{
+				Title: "Curator Payout",
+				Value: event.CuratorPayout,
+				Short: true,
+			},
+		},
+	}), nil
+}
+
+// WitnessPropertiesSet
+
+func renderWitnessPropertiesSetEvent(lb *links.Builder, event *events.WitnessPropertiesSet) (*Payload, error) {
+	summary := fmt.Sprintf("Witness @%v updated its properties", event.Op.Owner)
+
+	fields := make([]*Field, 0, len(event.Properties))
+	for _, prop := range event.Properties {
+		fields = append(fields, &Field{
+			Title: prop.Key,
+			Value: prop.Value,
+			Short: len(prop.Value) < 40,
+		})
+	}
+
+	return makeMessage(&Attachment{
+		Title:    "Witness Properties Updated",
+		Fallback: summary,
+		Color:    events.DisplayOf(event).Color,
+		Text:     summary,
+		Fields:   fields,
+	}), nil
+}
+
+// BlockProductionRewardReceived
+
+func renderBlockProductionRewardReceivedEvent(
+	lb *links.Builder,
+	event *events.BlockProductionRewardReceived,
+) (*Payload, error) {
+
+	var summary string
+	if event.Aggregated() {
+		summary = fmt.Sprintf("Witness @%v produced %v blocks on %v, earning %v",
+			event.Op.Producer, event.Blocks, event.Day, event.Op.VestingShares)
+	} else {
+		summary = fmt.Sprintf("Witness @%v produced a block, earning %v",
+			event.Op.Producer, event.Op.VestingShares)
+	}
+
+	return makeMessage(&Attachment{
+		Title:    "Block Production Reward",
+		Fallback: summary,
+		Color:    events.DisplayOf(event).Color,
+		Text:     summary,
+	}), nil
+}
+
+// CommunitySubscriptionChanged
+
+func renderCommunitySubscriptionChangedEvent(
+	lb *links.Builder,
+	event *events.CommunitySubscriptionChanged,
+) (*Payload, error) {
+
+	verb := "unsubscribed from"
+	if event.Subscribed() {
+		verb = "subscribed to"
+	}
+	summary := fmt.Sprintf("@%v %v community %v", event.Op.Account, verb, event.Op.Community)
+
+	return makeMessage(&Attachment{
+		Title:     "Community Subscription",
+		TitleLink: lb.Account(event.Op.Account),
+		Fallback:  summary,
+		Color:     events.DisplayOf(event).Color,
+		Text:      summary,
+	}), nil
+}
+
+// CommunityRoleChanged
+
+func renderCommunityRoleChangedEvent(
+	lb *links.Builder,
+	event *events.CommunityRoleChanged,
+) (*Payload, error) {
+
+	summary := fmt.Sprintf("@%v set the role of @%v in community %v to %v",
+		event.Op.Account, event.Op.Target, event.Op.Community, event.Op.Role)
+
+	return makeMessage(&Attachment{
+		Title:     "Community Role Changed",
+		TitleLink: lb.Account(event.Op.Target),
+		Fallback:  summary,
+		Color:     events.DisplayOf(event).Color,
+		Text:      summary,
+	}), nil
+}
+
+// NewPayerDetected
+
+func renderNewPayerDetectedEvent(lb *links.Builder, event *events.NewPayerDetected) (*Payload, error) {
+	op := event.Op
+
+	summary := fmt.Sprintf("New payer @%v transferred %v to @%v", op.From, op.Amount, op.To)
+
+	attachment := &Attachment{
+		Title:     "New Payer",
+		TitleLink: lb.Account(op.From),
+		Fallback:  summary,
+		Color:     events.DisplayOf(event).Color,
+		Text:      summary,
+	}
+	if op.Memo != "" {
+		attachment.Fields = []*Field{
+			{
+				Title: "Memo",
+				Value: op.Memo,
+			},
+		}
+	}
+	return makeMessage(attachment), nil
+}
+
+// CustomJSONBroadcast
+
+func renderCustomJSONBroadcastEvent(lb *links.Builder, event *events.CustomJSONBroadcast) (*Payload, error) {
+	summary := fmt.Sprintf("custom_json %v broadcast by @%v", event.Op.ID, event.Account())
+
+	return makeMessage(&Attachment{
+		Title:    "Custom JSON",
+		Fallback: summary,
+		Color:    events.DisplayOf(event).Color,
+		Pretext:  summary,
+		Text:     "```" + events.Excerpt(event.Op.JSON, events.CustomJSONExcerptLength) + "```",
+	}), nil
+}
+
+// AccountCreated
+
+func renderAccountCreatedEvent(lb *links.Builder, event *events.AccountCreated) (*Payload, error) {
+	op := event.Op
+
+	summary := fmt.Sprintf("@%v created account @%v", op.Creator, op.NewAccountName)
+
+	return makeMessage(&Attachment{
+		Title:     "Account Created",
+		TitleLink: lb.Account(op.NewAccountName),
+		Fallback:  summary,
+		Color:     events.DisplayOf(event).Color,
+		Text:      summary,
+		Fields: []*Field{
+			{
+				Title: "Fee",
+				Value: op.Fee,
+				Short: true,
+			},
+			{
+				Title: "Delegation",
+				Value: op.Delegation,
+				Short: true,
+			},
+		},
+	}), nil
+}
+
+// AccountActivity
+
+func renderAccountActivityEvent(lb *links.Builder, event *events.AccountActivity) (*Payload, error) {
+	summary := fmt.Sprintf("%v operation by @%v", event.OpType, strings.Join(event.Accounts, ", @"))
+
+	return makeMessage(&Attachment{
+		Title:    "Account Activity",
+		Fallback: summary,
+		Color:    events.DisplayOf(event).Color,
+		Text:     summary,
+		Fields: []*Field{
+			{
+				Title: "Operation",
+				Value: event.Excerpt(),
+			},
+		},
+	}), nil
+}
+
+// RCDelegated
+
+func renderRCDelegatedEvent(lb *links.Builder, event *events.RCDelegated) (*Payload, error) {
+	op := event.Op
+
+	summary := fmt.Sprintf("@%v delegated %v RC to @%v", op.Delegator, op.MaxRC, op.Delegatee)
+
+	return makeMessage(&Attachment{
+		Title:     "RC Delegated",
+		TitleLink: lb.Account(op.Delegatee),
+		Fallback:  summary,
+		Color:     events.DisplayOf(event).Color,
+		Text:      summary,
+	}), nil
+}
+
+// RCDelegationRemoved
+
+func renderRCDelegationRemovedEvent(lb *links.Builder, event *events.RCDelegationRemoved) (*Payload, error) {
+	op := event.Op
+
+	summary := fmt.Sprintf("@%v removed the RC delegation to @%v", op.Delegator, op.Delegatee)
+
+	return makeMessage(&Attachment{
+		Title:     "RC Delegation Removed",
+		TitleLink: lb.Account(op.Delegatee),
+		Fallback:  summary,
+		Color:     events.DisplayOf(event).Color,
+		Text:      summary,
+	}), nil
+}
+
+// WitnessFeedStale
+
+func renderWitnessFeedStaleEvent(lb *links.Builder, event *events.WitnessFeedStale) (*Payload, error) {
+	summary := fmt.Sprintf("Witness @%v has not published the price feed for %v", event.Witness, event.Age())
+
+	return makeMessage(&Attachment{
+		Title:     "Stale Price Feed",
+		TitleLink: lb.Account(event.Witness),
+		Fallback:  summary,
+		Color:     events.DisplayOf(event).Color,
+		Text:      summary,
+		Fields: []*Field{
+			{
+				Title: "Last Published",
+				Value: event.LastPublish.UTC().Format("Jan 2 15:04 MST"),
+				Short: true,
+			},
+		},
+	}), nil
+}
+
+// WitnessFeedRecovered
+
+func renderWitnessFeedRecoveredEvent(lb *links.Builder, event *events.WitnessFeedRecovered) (*Payload, error) {
+	summary := fmt.Sprintf("Witness @%v published the price feed again after %v", event.Witness, event.Stale())
+
+	return makeMessage(&Attachment{
+		Title:     "Price Feed Recovered",
+		TitleLink: lb.Account(event.Witness),
+		Fallback:  summary,
+		Color:     events.DisplayOf(event).Color,
+		Text:      summary,
+	}), nil
+}
@@ -0,0 +1,106 @@
+package steemitchat
+
+import (
+	"fmt"
+
+	"github.com/tchap/steemwatch/links"
+	"github.com/tchap/steemwatch/notifications/events"
+
+	"github.com/pkg/errors"
+)
+
+// renderEvent renders any of the supported events.
+func renderEvent(lb *links.Builder, event interface{}) (*Payload, error) {
+	switch event := event.(type) {
+	case *events.AccountUpdated:
+		return renderAccountUpdatedEvent(lb, event)
+	case *events.AccountWitnessVoted:
+		return renderAccountWitnessVotedEvent(lb, event)
+	case *events.TransferMade:
+		return renderTransferMadeEvent(lb, event)
+	case *events.UserMentioned:
+		return renderUserMentionedEvent(lb, event)
+	case *events.UserFollowStatusChanged:
+		return renderUserFollowStatusChangedEvent(lb, event)
+	case *events.StoryPublished:
+		return renderStoryPublishedEvent(lb, event)
+	case *events.StoryVoted:
+		return renderStoryVotedEvent(lb, event)
+	case *events.CommentPublished:
+		return renderCommentPublishedEvent(lb, event)
+	case *events.CommentVoted:
+		return renderCommentVotedEvent(lb, event)
+	case *events.AccountCreationTokenClaimed:
+		return renderAccountCreationTokenClaimedEvent(lb, event)
+	case *events.PayoutApproaching:
+		return renderPayoutApproachingEvent(lb, event)
+	case *events.PostPaidOut:
+		return renderPostPaidOutEvent(lb, event)
+	case *events.WitnessPropertiesSet:
+		return renderWitnessPropertiesSetEvent(lb, event)
+	case *events.BlockProductionRewardReceived:
+		return renderBlockProductionRewardReceivedEvent(lb, event)
+	case *events.CommunitySubscriptionChanged:
+		return renderCommunitySubscriptionChangedEvent(lb, event)
+	case *events.CommunityRoleChanged:
+		return renderCommunityRoleChangedEvent(lb, event)
+	case *events.NewPayerDetected:
+		return renderNewPayerDetectedEvent(lb, event)
+	case *events.CustomJSONBroadcast:
+		return renderCustomJSONBroadcastEvent(lb, event)
+	case *events.AccountCreated:
+		return renderAccountCreatedEvent(lb, event)
+	case *events.AccountActivity:
+		return renderAccountActivityEvent(lb, event)
+	case *events.RCDelegated:
+		return renderRCDelegatedEvent(lb, event)
+	case *events.RCDelegationRemoved:
+		return renderRCDelegationRemovedEvent(lb, event)
+	case *events.WitnessFeedStale:
+		return renderWitnessFeedStaleEvent(lb, event)
+	case *events.WitnessFeedRecovered:
+		return renderWitnessFeedRecoveredEvent(lb, event)
+	default:
+		return nil, errors.Errorf("unknown event type: %T", event)
+	}
+}
+
+// renderDigest puts the messages rendered for the events into a single message.
+func renderDigest(lb *links.Builder, digest *events.Digest) (*Payload, error) {
+	payload := &Payload{
+		Text: fmt.Sprintf("%v events since %v", len(digest.Events),
+			digest.Since.UTC().Format("Jan 2 15:04 MST")),
+	}
+
+	for _, event := range digest.Events {
+		msg, err := renderEvent(lb, event)
+		if err != nil {
+			return nil, err
+		}
+		if msg.Text != "" {
+			payload.Attachments = append(payload.Attachments, &Attachment{
+				Fallback: msg.Text,
+				Text:     msg.Text,
+			})
+		}
+		payload.Attachments = append(payload.Attachments, msg.Attachments...)
+	}
+	return payload, nil
+}
+
+// renderDailySummary renders the daily summary as a single attachment, one field per section.
+func renderDailySummary(lb *links.Builder, summary *events.DailySummary) (*Payload, error) {
+	text := fmt.Sprintf("Daily summary for %v: %v events", summary.Day, summary.Events)
+	attachment := &Attachment{
+		Fallback: text,
+		Title:    "Daily Summary",
+		Text:     text,
+	}
+	for _, part := range summary.Parts() {
+		attachment.Fields = append(attachment.Fields, &Field{
+			Title: part.Title,
+			Value: part.Text,
+		})
+	}
+	return makeMessage(attachment), nil
+}
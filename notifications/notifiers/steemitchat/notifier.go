@@ -6,7 +6,9 @@ import (
 	"time"
 
 	"github.com/tchap/steemwatch/errs"
+	"github.com/tchap/steemwatch/links"
 	"github.com/tchap/steemwatch/notifications/events"
+	"github.com/tchap/steemwatch/notifications/notifiers/truncate"
 
 	"github.com/pkg/errors"
 	"github.com/valyala/fasthttp"
@@ -15,6 +17,10 @@ import (
 
 const DefaultMaxConcurrentRequests = 1000
 
+// DefaultMaxMessageLength is the default length limit of the attachment texts and field values.
+// Rocket.Chat, which steemit.chat runs, rejects the messages over its size limit.
+const DefaultMaxMessageLength = 3000
+
 const postMessageEndpointURL = "https://steemit.chat/api/v1/chat.postMessage"
 
 //
@@ -61,9 +67,14 @@ type Notifier struct {
 	daemonAuthToken string
 
 	webhookTimeout        time.Duration
+	links                 *links.Builder
 	maxConcurrentRequests uint
 	requestSemaphore      chan struct{}
+	maxMessageLength      uint
 	termCh                chan struct{}
+
+	// matchedBy is only set on the views returned by MatchedBy.
+	matchedBy string
 }
 
 func NewNotifier(daemonUserID string, daemonAuthToken string, opts ...NotifierOption) *Notifier {
@@ -71,7 +82,9 @@ func NewNotifier(daemonUserID string, daemonAuthToken string, opts ...NotifierOp
 		daemonUserID:          daemonUserID,
 		daemonAuthToken:       daemonAuthToken,
 		webhookTimeout:        30 * time.Second,
+		links:                 links.MustNewBuilder(links.DefaultBaseURL),
 		maxConcurrentRequests: DefaultMaxConcurrentRequests,
+		maxMessageLength:      DefaultMaxMessageLength,
 		termCh:                make(chan struct{}),
 	}
 
@@ -86,6 +99,20 @@ func NewNotifier(daemonUserID string, daemonAuthToken string, opts ...NotifierOp
 
 type NotifierOption func(*Notifier)
 
+func SetLinkBuilder(lb *links.Builder) NotifierOption {
+	return func(notifier *Notifier) {
+		notifier.links = lb
+	}
+}
+
+// SetMaxMessageLength sets the maximum number of characters in an attachment text
+// or a field value. The longer ones are cut, the attachment title links to the full content.
+func SetMaxMessageLength(length uint) NotifierOption {
+	return func(notifier *Notifier) {
+		notifier.maxMessageLength = length
+	}
+}
+
 func SetWebhookTimeout(timeout time.Duration) NotifierOption {
 	return func(notifier *Notifier) {
 		notifier.webhookTimeout = timeout
@@ -104,7 +131,7 @@ func (notifier *Notifier) DispatchAccountUpdatedEvent(
 	event *events.AccountUpdated,
 ) error {
 	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
-		return renderAccountUpdatedEvent(event)
+		return renderAccountUpdatedEvent(notifier.links, event)
 	})
 }
 
@@ -114,7 +141,7 @@ func (notifier *Notifier) DispatchAccountWitnessVotedEvent(
 	event *events.AccountWitnessVoted,
 ) error {
 	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
-		return renderAccountWitnessVotedEvent(event)
+		return renderAccountWitnessVotedEvent(notifier.links, event)
 	})
 }
 
@@ -124,7 +151,7 @@ func (notifier *Notifier) DispatchTransferMadeEvent(
 	event *events.TransferMade,
 ) error {
 	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
-		return renderTransferMadeEvent(event)
+		return renderTransferMadeEvent(notifier.links, event)
 	})
 }
 
@@ -134,7 +161,7 @@ func (notifier *Notifier) DispatchUserMentionedEvent(
 	event *events.UserMentioned,
 ) error {
 	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
-		return renderUserMentionedEvent(event)
+		return renderUserMentionedEvent(notifier.links, event)
 	})
 }
 
@@ -144,7 +171,7 @@ func (notifier *Notifier) DispatchUserFollowStatusChangedEvent(
 	event *events.UserFollowStatusChanged,
 ) error {
 	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
-		return renderUserFollowStatusChangedEvent(event)
+		return renderUserFollowStatusChangedEvent(notifier.links, event)
 	})
 }
 
@@ -154,7 +181,7 @@ func (notifier *Notifier) DispatchStoryPublishedEvent(
 	event *events.StoryPublished,
 ) error {
 	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
-		return renderStoryPublishedEvent(event)
+		return renderStoryPublishedEvent(notifier.links, event)
 	})
 }
 
@@ -164,7 +191,7 @@ func (notifier *Notifier) DispatchStoryVotedEvent(
 	event *events.StoryVoted,
 ) error {
 	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
-		return renderStoryVotedEvent(event)
+		return renderStoryVotedEvent(notifier.links, event)
 	})
 }
 
@@ -174,7 +201,7 @@ func (notifier *Notifier) DispatchCommentPublishedEvent(
 	event *events.CommentPublished,
 ) error {
 	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
-		return renderCommentPublishedEvent(event)
+		return renderCommentPublishedEvent(notifier.links, event)
 	})
 }
 
@@ -184,10 +211,206 @@ func (notifier *Notifier) DispatchCommentVotedEvent(
 	event *events.CommentVoted,
 ) error {
 	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
-		return renderCommentVotedEvent(event)
+		return renderCommentVotedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchAccountCreationTokenClaimedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.AccountCreationTokenClaimed,
+) error {
+	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
+		return renderAccountCreationTokenClaimedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchPayoutApproachingEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.PayoutApproaching,
+) error {
+	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
+		return renderPayoutApproachingEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchPostPaidOutEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.PostPaidOut,
+) error {
+	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
+		return renderPostPaidOutEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchWitnessPropertiesSetEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.WitnessPropertiesSet,
+) error {
+	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
+		return renderWitnessPropertiesSetEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchBlockProductionRewardReceivedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.BlockProductionRewardReceived,
+) error {
+	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
+		return renderBlockProductionRewardReceivedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchCommunitySubscriptionChangedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.CommunitySubscriptionChanged,
+) error {
+	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
+		return renderCommunitySubscriptionChangedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchCommunityRoleChangedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.CommunityRoleChanged,
+) error {
+	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
+		return renderCommunityRoleChangedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchNewPayerDetectedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.NewPayerDetected,
+) error {
+	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
+		return renderNewPayerDetectedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchCustomJSONBroadcastEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.CustomJSONBroadcast,
+) error {
+	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
+		return renderCustomJSONBroadcastEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchAccountCreatedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.AccountCreated,
+) error {
+	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
+		return renderAccountCreatedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchAccountActivityEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.AccountActivity,
+) error {
+	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
+		return renderAccountActivityEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchRCDelegatedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.RCDelegated,
+) error {
+	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
+		return renderRCDelegatedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchRCDelegationRemovedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.RCDelegationRemoved,
+) error {
+	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
+		return renderRCDelegationRemovedEvent(notifier.links, event)
 	})
 }
 
+func (notifier *Notifier) DispatchWitnessFeedStaleEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.WitnessFeedStale,
+) error {
+	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
+		return renderWitnessFeedStaleEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchWitnessFeedRecoveredEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.WitnessFeedRecovered,
+) error {
+	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
+		return renderWitnessFeedRecoveredEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchDigest(
+	userId string,
+	userSettings bson.Raw,
+	digest *events.Digest,
+) error {
+	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
+		return renderDigest(notifier.links, digest)
+	})
+}
+
+func (notifier *Notifier) DispatchDailySummary(
+	userId string,
+	userSettings bson.Raw,
+	summary *events.DailySummary,
+) error {
+	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
+		return renderDailySummary(notifier.links, summary)
+	})
+}
+
+// DispatchTitled renders the event using the given attachment title.
+func (notifier *Notifier) DispatchTitled(
+	userId string,
+	userSettings bson.Raw,
+	event interface{},
+	title string,
+) error {
+	return notifier.dispatch(userId, userSettings, func() (*Payload, error) {
+		payload, err := renderEvent(notifier.links, event)
+		if err != nil {
+			return nil, err
+		}
+		if len(payload.Attachments) != 0 && title != "" {
+			payload.Attachments[0].Title = title
+		}
+		return payload, nil
+	})
+}
+
+// MatchedBy returns a view of the notifier that puts the reason into the footer of the message.
+func (notifier *Notifier) MatchedBy(reason string) interface{} {
+	view := *notifier
+	view.matchedBy = reason
+	return &view
+}
+
 func (notifier *Notifier) dispatch(
 	userId string,
 	userSettings bson.Raw,
@@ -202,12 +425,27 @@ func (notifier *Notifier) dispatch(
 	if err != nil {
 		return err
 	}
+	if notifier.matchedBy != "" && len(payload.Attachments) != 0 {
+		payload.Attachments[len(payload.Attachments)-1].Footer = "Matched by " + notifier.matchedBy
+	}
+	notifier.fit(payload)
 
 	payload.Channel = "@" + settings.Username
 
 	return notifier.send(payload)
 }
 
+// fit cuts the attachment texts and the field values to the length limit.
+func (notifier *Notifier) fit(payload *Payload) {
+	limit := int(notifier.maxMessageLength)
+	for _, attachment := range payload.Attachments {
+		attachment.Text = truncate.Fit(attachment.Text, limit, "")
+		for _, field := range attachment.Fields {
+			field.Value = truncate.Fit(field.Value, limit, "")
+		}
+	}
+}
+
 func (notifier *Notifier) send(payload *Payload) error {
 	// Acquire a request slot.
 	select {
@@ -235,7 +473,7 @@ func (notifier *Notifier) send(payload *Payload) error {
 	}
 
 	req.Header.SetMethod("POST")
-	req.Header.SetContentType("application/json")
+	req.Header.SetContentType("application/json; charset=utf-8")
 	req.Header.Set("X-User-Id", notifier.daemonUserID)
 	req.Header.Set("X-Auth-Token", notifier.daemonAuthToken)
 	req.SetRequestURI(postMessageEndpointURL)
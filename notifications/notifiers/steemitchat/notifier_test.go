@@ -0,0 +1,45 @@
+package steemitchat
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/tchap/steemwatch/notifications/events"
+
+	"github.com/go-steem/rpc/apis/database"
+)
+
+// TestFit checks that the attachment fields are cut as well, not just the text.
+// The cutting as such is tested in the truncate package.
+func TestFit(t *testing.T) {
+	const limit = 300
+	event := &events.CommentPublished{
+		Content: &database.Content{
+			Author:         "alice",
+			ParentAuthor:   "bob",
+			ParentPermlink: "a-story",
+			URL:            "/steem/@bob/a-story#@alice/re-a-story",
+			Body:           strings.Repeat("a line of the comment ", 100),
+		},
+	}
+
+	notifier := NewNotifier("daemon", "token", SetMaxMessageLength(limit))
+
+	payload, err := renderCommentPublishedEvent(notifier.links, event)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	notifier.fit(payload)
+
+	for _, attachment := range payload.Attachments {
+		if n := utf8.RuneCountInString(attachment.Text); n > limit {
+			t.Errorf("got %v characters of the attachment text, limit %v", n, limit)
+		}
+		for _, field := range attachment.Fields {
+			if !strings.HasSuffix(field.Value, "…") {
+				t.Errorf("%v not cut: %q", field.Title, field.Value)
+			}
+		}
+	}
+}
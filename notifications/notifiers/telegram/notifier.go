@@ -1,8 +1,12 @@
 package telegram
 
 import (
+	"strings"
+
 	"github.com/tchap/steemwatch/errs"
+	"github.com/tchap/steemwatch/links"
 	"github.com/tchap/steemwatch/notifications/events"
+	"github.com/tchap/steemwatch/notifications/notifiers/truncate"
 	"github.com/tchap/steemwatch/server/routes/api/notifiers/telegram"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
@@ -12,21 +16,32 @@ import (
 
 const DefaultMaxConcurrentRequests = 1000
 
+// DefaultMaxMessageLength is the default length limit of the messages.
+// Telegram rejects the longer messages.
+const DefaultMaxMessageLength = 4096
+
 //
 // Notifier
 //
 
 type Notifier struct {
 	bot                   *tgbotapi.BotAPI
+	links                 *links.Builder
 	maxConcurrentRequests uint
 	requestSemaphore      chan struct{}
+	maxMessageLength      uint
 	termCh                chan struct{}
+
+	// matchedBy is only set on the views returned by MatchedBy.
+	matchedBy string
 }
 
 func NewNotifier(bot *tgbotapi.BotAPI, opts ...NotifierOption) *Notifier {
 	notifier := &Notifier{
-		bot: bot,
+		bot:                   bot,
+		links:                 links.MustNewBuilder(links.DefaultBaseURL),
 		maxConcurrentRequests: DefaultMaxConcurrentRequests,
+		maxMessageLength:      DefaultMaxMessageLength,
 		termCh:                make(chan struct{}),
 	}
 
@@ -41,6 +56,20 @@ func NewNotifier(bot *tgbotapi.BotAPI, opts ...NotifierOption) *Notifier {
 
 type NotifierOption func(*Notifier)
 
+func SetLinkBuilder(lb *links.Builder) NotifierOption {
+	return func(notifier *Notifier) {
+		notifier.links = lb
+	}
+}
+
+// SetMaxMessageLength sets the maximum number of characters in a message.
+// The longer messages are cut and the link to the full content is appended.
+func SetMaxMessageLength(length uint) NotifierOption {
+	return func(notifier *Notifier) {
+		notifier.maxMessageLength = length
+	}
+}
+
 func SetMaxConcurrentRequests(maxConcurrentRequests uint) NotifierOption {
 	return func(notifier *Notifier) {
 		notifier.maxConcurrentRequests = maxConcurrentRequests
@@ -52,8 +81,8 @@ func (notifier *Notifier) DispatchAccountUpdatedEvent(
 	userSettings bson.Raw,
 	event *events.AccountUpdated,
 ) error {
-	return notifier.dispatch(userId, userSettings, func() string {
-		return renderAccountUpdatedEvent(event)
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderAccountUpdatedEvent(notifier.links, event)
 	})
 }
 
@@ -62,8 +91,8 @@ func (notifier *Notifier) DispatchAccountWitnessVotedEvent(
 	userSettings bson.Raw,
 	event *events.AccountWitnessVoted,
 ) error {
-	return notifier.dispatch(userId, userSettings, func() string {
-		return renderAccountWitnessVotedEvent(event)
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderAccountWitnessVotedEvent(notifier.links, event)
 	})
 }
 
@@ -72,8 +101,8 @@ func (notifier *Notifier) DispatchTransferMadeEvent(
 	userSettings bson.Raw,
 	event *events.TransferMade,
 ) error {
-	return notifier.dispatch(userId, userSettings, func() string {
-		return renderTransferMadeEvent(event)
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderTransferMadeEvent(notifier.links, event)
 	})
 }
 
@@ -82,8 +111,8 @@ func (notifier *Notifier) DispatchUserMentionedEvent(
 	userSettings bson.Raw,
 	event *events.UserMentioned,
 ) error {
-	return notifier.dispatch(userId, userSettings, func() string {
-		return renderUserMentionedEvent(event)
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderUserMentionedEvent(notifier.links, event)
 	})
 }
 
@@ -92,8 +121,8 @@ func (notifier *Notifier) DispatchUserFollowStatusChangedEvent(
 	userSettings bson.Raw,
 	event *events.UserFollowStatusChanged,
 ) error {
-	return notifier.dispatch(userId, userSettings, func() string {
-		return renderUserFollowStatusChangedEvent(event)
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderUserFollowStatusChangedEvent(notifier.links, event)
 	})
 }
 
@@ -102,8 +131,8 @@ func (notifier *Notifier) DispatchStoryPublishedEvent(
 	userSettings bson.Raw,
 	event *events.StoryPublished,
 ) error {
-	return notifier.dispatch(userId, userSettings, func() string {
-		return renderStoryPublishedEvent(event)
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderStoryPublishedEvent(notifier.links, event)
 	})
 }
 
@@ -112,8 +141,8 @@ func (notifier *Notifier) DispatchStoryVotedEvent(
 	userSettings bson.Raw,
 	event *events.StoryVoted,
 ) error {
-	return notifier.dispatch(userId, userSettings, func() string {
-		return renderStoryVotedEvent(event)
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderStoryVotedEvent(notifier.links, event)
 	})
 }
 
@@ -122,8 +151,8 @@ func (notifier *Notifier) DispatchCommentPublishedEvent(
 	userSettings bson.Raw,
 	event *events.CommentPublished,
 ) error {
-	return notifier.dispatch(userId, userSettings, func() string {
-		return renderCommentPublishedEvent(event)
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderCommentPublishedEvent(notifier.links, event)
 	})
 }
 
@@ -132,14 +161,192 @@ func (notifier *Notifier) DispatchCommentVotedEvent(
 	userSettings bson.Raw,
 	event *events.CommentVoted,
 ) error {
-	return notifier.dispatch(userId, userSettings, func() string {
-		return renderCommentVotedEvent(event)
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderCommentVotedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchAccountCreationTokenClaimedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.AccountCreationTokenClaimed,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderAccountCreationTokenClaimedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchPayoutApproachingEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.PayoutApproaching,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderPayoutApproachingEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchPostPaidOutEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.PostPaidOut,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderPostPaidOutEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchWitnessPropertiesSetEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.WitnessPropertiesSet,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderWitnessPropertiesSetEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchBlockProductionRewardReceivedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.BlockProductionRewardReceived,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderBlockProductionRewardReceivedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchCommunitySubscriptionChangedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.CommunitySubscriptionChanged,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderCommunitySubscriptionChangedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchCommunityRoleChangedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.CommunityRoleChanged,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderCommunityRoleChangedEvent(notifier.links, event)
 	})
 }
 
+func (notifier *Notifier) DispatchNewPayerDetectedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.NewPayerDetected,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderNewPayerDetectedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchCustomJSONBroadcastEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.CustomJSONBroadcast,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderCustomJSONBroadcastEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchAccountCreatedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.AccountCreated,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderAccountCreatedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchAccountActivityEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.AccountActivity,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderAccountActivityEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchRCDelegatedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.RCDelegated,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderRCDelegatedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchRCDelegationRemovedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.RCDelegationRemoved,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderRCDelegationRemovedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchWitnessFeedStaleEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.WitnessFeedStale,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderWitnessFeedStaleEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchWitnessFeedRecoveredEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.WitnessFeedRecovered,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderWitnessFeedRecoveredEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchDigest(
+	userId string,
+	userSettings bson.Raw,
+	digest *events.Digest,
+) error {
+	return notifier.dispatch(userId, userSettings, digest, func() string {
+		return renderDigest(notifier.links, digest)
+	})
+}
+
+func (notifier *Notifier) DispatchDailySummary(
+	userId string,
+	userSettings bson.Raw,
+	summary *events.DailySummary,
+) error {
+	return notifier.dispatch(userId, userSettings, summary, func() string {
+		return renderDailySummary(notifier.links, summary)
+	})
+}
+
+// MatchedBy returns a view of the notifier that appends the reason to the messages.
+func (notifier *Notifier) MatchedBy(reason string) interface{} {
+	view := *notifier
+	view.matchedBy = reason
+	return &view
+}
+
 func (notifier *Notifier) dispatch(
 	userId string,
 	userSettings bson.Raw,
+	event interface{},
 	render func() string,
 ) error {
 	var settings telegram.Settings
@@ -147,7 +354,16 @@ func (notifier *Notifier) dispatch(
 		return errors.Wrap(err, "failed to unmarshal user settings")
 	}
 
-	return notifier.send(&settings, render())
+	return notifier.send(&settings, notifier.message(event, render()))
+}
+
+// message appends the reason to the rendered text and fits it into the length limit.
+func (notifier *Notifier) message(event interface{}, text string) string {
+	if notifier.matchedBy != "" {
+		text = strings.TrimRight(text, "\n") + "\nMatched by " + markdownEscaper.Replace(notifier.matchedBy) + "\n"
+	}
+	more := markdownEscaper.Replace(truncate.ContentLink(notifier.links, event))
+	return truncate.FitMarkdown(text, int(notifier.maxMessageLength), more)
 }
 
 func (notifier *Notifier) send(settings *telegram.Settings, text string) error {
@@ -177,3 +393,6 @@ func (notifier *Notifier) Close() error {
 		return nil
 	}
 }
+
+// markdownEscaper escapes the characters that have a meaning in Markdown.
+var markdownEscaper = strings.NewReplacer("_", "\\_", "*", "\\*", "`", "\\`", "[", "\\[")
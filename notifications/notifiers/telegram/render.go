@@ -2,14 +2,16 @@ package telegram
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"strings"
 
+	"github.com/tchap/steemwatch/links"
 	"github.com/tchap/steemwatch/notifications/events"
 )
 
-func steemitLink(account string) string {
-	return fmt.Sprintf("[@%v](https://steemit.com/@%v)", account, account)
+func steemitLink(lb *links.Builder, account string) string {
+	return fmt.Sprintf("[@%v](%v)", account, lb.Account(account))
 }
 
 func steemdLink(account string) string {
@@ -18,18 +20,18 @@ func steemdLink(account string) string {
 
 // AccountUpdated
 
-func renderAccountUpdatedEvent(event *events.AccountUpdated) string {
+func renderAccountUpdatedEvent(lb *links.Builder, event *events.AccountUpdated) string {
 	return fmt.Sprintf(`
 <=====>
 Account update detected for %v.
 `,
-		steemitLink(event.Op.Account),
+		steemitLink(lb, event.Op.Account),
 	)
 }
 
 // AccountWitnessVoted
 
-func renderAccountWitnessVotedEvent(event *events.AccountWitnessVoted) string {
+func renderAccountWitnessVotedEvent(lb *links.Builder, event *events.AccountWitnessVoted) string {
 	var verb string
 	if event.Op.Approve {
 		verb = "approved"
@@ -41,57 +43,68 @@ func renderAccountWitnessVotedEvent(event *events.AccountWitnessVoted) string {
 <=====>
 %v %v witness %v.
 `,
-		steemitLink(event.Op.Account),
+		steemitLink(lb, event.Op.Account),
 		verb,
-		steemitLink(event.Op.Witness),
+		steemitLink(lb, event.Op.Witness),
 	)
 }
 
 // TransferMade
 
-func renderTransferMadeEvent(event *events.TransferMade) string {
+func renderTransferMadeEvent(lb *links.Builder, event *events.TransferMade) string {
 	op := event.Op
+
+	var notes string
+	if event.Exchange != nil {
+		notes = "\n" + event.Exchange.Describe() + "."
+	}
+	if event.RoundTrip != nil {
+		notes += "\n" + event.RoundTrip.Describe() + "."
+	}
+
 	if op.Memo != "" {
 		return fmt.Sprintf(`
 <=====>
-%v transferred %v to %v using memo %v.
+%v transferred %v to %v using memo %v.%v
 `,
-			steemitLink(op.From),
+			steemitLink(lb, op.From),
 			op.Amount,
-			steemitLink(op.To),
+			steemitLink(lb, op.To),
 			op.Memo,
+			notes,
 		)
 	}
 	return fmt.Sprintf(
-		"%v transferred %v to %v.",
-		steemitLink(op.From),
+		"%v transferred %v to %v.%v",
+		steemitLink(lb, op.From),
 		op.Amount,
-		steemitLink(op.To),
+		steemitLink(lb, op.To),
+		notes,
 	)
 }
 
 // UserMentioned
 
-func renderUserMentionedEvent(event *events.UserMentioned) string {
+func renderUserMentionedEvent(lb *links.Builder, event *events.UserMentioned) string {
 	c := event.Content
 	return fmt.Sprintf(`
 <=====>
 %v was [mentioned](%v) by %v in %v.
 `,
-		steemitLink(event.User),
-		c.URL,
-		steemitLink(c.Author),
+		steemitLink(lb, event.User),
+		lb.Content(c.URL),
+		steemitLink(lb, c.Author),
 		c.Permlink,
 	)
 }
 
 // UserFollowStatusChanged
 
-func renderUserFollowStatusChangedEvent(event *events.UserFollowStatusChanged) string {
+func renderUserFollowStatusChangedEvent(lb *links.Builder, event *events.UserFollowStatusChanged) string {
 	op := event.Op
 
-	follower := steemitLink(op.Follower)
-	following := steemitLink(op.Following)
+	follower := steemitLink(lb, op.Follower)
+	following := steemitLink(lb, op.Following)
 
 	var text string
 	switch {
@@ -108,22 +121,23 @@ func renderUserFollowStatusChangedEvent(event *events.UserFollowStatusChanged) s
 
 // StoryPublished
 
-func renderStoryPublishedEvent(event *events.StoryPublished) string {
+func renderStoryPublishedEvent(lb *links.Builder, event *events.StoryPublished) string {
 	c := event.Content
 
 	summary, _ := bufio.NewReader(strings.NewReader(c.Body)).ReadString('\n')
 
 	return fmt.Sprintf(`
 <=====>
-%v has published or updated a [story](https://steemit.com%v).
+%v has %v a [story](%v).
 
 *Title:* %v
 
 *Summary:* %v
 *Tags:* %v
 `,
-		steemitLink(c.Author),
-		c.URL,
+		steemitLink(lb, c.Author),
+		event.Verb(),
+		lb.Content(c.URL),
 		c.Title,
 		summary,
 		c.JsonMetadata.Tags,
@@ -132,30 +146,31 @@ func renderStoryPublishedEvent(event *events.StoryPublished) string {
 
 // StoryVoted
 
-func renderStoryVotedEvent(event *events.StoryVoted) string {
+func renderStoryVotedEvent(lb *links.Builder, event *events.StoryVoted) string {
 	o := event.Op
 	c := event.Content
 
 	return fmt.Sprintf(`
 <=====>
-%v cast a vote on a [story](https://steemit.com%v) by %v.
+%v %v on a [story](%v) by %v.
 
 *Title:* %v
 *Vote weight:* %v
 *Pending Payout:* %v
 `,
-		steemitLink(o.Voter),
-		c.URL,
-		steemitLink(o.Author),
+		steemitLink(lb, o.Voter),
+		event.Verb(),
+		lb.Content(c.URL),
+		steemitLink(lb, o.Author),
 		c.Title,
-		o.Weight,
+		event.WeightText(),
 		c.PendingPayoutValue,
 	)
 }
 
 // CommentPublished
 
-func renderCommentPublishedEvent(event *events.CommentPublished) string {
+func renderCommentPublishedEvent(lb *links.Builder, event *events.CommentPublished) string {
 	c := event.Content
 
 	commentLines := make([]string, 0, 5)
@@ -171,17 +186,17 @@ func renderCommentPublishedEvent(event *events.CommentPublished) string {
 
 	extract := strings.Join(extractLines, "\n")
 	if len(commentLines) > 5 {
-		extract += fmt.Sprintf("\n<https://steemit.com%v|Read more...>", c.URL)
+		extract += fmt.Sprintf("\n<%v|Read more...>", lb.Content(c.URL))
 	}
 
 	return fmt.Sprintf(`
 <=====>
-%v added a [comment](https://steemit.com%v) to @%v/%v.
+%v added a [comment](%v) to @%v/%v.
 
 *Content:* %v
 `,
-		steemitLink(c.Author),
-		c.URL,
+		steemitLink(lb, c.Author),
+		lb.Content(c.URL),
 		c.ParentAuthor,
 		c.ParentPermlink,
 		extract,
@@ -190,21 +205,296 @@ func renderCommentPublishedEvent(event *events.CommentPublished) string {
 
 // CommentVoted
 
-func renderCommentVotedEvent(event *events.CommentVoted) string {
+func renderCommentVotedEvent(lb *links.Builder, event *events.CommentVoted) string {
 	o := event.Op
 	c := event.Content
 
 	return fmt.Sprintf(`
 <=====>
-%v cast a vote on a [comment](https://steemit.com%v) by %v.
+%v %v on a [comment](%v) by %v.
 
 *Weight:* %v
 *Pending Payout:* %v
 `,
-		steemitLink(o.Voter),
-		c.URL,
-		steemitLink(o.Author),
-		o.Weight,
+		steemitLink(lb, o.Voter),
+		event.Verb(),
+		lb.Content(c.URL),
+		steemitLink(lb, o.Author),
+		event.WeightText(),
+		c.PendingPayoutValue,
+	)
+}
+
+// AccountCreationTokenClaimed
+
+func renderAccountCreationTokenClaimedEvent(
+	lb *links.Builder,
+	event *events.AccountCreationTokenClaimed,
+) string {
+
+	payment := event.Op.Fee
+	if event.PaidWithRC() {
+		payment = "resource credits"
+	}
+
+	return fmt.Sprintf(`
+<=====>
+%v claimed an account creation token, paid with %v.
+`,
+		steemitLink(lb, event.Op.Creator),
+		payment,
+	)
+}
+
+// PayoutApproaching
+
+func renderPayoutApproachingEvent(lb *links.Builder, event *events.PayoutApproaching) string {
+	c := event.Content
+
+	return fmt.Sprintf(`
+<=====>
+A [story](%v) by %v is going to be paid out in %v.
+
+*Title:* %v
+*Pending Payout:* %v
+`,
+		lb.Content(c.URL),
+		steemitLink(lb, c.Author),
+		event.TimeLeft(),
+		c.Title,
 		c.PendingPayoutValue,
 	)
 }
+
+// PostPaidOut
+
+func renderPostPaidOutEvent(lb *links.Builder, event *events.PostPaidOut) string {
+	c := event.Content
+
+	return fmt.Sprintf(`
+<=====>
+A [story](%v) by %v has been paid out.
+
+*Title:* %v
+*Total Payout:* %v
+*Curator Payout:* %v
+`,
+		lb.Content(c.URL),
+		steemitLink(lb, c.Author),
+		c.Title,
+		c.TotalPayoutValue,
+		event.CuratorPayout,
+	)
+}
+
+// WitnessPropertiesSet
+
+func renderWitnessPropertiesSetEvent(lb *links.Builder, event *events.WitnessPropertiesSet) string {
+	var props bytes.Buffer
+	for _, prop := range event.Properties {
+		fmt.Fprintf(&props, "*%v:* %v\n", prop.Key, prop.Value)
+	}
+
+	return fmt.Sprintf(`
+<=====>
+Witness %v updated its properties.
+
+%v`,
+		steemitLink(lb, event.Op.Owner),
+		props.String(),
+	)
+}
+
+// BlockProductionRewardReceived
+
+func renderBlockProductionRewardReceivedEvent(
+	lb *links.Builder,
+	event *events.BlockProductionRewardReceived,
+) string {
+
+	if event.Aggregated() {
+		return fmt.Sprintf(`
+<=====>
+Witness %v produced %v blocks on %v.
+
+*Reward:* %v
+`,
+			steemitLink(lb, event.Op.Producer),
+			event.Blocks,
+			event.Day,
+			event.Op.VestingShares,
+		)
+	}
+	return fmt.Sprintf(`
+<=====>
+Witness %v produced a block, earning %v.
+`,
+		steemitLink(lb, event.Op.Producer),
+		event.Op.VestingShares,
+	)
+}
+
+// CommunitySubscriptionChanged
+
+func renderCommunitySubscriptionChangedEvent(
+	lb *links.Builder,
+	event *events.CommunitySubscriptionChanged,
+) string {
+
+	verb := "unsubscribed from"
+	if event.Subscribed() {
+		verb = "subscribed to"
+	}
+	return fmt.Sprintf(`
+<=====>
+%v %v community %v.
+`,
+		steemitLink(lb, event.Op.Account),
+		verb,
+		event.Op.Community,
+	)
+}
+
+// CommunityRoleChanged
+
+func renderCommunityRoleChangedEvent(lb *links.Builder, event *events.CommunityRoleChanged) string {
+	return fmt.Sprintf(`
+<=====>
+%v set the role of %v in community %v.
+
+*Role:* %v
+`,
+		steemitLink(lb, event.Op.Account),
+		steemitLink(lb, event.Op.Target),
+		event.Op.Community,
+		event.Op.Role,
+	)
+}
+
+// NewPayerDetected
+
+func renderNewPayerDetectedEvent(lb *links.Builder, event *events.NewPayerDetected) string {
+	op := event.Op
+
+	var memo string
+	if op.Memo != "" {
+		memo = "\n\n*Memo:* " + op.Memo
+	}
+	return fmt.Sprintf(`
+<=====>
+New payer %v transferred %v to %v.%v
+`,
+		steemitLink(lb, op.From),
+		op.Amount,
+		steemitLink(lb, op.To),
+		memo,
+	)
+}
+
+// CustomJSONBroadcast
+
+func renderCustomJSONBroadcastEvent(lb *links.Builder, event *events.CustomJSONBroadcast) string {
+	return fmt.Sprintf(`
+<=====>
+custom_json %v broadcast by %v:
+
+`+"```"+`
+%v
+`+"```"+`
+`,
+		event.Op.ID,
+		steemitLink(lb, event.Account()),
+		events.Excerpt(event.Op.JSON, events.CustomJSONExcerptLength),
+	)
+}
+
+// AccountCreated
+
+func renderAccountCreatedEvent(lb *links.Builder, event *events.AccountCreated) string {
+	op := event.Op
+
+	return fmt.Sprintf(`
+<=====>
+%v created account %v, paid %v and delegated %v.
+`,
+		steemitLink(lb, op.Creator),
+		steemitLink(lb, op.NewAccountName),
+		op.Fee,
+		op.Delegation,
+	)
+}
+
+// AccountActivity
+
+func renderAccountActivityEvent(lb *links.Builder, event *events.AccountActivity) string {
+	accounts := make([]string, len(event.Accounts))
+	for i, account := range event.Accounts {
+		accounts[i] = steemitLink(lb, account)
+	}
+
+	return fmt.Sprintf(`
+<=====>
+%v operation by %v
+
+%v
+`,
+		event.OpType,
+		strings.Join(accounts, ", "),
+		event.Excerpt(),
+	)
+}
+
+// RCDelegated
+
+func renderRCDelegatedEvent(lb *links.Builder, event *events.RCDelegated) string {
+	op := event.Op
+
+	return fmt.Sprintf(`
+<=====>
+%v delegated %v RC to %v.
+`,
+		steemitLink(lb, op.Delegator),
+		op.MaxRC,
+		steemitLink(lb, op.Delegatee),
+	)
+}
+
+// RCDelegationRemoved
+
+func renderRCDelegationRemovedEvent(lb *links.Builder, event *events.RCDelegationRemoved) string {
+	op := event.Op
+
+	return fmt.Sprintf(`
+<=====>
+%v removed the RC delegation to %v.
+`,
+		steemitLink(lb, op.Delegator),
+		steemitLink(lb, op.Delegatee),
+	)
+}
+
+// WitnessFeedStale
+
+func renderWitnessFeedStaleEvent(lb *links.Builder, event *events.WitnessFeedStale) string {
+	return fmt.Sprintf(`
+<=====>
+Witness %v has not published the price feed for %v.
+The last feed was published at %v.
+`,
+		steemitLink(lb, event.Witness),
+		event.Age(),
+		event.LastPublish.UTC().Format("Jan 2 15:04 MST"),
+	)
+}
+
+// WitnessFeedRecovered
+
+func renderWitnessFeedRecoveredEvent(lb *links.Builder, event *events.WitnessFeedRecovered) string {
+	return fmt.Sprintf(`
+<=====>
+Witness %v published the price feed again after %v.
+`,
+		steemitLink(lb, event.Witness),
+		event.Stale(),
+	)
+}
@@ -0,0 +1,152 @@
+// Package truncate fits the rendered messages into the size limits of the providers,
+// e.g. 4096 characters for Telegram, so that a long post does not make the send fail.
+package truncate
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/tchap/steemwatch/links"
+	"github.com/tchap/steemwatch/notifications/events"
+
+	"github.com/go-steem/rpc/apis/database"
+)
+
+const (
+	ellipsis = "…"
+	// codeFence is closed when the cut leaves it open, otherwise the rest
+	// of the message would be rendered as code, or rejected altogether.
+	codeFence = "```"
+)
+
+// Fit returns the text cut to at most limit characters, with the ellipsis and more appended
+// when it is cut, e.g. the link to the full content. The text is cut at the end of a line
+// or a word when possible. A limit of 0 means no limit.
+func Fit(text string, limit int, more string) string {
+	return fit(text, limit, more, nil)
+}
+
+// FitMarkdown is Fit for the Markdown texts, e.g. the Telegram messages. The cut is moved
+// before the entity it would leave open, i.e. *bold*, _italic_, `code` or [text](url),
+// and before a trailing escape, so that the message can still be parsed.
+func FitMarkdown(text string, limit int, more string) string {
+	return fit(text, limit, more, markdownCut)
+}
+
+func fit(text string, limit int, more string, clean func(string) string) string {
+	if limit <= 0 || utf8.RuneCountInString(text) <= limit {
+		return text
+	}
+
+	suffix := ellipsis
+	if more != "" {
+		suffix += "\n" + more
+	}
+	room := limit - utf8.RuneCountInString(suffix) - len(codeFence) - 1
+	if room <= 0 {
+		cut := string([]rune(text)[:limit])
+		if clean != nil {
+			cut = clean(cut)
+		}
+		return cut
+	}
+
+	cut := string([]rune(text)[:room])
+	// Prefer a natural boundary unless it throws away too much.
+	if i := strings.LastIndexAny(cut, "\n "); i > len(cut)*3/4 {
+		cut = cut[:i]
+	}
+	if clean != nil {
+		cut = clean(cut)
+	}
+	if strings.Count(cut, codeFence)%2 == 1 {
+		cut += "\n" + codeFence
+	}
+	return strings.TrimRight(cut, " ") + suffix
+}
+
+// markdownCut returns the cut moved before the entity it leaves open, see FitMarkdown.
+// The entities cannot be nested, so there is at most one open. The code blocks are
+// taken as they are, the one left open is closed by fit.
+func markdownCut(cut string) string {
+	var (
+		end     = len(cut)
+		open    = -1
+		closing byte
+	)
+	for i := 0; i < len(cut); i++ {
+		c := cut[i]
+		switch {
+		case closing == 0 && strings.HasPrefix(cut[i:], codeFence):
+			j := strings.Index(cut[i+len(codeFence):], codeFence)
+			if j == -1 {
+				i = len(cut)
+				break
+			}
+			i += len(codeFence) + j + len(codeFence) - 1
+
+		case closing == '`':
+			// There are no escapes in code.
+			if c == '`' {
+				open, closing = -1, 0
+			}
+
+		case c == '\\':
+			if i == len(cut)-1 {
+				end = i
+			}
+			i++
+
+		case closing != 0:
+			if c != closing {
+				continue
+			}
+			// The link text is followed by the URL.
+			if closing == ']' && i+1 < len(cut) && cut[i+1] == '(' {
+				closing = ')'
+				i++
+				continue
+			}
+			if closing == ']' && i+1 == len(cut) {
+				continue
+			}
+			open, closing = -1, 0
+
+		case c == '*' || c == '_' || c == '`':
+			open, closing = i, c
+
+		case c == '[':
+			open, closing = i, ']'
+		}
+	}
+	if open != -1 && open < end {
+		end = open
+	}
+	return cut[:end]
+}
+
+// ContentLink returns the link to the full content the event is about,
+// an empty string for the events without content.
+func ContentLink(lb *links.Builder, event interface{}) string {
+	var content *database.Content
+	switch event := event.(type) {
+	case *events.StoryPublished:
+		content = event.Content
+	case *events.StoryVoted:
+		content = event.Content
+	case *events.CommentPublished:
+		content = event.Content
+	case *events.CommentVoted:
+		content = event.Content
+	case *events.UserMentioned:
+		content = event.Content
+	case *events.PayoutApproaching:
+		content = event.Content
+	case *events.PostPaidOut:
+		content = event.Content
+	}
+	if content == nil || content.URL == "" {
+		return ""
+	}
+	return "Full content: " + lb.Content(content.URL)
+}
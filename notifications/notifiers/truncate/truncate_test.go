@@ -0,0 +1,96 @@
+package truncate
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestFit(t *testing.T) {
+	testCases := []struct {
+		name  string
+		text  string
+		limit int
+		more  string
+		want  string
+	}{
+		{"no limit", "hello world", 0, "", "hello world"},
+		{"within the limit", "hello world", 11, "", "hello world"},
+		{"word boundary", strings.Repeat("word ", 10), 30, "", "word word word word word…"},
+		{"more", strings.Repeat("word ", 10), 30, "more", "word word word word…\nmore"},
+		{"code fence closed", "```\n" + strings.Repeat("code ", 10), 30, "", "```\ncode code code code\n```…"},
+		{"tiny limit", "hello world", 3, "", "hel"},
+	}
+
+	for _, tc := range testCases {
+		got := Fit(tc.text, tc.limit, tc.more)
+		if got != tc.want {
+			t.Errorf("%v: got %q, want %q", tc.name, got, tc.want)
+		}
+		if tc.limit != 0 && utf8.RuneCountInString(got) > tc.limit {
+			t.Errorf("%v: got %v characters, limit %v", tc.name, utf8.RuneCountInString(got), tc.limit)
+		}
+	}
+}
+
+func TestFitMarkdown(t *testing.T) {
+	padding := strings.Repeat("x", 20)
+
+	testCases := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"closed bold", padding + " *bold* " + strings.Repeat("y", 40), padding + " *bold*…"},
+		{"open bold", padding + " *bold text that goes on* end", padding + "…"},
+		{"open italic", padding + " _italic text that goes on_ end", padding + "…"},
+		{"open code", padding + " `code that goes on and on` end", padding + "…"},
+		{"open link text", padding + " [a link that goes on](https://steemit.com) end", padding + "…"},
+		{"open link URL", padding + " [link](https://steemit.com/@alice/a-long-post) end", padding + "…"},
+		{"trailing escape", padding + "abcdefghijklmn\\_ end of the text", padding + "abcdefghijklmn…"},
+		{"escaped bold", padding + " \\*not bold text that goes on end", padding + " \\*not bold…"},
+	}
+
+	for _, tc := range testCases {
+		got := FitMarkdown(tc.text, 40, "")
+		if got != tc.want {
+			t.Errorf("%v: got %q, want %q", tc.name, got, tc.want)
+		}
+		if utf8.RuneCountInString(got) > 40 {
+			t.Errorf("%v: got %v characters, limit 40", tc.name, utf8.RuneCountInString(got))
+		}
+	}
+}
+
+func TestFitOverLimit(t *testing.T) {
+	line := strings.Repeat("a line of the comment ", 100)
+	text := strings.Repeat(line+"\n", 5)
+	const more = "Full content: https://steemit.com/steem/@bob/a-story#@alice/re-a-story"
+
+	testCases := []struct {
+		name  string
+		fit   func(text string, limit int, more string) string
+		limit int
+		more  string
+	}{
+		{"Telegram limit", Fit, 4096, more},
+		{"short limit", Fit, 300, more},
+		{"short limit without more", Fit, 300, ""},
+		{"Markdown", FitMarkdown, 300, more},
+		{"Markdown without more", FitMarkdown, 300, ""},
+	}
+
+	for _, tc := range testCases {
+		got := tc.fit(text, tc.limit, tc.more)
+		if n := utf8.RuneCountInString(got); n > tc.limit {
+			t.Errorf("%v: got %v characters, limit %v", tc.name, n, tc.limit)
+		}
+		suffix := ellipsis
+		if tc.more != "" {
+			suffix += "\n" + tc.more
+		}
+		if !strings.HasSuffix(got, suffix) {
+			t.Errorf("%v: suffix %q missing: %q", tc.name, suffix, got)
+		}
+	}
+}
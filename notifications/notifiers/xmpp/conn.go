@@ -0,0 +1,164 @@
+package xmpp
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/tchap/steemwatch/errs"
+
+	xmppclient "github.com/mattn/go-xmpp"
+	"github.com/pkg/errors"
+)
+
+const (
+	minReconnectDelay = time.Second
+	maxReconnectDelay = 5 * time.Minute
+)
+
+// conn is the managed connection of the bot account.
+// It keeps reconnecting until closed.
+type conn struct {
+	options xmppclient.Options
+
+	client     *xmppclient.Client
+	clientLock sync.Mutex
+	// connectedCh is closed when the client is connected and replaced on disconnect.
+	connectedCh chan struct{}
+
+	termCh chan struct{}
+}
+
+func newConn(server, jid, password string) *conn {
+	return &conn{
+		options: xmppclient.Options{
+			Host:     server,
+			User:     jid,
+			Password: password,
+			Resource: "steemwatch",
+			NoTLS:    true,
+			StartTLS: true,
+			Session:  true,
+		},
+		connectedCh: make(chan struct{}),
+		termCh:      make(chan struct{}),
+	}
+}
+
+// loop connects to the server and serves the connection, reconnecting on failure.
+func (c *conn) loop() {
+	delay := minReconnectDelay
+	for {
+		connectedAt := time.Now()
+		err := c.serve()
+		if err == errs.ErrClosing {
+			return
+		}
+		log.Printf("XMPP connection to %v lost: %+v", c.options.Host, err)
+
+		// Reset the delay when the connection was alive for a while.
+		if time.Since(connectedAt) > maxReconnectDelay {
+			delay = minReconnectDelay
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-c.termCh:
+			return
+		}
+
+		delay *= 2
+		if delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
+
+func (c *conn) serve() error {
+	client, err := c.options.NewClient()
+	if err != nil {
+		return errors.Wrapf(err, "failed to connect to %v", c.options.Host)
+	}
+
+	c.clientLock.Lock()
+	c.client = client
+	close(c.connectedCh)
+	c.clientLock.Unlock()
+
+	log.Printf("XMPP connection to %v established", c.options.Host)
+
+	defer func() {
+		c.clientLock.Lock()
+		c.client = nil
+		c.connectedCh = make(chan struct{})
+		c.clientLock.Unlock()
+		client.Close()
+	}()
+
+	// Close the client on termination to interrupt Recv.
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+	go func() {
+		select {
+		case <-c.termCh:
+			client.Close()
+		case <-doneCh:
+		}
+	}()
+
+	for {
+		stanza, err := client.Recv()
+		if err != nil {
+			select {
+			case <-c.termCh:
+				return errs.ErrClosing
+			default:
+				return errors.Wrap(err, "failed to receive")
+			}
+		}
+
+		switch stanza := stanza.(type) {
+		case xmppclient.Presence:
+			// Accept the subscription requests so that the recipients can add the bot
+			// to their rosters. Other presence updates don't matter, the server queues
+			// the messages for the recipients that are offline.
+			if stanza.Type == "subscribe" {
+				c.clientLock.Lock()
+				client.ApproveSubscription(stanza.From)
+				c.clientLock.Unlock()
+			}
+		}
+	}
+}
+
+// send sends the chat message to the given JID,
+// waiting for the connection to be established when necessary.
+func (c *conn) send(to, text string, timeout time.Duration) error {
+	timeoutCh := time.After(timeout)
+	for {
+		c.clientLock.Lock()
+		client, connectedCh := c.client, c.connectedCh
+		if client != nil {
+			_, err := client.Send(xmppclient.Chat{
+				Remote: to,
+				Type:   "chat",
+				Text:   text,
+			})
+			c.clientLock.Unlock()
+			return errors.Wrapf(err, "failed to send a message to %v", to)
+		}
+		c.clientLock.Unlock()
+
+		select {
+		case <-connectedCh:
+		case <-timeoutCh:
+			return errors.Errorf("timed out waiting to send a message to %v", to)
+		case <-c.termCh:
+			return errs.ErrClosing
+		}
+	}
+}
+
+func (c *conn) close() {
+	close(c.termCh)
+}
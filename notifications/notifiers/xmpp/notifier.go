@@ -0,0 +1,385 @@
+package xmpp
+
+import (
+	"time"
+
+	"github.com/tchap/steemwatch/errs"
+	"github.com/tchap/steemwatch/links"
+	"github.com/tchap/steemwatch/notifications/events"
+	"github.com/tchap/steemwatch/notifications/notifiers/truncate"
+	"github.com/tchap/steemwatch/server/routes/api/notifiers/xmpp"
+
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// DefaultMaxMessageLength is the default length limit of the messages.
+// Many servers reject the longer stanzas.
+const DefaultMaxMessageLength = 10000
+
+//
+// Notifier
+//
+
+// Notifier sends the events as chat messages to the users' JIDs.
+//
+// The messages are sent by a single bot account that keeps a persistent connection
+// to its server. The server takes care of queueing the messages for offline recipients.
+type Notifier struct {
+	conn             *conn
+	requestTimeout   time.Duration
+	links            *links.Builder
+	maxMessageLength uint
+	termCh           chan struct{}
+
+	// matchedBy is only set on the views returned by MatchedBy.
+	matchedBy string
+}
+
+func NewNotifier(server, jid, password string, opts ...NotifierOption) *Notifier {
+	notifier := &Notifier{
+		conn:             newConn(server, jid, password),
+		requestTimeout:   time.Minute,
+		links:            links.MustNewBuilder(links.DefaultBaseURL),
+		maxMessageLength: DefaultMaxMessageLength,
+		termCh:           make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(notifier)
+	}
+
+	go notifier.conn.loop()
+
+	return notifier
+}
+
+type NotifierOption func(*Notifier)
+
+func SetLinkBuilder(lb *links.Builder) NotifierOption {
+	return func(notifier *Notifier) {
+		notifier.links = lb
+	}
+}
+
+// SetMaxMessageLength sets the maximum number of characters in a message.
+// The longer messages are cut and the link to the full content is appended.
+func SetMaxMessageLength(length uint) NotifierOption {
+	return func(notifier *Notifier) {
+		notifier.maxMessageLength = length
+	}
+}
+
+// SetRequestTimeout sets how long a dispatch waits for the message to be sent,
+// which includes waiting for the connection to be re-established.
+func SetRequestTimeout(timeout time.Duration) NotifierOption {
+	return func(notifier *Notifier) {
+		notifier.requestTimeout = timeout
+	}
+}
+
+func (notifier *Notifier) DispatchAccountUpdatedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.AccountUpdated,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderAccountUpdatedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchAccountWitnessVotedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.AccountWitnessVoted,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderAccountWitnessVotedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchTransferMadeEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.TransferMade,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderTransferMadeEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchUserMentionedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.UserMentioned,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderUserMentionedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchUserFollowStatusChangedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.UserFollowStatusChanged,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderUserFollowStatusChangedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchStoryPublishedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.StoryPublished,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderStoryPublishedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchStoryVotedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.StoryVoted,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderStoryVotedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchCommentPublishedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.CommentPublished,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderCommentPublishedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchCommentVotedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.CommentVoted,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderCommentVotedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchAccountCreationTokenClaimedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.AccountCreationTokenClaimed,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderAccountCreationTokenClaimedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchPayoutApproachingEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.PayoutApproaching,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderPayoutApproachingEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchPostPaidOutEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.PostPaidOut,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderPostPaidOutEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchWitnessPropertiesSetEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.WitnessPropertiesSet,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderWitnessPropertiesSetEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchBlockProductionRewardReceivedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.BlockProductionRewardReceived,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderBlockProductionRewardReceivedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchCommunitySubscriptionChangedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.CommunitySubscriptionChanged,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderCommunitySubscriptionChangedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchCommunityRoleChangedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.CommunityRoleChanged,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderCommunityRoleChangedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchNewPayerDetectedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.NewPayerDetected,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderNewPayerDetectedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchCustomJSONBroadcastEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.CustomJSONBroadcast,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderCustomJSONBroadcastEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchAccountCreatedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.AccountCreated,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderAccountCreatedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchAccountActivityEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.AccountActivity,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderAccountActivityEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchRCDelegatedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.RCDelegated,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderRCDelegatedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchRCDelegationRemovedEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.RCDelegationRemoved,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderRCDelegationRemovedEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchWitnessFeedStaleEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.WitnessFeedStale,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderWitnessFeedStaleEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchWitnessFeedRecoveredEvent(
+	userId string,
+	userSettings bson.Raw,
+	event *events.WitnessFeedRecovered,
+) error {
+	return notifier.dispatch(userId, userSettings, event, func() string {
+		return renderWitnessFeedRecoveredEvent(notifier.links, event)
+	})
+}
+
+func (notifier *Notifier) DispatchDigest(
+	userId string,
+	userSettings bson.Raw,
+	digest *events.Digest,
+) error {
+	return notifier.dispatch(userId, userSettings, digest, func() string {
+		return renderDigest(notifier.links, digest)
+	})
+}
+
+func (notifier *Notifier) DispatchDailySummary(
+	userId string,
+	userSettings bson.Raw,
+	summary *events.DailySummary,
+) error {
+	return notifier.dispatch(userId, userSettings, summary, func() string {
+		return renderDailySummary(notifier.links, summary)
+	})
+}
+
+// MatchedBy returns a view of the notifier that appends the reason to the messages.
+func (notifier *Notifier) MatchedBy(reason string) interface{} {
+	view := *notifier
+	view.matchedBy = reason
+	return &view
+}
+
+func (notifier *Notifier) dispatch(
+	userId string,
+	userSettings bson.Raw,
+	event interface{},
+	render func() string,
+) error {
+	var settings xmpp.Settings
+	if err := userSettings.Unmarshal(&settings); err != nil {
+		return errors.Wrapf(err, "failed to unmarshal XMPP settings for user %v", userId)
+	}
+
+	select {
+	case <-notifier.termCh:
+		return errs.ErrClosing
+	default:
+	}
+
+	return notifier.conn.send(settings.JID, notifier.message(event, render()), notifier.requestTimeout)
+}
+
+// message appends the reason to the rendered text and fits it into the length limit.
+func (notifier *Notifier) message(event interface{}, text string) string {
+	if notifier.matchedBy != "" {
+		text += "\nMatched by " + notifier.matchedBy
+	}
+	return truncate.Fit(text, int(notifier.maxMessageLength), truncate.ContentLink(notifier.links, event))
+}
+
+func (notifier *Notifier) Close() error {
+	select {
+	case <-notifier.termCh:
+		return errs.ErrClosing
+	default:
+		close(notifier.termCh)
+		notifier.conn.close()
+		return nil
+	}
+}
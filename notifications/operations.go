@@ -0,0 +1,27 @@
+package notifications
+
+import (
+	"github.com/go-steem/rpc/types"
+)
+
+// OperationNotifier is implemented by the notifiers that can pass on the raw operation
+// the event was mined from, which helps the developers debugging their filters and clients.
+// WithOperation returns a view of the notifier carrying the operation, see MatchedByNotifier.
+// It is up to the notifier whether the operation is actually sent, it is opt-in.
+type OperationNotifier interface {
+	WithOperation(op types.Operation) interface{}
+}
+
+// operationNotifier returns the view of the notifier carrying the operation the event was mined from,
+// or the notifier itself when there is no such operation, e.g. for a digest.
+func operationNotifier(notifier Notifier, pos *eventPosition) Notifier {
+	if pos == nil || pos.op == nil {
+		return notifier
+	}
+	if on, ok := notifier.(OperationNotifier); ok {
+		if view, ok := on.WithOperation(pos.op).(Notifier); ok {
+			return view
+		}
+	}
+	return notifier
+}
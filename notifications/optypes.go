@@ -0,0 +1,93 @@
+package notifications
+
+import (
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/tchap/steemwatch/notifications/events"
+
+	"github.com/go-steem/rpc/types"
+)
+
+// eventKindSources are the operation types the events of the given kind are mined from.
+// The kind is disabled when all of its operation types are disabled.
+var eventKindSources = map[string][]types.OpType{
+	"account.updated":                {types.TypeAccountUpdate},
+	"account.witness_voted":          {types.TypeAccountWitnessVote},
+	"transfer.made":                  {types.TypeTransfer},
+	"transfer.new_payer":             {types.TypeTransfer},
+	"user.mentioned":                 {types.TypeComment},
+	"story.published":                {types.TypeComment},
+	"comment.published":              {types.TypeComment},
+	"story.voted":                    {types.TypeVote},
+	"comment.voted":                  {types.TypeVote},
+	"user.follow_changed":            {types.TypeCustomJSON},
+	"community.subscription_changed": {types.TypeCustomJSON},
+	"community.role_changed":         {types.TypeCustomJSON},
+	"custom_json.firehose":           {types.TypeCustomJSON},
+	"rc.delegated":                   {types.TypeCustomJSON},
+	"rc.delegation_removed":          {types.TypeCustomJSON},
+	"account.creation_token_claimed": {events.TypeClaimAccount},
+	"witness.properties_set":         {events.TypeWitnessSetProperties},
+	"witness.feed_stale":             {types.TypeFeedPublish, events.TypeWitnessSetProperties},
+	"witness.feed_recovered":         {types.TypeFeedPublish, events.TypeWitnessSetProperties},
+	"witness.production_reward":      {events.TypeProducerReward},
+	"chain.hardfork_activated":       {events.TypeHardfork},
+	"account.created":                {events.TypeAccountCreateWithDelegation},
+	"account.activity":               {AnyOpType},
+	// The payouts are only tracked for the posts mined from comment operations.
+	"post.payout_approaching": {types.TypeComment},
+	"post.paid_out":           {types.TypeComment},
+}
+
+// disableOpTypes removes the miners of the disabled operation types so that the operations
+// of these types are skipped altogether, including the prefetching and the miners run for every operation.
+func (processor *BlockProcessor) disableOpTypes() {
+	if len(processor.disabledOpTypes) == 0 {
+		return
+	}
+
+	names := make([]string, 0, len(processor.disabledOpTypes))
+	for opType := range processor.disabledOpTypes {
+		if _, ok := processor.eventMiners[opType]; !ok {
+			log.Printf("operation type %v disabled, but it is not mined anyway", opType)
+		}
+		delete(processor.eventMiners, opType)
+		names = append(names, string(opType))
+	}
+	sort.Strings(names)
+
+	var kinds []string
+	for kind := range events.Types {
+		if !processor.eventKindEnabled(kind) {
+			kinds = append(kinds, kind)
+		}
+	}
+	sort.Strings(kinds)
+
+	log.Printf("operation types disabled: %v", strings.Join(names, ", "))
+	if len(kinds) != 0 {
+		log.Printf("event kinds disabled: %v", strings.Join(kinds, ", "))
+	}
+}
+
+// opTypeEnabled returns true unless the operation type is disabled.
+func (processor *BlockProcessor) opTypeEnabled(opType types.OpType) bool {
+	return !processor.disabledOpTypes[opType]
+}
+
+// eventKindEnabled returns true when any operation type the kind is mined from is enabled.
+// The kinds not mined from operations are always enabled.
+func (processor *BlockProcessor) eventKindEnabled(kind string) bool {
+	sources, ok := eventKindSources[kind]
+	if !ok {
+		return true
+	}
+	for _, opType := range sources {
+		if processor.opTypeEnabled(opType) {
+			return true
+		}
+	}
+	return false
+}
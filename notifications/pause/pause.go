@@ -0,0 +1,85 @@
+package pause
+
+import (
+	"sync"
+	"time"
+)
+
+// Status describes whether the block processing pipeline is paused.
+type Status struct {
+	Paused bool       `json:"paused"`
+	Reason string     `json:"reason,omitempty"`
+	Since  *time.Time `json:"since,omitempty"`
+}
+
+// Switch pauses and resumes the block processing pipeline.
+// It is shared by the block processor and the admin API.
+type Switch struct {
+	status   Status
+	resumeCh chan struct{}
+	lock     sync.RWMutex
+}
+
+func NewSwitch() *Switch {
+	return &Switch{}
+}
+
+// Pause stops the pipeline. Pausing a paused pipeline only updates the reason.
+func (s *Switch) Pause(reason string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.status.Paused {
+		s.status.Reason = reason
+		return
+	}
+
+	now := time.Now()
+	s.status = Status{
+		Paused: true,
+		Reason: reason,
+		Since:  &now,
+	}
+	s.resumeCh = make(chan struct{})
+}
+
+// Resume lets the pipeline continue where it stopped.
+func (s *Switch) Resume() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if !s.status.Paused {
+		return
+	}
+	s.status = Status{}
+	close(s.resumeCh)
+	s.resumeCh = nil
+}
+
+func (s *Switch) Status() Status {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.status
+}
+
+func (s *Switch) Paused() bool {
+	return s.Status().Paused
+}
+
+// Wait blocks while the pipeline is paused. It returns false when abort is closed first.
+func (s *Switch) Wait(abort <-chan struct{}) bool {
+	s.lock.RLock()
+	resumeCh := s.resumeCh
+	s.lock.RUnlock()
+
+	if resumeCh == nil {
+		return true
+	}
+
+	select {
+	case <-resumeCh:
+		return true
+	case <-abort:
+		return false
+	}
+}
@@ -0,0 +1,55 @@
+package notifications
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// DefaultPayerRetention is how long a payer is remembered after the last transfer.
+// A payer that was forgotten is detected as a new payer again.
+const DefaultPayerRetention = 365 * 24 * time.Hour
+
+// Payer is stored for every (payee, payer) pair seen, for the watched payees only.
+type Payer struct {
+	Id            string    `bson:"_id"`
+	Payee         string    `bson:"payee"`
+	Payer         string    `bson:"payer"`
+	Transfers     uint      `bson:"transfers"`
+	FirstTransfer time.Time `bson:"firstTransfer"`
+	LastTransfer  time.Time `bson:"lastTransfer"`
+	ExpiresAt     time.Time `bson:"expiresAt"`
+}
+
+// recordPayer counts the transfer from payer to payee
+// and returns the number of transfers seen including this one.
+func (processor *BlockProcessor) recordPayer(payee, payer string) (uint, error) {
+	now := time.Now()
+
+	change := mgo.Change{
+		Update: bson.M{
+			"$setOnInsert": bson.M{
+				"payee":         payee,
+				"payer":         payer,
+				"firstTransfer": now,
+			},
+			"$set": bson.M{
+				"lastTransfer": now,
+				"expiresAt":    now.Add(processor.payerRetention),
+			},
+			"$inc": bson.M{
+				"transfers": 1,
+			},
+		},
+		Upsert:    true,
+		ReturnNew: true,
+	}
+
+	var doc Payer
+	if _, err := processor.db.C("payers").FindId(payee+":"+payer).Apply(change, &doc); err != nil {
+		return 0, errors.Wrapf(err, "failed to record payer @%v for @%v", payer, payee)
+	}
+	return doc.Transfers, nil
+}
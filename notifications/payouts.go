@@ -0,0 +1,206 @@
+package notifications
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/tchap/steemwatch/notifications/events"
+
+	"github.com/go-steem/rpc/apis/database"
+	"github.com/go-steem/rpc/types"
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// PayoutPollInterval specifies how often the tracked posts are checked.
+const PayoutPollInterval = time.Minute
+
+// DefaultPayoutLeadTimes specifies how long before the payout PayoutApproaching is emitted.
+var DefaultPayoutLeadTimes = []time.Duration{12 * time.Hour, time.Hour}
+
+// TrackedPost is a post that was dispatched to the owners as story.published.
+// The payout tracker watches its cashout time until it is paid out.
+type TrackedPost struct {
+	Id          bson.ObjectId   `bson:"_id,omitempty"`
+	Author      string          `bson:"author"`
+	Permlink    string          `bson:"permlink"`
+	Owners      []bson.ObjectId `bson:"owners"`
+	CashoutTime time.Time       `bson:"cashoutTime"`
+	// Notified contains the lead times PayoutApproaching was already emitted for.
+	Notified []time.Duration `bson:"notified"`
+}
+
+// trackPost starts tracking the payout of the post for the given users.
+func (processor *BlockProcessor) trackPost(content *database.Content, ownerIds []bson.ObjectId) {
+	if len(ownerIds) == 0 || content.CashoutTime == nil || content.CashoutTime.Time == nil {
+		return
+	}
+
+	selector := bson.M{
+		"author":   content.Author,
+		"permlink": content.Permlink,
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"cashoutTime": *content.CashoutTime.Time,
+		},
+		"$addToSet": bson.M{
+			"owners": bson.M{"$each": ownerIds},
+		},
+	}
+	if _, err := processor.db.C("trackedPosts").Upsert(selector, update); err != nil {
+		log.Printf("failed to track payout of @%v/%v: %v", content.Author, content.Permlink, err)
+	}
+}
+
+func (processor *BlockProcessor) trackedPostOwners(author, permlink string) ([]bson.ObjectId, error) {
+	query := bson.M{
+		"author":   author,
+		"permlink": permlink,
+	}
+
+	var post TrackedPost
+	if err := processor.db.C("trackedPosts").Find(query).One(&post); err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "failed to get tracked post @%v/%v", author, permlink)
+	}
+	return post.Owners, nil
+}
+
+func (processor *BlockProcessor) payoutTracker() error {
+	ticker := time.NewTicker(PayoutPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// Nothing is dispatched while the pipeline is paused.
+			if processor.pipeline.Paused() {
+				continue
+			}
+			if err := processor.checkPayouts(); err != nil {
+				log.Printf("failed to check payouts: %+v", err)
+			}
+
+		case <-processor.t.Dying():
+			return nil
+		}
+	}
+}
+
+func (processor *BlockProcessor) checkPayouts() error {
+	now := time.Now()
+
+	// Go from the longest lead time to the shortest one. A post is only notified about
+	// the shortest lead time it falls into, which matters for posts tracked late.
+	leadTimes := append([]time.Duration(nil), processor.payoutLeadTimes...)
+	sort.Sort(sort.Reverse(durations(leadTimes)))
+
+	for i, leadTime := range leadTimes {
+		window := bson.M{
+			"$gt":  now,
+			"$lte": now.Add(leadTime),
+		}
+		if i+1 < len(leadTimes) {
+			window["$gt"] = now.Add(leadTimes[i+1])
+		}
+
+		query := bson.M{
+			"cashoutTime": window,
+			"notified":    bson.M{"$ne": leadTime},
+		}
+		if err := processor.forEachTrackedPost(query, func(post *TrackedPost) error {
+			return processor.payoutApproaching(post, leadTime)
+		}); err != nil {
+			return err
+		}
+	}
+
+	query := bson.M{
+		"cashoutTime": bson.M{"$lte": now},
+	}
+	return processor.forEachTrackedPost(query, processor.payoutCompleted)
+}
+
+func (processor *BlockProcessor) forEachTrackedPost(query bson.M, fn func(*TrackedPost) error) error {
+	var posts []*TrackedPost
+	if err := processor.db.C("trackedPosts").Find(query).All(&posts); err != nil {
+		return errors.Wrap(err, "failed to get tracked posts")
+	}
+
+	for _, post := range posts {
+		if err := fn(post); err != nil {
+			log.Printf("failed to check payout of @%v/%v: %+v", post.Author, post.Permlink, err)
+		}
+	}
+	return nil
+}
+
+func (processor *BlockProcessor) payoutApproaching(post *TrackedPost, leadTime time.Duration) error {
+	content, err := processor.client.Database.GetContent(post.Author, post.Permlink)
+	if err != nil {
+		return errors.Wrap(err, "failed to get content")
+	}
+
+	update := bson.M{
+		"$addToSet": bson.M{
+			"notified": leadTime,
+		},
+	}
+	if err := processor.db.C("trackedPosts").UpdateId(post.Id, update); err != nil {
+		return errors.Wrap(err, "failed to update tracked post")
+	}
+
+	return processor.HandlePayoutApproachingEvent(&events.PayoutApproaching{
+		Content:  content,
+		LeadTime: leadTime,
+	})
+}
+
+func (processor *BlockProcessor) payoutCompleted(post *TrackedPost) error {
+	// The raw content is decoded twice, database.Content has neither the curator payout value
+	// nor the last payout time.
+	raw, err := processor.client.Database.GetContentRaw(post.Author, post.Permlink)
+	if err != nil {
+		return errors.Wrap(err, "failed to get content")
+	}
+	var content *database.Content
+	if err := json.Unmarshal([]byte(*raw), &content); err != nil {
+		return errors.Wrap(err, "failed to decode content")
+	}
+	var payout struct {
+		CuratorPayoutValue string      `json:"curator_payout_value"`
+		LastPayout         *types.Time `json:"last_payout"`
+	}
+	if err := json.Unmarshal([]byte(*raw), &payout); err != nil {
+		return errors.Wrap(err, "failed to decode content")
+	}
+
+	// The payout happens in the first block after the cashout time,
+	// so the node might not have processed it yet. Try again later in that case.
+	if payout.LastPayout == nil || payout.LastPayout.Time == nil ||
+		payout.LastPayout.Time.Before(post.CashoutTime) {
+		return nil
+	}
+
+	if err := processor.HandlePostPaidOutEvent(&events.PostPaidOut{
+		Content:       content,
+		CuratorPayout: payout.CuratorPayoutValue,
+	}); err != nil {
+		return err
+	}
+
+	err = processor.db.C("trackedPosts").RemoveId(post.Id)
+	return errors.Wrap(err, "failed to remove tracked post")
+}
+
+type durations []time.Duration
+
+func (ds durations) Len() int           { return len(ds) }
+func (ds durations) Less(i, j int) bool { return ds[i] < ds[j] }
+func (ds durations) Swap(i, j int)      { ds[i], ds[j] = ds[j], ds[i] }
@@ -0,0 +1,60 @@
+package notifications
+
+import (
+	"time"
+
+	"github.com/tchap/steemwatch/errs"
+
+	"github.com/pkg/errors"
+)
+
+// NotifierPolicy specifies how long a single delivery to a notifier may take
+// and how many times a failed delivery is retried.
+type NotifierPolicy struct {
+	// Timeout is applied by the notifier itself, 0 keeps the notifier default.
+	Timeout time.Duration
+	Retries uint
+	// MaxLength limits the length of the messages, 0 keeps the notifier default.
+	MaxLength uint
+}
+
+// DefaultNotifierPolicies are the per-notifier-type policies used unless overridden.
+// The connection-based notifiers wait longer and do not retry since the message
+// is already queued on the connection.
+var DefaultNotifierPolicies = map[string]NotifierPolicy{
+	"slack":        {Timeout: 30 * time.Second, Retries: 2},
+	"steemit-chat": {Timeout: 30 * time.Second, Retries: 2},
+	"telegram":     {Timeout: 30 * time.Second, Retries: 2},
+	"discord":      {Retries: 1},
+	"matrix":       {Timeout: 30 * time.Second, Retries: 2},
+	"irc":          {Timeout: time.Minute},
+	"xmpp":         {Timeout: time.Minute},
+	"apns":         {Timeout: 30 * time.Second, Retries: 2},
+	"fcm":          {Timeout: 30 * time.Second, Retries: 2},
+}
+
+// RetryBackoff is the delay before the first retry, it is doubled for every following retry.
+const RetryBackoff = time.Second
+
+func (processor *BlockProcessor) notifierPolicy(notifierId string) NotifierPolicy {
+	return processor.notifierPolicies[notifierId]
+}
+
+// dispatchWithRetries calls dispatch until it succeeds or the retries are exhausted.
+// Rejected credentials are not retried, nothing is going to change about them.
+func (processor *BlockProcessor) dispatchWithRetries(retries uint, dispatch func() error) error {
+	backoff := RetryBackoff
+	for attempt := uint(0); ; attempt++ {
+		err := dispatch()
+		if err == nil || attempt == retries || errors.Cause(err) == errs.ErrCredentialsRejected {
+			return err
+		}
+
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-processor.t.Dying():
+			return err
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package notifications
+
+import (
+	"log"
+	"sync"
+
+	"github.com/go-steem/rpc"
+	"github.com/go-steem/rpc/apis/database"
+	"github.com/go-steem/rpc/types"
+	"github.com/pkg/errors"
+)
+
+const DefaultContentFetchConcurrency = 8
+
+type contentKey struct {
+	author   string
+	permlink string
+}
+
+func operationContentKey(op types.Operation) (contentKey, bool) {
+	switch body := op.Data().(type) {
+	case *types.CommentOperation:
+		return contentKey{body.Author, body.Permlink}, true
+	case *types.VoteOperation:
+		return contentKey{body.Author, body.Permlink}, true
+	default:
+		return contentKey{}, false
+	}
+}
+
+// operationAccounts returns the accounts that can be subject to account lookups
+// when the events mined from the operation are being handled.
+func operationAccounts(op types.Operation) []string {
+	switch body := op.Data().(type) {
+	case *types.CommentOperation:
+		return []string{body.Author}
+	case *types.VoteOperation:
+		return []string{body.Voter}
+	default:
+		return nil
+	}
+}
+
+// prefetch gets all the content referenced by the operations in the block,
+// fetching every post only once no matter how many times it is referenced.
+// The accounts involved are loaded into the account cache in a single call,
+// unless the watch index tells that nobody filters by the account age.
+func (processor *BlockProcessor) prefetch(
+	client *rpc.Client,
+	block *database.Block,
+) (map[contentKey]*database.Content, error) {
+
+	var (
+		keys          = make(map[contentKey]struct{})
+		accountSet    = make(map[string]struct{})
+		fetchAccounts = processor.watches == nil || processor.watches.filteringAccountAge()
+	)
+	for _, tx := range block.Transactions {
+		for _, op := range tx.Operations {
+			if !processor.opTypeEnabled(op.Type()) {
+				continue
+			}
+			if key, ok := operationContentKey(op); ok {
+				keys[key] = struct{}{}
+			}
+			if !fetchAccounts {
+				continue
+			}
+			for _, account := range operationAccounts(op) {
+				accountSet[account] = struct{}{}
+			}
+		}
+	}
+
+	if len(accountSet) != 0 {
+		names := make([]string, 0, len(accountSet))
+		for account := range accountSet {
+			names = append(names, account)
+		}
+		// The cache falls back to fetching accounts one by one, so this is not fatal.
+		if err := processor.accounts.Prefetch(names); err != nil {
+			log.Printf("block %v: failed to prefetch accounts: %+v", block.Number, err)
+		}
+	}
+
+	var (
+		contents  = make(map[contentKey]*database.Content, len(keys))
+		firstErr  error
+		lock      sync.Mutex
+		wg        sync.WaitGroup
+		semaphore = make(chan struct{}, DefaultContentFetchConcurrency)
+	)
+	for key := range keys {
+		semaphore <- struct{}{}
+		wg.Add(1)
+		go func(key contentKey) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+
+			content, err := client.Database.GetContent(key.author, key.permlink)
+
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = errors.Wrapf(err, "block %v: failed to get content: @%v/%v",
+						block.Number, key.author, key.permlink)
+				}
+				return
+			}
+			contents[key] = content
+		}(key)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return contents, nil
+}
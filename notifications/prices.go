@@ -0,0 +1,136 @@
+package notifications
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/tchap/steemwatch/notifications/events"
+	"github.com/tchap/steemwatch/server/db"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// PriceRefreshInterval is how often the median price feed is fetched.
+	PriceRefreshInterval = 5 * time.Minute
+
+	// PriceMaxAge is the age after which the cached price is not used any more.
+	PriceMaxAge = time.Hour
+)
+
+// priceCache holds the median STEEM price in SBD reported by the witnesses.
+// SBD is taken as worth 1 USD, that is what the price feed is about.
+type priceCache struct {
+	steemPrice float64
+	updatedAt  time.Time
+	lock       sync.RWMutex
+}
+
+func newPriceCache() *priceCache {
+	return &priceCache{}
+}
+
+func (cache *priceCache) set(steemPrice float64) {
+	cache.lock.Lock()
+	cache.steemPrice = steemPrice
+	cache.updatedAt = time.Now()
+	cache.lock.Unlock()
+}
+
+// usdValue returns the USD value of the given amount.
+// False is returned when the price is not known or the asset cannot be converted.
+func (cache *priceCache) usdValue(amount float64, symbol string) (float64, bool) {
+	switch symbol {
+	case "SBD":
+		return amount, true
+	case "STEEM":
+		cache.lock.RLock()
+		price, updatedAt := cache.steemPrice, cache.updatedAt
+		cache.lock.RUnlock()
+
+		if price == 0 || time.Since(updatedAt) > PriceMaxAge {
+			return 0, false
+		}
+		return amount * price, true
+	default:
+		return 0, false
+	}
+}
+
+func (processor *BlockProcessor) priceRefresher() error {
+	ticker := time.NewTicker(PriceRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := processor.refreshPrice(); err != nil {
+			log.Printf("failed to refresh the price feed: %+v", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-processor.t.Dying():
+			return nil
+		}
+	}
+}
+
+func (processor *BlockProcessor) refreshPrice() error {
+	raw, err := processor.client.Database.GetCurrentMedianHistoryPriceRaw()
+	if err != nil {
+		return errors.Wrap(err, "failed to get the median price")
+	}
+
+	var price struct {
+		Base  string `json:"base"`
+		Quote string `json:"quote"`
+	}
+	if err := json.Unmarshal([]byte(*raw), &price); err != nil {
+		return errors.Wrap(err, "failed to decode the median price")
+	}
+
+	base, baseSymbol, err := events.ParseAmount(price.Base)
+	if err != nil {
+		return err
+	}
+	quote, quoteSymbol, err := events.ParseAmount(price.Quote)
+	if err != nil {
+		return err
+	}
+	if baseSymbol != "SBD" || quoteSymbol != "STEEM" || quote == 0 {
+		return errors.Errorf("unexpected median price: %v / %v", price.Base, price.Quote)
+	}
+
+	processor.prices.set(base / quote)
+	return nil
+}
+
+// matchesAmount checks the transferred amount against the user's thresholds.
+// The USD threshold is used when possible, otherwise the per-asset threshold applies.
+// An amount that cannot be parsed only matches when there is no threshold set.
+// The returned string describes a mismatch.
+func (processor *BlockProcessor) matchesAmount(settings *db.Settings, amount string) (bool, string) {
+	value, symbol, err := events.ParseAmount(amount)
+	if err != nil {
+		if settings.MinValueUSD != nil || len(settings.MinAmounts) != 0 {
+			return false, err.Error()
+		}
+		return true, ""
+	}
+
+	if min := settings.MinValueUSD; min != nil {
+		if usd, ok := processor.prices.usdValue(value, symbol); ok {
+			if usd < *min {
+				return false, fmt.Sprintf("%v worth $%.2f, less than $%.2f", amount, usd, *min)
+			}
+			return true, ""
+		}
+	}
+
+	if min := settings.MinAmount(symbol); value < min {
+		return false, fmt.Sprintf("%v less than %v %v", amount, min, symbol)
+	}
+	return true, ""
+}
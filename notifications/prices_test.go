@@ -0,0 +1,35 @@
+package notifications
+
+import (
+	"testing"
+
+	"github.com/tchap/steemwatch/server/db"
+)
+
+func TestMatchesAmount(t *testing.T) {
+	minUSD := 10.0
+
+	testCases := []struct {
+		name     string
+		settings db.Settings
+		amount   string
+		matches  bool
+	}{
+		{"no threshold", db.Settings{}, "1.000 STEEM", true},
+		{"above the asset threshold", db.Settings{MinAmounts: map[string]float64{"steem": 5}}, "10.000 STEEM", true},
+		{"below the asset threshold", db.Settings{MinAmounts: map[string]float64{"STEEM": 5}}, "1.000 STEEM", false},
+		{"another asset", db.Settings{MinAmounts: map[string]float64{"STEEM": 5}}, "1.000 SBD", true},
+		{"below the USD threshold", db.Settings{MinValueUSD: &minUSD}, "5.000 SBD", false},
+		{"USD threshold without the price", db.Settings{MinValueUSD: &minUSD}, "5.000 STEEM", true},
+		{"malformed amount without threshold", db.Settings{}, "1.0.0 STEEM", true},
+		{"malformed amount", db.Settings{MinAmounts: map[string]float64{"STEEM": 5}}, "1.0.0 STEEM", false},
+		{"malformed amount with USD threshold", db.Settings{MinValueUSD: &minUSD}, "NaN SBD", false},
+	}
+
+	processor := &BlockProcessor{prices: newPriceCache()}
+	for _, tc := range testCases {
+		if matches, detail := processor.matchesAmount(&tc.settings, tc.amount); matches != tc.matches {
+			t.Errorf("%v: got %v (%v), want %v", tc.name, matches, detail, tc.matches)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package notifications
+
+import (
+	"log"
+	"time"
+
+	"github.com/tchap/steemwatch/notifications/events"
+
+	"github.com/go-steem/rpc"
+	"github.com/go-steem/rpc/types"
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// ProductionRewardFlushInterval is how often the finished daily totals are sent.
+const ProductionRewardFlushInterval = 5 * time.Minute
+
+const productionRewardDayFormat = "2006-01-02"
+
+// ProductionRewardTotal sums up the block production rewards of a witness
+// for a single user and day.
+type ProductionRewardTotal struct {
+	Id         string        `bson:"_id"`
+	OwnerId    bson.ObjectId `bson:"ownerId"`
+	Producer   string        `bson:"producer"`
+	Day        string        `bson:"day"`
+	MicroVests int64         `bson:"microVests"`
+	Blocks     uint          `bson:"blocks"`
+}
+
+// virtualOpTypes are the operation types that are not part of the block transactions.
+// They must be fetched separately using get_ops_in_block.
+var virtualOpTypes = map[types.OpType]bool{
+	events.TypeProducerReward: true,
+	events.TypeHardfork:       true,
+}
+
+// needsVirtualOps returns true when there is a miner for any virtual operation type.
+func (processor *BlockProcessor) needsVirtualOps() bool {
+	for opType := range virtualOpTypes {
+		if _, ok := processor.eventMiners[opType]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// virtualOps fetches the virtual operations for the given block.
+func virtualOps(client *rpc.Client, blockNum uint32) ([]types.Operation, error) {
+	objects, err := client.Database.GetOpsInBlock(blockNum, true)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get virtual operations for block %v", blockNum)
+	}
+
+	ops := make([]types.Operation, 0, len(objects))
+	for _, object := range objects {
+		if virtualOpTypes[object.Operation.Type()] {
+			ops = append(ops, object.Operation)
+		}
+	}
+	return ops, nil
+}
+
+// aggregateProductionReward adds the reward to today's total for the given user.
+func (processor *BlockProcessor) aggregateProductionReward(
+	ownerId bson.ObjectId,
+	event *events.BlockProductionRewardReceived,
+) error {
+	vests, err := events.ParseVests(event.Op.VestingShares)
+	if err != nil {
+		return err
+	}
+
+	day := time.Now().UTC().Format(productionRewardDayFormat)
+	id := ownerId.Hex() + ":" + event.Op.Producer + ":" + day
+
+	update := bson.M{
+		"$setOnInsert": bson.M{
+			"ownerId":  ownerId,
+			"producer": event.Op.Producer,
+			"day":      day,
+		},
+		"$inc": bson.M{
+			"microVests": vests,
+			"blocks":     event.Blocks,
+		},
+	}
+	_, err = processor.db.C("productionRewards").UpsertId(id, update)
+	return errors.Wrapf(err, "failed to update production reward total %v", id)
+}
+
+func (processor *BlockProcessor) productionRewardSender() error {
+	ticker := time.NewTicker(ProductionRewardFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// Nothing is dispatched while the pipeline is paused.
+			if processor.pipeline.Paused() {
+				continue
+			}
+			if err := processor.sendProductionRewardTotals(); err != nil {
+				log.Printf("failed to send production reward totals: %+v", err)
+			}
+
+		case <-processor.t.Dying():
+			return nil
+		}
+	}
+}
+
+// sendProductionRewardTotals dispatches the totals for the days that are over.
+func (processor *BlockProcessor) sendProductionRewardTotals() error {
+	today := time.Now().UTC().Format(productionRewardDayFormat)
+
+	query := bson.M{
+		"day": bson.M{"$lt": today},
+	}
+
+	var total ProductionRewardTotal
+	iter := processor.db.C("productionRewards").Find(query).Iter()
+	for iter.Next(&total) {
+		// Remove the total first so that it is never sent twice.
+		if err := processor.db.C("productionRewards").RemoveId(total.Id); err != nil {
+			log.Printf("failed to remove production reward total %v: %v", total.Id, err)
+			continue
+		}
+
+		processor.DispatchBlockProductionRewardReceivedEvent(total.OwnerId.Hex(),
+			&events.BlockProductionRewardReceived{
+				Op: &events.ProducerRewardOperation{
+					Producer:      total.Producer,
+					VestingShares: events.FormatVests(total.MicroVests),
+				},
+				Blocks: total.Blocks,
+				Day:    total.Day,
+			})
+	}
+	return errors.Wrap(iter.Err(), "failed to iterate production reward totals")
+}
@@ -0,0 +1,133 @@
+package notifications
+
+import (
+	"log"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// RedeliveryPollInterval specifies how often pending redelivery requests are picked up.
+const RedeliveryPollInterval = 5 * time.Second
+
+// Redelivery is a request to send an event from the history again.
+// The requests are inserted by the API and processed by the block processor.
+type Redelivery struct {
+	Id          bson.ObjectId `bson:"_id,omitempty"`
+	OwnerId     bson.ObjectId `bson:"ownerId"`
+	HistoryId   bson.ObjectId `bson:"historyId"`
+	Stream      bool          `bson:"stream"`
+	RequestedAt time.Time     `bson:"requestedAt"`
+	ProcessedAt *time.Time    `bson:"processedAt,omitempty"`
+	Error       string        `bson:"error,omitempty"`
+}
+
+func (processor *BlockProcessor) redeliverer() error {
+	ticker := time.NewTicker(RedeliveryPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// Nothing is dispatched while the pipeline is paused.
+			if processor.pipeline.Paused() {
+				continue
+			}
+			if err := processor.processRedeliveries(); err != nil {
+				log.Printf("failed to process redeliveries: %+v", err)
+			}
+
+		case <-processor.t.Dying():
+			return nil
+		}
+	}
+}
+
+func (processor *BlockProcessor) processRedeliveries() error {
+	for {
+		// Claim the next pending request.
+		change := mgo.Change{
+			Update: bson.M{
+				"$set": bson.M{
+					"processedAt": time.Now(),
+				},
+			},
+			ReturnNew: true,
+		}
+		query := bson.M{
+			"processedAt": bson.M{"$exists": false},
+		}
+
+		var req Redelivery
+		_, err := processor.db.C("redeliveries").Find(query).Sort("requestedAt").Apply(change, &req)
+		if err != nil {
+			if err == mgo.ErrNotFound {
+				return nil
+			}
+			return errors.Wrap(err, "failed to get pending redelivery")
+		}
+
+		if err := processor.redeliver(&req); err != nil {
+			log.Printf("redelivery %v failed: %+v", req.Id.Hex(), err)
+
+			update := bson.M{
+				"$set": bson.M{
+					"error": err.Error(),
+				},
+			}
+			if err := processor.db.C("redeliveries").UpdateId(req.Id, update); err != nil {
+				log.Printf("failed to update redelivery %v: %v", req.Id.Hex(), err)
+			}
+		}
+
+		select {
+		case <-processor.t.Dying():
+			return nil
+		default:
+		}
+	}
+}
+
+// redeliver sends the event through the user's current notifiers,
+// and optionally through the event stream, skipping the filters.
+func (processor *BlockProcessor) redeliver(req *Redelivery) error {
+	userId := req.OwnerId.Hex()
+
+	entry, err := processor.getHistoryEntry(userId, req.HistoryId)
+	if err != nil {
+		return err
+	}
+
+	event, err := entry.Decode()
+	if err != nil {
+		return err
+	}
+
+	user, err := processor.getUser(userId)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get user %v", userId)
+	}
+
+	targets, err := processor.getUserTargets(userId)
+	if err != nil {
+		return err
+	}
+	if req.Stream {
+		var settings bson.Raw
+		for id, dispatcher := range processor.additionalNotifiers {
+			targets = append(targets, &deliveryTarget{
+				notifierId: id,
+				dispatcher: dispatcher,
+				settings:   settings,
+			})
+		}
+	}
+
+	processor.deliver(userId, event, targets, processor.notifierConcurrency(user),
+		func(target *deliveryTarget) error {
+			return notify(target.dispatcher, userId, target.settings, event)
+		}, nil)
+	return nil
+}
@@ -0,0 +1,165 @@
+package notifications
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tchap/steemwatch/notifications/events"
+)
+
+// roundTrips holds every transfer for the window, waiting for the same amount to be sent back.
+// When it is, the two transfers are passed on as a single event annotated with the return,
+// so that the accounts shuffling the funds back and forth don't flood the notifications.
+// The transfers not sent back within the window are passed on unchanged by run,
+// which also passes on all the transfers still held when it is stopped.
+type roundTrips struct {
+	window  time.Duration
+	pending map[string][]*heldTransfer
+	next    uint64
+	stopped bool
+	lock    *sync.Mutex
+
+	dueCh     chan *heldTransfer
+	stoppedCh chan struct{}
+}
+
+type heldTransfer struct {
+	// seq orders the held transfers the way they were made.
+	seq   uint64
+	key   string
+	event *events.TransferMade
+	timer *time.Timer
+	// done is called once the transfer is passed on.
+	done func()
+}
+
+func newRoundTrips(window time.Duration) *roundTrips {
+	return &roundTrips{
+		window:    window,
+		pending:   make(map[string][]*heldTransfer),
+		lock:      &sync.Mutex{},
+		dueCh:     make(chan *heldTransfer),
+		stoppedCh: make(chan struct{}),
+	}
+}
+
+func roundTripKey(from, to, amount string) string {
+	return from + ":" + to + ":" + amount
+}
+
+// hold returns the event to be handled right away, if any. That is the event itself
+// when the detection is disabled, i.e. the window is 0, or run is stopped already,
+// or the coalesced event when the event sends back a held transfer. Otherwise the event
+// is taken over and passed on by run once the window is over, unless it is sent back
+// in the meantime. done is called once the event is passed on, i.e. right away
+// unless the event is held, so that the caller can keep the block of the event from being released.
+func (trips *roundTrips) hold(event *events.TransferMade, done func()) *events.TransferMade {
+	// A self-transfer would only ever be matched with the next one.
+	if trips.window == 0 || event.SelfTransfer() {
+		done()
+		return event
+	}
+
+	op := event.Op
+	reverse := roundTripKey(op.To, op.From, op.Amount)
+
+	trips.lock.Lock()
+	defer trips.lock.Unlock()
+
+	if trips.stopped {
+		done()
+		return event
+	}
+
+	// The oldest transfer is the one sent back. A transfer whose timer has fired already
+	// is being passed on, it just didn't manage to remove itself yet.
+	for _, held := range trips.pending[reverse] {
+		if !held.timer.Stop() {
+			continue
+		}
+		trips.remove(held)
+		held.done()
+		done()
+
+		coalesced := *held.event
+		coalesced.RoundTrip = &events.TransferRoundTrip{Return: op}
+		return &coalesced
+	}
+
+	trips.next++
+	held := &heldTransfer{
+		seq:   trips.next,
+		key:   roundTripKey(op.From, op.To, op.Amount),
+		event: event,
+		done:  done,
+	}
+	held.timer = time.AfterFunc(trips.window, func() {
+		select {
+		case trips.dueCh <- held:
+		case <-trips.stoppedCh:
+		}
+	})
+	trips.pending[held.key] = append(trips.pending[held.key], held)
+	return nil
+}
+
+// run passes the held transfers on to flush once their window is over until dying is closed.
+// The transfers still held then are passed on right away, hold does not hold any more.
+func (trips *roundTrips) run(dying <-chan struct{}, flush func(*events.TransferMade)) {
+	for {
+		select {
+		case held := <-trips.dueCh:
+			trips.lock.Lock()
+			ok := trips.remove(held)
+			trips.lock.Unlock()
+
+			if ok {
+				flush(held.event)
+				held.done()
+			}
+
+		case <-dying:
+			trips.lock.Lock()
+			var held []*heldTransfer
+			for _, queue := range trips.pending {
+				for _, h := range queue {
+					h.timer.Stop()
+					held = append(held, h)
+				}
+			}
+			trips.pending = make(map[string][]*heldTransfer)
+			trips.stopped = true
+			close(trips.stoppedCh)
+			trips.lock.Unlock()
+
+			// Keep the order the transfers were made in.
+			sort.Slice(held, func(i, j int) bool {
+				return held[i].seq < held[j].seq
+			})
+			for _, h := range held {
+				flush(h.event)
+				h.done()
+			}
+			return
+		}
+	}
+}
+
+// remove drops the held transfer. It returns false when the transfer is not held any more.
+// The lock must be held.
+func (trips *roundTrips) remove(held *heldTransfer) bool {
+	queue := trips.pending[held.key]
+	for i, h := range queue {
+		if h == held {
+			queue = append(queue[:i], queue[i+1:]...)
+			if len(queue) == 0 {
+				delete(trips.pending, held.key)
+			} else {
+				trips.pending[held.key] = queue
+			}
+			return true
+		}
+	}
+	return false
+}
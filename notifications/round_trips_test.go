@@ -0,0 +1,136 @@
+package notifications
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tchap/steemwatch/notifications/events"
+
+	"github.com/go-steem/rpc/types"
+)
+
+func transferEvent(from, to, amount string) *events.TransferMade {
+	return &events.TransferMade{
+		Op: &types.TransferOperation{From: from, To: to, Amount: amount},
+	}
+}
+
+func TestRoundTripsHold(t *testing.T) {
+	testCases := []struct {
+		name      string
+		window    time.Duration
+		transfers []*events.TransferMade
+		// passed are the indexes of the transfers returned right away, -1 when held.
+		passed    []int
+		roundTrip []bool
+		done      []bool
+	}{
+		{
+			name:      "disabled",
+			transfers: []*events.TransferMade{transferEvent("alice", "bob", "1.000 STEEM")},
+			passed:    []int{0},
+			roundTrip: []bool{false},
+			done:      []bool{true},
+		},
+		{
+			name:      "self-transfer",
+			window:    time.Hour,
+			transfers: []*events.TransferMade{transferEvent("alice", "alice", "1.000 STEEM")},
+			passed:    []int{0},
+			roundTrip: []bool{false},
+			done:      []bool{true},
+		},
+		{
+			name:   "sent back",
+			window: time.Hour,
+			transfers: []*events.TransferMade{
+				transferEvent("alice", "bob", "1.000 STEEM"),
+				transferEvent("bob", "alice", "1.000 STEEM"),
+			},
+			passed:    []int{-1, 0},
+			roundTrip: []bool{false, true},
+			done:      []bool{true, true},
+		},
+		{
+			name:   "different amount",
+			window: time.Hour,
+			transfers: []*events.TransferMade{
+				transferEvent("alice", "bob", "1.000 STEEM"),
+				transferEvent("bob", "alice", "2.000 STEEM"),
+			},
+			passed:    []int{-1, -1},
+			roundTrip: []bool{false, false},
+			done:      []bool{false, false},
+		},
+	}
+
+	for _, tc := range testCases {
+		trips := newRoundTrips(tc.window)
+		done := make([]bool, len(tc.transfers))
+		for i, transfer := range tc.transfers {
+			i := i
+			passed := trips.hold(transfer, func() { done[i] = true })
+			switch {
+			case tc.passed[i] == -1 && passed != nil:
+				t.Errorf("%v: transfer %v not held", tc.name, i)
+			case tc.passed[i] != -1 && passed == nil:
+				t.Errorf("%v: transfer %v held", tc.name, i)
+			case passed != nil && (passed.RoundTrip != nil) != tc.roundTrip[i]:
+				t.Errorf("%v: transfer %v: got round trip %v, want %v", tc.name, i, passed.RoundTrip, tc.roundTrip[i])
+			}
+		}
+		for i := range tc.transfers {
+			if done[i] != tc.done[i] {
+				t.Errorf("%v: transfer %v: got done %v, want %v", tc.name, i, done[i], tc.done[i])
+			}
+		}
+	}
+}
+
+func TestRoundTripsRun(t *testing.T) {
+	trips := newRoundTrips(10 * time.Millisecond)
+	var (
+		flushed []*events.TransferMade
+		done    int
+		dying   = make(chan struct{})
+		stopped = make(chan struct{})
+	)
+	go func() {
+		trips.run(dying, func(event *events.TransferMade) { flushed = append(flushed, event) })
+		close(stopped)
+	}()
+
+	first := transferEvent("alice", "bob", "1.000 STEEM")
+	trips.hold(first, func() { done++ })
+
+	// The window is over, the transfer is passed on.
+	time.Sleep(50 * time.Millisecond)
+
+	trips.window = time.Hour
+	second := transferEvent("carol", "dave", "1.000 STEEM")
+	third := transferEvent("erin", "frank", "1.000 STEEM")
+	trips.hold(second, func() { done++ })
+	trips.hold(third, func() { done++ })
+
+	// Stopping passes on the transfers still held in the order they were made.
+	close(dying)
+	<-stopped
+
+	want := []*events.TransferMade{first, second, third}
+	if len(flushed) != len(want) {
+		t.Fatalf("got %v transfers passed on, want %v", len(flushed), len(want))
+	}
+	for i := range want {
+		if flushed[i] != want[i] {
+			t.Errorf("transfer %v: got %v, want %v", i, flushed[i].Op, want[i].Op)
+		}
+	}
+	if done != len(want) {
+		t.Errorf("got %v transfers done, want %v", done, len(want))
+	}
+
+	// Once stopped, nothing is held.
+	if passed := trips.hold(transferEvent("alice", "bob", "1.000 STEEM"), func() { done++ }); passed == nil {
+		t.Error("transfer held after stopped")
+	}
+}
@@ -8,14 +8,18 @@ import (
 
 type ConnectFunc func() (*rpc.Client, error)
 
+// Run starts processing the blocks using the block fetcher.
+//
+// The block fetcher only passes on the blocks up to the last irreversible block,
+// so the events are never mined from a block that later gets orphaned in a micro-fork
+// and there is nothing to revert. The price paid is the latency of the irreversibility,
+// i.e. the events are dispatched about a minute after the operation was included in a block.
 func Run(
 	client *rpc.Client,
 	connect ConnectFunc,
 	db *mgo.Database,
 	opts ...Option,
 ) (*blockfetcher.Context, error) {
-	initNotifiers()
-
 	processor, err := New(client, connect, db, opts...)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,44 @@
+package notifications
+
+import (
+	"sync"
+
+	"github.com/tchap/steemwatch/server/db"
+)
+
+// sampler thins out the broad subscriptions, e.g. a tag or the custom_json firehose,
+// according to the subscription settings. It keeps the state per (user, event kind).
+type sampler struct {
+	counters map[string]uint
+	limiter  *firehoseLimiter
+	lock     sync.Mutex
+}
+
+func newSampler() *sampler {
+	return &sampler{
+		counters: make(map[string]uint),
+		limiter:  newFirehoseLimiter(),
+	}
+}
+
+// sample returns true when the event is to be delivered to the user.
+// Every Nth event is taken first, then the per-minute limit is applied.
+func (s *sampler) sample(userId, kind string, settings *db.Settings) bool {
+	key := userId + ":" + kind
+
+	if n := settings.SampleEvery; n != nil && *n > 1 {
+		s.lock.Lock()
+		i := s.counters[key]
+		s.counters[key] = (i + 1) % *n
+		s.lock.Unlock()
+
+		if i != 0 {
+			return false
+		}
+	}
+
+	if rate := settings.SampleRatePerMinute; rate != nil && *rate != 0 {
+		return s.limiter.allow(key, *rate)
+	}
+	return true
+}
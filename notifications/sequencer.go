@@ -0,0 +1,249 @@
+package notifications
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-steem/rpc/types"
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"gopkg.in/tomb.v2"
+)
+
+// SequencedNotifier is implemented by the notifiers that can pass
+// the per-user sequence number on to the client, e.g. the event stream.
+// Sequenced returns a view of the notifier that stamps the events with seq.
+type SequencedNotifier interface {
+	Sequenced(seq uint64) Notifier
+}
+
+// eventPosition is the position of an event in the blockchain.
+// The index orders the events mined from the same block.
+type eventPosition struct {
+	block uint32
+	index uint32
+
+	// timestamp is the timestamp of the block, it does not affect the order.
+	timestamp time.Time
+	// op is the operation the event was mined from, see OperationNotifier.
+	op types.Operation
+}
+
+func (pos eventPosition) before(other eventPosition) bool {
+	if pos.block != other.block {
+		return pos.block < other.block
+	}
+	return pos.index < other.index
+}
+
+type sequencedDelivery struct {
+	pos     *eventPosition
+	deliver func(seq uint64)
+}
+
+// sequencer delivers the events of the users that requested ordered delivery
+// strictly in block order, no matter which worker mined them.
+//
+// An event is released once all the preceding blocks were processed and there is
+// no dispatch in flight for any event mined from a block not after the event's block.
+// Released events get the next sequence number of the user and are delivered one by one.
+type sequencer struct {
+	// t runs the goroutines draining the ready queues, so that the processor waits for them.
+	t  *tomb.Tomb
+	db *mgo.Database
+
+	positions map[interface{}]eventPosition
+	pending   map[uint32]int
+	nextBlock uint32
+
+	waiting  map[string][]*sequencedDelivery
+	ready    map[string][]*sequencedDelivery
+	draining map[string]bool
+
+	lock *sync.Mutex
+}
+
+func newSequencer(t *tomb.Tomb, db *mgo.Database, nextBlock uint32) *sequencer {
+	return &sequencer{
+		t:         t,
+		db:        db,
+		positions: make(map[interface{}]eventPosition),
+		pending:   make(map[uint32]int),
+		nextBlock: nextBlock,
+		waiting:   make(map[string][]*sequencedDelivery),
+		ready:     make(map[string][]*sequencedDelivery),
+		draining:  make(map[string]bool),
+		lock:      &sync.Mutex{},
+	}
+}
+
+// track remembers the position of the event mined by a worker.
+func (seq *sequencer) track(event interface{}, pos eventPosition) {
+	seq.lock.Lock()
+	seq.positions[event] = pos
+	seq.lock.Unlock()
+}
+
+func (seq *sequencer) position(event interface{}) (*eventPosition, bool) {
+	seq.lock.Lock()
+	defer seq.lock.Unlock()
+	pos, ok := seq.positions[event]
+	if !ok {
+		return nil, false
+	}
+	return &pos, true
+}
+
+// begin must be called synchronously before the event is dispatched asynchronously.
+// The returned function must be called once the dispatch is finished.
+func (seq *sequencer) begin(event interface{}) func() {
+	seq.lock.Lock()
+	pos, ok := seq.positions[event]
+	if ok {
+		seq.pending[pos.block]++
+	}
+	seq.lock.Unlock()
+
+	if !ok {
+		return func() {}
+	}
+	return func() {
+		seq.lock.Lock()
+		defer seq.lock.Unlock()
+		if seq.pending[pos.block]--; seq.pending[pos.block] == 0 {
+			delete(seq.pending, pos.block)
+		}
+		seq.release()
+	}
+}
+
+// ack is called every time the number of the next block to be processed is moved forward.
+func (seq *sequencer) ack(nextBlock uint32) {
+	seq.lock.Lock()
+	defer seq.lock.Unlock()
+
+	seq.nextBlock = nextBlock
+	for event, pos := range seq.positions {
+		if pos.block < nextBlock && seq.pending[pos.block] == 0 {
+			delete(seq.positions, event)
+		}
+	}
+	seq.release()
+}
+
+// submit queues the delivery for the user. Deliveries without a position,
+// i.e. the events that do not come from a block, are delivered right away.
+func (seq *sequencer) submit(userId string, pos *eventPosition, deliver func(seq uint64)) {
+	seq.lock.Lock()
+	defer seq.lock.Unlock()
+
+	delivery := &sequencedDelivery{pos, deliver}
+	if pos == nil {
+		seq.enqueue(userId, delivery)
+		return
+	}
+
+	queue := seq.waiting[userId]
+	i := sort.Search(len(queue), func(i int) bool {
+		return pos.before(*queue[i].pos)
+	})
+	queue = append(queue, nil)
+	copy(queue[i+1:], queue[i:])
+	queue[i] = delivery
+	seq.waiting[userId] = queue
+
+	seq.release()
+}
+
+// release moves the deliveries that can be delivered already to the ready queues.
+// The lock must be held.
+func (seq *sequencer) release() {
+	for userId, queue := range seq.waiting {
+		n := 0
+		for _, delivery := range queue {
+			if !seq.releasable(delivery.pos.block) {
+				break
+			}
+			seq.enqueue(userId, delivery)
+			n++
+		}
+
+		if n == len(queue) {
+			delete(seq.waiting, userId)
+		} else {
+			seq.waiting[userId] = queue[n:]
+		}
+	}
+}
+
+func (seq *sequencer) releasable(block uint32) bool {
+	if block >= seq.nextBlock {
+		return false
+	}
+	for b := range seq.pending {
+		if b <= block {
+			return false
+		}
+	}
+	return true
+}
+
+// enqueue appends the delivery to the ready queue of the user and makes sure it is drained.
+// The lock must be held.
+func (seq *sequencer) enqueue(userId string, delivery *sequencedDelivery) {
+	seq.ready[userId] = append(seq.ready[userId], delivery)
+	if !seq.draining[userId] {
+		seq.draining[userId] = true
+		seq.t.Go(func() error {
+			seq.drain(userId)
+			return nil
+		})
+	}
+}
+
+func (seq *sequencer) drain(userId string) {
+	for {
+		seq.lock.Lock()
+		queue := seq.ready[userId]
+		if len(queue) == 0 {
+			delete(seq.ready, userId)
+			delete(seq.draining, userId)
+			seq.lock.Unlock()
+			return
+		}
+		delivery := queue[0]
+		seq.ready[userId] = queue[1:]
+		seq.lock.Unlock()
+
+		// The event is still delivered when the sequence number cannot be assigned,
+		// just without the number, which the client can tell.
+		n, err := seq.nextSequence(userId)
+		if err != nil {
+			log.Printf("failed to assign sequence number for user %v: %+v", userId, err)
+		}
+		delivery.deliver(n)
+	}
+}
+
+// nextSequence increments and returns the sequence number of the user.
+func (seq *sequencer) nextSequence(userId string) (uint64, error) {
+	change := mgo.Change{
+		Update: bson.M{
+			"$inc": bson.M{
+				"sequence": 1,
+			},
+		},
+		ReturnNew: true,
+	}
+
+	var doc struct {
+		Sequence int64 `bson:"sequence"`
+	}
+	if _, err := seq.db.C("users").FindId(bson.ObjectIdHex(userId)).Apply(change, &doc); err != nil {
+		return 0, errors.Wrap(err, "failed to increment sequence number")
+	}
+	return uint64(doc.Sequence), nil
+}
@@ -0,0 +1,278 @@
+package notifications
+
+import (
+	"log"
+	"sort"
+	"time"
+
+	"github.com/tchap/steemwatch/notifications/events"
+	"github.com/tchap/steemwatch/server/routes/api/profile"
+
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	// SummaryCheckInterval specifies how often the users are checked for due daily summaries.
+	SummaryCheckInterval = time.Minute
+
+	// MaxSummaryVoters is the number of voters listed in the daily summary.
+	MaxSummaryVoters = 5
+
+	// MaxSummaryNotable is the number of notable events listed in the daily summary.
+	MaxSummaryNotable = 10
+)
+
+// notableKinds are the event kinds listed in the notable section of the daily summary.
+var notableKinds = map[string]bool{
+	"account.updated":        true,
+	"transfer.new_payer":     true,
+	"community.role_changed": true,
+	"witness.feed_stale":     true,
+}
+
+// SummaryRecord remembers the last daily summary sent to a user,
+// so that every summary is sent exactly once even across restarts.
+type SummaryRecord struct {
+	OwnerId bson.ObjectId `bson:"_id"`
+	LastDue time.Time     `bson:"lastDue"`
+}
+
+type summaryUser struct {
+	Id       bson.ObjectId `bson:"_id"`
+	Accounts []string      `bson:"accounts"`
+	Settings struct {
+		DailySummary *profile.DailySummary `bson:"dailySummary"`
+	} `bson:"settings"`
+}
+
+func (processor *BlockProcessor) summarySender() error {
+	ticker := time.NewTicker(SummaryCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// Nothing is dispatched while the pipeline is paused.
+			if processor.pipeline.Paused() {
+				continue
+			}
+			if err := processor.sendSummaries(); err != nil {
+				log.Printf("failed to send daily summaries: %+v", err)
+			}
+
+		case <-processor.t.Dying():
+			return nil
+		}
+	}
+}
+
+// sendSummaries delivers the daily summaries that are due.
+func (processor *BlockProcessor) sendSummaries() error {
+	query := bson.M{
+		"settings.dailySummary.time": bson.M{"$nin": []interface{}{nil, ""}},
+	}
+	selector := bson.M{
+		"accounts":              1,
+		"settings.dailySummary": 1,
+	}
+
+	var users []*summaryUser
+	if err := processor.db.C("users").Find(query).Select(selector).All(&users); err != nil {
+		return errors.Wrap(err, "failed to get users with daily summaries")
+	}
+
+	now := time.Now()
+	for _, user := range users {
+		if err := processor.sendSummary(user, now); err != nil {
+			log.Printf("failed to send daily summary to user %v: %+v", user.Id.Hex(), err)
+		}
+	}
+	return nil
+}
+
+func (processor *BlockProcessor) sendSummary(user *summaryUser, now time.Time) error {
+	settings := user.Settings.DailySummary
+	due, err := settings.Due(now)
+	if err != nil {
+		return err
+	}
+
+	var record SummaryRecord
+	err = processor.db.C("dailySummaries").FindId(user.Id).One(&record)
+	if err != nil && err != mgo.ErrNotFound {
+		return errors.Wrap(err, "failed to get the last daily summary")
+	}
+	first := err == mgo.ErrNotFound
+	if !record.LastDue.Before(due) {
+		return nil
+	}
+
+	// Mark the summary as sent first, a summary that fails to be delivered is not sent again.
+	record = SummaryRecord{user.Id, due}
+	if _, err := processor.db.C("dailySummaries").UpsertId(user.Id, &record); err != nil {
+		return errors.Wrap(err, "failed to store the last daily summary")
+	}
+	// The summaries start with the day after they are enabled,
+	// otherwise enabling them would send the last one right away.
+	if first {
+		return nil
+	}
+
+	summary, err := processor.summarize(user, due)
+	if err != nil {
+		return err
+	}
+
+	userId := user.Id.Hex()
+	doc, err := processor.getUser(userId)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get user %v", userId)
+	}
+	targets, err := processor.getUserTargets(userId)
+	if err != nil {
+		return err
+	}
+
+	processor.deliver(userId, summary, targets, processor.notifierConcurrency(doc),
+		func(target *deliveryTarget) error {
+			return target.dispatcher.DispatchDailySummary(userId, target.settings, summary)
+		}, nil)
+	return nil
+}
+
+// summarize sums up the history of the user for the day before the due time.
+func (processor *BlockProcessor) summarize(user *summaryUser, due time.Time) (*events.DailySummary, error) {
+	summary := &events.DailySummary{
+		Day:      due.Format("2006-01-02"),
+		Since:    due.AddDate(0, 0, -1),
+		Until:    due,
+		Sections: user.Settings.DailySummary.Sections,
+	}
+
+	own := make(map[string]bool, len(user.Accounts))
+	for _, account := range user.Accounts {
+		own[account] = true
+	}
+
+	var (
+		flows   = make(map[string]*events.AssetFlow)
+		rewards = make(map[string]*events.AssetTotal)
+		voters  = make(map[string]*events.VoterCount)
+	)
+	addReward := func(amount float64, symbol string) {
+		total, ok := rewards[symbol]
+		if !ok {
+			total = &events.AssetTotal{Symbol: symbol}
+			rewards[symbol] = total
+		}
+		total.Amount += amount
+	}
+	addVote := func(voter string) {
+		count, ok := voters[voter]
+		if !ok {
+			count = &events.VoterCount{Voter: voter}
+			voters[voter] = count
+		}
+		count.Votes++
+	}
+
+	query := bson.M{
+		"ownerId":   user.Id,
+		"createdAt": bson.M{"$gte": summary.Since, "$lt": summary.Until},
+		"eventKind": bson.M{"$ne": HistoryGapKind},
+	}
+
+	var entry HistoryEntry
+	iter := processor.db.C("history").Find(query).Sort("seq", "createdAt").Iter()
+	for iter.Next(&entry) {
+		event, err := entry.Decode()
+		if err != nil {
+			log.Printf("skipping history entry %v in the daily summary: %+v", entry.Id.Hex(), err)
+			continue
+		}
+		summary.Events++
+
+		if notableKinds[entry.EventKind] && len(summary.Notable) < MaxSummaryNotable {
+			summary.Notable = append(summary.Notable, events.DefaultTitle(event))
+		}
+
+		switch event := event.(type) {
+		case *events.UserMentioned:
+			summary.Mentions++
+
+		case *events.TransferMade:
+			// Only the transfers from and to the user's own accounts move the user's funds.
+			if own[event.Op.From] == own[event.Op.To] {
+				continue
+			}
+			amount, symbol, err := events.ParseAmount(event.Op.Amount)
+			if err != nil {
+				continue
+			}
+			flow, ok := flows[symbol]
+			if !ok {
+				flow = &events.AssetFlow{Symbol: symbol}
+				flows[symbol] = flow
+			}
+			// A round trip moves the amount both ways.
+			switch {
+			case event.RoundTrip != nil:
+				flow.In += amount
+				flow.Out += amount
+			case own[event.Op.To]:
+				flow.In += amount
+			default:
+				flow.Out += amount
+			}
+
+		case *events.StoryVoted:
+			addVote(event.Op.Voter)
+
+		case *events.CommentVoted:
+			addVote(event.Op.Voter)
+
+		case *events.PostPaidOut:
+			if amount, symbol, err := events.ParseAmount(event.Content.TotalPayoutValue); err == nil {
+				addReward(amount, symbol)
+			}
+
+		case *events.BlockProductionRewardReceived:
+			if vests, err := events.ParseVests(event.Op.VestingShares); err == nil {
+				addReward(float64(vests)/1e6, "VESTS")
+			}
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, errors.Wrapf(err, "failed to get the history of user %v", user.Id.Hex())
+	}
+
+	for _, flow := range flows {
+		summary.Flows = append(summary.Flows, flow)
+	}
+	for _, total := range rewards {
+		summary.Rewards = append(summary.Rewards, total)
+	}
+	for _, count := range voters {
+		summary.TopVoters = append(summary.TopVoters, count)
+	}
+
+	sort.Slice(summary.Flows, func(i, j int) bool {
+		return summary.Flows[i].Symbol < summary.Flows[j].Symbol
+	})
+	sort.Slice(summary.Rewards, func(i, j int) bool {
+		return summary.Rewards[i].Symbol < summary.Rewards[j].Symbol
+	})
+	sort.Slice(summary.TopVoters, func(i, j int) bool {
+		a, b := summary.TopVoters[i], summary.TopVoters[j]
+		if a.Votes != b.Votes {
+			return a.Votes > b.Votes
+		}
+		return a.Voter < b.Voter
+	})
+	if len(summary.TopVoters) > MaxSummaryVoters {
+		summary.TopVoters = summary.TopVoters[:MaxSummaryVoters]
+	}
+	return summary, nil
+}
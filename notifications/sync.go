@@ -0,0 +1,62 @@
+package notifications
+
+import (
+	"log"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// SyncStatusInterval is how often the head block of the node is checked.
+	SyncStatusInterval = 10 * time.Second
+
+	// SyncedMaxLag is the number of blocks the processor can be behind the head block
+	// while still being considered synced.
+	SyncedMaxLag = 30
+)
+
+// SyncStatus is the head block of the node as seen by the block processor.
+// The document is stored in the configuration collection periodically
+// so that the web server can report how far behind the processor is.
+type SyncStatus struct {
+	Id                       string    `bson:"_id"`
+	HeadBlockNum             uint32    `bson:"headBlockNum"`
+	LastIrreversibleBlockNum uint32    `bson:"lastIrreversibleBlockNum"`
+	UpdatedAt                time.Time `bson:"updatedAt"`
+}
+
+const SyncStatusId = "SyncStatus"
+
+func (processor *BlockProcessor) syncTracker() error {
+	ticker := time.NewTicker(SyncStatusInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := processor.storeSyncStatus(); err != nil {
+			log.Printf("failed to update sync status: %+v", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-processor.t.Dying():
+			return nil
+		}
+	}
+}
+
+func (processor *BlockProcessor) storeSyncStatus() error {
+	props, err := processor.client.Database.GetDynamicGlobalProperties()
+	if err != nil {
+		return errors.Wrap(err, "failed to get steemd dynamic global properties")
+	}
+
+	status := &SyncStatus{
+		Id:                       SyncStatusId,
+		HeadBlockNum:             uint32(props.HeadBlockNumber),
+		LastIrreversibleBlockNum: props.LastIrreversibleBlockNum,
+		UpdatedAt:                time.Now(),
+	}
+	_, err = processor.db.C("configuration").UpsertId(status.Id, status)
+	return errors.Wrap(err, "failed to store sync status")
+}
@@ -0,0 +1,156 @@
+package notifications
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/tchap/steemwatch/notifications/events"
+
+	"github.com/go-steem/rpc/apis/database"
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	// DefaultMaxAutoThreads is the number of threads watched automatically per user.
+	// The subscription that would expire first is dropped when the cap is reached.
+	DefaultMaxAutoThreads = 50
+
+	// DefaultAutoThreadExpiry is how long a thread is watched after the user last commented in it.
+	DefaultAutoThreadExpiry = 7 * 24 * time.Hour
+)
+
+// ThreadSubscription makes the user receive all comments posted under the root post.
+// It is created automatically when one of the user's accounts comments in the thread.
+type ThreadSubscription struct {
+	Id           bson.ObjectId `bson:"_id,omitempty"`
+	OwnerId      bson.ObjectId `bson:"ownerId"`
+	RootAuthor   string        `bson:"rootAuthor"`
+	RootPermlink string        `bson:"rootPermlink"`
+	ExpiresAt    time.Time     `bson:"expiresAt"`
+}
+
+// threadRoot returns the root post of the thread the content belongs to.
+// The root is taken from the content URL, which is /category/@author/permlink#@...
+func threadRoot(content *database.Content) (author, permlink string, ok bool) {
+	path := content.URL
+	if i := strings.IndexByte(path, '#'); i != -1 {
+		path = path[:i]
+	}
+
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) < 2 {
+		return "", "", false
+	}
+	author, permlink = parts[len(parts)-2], parts[len(parts)-1]
+	if !strings.HasPrefix(author, "@") || len(author) == 1 || permlink == "" {
+		return "", "", false
+	}
+	return author[1:], permlink, true
+}
+
+// handleThreads refreshes the thread subscriptions of the users that own the comment author
+// and dispatches the comment to the users watching the thread. The users in notified
+// have already received the comment, so they are skipped.
+func (processor *BlockProcessor) handleThreads(
+	event *events.CommentPublished,
+	notified map[bson.ObjectId]struct{},
+) error {
+
+	rootAuthor, rootPermlink, ok := threadRoot(event.Content)
+	if !ok {
+		return nil
+	}
+
+	// Find the users owning the comment author. They are not notified about their own comments.
+	var owners []struct {
+		Id bson.ObjectId `bson:"_id"`
+
+		Settings struct {
+			AutoWatchThreads bool `bson:"autoWatchThreads"`
+		} `bson:"settings"`
+	}
+	query := bson.M{
+		"accounts": event.Content.Author,
+	}
+	selector := bson.M{
+		"settings.autoWatchThreads": 1,
+	}
+	if err := processor.db.C("users").Find(query).Select(selector).All(&owners); err != nil {
+		return errors.Wrap(err, "failed to get comment author owners")
+	}
+
+	isOwner := make(map[bson.ObjectId]struct{}, len(owners))
+	for _, owner := range owners {
+		isOwner[owner.Id] = struct{}{}
+
+		if owner.Settings.AutoWatchThreads && !event.Edited {
+			if err := processor.watchThread(owner.Id, rootAuthor, rootPermlink); err != nil {
+				log.Printf("failed to watch thread @%v/%v for user %v: %+v",
+					rootAuthor, rootPermlink, owner.Id.Hex(), err)
+			}
+		}
+	}
+
+	query = bson.M{
+		"rootAuthor":   rootAuthor,
+		"rootPermlink": rootPermlink,
+		"expiresAt":    bson.M{"$gt": time.Now()},
+	}
+
+	var sub ThreadSubscription
+	iter := processor.db.C("threadSubscriptions").Find(query).Iter()
+	for iter.Next(&sub) {
+		if _, ok := notified[sub.OwnerId]; ok {
+			continue
+		}
+		if _, ok := isOwner[sub.OwnerId]; ok {
+			continue
+		}
+		processor.DispatchCommentPublishedEvent(sub.OwnerId.Hex(), event)
+	}
+	return errors.Wrap(iter.Err(), "failed get thread subscriptions")
+}
+
+func (processor *BlockProcessor) watchThread(ownerId bson.ObjectId, rootAuthor, rootPermlink string) error {
+	c := processor.db.C("threadSubscriptions")
+
+	selector := bson.M{
+		"ownerId":      ownerId,
+		"rootAuthor":   rootAuthor,
+		"rootPermlink": rootPermlink,
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"expiresAt": time.Now().Add(DefaultAutoThreadExpiry),
+		},
+	}
+	if _, err := c.Upsert(selector, update); err != nil {
+		return errors.Wrap(err, "failed to upsert thread subscription")
+	}
+
+	// Enforce the cap.
+	query := bson.M{
+		"ownerId": ownerId,
+	}
+	n, err := c.Find(query).Count()
+	if err != nil {
+		return errors.Wrap(err, "failed to count thread subscriptions")
+	}
+	if n <= DefaultMaxAutoThreads {
+		return nil
+	}
+
+	var stale []ThreadSubscription
+	err = c.Find(query).Sort("expiresAt").Limit(n - DefaultMaxAutoThreads).Select(bson.M{"_id": 1}).All(&stale)
+	if err != nil {
+		return errors.Wrap(err, "failed to get stale thread subscriptions")
+	}
+	ids := make([]bson.ObjectId, 0, len(stale))
+	for _, s := range stale {
+		ids = append(ids, s.Id)
+	}
+	_, err = c.RemoveAll(bson.M{"_id": bson.M{"$in": ids}})
+	return errors.Wrap(err, "failed to remove stale thread subscriptions")
+}
@@ -0,0 +1,54 @@
+package notifications
+
+import (
+	"log"
+	"text/template"
+
+	"github.com/tchap/steemwatch/notifications/events"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// TitledNotifier is implemented by the notifiers that display a title
+// separately from the message body. The title is rendered for every user
+// from the user's title template for the event kind, falling back to the default.
+type TitledNotifier interface {
+	DispatchTitled(userId string, userSettings bson.Raw, event interface{}, title string) error
+}
+
+// userEvent applies the per-user changes to the event
+// that the typed dispatch functions apply, e.g. the exchange annotation.
+func (processor *BlockProcessor) userEvent(user *UserDoc, event interface{}) interface{} {
+	switch event := event.(type) {
+	case *events.TransferMade:
+		return processor.annotateTransfer(user, event)
+	default:
+		return event
+	}
+}
+
+// compileTitles parses the title templates of the user. The templates that fail to parse
+// are logged and skipped, so the default titles are used instead.
+func (user *UserDoc) compileTitles(userId string) {
+	user.titleTemplates = make(map[string]*template.Template, len(user.Settings.TitleTemplates))
+	for kind, text := range user.Settings.TitleTemplates {
+		if text == "" {
+			continue
+		}
+		tmpl, err := events.ParseTitleTemplate(text)
+		if err != nil {
+			log.Printf("user %v: %v: %v", userId, kind, err)
+			continue
+		}
+		user.titleTemplates[kind] = tmpl
+	}
+}
+
+// eventTitle renders the title of the event for the given user.
+func (user *UserDoc) eventTitle(userId string, event interface{}) string {
+	title, err := events.RenderTitle(event, user.titleTemplates[eventKind(event)])
+	if err != nil {
+		log.Printf("user %v: %v: %v", userId, eventKind(event), err)
+	}
+	return title
+}
@@ -0,0 +1,193 @@
+package notifications
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	// DefaultTraceDuration is how long trace mode stays on when no duration is requested.
+	DefaultTraceDuration = 15 * time.Minute
+
+	// MaxTraceDuration limits how long trace mode can be turned on at once.
+	MaxTraceDuration = 2 * time.Hour
+
+	// TraceRetention is how long the trace entries are kept.
+	TraceRetention = 24 * time.Hour
+
+	// TraceRefreshInterval is how often the list of the users in trace mode is reloaded.
+	TraceRefreshInterval = 30 * time.Second
+)
+
+const (
+	TracePassed    = "passed"
+	TraceRejected  = "rejected"
+	TraceHeld      = "held"
+	TraceDelivered = "delivered"
+	TraceFailed    = "failed"
+	TraceSkipped   = "skipped"
+)
+
+// TraceEntry records how a candidate event was processed for a user in trace mode.
+type TraceEntry struct {
+	Id        bson.ObjectId `json:"id"        bson:"_id,omitempty"`
+	OwnerId   bson.ObjectId `json:"-"         bson:"ownerId"`
+	EventKind string        `json:"eventKind" bson:"eventKind"`
+	EventId   string        `json:"eventId"   bson:"eventId"`
+	Steps     []*TraceStep  `json:"steps"     bson:"steps"`
+	CreatedAt time.Time     `json:"createdAt" bson:"createdAt"`
+}
+
+// TraceStep is a single decision made when processing the event.
+type TraceStep struct {
+	Stage   string    `json:"stage"            bson:"stage"`
+	Outcome string    `json:"outcome"          bson:"outcome"`
+	Detail  string    `json:"detail,omitempty" bson:"detail,omitempty"`
+	At      time.Time `json:"at"               bson:"at"`
+}
+
+// tracedUsers is the set of the users in trace mode, reloaded periodically from the database.
+type tracedUsers struct {
+	until map[string]time.Time
+	lock  sync.RWMutex
+}
+
+func newTracedUsers() *tracedUsers {
+	return &tracedUsers{
+		until: make(map[string]time.Time),
+	}
+}
+
+func (users *tracedUsers) contains(userId string) bool {
+	users.lock.RLock()
+	until, ok := users.until[userId]
+	users.lock.RUnlock()
+	return ok && time.Now().Before(until)
+}
+
+func (users *tracedUsers) reset(until map[string]time.Time) {
+	users.lock.Lock()
+	users.until = until
+	users.lock.Unlock()
+}
+
+// eventTrace collects the steps for a single (user, event) pair.
+// All the methods can be called on nil, which is what users not in trace mode get.
+type eventTrace struct {
+	processor *BlockProcessor
+	entry     *TraceEntry
+	lock      sync.Mutex
+}
+
+// startTrace returns a new trace for the event when the user is in trace mode, nil otherwise.
+func (processor *BlockProcessor) startTrace(userId string, event interface{}) *eventTrace {
+	if !processor.traced.contains(userId) {
+		return nil
+	}
+	return &eventTrace{
+		processor: processor,
+		entry: &TraceEntry{
+			Id:        bson.NewObjectId(),
+			OwnerId:   bson.ObjectIdHex(userId),
+			EventKind: eventKind(event),
+			EventId:   eventId(event),
+			CreatedAt: time.Now(),
+		},
+	}
+}
+
+func (trace *eventTrace) step(stage, outcome, format string, args ...interface{}) {
+	if trace == nil {
+		return
+	}
+	s := &TraceStep{
+		Stage:   stage,
+		Outcome: outcome,
+		At:      time.Now(),
+	}
+	if format != "" {
+		s.Detail = fmt.Sprintf(format, args...)
+	}
+
+	trace.lock.Lock()
+	trace.entry.Steps = append(trace.entry.Steps, s)
+	trace.lock.Unlock()
+}
+
+// reject records the final step of an event that is not going any further and saves the trace.
+func (trace *eventTrace) reject(stage, format string, args ...interface{}) {
+	trace.step(stage, TraceRejected, format, args...)
+	trace.save()
+}
+
+func (trace *eventTrace) save() {
+	if trace == nil {
+		return
+	}
+	trace.lock.Lock()
+	defer trace.lock.Unlock()
+	if err := trace.processor.db.C("traces").Insert(trace.entry); err != nil {
+		log.Printf("failed to store trace entry for user %v: %v", trace.entry.OwnerId.Hex(), err)
+	}
+}
+
+// traceRejected records the event being rejected for the user before it got to dispatching,
+// i.e. by the per-kind filters applied when looking up the target users.
+func (processor *BlockProcessor) traceRejected(
+	userId string,
+	event interface{},
+	stage string,
+	format string,
+	args ...interface{},
+) {
+	processor.startTrace(userId, event).reject(stage, format, args...)
+}
+
+func (processor *BlockProcessor) traceRefresher() error {
+	ticker := time.NewTicker(TraceRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := processor.refreshTracedUsers(); err != nil {
+			log.Printf("failed to refresh the users in trace mode: %+v", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-processor.t.Dying():
+			return nil
+		}
+	}
+}
+
+func (processor *BlockProcessor) refreshTracedUsers() error {
+	query := bson.M{
+		"traceUntil": bson.M{"$gt": time.Now()},
+	}
+	selector := bson.M{
+		"traceUntil": 1,
+	}
+
+	var (
+		doc struct {
+			Id         bson.ObjectId `bson:"_id"`
+			TraceUntil time.Time     `bson:"traceUntil"`
+		}
+		until = make(map[string]time.Time)
+	)
+	iter := processor.db.C("users").Find(query).Select(selector).Iter()
+	for iter.Next(&doc) {
+		until[doc.Id.Hex()] = doc.TraceUntil
+	}
+	if err := iter.Err(); err != nil {
+		return errors.Wrap(err, "failed to get the users in trace mode")
+	}
+
+	processor.traced.reset(until)
+	return nil
+}
@@ -0,0 +1,57 @@
+package notifications
+
+import (
+	"github.com/tchap/steemwatch/notifications/events"
+)
+
+// transferMatch returns which side of the transfer is in the watched accounts,
+// nil when neither is. The paused accounts are not considered watched.
+func transferMatch(event *events.TransferMade, accounts, paused []string) *events.TransferMatch {
+	watched := func(account string) bool {
+		return stringInSlice(accounts, account) && !stringInSlice(paused, account)
+	}
+
+	var (
+		to   = watched(event.Op.To)
+		from = watched(event.Op.From)
+	)
+	switch {
+	case to:
+		return &events.TransferMatch{
+			Account:  event.Op.To,
+			Incoming: true,
+			Internal: from,
+		}
+	case from:
+		return &events.TransferMatch{
+			Account: event.Op.From,
+		}
+	default:
+		return nil
+	}
+}
+
+// annotateTransfer returns a copy of the event with the exchange information filled in
+// according to the exchange directory with the user's overrides applied.
+func (processor *BlockProcessor) annotateTransfer(
+	user *UserDoc,
+	event *events.TransferMade,
+) *events.TransferMade {
+
+	directory := processor.exchanges.Override(user.Settings.ExchangeAccounts)
+
+	annotated := *event
+	if label, ok := directory.Label(event.Op.To); ok {
+		annotated.Exchange = &events.TransferExchange{
+			Account: event.Op.To,
+			Label:   label,
+			Deposit: true,
+		}
+	} else if label, ok := directory.Label(event.Op.From); ok {
+		annotated.Exchange = &events.TransferExchange{
+			Account: event.Op.From,
+			Label:   label,
+		}
+	}
+	return &annotated
+}
@@ -0,0 +1,90 @@
+package notifications
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/go-steem/rpc/types"
+)
+
+// DefaultVoteCacheSize is the number of votes remembered before the oldest votes are evicted.
+const DefaultVoteCacheSize = 100000
+
+type voteKey struct {
+	author   string
+	permlink string
+	voter    string
+}
+
+type voteEntry struct {
+	key    voteKey
+	weight int16
+	// pos is the position of the last vote operation recorded, removals included.
+	pos *eventPosition
+}
+
+// voteCache remembers the weight of the votes seen recently
+// so that a changed vote can be told apart from a new one.
+//
+// The workers process the blocks out of order, so every vote is recorded
+// with its position and the operations older than the one recorded are ignored.
+// The votes recorded least recently are evicted once the cache is full.
+type voteCache struct {
+	size    int
+	entries map[voteKey]*list.Element
+	order   *list.List
+	lock    *sync.Mutex
+}
+
+func newVoteCache(size int) *voteCache {
+	if size <= 0 {
+		size = DefaultVoteCacheSize
+	}
+	return &voteCache{
+		size:    size,
+		entries: make(map[voteKey]*list.Element),
+		order:   list.New(),
+		lock:    &sync.Mutex{},
+	}
+}
+
+// record stores the vote weight and returns the previous weight of the vote, if known.
+// Removed votes are forgotten, so voting again after that counts as a new vote.
+// pos is the position of the operation, nil when not known, in which case
+// the operation is considered the latest one.
+func (cache *voteCache) record(op *types.VoteOperation, pos *eventPosition) (int16, bool) {
+	key := voteKey{op.Author, op.Permlink, op.Voter}
+	weight := int16(op.Weight)
+
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	if elem, ok := cache.entries[key]; ok {
+		entry := elem.Value.(*voteEntry)
+		// A later operation was recorded already, the previous weight is not known.
+		if pos != nil && entry.pos != nil && pos.before(*entry.pos) {
+			return 0, false
+		}
+
+		// A removed vote is kept with weight 0 to keep its position.
+		previous, known := entry.weight, entry.weight != 0
+		entry.weight = weight
+		if pos != nil {
+			entry.pos = pos
+		}
+		cache.order.MoveToBack(elem)
+		return previous, known
+	}
+
+	for cache.order.Len() >= cache.size {
+		oldest := cache.order.Front()
+		cache.order.Remove(oldest)
+		delete(cache.entries, oldest.Value.(*voteEntry).key)
+	}
+	cache.entries[key] = cache.order.PushBack(&voteEntry{
+		key:    key,
+		weight: weight,
+		pos:    pos,
+	})
+	return 0, false
+}
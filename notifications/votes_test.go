@@ -0,0 +1,47 @@
+package notifications
+
+import (
+	"testing"
+
+	"github.com/go-steem/rpc/types"
+)
+
+func TestVoteCacheRecord(t *testing.T) {
+	cache := newVoteCache(2)
+	at := func(block uint32) *eventPosition { return &eventPosition{block: block} }
+
+	if _, ok := cache.record(&types.VoteOperation{Voter: "bob", Weight: 100}, at(10)); ok {
+		t.Error("new vote: previous weight known")
+	}
+	if previous, ok := cache.record(&types.VoteOperation{Voter: "bob", Weight: 50}, at(12)); !ok || previous != 100 {
+		t.Errorf("changed vote: got %v %v, want 100 true", previous, ok)
+	}
+
+	// Processed out of order, the vote from block 11 is older than the one recorded.
+	if _, ok := cache.record(&types.VoteOperation{Voter: "bob", Weight: 10000}, at(11)); ok {
+		t.Error("older vote: previous weight known")
+	}
+	if previous, ok := cache.record(&types.VoteOperation{Voter: "bob", Weight: 25}, at(13)); !ok || previous != 50 {
+		t.Errorf("older vote applied: got %v %v, want 50 true", previous, ok)
+	}
+
+	// Removed, the vote counts as new again, the older operations are still ignored.
+	cache.record(&types.VoteOperation{Voter: "bob", Weight: 0}, at(14))
+	if _, ok := cache.record(&types.VoteOperation{Voter: "bob", Weight: 100}, at(13)); ok {
+		t.Error("vote older than the removal: previous weight known")
+	}
+	if _, ok := cache.record(&types.VoteOperation{Voter: "bob", Weight: 100}, at(15)); ok {
+		t.Error("vote after the removal: previous weight known")
+	}
+
+	// The cache is full, carol is evicted as recorded least recently.
+	cache.record(&types.VoteOperation{Voter: "carol", Weight: 100}, at(16))
+	cache.record(&types.VoteOperation{Voter: "bob", Weight: 200}, at(17))
+	cache.record(&types.VoteOperation{Voter: "dave", Weight: 100}, at(18))
+	if _, ok := cache.record(&types.VoteOperation{Voter: "carol", Weight: 50}, at(19)); ok {
+		t.Error("evicted vote: previous weight known")
+	}
+	if previous, ok := cache.record(&types.VoteOperation{Voter: "dave", Weight: 50}, at(20)); !ok || previous != 100 {
+		t.Errorf("kept vote: got %v %v, want 100 true", previous, ok)
+	}
+}
@@ -0,0 +1,49 @@
+package notifications
+
+import (
+	"log"
+	"time"
+)
+
+const (
+	// DefaultWarmupGrace is how long after startup the stale events are not delivered.
+	DefaultWarmupGrace = 15 * time.Minute
+
+	// DefaultWarmupMaxAge is the age of the block after which its events are considered stale.
+	DefaultWarmupMaxAge = 10 * time.Minute
+)
+
+// warmup keeps the processor from flooding the users with notifications
+// for old blocks that are processed when catching up after startup.
+type warmup struct {
+	until  time.Time
+	maxAge time.Duration
+}
+
+func newWarmup(grace, maxAge time.Duration) *warmup {
+	return &warmup{
+		until:  time.Now().Add(grace),
+		maxAge: maxAge,
+	}
+}
+
+// suppressedByWarmup returns true when the event was mined from a stale block during the warmup.
+// The events not mined from a block, e.g. payout reminders, are never suppressed.
+func (processor *BlockProcessor) suppressedByWarmup(event interface{}) bool {
+	w := processor.warmup
+	if w == nil || w.maxAge == 0 || time.Now().After(w.until) {
+		return false
+	}
+
+	pos, ok := processor.sequencer.position(event)
+	if !ok || pos.timestamp.IsZero() {
+		return false
+	}
+
+	if age := time.Since(pos.timestamp); age > w.maxAge {
+		log.Printf("warmup: not delivering %v from block %v, %v old",
+			eventKind(event), pos.block, age.Truncate(time.Second))
+		return true
+	}
+	return false
+}
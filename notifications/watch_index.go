@@ -0,0 +1,369 @@
+package notifications
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// WatchIndexRebuildInterval is how often the watch index is rebuilt from scratch.
+// The rebuild picks up the changes made to the events collection that were not reported.
+const WatchIndexRebuildInterval = 10 * time.Minute
+
+// watchKey is a single entry of a watch list, e.g. @alice in the accounts list for account.updated.
+type watchKey struct {
+	kind  string
+	list  string
+	value string
+}
+
+// watchIndex maps the watch list entries to the users watching them,
+// so that the handlers only query the event documents of the users actually interested.
+// The paused entries are not in the index.
+//
+// The entries of a user are replaced when the user changes the configuration,
+// see the config cache. Until the first build is finished, the index is not ready
+// and the handlers query the events collection as a whole.
+type watchIndex struct {
+	entries map[watchKey]map[bson.ObjectId]struct{}
+	users   map[bson.ObjectId][]watchKey
+	ready   bool
+
+	// ageFiltered are the users with minAccountAgeDays set, in the profile or for any kind,
+	// so that the accounts are only prefetched when their age is going to be checked.
+	ageFiltered map[bson.ObjectId]struct{}
+
+	// versions are bumped on every change of the user, so that the entries
+	// loaded before the change are not stored.
+	versions map[bson.ObjectId]uint64
+
+	// dirty collects the users changed while rebuilding.
+	rebuilding bool
+	dirty      map[bson.ObjectId]struct{}
+
+	lock sync.RWMutex
+}
+
+func newWatchIndex() *watchIndex {
+	return &watchIndex{
+		entries:     make(map[watchKey]map[bson.ObjectId]struct{}),
+		users:       make(map[bson.ObjectId][]watchKey),
+		ageFiltered: make(map[bson.ObjectId]struct{}),
+		versions:    make(map[bson.ObjectId]uint64),
+	}
+}
+
+// lookup returns the users watching any of the keys.
+// False is returned when the index is not ready yet.
+func (index *watchIndex) lookup(keys []watchKey) ([]bson.ObjectId, bool) {
+	index.lock.RLock()
+	defer index.lock.RUnlock()
+
+	if !index.ready {
+		return nil, false
+	}
+
+	var (
+		userIds []bson.ObjectId
+		seen    = make(map[bson.ObjectId]struct{})
+	)
+	for _, key := range keys {
+		for userId := range index.entries[key] {
+			if _, ok := seen[userId]; ok {
+				continue
+			}
+			seen[userId] = struct{}{}
+			userIds = append(userIds, userId)
+		}
+	}
+	return userIds, true
+}
+
+// watchingKind returns true when the user watches any entry of the given kind.
+// False is returned as the second value when the index is not ready yet.
+func (index *watchIndex) watchingKind(userId bson.ObjectId, kind string) (bool, bool) {
+	index.lock.RLock()
+	defer index.lock.RUnlock()
+
+	if !index.ready {
+		return false, false
+	}
+	for _, key := range index.users[userId] {
+		if key.kind == kind {
+			return true, true
+		}
+	}
+	return false, true
+}
+
+// filteringAccountAge returns true when any user filters the events by the account age.
+// True is returned as well while the index is not ready.
+func (index *watchIndex) filteringAccountAge() bool {
+	index.lock.RLock()
+	defer index.lock.RUnlock()
+
+	return !index.ready || len(index.ageFiltered) != 0
+}
+
+// changed records a change of the user and returns the version to pass to replace.
+func (index *watchIndex) changed(userId bson.ObjectId) uint64 {
+	index.lock.Lock()
+	defer index.lock.Unlock()
+
+	index.versions[userId]++
+	if index.rebuilding {
+		index.dirty[userId] = struct{}{}
+	}
+	return index.versions[userId]
+}
+
+// replace sets the entries of the user unless the user changed again since version.
+func (index *watchIndex) replace(userId bson.ObjectId, version uint64, keys []watchKey, ageFiltered bool) {
+	index.lock.Lock()
+	defer index.lock.Unlock()
+
+	if index.versions[userId] != version {
+		return
+	}
+
+	for _, key := range index.users[userId] {
+		if set, ok := index.entries[key]; ok {
+			delete(set, userId)
+			if len(set) == 0 {
+				delete(index.entries, key)
+			}
+		}
+	}
+	delete(index.users, userId)
+
+	addWatchKeys(index.entries, index.users, userId, keys)
+
+	if ageFiltered {
+		index.ageFiltered[userId] = struct{}{}
+	} else {
+		delete(index.ageFiltered, userId)
+	}
+}
+
+func addWatchKeys(
+	entries map[watchKey]map[bson.ObjectId]struct{},
+	users map[bson.ObjectId][]watchKey,
+	userId bson.ObjectId,
+	keys []watchKey,
+) {
+	for _, key := range keys {
+		set, ok := entries[key]
+		if !ok {
+			set = make(map[bson.ObjectId]struct{})
+			entries[key] = set
+		}
+		set[userId] = struct{}{}
+	}
+	if len(keys) != 0 {
+		users[userId] = append(users[userId], keys...)
+	}
+}
+
+// eventDocWatchKeys returns the watch list entries of the event document, without the paused ones.
+// Every array of strings in the document is considered a list.
+func eventDocWatchKeys(doc bson.M) []watchKey {
+	kind, _ := doc["kind"].(string)
+	if kind == "" {
+		return nil
+	}
+
+	paused := make(map[string]map[string]bool)
+	if p, ok := doc["paused"].(bson.M); ok {
+		for list, values := range p {
+			paused[list] = make(map[string]bool)
+			if values, ok := values.([]interface{}); ok {
+				for _, v := range values {
+					if s, ok := v.(string); ok {
+						paused[list][s] = true
+					}
+				}
+			}
+		}
+	}
+
+	var keys []watchKey
+	for list, values := range doc {
+		values, ok := values.([]interface{})
+		if !ok || list == "paused" {
+			continue
+		}
+		for _, v := range values {
+			if s, ok := v.(string); ok && !paused[list][s] {
+				keys = append(keys, watchKey{kind, list, s})
+			}
+		}
+	}
+	return keys
+}
+
+// filtersAccountAge returns true when minAccountAgeDays is set in the settings of the document,
+// be it an event document or a user document.
+func filtersAccountAge(doc bson.M) bool {
+	settings, _ := doc["settings"].(bson.M)
+	switch days := settings["minAccountAgeDays"].(type) {
+	case int:
+		return days > 0
+	case int64:
+		return days > 0
+	case float64:
+		return days > 0
+	default:
+		return false
+	}
+}
+
+// reindexUser reloads the entries of the user from the events collection.
+func (processor *BlockProcessor) reindexUser(userId string) {
+	if !bson.IsObjectIdHex(userId) {
+		return
+	}
+	ownerId := bson.ObjectIdHex(userId)
+
+	version := processor.watches.changed(ownerId)
+
+	var (
+		doc         bson.M
+		keys        []watchKey
+		ageFiltered bool
+	)
+	iter := processor.db.C("events").Find(bson.M{"ownerId": ownerId}).Iter()
+	for iter.Next(&doc) {
+		keys = append(keys, eventDocWatchKeys(doc)...)
+		ageFiltered = ageFiltered || filtersAccountAge(doc)
+		doc = nil
+	}
+	if err := iter.Err(); err != nil {
+		// The rebuild fixes the entries of the user eventually.
+		log.Printf("failed to reindex the watch lists of user %v: %v", userId, err)
+		return
+	}
+
+	if !ageFiltered {
+		err := processor.db.C("users").FindId(ownerId).Select(bson.M{"settings": 1}).One(&doc)
+		if err != nil && err != mgo.ErrNotFound {
+			log.Printf("failed to reindex the settings of user %v: %v", userId, err)
+			return
+		}
+		ageFiltered = filtersAccountAge(doc)
+	}
+
+	processor.watches.replace(ownerId, version, keys, ageFiltered)
+}
+
+// rebuildWatchIndex builds the index from scratch. The users changed meanwhile are reindexed
+// again once the new index is in place since their entries may have been read before the change.
+func (processor *BlockProcessor) rebuildWatchIndex() error {
+	index := processor.watches
+
+	index.lock.Lock()
+	index.rebuilding = true
+	index.dirty = make(map[bson.ObjectId]struct{})
+	index.lock.Unlock()
+
+	var (
+		entries     = make(map[watchKey]map[bson.ObjectId]struct{})
+		users       = make(map[bson.ObjectId][]watchKey)
+		ageFiltered = make(map[bson.ObjectId]struct{})
+		doc         bson.M
+	)
+	iter := processor.db.C("events").Find(nil).Iter()
+	for iter.Next(&doc) {
+		if ownerId, ok := doc["ownerId"].(bson.ObjectId); ok {
+			addWatchKeys(entries, users, ownerId, eventDocWatchKeys(doc))
+			if filtersAccountAge(doc) {
+				ageFiltered[ownerId] = struct{}{}
+			}
+		}
+		doc = nil
+	}
+	err := iter.Err()
+
+	if err == nil {
+		var user struct {
+			Id bson.ObjectId `bson:"_id"`
+		}
+		query := bson.M{"settings.minAccountAgeDays": bson.M{"$gt": 0}}
+		iter := processor.db.C("users").Find(query).Select(bson.M{"_id": 1}).Iter()
+		for iter.Next(&user) {
+			ageFiltered[user.Id] = struct{}{}
+		}
+		err = iter.Err()
+	}
+
+	index.lock.Lock()
+	dirty := index.dirty
+	if err == nil {
+		index.entries = entries
+		index.users = users
+		index.ageFiltered = ageFiltered
+		index.ready = true
+	}
+	index.rebuilding = false
+	index.dirty = nil
+	index.lock.Unlock()
+
+	if err != nil {
+		return errors.Wrap(err, "failed to build the watch index")
+	}
+
+	for ownerId := range dirty {
+		processor.reindexUser(ownerId.Hex())
+	}
+	return nil
+}
+
+func (processor *BlockProcessor) watchIndexer() error {
+	ticker := time.NewTicker(WatchIndexRebuildInterval)
+	defer ticker.Stop()
+
+	for {
+		start := time.Now()
+		if err := processor.rebuildWatchIndex(); err != nil {
+			log.Printf("%+v", err)
+		} else {
+			log.Printf("watch index built in %v", time.Since(start))
+		}
+
+		select {
+		case <-ticker.C:
+		case <-processor.t.Dying():
+			return nil
+		}
+	}
+}
+
+// narrowToWatchers restricts the query to the users watching any of the keys according to the index.
+// False is returned when nobody is watching, so that the query can be skipped altogether.
+// The query stays as it is while the index is not ready.
+func (processor *BlockProcessor) narrowToWatchers(query bson.M, keys ...watchKey) bool {
+	if processor.watches == nil {
+		return true
+	}
+	userIds, ok := processor.watches.lookup(keys)
+	if !ok {
+		return true
+	}
+	if len(userIds) == 0 {
+		return false
+	}
+	query["ownerId"] = bson.M{"$in": userIds}
+	return true
+}
+
+// watchKeys returns the keys for the values in the given list of the given kind.
+func watchKeys(kind, list string, values ...string) []watchKey {
+	keys := make([]watchKey, 0, len(values))
+	for _, value := range values {
+		keys = append(keys, watchKey{kind, list, value})
+	}
+	return keys
+}
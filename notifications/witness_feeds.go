@@ -0,0 +1,182 @@
+package notifications
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/tchap/steemwatch/notifications/events"
+
+	"github.com/go-steem/rpc/types"
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2"
+)
+
+// DefaultFeedStaleThreshold is how long a witness can go without publishing
+// the price feed before WitnessFeedStale is emitted.
+const DefaultFeedStaleThreshold = time.Hour
+
+// FeedCheckInterval is how often the price feeds are checked for staleness.
+const FeedCheckInterval = time.Minute
+
+// WitnessFeed is the last price feed published by a witness.
+type WitnessFeed struct {
+	Witness     string    `bson:"_id"`
+	LastPublish time.Time `bson:"lastPublish"`
+	// Stale is set once WitnessFeedStale is emitted, until the feed is published again.
+	Stale bool `bson:"stale"`
+}
+
+// feedMonitor keeps the last price feed publish time of every witness.
+// The times are kept in the witnessFeeds collection so that a restart
+// neither forgets a stale feed nor reports it again.
+//
+// The staleness is measured against the time of the newest block processed,
+// not the wall clock, so that the feeds are not reported as stale while
+// the processor is catching up after a downtime.
+type feedMonitor struct {
+	threshold time.Duration
+	feeds     map[string]*WitnessFeed
+	clock     time.Time
+	lock      sync.Mutex
+}
+
+func loadFeedMonitor(db *mgo.Database, threshold time.Duration) (*feedMonitor, error) {
+	var feeds []*WitnessFeed
+	if err := db.C("witnessFeeds").Find(nil).All(&feeds); err != nil {
+		return nil, errors.Wrap(err, "failed to load witness feeds")
+	}
+
+	monitor := &feedMonitor{
+		threshold: threshold,
+		feeds:     make(map[string]*WitnessFeed, len(feeds)),
+	}
+	for _, feed := range feeds {
+		monitor.feeds[feed.Witness] = feed
+	}
+	return monitor, nil
+}
+
+// advance moves the clock to the time of the block processed.
+// The blocks are processed concurrently, so the clock only moves forward.
+func (monitor *feedMonitor) advance(blockTime time.Time) {
+	monitor.lock.Lock()
+	if blockTime.After(monitor.clock) {
+		monitor.clock = blockTime
+	}
+	monitor.lock.Unlock()
+}
+
+// published records the feed publish. The recovery event is returned when the feed was stale.
+func (monitor *feedMonitor) published(witness string, at time.Time) (*WitnessFeed, *events.WitnessFeedRecovered) {
+	monitor.lock.Lock()
+	defer monitor.lock.Unlock()
+
+	feed, ok := monitor.feeds[witness]
+	if !ok {
+		feed = &WitnessFeed{Witness: witness}
+		monitor.feeds[witness] = feed
+	}
+	if !at.After(feed.LastPublish) {
+		return nil, nil
+	}
+
+	var recovered *events.WitnessFeedRecovered
+	if feed.Stale {
+		recovered = &events.WitnessFeedRecovered{
+			Witness:     witness,
+			LastPublish: feed.LastPublish,
+			PublishedAt: at,
+		}
+	}
+	feed.LastPublish = at
+	feed.Stale = false
+
+	stored := *feed
+	return &stored, recovered
+}
+
+// stale marks the feeds not published within the threshold as stale and returns them.
+func (monitor *feedMonitor) stale() []*WitnessFeed {
+	monitor.lock.Lock()
+	defer monitor.lock.Unlock()
+
+	if monitor.clock.IsZero() {
+		return nil
+	}
+
+	var feeds []*WitnessFeed
+	for _, feed := range monitor.feeds {
+		if feed.Stale || monitor.clock.Sub(feed.LastPublish) <= monitor.threshold {
+			continue
+		}
+		feed.Stale = true
+		stored := *feed
+		feeds = append(feeds, &stored)
+	}
+	return feeds
+}
+
+// observeFeed records the price feed published by the operation, if any.
+func (processor *BlockProcessor) observeFeed(op types.Operation, blockTime time.Time) error {
+	if processor.feeds == nil || !processor.opTypeEnabled(op.Type()) {
+		return nil
+	}
+	witness, ok := events.FeedPublisher(op)
+	if !ok {
+		return nil
+	}
+
+	feed, recovered := processor.feeds.published(witness, blockTime)
+	if feed == nil {
+		return nil
+	}
+	if err := processor.storeWitnessFeed(feed); err != nil {
+		log.Printf("%+v", err)
+	}
+
+	if recovered == nil {
+		return nil
+	}
+	return processor.skipUnavailable("witness.feed_recovered event", processor.HandleWitnessFeedRecoveredEvent(recovered))
+}
+
+func (processor *BlockProcessor) storeWitnessFeed(feed *WitnessFeed) error {
+	err := processor.persist("witness feed", func() error {
+		_, err := processor.db.C("witnessFeeds").UpsertId(feed.Witness, feed)
+		return err
+	})
+	return errors.Wrapf(err, "failed to store the price feed of witness @%v", feed.Witness)
+}
+
+// feedChecker emits WitnessFeedStale for the feeds not published within the threshold.
+func (processor *BlockProcessor) feedChecker() error {
+	ticker := time.NewTicker(FeedCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// Nothing is dispatched while the pipeline is paused.
+			if processor.pipeline.Paused() {
+				continue
+			}
+			for _, feed := range processor.feeds.stale() {
+				if err := processor.storeWitnessFeed(feed); err != nil {
+					log.Printf("%+v", err)
+				}
+				err := processor.HandleWitnessFeedStaleEvent(&events.WitnessFeedStale{
+					Witness:     feed.Witness,
+					LastPublish: feed.LastPublish,
+					Threshold:   processor.feeds.threshold,
+				})
+				if err != nil {
+					log.Printf("failed to handle stale feed of witness @%v: %+v", feed.Witness, err)
+				}
+			}
+
+		case <-processor.t.Dying():
+			return nil
+		}
+	}
+}
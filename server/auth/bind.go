@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"log"
 	"net/http"
 
 	"github.com/tchap/steemwatch/server/context"
@@ -36,10 +37,20 @@ func Bind(serverCtx *context.Context, group *echo.Group, auth Authenticator) {
 		}
 
 		// Create a session.
-		if err := serverCtx.SessionManager.SetProfile(ctx, profile.AsUser()); err != nil {
+		user := profile.AsUser()
+		if err := serverCtx.SessionManager.SetProfile(ctx, user); err != nil {
 			return err
 		}
 
+		// Set up the default subscriptions for the new users.
+		// The login goes through in any case, the user can set things up manually.
+		if applied, err := serverCtx.DefaultSubscriptions.Apply(serverCtx.DB, user.Id); err != nil {
+			log.Printf("failed to apply default subscriptions for user %v: %+v", user.Id, err)
+		} else if applied {
+			log.Printf("default subscriptions applied for user %v", user.Id)
+			serverCtx.ConfigChanges.Changed(user.Id)
+		}
+
 		// Redirect to home.
 		return ctx.Redirect(http.StatusTemporaryRedirect, serverCtx.CanonicalURL.String())
 	})
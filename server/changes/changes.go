@@ -0,0 +1,60 @@
+package changes
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/tchap/steemwatch/server/users"
+
+	"github.com/labstack/echo"
+)
+
+// Feed tells the listeners that the configuration of a user changed,
+// e.g. so that the block processor drops its cached copy.
+type Feed struct {
+	listeners []func(userId string)
+	lock      sync.RWMutex
+}
+
+func NewFeed() *Feed {
+	return &Feed{}
+}
+
+// OnChange registers a function to be called when the configuration of a user changes.
+func (feed *Feed) OnChange(listener func(userId string)) {
+	feed.lock.Lock()
+	defer feed.lock.Unlock()
+	feed.listeners = append(feed.listeners, listener)
+}
+
+// Changed notifies the listeners that the configuration of the user changed.
+func (feed *Feed) Changed(userId string) {
+	feed.lock.RLock()
+	listeners := feed.listeners
+	feed.lock.RUnlock()
+
+	for _, listener := range listeners {
+		listener(userId)
+	}
+}
+
+// Middleware reports a change of the configuration of the authenticated user
+// for every request that can modify anything. It is meant for the API group,
+// so that the routes do not need to report the changes one by one.
+// Failed requests are reported as well since they may have changed something before failing.
+func (feed *Feed) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			err := next(ctx)
+
+			switch ctx.Request().Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				return err
+			}
+			if user, ok := ctx.Get("user").(*users.User); ok {
+				feed.Changed(user.Id)
+			}
+			return err
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package context
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ParseTrustedProxies parses the given CIDR ranges. Plain IP addresses are accepted as well.
+func ParseTrustedProxies(ranges []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(ranges))
+	for _, r := range ranges {
+		r = strings.TrimSpace(r)
+		if r == "" {
+			continue
+		}
+
+		if !strings.Contains(r, "/") {
+			ip := net.ParseIP(r)
+			if ip == nil {
+				return nil, errors.Errorf("invalid trusted proxy address: %v", r)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(r)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid trusted proxy range: %v", r)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// ClientIP returns the IP address of the client that sent the request.
+//
+// X-Forwarded-For and X-Real-IP are only consulted when the request comes from a trusted proxy,
+// otherwise anybody could spoof the address by setting the headers. The forwarded addresses are
+// walked from the right, skipping the trusted proxies, so that the entries prepended by the client
+// are not taken into account either.
+func (ctx *Context) ClientIP(req *http.Request) string {
+	remote := remoteIP(req.RemoteAddr)
+	if remote == nil {
+		return req.RemoteAddr
+	}
+	if !ctx.isTrustedProxy(remote) {
+		return remote.String()
+	}
+
+	if header := req.Header.Get("X-Forwarded-For"); header != "" {
+		hops := strings.Split(header, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(hops[i]))
+			if ip == nil {
+				// Garbage, we can't trust anything to the left.
+				break
+			}
+			if i == 0 || !ctx.isTrustedProxy(ip) {
+				return ip.String()
+			}
+		}
+		return remote.String()
+	}
+
+	if ip := net.ParseIP(strings.TrimSpace(req.Header.Get("X-Real-IP"))); ip != nil {
+		return ip.String()
+	}
+	return remote.String()
+}
+
+func (ctx *Context) isTrustedProxy(ip net.IP) bool {
+	for _, ipNet := range ctx.TrustedProxies {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func remoteIP(remoteAddr string) net.IP {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	return net.ParseIP(host)
+}
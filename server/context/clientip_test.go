@@ -0,0 +1,98 @@
+package context
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1", "fd00::/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := &Context{TrustedProxies: proxies}
+
+	testCases := []struct {
+		name       string
+		remoteAddr string
+		xff        string
+		xRealIP    string
+		want       string
+	}{
+		// Untrusted remotes.
+		{"untrusted", "203.0.113.7:4000", "", "", "203.0.113.7"},
+		{"untrusted with XFF", "203.0.113.7:4000", "198.51.100.1", "", "203.0.113.7"},
+		{"untrusted with X-Real-IP", "203.0.113.7:4000", "", "198.51.100.1", "203.0.113.7"},
+		{"untrusted with both", "203.0.113.7:4000", "198.51.100.1, 10.0.0.1", "198.51.100.2", "203.0.113.7"},
+
+		// Trusted proxies.
+		{"trusted without headers", "10.0.0.1:4000", "", "", "10.0.0.1"},
+		{"trusted with XFF", "10.0.0.1:4000", "198.51.100.1", "", "198.51.100.1"},
+		{"trusted with X-Real-IP", "192.168.1.1:4000", "", "198.51.100.1", "198.51.100.1"},
+		{"trusted prefers XFF", "10.0.0.1:4000", "198.51.100.1", "198.51.100.2", "198.51.100.1"},
+		{"trusted proxy chain", "10.0.0.1:4000", "198.51.100.1, 10.0.0.2, 10.0.0.3", "", "198.51.100.1"},
+		{"client-prepended chain", "10.0.0.1:4000", "1.2.3.4, 5.6.7.8, 198.51.100.1", "", "198.51.100.1"},
+		{"client-prepended trusted address", "10.0.0.1:4000", "10.0.0.9, 198.51.100.1", "", "198.51.100.1"},
+		{"all trusted", "10.0.0.1:4000", "10.0.0.2, 10.0.0.3", "", "10.0.0.2"},
+
+		// Garbage in the chain.
+		{"garbage only", "10.0.0.1:4000", "garbage", "", "10.0.0.1"},
+		{"garbage left of the client", "10.0.0.1:4000", "garbage, 198.51.100.1", "", "198.51.100.1"},
+		{"garbage right of the client", "10.0.0.1:4000", "198.51.100.1, garbage", "", "10.0.0.1"},
+		{"empty entries", "10.0.0.1:4000", ", ,198.51.100.1", "", "198.51.100.1"},
+		{"garbage X-Real-IP", "10.0.0.1:4000", "", "not-an-ip", "10.0.0.1"},
+
+		// IPv6.
+		{"untrusted IPv6", "[2001:db8::1]:4000", "198.51.100.1", "", "2001:db8::1"},
+		{"trusted IPv6 with XFF", "[fd00::1]:4000", "2001:db8::2", "", "2001:db8::2"},
+		{"trusted IPv6 chain", "[fd00::1]:4000", "2001:db8::2, fd00::3", "", "2001:db8::2"},
+		{"IPv6 normalized", "[fd00::1]:4000", "2001:DB8:0::2", "", "2001:db8::2"},
+		{"IPv4-mapped IPv6 remote", "[::ffff:10.0.0.1]:4000", "198.51.100.1", "", "198.51.100.1"},
+
+		// Unparsable remote addresses are passed on as they are.
+		{"no port", "203.0.113.7", "", "", "203.0.113.7"},
+		{"garbage remote", "garbage", "198.51.100.1", "", "garbage"},
+	}
+
+	for _, tc := range testCases {
+		req := &http.Request{
+			RemoteAddr: tc.remoteAddr,
+			Header:     make(http.Header),
+		}
+		if tc.xff != "" {
+			req.Header.Set("X-Forwarded-For", tc.xff)
+		}
+		if tc.xRealIP != "" {
+			req.Header.Set("X-Real-IP", tc.xRealIP)
+		}
+
+		if got := ctx.ClientIP(req); got != tc.want {
+			t.Errorf("%v: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	testCases := []struct {
+		ranges []string
+		n      int
+		ok     bool
+	}{
+		{[]string{"10.0.0.0/8", "fd00::/8"}, 2, true},
+		{[]string{"192.168.1.1", "::1"}, 2, true},
+		{[]string{" 10.0.0.0/8 ", ""}, 1, true},
+		{[]string{"garbage"}, 0, false},
+		{[]string{"10.0.0.0/33"}, 0, false},
+	}
+
+	for _, tc := range testCases {
+		nets, err := ParseTrustedProxies(tc.ranges)
+		if (err == nil) != tc.ok {
+			t.Errorf("%v: got error %v, want ok %v", tc.ranges, err, tc.ok)
+			continue
+		}
+		if tc.ok && len(nets) != tc.n {
+			t.Errorf("%v: got %v ranges, want %v", tc.ranges, len(nets), tc.n)
+		}
+	}
+}
@@ -1,9 +1,19 @@
 package context
 
 import (
+	"net"
 	"net/url"
+	"time"
 
+	"github.com/tchap/steemwatch/links"
+	"github.com/tchap/steemwatch/notifications/accounts"
+	"github.com/tchap/steemwatch/notifications/dbhealth"
+	"github.com/tchap/steemwatch/notifications/faults"
+	"github.com/tchap/steemwatch/notifications/pause"
+	"github.com/tchap/steemwatch/server/changes"
+	"github.com/tchap/steemwatch/server/maintenance"
 	"github.com/tchap/steemwatch/server/sessions"
+	"github.com/tchap/steemwatch/server/subscriptions"
 
 	"gopkg.in/mgo.v2"
 )
@@ -17,8 +27,33 @@ const (
 
 type Context struct {
 	CanonicalURL   *url.URL
+	Links          *links.Builder
 	Env            Environment
 	SessionManager *sessions.SessionManager
 	DB             *mgo.Database
 	SSLEnabled     bool
+	Maintenance    *maintenance.Mode
+	Pipeline       *pause.Switch
+
+	// DBHealth is the database availability as seen by the block processor and the API,
+	// it keeps the configuration changes made while unavailable, see PersistConfig.
+	DBHealth *dbhealth.Monitor
+
+	// ConfigChanges reports the changes of the user configuration to the block processor.
+	ConfigChanges *changes.Feed
+
+	// Faults are the notifier failures injected using the admin API, nil when disabled.
+	Faults *faults.Injector
+
+	// AccountOverviews are the account snapshots for the dashboard, fetched once connected to steemd.
+	AccountOverviews *accounts.Overviews
+
+	// HistoryMaxRetention caps the history retention chosen by the users, 0 means no cap.
+	HistoryMaxRetention time.Duration
+
+	// DefaultSubscriptions are applied to the users logging in for the first time, nil disables them.
+	DefaultSubscriptions subscriptions.Template
+
+	// TrustedProxies are the ranges the forwarding headers are accepted from, see ClientIP.
+	TrustedProxies []*net.IPNet
 }
@@ -0,0 +1,35 @@
+package context
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/labstack/echo"
+)
+
+// PersistConfig runs the write changing the configuration of the user.
+//
+// When the database is unavailable, the write is kept to be retried once it recovers,
+// see dbhealth.Monitor, and the request is answered with 202 Accepted. The change is reported
+// again once the write goes through, the configuration cached meanwhile would be stale otherwise.
+// The writes must be idempotent and the last thing the handler does, nothing is written
+// to the response when the write succeeds. The writes that depend on a read, e.g. the list limits,
+// still fail until the database is back.
+func (ctx *Context) PersistConfig(reqCtx echo.Context, userId string, write func() error) error {
+	err := write()
+	if err == nil || ctx.DBHealth == nil || !ctx.DBHealth.Check(err) {
+		return err
+	}
+
+	log.Printf("database unavailable, configuration change of user %v kept for retrying", userId)
+	ctx.DBHealth.Retry(func() error {
+		if err := write(); err != nil {
+			return err
+		}
+		if ctx.ConfigChanges != nil {
+			ctx.ConfigChanges.Changed(userId)
+		}
+		return nil
+	})
+	return reqCtx.NoContent(http.StatusAccepted)
+}
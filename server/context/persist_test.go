@@ -0,0 +1,74 @@
+package context
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tchap/steemwatch/notifications/dbhealth"
+	"github.com/tchap/steemwatch/server/changes"
+
+	"github.com/labstack/echo"
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2"
+)
+
+func TestPersistConfig(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		code     int
+		failed   bool
+		degraded bool
+	}{
+		{"written", nil, http.StatusOK, false, false},
+		{"failed", mgo.ErrNotFound, http.StatusOK, true, false},
+		{"unavailable", errors.Wrap(io.EOF, "failed to update doc"), http.StatusAccepted, false, true},
+	}
+
+	for _, tc := range testCases {
+		var (
+			ctx = &Context{
+				DBHealth:      dbhealth.NewMonitor(),
+				ConfigChanges: changes.NewFeed(),
+			}
+			writes  int
+			changed []string
+		)
+		ctx.ConfigChanges.OnChange(func(userId string) {
+			changed = append(changed, userId)
+		})
+
+		rec := httptest.NewRecorder()
+		reqCtx := echo.New().NewContext(httptest.NewRequest(http.MethodPut, "/", nil), rec)
+
+		err := ctx.PersistConfig(reqCtx, "alice", func() error {
+			writes++
+			if writes == 1 {
+				return tc.err
+			}
+			return nil
+		})
+		if (err != nil) != tc.failed {
+			t.Errorf("%v: got error %v, want failed %v", tc.name, err, tc.failed)
+		}
+		if rec.Code != tc.code {
+			t.Errorf("%v: got status %v, want %v", tc.name, rec.Code, tc.code)
+		}
+		if ctx.DBHealth.Degraded() != tc.degraded {
+			t.Errorf("%v: got degraded %v, want %v", tc.name, ctx.DBHealth.Degraded(), tc.degraded)
+		}
+
+		// The kept write is retried once the database recovers, then the change is reported.
+		ctx.DBHealth.Recovered()
+		wantWrites, wantChanged := 1, 0
+		if tc.degraded {
+			wantWrites, wantChanged = 2, 1
+		}
+		if writes != wantWrites || len(changed) != wantChanged {
+			t.Errorf("%v: got %v writes and %v changes reported, want %v and %v",
+				tc.name, writes, len(changed), wantWrites, wantChanged)
+		}
+	}
+}
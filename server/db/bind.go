@@ -3,6 +3,7 @@ package db
 import (
 	"encoding/json"
 	"io/ioutil"
+	"net/http"
 
 	"github.com/tchap/steemwatch/server/context"
 	"github.com/tchap/steemwatch/server/users"
@@ -12,7 +13,7 @@ import (
 	"gopkg.in/mgo.v2/bson"
 )
 
-func BindList(serverCtx *context.Context, group *echo.Group) {
+func BindList(serverCtx *context.Context, group *echo.Group, limits *ListLimits) {
 	group.GET("/", func(ctx echo.Context) error {
 		// Get the list from the database and unmarshal it.
 		var (
@@ -56,12 +57,23 @@ func BindList(serverCtx *context.Context, group *echo.Group) {
 			return err
 		}
 
-		// Push to the database.
+		// Push to the database unless the entry is already there.
 		var (
 			profile   = ctx.Get("user").(*users.User)
 			eventKind = ctx.Param("kind")
 			listName  = ctx.Param("list")
+			entry     = NormalizeListEntry(listName, string(body))
 		)
+		if entry == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "empty list entry")
+		}
+		if entry == "_" {
+			return echo.NewHTTPError(http.StatusBadRequest, "reserved list entry")
+		}
+
+		if err := limits.check(serverCtx.DB, profile.Id, eventKind, listName, entry); err != nil {
+			return err
+		}
 
 		selector := bson.M{
 			"ownerId": bson.ObjectIdHex(profile.Id),
@@ -69,13 +81,18 @@ func BindList(serverCtx *context.Context, group *echo.Group) {
 		}
 
 		update := bson.M{
-			"$push": bson.M{
-				listName: string(body),
+			"$addToSet": bson.M{
+				listName: entry,
 			},
 		}
 
-		_, err = serverCtx.DB.C("events").Upsert(selector, update)
-		return err
+		if _, err := serverCtx.DB.C("events").Upsert(selector, update); err != nil {
+			return err
+		}
+
+		// Send the stored entry back so that the UI shows what was saved.
+		ctx.Response().Header().Set(echo.HeaderContentType, "application/json")
+		return json.NewEncoder(ctx.Response().Writer).Encode(entry)
 	})
 
 	group.DELETE("/:item/", func(ctx echo.Context) error {
@@ -92,12 +109,125 @@ func BindList(serverCtx *context.Context, group *echo.Group) {
 			"kind":    eventKind,
 		}
 
+		values := bson.M{"$in": entryValues(listName, item)}
 		update := bson.M{
 			"$pull": bson.M{
-				listName: item,
+				listName:             values,
+				"paused." + listName: values,
+				"labels":             bson.M{"list": listName, "value": values},
+				"schedules":          bson.M{"list": listName, "value": values},
 			},
 		}
 
-		return serverCtx.DB.C("events").Update(selector, update)
+		return serverCtx.PersistConfig(ctx, profile.Id, func() error {
+			return serverCtx.DB.C("events").Update(selector, update)
+		})
+	})
+
+	// Paused entries stay in the list, they are just skipped when dispatching events.
+	//
+	// The list-wide routes live under /_/ since echo matches the static segments first,
+	// so /paused/ would otherwise shadow an entry called paused. The entry called _ is rejected.
+	group.GET("/_/paused/", func(ctx echo.Context) error {
+		var (
+			profile   = ctx.Get("user").(*users.User)
+			eventKind = ctx.Param("kind")
+			listName  = ctx.Param("list")
+		)
+
+		query := bson.M{
+			"ownerId": bson.ObjectIdHex(profile.Id),
+			"kind":    eventKind,
+		}
+
+		selector := bson.M{
+			"paused." + listName: 1,
+		}
+
+		var (
+			doc struct {
+				Paused map[string][]string `bson:"paused"`
+			}
+			list []string
+		)
+		err := serverCtx.DB.C("events").Find(query).Select(selector).One(&doc)
+		if err != nil && err != mgo.ErrNotFound {
+			return err
+		}
+		if lx, ok := doc.Paused[listName]; ok {
+			list = lx
+		} else {
+			list = []string{}
+		}
+
+		ctx.Response().Header().Set(echo.HeaderContentType, "application/json")
+		return json.NewEncoder(ctx.Response().Writer).Encode(list)
 	})
+
+	group.PUT("/:item/paused/", func(ctx echo.Context) error {
+		var (
+			profile   = ctx.Get("user").(*users.User)
+			eventKind = ctx.Param("kind")
+			listName  = ctx.Param("list")
+			item      = ctx.Param("item")
+		)
+
+		// Only entries that are actually in the list can be paused.
+		entry, err := findEntry(serverCtx.DB, profile.Id, eventKind, listName, item)
+		if err == mgo.ErrNotFound {
+			return echo.NewHTTPError(http.StatusNotFound, "list entry not found")
+		}
+		if err != nil {
+			return err
+		}
+
+		selector := bson.M{
+			"ownerId": bson.ObjectIdHex(profile.Id),
+			"kind":    eventKind,
+			listName:  entry,
+		}
+
+		update := bson.M{
+			"$addToSet": bson.M{
+				"paused." + listName: entry,
+			},
+		}
+
+		err = serverCtx.DB.C("events").Update(selector, update)
+		if err == mgo.ErrNotFound {
+			return echo.NewHTTPError(http.StatusNotFound, "list entry not found")
+		}
+		return err
+	})
+
+	group.DELETE("/:item/paused/", func(ctx echo.Context) error {
+		var (
+			profile   = ctx.Get("user").(*users.User)
+			eventKind = ctx.Param("kind")
+			listName  = ctx.Param("list")
+			item      = ctx.Param("item")
+		)
+
+		selector := bson.M{
+			"ownerId": bson.ObjectIdHex(profile.Id),
+			"kind":    eventKind,
+		}
+
+		update := bson.M{
+			"$pull": bson.M{
+				"paused." + listName: bson.M{"$in": entryValues(listName, item)},
+			},
+		}
+
+		return serverCtx.PersistConfig(ctx, profile.Id, func() error {
+			err := serverCtx.DB.C("events").Update(selector, update)
+			if err == mgo.ErrNotFound {
+				return nil
+			}
+			return err
+		})
+	})
+
+	bindLabels(serverCtx, group)
+	bindSchedules(serverCtx, group)
 }
@@ -0,0 +1,164 @@
+package db
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/tchap/steemwatch/server/context"
+	"github.com/tchap/steemwatch/server/users"
+
+	"github.com/labstack/echo"
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	// MaxEntryLabels is the maximum number of labels of a single list entry.
+	MaxEntryLabels = 10
+	// MaxLabelLength is the maximum length of a label in characters.
+	MaxLabelLength = 32
+)
+
+// EntryLabels are the labels the user put on a list entry, e.g. "clients".
+// They are stored in the labels array of the event document since the entries
+// can contain dots, which cannot be used in the field names.
+type EntryLabels struct {
+	List   string   `json:"list"   bson:"list"`
+	Value  string   `json:"value"  bson:"value"`
+	Labels []string `json:"labels" bson:"labels"`
+}
+
+// LabelsOf returns the labels of the given list entry.
+func LabelsOf(labels []EntryLabels, list, value string) []string {
+	for _, entry := range labels {
+		if entry.List == list && entry.Value == value {
+			return entry.Labels
+		}
+	}
+	return nil
+}
+
+// NormalizeLabels trims and lower-cases the labels, dropping the empty ones and the duplicates.
+func NormalizeLabels(labels []string) ([]string, error) {
+	var (
+		normalized = make([]string, 0, len(labels))
+		seen       = make(map[string]bool, len(labels))
+	)
+	for _, label := range labels {
+		label = strings.ToLower(strings.TrimSpace(label))
+		if label == "" || seen[label] {
+			continue
+		}
+		if utf8.RuneCountInString(label) > MaxLabelLength {
+			return nil, errors.Errorf("label too long: %v, the limit is %v characters", label, MaxLabelLength)
+		}
+		seen[label] = true
+		normalized = append(normalized, label)
+	}
+	if len(normalized) > MaxEntryLabels {
+		return nil, errors.Errorf("too many labels: %v, the limit is %v", len(normalized), MaxEntryLabels)
+	}
+	return normalized, nil
+}
+
+// bindLabels binds the routes managing the labels of the list entries.
+func bindLabels(serverCtx *context.Context, group *echo.Group) {
+	// The labels of all the entries in the list, by entry.
+	group.GET("/_/labels/", func(ctx echo.Context) error {
+		var (
+			profile   = ctx.Get("user").(*users.User)
+			eventKind = ctx.Param("kind")
+			listName  = ctx.Param("list")
+		)
+
+		query := bson.M{
+			"ownerId": bson.ObjectIdHex(profile.Id),
+			"kind":    eventKind,
+		}
+
+		selector := bson.M{
+			"labels": 1,
+		}
+
+		var doc struct {
+			Labels []EntryLabels `bson:"labels"`
+		}
+		err := serverCtx.DB.C("events").Find(query).Select(selector).One(&doc)
+		if err != nil && err != mgo.ErrNotFound {
+			return err
+		}
+
+		labels := make(map[string][]string)
+		for _, entry := range doc.Labels {
+			if entry.List == listName {
+				labels[entry.Value] = entry.Labels
+			}
+		}
+
+		ctx.Response().Header().Set(echo.HeaderContentType, "application/json")
+		return json.NewEncoder(ctx.Response().Writer).Encode(labels)
+	})
+
+	// The labels are replaced with the JSON array in the body, an empty array removes them.
+	group.PUT("/:item/labels/", func(ctx echo.Context) error {
+		var (
+			profile   = ctx.Get("user").(*users.User)
+			eventKind = ctx.Param("kind")
+			listName  = ctx.Param("list")
+			item      = ctx.Param("item")
+		)
+
+		var labels []string
+		if err := json.NewDecoder(ctx.Request().Body).Decode(&labels); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "labels must be a JSON array of strings")
+		}
+		labels, err := NormalizeLabels(labels)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusUnprocessableEntity, err.Error())
+		}
+
+		// Only entries that are actually in the list can be labeled.
+		entry, err := findEntry(serverCtx.DB, profile.Id, eventKind, listName, item)
+		if err == mgo.ErrNotFound {
+			return echo.NewHTTPError(http.StatusNotFound, "list entry not found")
+		}
+		if err != nil {
+			return err
+		}
+
+		selector := bson.M{
+			"ownerId": bson.ObjectIdHex(profile.Id),
+			"kind":    eventKind,
+			listName:  entry,
+		}
+
+		update := bson.M{
+			"$pull": bson.M{
+				"labels": bson.M{"list": listName, "value": entry},
+			},
+		}
+
+		err = serverCtx.DB.C("events").Update(selector, update)
+		if err == mgo.ErrNotFound {
+			return echo.NewHTTPError(http.StatusNotFound, "list entry not found")
+		}
+		if err != nil || len(labels) == 0 {
+			return err
+		}
+
+		update = bson.M{
+			"$push": bson.M{
+				"labels": &EntryLabels{listName, entry, labels},
+			},
+		}
+		if err := serverCtx.DB.C("events").Update(selector, update); err != nil {
+			return err
+		}
+
+		ctx.Response().Header().Set(echo.HeaderContentType, "application/json")
+		return json.NewEncoder(ctx.Response().Writer).Encode(labels)
+	})
+}
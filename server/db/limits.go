@@ -0,0 +1,81 @@
+package db
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo"
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// ListLimits caps the number of entries a user can watch, 0 means no limit.
+// The limits are only enforced when adding entries, the lists over the limit are kept.
+type ListLimits struct {
+	// MaxListEntries is the maximum length of a single list.
+	MaxListEntries uint
+	// MaxUserEntries is the maximum number of entries in all the lists of the user.
+	MaxUserEntries uint
+}
+
+// nonListFields are the fields of the events documents that are not watch lists.
+var nonListFields = map[string]bool{
+	"_id":       true,
+	"ownerId":   true,
+	"kind":      true,
+	"settings":  true,
+	"paused":    true,
+	"labels":    true,
+	"schedules": true,
+}
+
+// check returns an HTTP error when adding the entry to the list would exceed the limits.
+// Entries already in the list are always accepted since adding them changes nothing.
+func (limits *ListLimits) check(db *mgo.Database, userId, kind, listName, entry string) error {
+	if limits.MaxListEntries == 0 && limits.MaxUserEntries == 0 {
+		return nil
+	}
+
+	var (
+		doc       bson.M
+		listCount uint
+		userCount uint
+	)
+	iter := db.C("events").Find(bson.M{"ownerId": bson.ObjectIdHex(userId)}).Iter()
+	for iter.Next(&doc) {
+		for field, value := range doc {
+			if nonListFields[field] {
+				continue
+			}
+			list, ok := value.([]interface{})
+			if !ok {
+				continue
+			}
+			if doc["kind"] == kind && field == listName {
+				for _, v := range list {
+					if v == entry {
+						iter.Close()
+						return nil
+					}
+				}
+				listCount = uint(len(list))
+			}
+			userCount += uint(len(list))
+		}
+		doc = nil
+	}
+	if err := iter.Err(); err != nil {
+		return errors.Wrapf(err, "failed to get event documents for user %v", userId)
+	}
+
+	if max := limits.MaxListEntries; max != 0 && listCount >= max {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, fmt.Sprintf(
+			"list limit reached: the list contains %v entries, the limit is %v", listCount, max))
+	}
+	if max := limits.MaxUserEntries; max != 0 && userCount >= max {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, fmt.Sprintf(
+			"watch limit reached: your lists contain %v entries, the limit is %v", userCount, max))
+	}
+	return nil
+}
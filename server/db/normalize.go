@@ -0,0 +1,75 @@
+package db
+
+import (
+	"strings"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// accountLists are the lists holding account names, the only ones normalized by NormalizeListEntry.
+var accountLists = map[string]bool{
+	"accounts":      true,
+	"authors":       true,
+	"from":          true,
+	"parentAuthors": true,
+	"payees":        true,
+	"to":            true,
+	"users":         true,
+	"voters":        true,
+	"witnesses":     true,
+}
+
+// NormalizeEntry turns a list entry into the form used on the blockchain,
+// so that "Alice", "@alice" and " alice " all end up stored as "alice".
+func NormalizeEntry(entry string) string {
+	entry = strings.TrimSpace(entry)
+	entry = strings.TrimPrefix(entry, "@")
+	return strings.ToLower(strings.TrimSpace(entry))
+}
+
+// NormalizeListEntry normalizes the entry when the list holds account names.
+// The entries of the other lists, e.g. tags or custom JSON IDs, are kept as they are.
+func NormalizeListEntry(listName, entry string) string {
+	if !accountLists[listName] {
+		return entry
+	}
+	return NormalizeEntry(entry)
+}
+
+// entryValues returns the values the list entry can be stored as, i.e. as given and normalized,
+// so that the entries stored before the normalization was introduced, e.g. "Alice" or "@alice",
+// can still be managed.
+func entryValues(listName, item string) []string {
+	normalized := NormalizeListEntry(listName, item)
+	if normalized == item {
+		return []string{item}
+	}
+	return []string{item, normalized}
+}
+
+// findEntry returns the list entry as stored, see entryValues.
+// mgo.ErrNotFound is returned when the entry is not in the list.
+func findEntry(db *mgo.Database, ownerId, eventKind, listName, item string) (string, error) {
+	values := entryValues(listName, item)
+
+	query := bson.M{
+		"ownerId": bson.ObjectIdHex(ownerId),
+		"kind":    eventKind,
+		listName:  bson.M{"$in": values},
+	}
+
+	var doc bson.M
+	if err := db.C("events").Find(query).Select(bson.M{listName: 1}).One(&doc); err != nil {
+		return "", err
+	}
+	stored, _ := doc[listName].([]interface{})
+	for _, value := range values {
+		for _, entry := range stored {
+			if entry == value {
+				return value, nil
+			}
+		}
+	}
+	return "", mgo.ErrNotFound
+}
@@ -0,0 +1,80 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeEntry(t *testing.T) {
+	testCases := []struct {
+		entry string
+		want  string
+	}{
+		{"alice", "alice"},
+		{"Alice", "alice"},
+		{"ALICE", "alice"},
+		{"@alice", "alice"},
+		{"@Alice", "alice"},
+		{" alice ", "alice"},
+		{"alice\n", "alice"},
+		{" @Alice ", "alice"},
+		{"@ alice", "alice"},
+		{"name.with-dots", "name.with-dots"},
+		{"", ""},
+		{"@", ""},
+		{"  ", ""},
+	}
+
+	for _, tc := range testCases {
+		if got := NormalizeEntry(tc.entry); got != tc.want {
+			t.Errorf("NormalizeEntry(%q): got %q, want %q", tc.entry, got, tc.want)
+		}
+	}
+}
+
+func TestNormalizeListEntry(t *testing.T) {
+	testCases := []struct {
+		list  string
+		entry string
+		want  string
+	}{
+		{"accounts", " @Alice ", "alice"},
+		{"authors", "@Alice", "alice"},
+		{"voters", "Alice", "alice"},
+		{"witnesses", "@alice", "alice"},
+		{"from", "Alice", "alice"},
+		{"to", "Alice", "alice"},
+		{"payees", "Alice", "alice"},
+		{"users", "Alice", "alice"},
+		{"parentAuthors", "Alice", "alice"},
+		{"tags", "SteemDev", "SteemDev"},
+		{"tags", "@steemdev", "@steemdev"},
+		{"ids", "Follow", "Follow"},
+		{"communities", "Hive-123456", "Hive-123456"},
+	}
+
+	for _, tc := range testCases {
+		if got := NormalizeListEntry(tc.list, tc.entry); got != tc.want {
+			t.Errorf("NormalizeListEntry(%q, %q): got %q, want %q", tc.list, tc.entry, got, tc.want)
+		}
+	}
+}
+
+func TestEntryValues(t *testing.T) {
+	testCases := []struct {
+		list string
+		item string
+		want []string
+	}{
+		{"accounts", "alice", []string{"alice"}},
+		{"accounts", "Alice", []string{"Alice", "alice"}},
+		{"accounts", "@alice", []string{"@alice", "alice"}},
+		{"tags", "SteemDev", []string{"SteemDev"}},
+	}
+
+	for _, tc := range testCases {
+		if got := entryValues(tc.list, tc.item); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("entryValues(%q, %q): got %q, want %q", tc.list, tc.item, got, tc.want)
+		}
+	}
+}
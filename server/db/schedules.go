@@ -0,0 +1,257 @@
+package db
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tchap/steemwatch/server/context"
+	"github.com/tchap/steemwatch/server/users"
+
+	"github.com/labstack/echo"
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const scheduleTimeLayout = "15:04"
+
+var scheduleDays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Schedule limits when the events caused by a list entry are delivered, e.g. on weekdays
+// from 09:00 to 17:00 for a business account. Outside of the schedule, the events
+// only go to the history. No days means every day, no start and end means the whole day.
+// The end can be before the start for a range spanning midnight, the days are then
+// the days the range starts on.
+type Schedule struct {
+	Days     []string `json:"days,omitempty"  bson:"days,omitempty"`
+	Start    string   `json:"start,omitempty" bson:"start,omitempty"`
+	End      string   `json:"end,omitempty"   bson:"end,omitempty"`
+	Timezone string   `json:"timezone"        bson:"timezone"`
+
+	// location is the time zone resolved when the schedule is loaded, see SetBSON.
+	location *time.Location
+}
+
+// EntrySchedule is the schedule of a list entry, stored in the schedules array
+// of the event document the same way as the labels, see EntryLabels.
+type EntrySchedule struct {
+	List     string    `json:"list"     bson:"list"`
+	Value    string    `json:"value"    bson:"value"`
+	Schedule *Schedule `json:"schedule" bson:"schedule"`
+}
+
+// ScheduleOf returns the schedule of the given list entry, nil for always.
+func ScheduleOf(schedules []EntrySchedule, list, value string) *Schedule {
+	for _, entry := range schedules {
+		if entry.List == list && entry.Value == value {
+			return entry.Schedule
+		}
+	}
+	return nil
+}
+
+func (schedule *Schedule) Validate() error {
+	for _, day := range schedule.Days {
+		if _, ok := scheduleDays[day]; !ok {
+			return errors.Errorf("invalid day: %q, expected one of mon, tue, wed, thu, fri, sat, sun", day)
+		}
+	}
+	if (schedule.Start == "") != (schedule.End == "") {
+		return errors.New("either both start and end or none must be set")
+	}
+	if schedule.Start != "" {
+		if _, err := time.Parse(scheduleTimeLayout, schedule.Start); err != nil {
+			return errors.New("start is not a valid HH:MM time")
+		}
+		if _, err := time.Parse(scheduleTimeLayout, schedule.End); err != nil {
+			return errors.New("end is not a valid HH:MM time")
+		}
+		if schedule.Start == schedule.End {
+			return errors.New("start and end must differ, leave both out for the whole day")
+		}
+	}
+	if _, err := time.LoadLocation(schedule.Timezone); err != nil {
+		return errors.New("timezone is not a valid time zone")
+	}
+	return nil
+}
+
+// SetBSON resolves the time zone once when the schedule is loaded
+// rather than every time Active is called, i.e. for every event.
+func (schedule *Schedule) SetBSON(raw bson.Raw) error {
+	type plain Schedule
+	if err := raw.Unmarshal((*plain)(schedule)); err != nil {
+		return err
+	}
+	// An invalid time zone is left to Active.
+	schedule.location, _ = time.LoadLocation(schedule.Timezone)
+	return nil
+}
+
+// Active returns true when t falls into the schedule.
+// No schedule or an invalid one means always.
+func (schedule *Schedule) Active(t time.Time) bool {
+	if schedule == nil {
+		return true
+	}
+	loc := schedule.location
+	if loc == nil {
+		var err error
+		if loc, err = time.LoadLocation(schedule.Timezone); err != nil {
+			return true
+		}
+	}
+	local := t.In(loc)
+
+	day := local.Weekday()
+	if schedule.Start != "" {
+		start, err := time.Parse(scheduleTimeLayout, schedule.Start)
+		if err != nil {
+			return true
+		}
+		end, err := time.Parse(scheduleTimeLayout, schedule.End)
+		if err != nil {
+			return true
+		}
+
+		var (
+			minute   = local.Hour()*60 + local.Minute()
+			startMin = start.Hour()*60 + start.Minute()
+			endMin   = end.Hour()*60 + end.Minute()
+		)
+		switch {
+		case startMin <= endMin:
+			if minute < startMin || minute >= endMin {
+				return false
+			}
+		case minute < endMin:
+			// The range started the day before.
+			day = local.AddDate(0, 0, -1).Weekday()
+		case minute < startMin:
+			return false
+		}
+	}
+
+	if len(schedule.Days) == 0 {
+		return true
+	}
+	for _, d := range schedule.Days {
+		if scheduleDays[d] == day {
+			return true
+		}
+	}
+	return false
+}
+
+// bindSchedules binds the routes managing the schedules of the list entries.
+func bindSchedules(serverCtx *context.Context, group *echo.Group) {
+	// The schedules of all the entries in the list, by entry.
+	group.GET("/_/schedules/", func(ctx echo.Context) error {
+		var (
+			profile   = ctx.Get("user").(*users.User)
+			eventKind = ctx.Param("kind")
+			listName  = ctx.Param("list")
+		)
+
+		query := bson.M{
+			"ownerId": bson.ObjectIdHex(profile.Id),
+			"kind":    eventKind,
+		}
+
+		selector := bson.M{
+			"schedules": 1,
+		}
+
+		var doc struct {
+			Schedules []EntrySchedule `bson:"schedules"`
+		}
+		err := serverCtx.DB.C("events").Find(query).Select(selector).One(&doc)
+		if err != nil && err != mgo.ErrNotFound {
+			return err
+		}
+
+		schedules := make(map[string]*Schedule)
+		for _, entry := range doc.Schedules {
+			if entry.List == listName {
+				schedules[entry.Value] = entry.Schedule
+			}
+		}
+
+		ctx.Response().Header().Set(echo.HeaderContentType, "application/json")
+		return json.NewEncoder(ctx.Response().Writer).Encode(schedules)
+	})
+
+	// The schedule is replaced with the JSON object in the body, null removes it.
+	group.PUT("/:item/schedule/", func(ctx echo.Context) error {
+		var (
+			profile   = ctx.Get("user").(*users.User)
+			eventKind = ctx.Param("kind")
+			listName  = ctx.Param("list")
+			item      = ctx.Param("item")
+		)
+
+		var schedule *Schedule
+		if err := json.NewDecoder(ctx.Request().Body).Decode(&schedule); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "schedule must be a JSON object or null")
+		}
+		if schedule != nil {
+			for i, day := range schedule.Days {
+				schedule.Days[i] = strings.ToLower(strings.TrimSpace(day))
+			}
+			if err := schedule.Validate(); err != nil {
+				return echo.NewHTTPError(http.StatusUnprocessableEntity, err.Error())
+			}
+		}
+
+		// Only entries that are actually in the list can be scheduled.
+		entry, err := findEntry(serverCtx.DB, profile.Id, eventKind, listName, item)
+		if err == mgo.ErrNotFound {
+			return echo.NewHTTPError(http.StatusNotFound, "list entry not found")
+		}
+		if err != nil {
+			return err
+		}
+
+		selector := bson.M{
+			"ownerId": bson.ObjectIdHex(profile.Id),
+			"kind":    eventKind,
+			listName:  entry,
+		}
+
+		update := bson.M{
+			"$pull": bson.M{
+				"schedules": bson.M{"list": listName, "value": entry},
+			},
+		}
+
+		err = serverCtx.DB.C("events").Update(selector, update)
+		if err == mgo.ErrNotFound {
+			return echo.NewHTTPError(http.StatusNotFound, "list entry not found")
+		}
+		if err != nil || schedule == nil {
+			return err
+		}
+
+		update = bson.M{
+			"$push": bson.M{
+				"schedules": &EntrySchedule{listName, entry, schedule},
+			},
+		}
+		if err := serverCtx.DB.C("events").Update(selector, update); err != nil {
+			return err
+		}
+
+		ctx.Response().Header().Set(echo.HeaderContentType, "application/json")
+		return json.NewEncoder(ctx.Response().Writer).Encode(schedule)
+	})
+}
@@ -0,0 +1,58 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestScheduleValidate(t *testing.T) {
+	testCases := []struct {
+		name     string
+		schedule Schedule
+		valid    bool
+	}{
+		{"whole day", Schedule{Timezone: "UTC"}, true},
+		{"range", Schedule{Days: []string{"mon"}, Start: "09:00", End: "17:00", Timezone: "Europe/Prague"}, true},
+		{"over midnight", Schedule{Start: "22:00", End: "06:00", Timezone: "UTC"}, true},
+		{"empty range", Schedule{Start: "09:00", End: "09:00", Timezone: "UTC"}, false},
+		{"start only", Schedule{Start: "09:00", Timezone: "UTC"}, false},
+		{"invalid day", Schedule{Days: []string{"monday"}, Timezone: "UTC"}, false},
+		{"invalid time zone", Schedule{Timezone: "Mars/Olympus"}, false},
+	}
+
+	for _, tc := range testCases {
+		if err := tc.schedule.Validate(); (err == nil) != tc.valid {
+			t.Errorf("%v: got error %v, valid %v", tc.name, err, tc.valid)
+		}
+	}
+}
+
+func TestScheduleSetBSON(t *testing.T) {
+	raw, err := bson.Marshal(&EntrySchedule{
+		List:     "authors",
+		Value:    "alice",
+		Schedule: &Schedule{Start: "09:00", End: "17:00", Timezone: "Asia/Tokyo"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var entry EntrySchedule
+	if err := bson.Unmarshal(raw, &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Schedule.location == nil || entry.Schedule.location.String() != "Asia/Tokyo" {
+		t.Fatalf("time zone not resolved: %v", entry.Schedule.location)
+	}
+
+	// 10:00 in Tokyo.
+	if !entry.Schedule.Active(time.Date(2018, 1, 1, 1, 0, 0, 0, time.UTC)) {
+		t.Error("schedule inactive within the range")
+	}
+	// 18:00 in Tokyo.
+	if entry.Schedule.Active(time.Date(2018, 1, 1, 9, 0, 0, 0, time.UTC)) {
+		t.Error("schedule active outside of the range")
+	}
+}
@@ -0,0 +1,170 @@
+package db
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/tchap/steemwatch/notifications/events"
+	"github.com/tchap/steemwatch/server/context"
+	"github.com/tchap/steemwatch/server/users"
+
+	"github.com/labstack/echo"
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Settings contains the per-kind options stored next to the lists
+// in the events collection. Fields that are not set keep their current value on PATCH.
+type Settings struct {
+	SkipEdits *bool `json:"skipEdits,omitempty" bson:"skipEdits,omitempty"`
+
+	// SkipRevotes suppresses vote events for votes that only changed the weight of an existing vote.
+	SkipRevotes *bool `json:"skipRevotes,omitempty" bson:"skipRevotes,omitempty"`
+
+	// Assets limits transfer events to the given asset symbols, e.g. ["SBD"].
+	// All assets are matched when empty.
+	Assets []string `json:"assets,omitempty" bson:"assets,omitempty"`
+
+	// MinAmounts suppresses transfers smaller than the given amount of the asset, e.g. {"STEEM": 10}.
+	MinAmounts map[string]float64 `json:"minAmounts,omitempty" bson:"minAmounts,omitempty"`
+
+	// MinValueUSD suppresses transfers worth less than the given value in USD according
+	// to the median price feed. MinAmounts are used instead while the price is not available.
+	MinValueUSD *float64 `json:"minValueUSD,omitempty" bson:"minValueUSD,omitempty"`
+
+	// NewPayerTransfers is the number of the first transfers from a payer
+	// that are reported as coming from a new payer, 1 by default.
+	NewPayerTransfers *uint `json:"newPayerTransfers,omitempty" bson:"newPayerTransfers,omitempty"`
+
+	// FirehosePush delivers the custom_json firehose to the user's notifiers as well.
+	// By default it only goes to the event stream.
+	FirehosePush *bool `json:"firehosePush,omitempty" bson:"firehosePush,omitempty"`
+
+	// SampleEvery delivers only one in the given number of events and SampleRatePerMinute
+	// delivers the given number of events per minute at most. They are meant for the broad
+	// subscriptions such as story.published for a tag or custom_json.firehose.
+	SampleEvery         *uint `json:"sampleEvery,omitempty"         bson:"sampleEvery,omitempty"`
+	SampleRatePerMinute *uint `json:"sampleRatePerMinute,omitempty" bson:"sampleRatePerMinute,omitempty"`
+
+	// PerBlockRewards sends a notification for every block produced
+	// instead of the daily total of the block production rewards.
+	PerBlockRewards *bool `json:"perBlockRewards,omitempty" bson:"perBlockRewards,omitempty"`
+
+	// MinAccountAgeDays suppresses events caused by accounts younger than the given number of days.
+	MinAccountAgeDays *uint `json:"minAccountAgeDays,omitempty" bson:"minAccountAgeDays,omitempty"`
+}
+
+// MatchesAsset returns true when the asset filter is not set or it contains the given symbol.
+func (settings *Settings) MatchesAsset(symbol string) bool {
+	if len(settings.Assets) == 0 {
+		return true
+	}
+	for _, asset := range settings.Assets {
+		if events.NormalizeAssetSymbol(asset) == symbol {
+			return true
+		}
+	}
+	return false
+}
+
+// MinAmount returns the minimum amount of the given asset, 0 when not set.
+func (settings *Settings) MinAmount(symbol string) float64 {
+	for asset, min := range settings.MinAmounts {
+		if events.NormalizeAssetSymbol(asset) == symbol {
+			return min
+		}
+	}
+	return 0
+}
+
+// NewPayerTransferCount returns NewPayerTransfers or the default when it is not set.
+func (settings *Settings) NewPayerTransferCount() uint {
+	if settings.NewPayerTransfers == nil || *settings.NewPayerTransfers == 0 {
+		return 1
+	}
+	return *settings.NewPayerTransfers
+}
+
+func BindSettings(serverCtx *context.Context, group *echo.Group) {
+	group.GET("/", func(ctx echo.Context) error {
+		var (
+			profile   = ctx.Get("user").(*users.User)
+			eventKind = ctx.Param("kind")
+		)
+
+		query := bson.M{
+			"ownerId": bson.ObjectIdHex(profile.Id),
+			"kind":    eventKind,
+		}
+
+		selector := bson.M{
+			"settings": 1,
+		}
+
+		var doc struct {
+			Settings Settings `bson:"settings"`
+		}
+		err := serverCtx.DB.C("events").Find(query).Select(selector).One(&doc)
+		if err != nil && err != mgo.ErrNotFound {
+			return errors.Wrapf(err, "failed to get settings [query=%+v]", query)
+		}
+
+		ctx.Response().Header().Set(echo.HeaderContentType, "application/json")
+		return json.NewEncoder(ctx.Response().Writer).Encode(&doc.Settings)
+	})
+
+	group.PATCH("/", func(ctx echo.Context) error {
+		var (
+			profile   = ctx.Get("user").(*users.User)
+			eventKind = ctx.Param("kind")
+		)
+
+		var settings Settings
+		if err := json.NewDecoder(ctx.Request().Body).Decode(&settings); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "failed to decode request body")
+		}
+
+		fields, err := DottedFields("settings", &settings)
+		if err != nil {
+			return err
+		}
+		if len(fields) == 0 {
+			return nil
+		}
+
+		selector := bson.M{
+			"ownerId": bson.ObjectIdHex(profile.Id),
+			"kind":    eventKind,
+		}
+
+		update := bson.M{
+			"$set": fields,
+		}
+
+		return serverCtx.PersistConfig(ctx, profile.Id, func() error {
+			_, err := serverCtx.DB.C("events").Upsert(selector, update)
+			return errors.Wrapf(err, "failed to update settings [select=%+v, update=%+v]", selector, update)
+		})
+	})
+}
+
+// DottedFields turns the given document into a set of dotted keys under prefix
+// so that an update only touches the fields that are actually set.
+func DottedFields(prefix string, doc interface{}) (bson.M, error) {
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal document")
+	}
+
+	var values bson.M
+	if err := bson.Unmarshal(raw, &values); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal document")
+	}
+
+	fields := make(bson.M, len(values))
+	for k, v := range values {
+		fields[prefix+"."+k] = v
+	}
+	return fields, nil
+}
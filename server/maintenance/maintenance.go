@@ -0,0 +1,112 @@
+package maintenance
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+// DefaultMessage is displayed when no message is given when enabling maintenance mode.
+const DefaultMessage = "SteemWatch is undergoing scheduled maintenance. Please check back soon."
+
+// Status describes the current maintenance state.
+type Status struct {
+	Enabled bool       `json:"enabled"`
+	Message string     `json:"message,omitempty"`
+	Since   *time.Time `json:"since,omitempty"`
+}
+
+// Mode keeps track of whether the server is in maintenance mode.
+// The listeners registered using OnChange are notified every time the mode is toggled.
+type Mode struct {
+	status    Status
+	listeners []func(Status)
+	lock      sync.RWMutex
+}
+
+func NewMode() *Mode {
+	return &Mode{}
+}
+
+// Set enables or disables maintenance mode. The message is only used when enabling.
+func (mode *Mode) Set(enabled bool, message string) {
+	mode.lock.Lock()
+	if mode.status.Enabled == enabled && (!enabled || mode.status.Message == message) {
+		mode.lock.Unlock()
+		return
+	}
+
+	if enabled {
+		if message == "" {
+			message = DefaultMessage
+		}
+		since := mode.status.Since
+		if since == nil {
+			now := time.Now()
+			since = &now
+		}
+		mode.status = Status{
+			Enabled: true,
+			Message: message,
+			Since:   since,
+		}
+	} else {
+		mode.status = Status{}
+	}
+
+	status := mode.status
+	listeners := mode.listeners
+	mode.lock.Unlock()
+
+	for _, listener := range listeners {
+		listener(status)
+	}
+}
+
+func (mode *Mode) Status() Status {
+	mode.lock.RLock()
+	defer mode.lock.RUnlock()
+	return mode.status
+}
+
+func (mode *Mode) Enabled() bool {
+	return mode.Status().Enabled
+}
+
+// OnChange registers a function to be called when maintenance mode is toggled.
+func (mode *Mode) OnChange(listener func(Status)) {
+	mode.lock.Lock()
+	defer mode.lock.Unlock()
+	mode.listeners = append(mode.listeners, listener)
+}
+
+// Middleware rejects requests while in maintenance mode.
+//
+// Web pages are replaced with the maintenance page rendered from the given template.
+// The API stays read-only, requests modifying anything are rejected.
+// Requests matching skipper are always let through, e.g. assets or the admin API.
+func (mode *Mode) Middleware(templateName string, skipper func(echo.Context) bool) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			status := mode.Status()
+			if !status.Enabled || skipper(ctx) {
+				return next(ctx)
+			}
+
+			ctx.Response().Header().Set("Retry-After", "300")
+
+			req := ctx.Request()
+			if path := req.URL.Path; path == "/api" || strings.HasPrefix(path, "/api/") {
+				if req.Method == http.MethodGet || req.Method == http.MethodHead {
+					return next(ctx)
+				}
+				return echo.NewHTTPError(http.StatusServiceUnavailable, status.Message)
+			}
+
+			return ctx.Render(http.StatusServiceUnavailable, templateName, &status)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package eventstream
+
+import (
+	"github.com/tchap/steemwatch/notifications/events"
+	"github.com/tchap/steemwatch/server/routes/api/profile"
+)
+
+// LargeTransferAmount is the amount, in any asset, from which a transfer is considered critical.
+const LargeTransferAmount = 1000
+
+var (
+	// criticalAlert is for the events the user most likely wants to know about immediately.
+	criticalAlert = &profile.AlertHint{
+		Sound:      "alarm",
+		Vibration:  []uint{0, 500, 200, 500},
+		WakeScreen: true,
+	}
+
+	// noticeAlert is for the events addressed to the user directly.
+	noticeAlert = &profile.AlertHint{
+		Sound:     "default",
+		Vibration: []uint{0, 200},
+	}
+)
+
+// defaultAlerts maps event kinds to the alert hints used unless the user overrides them.
+// The kinds not listed are routine and silent.
+var defaultAlerts = map[string]*profile.AlertHint{
+	// The account update is how the keys are changed.
+	"account.updated":        criticalAlert,
+	"user.mentioned":         noticeAlert,
+	"transfer.new_payer":     noticeAlert,
+	"community.role_changed": noticeAlert,
+	// A stale feed needs the witness to act right away.
+	"witness.feed_stale": criticalAlert,
+}
+
+// alertFor returns the alert hint for the event, nil for a silent event.
+// The overrides are the user's AlertHints setting.
+func alertFor(event *Event, overrides map[string]*profile.AlertHint) *profile.AlertHint {
+	if hint, ok := overrides[event.Kind]; ok {
+		if hint.Silent() {
+			return nil
+		}
+		return hint
+	}
+
+	if payload, ok := event.Payload.(*TransferMadePayload); ok {
+		if value, _, err := events.ParseAmount(payload.Amount); err == nil && value >= LargeTransferAmount {
+			return criticalAlert
+		}
+		return noticeAlert
+	}
+	return defaultAlerts[event.Kind]
+}
@@ -0,0 +1,90 @@
+package eventstream
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/tchap/steemwatch/notifications/events"
+	"github.com/tchap/steemwatch/server/routes/api/profile"
+)
+
+// amountFields are the payload fields holding amounts such as "1.234 STEEM".
+var amountFields = map[string]bool{
+	"amount":             true,
+	"fee":                true,
+	"delegation":         true,
+	"vestingShares":      true,
+	"totalPayout":        true,
+	"pendingPayout":      true,
+	"totalPendingPayout": true,
+	"curatorPayout":      true,
+}
+
+// StructuredAmount is an amount split into the numeric value and the asset symbol.
+// The value is kept as a number literal so that no precision is lost.
+type StructuredAmount struct {
+	Amount json.Number `json:"amount"`
+	Symbol string      `json:"symbol"`
+}
+
+// parseAmount returns the structured form of the amount, false when it is not a valid amount.
+func parseAmount(amount string) (*StructuredAmount, bool) {
+	_, symbol, err := events.ParseAmount(amount)
+	if err != nil {
+		return nil, false
+	}
+	return &StructuredAmount{
+		Amount: json.Number(strings.Fields(amount)[0]),
+		Symbol: symbol,
+	}, true
+}
+
+// structureAmounts rewrites the amounts in the encoded message according to the format.
+// The formatters always produce the raw strings, so the message is returned as it is by default.
+// The fields that do not hold a valid amount, e.g. empty ones, are left untouched.
+func structureAmounts(data []byte, format string) ([]byte, error) {
+	switch format {
+	case profile.AmountFormatStructured, profile.AmountFormatBoth:
+	default:
+		return data, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(replaceAmounts(v, format == profile.AmountFormatBoth))
+}
+
+// replaceAmounts replaces the amount fields with the structured form.
+// With keepRaw set, the raw string is kept and the structured form is added as <field>Parsed.
+func replaceAmounts(v interface{}, keepRaw bool) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if s, ok := value.(string); ok && amountFields[key] {
+				if amount, ok := parseAmount(s); ok {
+					if keepRaw {
+						v[key+"Parsed"] = amount
+					} else {
+						v[key] = amount
+					}
+				}
+				continue
+			}
+			v[key] = replaceAmounts(value, keepRaw)
+		}
+		return v
+	case []interface{}:
+		for i, value := range v {
+			v[i] = replaceAmounts(value, keepRaw)
+		}
+		return v
+	default:
+		return v
+	}
+}
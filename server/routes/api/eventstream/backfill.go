@@ -0,0 +1,92 @@
+package eventstream
+
+import (
+	"log"
+
+	"github.com/tchap/steemwatch/notifications"
+	"github.com/tchap/steemwatch/server/context"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// ControlMessageReplay asks for the last events stored in the history to be sent again,
+// e.g. {"type": "replay", "last": 20} or {"type": "replay", "since": "2018-01-02T15:04:05Z"}.
+// The events are marked as replayed and followed by the ack, so the client knows when
+// the backfill is complete. Unlike the resume on reconnect, it works for all the users,
+// not only the ones with ordered delivery, and it goes further back than the replay buffer.
+const ControlMessageReplay = "replay"
+
+// SetMaxBackfill sets the maximum number of events replayed on the client's request, 0 disables the replay.
+func (manager *Manager) SetMaxBackfill(max uint) {
+	manager.lock.Lock()
+	manager.maxBackfill = max
+	manager.lock.Unlock()
+}
+
+// backfill sends the events requested by the replay control message. The reason to put
+// in the ack is returned when the request cannot be served, the error when the connection is broken.
+func (manager *Manager) backfill(
+	serverCtx *context.Context,
+	userId string,
+	record *connectionRecord,
+	msg *ControlMessage,
+) (string, error) {
+
+	manager.lock.RLock()
+	max := manager.maxBackfill
+	manager.lock.RUnlock()
+
+	if max == 0 {
+		return "replay disabled", nil
+	}
+
+	if msg.Last == 0 && msg.Since == nil {
+		return "either last or since must be set", nil
+	}
+	limit := msg.Last
+	if limit == 0 || limit > max {
+		limit = max
+	}
+
+	query := bson.M{
+		"ownerId": bson.ObjectIdHex(userId),
+	}
+	if msg.Since != nil {
+		query["createdAt"] = bson.M{"$gt": *msg.Since}
+	}
+
+	// The newest entries are selected, then sent oldest first.
+	var entries []*notifications.HistoryEntry
+	err := serverCtx.DB.C("history").Find(query).Sort("-seq", "-createdAt").Limit(int(limit)).All(&entries)
+	if err != nil {
+		log.Printf("failed to get history for user %v: %v", userId, err)
+		return "failed to get history", nil
+	}
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if entry.EventKind == notifications.HistoryGapKind {
+			continue
+		}
+
+		event, err := entry.Decode()
+		if err != nil {
+			log.Printf("failed to decode history entry %v: %+v", entry.Id.Hex(), err)
+			continue
+		}
+		ev := formatEvent(manager.links, event)
+		if ev == nil {
+			continue
+		}
+		ev.Labels = entry.Labels
+		ev.Replayed = true
+
+		if !record.prefs.wants(ev) {
+			continue
+		}
+		if err := record.writeJSON(record.prefs.prepare(ev)); err != nil {
+			return "", err
+		}
+	}
+	return "", nil
+}
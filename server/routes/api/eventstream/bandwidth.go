@@ -0,0 +1,167 @@
+package eventstream
+
+import (
+	"encoding/json"
+	"time"
+	"unicode/utf8"
+
+	"github.com/tchap/steemwatch/server/context"
+	"github.com/tchap/steemwatch/server/routes/api/profile"
+
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// MinimalExcerptLength is the maximum length of content excerpts in minimal payloads.
+const MinimalExcerptLength = 140
+
+// ConnectionStats describes the traffic of a single event stream connection.
+// BytesWritten counts the payload bytes before compression.
+type ConnectionStats struct {
+	Connected       bool      `json:"connected"`
+	ConnectedAt     time.Time `json:"connectedAt,omitempty"`
+	BytesWritten    uint64    `json:"bytesWritten"`
+	MessagesWritten uint64    `json:"messagesWritten"`
+	Compressed      bool      `json:"compressed"`
+	Minimal         bool      `json:"minimal"`
+	FieldNaming     string    `json:"fieldNaming,omitempty"`
+	AmountFormat    string    `json:"amountFormat,omitempty"`
+	// LastActivityAt is when the last message was successfully read or written, see StartReaper.
+	LastActivityAt time.Time `json:"lastActivityAt,omitempty"`
+}
+
+type streamPreferences struct {
+	compression  bool
+	minimal      bool
+	fieldNaming  string
+	amountFormat string
+
+	// labels are the subscription labels the connection is interested in, all events when empty.
+	labels []string
+
+	// alerts are the user's overrides of the default alert hints.
+	alerts map[string]*profile.AlertHint
+
+	// rawOperation adds the operation the event was mined from to the events.
+	rawOperation bool
+}
+
+// wants returns true when the event is to be sent according to the label filter.
+func (prefs *streamPreferences) wants(event *Event) bool {
+	if len(prefs.labels) == 0 {
+		return true
+	}
+	for _, label := range event.Labels {
+		for _, wanted := range prefs.labels {
+			if label == wanted {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func loadStreamPreferences(serverCtx *context.Context, userId string) (*streamPreferences, error) {
+	var doc struct {
+		Settings profile.Settings `bson:"settings"`
+	}
+	selector := bson.M{
+		"settings": 1,
+	}
+	err := serverCtx.DB.C("users").FindId(bson.ObjectIdHex(userId)).Select(selector).One(&doc)
+	if err != nil && err != mgo.ErrNotFound {
+		return nil, errors.Wrapf(err, "failed to get settings for user %v", userId)
+	}
+
+	settings := &doc.Settings
+	return &streamPreferences{
+		compression:  settings.StreamCompression != nil && *settings.StreamCompression,
+		minimal:      settings.MinimalPayloads != nil && *settings.MinimalPayloads,
+		fieldNaming:  settings.FieldNaming,
+		amountFormat: settings.AmountFormat,
+		alerts:       settings.AlertHints,
+	}, nil
+}
+
+// prepare returns the event as it is to be written to the connection,
+// i.e. with the alert hint set and minimized when requested.
+// The event itself is shared, so it is copied rather than modified.
+func (prefs *streamPreferences) prepare(event *Event) *Event {
+	alerted := *event
+	alerted.Alert = alertFor(event, prefs.alerts)
+	if !prefs.rawOperation {
+		// The event may be shared with a connection that asked for the operation.
+		alerted.Operation = nil
+	}
+	if prefs.minimal {
+		return minimize(&alerted)
+	}
+	return &alerted
+}
+
+// optionalFields can be reconstructed by the client or are not essential.
+var optionalFields = []string{
+	"link",
+	"tags",
+	"parentPermlink",
+	"totalPayout",
+	"pendingPayout",
+	"totalPendingPayout",
+}
+
+// minimize drops the optional fields from the event payload and shortens content excerpts.
+func minimize(event *Event) *Event {
+	if digest, ok := event.Payload.(*DigestPayload); ok {
+		minimal := *digest
+		minimal.Events = make([]*Event, 0, len(digest.Events))
+		for _, ev := range digest.Events {
+			minimal.Events = append(minimal.Events, minimize(ev))
+		}
+		return &Event{
+			Kind:      event.Kind,
+			Seq:       event.Seq,
+			Replayed:  event.Replayed,
+			Display:   event.Display,
+			Title:     event.Title,
+			MatchedBy: event.MatchedBy,
+			Labels:    event.Labels,
+			Alert:     event.Alert,
+			Operation: event.Operation,
+			Payload:   &minimal,
+		}
+	}
+
+	raw, err := json.Marshal(event.Payload)
+	if err != nil {
+		return event
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		// Not an object.
+		return event
+	}
+
+	for _, field := range optionalFields {
+		delete(payload, field)
+	}
+	if content, ok := payload["content"].(string); ok {
+		if utf8.RuneCountInString(content) > MinimalExcerptLength {
+			payload["content"] = string([]rune(content)[:MinimalExcerptLength]) + "…"
+			payload["more"] = true
+		}
+	}
+
+	return &Event{
+		Kind:      event.Kind,
+		Seq:       event.Seq,
+		Replayed:  event.Replayed,
+		Display:   event.Display,
+		Title:     event.Title,
+		MatchedBy: event.MatchedBy,
+		Labels:    event.Labels,
+		Alert:     event.Alert,
+		Operation: event.Operation,
+		Payload:   payload,
+	}
+}
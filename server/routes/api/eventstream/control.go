@@ -0,0 +1,75 @@
+package eventstream
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/tchap/steemwatch/server/context"
+)
+
+// ControlMessage is sent by the client over the event stream connection.
+type ControlMessage struct {
+	Type string `json:"type"`
+	// Id is echoed back in the ack so that the client can pair the messages.
+	Id string `json:"id,omitempty"`
+
+	// Last and Since select the events to replay, see ControlMessageReplay.
+	Last  uint       `json:"last,omitempty"`
+	Since *time.Time `json:"since,omitempty"`
+}
+
+const ControlMessageReload = "reload"
+
+type ControlAckPayload struct {
+	Type  string `json:"type"`
+	Id    string `json:"id,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// handleControlMessage processes a message sent by the client and acks it.
+// Only a failure to write the ack is returned since that means the connection is broken.
+func (manager *Manager) handleControlMessage(
+	serverCtx *context.Context,
+	userId string,
+	record *connectionRecord,
+	data []byte,
+) error {
+
+	var (
+		msg ControlMessage
+		ack ControlAckPayload
+	)
+	if err := json.Unmarshal(data, &msg); err != nil {
+		ack.Error = "invalid control message"
+	} else {
+		ack.Type = msg.Type
+		ack.Id = msg.Id
+
+		switch msg.Type {
+		case ControlMessageReload:
+			if err := manager.reload(userId); err != nil {
+				log.Printf("failed to reload subscriptions for user %v: %+v", userId, err)
+				ack.Error = "failed to reload subscriptions"
+			}
+		case ControlMessageDismissOnboarding:
+			if err := dismissOnboarding(serverCtx.DB, userId); err != nil {
+				log.Printf("failed to dismiss onboarding for user %v: %+v", userId, err)
+				ack.Error = "failed to dismiss onboarding"
+			}
+		case ControlMessageReplay:
+			reason, err := manager.backfill(serverCtx, userId, record, &msg)
+			if err != nil {
+				return err
+			}
+			ack.Error = reason
+		default:
+			ack.Error = "unknown control message type"
+		}
+	}
+
+	return record.writeJSON(&Event{
+		Kind:    "control.ack",
+		Payload: &ack,
+	})
+}
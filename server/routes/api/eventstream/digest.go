@@ -0,0 +1,133 @@
+package eventstream
+
+import (
+	"time"
+
+	"github.com/tchap/steemwatch/links"
+	"github.com/tchap/steemwatch/notifications/events"
+)
+
+// formatEvent formats any of the supported events.
+func formatEvent(lb *links.Builder, event interface{}) *Event {
+	switch event := event.(type) {
+	case *events.AccountUpdated:
+		return formatAccountUpdated(lb, event)
+	case *events.AccountWitnessVoted:
+		return formatAccountWitnessVoted(lb, event)
+	case *events.TransferMade:
+		return formatTransferMade(lb, event)
+	case *events.UserMentioned:
+		return formatUserMentioned(lb, event)
+	case *events.UserFollowStatusChanged:
+		return formatUserFollowStatusChanged(lb, event)
+	case *events.StoryPublished:
+		return formatStoryPublished(lb, event)
+	case *events.StoryVoted:
+		return formatStoryVoted(lb, event)
+	case *events.CommentPublished:
+		return formatCommentPublished(lb, event)
+	case *events.CommentVoted:
+		return formatCommentVoted(lb, event)
+	case *events.AccountCreationTokenClaimed:
+		return formatAccountCreationTokenClaimed(lb, event)
+	case *events.PayoutApproaching:
+		return formatPayoutApproaching(lb, event)
+	case *events.PostPaidOut:
+		return formatPostPaidOut(lb, event)
+	case *events.WitnessPropertiesSet:
+		return formatWitnessPropertiesSet(lb, event)
+	case *events.BlockProductionRewardReceived:
+		return formatBlockProductionRewardReceived(lb, event)
+	case *events.CommunitySubscriptionChanged:
+		return formatCommunitySubscriptionChanged(lb, event)
+	case *events.CommunityRoleChanged:
+		return formatCommunityRoleChanged(lb, event)
+	case *events.NewPayerDetected:
+		return formatNewPayerDetected(lb, event)
+	case *events.CustomJSONBroadcast:
+		return formatCustomJSONBroadcast(lb, event)
+	case *events.AccountCreated:
+		return formatAccountCreated(lb, event)
+	case *events.AccountActivity:
+		return formatAccountActivity(lb, event)
+	case *events.RCDelegated:
+		return formatRCDelegated(lb, event)
+	case *events.RCDelegationRemoved:
+		return formatRCDelegationRemoved(lb, event)
+	case *events.WitnessFeedStale:
+		return formatWitnessFeedStale(lb, event)
+	case *events.WitnessFeedRecovered:
+		return formatWitnessFeedRecovered(lb, event)
+	default:
+		return nil
+	}
+}
+
+type DigestPayload struct {
+	Since  time.Time `json:"since"`
+	Until  time.Time `json:"until"`
+	Events []*Event  `json:"events"`
+}
+
+func formatDigest(lb *links.Builder, digest *events.Digest) *Event {
+	payload := &DigestPayload{
+		Since:  digest.Since,
+		Until:  digest.Until,
+		Events: make([]*Event, 0, len(digest.Events)),
+	}
+	for _, event := range digest.Events {
+		if formatted := formatEvent(lb, event); formatted != nil {
+			payload.Events = append(payload.Events, formatted)
+		}
+	}
+
+	return &Event{
+		Kind:    "digest",
+		Display: events.DisplayOf(digest),
+		Payload: payload,
+	}
+}
+
+// DailySummaryPayload carries the numbers of the daily summary, the sections
+// not chosen by the user are omitted.
+type DailySummaryPayload struct {
+	Day       string               `json:"day"`
+	Since     time.Time            `json:"since"`
+	Until     time.Time            `json:"until"`
+	Events    uint                 `json:"events"`
+	Mentions  *uint                `json:"mentions,omitempty"`
+	Flows     []*events.AssetFlow  `json:"transfers,omitempty"`
+	TopVoters []*events.VoterCount `json:"topVoters,omitempty"`
+	Rewards   []*events.AssetTotal `json:"rewards,omitempty"`
+	Notable   []string             `json:"notable,omitempty"`
+}
+
+func formatDailySummary(lb *links.Builder, summary *events.DailySummary) *Event {
+	payload := &DailySummaryPayload{
+		Day:    summary.Day,
+		Since:  summary.Since,
+		Until:  summary.Until,
+		Events: summary.Events,
+	}
+	if summary.Includes(events.SummarySectionMentions) {
+		payload.Mentions = &summary.Mentions
+	}
+	if summary.Includes(events.SummarySectionTransfers) {
+		payload.Flows = summary.Flows
+	}
+	if summary.Includes(events.SummarySectionVoters) {
+		payload.TopVoters = summary.TopVoters
+	}
+	if summary.Includes(events.SummarySectionRewards) {
+		payload.Rewards = summary.Rewards
+	}
+	if summary.Includes(events.SummarySectionNotable) {
+		payload.Notable = summary.Notable
+	}
+
+	return &Event{
+		Kind:    "daily_summary",
+		Display: events.DisplayOf(summary),
+		Payload: payload,
+	}
+}
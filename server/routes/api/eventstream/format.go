@@ -2,23 +2,44 @@ package eventstream
 
 import (
 	"bufio"
+	"encoding/json"
 	"strings"
+	"time"
 
+	"github.com/tchap/steemwatch/links"
 	"github.com/tchap/steemwatch/notifications/events"
+	"github.com/tchap/steemwatch/server/routes/api/profile"
 )
 
 type Event struct {
-	Kind    string      `json:"kind"`
-	Payload interface{} `json:"payload,omitempty"`
+	Kind string `json:"kind"`
+	// Seq is the per-user sequence number, set for the users with ordered delivery.
+	// A gap in the sequence means that an event was missed.
+	Seq uint64 `json:"seq,omitempty"`
+	// Replayed is set for the events sent again on the client's request, see ControlMessageReplay.
+	Replayed bool            `json:"replayed,omitempty"`
+	Display  *events.Display `json:"display,omitempty"`
+	// Title is the short title rendered from the user's title template.
+	Title string `json:"title,omitempty"`
+	// MatchedBy describes the subscription that caused the event, e.g. "mention of @alice".
+	MatchedBy string `json:"matchedBy,omitempty"`
+	// Labels are the labels the user put on the matched subscription.
+	Labels []string `json:"labels,omitempty"`
+	// Alert is the advisory sound and vibration hint for the native clients, see alertFor.
+	Alert *profile.AlertHint `json:"alert,omitempty"`
+	// Operation is the raw operation the event was mined from, sent on request only.
+	Operation *RawOperation `json:"operation,omitempty"`
+	Payload   interface{}   `json:"payload,omitempty"`
 }
 
 type AccountUpdatedPayload struct {
 	Account string `json:"account"`
 }
 
-func formatAccountUpdated(event *events.AccountUpdated) *Event {
+func formatAccountUpdated(lb *links.Builder, event *events.AccountUpdated) *Event {
 	return &Event{
-		Kind: "account.updated",
+		Kind:    "account.updated",
+		Display: events.DisplayOf(event),
 		Payload: &AccountUpdatedPayload{
 			Account: event.Op.Account,
 		},
@@ -31,9 +52,10 @@ type AccountWitnessVotedPayload struct {
 	Approve bool   `json:"approve"`
 }
 
-func formatAccountWitnessVoted(event *events.AccountWitnessVoted) *Event {
+func formatAccountWitnessVoted(lb *links.Builder, event *events.AccountWitnessVoted) *Event {
 	return &Event{
-		Kind: "account.witness_voted",
+		Kind:    "account.witness_voted",
+		Display: events.DisplayOf(event),
 		Payload: &AccountWitnessVotedPayload{
 			Account: event.Op.Account,
 			Witness: event.Op.Witness,
@@ -47,33 +69,88 @@ type TransferMadePayload struct {
 	To     string `json:"to"`
 	Amount string `json:"amount"`
 	Memo   string `json:"memo,omitempty"`
+
+	Exchange  *TransferExchangePayload  `json:"exchange,omitempty"`
+	Match     *TransferMatchPayload     `json:"match,omitempty"`
+	RoundTrip *TransferRoundTripPayload `json:"roundTrip,omitempty"`
+}
+
+// TransferMatchPayload tells which side of the transfer is the watched account.
+type TransferMatchPayload struct {
+	Account   string `json:"account"`
+	Side      string `json:"side"`
+	Direction string `json:"direction"`
+	Internal  bool   `json:"internal"`
+}
+
+// TransferRoundTripPayload describes the transfer that sent the amount back.
+type TransferRoundTripPayload struct {
+	Memo string `json:"memo,omitempty"`
 }
 
-func formatTransferMade(event *events.TransferMade) *Event {
+type TransferExchangePayload struct {
+	Account      string `json:"account"`
+	Label        string `json:"label"`
+	Deposit      bool   `json:"deposit"`
+	MemoRequired bool   `json:"memoRequired"`
+}
+
+func formatTransferMade(lb *links.Builder, event *events.TransferMade) *Event {
+	payload := &TransferMadePayload{
+		From:   event.Op.From,
+		To:     event.Op.To,
+		Amount: event.Op.Amount,
+		Memo:   event.Op.Memo,
+	}
+	if exchange := event.Exchange; exchange != nil {
+		payload.Exchange = &TransferExchangePayload{
+			Account:      exchange.Account,
+			Label:        exchange.Label,
+			Deposit:      exchange.Deposit,
+			MemoRequired: exchange.MemoRequired(),
+		}
+	}
+	if match := event.Match; match != nil {
+		side := "from"
+		if match.Incoming {
+			side = "to"
+		}
+		payload.Match = &TransferMatchPayload{
+			Account:   match.Account,
+			Side:      side,
+			Direction: match.Direction(),
+			Internal:  match.Internal,
+		}
+	}
+	if trip := event.RoundTrip; trip != nil {
+		payload.RoundTrip = &TransferRoundTripPayload{
+			Memo: trip.Return.Memo,
+		}
+	}
+
 	return &Event{
-		Kind: "transfer.made",
-		Payload: &TransferMadePayload{
-			From:   event.Op.From,
-			To:     event.Op.To,
-			Amount: event.Op.Amount,
-			Memo:   event.Op.Memo,
-		},
+		Kind:    "transfer.made",
+		Display: events.DisplayOf(event),
+		Payload: payload,
 	}
 }
 
 type UserMentionedPayload struct {
 	User     string `json:"user"`
 	URL      string `json:"url"`
+	Link     string `json:"link"`
 	Author   string `json:"author"`
 	Permlink string `json:"permlink"`
 }
 
-func formatUserMentioned(event *events.UserMentioned) *Event {
+func formatUserMentioned(lb *links.Builder, event *events.UserMentioned) *Event {
 	return &Event{
-		Kind: "user.mentioned",
+		Kind:    "user.mentioned",
+		Display: events.DisplayOf(event),
 		Payload: &UserMentionedPayload{
 			User:     event.User,
 			URL:      event.Content.URL,
+			Link:     lb.Content(event.Content.URL),
 			Author:   event.Content.Author,
 			Permlink: event.Content.Permlink,
 		},
@@ -86,7 +163,7 @@ type UserFollowStatusChangedPayload struct {
 	What      string `json:"what,omitempty"`
 }
 
-func formatUserFollowStatusChanged(event *events.UserFollowStatusChanged) *Event {
+func formatUserFollowStatusChanged(lb *links.Builder, event *events.UserFollowStatusChanged) *Event {
 	var what string
 	for _, v := range event.Op.What {
 		what = v
@@ -102,7 +179,8 @@ func formatUserFollowStatusChanged(event *events.UserFollowStatusChanged) *Event
 	}
 
 	return &Event{
-		Kind: "user.follow_changed",
+		Kind:    "user.follow_changed",
+		Display: events.DisplayOf(event),
 		Payload: &UserFollowStatusChangedPayload{
 			Follower:  event.Op.Follower,
 			Following: event.Op.Following,
@@ -115,17 +193,22 @@ type StoryPublishedPayload struct {
 	Author string   `json:"author"`
 	Title  string   `json:"title"`
 	URL    string   `json:"url"`
+	Link   string   `json:"link"`
 	Tags   []string `json:"tags"`
+	Edited bool     `json:"edited,omitempty"`
 }
 
-func formatStoryPublished(event *events.StoryPublished) *Event {
+func formatStoryPublished(lb *links.Builder, event *events.StoryPublished) *Event {
 	return &Event{
-		Kind: "story.published",
+		Kind:    "story.published",
+		Display: events.DisplayOf(event),
 		Payload: &StoryPublishedPayload{
 			Author: event.Content.Author,
 			Title:  event.Content.Title,
 			URL:    event.Content.URL,
+			Link:   lb.Content(event.Content.URL),
 			Tags:   event.Content.JsonMetadata.Tags,
+			Edited: event.Edited,
 		},
 	}
 }
@@ -136,37 +219,50 @@ type StoryVotedPayload struct {
 	Author             string `json:"author"`
 	Title              string `json:"title"`
 	URL                string `json:"url"`
+	Link               string `json:"link"`
 	TotalPayout        string `json:"totalPayout"`
 	PendingPayout      string `json:"pendingPayout"`
 	TotalPendingPayout string `json:"totalPendingPayout"`
+	PreviousWeight     *int16 `json:"previousWeight,omitempty"`
+	WeightDelta        *int16 `json:"weightDelta,omitempty"`
 }
 
-func formatStoryVoted(event *events.StoryVoted) *Event {
+func formatStoryVoted(lb *links.Builder, event *events.StoryVoted) *Event {
+	payload := &StoryVotedPayload{
+		Voter:              event.Op.Voter,
+		VoteWeight:         int16(event.Op.Weight),
+		Author:             event.Content.Author,
+		Title:              event.Content.Title,
+		URL:                event.Content.URL,
+		Link:               lb.Content(event.Content.URL),
+		TotalPayout:        event.Content.TotalPayoutValue,
+		PendingPayout:      event.Content.PendingPayoutValue,
+		TotalPendingPayout: event.Content.TotalPendingPayoutValue,
+	}
+	if event.Revote != nil {
+		payload.PreviousWeight = &event.Revote.PreviousWeight
+		payload.WeightDelta = &event.Revote.Delta
+	}
+
 	return &Event{
-		Kind: "story.voted",
-		Payload: &StoryVotedPayload{
-			Voter:              event.Op.Voter,
-			VoteWeight:         int16(event.Op.Weight),
-			Author:             event.Content.Author,
-			Title:              event.Content.Title,
-			URL:                event.Content.URL,
-			TotalPayout:        event.Content.TotalPayoutValue,
-			PendingPayout:      event.Content.PendingPayoutValue,
-			TotalPendingPayout: event.Content.TotalPendingPayoutValue,
-		},
+		Kind:    "story.voted",
+		Display: events.DisplayOf(event),
+		Payload: payload,
 	}
 }
 
 type CommentPublishedPayload struct {
 	Author         string `json:"author"`
 	URL            string `json:"url"`
+	Link           string `json:"link"`
 	ParentAuthor   string `json:"parentAuthor"`
 	ParentPermlink string `json:"parentPermlink"`
 	Content        string `json:"content,omitempty"`
 	ReadMore       bool   `json:"more,omitempty"`
+	Edited         bool   `json:"edited,omitempty"`
 }
 
-func formatCommentPublished(event *events.CommentPublished) *Event {
+func formatCommentPublished(lb *links.Builder, event *events.CommentPublished) *Event {
 	commentLines := make([]string, 0, 5)
 	scanner := bufio.NewScanner(strings.NewReader(event.Content.Body))
 	i := 0
@@ -179,14 +275,17 @@ func formatCommentPublished(event *events.CommentPublished) *Event {
 	more := i == 5
 
 	return &Event{
-		Kind: "comment.published",
+		Kind:    "comment.published",
+		Display: events.DisplayOf(event),
 		Payload: &CommentPublishedPayload{
 			Author:         event.Content.Author,
 			URL:            event.Content.URL,
+			Link:           lb.Content(event.Content.URL),
 			ParentAuthor:   event.Content.ParentAuthor,
 			ParentPermlink: event.Content.ParentPermlink,
 			Content:        content,
 			ReadMore:       more,
+			Edited:         event.Edited,
 		},
 	}
 }
@@ -197,23 +296,352 @@ type CommentVotedPayload struct {
 	Author             string `json:"author"`
 	Permlink           string `json:"permlink"`
 	URL                string `json:"url"`
+	Link               string `json:"link"`
 	TotalPayout        string `json:"totalPayout"`
 	PendingPayout      string `json:"pendingPayout"`
 	TotalPendingPayout string `json:"totalPendingPayout"`
+	PreviousWeight     *int16 `json:"previousWeight,omitempty"`
+	WeightDelta        *int16 `json:"weightDelta,omitempty"`
+}
+
+func formatCommentVoted(lb *links.Builder, event *events.CommentVoted) *Event {
+	payload := &CommentVotedPayload{
+		Voter:              event.Op.Voter,
+		VoteWeight:         int16(event.Op.Weight),
+		Author:             event.Content.Author,
+		Permlink:           event.Content.Permlink,
+		URL:                event.Content.URL,
+		Link:               lb.Content(event.Content.URL),
+		TotalPayout:        event.Content.TotalPayoutValue,
+		PendingPayout:      event.Content.PendingPayoutValue,
+		TotalPendingPayout: event.Content.TotalPendingPayoutValue,
+	}
+	if event.Revote != nil {
+		payload.PreviousWeight = &event.Revote.PreviousWeight
+		payload.WeightDelta = &event.Revote.Delta
+	}
+
+	return &Event{
+		Kind:    "comment.voted",
+		Display: events.DisplayOf(event),
+		Payload: payload,
+	}
+}
+
+type AccountCreationTokenClaimedPayload struct {
+	Creator    string `json:"creator"`
+	Fee        string `json:"fee"`
+	PaidWithRC bool   `json:"paidWithRC"`
+}
+
+func formatAccountCreationTokenClaimed(
+	lb *links.Builder,
+	event *events.AccountCreationTokenClaimed,
+) *Event {
+
+	return &Event{
+		Kind:    "account.creation_token_claimed",
+		Display: events.DisplayOf(event),
+		Payload: &AccountCreationTokenClaimedPayload{
+			Creator:    event.Op.Creator,
+			Fee:        event.Op.Fee,
+			PaidWithRC: event.PaidWithRC(),
+		},
+	}
+}
+
+type PayoutApproachingPayload struct {
+	Author        string    `json:"author"`
+	Title         string    `json:"title"`
+	URL           string    `json:"url"`
+	Link          string    `json:"link"`
+	CashoutTime   time.Time `json:"cashoutTime"`
+	LeadTime      string    `json:"leadTime"`
+	PendingPayout string    `json:"pendingPayout"`
+}
+
+func formatPayoutApproaching(lb *links.Builder, event *events.PayoutApproaching) *Event {
+	payload := &PayoutApproachingPayload{
+		Author:        event.Content.Author,
+		Title:         event.Content.Title,
+		URL:           event.Content.URL,
+		Link:          lb.Content(event.Content.URL),
+		LeadTime:      event.LeadTime.String(),
+		PendingPayout: event.Content.PendingPayoutValue,
+	}
+	if t := event.Content.CashoutTime; t != nil && t.Time != nil {
+		payload.CashoutTime = *t.Time
+	}
+
+	return &Event{
+		Kind:    "post.payout_approaching",
+		Display: events.DisplayOf(event),
+		Payload: payload,
+	}
+}
+
+type PostPaidOutPayload struct {
+	Author        string `json:"author"`
+	Title         string `json:"title"`
+	URL           string `json:"url"`
+	Link          string `json:"link"`
+	TotalPayout   string `json:"totalPayout"`
+	CuratorPayout string `json:"curatorPayout"`
+}
+
+func formatPostPaidOut(lb *links.Builder, event *events.PostPaidOut) *Event {
+	return &Event{
+		Kind:    "post.paid_out",
+		Display: events.DisplayOf(event),
+		Payload: &PostPaidOutPayload{
+			Author:        event.Content.Author,
+			Title:         event.Content.Title,
+			URL:           event.Content.URL,
+			Link:          lb.Content(event.Content.URL),
+			TotalPayout:   event.Content.TotalPayoutValue,
+			CuratorPayout: event.CuratorPayout,
+		},
+	}
+}
+
+type WitnessPropertiesSetPayload struct {
+	Owner      string                    `json:"owner"`
+	Properties []*events.WitnessProperty `json:"properties"`
+}
+
+func formatWitnessPropertiesSet(lb *links.Builder, event *events.WitnessPropertiesSet) *Event {
+	return &Event{
+		Kind:    "witness.properties_set",
+		Display: events.DisplayOf(event),
+		Payload: &WitnessPropertiesSetPayload{
+			Owner:      event.Op.Owner,
+			Properties: event.Properties,
+		},
+	}
+}
+
+type BlockProductionRewardReceivedPayload struct {
+	Producer      string `json:"producer"`
+	VestingShares string `json:"vestingShares"`
+	Blocks        uint   `json:"blocks"`
+	Day           string `json:"day,omitempty"`
+}
+
+func formatBlockProductionRewardReceived(
+	lb *links.Builder,
+	event *events.BlockProductionRewardReceived,
+) *Event {
+
+	return &Event{
+		Kind:    "witness.production_reward",
+		Display: events.DisplayOf(event),
+		Payload: &BlockProductionRewardReceivedPayload{
+			Producer:      event.Op.Producer,
+			VestingShares: event.Op.VestingShares,
+			Blocks:        event.Blocks,
+			Day:           event.Day,
+		},
+	}
+}
+
+type CommunitySubscriptionChangedPayload struct {
+	Account    string `json:"account"`
+	Community  string `json:"community"`
+	Subscribed bool   `json:"subscribed"`
+}
+
+func formatCommunitySubscriptionChanged(
+	lb *links.Builder,
+	event *events.CommunitySubscriptionChanged,
+) *Event {
+
+	return &Event{
+		Kind:    "community.subscription_changed",
+		Display: events.DisplayOf(event),
+		Payload: &CommunitySubscriptionChangedPayload{
+			Account:    event.Op.Account,
+			Community:  event.Op.Community,
+			Subscribed: event.Subscribed(),
+		},
+	}
+}
+
+type CommunityRoleChangedPayload struct {
+	Account   string `json:"account"`
+	Community string `json:"community"`
+	Target    string `json:"target"`
+	Role      string `json:"role"`
+}
+
+func formatCommunityRoleChanged(lb *links.Builder, event *events.CommunityRoleChanged) *Event {
+	return &Event{
+		Kind:    "community.role_changed",
+		Display: events.DisplayOf(event),
+		Payload: &CommunityRoleChangedPayload{
+			Account:   event.Op.Account,
+			Community: event.Op.Community,
+			Target:    event.Op.Target,
+			Role:      event.Op.Role,
+		},
+	}
+}
+
+type NewPayerDetectedPayload struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Amount    string `json:"amount"`
+	Memo      string `json:"memo,omitempty"`
+	Transfers uint   `json:"transfers"`
+}
+
+func formatNewPayerDetected(lb *links.Builder, event *events.NewPayerDetected) *Event {
+	return &Event{
+		Kind:    "transfer.new_payer",
+		Display: events.DisplayOf(event),
+		Payload: &NewPayerDetectedPayload{
+			From:      event.Op.From,
+			To:        event.Op.To,
+			Amount:    event.Op.Amount,
+			Memo:      event.Op.Memo,
+			Transfers: event.Transfers,
+		},
+	}
+}
+
+type CustomJSONBroadcastPayload struct {
+	Id                   string          `json:"id"`
+	RequiredAuths        []string        `json:"requiredAuths"`
+	RequiredPostingAuths []string        `json:"requiredPostingAuths"`
+	JSON                 json.RawMessage `json:"json"`
+}
+
+func formatCustomJSONBroadcast(lb *links.Builder, event *events.CustomJSONBroadcast) *Event {
+	// Pass the JSON on as it is when it is valid, as a string otherwise.
+	data := json.RawMessage(event.Op.JSON)
+	if !json.Valid(data) {
+		data, _ = json.Marshal(event.Op.JSON)
+	}
+
+	return &Event{
+		Kind:    "custom_json.firehose",
+		Display: events.DisplayOf(event),
+		Payload: &CustomJSONBroadcastPayload{
+			Id:                   event.Op.ID,
+			RequiredAuths:        event.Op.RequiredAuths,
+			RequiredPostingAuths: event.Op.RequiredPostingAuths,
+			JSON:                 data,
+		},
+	}
+}
+
+type AccountCreatedPayload struct {
+	Creator    string `json:"creator"`
+	Account    string `json:"account"`
+	Fee        string `json:"fee"`
+	Delegation string `json:"delegation"`
+}
+
+func formatAccountCreated(lb *links.Builder, event *events.AccountCreated) *Event {
+	return &Event{
+		Kind:    "account.created",
+		Display: events.DisplayOf(event),
+		Payload: &AccountCreatedPayload{
+			Creator:    event.Op.Creator,
+			Account:    event.Op.NewAccountName,
+			Fee:        event.Op.Fee,
+			Delegation: event.Op.Delegation,
+		},
+	}
+}
+
+type HardforkActivatedPayload struct {
+	HardforkId uint32 `json:"hardforkId"`
+}
+
+func formatHardforkActivated(lb *links.Builder, event *events.HardforkActivated) *Event {
+	return &Event{
+		Kind:    "chain.hardfork_activated",
+		Display: events.DisplayOf(event),
+		Payload: &HardforkActivatedPayload{
+			HardforkId: event.Op.HardforkId,
+		},
+	}
+}
+
+type AccountActivityPayload struct {
+	OpType   string          `json:"opType"`
+	Accounts []string        `json:"accounts"`
+	Body     json.RawMessage `json:"body"`
+}
+
+func formatAccountActivity(lb *links.Builder, event *events.AccountActivity) *Event {
+	return &Event{
+		Kind:    "account.activity",
+		Display: events.DisplayOf(event),
+		Payload: &AccountActivityPayload{
+			OpType:   event.OpType,
+			Accounts: event.Accounts,
+			Body:     event.Body,
+		},
+	}
+}
+
+type RCDelegationPayload struct {
+	Delegator string `json:"delegator"`
+	Delegatee string `json:"delegatee"`
+	MaxRC     int64  `json:"maxRC"`
+}
+
+func formatRCDelegated(lb *links.Builder, event *events.RCDelegated) *Event {
+	return &Event{
+		Kind:    "rc.delegated",
+		Display: events.DisplayOf(event),
+		Payload: &RCDelegationPayload{
+			Delegator: event.Op.Delegator,
+			Delegatee: event.Op.Delegatee,
+			MaxRC:     event.Op.MaxRC,
+		},
+	}
+}
+
+func formatRCDelegationRemoved(lb *links.Builder, event *events.RCDelegationRemoved) *Event {
+	return &Event{
+		Kind:    "rc.delegation_removed",
+		Display: events.DisplayOf(event),
+		Payload: &RCDelegationPayload{
+			Delegator: event.Op.Delegator,
+			Delegatee: event.Op.Delegatee,
+		},
+	}
+}
+
+type WitnessFeedPayload struct {
+	Witness     string     `json:"witness"`
+	LastPublish time.Time  `json:"lastPublish"`
+	Threshold   string     `json:"threshold,omitempty"`
+	PublishedAt *time.Time `json:"publishedAt,omitempty"`
+}
+
+func formatWitnessFeedStale(lb *links.Builder, event *events.WitnessFeedStale) *Event {
+	return &Event{
+		Kind:    "witness.feed_stale",
+		Display: events.DisplayOf(event),
+		Payload: &WitnessFeedPayload{
+			Witness:     event.Witness,
+			LastPublish: event.LastPublish,
+			Threshold:   event.Threshold.String(),
+		},
+	}
 }
 
-func formatCommentVoted(event *events.CommentVoted) *Event {
+func formatWitnessFeedRecovered(lb *links.Builder, event *events.WitnessFeedRecovered) *Event {
 	return &Event{
-		Kind: "comment.voted",
-		Payload: &CommentVotedPayload{
-			Voter:              event.Op.Voter,
-			VoteWeight:         int16(event.Op.Weight),
-			Author:             event.Content.Author,
-			Permlink:           event.Content.Permlink,
-			URL:                event.Content.URL,
-			TotalPayout:        event.Content.TotalPayoutValue,
-			PendingPayout:      event.Content.PendingPayoutValue,
-			TotalPendingPayout: event.Content.TotalPendingPayoutValue,
+		Kind:    "witness.feed_recovered",
+		Display: events.DisplayOf(event),
+		Payload: &WitnessFeedPayload{
+			Witness:     event.Witness,
+			LastPublish: event.LastPublish,
+			PublishedAt: &event.PublishedAt,
 		},
 	}
 }
@@ -0,0 +1,357 @@
+package eventstream
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tchap/steemwatch/links"
+	"github.com/tchap/steemwatch/notifications"
+	"github.com/tchap/steemwatch/notifications/events"
+
+	"github.com/pkg/errors"
+	"github.com/valyala/fasthttp"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Forwarder sends the formatted events to the ingest endpoint of other steemwatch instances.
+// It is meant to be registered as an additional notifier so that it receives every event.
+type Forwarder struct {
+	links   *links.Builder
+	urls    []string
+	secret  string
+	timeout time.Duration
+
+	// seq is only set on the views returned by Sequenced.
+	seq uint64
+	// matchedBy is only set on the views returned by MatchedBy.
+	matchedBy string
+	// labels are only set on the views returned by Labeled.
+	labels []string
+}
+
+func NewForwarder(lb *links.Builder, urls []string, secret string) *Forwarder {
+	return &Forwarder{
+		links:   lb,
+		urls:    urls,
+		secret:  secret,
+		timeout: 10 * time.Second,
+	}
+}
+
+// ForwardsEvents marks the forwarder as a notifications.EventForwarder,
+// so that the events ingested from the other instances are not sent back.
+func (forwarder *Forwarder) ForwardsEvents() {}
+
+// Sequenced returns a forwarder that stamps the events with the given sequence number.
+func (forwarder *Forwarder) Sequenced(seq uint64) notifications.Notifier {
+	view := *forwarder
+	view.seq = seq
+	return &view
+}
+
+// MatchedBy returns a view of the forwarder that stamps the events with the given reason.
+func (forwarder *Forwarder) MatchedBy(reason string) interface{} {
+	view := *forwarder
+	view.matchedBy = reason
+	return &view
+}
+
+// Labeled returns a view of the forwarder that stamps the events with the given labels.
+func (forwarder *Forwarder) Labeled(labels []string) interface{} {
+	view := *forwarder
+	view.labels = labels
+	return &view
+}
+
+func (forwarder *Forwarder) DispatchAccountUpdatedEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.AccountUpdated,
+) error {
+	return forwarder.forward(userId, formatAccountUpdated(forwarder.links, event), event)
+}
+
+func (forwarder *Forwarder) DispatchAccountWitnessVotedEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.AccountWitnessVoted,
+) error {
+	return forwarder.forward(userId, formatAccountWitnessVoted(forwarder.links, event), event)
+}
+
+func (forwarder *Forwarder) DispatchTransferMadeEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.TransferMade,
+) error {
+	return forwarder.forward(userId, formatTransferMade(forwarder.links, event), event)
+}
+
+func (forwarder *Forwarder) DispatchUserMentionedEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.UserMentioned,
+) error {
+	return forwarder.forward(userId, formatUserMentioned(forwarder.links, event), event)
+}
+
+func (forwarder *Forwarder) DispatchUserFollowStatusChangedEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.UserFollowStatusChanged,
+) error {
+	return forwarder.forward(userId, formatUserFollowStatusChanged(forwarder.links, event), event)
+}
+
+func (forwarder *Forwarder) DispatchStoryPublishedEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.StoryPublished,
+) error {
+	return forwarder.forward(userId, formatStoryPublished(forwarder.links, event), event)
+}
+
+func (forwarder *Forwarder) DispatchStoryVotedEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.StoryVoted,
+) error {
+	return forwarder.forward(userId, formatStoryVoted(forwarder.links, event), event)
+}
+
+func (forwarder *Forwarder) DispatchCommentPublishedEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.CommentPublished,
+) error {
+	return forwarder.forward(userId, formatCommentPublished(forwarder.links, event), event)
+}
+
+func (forwarder *Forwarder) DispatchCommentVotedEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.CommentVoted,
+) error {
+	return forwarder.forward(userId, formatCommentVoted(forwarder.links, event), event)
+}
+
+func (forwarder *Forwarder) DispatchAccountCreationTokenClaimedEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.AccountCreationTokenClaimed,
+) error {
+	return forwarder.forward(userId, formatAccountCreationTokenClaimed(forwarder.links, event), event)
+}
+
+func (forwarder *Forwarder) DispatchPayoutApproachingEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.PayoutApproaching,
+) error {
+	return forwarder.forward(userId, formatPayoutApproaching(forwarder.links, event), event)
+}
+
+func (forwarder *Forwarder) DispatchPostPaidOutEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.PostPaidOut,
+) error {
+	return forwarder.forward(userId, formatPostPaidOut(forwarder.links, event), event)
+}
+
+func (forwarder *Forwarder) DispatchWitnessPropertiesSetEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.WitnessPropertiesSet,
+) error {
+	return forwarder.forward(userId, formatWitnessPropertiesSet(forwarder.links, event), event)
+}
+
+func (forwarder *Forwarder) DispatchBlockProductionRewardReceivedEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.BlockProductionRewardReceived,
+) error {
+	return forwarder.forward(userId, formatBlockProductionRewardReceived(forwarder.links, event), event)
+}
+
+func (forwarder *Forwarder) DispatchCommunitySubscriptionChangedEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.CommunitySubscriptionChanged,
+) error {
+	return forwarder.forward(userId, formatCommunitySubscriptionChanged(forwarder.links, event), event)
+}
+
+func (forwarder *Forwarder) DispatchCommunityRoleChangedEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.CommunityRoleChanged,
+) error {
+	return forwarder.forward(userId, formatCommunityRoleChanged(forwarder.links, event), event)
+}
+
+func (forwarder *Forwarder) DispatchNewPayerDetectedEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.NewPayerDetected,
+) error {
+	return forwarder.forward(userId, formatNewPayerDetected(forwarder.links, event), event)
+}
+
+func (forwarder *Forwarder) DispatchCustomJSONBroadcastEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.CustomJSONBroadcast,
+) error {
+	return forwarder.forward(userId, formatCustomJSONBroadcast(forwarder.links, event), event)
+}
+
+func (forwarder *Forwarder) DispatchAccountCreatedEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.AccountCreated,
+) error {
+	return forwarder.forward(userId, formatAccountCreated(forwarder.links, event), event)
+}
+
+func (forwarder *Forwarder) DispatchAccountActivityEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.AccountActivity,
+) error {
+	return forwarder.forward(userId, formatAccountActivity(forwarder.links, event), event)
+}
+
+func (forwarder *Forwarder) DispatchRCDelegatedEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.RCDelegated,
+) error {
+	return forwarder.forward(userId, formatRCDelegated(forwarder.links, event), event)
+}
+
+func (forwarder *Forwarder) DispatchRCDelegationRemovedEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.RCDelegationRemoved,
+) error {
+	return forwarder.forward(userId, formatRCDelegationRemoved(forwarder.links, event), event)
+}
+
+func (forwarder *Forwarder) DispatchWitnessFeedStaleEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.WitnessFeedStale,
+) error {
+	return forwarder.forward(userId, formatWitnessFeedStale(forwarder.links, event), event)
+}
+
+func (forwarder *Forwarder) DispatchWitnessFeedRecoveredEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.WitnessFeedRecovered,
+) error {
+	return forwarder.forward(userId, formatWitnessFeedRecovered(forwarder.links, event), event)
+}
+
+func (forwarder *Forwarder) DispatchDigest(
+	userId string,
+	_ bson.Raw,
+	digest *events.Digest,
+) error {
+	return forwarder.forward(userId, formatDigest(forwarder.links, digest), nil)
+}
+
+func (forwarder *Forwarder) DispatchDailySummary(
+	userId string,
+	_ bson.Raw,
+	summary *events.DailySummary,
+) error {
+	return forwarder.forward(userId, formatDailySummary(forwarder.links, summary), nil)
+}
+
+// forward sends the formatted event along with the mined event it was formatted from,
+// so that the receiving instance can dispatch it to the user's notifiers. The source can be nil.
+func (forwarder *Forwarder) forward(userId string, event *Event, source interface{}) error {
+	payload, err := json.Marshal(event.Payload)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal event payload")
+	}
+
+	var sourceBody json.RawMessage
+	if source != nil {
+		sourceBody, err = json.Marshal(source)
+		if err != nil {
+			return errors.Wrap(err, "failed to marshal event")
+		}
+	}
+
+	// The event ID only needs to be the same for the same event sent to the same user.
+	sum := sha1.Sum(append([]byte(userId+":"+event.Kind+":"), payload...))
+
+	body, err := json.Marshal(&IngestRequest{
+		UserId:  userId,
+		EventId: hex.EncodeToString(sum[:]),
+		Event: &IngestEvent{
+			Kind:      event.Kind,
+			Seq:       forwarder.seq,
+			Display:   event.Display,
+			MatchedBy: forwarder.matchedBy,
+			Labels:    forwarder.labels,
+			Payload:   payload,
+			Source:    sourceBody,
+		},
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal ingest request")
+	}
+
+	// The event is posted to all the instances even when one of them fails. The failure
+	// is returned so that the event is retried, the instances that got the event already
+	// drop the repeated one using the event ID.
+	var failures []string
+	for _, url := range forwarder.urls {
+		if err := forwarder.post(url, body); err != nil {
+			failures = append(failures, fmt.Sprintf("%v: %v", url, err))
+		}
+	}
+	if len(failures) != 0 {
+		return errors.Errorf("failed to forward event to %v of %v instances: %v",
+			len(failures), len(forwarder.urls), strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+func (forwarder *Forwarder) post(url string, body []byte) error {
+	req := fasthttp.AcquireRequest()
+	res := fasthttp.AcquireResponse()
+	defer func() {
+		fasthttp.ReleaseRequest(req)
+		fasthttp.ReleaseResponse(res)
+	}()
+
+	req.Header.SetMethod("POST")
+	req.Header.SetContentType("application/json; charset=utf-8")
+	req.Header.Set(IngestSecretHeader, forwarder.secret)
+	req.SetRequestURI(url)
+	req.SetBodyStream(bytes.NewReader(body), len(body))
+
+	if err := fasthttp.DoTimeout(req, res, forwarder.timeout); err != nil {
+		return errors.Wrap(err, "failed to send ingest request")
+	}
+
+	if code := res.StatusCode(); code < 200 || code >= 300 {
+		return errors.Errorf("POST %v -> %v", url, code)
+	}
+	return nil
+}
+
+func (forwarder *Forwarder) Close() error {
+	return nil
+}
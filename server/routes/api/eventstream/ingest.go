@@ -0,0 +1,138 @@
+package eventstream
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/tchap/steemwatch/notifications/events"
+
+	"github.com/labstack/echo"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// IngestSecretHeader carries the secret shared between the forwarding and the receiving instance.
+const IngestSecretHeader = "X-Steemwatch-Ingest-Secret"
+
+// IngestRequest is what a forwarding instance POSTs to the ingest endpoint.
+// The event is exactly what is normally written to the event stream connections.
+type IngestRequest struct {
+	UserId  string       `json:"userId"`
+	EventId string       `json:"eventId"`
+	Event   *IngestEvent `json:"event"`
+}
+
+type IngestEvent struct {
+	Kind      string          `json:"kind"`
+	Seq       uint64          `json:"seq,omitempty"`
+	Display   *events.Display `json:"display,omitempty"`
+	MatchedBy string          `json:"matchedBy,omitempty"`
+	Labels    []string        `json:"labels,omitempty"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+	// Source is the mined event the payload was formatted from, if any.
+	Source json.RawMessage `json:"source,omitempty"`
+}
+
+// OnIngest registers the function the ingested events carrying the mined event are passed to,
+// see notifications.SetIngestSource. Without it, the events only go to the event stream.
+func (manager *Manager) OnIngest(listener func(userId, kind string, event []byte) error) {
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+	manager.ingestListener = listener
+}
+
+// BindIngest makes the manager accept events forwarded by another steemwatch instance.
+// Ingested events are dispatched to the target user as if mined locally, see OnIngest,
+// or written to the local event stream connections of the user when that is not possible.
+// Events that were already ingested recently, as identified by their event ID, are dropped.
+func (manager *Manager) BindIngest(group *echo.Group, secret string) {
+	seen := newRecentIds(DefaultIngestDedupSize)
+
+	group.POST("/", func(ctx echo.Context) error {
+		given := ctx.Request().Header.Get(IngestSecretHeader)
+		if subtle.ConstantTimeCompare([]byte(given), []byte(secret)) != 1 {
+			return echo.NewHTTPError(http.StatusUnauthorized)
+		}
+
+		var req IngestRequest
+		if err := json.NewDecoder(ctx.Request().Body).Decode(&req); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "failed to decode request body")
+		}
+		switch {
+		case !bson.IsObjectIdHex(req.UserId):
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid userId")
+		case req.EventId == "":
+			return echo.NewHTTPError(http.StatusBadRequest, "eventId not set")
+		case req.Event == nil || req.Event.Kind == "":
+			return echo.NewHTTPError(http.StatusBadRequest, "event not set")
+		}
+
+		if !seen.add(req.EventId) {
+			return ctx.NoContent(http.StatusOK)
+		}
+
+		manager.lock.RLock()
+		listener := manager.ingestListener
+		manager.lock.RUnlock()
+		if listener != nil && len(req.Event.Source) != 0 {
+			if err := listener(req.UserId, req.Event.Kind, req.Event.Source); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+			}
+			return ctx.NoContent(http.StatusAccepted)
+		}
+
+		event := &Event{
+			Kind:      req.Event.Kind,
+			Seq:       req.Event.Seq,
+			Display:   req.Event.Display,
+			MatchedBy: req.Event.MatchedBy,
+			Labels:    req.Event.Labels,
+		}
+		if len(req.Event.Payload) != 0 {
+			event.Payload = req.Event.Payload
+		}
+
+		if err := manager.sendEvent(req.UserId, event); err != nil {
+			return err
+		}
+		return ctx.NoContent(http.StatusAccepted)
+	})
+}
+
+// DefaultIngestDedupSize is the number of event IDs remembered for deduplication.
+const DefaultIngestDedupSize = 10000
+
+// recentIds remembers the last size IDs added.
+type recentIds struct {
+	ids  map[string]struct{}
+	ring []string
+	next int
+	lock *sync.Mutex
+}
+
+func newRecentIds(size int) *recentIds {
+	return &recentIds{
+		ids:  make(map[string]struct{}, size),
+		ring: make([]string, size),
+		lock: &sync.Mutex{},
+	}
+}
+
+// add returns false when the ID has been seen already.
+func (recent *recentIds) add(id string) bool {
+	recent.lock.Lock()
+	defer recent.lock.Unlock()
+
+	if _, ok := recent.ids[id]; ok {
+		return false
+	}
+
+	if old := recent.ring[recent.next]; old != "" {
+		delete(recent.ids, old)
+	}
+	recent.ring[recent.next] = id
+	recent.next = (recent.next + 1) % len(recent.ring)
+	recent.ids[id] = struct{}{}
+	return true
+}
@@ -1,14 +1,23 @@
 package eventstream
 
 import (
+	"encoding/json"
 	"log"
+	"net/http"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
+	"github.com/tchap/steemwatch/links"
+	"github.com/tchap/steemwatch/notifications"
 	"github.com/tchap/steemwatch/notifications/events"
 	"github.com/tchap/steemwatch/server/context"
+	"github.com/tchap/steemwatch/server/routes/api/profile"
 	"github.com/tchap/steemwatch/server/users"
 
+	"github.com/go-steem/rpc/types"
 	"github.com/gorilla/websocket"
 	"github.com/labstack/echo"
 	"github.com/pkg/errors"
@@ -18,34 +27,208 @@ import (
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
+	// Compression is negotiated with every client,
+	// but it is only used for the users that opted in.
+	EnableCompression: true,
 }
 
+// CloseCodeMaintenance is used to close the connections when entering maintenance mode.
+// The clients are expected to reconnect later.
+const CloseCodeMaintenance = websocket.CloseTryAgainLater
+
 type connectionRecord struct {
 	conn *websocket.Conn
 	lock *sync.Mutex
+
+	prefs *streamPreferences
+	stats ConnectionStats
+
+	// fingerprint identifies the client, see closeReplaced.
+	fingerprint string
+
+	// resuming is set while the missed events are being replayed, see resume.
+	resuming bool
+	queued   []interface{}
+}
+
+func newConnectionRecord(conn *websocket.Conn, prefs *streamPreferences, fingerprint string) *connectionRecord {
+	now := time.Now()
+	return &connectionRecord{
+		conn:        conn,
+		lock:        &sync.Mutex{},
+		prefs:       prefs,
+		fingerprint: fingerprint,
+		stats: ConnectionStats{
+			ConnectedAt:    now,
+			LastActivityAt: now,
+			Compressed:     prefs.compression,
+			Minimal:        prefs.minimal,
+			FieldNaming:    prefs.fieldNaming,
+			AmountFormat:   prefs.amountFormat,
+		},
+	}
+}
+
+func (record *connectionRecord) writeJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal message")
+	}
+	// The amounts are structured first since the field names are only known in camelCase.
+	data, err = structureAmounts(data, record.prefs.amountFormat)
+	if err != nil {
+		return errors.Wrap(err, "failed to structure message amounts")
+	}
+	data, err = renameFields(data, record.prefs.fieldNaming)
+	if err != nil {
+		return errors.Wrap(err, "failed to rename message fields")
+	}
+
+	record.lock.Lock()
+	defer record.lock.Unlock()
+
+	if err := record.conn.SetWriteDeadline(time.Now().Add(10 * time.Second)); err != nil {
+		return errors.Wrap(err, "failed to set write deadline")
+	}
+	if err := record.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		return err
+	}
+
+	record.stats.BytesWritten += uint64(len(data))
+	record.stats.MessagesWritten++
+	record.stats.LastActivityAt = time.Now()
+	return nil
+}
+
+// touch records that something was read from the connection.
+func (record *connectionRecord) touch() {
+	record.lock.Lock()
+	record.stats.LastActivityAt = time.Now()
+	record.lock.Unlock()
+}
+
+func (record *connectionRecord) getStats() ConnectionStats {
+	record.lock.Lock()
+	defer record.lock.Unlock()
+	return record.stats
 }
 
+// ReloadFunc is called when the client asks for the user's configuration to be reloaded.
+type ReloadFunc func(userId string) error
+
 type Manager struct {
+	// managerView without any stamp dispatches the events of the manager itself,
+	// the views returned by Sequenced, MatchedBy, Labeled and WithOperation stamp them.
+	*managerView
+
+	links       *links.Builder
 	connections map[string]*connectionRecord
+	reloaders   []ReloadFunc
+	tokens      *streamTokens
+	replay      *replayBuffer
 	closed      bool
 	lock        *sync.RWMutex
+
+	replaceGrace time.Duration
+	maxBackfill  uint
+
+	// ingestListener is set by OnIngest.
+	ingestListener func(userId, kind string, event []byte) error
 }
 
-func NewManager() *Manager {
-	return &Manager{
+func NewManager(lb *links.Builder) *Manager {
+	manager := &Manager{
+		links:       lb,
 		connections: make(map[string]*connectionRecord),
+		tokens:      newStreamTokens(),
+		replay:      newReplayBuffer(),
 		lock:        &sync.RWMutex{},
 	}
+	manager.managerView = &managerView{manager: manager}
+	return manager
 }
 
-func (manager *Manager) Bind(serverCtx *context.Context, group *echo.Group) {
-	group.GET("/ws/", func(ctx echo.Context) error {
+// eventStamp is what a view of the manager stamps the events with.
+type eventStamp struct {
+	seq       uint64
+	matchedBy string
+	labels    []string
+	op        types.Operation
+}
+
+// managerView sends the events through the shared manager, stamping them on the way.
+// It only holds the stamp, the rest of the state is read from the manager under its lock.
+type managerView struct {
+	manager *Manager
+	stamp   eventStamp
+}
+
+// BindWebSocket binds the WebSocket endpoint. The group is expected to check the upgrade
+// and to authenticate the user, see RequireUpgrade and RequireSessionOrToken.
+func (manager *Manager) BindWebSocket(serverCtx *context.Context, group *echo.Group) {
+	group.GET("/", func(ctx echo.Context) error {
 		user := ctx.Get("user").(*users.User)
 
-		conn, err := upgrader.Upgrade(ctx.Response().Writer, ctx.Request(), nil)
+		if status := serverCtx.Maintenance.Status(); status.Enabled {
+			return echo.NewHTTPError(http.StatusServiceUnavailable, status.Message)
+		}
+
+		// The client can ask for the events it missed since the given sequence number.
+		var (
+			since    uint64
+			resuming bool
+		)
+		if v := ctx.QueryParam(ResumeParam); v != "" {
+			seq, err := strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "invalid since")
+			}
+			since, resuming = seq, true
+		}
+
+		// Everything that can fail with an HTTP error must happen before the upgrade.
+		prefs, err := loadStreamPreferences(serverCtx, user.Id)
 		if err != nil {
 			return err
 		}
+		// The naming convention can be chosen per connection.
+		switch naming := ctx.QueryParam("fieldNaming"); naming {
+		case profile.FieldNamingCamelCase, profile.FieldNamingSnakeCase:
+			prefs.fieldNaming = naming
+		}
+		// So can the amount format.
+		switch format := ctx.QueryParam("amountFormat"); format {
+		case profile.AmountFormatString, profile.AmountFormatStructured, profile.AmountFormatBoth:
+			prefs.amountFormat = format
+		}
+		// The raw operations are for debugging, they are only sent on request.
+		if raw, err := strconv.ParseBool(ctx.QueryParam("rawOperation")); err == nil {
+			prefs.rawOperation = raw
+		}
+		// The connection can ask for the events of the labeled subscriptions only, e.g. ?labels=clients,personal.
+		if labels := ctx.QueryParam("labels"); labels != "" {
+			for _, label := range strings.Split(labels, ",") {
+				if label = strings.ToLower(strings.TrimSpace(label)); label != "" {
+					prefs.labels = append(prefs.labels, label)
+				}
+			}
+		}
+
+		// A middleware that wrote the response already would make the upgrade fail half-way.
+		if ctx.Response().Committed {
+			log.Printf("WebSocket upgrade for user %v skipped, the response was already written", user.Id)
+			return nil
+		}
+
+		// The upgrader writes the HTTP error itself, nothing can be written once it fails.
+		conn, err := upgrader.Upgrade(ctx.Response().Writer, ctx.Request(), nil)
+		if err != nil {
+			log.Printf("WebSocket upgrade for user %v failed: %v", user.Id, err)
+			return nil
+		}
+		conn.EnableWriteCompression(prefs.compression)
+
+		fingerprint := clientFingerprint(serverCtx, ctx)
 
 		go func(userID string, conn *websocket.Conn) {
 			defer conn.Close()
@@ -60,20 +243,61 @@ func (manager *Manager) Bind(serverCtx *context.Context, group *echo.Group) {
 			// This is perhaps not idea, but it at least prevents leaking connections.
 			record, ok := manager.connections[userID]
 			if ok {
-				record.conn.Close()
+				manager.closeReplaced(userID, record, fingerprint)
 			}
 
 			// Insert the new connection record into the map.
-			manager.connections[userID] = &connectionRecord{conn, &sync.Mutex{}}
+			record = newConnectionRecord(conn, prefs, fingerprint)
+			manager.connections[userID] = record
+
+			// Control frames count as activity as well.
+			ping := conn.PingHandler()
+			conn.SetPingHandler(func(data string) error {
+				record.touch()
+				return ping(data)
+			})
+			conn.SetPongHandler(func(string) error {
+				record.touch()
+				return nil
+			})
 			log.Println(
 				"WebSocket connection added. Number of connections:", len(manager.connections))
+
+			// The buffer is read while holding the lock so that every event
+			// is either replayed or sent live, never both.
+			var (
+				replay []*Event
+				gap    *GapPayload
+			)
+			if resuming {
+				replay, gap = manager.replay.since(userID, since)
+				record.resuming = true
+			}
 			manager.lock.Unlock()
 
+			if resuming {
+				record.resume(replay, gap)
+			}
+
+			// New users often do not realize they need to set up watches first.
+			if hint, err := onboardingHint(serverCtx, userID); err != nil {
+				log.Printf("failed to check onboarding for user %v: %+v", userID, err)
+			} else if hint != nil {
+				record.writeJSON(hint)
+			}
+
 			for {
-				_, _, err := conn.ReadMessage()
+				_, data, err := conn.ReadMessage()
+				if err == nil {
+					record.touch()
+					err = manager.handleControlMessage(serverCtx, userID, record, data)
+				}
 				if err != nil {
 					manager.lock.Lock()
-					delete(manager.connections, userID)
+					// The connection may have been replaced already.
+					if manager.connections[userID] == record {
+						delete(manager.connections, userID)
+					}
 					log.Println(
 						"WebSocket connection removed. Number of connections:",
 						len(manager.connections))
@@ -87,7 +311,48 @@ func (manager *Manager) Bind(serverCtx *context.Context, group *echo.Group) {
 	})
 }
 
-func (manager *Manager) sendEvent(userId string, event interface{}) error {
+func (manager *Manager) Bind(serverCtx *context.Context, group *echo.Group) {
+	// Bandwidth accounting for the current connection. It is reset on disconnect.
+	group.GET("/stats/", func(ctx echo.Context) error {
+		user := ctx.Get("user").(*users.User)
+
+		stats := &ConnectionStats{}
+		manager.lock.RLock()
+		if record, ok := manager.connections[user.Id]; ok {
+			*stats = record.getStats()
+			stats.Connected = true
+		}
+		manager.lock.RUnlock()
+
+		ctx.Response().Header().Set(echo.HeaderContentType, "application/json")
+		return json.NewEncoder(ctx.Response().Writer).Encode(stats)
+	})
+}
+
+// AddReloader registers a function to be called when a client
+// asks for the subscriptions of its user to be reloaded.
+func (manager *Manager) AddReloader(reload ReloadFunc) {
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+	manager.reloaders = append(manager.reloaders, reload)
+}
+
+func (manager *Manager) reload(userId string) error {
+	manager.lock.RLock()
+	reloaders := manager.reloaders
+	manager.lock.RUnlock()
+
+	for _, reload := range reloaders {
+		if err := reload(userId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (view *managerView) sendEvent(userId string, event interface{}) error {
+	manager := view.manager
+
 	manager.lock.RLock()
 	defer manager.lock.RUnlock()
 
@@ -95,18 +360,135 @@ func (manager *Manager) sendEvent(userId string, event interface{}) error {
 		return nil
 	}
 
+	ev, isEvent := event.(*Event)
+	if isEvent {
+		if view.stamp.seq != 0 {
+			ev.Seq = view.stamp.seq
+		}
+		if view.stamp.matchedBy != "" {
+			ev.MatchedBy = view.stamp.matchedBy
+		}
+		if len(view.stamp.labels) != 0 {
+			ev.Labels = view.stamp.labels
+		}
+		manager.replay.add(userId, ev)
+	}
+
 	record, ok := manager.connections[userId]
 	if !ok {
 		return nil
 	}
 
-	record.lock.Lock()
-	defer record.lock.Unlock()
+	if isEvent && !record.prefs.wants(ev) {
+		return nil
+	}
+	if isEvent && view.stamp.op != nil && record.prefs.rawOperation {
+		ev.Operation = newRawOperation(view.stamp.op)
+	}
+	if isEvent {
+		event = record.prefs.prepare(ev)
+	}
+	return record.send(event)
+}
 
-	if err := record.conn.SetWriteDeadline(time.Now().Add(10 * time.Second)); err != nil {
-		return errors.Wrap(err, "failed to set write deadline")
+// DispatchTitled sends the event with the title set.
+func (view *managerView) DispatchTitled(
+	userId string,
+	_ bson.Raw,
+	event interface{},
+	title string,
+) error {
+	ev := formatEvent(view.manager.links, event)
+	if ev == nil {
+		return errors.Errorf("unknown event type: %T", event)
+	}
+	ev.Title = title
+	return view.sendEvent(userId, ev)
+}
+
+// Sequenced returns a view of the manager that stamps the events with the given sequence number.
+// The view shares the connections with the manager.
+func (view *managerView) Sequenced(seq uint64) notifications.Notifier {
+	stamped := *view
+	stamped.stamp.seq = seq
+	return &stamped
+}
+
+// MatchedBy returns a view of the manager that stamps the events with the given reason.
+func (view *managerView) MatchedBy(reason string) interface{} {
+	stamped := *view
+	stamped.stamp.matchedBy = reason
+	return &stamped
+}
+
+// Labeled returns a view of the manager that stamps the events with the given labels.
+func (view *managerView) Labeled(labels []string) interface{} {
+	stamped := *view
+	stamped.stamp.labels = labels
+	return &stamped
+}
+
+// Close closes the shared manager.
+func (view *managerView) Close() error {
+	return view.manager.Close()
+}
+
+// Broadcast sends the global event to all the connected users.
+func (manager *Manager) Broadcast(event interface{}) error {
+	var formatted *Event
+	switch event := event.(type) {
+	case *events.HardforkActivated:
+		formatted = formatHardforkActivated(manager.links, event)
+	default:
+		return errors.Errorf("cannot broadcast event of type %T", event)
+	}
+
+	manager.lock.RLock()
+	defer manager.lock.RUnlock()
+
+	if manager.closed {
+		return nil
+	}
+	for userId, record := range manager.connections {
+		if err := record.writeJSON(formatted); err != nil {
+			log.Printf("failed to broadcast to user %v: %v", userId, err)
+		}
+	}
+	return nil
+}
+
+// maxCloseReasonLength is the control frame payload limit minus the close code.
+const maxCloseReasonLength = 123
+
+// closeReason cuts the reason to fit a close control frame. It is cut at a rune boundary
+// so that the reason remains valid UTF-8, which the clients check.
+func closeReason(reason string) string {
+	if len(reason) <= maxCloseReasonLength {
+		return reason
+	}
+	i := maxCloseReasonLength
+	for i > 0 && !utf8.RuneStart(reason[i]) {
+		i--
+	}
+	return reason[:i]
+}
+
+// CloseStreams closes all the connections gracefully, sending the given close code and reason.
+func (manager *Manager) CloseStreams(code int, reason string) {
+	msg := websocket.FormatCloseMessage(code, closeReason(reason))
+
+	manager.lock.RLock()
+	defer manager.lock.RUnlock()
+
+	for userId, record := range manager.connections {
+		record.lock.Lock()
+		err := record.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(5*time.Second))
+		record.lock.Unlock()
+		if err != nil {
+			log.Printf("failed to send close message to user %v: %v", userId, err)
+		}
+		record.conn.Close()
 	}
-	return record.conn.WriteJSON(event)
 }
 
 func (manager *Manager) Close() error {
@@ -122,74 +504,210 @@ func (manager *Manager) Close() error {
 	return nil
 }
 
-func (manager *Manager) DispatchAccountUpdatedEvent(
+func (view *managerView) DispatchAccountUpdatedEvent(
 	userId string,
 	_ bson.Raw,
 	event *events.AccountUpdated,
 ) error {
-	return manager.sendEvent(userId, formatAccountUpdated(event))
+	return view.sendEvent(userId, formatAccountUpdated(view.manager.links, event))
 }
 
-func (manager *Manager) DispatchAccountWitnessVotedEvent(
+func (view *managerView) DispatchAccountWitnessVotedEvent(
 	userId string,
 	_ bson.Raw,
 	event *events.AccountWitnessVoted,
 ) error {
-	return manager.sendEvent(userId, formatAccountWitnessVoted(event))
+	return view.sendEvent(userId, formatAccountWitnessVoted(view.manager.links, event))
 }
 
-func (manager *Manager) DispatchTransferMadeEvent(
+func (view *managerView) DispatchTransferMadeEvent(
 	userId string,
 	_ bson.Raw,
 	event *events.TransferMade,
 ) error {
-	return manager.sendEvent(userId, formatTransferMade(event))
+	return view.sendEvent(userId, formatTransferMade(view.manager.links, event))
 }
 
-func (manager *Manager) DispatchUserMentionedEvent(
+func (view *managerView) DispatchUserMentionedEvent(
 	userId string,
 	_ bson.Raw,
 	event *events.UserMentioned,
 ) error {
-	return manager.sendEvent(userId, formatUserMentioned(event))
+	return view.sendEvent(userId, formatUserMentioned(view.manager.links, event))
 }
 
-func (manager *Manager) DispatchUserFollowStatusChangedEvent(
+func (view *managerView) DispatchUserFollowStatusChangedEvent(
 	userId string,
 	_ bson.Raw,
 	event *events.UserFollowStatusChanged,
 ) error {
-	return manager.sendEvent(userId, formatUserFollowStatusChanged(event))
+	return view.sendEvent(userId, formatUserFollowStatusChanged(view.manager.links, event))
 }
 
-func (manager *Manager) DispatchStoryPublishedEvent(
+func (view *managerView) DispatchStoryPublishedEvent(
 	userId string,
 	_ bson.Raw,
 	event *events.StoryPublished,
 ) error {
-	return manager.sendEvent(userId, formatStoryPublished(event))
+	return view.sendEvent(userId, formatStoryPublished(view.manager.links, event))
 }
 
-func (manager *Manager) DispatchStoryVotedEvent(
+func (view *managerView) DispatchStoryVotedEvent(
 	userId string,
 	_ bson.Raw,
 	event *events.StoryVoted,
 ) error {
-	return manager.sendEvent(userId, formatStoryVoted(event))
+	return view.sendEvent(userId, formatStoryVoted(view.manager.links, event))
 }
 
-func (manager *Manager) DispatchCommentPublishedEvent(
+func (view *managerView) DispatchCommentPublishedEvent(
 	userId string,
 	_ bson.Raw,
 	event *events.CommentPublished,
 ) error {
-	return manager.sendEvent(userId, formatCommentPublished(event))
+	return view.sendEvent(userId, formatCommentPublished(view.manager.links, event))
 }
 
-func (manager *Manager) DispatchCommentVotedEvent(
+func (view *managerView) DispatchCommentVotedEvent(
 	userId string,
 	_ bson.Raw,
 	event *events.CommentVoted,
 ) error {
-	return manager.sendEvent(userId, formatCommentVoted(event))
+	return view.sendEvent(userId, formatCommentVoted(view.manager.links, event))
+}
+
+func (view *managerView) DispatchAccountCreationTokenClaimedEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.AccountCreationTokenClaimed,
+) error {
+	return view.sendEvent(userId, formatAccountCreationTokenClaimed(view.manager.links, event))
+}
+
+func (view *managerView) DispatchPayoutApproachingEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.PayoutApproaching,
+) error {
+	return view.sendEvent(userId, formatPayoutApproaching(view.manager.links, event))
+}
+
+func (view *managerView) DispatchPostPaidOutEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.PostPaidOut,
+) error {
+	return view.sendEvent(userId, formatPostPaidOut(view.manager.links, event))
+}
+
+func (view *managerView) DispatchWitnessPropertiesSetEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.WitnessPropertiesSet,
+) error {
+	return view.sendEvent(userId, formatWitnessPropertiesSet(view.manager.links, event))
+}
+
+func (view *managerView) DispatchBlockProductionRewardReceivedEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.BlockProductionRewardReceived,
+) error {
+	return view.sendEvent(userId, formatBlockProductionRewardReceived(view.manager.links, event))
+}
+
+func (view *managerView) DispatchCommunitySubscriptionChangedEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.CommunitySubscriptionChanged,
+) error {
+	return view.sendEvent(userId, formatCommunitySubscriptionChanged(view.manager.links, event))
+}
+
+func (view *managerView) DispatchCommunityRoleChangedEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.CommunityRoleChanged,
+) error {
+	return view.sendEvent(userId, formatCommunityRoleChanged(view.manager.links, event))
+}
+
+func (view *managerView) DispatchNewPayerDetectedEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.NewPayerDetected,
+) error {
+	return view.sendEvent(userId, formatNewPayerDetected(view.manager.links, event))
+}
+
+func (view *managerView) DispatchCustomJSONBroadcastEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.CustomJSONBroadcast,
+) error {
+	return view.sendEvent(userId, formatCustomJSONBroadcast(view.manager.links, event))
+}
+
+func (view *managerView) DispatchAccountCreatedEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.AccountCreated,
+) error {
+	return view.sendEvent(userId, formatAccountCreated(view.manager.links, event))
+}
+
+func (view *managerView) DispatchAccountActivityEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.AccountActivity,
+) error {
+	return view.sendEvent(userId, formatAccountActivity(view.manager.links, event))
+}
+
+func (view *managerView) DispatchRCDelegatedEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.RCDelegated,
+) error {
+	return view.sendEvent(userId, formatRCDelegated(view.manager.links, event))
+}
+
+func (view *managerView) DispatchRCDelegationRemovedEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.RCDelegationRemoved,
+) error {
+	return view.sendEvent(userId, formatRCDelegationRemoved(view.manager.links, event))
+}
+
+func (view *managerView) DispatchWitnessFeedStaleEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.WitnessFeedStale,
+) error {
+	return view.sendEvent(userId, formatWitnessFeedStale(view.manager.links, event))
+}
+
+func (view *managerView) DispatchWitnessFeedRecoveredEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.WitnessFeedRecovered,
+) error {
+	return view.sendEvent(userId, formatWitnessFeedRecovered(view.manager.links, event))
+}
+
+func (view *managerView) DispatchDigest(
+	userId string,
+	_ bson.Raw,
+	digest *events.Digest,
+) error {
+	return view.sendEvent(userId, formatDigest(view.manager.links, digest))
+}
+
+func (view *managerView) DispatchDailySummary(
+	userId string,
+	_ bson.Raw,
+	summary *events.DailySummary,
+) error {
+	return view.sendEvent(userId, formatDailySummary(view.manager.links, summary))
 }
@@ -0,0 +1,38 @@
+package eventstream
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestCloseReason(t *testing.T) {
+	testCases := []struct {
+		name   string
+		reason string
+		want   string
+	}{
+		{"short", "maintenance", "maintenance"},
+		{"short multibyte", "údržba 🔧", "údržba 🔧"},
+		{"exact", strings.Repeat("a", 123), strings.Repeat("a", 123)},
+		{"ascii", strings.Repeat("a", 200), strings.Repeat("a", 123)},
+		// 61 two-byte runes are 122 bytes, the 62nd would end at 124.
+		{"two-byte runes", strings.Repeat("č", 100), strings.Repeat("č", 61)},
+		// 30 four-byte runes are 120 bytes, the 31st would end at 124.
+		{"four-byte runes", strings.Repeat("👍", 40), strings.Repeat("👍", 30)},
+		{"rune across the limit", strings.Repeat("a", 122) + "ありがとう", strings.Repeat("a", 122)},
+	}
+
+	for _, tc := range testCases {
+		got := closeReason(tc.reason)
+		if got != tc.want {
+			t.Errorf("%v: got %q, want %q", tc.name, got, tc.want)
+		}
+		if len(got) > maxCloseReasonLength {
+			t.Errorf("%v: got %v bytes, want at most %v", tc.name, len(got), maxCloseReasonLength)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("%v: got invalid UTF-8 %q", tc.name, got)
+		}
+	}
+}
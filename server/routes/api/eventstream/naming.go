@@ -0,0 +1,66 @@
+package eventstream
+
+import (
+	"bytes"
+	"encoding/json"
+	"unicode"
+
+	"github.com/tchap/steemwatch/server/routes/api/profile"
+)
+
+// renameFields rewrites the object keys in the encoded message according to the naming convention.
+// The formatters always produce camelCase, so the message is returned as it is by default.
+func renameFields(data []byte, naming string) ([]byte, error) {
+	if naming != profile.FieldNamingSnakeCase {
+		return data, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(renameKeys(v, snakeCase))
+}
+
+func renameKeys(v interface{}, rename func(string) string) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		renamed := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			renamed[rename(key)] = renameKeys(value, rename)
+		}
+		return renamed
+	case []interface{}:
+		for i, value := range v {
+			v[i] = renameKeys(value, rename)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// snakeCase turns a camelCase name into snake_case, keeping acronyms together,
+// e.g. parentPermlink -> parent_permlink, eventID -> event_id.
+func snakeCase(name string) string {
+	runes := []rune(name)
+
+	var buf bytes.Buffer
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				prev := runes[i-1]
+				nextIsLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+				if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextIsLower) {
+					buf.WriteByte('_')
+				}
+			}
+			r = unicode.ToLower(r)
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
@@ -0,0 +1,107 @@
+package eventstream
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/tchap/steemwatch/server/context"
+
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const ControlMessageDismissOnboarding = "dismiss_onboarding"
+
+type OnboardingHintPayload struct {
+	Message string `json:"message"`
+	Link    string `json:"link"`
+}
+
+// eventDocFields are the fields of the events documents that are not watch lists.
+var eventDocFields = map[string]bool{
+	"_id":      true,
+	"ownerId":  true,
+	"kind":     true,
+	"settings": true,
+	"paused":   true,
+}
+
+// onboardingHint returns the hint to be sent to the user that has just connected,
+// nil when the user is watching something already or the hint was sent before.
+// The hint is marked as sent right away so that it is never repeated.
+func onboardingHint(serverCtx *context.Context, userId string) (*Event, error) {
+	var user struct {
+		Onboarding *struct {
+			SentAt *time.Time `bson:"sentAt"`
+		} `bson:"onboarding"`
+	}
+	err := serverCtx.DB.C("users").FindId(bson.ObjectIdHex(userId)).Select(bson.M{"onboarding": 1}).One(&user)
+	if err != nil && err != mgo.ErrNotFound {
+		return nil, errors.Wrapf(err, "failed to get onboarding state for user %v", userId)
+	}
+	if user.Onboarding != nil && user.Onboarding.SentAt != nil {
+		return nil, nil
+	}
+
+	watching, err := hasSubscriptions(serverCtx.DB, userId)
+	if err != nil || watching {
+		return nil, err
+	}
+
+	if err := markOnboarding(serverCtx.DB, userId, "sentAt"); err != nil {
+		return nil, err
+	}
+	return &Event{
+		Kind: "onboarding.hint",
+		Payload: &OnboardingHintPayload{
+			Message: "You are not watching anything yet. Set up the events you are interested in to start receiving them.",
+			Link:    serverCtx.CanonicalURL.ResolveReference(&url.URL{Path: "/events/"}).String(),
+		},
+	}, nil
+}
+
+// hasSubscriptions returns true when any of the user's watch lists is not empty.
+func hasSubscriptions(db *mgo.Database, userId string) (bool, error) {
+	var doc bson.M
+	iter := db.C("events").Find(bson.M{"ownerId": bson.ObjectIdHex(userId)}).Iter()
+	for iter.Next(&doc) {
+		for field, value := range doc {
+			if eventDocFields[field] {
+				continue
+			}
+			if list, ok := value.([]interface{}); ok && len(list) != 0 {
+				iter.Close()
+				return true, nil
+			}
+		}
+		doc = nil
+	}
+	return false, errors.Wrapf(iter.Err(), "failed to get event documents for user %v", userId)
+}
+
+// markOnboarding sets onboarding.<field> for the user unless it is set already.
+func markOnboarding(db *mgo.Database, userId, field string) error {
+	selector := bson.M{
+		"_id":                 bson.ObjectIdHex(userId),
+		"onboarding." + field: bson.M{"$exists": false},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"onboarding." + field: time.Now(),
+		},
+	}
+	err := db.C("users").Update(selector, update)
+	if err != nil && err != mgo.ErrNotFound {
+		return errors.Wrapf(err, "failed to update onboarding state for user %v", userId)
+	}
+	return nil
+}
+
+// dismissOnboarding makes sure the hint is not sent to the user any more.
+func dismissOnboarding(db *mgo.Database, userId string) error {
+	if err := markOnboarding(db, userId, "sentAt"); err != nil {
+		return err
+	}
+	return markOnboarding(db, userId, "dismissedAt")
+}
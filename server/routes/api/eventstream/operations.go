@@ -0,0 +1,35 @@
+package eventstream
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/go-steem/rpc/types"
+)
+
+// RawOperation is the operation the event was mined from, as it appears on the chain.
+// It is only sent to the connections asking for it using ?rawOperation=true.
+type RawOperation struct {
+	Type string          `json:"type"`
+	Body json.RawMessage `json:"body"`
+}
+
+// WithOperation returns a view of the manager that attaches the operation to the events
+// sent to the connections asking for it.
+func (view *managerView) WithOperation(op types.Operation) interface{} {
+	stamped := *view
+	stamped.stamp.op = op
+	return &stamped
+}
+
+func newRawOperation(op types.Operation) *RawOperation {
+	body, err := json.Marshal(op.Data())
+	if err != nil {
+		log.Printf("failed to marshal %v operation: %v", op.Type(), err)
+		return nil
+	}
+	return &RawOperation{
+		Type: string(op.Type()),
+		Body: body,
+	}
+}
@@ -0,0 +1,342 @@
+package eventstream
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/tchap/steemwatch/links"
+	"github.com/tchap/steemwatch/notifications"
+	"github.com/tchap/steemwatch/notifications/events"
+
+	"github.com/nats-io/go-nats"
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// PublisherSubjectPrefix is the prefix of the subjects the events are published to.
+// The complete subject is <prefix>.<userId>.<event kind>.
+const PublisherSubjectPrefix = "steemwatch.events"
+
+// DefaultPublisherBufferSize is the number of bytes buffered while disconnected from NATS.
+const DefaultPublisherBufferSize = 8 * 1024 * 1024
+
+type PublisherConfig struct {
+	URL      string
+	User     string
+	Password string
+	Token    string
+
+	// BufferSize limits the events buffered while reconnecting. Once the buffer is full,
+	// the events are dropped until the connection is restored.
+	BufferSize int
+}
+
+// Publisher publishes the formatted events to NATS for programmatic consumers.
+// It is meant to be registered as an additional notifier so that it receives every event.
+type Publisher struct {
+	links *links.Builder
+	conn  *nats.Conn
+
+	// seq is only set on the views returned by Sequenced.
+	seq uint64
+	// matchedBy is only set on the views returned by MatchedBy.
+	matchedBy string
+	// labels are only set on the views returned by Labeled.
+	labels []string
+}
+
+func NewPublisher(lb *links.Builder, config *PublisherConfig) (*Publisher, error) {
+	bufferSize := config.BufferSize
+	if bufferSize == 0 {
+		bufferSize = DefaultPublisherBufferSize
+	}
+
+	opts := []nats.Option{
+		nats.Name("steemwatch"),
+		nats.MaxReconnects(-1),
+		nats.ReconnectWait(2 * time.Second),
+		nats.ReconnectBufSize(bufferSize),
+		nats.DisconnectHandler(func(conn *nats.Conn) {
+			log.Println("NATS publisher disconnected, buffering events ...")
+		}),
+		nats.ReconnectHandler(func(conn *nats.Conn) {
+			log.Printf("NATS publisher reconnected to %v", conn.ConnectedUrl())
+		}),
+	}
+	switch {
+	case config.Token != "":
+		opts = append(opts, nats.Token(config.Token))
+	case config.User != "":
+		opts = append(opts, nats.UserInfo(config.User, config.Password))
+	}
+
+	conn, err := nats.Connect(config.URL, opts...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to connect to NATS at %v", config.URL)
+	}
+
+	return &Publisher{
+		links: lb,
+		conn:  conn,
+	}, nil
+}
+
+// Sequenced returns a publisher that stamps the events with the given sequence number.
+func (publisher *Publisher) Sequenced(seq uint64) notifications.Notifier {
+	view := *publisher
+	view.seq = seq
+	return &view
+}
+
+// MatchedBy returns a view of the publisher that stamps the events with the given reason.
+func (publisher *Publisher) MatchedBy(reason string) interface{} {
+	view := *publisher
+	view.matchedBy = reason
+	return &view
+}
+
+// Labeled returns a view of the publisher that stamps the events with the given labels.
+func (publisher *Publisher) Labeled(labels []string) interface{} {
+	view := *publisher
+	view.labels = labels
+	return &view
+}
+
+func (publisher *Publisher) DispatchAccountUpdatedEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.AccountUpdated,
+) error {
+	return publisher.publish(userId, formatAccountUpdated(publisher.links, event))
+}
+
+func (publisher *Publisher) DispatchAccountWitnessVotedEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.AccountWitnessVoted,
+) error {
+	return publisher.publish(userId, formatAccountWitnessVoted(publisher.links, event))
+}
+
+func (publisher *Publisher) DispatchTransferMadeEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.TransferMade,
+) error {
+	return publisher.publish(userId, formatTransferMade(publisher.links, event))
+}
+
+func (publisher *Publisher) DispatchUserMentionedEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.UserMentioned,
+) error {
+	return publisher.publish(userId, formatUserMentioned(publisher.links, event))
+}
+
+func (publisher *Publisher) DispatchUserFollowStatusChangedEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.UserFollowStatusChanged,
+) error {
+	return publisher.publish(userId, formatUserFollowStatusChanged(publisher.links, event))
+}
+
+func (publisher *Publisher) DispatchStoryPublishedEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.StoryPublished,
+) error {
+	return publisher.publish(userId, formatStoryPublished(publisher.links, event))
+}
+
+func (publisher *Publisher) DispatchStoryVotedEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.StoryVoted,
+) error {
+	return publisher.publish(userId, formatStoryVoted(publisher.links, event))
+}
+
+func (publisher *Publisher) DispatchCommentPublishedEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.CommentPublished,
+) error {
+	return publisher.publish(userId, formatCommentPublished(publisher.links, event))
+}
+
+func (publisher *Publisher) DispatchCommentVotedEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.CommentVoted,
+) error {
+	return publisher.publish(userId, formatCommentVoted(publisher.links, event))
+}
+
+func (publisher *Publisher) DispatchAccountCreationTokenClaimedEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.AccountCreationTokenClaimed,
+) error {
+	return publisher.publish(userId, formatAccountCreationTokenClaimed(publisher.links, event))
+}
+
+func (publisher *Publisher) DispatchPayoutApproachingEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.PayoutApproaching,
+) error {
+	return publisher.publish(userId, formatPayoutApproaching(publisher.links, event))
+}
+
+func (publisher *Publisher) DispatchPostPaidOutEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.PostPaidOut,
+) error {
+	return publisher.publish(userId, formatPostPaidOut(publisher.links, event))
+}
+
+func (publisher *Publisher) DispatchWitnessPropertiesSetEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.WitnessPropertiesSet,
+) error {
+	return publisher.publish(userId, formatWitnessPropertiesSet(publisher.links, event))
+}
+
+func (publisher *Publisher) DispatchBlockProductionRewardReceivedEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.BlockProductionRewardReceived,
+) error {
+	return publisher.publish(userId, formatBlockProductionRewardReceived(publisher.links, event))
+}
+
+func (publisher *Publisher) DispatchCommunitySubscriptionChangedEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.CommunitySubscriptionChanged,
+) error {
+	return publisher.publish(userId, formatCommunitySubscriptionChanged(publisher.links, event))
+}
+
+func (publisher *Publisher) DispatchCommunityRoleChangedEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.CommunityRoleChanged,
+) error {
+	return publisher.publish(userId, formatCommunityRoleChanged(publisher.links, event))
+}
+
+func (publisher *Publisher) DispatchNewPayerDetectedEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.NewPayerDetected,
+) error {
+	return publisher.publish(userId, formatNewPayerDetected(publisher.links, event))
+}
+
+func (publisher *Publisher) DispatchCustomJSONBroadcastEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.CustomJSONBroadcast,
+) error {
+	return publisher.publish(userId, formatCustomJSONBroadcast(publisher.links, event))
+}
+
+func (publisher *Publisher) DispatchAccountCreatedEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.AccountCreated,
+) error {
+	return publisher.publish(userId, formatAccountCreated(publisher.links, event))
+}
+
+func (publisher *Publisher) DispatchDigest(
+	userId string,
+	_ bson.Raw,
+	digest *events.Digest,
+) error {
+	return publisher.publish(userId, formatDigest(publisher.links, digest))
+}
+
+func (publisher *Publisher) DispatchDailySummary(
+	userId string,
+	_ bson.Raw,
+	summary *events.DailySummary,
+) error {
+	return publisher.publish(userId, formatDailySummary(publisher.links, summary))
+}
+
+func (publisher *Publisher) DispatchAccountActivityEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.AccountActivity,
+) error {
+	return publisher.publish(userId, formatAccountActivity(publisher.links, event))
+}
+
+func (publisher *Publisher) DispatchRCDelegatedEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.RCDelegated,
+) error {
+	return publisher.publish(userId, formatRCDelegated(publisher.links, event))
+}
+
+func (publisher *Publisher) DispatchRCDelegationRemovedEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.RCDelegationRemoved,
+) error {
+	return publisher.publish(userId, formatRCDelegationRemoved(publisher.links, event))
+}
+
+func (publisher *Publisher) DispatchWitnessFeedStaleEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.WitnessFeedStale,
+) error {
+	return publisher.publish(userId, formatWitnessFeedStale(publisher.links, event))
+}
+
+func (publisher *Publisher) DispatchWitnessFeedRecoveredEvent(
+	userId string,
+	_ bson.Raw,
+	event *events.WitnessFeedRecovered,
+) error {
+	return publisher.publish(userId, formatWitnessFeedRecovered(publisher.links, event))
+}
+
+func (publisher *Publisher) publish(userId string, event *Event) error {
+	if publisher.seq != 0 {
+		event.Seq = publisher.seq
+	}
+	if publisher.matchedBy != "" {
+		event.MatchedBy = publisher.matchedBy
+	}
+	if len(publisher.labels) != 0 {
+		event.Labels = publisher.labels
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal event")
+	}
+
+	// While reconnecting, the message is buffered by the client.
+	// It only fails when the buffer is full, the event is lost then.
+	subject := PublisherSubjectPrefix + "." + userId + "." + event.Kind
+	return errors.Wrapf(publisher.conn.Publish(subject, body), "failed to publish to %v", subject)
+}
+
+func (publisher *Publisher) Close() error {
+	if err := publisher.conn.Flush(); err != nil {
+		log.Printf("failed to flush NATS publisher: %v", err)
+	}
+	publisher.conn.Close()
+	return nil
+}
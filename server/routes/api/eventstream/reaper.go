@@ -0,0 +1,53 @@
+package eventstream
+
+import (
+	"log"
+	"time"
+)
+
+// MinReapInterval limits how often the connections are scanned for a short maximum idle time.
+const MinReapInterval = time.Second
+
+// StartReaper closes the connections that have not successfully read or written anything
+// for longer than maxIdle. This catches the half-open connections that TCP keepalive
+// and the WebSocket pings do not notice. The reaper stops once the manager is closed.
+func (manager *Manager) StartReaper(maxIdle time.Duration) {
+	interval := maxIdle / 2
+	if interval < MinReapInterval {
+		interval = MinReapInterval
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if !manager.reap(maxIdle) {
+				return
+			}
+		}
+	}()
+}
+
+// reap closes the idle connections. The read loop of a closed connection fails
+// and removes the record as usual. False is returned once the manager is closed.
+func (manager *Manager) reap(maxIdle time.Duration) bool {
+	manager.lock.RLock()
+	defer manager.lock.RUnlock()
+
+	if manager.closed {
+		return false
+	}
+
+	now := time.Now()
+	for userId, record := range manager.connections {
+		lastActivity := record.getStats().LastActivityAt
+		if now.Sub(lastActivity) <= maxIdle {
+			continue
+		}
+		log.Printf("closing stale WebSocket connection for user %v, last activity at %v",
+			userId, lastActivity.Format(time.RFC3339))
+		record.conn.Close()
+	}
+	return true
+}
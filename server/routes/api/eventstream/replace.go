@@ -0,0 +1,49 @@
+package eventstream
+
+import (
+	"log"
+	"time"
+
+	"github.com/tchap/steemwatch/server/context"
+
+	"github.com/labstack/echo"
+)
+
+// SetReplaceGrace sets for how long a connection replaced by a quick reconnect
+// of the same client is kept open, 0 closes it right away.
+//
+// After a network blip the old connection is often still half-open when the client
+// reconnects. The new connection takes over the events at once, so nothing is delivered
+// twice, but the old one is only closed after the grace so that anything already
+// in flight on it still has a chance to arrive.
+func (manager *Manager) SetReplaceGrace(grace time.Duration) {
+	manager.lock.Lock()
+	manager.replaceGrace = grace
+	manager.lock.Unlock()
+}
+
+// clientFingerprint identifies the client connecting. The clients can send a stable
+// ?clientId=, otherwise the address and the user agent are used.
+// The address is only taken from the forwarding headers set by the trusted proxies.
+func clientFingerprint(serverCtx *context.Context, ctx echo.Context) string {
+	if id := ctx.QueryParam("clientId"); id != "" {
+		return "id:" + id
+	}
+	return serverCtx.ClientIP(ctx.Request()) + " " + ctx.Request().UserAgent()
+}
+
+// closeReplaced closes the connection replaced by a new one for the same user.
+// The connections from other clients are closed right away since only a single
+// connection per user is kept. It must be called with the lock held.
+func (manager *Manager) closeReplaced(userId string, old *connectionRecord, fingerprint string) {
+	if manager.replaceGrace == 0 || old.fingerprint != fingerprint {
+		old.conn.Close()
+		return
+	}
+
+	log.Printf("WebSocket connection for user %v replaced by a reconnect, closing it in %v",
+		userId, manager.replaceGrace)
+	time.AfterFunc(manager.replaceGrace, func() {
+		old.conn.Close()
+	})
+}
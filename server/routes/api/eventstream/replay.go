@@ -0,0 +1,149 @@
+package eventstream
+
+import (
+	"sync"
+)
+
+// ReplayBufferSize is the number of the last sequenced events kept for every user
+// so that a client reconnecting with ?since=<seq> gets the events it missed.
+const ReplayBufferSize = 100
+
+// ResumeParam is the query parameter carrying the last sequence number seen by the client.
+const ResumeParam = "since"
+
+type GapPayload struct {
+	// Since is the sequence number requested by the client.
+	Since uint64 `json:"since"`
+	// Oldest is the oldest sequence number still available, 0 when there is none.
+	// The events in between are to be fetched from the history endpoint.
+	Oldest uint64 `json:"oldest"`
+}
+
+type CaughtUpPayload struct {
+	// Seq is the sequence number of the last event replayed, 0 when none was replayed.
+	Seq uint64 `json:"seq"`
+}
+
+// replayBuffer keeps the last sequenced events of every user, connected or not.
+// Only the events with a sequence number are kept, i.e. the events
+// of the users with ordered delivery, since there is nothing to resume from otherwise.
+type replayBuffer struct {
+	events map[string][]*Event
+	lock   *sync.Mutex
+}
+
+func newReplayBuffer() *replayBuffer {
+	return &replayBuffer{
+		events: make(map[string][]*Event),
+		lock:   &sync.Mutex{},
+	}
+}
+
+func (buffer *replayBuffer) add(userId string, event *Event) {
+	if event.Seq == 0 {
+		return
+	}
+
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+
+	queue := append(buffer.events[userId], event)
+	if len(queue) > ReplayBufferSize {
+		queue = queue[len(queue)-ReplayBufferSize:]
+	}
+	buffer.events[userId] = queue
+}
+
+// since returns the buffered events after the given sequence number. The gap is returned
+// when the events right after since are no longer available, so it can't be said that nothing was missed.
+func (buffer *replayBuffer) since(userId string, seq uint64) ([]*Event, *GapPayload) {
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+
+	queue := buffer.events[userId]
+	if len(queue) == 0 {
+		return nil, &GapPayload{Since: seq}
+	}
+
+	var gap *GapPayload
+	if oldest := queue[0].Seq; oldest > seq+1 {
+		gap = &GapPayload{Since: seq, Oldest: oldest}
+	}
+
+	var replay []*Event
+	for _, event := range queue {
+		if event.Seq > seq {
+			replay = append(replay, event)
+		}
+	}
+	return replay, gap
+}
+
+// resume writes the events missed by the client, preceded by the gap when there is one and
+// followed by the caught up marker. The live events sent in the meantime are queued
+// and written afterwards so that the client gets all the events in order.
+func (record *connectionRecord) resume(replay []*Event, gap *GapPayload) {
+	err := func() error {
+		if gap != nil {
+			if err := record.writeJSON(&Event{Kind: "stream.gap", Payload: gap}); err != nil {
+				return err
+			}
+		}
+
+		var last uint64
+		for _, event := range replay {
+			if !record.prefs.wants(event) {
+				continue
+			}
+			if err := record.writeJSON(record.prefs.prepare(event)); err != nil {
+				return err
+			}
+			last = event.Seq
+		}
+
+		if err := record.writeJSON(&Event{
+			Kind:    "stream.caught_up",
+			Payload: &CaughtUpPayload{Seq: last},
+		}); err != nil {
+			return err
+		}
+
+		for {
+			record.lock.Lock()
+			queued := record.queued
+			record.queued = nil
+			if len(queued) == 0 {
+				record.resuming = false
+				record.lock.Unlock()
+				return nil
+			}
+			record.lock.Unlock()
+
+			for _, v := range queued {
+				if err := record.writeJSON(v); err != nil {
+					return err
+				}
+			}
+		}
+	}()
+	if err != nil {
+		// The connection is broken, stop queueing and let the reader notice.
+		record.lock.Lock()
+		record.resuming = false
+		record.queued = nil
+		record.lock.Unlock()
+		record.conn.Close()
+	}
+}
+
+// send writes the message unless the record is resuming, in which case it is queued.
+func (record *connectionRecord) send(v interface{}) error {
+	record.lock.Lock()
+	if record.resuming {
+		record.queued = append(record.queued, v)
+		record.lock.Unlock()
+		return nil
+	}
+	record.lock.Unlock()
+	return record.writeJSON(v)
+}
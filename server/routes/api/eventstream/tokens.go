@@ -0,0 +1,129 @@
+package eventstream
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/tchap/steemwatch/server/auth"
+	"github.com/tchap/steemwatch/server/context"
+	"github.com/tchap/steemwatch/server/users"
+
+	"github.com/labstack/echo"
+	"github.com/pkg/errors"
+)
+
+// StreamTokenParam is the query parameter carrying the stream token on the WebSocket upgrade.
+const StreamTokenParam = "token"
+
+type StreamToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// streamTokens are single-use tokens authenticating the WebSocket upgrade
+// for the clients that cannot send the session cookie.
+type streamTokens struct {
+	tokens map[string]*streamTokenRecord
+	lock   sync.Mutex
+}
+
+type streamTokenRecord struct {
+	user      *users.User
+	expiresAt time.Time
+}
+
+func newStreamTokens() *streamTokens {
+	return &streamTokens{
+		tokens: make(map[string]*streamTokenRecord),
+	}
+}
+
+func (tokens *streamTokens) mint(user *users.User, ttl time.Duration) (*StreamToken, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, errors.Wrap(err, "failed to generate stream token")
+	}
+	token := &StreamToken{
+		Token:     hex.EncodeToString(raw),
+		ExpiresAt: time.Now().Add(ttl),
+	}
+
+	tokens.lock.Lock()
+	defer tokens.lock.Unlock()
+
+	// Drop the expired tokens so that the unused ones do not pile up.
+	now := time.Now()
+	for k, record := range tokens.tokens {
+		if now.After(record.expiresAt) {
+			delete(tokens.tokens, k)
+		}
+	}
+
+	tokens.tokens[token.Token] = &streamTokenRecord{
+		user:      user,
+		expiresAt: token.ExpiresAt,
+	}
+	return token, nil
+}
+
+// redeem returns the user the token was minted for, nil when the token is not valid.
+// The token cannot be used again.
+func (tokens *streamTokens) redeem(token string) *users.User {
+	tokens.lock.Lock()
+	defer tokens.lock.Unlock()
+
+	record, ok := tokens.tokens[token]
+	if !ok {
+		return nil
+	}
+	delete(tokens.tokens, token)
+
+	if time.Now().After(record.expiresAt) {
+		return nil
+	}
+	return record.user
+}
+
+// BindStreamTokens enables minting the stream tokens valid for the given time.
+// POST to the group to get a token for the current session.
+func (manager *Manager) BindStreamTokens(group *echo.Group, ttl time.Duration) {
+	group.POST("/", func(ctx echo.Context) error {
+		user := ctx.Get("user").(*users.User)
+
+		token, err := manager.tokens.mint(user, ttl)
+		if err != nil {
+			return err
+		}
+
+		ctx.Response().Header().Set(echo.HeaderContentType, "application/json")
+		return json.NewEncoder(ctx.Response().Writer).Encode(token)
+	})
+}
+
+// RequireSessionOrToken authenticates the request using the stream token when present,
+// falling back to the session cookie otherwise, the same way auth.Required does.
+func (manager *Manager) RequireSessionOrToken(serverCtx *context.Context) echo.MiddlewareFunc {
+	required := auth.Required(serverCtx)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		withSession := required(next)
+
+		return func(ctx echo.Context) error {
+			token := ctx.QueryParam(StreamTokenParam)
+			if token == "" {
+				return withSession(ctx)
+			}
+
+			user := manager.tokens.redeem(token)
+			if user == nil {
+				return echo.NewHTTPError(http.StatusForbidden, "invalid or expired stream token")
+			}
+			ctx.Set("user", user)
+			return next(ctx)
+		}
+	}
+}
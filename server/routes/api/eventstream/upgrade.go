@@ -0,0 +1,34 @@
+package eventstream
+
+import (
+	"net/http"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo"
+)
+
+// RequireUpgrade rejects the requests to the WebSocket endpoint that cannot be upgraded cleanly
+// before anything else runs, so that e.g. a stream token is not redeemed for a plain GET.
+//
+// The group must not use any middleware writing the response or wrapping the writer,
+// e.g. CSRF or gzip, the connection is hijacked by the upgrade. The Origin header
+// is checked by the upgrader, which is what protects the endpoint from cross-site use.
+func RequireUpgrade() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			req := ctx.Request()
+
+			if !websocket.IsWebSocketUpgrade(req) {
+				return echo.NewHTTPError(http.StatusBadRequest, "WebSocket upgrade expected")
+			}
+			// Repeated handshake headers make the proxies and the upgrader disagree
+			// on which value counts, so they are not accepted.
+			for _, header := range []string{"Sec-Websocket-Key", "Sec-Websocket-Version"} {
+				if len(req.Header[header]) > 1 {
+					return echo.NewHTTPError(http.StatusBadRequest, "duplicate "+header+" header")
+				}
+			}
+			return next(ctx)
+		}
+	}
+}
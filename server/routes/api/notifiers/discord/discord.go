@@ -195,7 +195,8 @@ To command me, simply send me a message containing one of the commands above.`
 				"settings.userId": msg.Author.ID,
 			}
 
-			if err := setEnabled(serverCtx.DB.C("notifiers"), selector, true); err != nil {
+			ownerId, err := setEnabled(serverCtx.DB.C("notifiers"), selector, true)
+			if err != nil {
 				if errors.Cause(err) == mgo.ErrNotFound {
 					text = "SteemWatch link not found, did you call **link**?"
 				} else {
@@ -203,6 +204,7 @@ To command me, simply send me a message containing one of the commands above.`
 					text = "Something went terribly wrong, sorry!"
 				}
 			} else {
+				serverCtx.ConfigChanges.Changed(ownerId.Hex())
 				text = "Enabled, as you wanted."
 			}
 
@@ -211,7 +213,8 @@ To command me, simply send me a message containing one of the commands above.`
 				"settings.userId": msg.Author.ID,
 			}
 
-			if err := setEnabled(serverCtx.DB.C("notifiers"), selector, false); err != nil {
+			ownerId, err := setEnabled(serverCtx.DB.C("notifiers"), selector, false)
+			if err != nil {
 				if errors.Cause(err) == mgo.ErrNotFound {
 					text = "SteemWatch link not found, did you call **link**?"
 				} else {
@@ -219,6 +222,7 @@ To command me, simply send me a message containing one of the commands above.`
 					text = "Something went terribly wrong, sorry!"
 				}
 			} else {
+				serverCtx.ConfigChanges.Changed(ownerId.Hex())
 				text = "Disabled, as you wanted."
 			}
 
@@ -227,7 +231,8 @@ To command me, simply send me a message containing one of the commands above.`
 				"settings.userId": msg.Author.ID,
 			}
 
-			if err := unlink(serverCtx.DB.C("notifiers"), selector); err != nil {
+			ownerId, err := unlink(serverCtx.DB.C("notifiers"), selector)
+			if err != nil {
 				if errors.Cause(err) == mgo.ErrNotFound {
 					text = "SteemWatch link not found, did you call **link**?"
 				} else {
@@ -235,6 +240,7 @@ To command me, simply send me a message containing one of the commands above.`
 					text = "Something went terribly wrong, sorry!"
 				}
 			} else {
+				serverCtx.ConfigChanges.Changed(ownerId.Hex())
 				text = "Unlinked from SteemWatch, as you wanted."
 			}
 
@@ -262,8 +268,9 @@ To command me, simply send me a message containing one of the commands above.`
 					},
 				}
 
-				if err := serverCtx.DB.C("notifiers").Update(selector, change); err != nil {
-					if err == mgo.ErrNotFound {
+				ownerId, err := apply(serverCtx.DB.C("notifiers"), selector, change)
+				if err != nil {
+					if errors.Cause(err) == mgo.ErrNotFound {
 						send("I don't recognize the token you provided.")
 					} else {
 						send("Something went terribly wrong, sorry!")
@@ -272,6 +279,7 @@ To command me, simply send me a message containing one of the commands above.`
 					return
 				}
 
+				serverCtx.ConfigChanges.Changed(ownerId.Hex())
 				text = "SteemWatch account linked successfully."
 
 			default:
@@ -359,7 +367,10 @@ func BindAPI(serverCtx *context.Context, root *echo.Group) {
 			"ownerId": bson.ObjectIdHex(profile.Id),
 		}
 
-		return setEnabled(serverCtx.DB.C("notifiers"), selector, *doc.Enabled)
+		return serverCtx.PersistConfig(ctx, profile.Id, func() error {
+			_, err := setEnabled(serverCtx.DB.C("notifiers"), selector, *doc.Enabled)
+			return err
+		})
 	})
 
 	root.DELETE("/", func(ctx echo.Context) error {
@@ -369,11 +380,14 @@ func BindAPI(serverCtx *context.Context, root *echo.Group) {
 			"ownerId": bson.ObjectIdHex(profile.Id),
 		}
 
-		return unlink(serverCtx.DB.C("notifiers"), selector)
+		return serverCtx.PersistConfig(ctx, profile.Id, func() error {
+			_, err := unlink(serverCtx.DB.C("notifiers"), selector)
+			return err
+		})
 	})
 }
 
-func setEnabled(c *mgo.Collection, selector bson.M, enabled bool) error {
+func setEnabled(c *mgo.Collection, selector bson.M, enabled bool) (bson.ObjectId, error) {
 	selector["notifierId"] = NotifierID
 
 	update := bson.M{
@@ -382,11 +396,10 @@ func setEnabled(c *mgo.Collection, selector bson.M, enabled bool) error {
 		},
 	}
 
-	err := c.Update(selector, update)
-	return errors.Wrapf(err, "failed to update doc [select=%+v, update=%+v]", selector, update)
+	return apply(c, selector, update)
 }
 
-func unlink(c *mgo.Collection, selector bson.M) error {
+func unlink(c *mgo.Collection, selector bson.M) (bson.ObjectId, error) {
 	selector["notifierId"] = NotifierID
 
 	update := bson.M{
@@ -400,6 +413,15 @@ func unlink(c *mgo.Collection, selector bson.M) error {
 		},
 	}
 
-	err := c.Update(selector, update)
-	return errors.Wrapf(err, "failed to update doc [select=%+v, update=%+v]", selector, update)
+	return apply(c, selector, update)
+}
+
+// apply updates the doc and returns the owner so that the bot commands
+// can report the change, the selector not being bound to the user there.
+func apply(c *mgo.Collection, selector, update bson.M) (bson.ObjectId, error) {
+	var doc Document
+	if _, err := c.Find(selector).Select(bson.M{"ownerId": 1}).Apply(mgo.Change{Update: update}, &doc); err != nil {
+		return "", errors.Wrapf(err, "failed to update doc [select=%+v, update=%+v]", selector, update)
+	}
+	return doc.OwnerId, nil
 }
@@ -0,0 +1,223 @@
+package push
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/tchap/steemwatch/server/changes"
+	"github.com/tchap/steemwatch/server/context"
+	"github.com/tchap/steemwatch/server/users"
+
+	"github.com/labstack/echo"
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	NotifierIDAPNs = "apns"
+	NotifierIDFCM  = "fcm"
+)
+
+// MaxDeviceTokens is the maximum number of devices registered per user and gateway.
+const MaxDeviceTokens = 10
+
+// The device token lengths accepted. The APNs tokens are 32 bytes, hex encoded, Apple may
+// make them longer though. The FCM registration tokens are about 160 characters.
+const (
+	MinAPNsTokenLength = 64
+	MaxAPNsTokenLength = 200
+	MaxFCMTokenLength  = 4096
+)
+
+type Settings struct {
+	// DeviceTokens are the tokens of the devices the notifications are pushed to.
+	// The tokens reported as invalid by the gateway are removed automatically.
+	DeviceTokens []string `json:"deviceTokens" bson:"deviceTokens"`
+}
+
+type Document struct {
+	OwnerId    bson.ObjectId `json:"-"        bson:"ownerId,omitempty"`
+	NotifierId string        `json:"-"        bson:"notifierId,omitempty"`
+	Enabled    *bool         `json:"enabled"  bson:"enabled,omitempty"`
+	Settings   *Settings     `json:"settings" bson:"settings,omitempty"`
+}
+
+// Bind binds the settings API for the given push notifier, apns or fcm.
+// The native app registers the device token using POST devices/ on every start.
+func Bind(serverCtx *context.Context, root *echo.Group, notifierId string) {
+	selectorFor := func(ctx echo.Context) bson.M {
+		profile := ctx.Get("user").(*users.User)
+		return bson.M{
+			"ownerId":    bson.ObjectIdHex(profile.Id),
+			"notifierId": notifierId,
+		}
+	}
+
+	root.GET("/", func(ctx echo.Context) error {
+		query := selectorFor(ctx)
+
+		var doc Document
+		err := serverCtx.DB.C("notifiers").Find(query).One(&doc)
+		if err != nil {
+			if err == mgo.ErrNotFound {
+				enabled := false
+				doc.Enabled = &enabled
+				doc.Settings = &Settings{}
+			} else {
+				return errors.Wrapf(err, "failed to get doc [query=%+v]", query)
+			}
+		}
+		if doc.Settings.DeviceTokens == nil {
+			doc.Settings.DeviceTokens = []string{}
+		}
+
+		err = json.NewEncoder(ctx.Response().Writer).Encode(&doc)
+		return errors.Wrapf(err, "failed to encode doc [doc=%+v]", doc)
+	})
+
+	root.PATCH("/", func(ctx echo.Context) error {
+		var doc struct {
+			Enabled *bool `json:"enabled" bson:"enabled,omitempty"`
+		}
+		if err := json.NewDecoder(ctx.Request().Body).Decode(&doc); err != nil {
+			return errors.Wrap(err, "failed to decode request body")
+		}
+		if doc.Enabled == nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "field not set: enabled")
+		}
+
+		profile := ctx.Get("user").(*users.User)
+		selector := selectorFor(ctx)
+		update := bson.M{
+			"$set": &doc,
+		}
+
+		return serverCtx.PersistConfig(ctx, profile.Id, func() error {
+			_, err := serverCtx.DB.C("notifiers").Upsert(selector, update)
+			return errors.Wrapf(err, "failed to update doc [select=%+v, update=%+v]", selector, doc)
+		})
+	})
+
+	root.POST("/devices/", func(ctx echo.Context) error {
+		body, err := ioutil.ReadAll(ctx.Request().Body)
+		if err != nil {
+			return err
+		}
+		token := strings.TrimSpace(string(body))
+		if err := validateDeviceToken(notifierId, token); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+
+		// The device is registered unless the user has too many of them already.
+		selector := selectorFor(ctx)
+
+		var doc Document
+		err = serverCtx.DB.C("notifiers").Find(selector).One(&doc)
+		if err != nil && err != mgo.ErrNotFound {
+			return errors.Wrapf(err, "failed to get doc [query=%+v]", selector)
+		}
+		if doc.Settings != nil && len(doc.Settings.DeviceTokens) >= MaxDeviceTokens {
+			registered := false
+			for _, t := range doc.Settings.DeviceTokens {
+				if t == token {
+					registered = true
+				}
+			}
+			if !registered {
+				return echo.NewHTTPError(http.StatusUnprocessableEntity, fmt.Sprintf(
+					"too many devices registered, the limit is %v", MaxDeviceTokens))
+			}
+		}
+
+		update := bson.M{
+			"$addToSet": bson.M{
+				"settings.deviceTokens": token,
+			},
+			"$setOnInsert": bson.M{
+				"enabled": true,
+			},
+		}
+
+		_, err = serverCtx.DB.C("notifiers").Upsert(selector, update)
+		return errors.Wrapf(err, "failed to register device [select=%+v]", selector)
+	})
+
+	root.DELETE("/devices/:token/", func(ctx echo.Context) error {
+		profile := ctx.Get("user").(*users.User)
+		selector := selectorFor(ctx)
+		update := bson.M{
+			"$pull": bson.M{
+				"settings.deviceTokens": ctx.Param("token"),
+			},
+		}
+
+		return serverCtx.PersistConfig(ctx, profile.Id, func() error {
+			err := serverCtx.DB.C("notifiers").Update(selector, update)
+			if err == mgo.ErrNotFound {
+				return nil
+			}
+			return errors.Wrapf(err, "failed to unregister device [select=%+v]", selector)
+		})
+	})
+}
+
+// validateDeviceToken checks the token format of the given gateway. The APNs tokens
+// are hex encoded, the FCM registration tokens are URL-safe strings.
+func validateDeviceToken(notifierId, token string) error {
+	if token == "" {
+		return errors.New("empty device token")
+	}
+
+	switch notifierId {
+	case NotifierIDAPNs:
+		if len(token) < MinAPNsTokenLength || len(token) > MaxAPNsTokenLength || len(token)%2 != 0 {
+			return errors.Errorf("APNs device token must be %v to %v hex digits",
+				MinAPNsTokenLength, MaxAPNsTokenLength)
+		}
+		if _, err := hex.DecodeString(token); err != nil {
+			return errors.New("APNs device token must be hex encoded")
+		}
+	case NotifierIDFCM:
+		if len(token) > MaxFCMTokenLength {
+			return errors.Errorf("FCM registration token must be at most %v characters", MaxFCMTokenLength)
+		}
+		for _, c := range token {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-_:", c)) {
+				return errors.Errorf("FCM registration token contains invalid character %q", c)
+			}
+		}
+	}
+	return nil
+}
+
+// RemoveDeviceToken removes the token reported as invalid by the gateway.
+// The change is reported to the feed unless it is nil, so that the cached configuration drops the token.
+func RemoveDeviceToken(db *mgo.Database, feed *changes.Feed, userId, notifierId, token string) error {
+	selector := bson.M{
+		"ownerId":    bson.ObjectIdHex(userId),
+		"notifierId": notifierId,
+	}
+	update := bson.M{
+		"$pull": bson.M{
+			"settings.deviceTokens": token,
+		},
+	}
+
+	err := db.C("notifiers").Update(selector, update)
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to remove device token [select=%+v]", selector)
+	}
+
+	if feed != nil {
+		feed.Changed(userId)
+	}
+	return nil
+}
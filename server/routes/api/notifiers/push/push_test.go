@@ -0,0 +1,38 @@
+package push
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateDeviceToken(t *testing.T) {
+	apnsToken := strings.Repeat("0a", 32)
+	fcmToken := "dGVzdA:APA91b" + strings.Repeat("x-_Y", 35)
+
+	testCases := []struct {
+		notifierId string
+		token      string
+		valid      bool
+	}{
+		{NotifierIDAPNs, apnsToken, true},
+		{NotifierIDAPNs, strings.ToUpper(apnsToken), true},
+		{NotifierIDAPNs, "", false},
+		{NotifierIDAPNs, apnsToken[:62], false},
+		{NotifierIDAPNs, apnsToken + "0", false},
+		{NotifierIDAPNs, strings.Repeat("0a", 101), false},
+		{NotifierIDAPNs, apnsToken[:62] + "zz", false},
+		{NotifierIDAPNs, apnsToken[:62] + "/x", false},
+		{NotifierIDFCM, fcmToken, true},
+		{NotifierIDFCM, "", false},
+		{NotifierIDFCM, fcmToken + "/..", false},
+		{NotifierIDFCM, fcmToken + "?x=1", false},
+		{NotifierIDFCM, strings.Repeat("x", MaxFCMTokenLength+1), false},
+	}
+
+	for _, tc := range testCases {
+		err := validateDeviceToken(tc.notifierId, tc.token)
+		if (err == nil) != tc.valid {
+			t.Errorf("%v token %q: got error %v, want valid %v", tc.notifierId, tc.token, err, tc.valid)
+		}
+	}
+}
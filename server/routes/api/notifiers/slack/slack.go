@@ -83,8 +83,10 @@ func Bind(serverCtx *context.Context, root *echo.Group) {
 			"notifierId": doc.NotifierId,
 		}
 
-		_, err := serverCtx.DB.C("notifiers").Upsert(selector, &doc)
-		return errors.Wrapf(err, "failed to upsert doc [select=%+v, upsert=%+v]", selector, doc)
+		return serverCtx.PersistConfig(ctx, profile.Id, func() error {
+			_, err := serverCtx.DB.C("notifiers").Upsert(selector, &doc)
+			return errors.Wrapf(err, "failed to upsert doc [select=%+v, upsert=%+v]", selector, doc)
+		})
 	})
 
 	root.PATCH("/", func(ctx echo.Context) error {
@@ -104,7 +106,9 @@ func Bind(serverCtx *context.Context, root *echo.Group) {
 			"$set": &doc,
 		}
 
-		err := serverCtx.DB.C("notifiers").Update(selector, update)
-		return errors.Wrapf(err, "failed to update doc [select=%+v, update=%+v]", selector, doc)
+		return serverCtx.PersistConfig(ctx, profile.Id, func() error {
+			err := serverCtx.DB.C("notifiers").Update(selector, update)
+			return errors.Wrapf(err, "failed to update doc [select=%+v, update=%+v]", selector, doc)
+		})
 	})
 }
@@ -0,0 +1,55 @@
+package status
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/tchap/steemwatch/server/context"
+	"github.com/tchap/steemwatch/server/users"
+
+	"github.com/labstack/echo"
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type Document struct {
+	NotifierId          string     `json:"notifierId"              bson:"notifierId"`
+	LastAttemptAt       *time.Time `json:"lastAttemptAt,omitempty" bson:"lastAttemptAt,omitempty"`
+	LastSuccessAt       *time.Time `json:"lastSuccessAt,omitempty" bson:"lastSuccessAt,omitempty"`
+	LastError           string     `json:"lastError,omitempty"     bson:"lastError,omitempty"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"     bson:"consecutiveFailures"`
+	BreakerState        string     `json:"breakerState,omitempty"  bson:"breakerState,omitempty"`
+	DeadLetters         int        `json:"deadLetters"             bson:"-"`
+}
+
+// Bind exposes the delivery status of the notifiers configured by the user.
+func Bind(serverCtx *context.Context, root *echo.Group) {
+	root.GET("/", func(ctx echo.Context) error {
+		profile := ctx.Get("user").(*users.User)
+		ownerId := bson.ObjectIdHex(profile.Id)
+
+		query := bson.M{
+			"ownerId": ownerId,
+		}
+
+		docs := []*Document{}
+		if err := serverCtx.DB.C("deliveryStatus").Find(query).All(&docs); err != nil {
+			return errors.Wrapf(err, "failed to get delivery status [query=%+v]", query)
+		}
+
+		for _, doc := range docs {
+			query := bson.M{
+				"ownerId":    ownerId,
+				"notifierId": doc.NotifierId,
+			}
+			n, err := serverCtx.DB.C("deadLetters").Find(query).Count()
+			if err != nil {
+				return errors.Wrapf(err, "failed to count dead letters [query=%+v]", query)
+			}
+			doc.DeadLetters = n
+		}
+
+		ctx.Response().Header().Set(echo.HeaderContentType, "application/json")
+		return json.NewEncoder(ctx.Response().Writer).Encode(docs)
+	})
+}
@@ -104,8 +104,10 @@ func Bind(serverCtx *context.Context, root *echo.Group) {
 			"notifierId": doc.NotifierId,
 		}
 
-		_, err := serverCtx.DB.C("notifiers").Upsert(selector, &doc)
-		return errors.Wrapf(err, "failed to upsert doc [select=%+v, upsert=%+v]", selector, doc)
+		return serverCtx.PersistConfig(ctx, profile.Id, func() error {
+			_, err := serverCtx.DB.C("notifiers").Upsert(selector, &doc)
+			return errors.Wrapf(err, "failed to upsert doc [select=%+v, upsert=%+v]", selector, doc)
+		})
 	})
 
 	root.PATCH("/", func(ctx echo.Context) error {
@@ -134,8 +136,10 @@ func Bind(serverCtx *context.Context, root *echo.Group) {
 			"$set": &doc,
 		}
 
-		err := serverCtx.DB.C("notifiers").Update(selector, update)
-		return errors.Wrapf(err, "failed to update doc [select=%+v, update=%+v]", selector, doc)
+		return serverCtx.PersistConfig(ctx, profile.Id, func() error {
+			err := serverCtx.DB.C("notifiers").Update(selector, update)
+			return errors.Wrapf(err, "failed to update doc [select=%+v, update=%+v]", selector, doc)
+		})
 	})
 
 	root.DELETE("/", func(ctx echo.Context) error {
@@ -146,8 +150,10 @@ func Bind(serverCtx *context.Context, root *echo.Group) {
 			"notifierId": NotifierID,
 		}
 
-		err := serverCtx.DB.C("notifiers").Remove(selector)
-		return errors.Wrapf(err, "failed to remove doc [select=%+v]", selector)
+		return serverCtx.PersistConfig(ctx, profile.Id, func() error {
+			err := serverCtx.DB.C("notifiers").Remove(selector)
+			return errors.Wrapf(err, "failed to remove doc [select=%+v]", selector)
+		})
 	})
 }
 
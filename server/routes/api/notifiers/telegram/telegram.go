@@ -116,7 +116,10 @@ You will be receiving SteemWatch notifications in this channel.`
 				},
 			}
 
-			if err := serverCtx.DB.C("notifiers").Update(selector, change); err != nil {
+			// The selector is not bound to the user, the owner is read back to report the change.
+			var doc Document
+			_, err := serverCtx.DB.C("notifiers").Find(selector).Select(bson.M{"ownerId": 1}).Apply(mgo.Change{Update: change}, &doc)
+			if err != nil {
 				if err == mgo.ErrNotFound {
 					return ctx.JSON(http.StatusOK, map[string]interface{}{
 						"method":  "sendMessage",
@@ -126,6 +129,7 @@ You will be receiving SteemWatch notifications in this channel.`
 				}
 				return errors.Wrap(err, "failed to enable Telegram")
 			}
+			serverCtx.ConfigChanges.Changed(doc.OwnerId.Hex())
 
 			return ctx.JSON(http.StatusOK, map[string]interface{}{
 				"method":  "sendMessage",
@@ -192,8 +196,10 @@ func BindAPI(serverCtx *context.Context, root *echo.Group) {
 			},
 		}
 
-		err := serverCtx.DB.C("notifiers").Update(selector, update)
-		return errors.Wrapf(err, "failed to update doc [select=%+v, update=%+v]", selector, update)
+		return serverCtx.PersistConfig(ctx, profile.Id, func() error {
+			err := serverCtx.DB.C("notifiers").Update(selector, update)
+			return errors.Wrapf(err, "failed to update doc [select=%+v, update=%+v]", selector, update)
+		})
 	})
 
 	root.DELETE("/", func(ctx echo.Context) error {
@@ -217,7 +223,9 @@ func BindAPI(serverCtx *context.Context, root *echo.Group) {
 			},
 		}
 
-		err := serverCtx.DB.C("notifiers").Update(selector, update)
-		return errors.Wrapf(err, "failed to update doc [select=%+v, update=%+v]", selector, update)
+		return serverCtx.PersistConfig(ctx, profile.Id, func() error {
+			err := serverCtx.DB.C("notifiers").Update(selector, update)
+			return errors.Wrapf(err, "failed to update doc [select=%+v, update=%+v]", selector, update)
+		})
 	})
 }
@@ -0,0 +1,51 @@
+package profile
+
+import (
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// MaxVibrationSteps limits the length of the vibration pattern.
+	MaxVibrationSteps = 16
+	// MaxVibrationStepMs limits a single step of the vibration pattern.
+	MaxVibrationStepMs = 5000
+)
+
+var soundNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_.-]{1,64}$`)
+
+// AlertHint tells the native clients how to get the user's attention for an event.
+// The hint is advisory, the clients that do not support it ignore it.
+// An empty hint means a silent event.
+type AlertHint struct {
+	// Sound is the name of the sound to play, e.g. "default" or "alarm".
+	Sound string `json:"sound,omitempty" bson:"sound,omitempty"`
+	// Vibration is the vibration pattern, alternating the milliseconds to wait and to vibrate.
+	Vibration []uint `json:"vibration,omitempty" bson:"vibration,omitempty"`
+	// WakeScreen asks the client to turn the screen on.
+	WakeScreen bool `json:"wakeScreen,omitempty" bson:"wakeScreen,omitempty"`
+}
+
+// Silent returns true when the hint does not ask for any attention.
+func (hint *AlertHint) Silent() bool {
+	return hint == nil || (hint.Sound == "" && len(hint.Vibration) == 0 && !hint.WakeScreen)
+}
+
+func (hint *AlertHint) Validate() error {
+	if hint == nil {
+		return nil
+	}
+	if hint.Sound != "" && !soundNameRegexp.MatchString(hint.Sound) {
+		return errors.Errorf("invalid sound name: %q", hint.Sound)
+	}
+	if len(hint.Vibration) > MaxVibrationSteps {
+		return errors.Errorf("vibration pattern longer than %v steps", MaxVibrationSteps)
+	}
+	for _, ms := range hint.Vibration {
+		if ms > MaxVibrationStepMs {
+			return errors.Errorf("vibration step longer than %v ms", MaxVibrationStepMs)
+		}
+	}
+	return nil
+}
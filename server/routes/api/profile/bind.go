@@ -3,17 +3,151 @@ package profile
 import (
 	"encoding/json"
 	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
+	"github.com/tchap/steemwatch/notifications/events"
+	"github.com/tchap/steemwatch/notifications/exchanges"
 	"github.com/tchap/steemwatch/server/context"
+	"github.com/tchap/steemwatch/server/db"
 	"github.com/tchap/steemwatch/server/users"
 
 	"github.com/labstack/echo"
+	"github.com/pkg/errors"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
 
 type Profile struct {
-	Accounts []string `json:"accounts" bson:"accounts"`
+	Accounts   []string `json:"accounts"   bson:"accounts"`
+	MutedWords []string `json:"mutedWords" bson:"mutedWords"`
+}
+
+// Settings contains the user-wide options stored in the users collection.
+// Fields that are not set keep their current value on PATCH.
+type Settings struct {
+	MuteWholeWordsOnly  *bool `json:"muteWholeWordsOnly,omitempty"  bson:"muteWholeWordsOnly,omitempty"`
+	NotifierConcurrency *uint `json:"notifierConcurrency,omitempty" bson:"notifierConcurrency,omitempty"`
+
+	// MinAccountAgeDays applies to all event kinds in addition to the per-kind setting.
+	MinAccountAgeDays *uint `json:"minAccountAgeDays,omitempty" bson:"minAccountAgeDays,omitempty"`
+
+	// ExchangeAccounts is applied on top of the global exchange account list.
+	// An empty label removes the account from the list.
+	ExchangeAccounts exchanges.Accounts `json:"exchangeAccounts,omitempty" bson:"exchangeAccounts,omitempty"`
+
+	// ActiveWindow holds the events received outside of the window
+	// and delivers them as a single digest once the window opens.
+	ActiveWindow *ActiveWindow `json:"activeWindow,omitempty" bson:"activeWindow,omitempty"`
+
+	// DailySummary sends a report of the day's activity once per day, separately from the digests.
+	DailySummary *DailySummary `json:"dailySummary,omitempty" bson:"dailySummary,omitempty"`
+
+	// StreamCompression enables compression of the event stream when the client supports it.
+	StreamCompression *bool `json:"streamCompression,omitempty" bson:"streamCompression,omitempty"`
+	// MinimalPayloads drops optional fields from the event stream payloads
+	// and shortens content excerpts to save bandwidth.
+	MinimalPayloads *bool `json:"minimalPayloads,omitempty" bson:"minimalPayloads,omitempty"`
+	// FieldNaming is the naming convention of the event stream payload fields,
+	// FieldNamingCamelCase (the default) or FieldNamingSnakeCase.
+	FieldNaming string `json:"fieldNaming,omitempty" bson:"fieldNaming,omitempty"`
+	// AmountFormat is how the event stream payloads carry amounts such as "1.234 STEEM",
+	// AmountFormatString (the default), AmountFormatStructured or AmountFormatBoth.
+	AmountFormat string `json:"amountFormat,omitempty" bson:"amountFormat,omitempty"`
+	// AlertHints maps event kinds to the alert hints sent to the native clients over the event stream,
+	// overriding the defaults. An empty hint silences the kind.
+	AlertHints map[string]*AlertHint `json:"alertHints,omitempty" bson:"alertHints,omitempty"`
+
+	// AutoWatchThreads makes the user receive all comments in the threads
+	// the user's accounts commented in recently.
+	AutoWatchThreads *bool `json:"autoWatchThreads,omitempty" bson:"autoWatchThreads,omitempty"`
+
+	// DeliveryMode is either DeliveryModeFanout or DeliveryModeFallback.
+	DeliveryMode string `json:"deliveryMode,omitempty" bson:"deliveryMode,omitempty"`
+	// FallbackChain lists the notifier IDs in the order they are tried in DeliveryModeFallback.
+	// Enabled notifiers missing from the chain are tried last.
+	FallbackChain []string `json:"fallbackChain,omitempty" bson:"fallbackChain,omitempty"`
+
+	// TitleTemplates maps event kinds to the templates of the titles shown by the channels
+	// that display a title separately from the body. The event is passed to the template as data.
+	TitleTemplates map[string]string `json:"titleTemplates,omitempty" bson:"titleTemplates,omitempty"`
+
+	// PayloadFields maps notifier IDs to the filters applied to the events sent to the notifier.
+	// All the fields are sent to the notifiers not listed.
+	PayloadFields map[string]*FieldFilter `json:"payloadFields,omitempty" bson:"payloadFields,omitempty"`
+
+	// HistoryRetentionDays is for how many days the event history is kept.
+	// The operator's default is used when not set, the operator's maximum is applied in any case.
+	HistoryRetentionDays *uint `json:"historyRetentionDays,omitempty" bson:"historyRetentionDays,omitempty"`
+
+	// OrderedDelivery makes the events arrive strictly in block order, numbered by a per-user sequence.
+	OrderedDelivery *bool `json:"orderedDelivery,omitempty" bson:"orderedDelivery,omitempty"`
+}
+
+const (
+	// DeliveryModeFanout delivers every event to all the enabled notifiers. This is the default.
+	DeliveryModeFanout = "fanout"
+	// DeliveryModeFallback tries the enabled notifiers one by one
+	// and stops at the first one that delivers the event successfully.
+	DeliveryModeFallback = "fallback"
+)
+
+const (
+	FieldNamingCamelCase = "camelCase"
+	FieldNamingSnakeCase = "snake_case"
+)
+
+const (
+	// AmountFormatString keeps the amounts as strings, e.g. "1.234 STEEM".
+	AmountFormatString = "string"
+	// AmountFormatStructured replaces the amounts with {"amount": 1.234, "symbol": "STEEM"}.
+	AmountFormatStructured = "structured"
+	// AmountFormatBoth keeps the strings and adds the structured form as <field>Parsed.
+	AmountFormatBoth = "both"
+)
+
+func (settings *Settings) Validate() error {
+	switch settings.DeliveryMode {
+	case "", DeliveryModeFanout, DeliveryModeFallback:
+	default:
+		return errors.New("deliveryMode must be either fanout or fallback")
+	}
+	switch settings.FieldNaming {
+	case "", FieldNamingCamelCase, FieldNamingSnakeCase:
+	default:
+		return errors.New("fieldNaming must be either camelCase or snake_case")
+	}
+	switch settings.AmountFormat {
+	case "", AmountFormatString, AmountFormatStructured, AmountFormatBoth:
+	default:
+		return errors.New("amountFormat must be either string, structured or both")
+	}
+	for kind, text := range settings.TitleTemplates {
+		if _, err := events.CompileTitleTemplate(kind, text); err != nil {
+			return errors.Wrapf(err, "titleTemplates.%v", kind)
+		}
+	}
+	for i, account := range settings.ExchangeAccounts {
+		if account == nil || account.Account == "" {
+			return errors.Errorf("exchangeAccounts.%v: account is required", i)
+		}
+	}
+	for kind, hint := range settings.AlertHints {
+		if err := hint.Validate(); err != nil {
+			return errors.Wrapf(err, "alertHints.%v", kind)
+		}
+	}
+	for id, filter := range settings.PayloadFields {
+		if err := filter.Validate(); err != nil {
+			return errors.Wrapf(err, "payloadFields.%v", id)
+		}
+	}
+	if err := settings.DailySummary.Validate(); err != nil {
+		return err
+	}
+	return settings.ActiveWindow.Validate()
 }
 
 func Bind(serverCtx *context.Context, group *echo.Group) {
@@ -25,7 +159,8 @@ func Bind(serverCtx *context.Context, group *echo.Group) {
 		}
 
 		selector := bson.M{
-			"accounts": 1,
+			"accounts":   1,
+			"mutedWords": 1,
 		}
 
 		var doc Profile
@@ -89,8 +224,10 @@ func Bind(serverCtx *context.Context, group *echo.Group) {
 			},
 		}
 
-		_, err = serverCtx.DB.C("users").Upsert(selector, update)
-		return err
+		return serverCtx.PersistConfig(ctx, profile.Id, func() error {
+			_, err := serverCtx.DB.C("users").Upsert(selector, update)
+			return err
+		})
 	})
 
 	group.DELETE("/accounts/:item/", func(ctx echo.Context) error {
@@ -110,6 +247,160 @@ func Bind(serverCtx *context.Context, group *echo.Group) {
 			},
 		}
 
-		return serverCtx.DB.C("users").Update(selector, update)
+		return serverCtx.PersistConfig(ctx, profile.Id, func() error {
+			return serverCtx.DB.C("users").Update(selector, update)
+		})
+	})
+
+	group.GET("/settings/", func(ctx echo.Context) error {
+		profile := ctx.Get("user").(*users.User)
+
+		query := bson.M{
+			"_id": bson.ObjectIdHex(profile.Id),
+		}
+
+		selector := bson.M{
+			"settings": 1,
+		}
+
+		var doc struct {
+			Settings Settings `bson:"settings"`
+		}
+		err := serverCtx.DB.C("users").Find(query).Select(selector).One(&doc)
+		if err != nil && err != mgo.ErrNotFound {
+			return errors.Wrapf(err, "failed to get settings [query=%+v]", query)
+		}
+
+		ctx.Response().Header().Set(echo.HeaderContentType, "application/json")
+		return json.NewEncoder(ctx.Response().Writer).Encode(&doc.Settings)
+	})
+
+	group.PATCH("/settings/", func(ctx echo.Context) error {
+		profile := ctx.Get("user").(*users.User)
+
+		var settings Settings
+		if err := json.NewDecoder(ctx.Request().Body).Decode(&settings); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "failed to decode request body")
+		}
+		if err := settings.Validate(); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		if err := validateHistoryRetention(serverCtx, settings.HistoryRetentionDays); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+
+		fields, err := db.DottedFields("settings", &settings)
+		if err != nil {
+			return err
+		}
+		if len(fields) == 0 {
+			return nil
+		}
+
+		selector := bson.M{
+			"_id": bson.ObjectIdHex(profile.Id),
+		}
+
+		update := bson.M{
+			"$set": fields,
+		}
+
+		return serverCtx.PersistConfig(ctx, profile.Id, func() error {
+			err := serverCtx.DB.C("users").Update(selector, update)
+			if err != nil {
+				return errors.Wrapf(err, "failed to update settings [select=%+v, update=%+v]", selector, update)
+			}
+
+			if days := settings.HistoryRetentionDays; days != nil && *days != 0 {
+				return applyHistoryRetention(serverCtx, profile.Id, time.Duration(*days)*24*time.Hour)
+			}
+			return nil
+		})
+	})
+
+	group.GET("/mutedWords/", func(ctx echo.Context) error {
+		profile := ctx.Get("user").(*users.User)
+
+		query := bson.M{
+			"_id": bson.ObjectIdHex(profile.Id),
+		}
+
+		selector := bson.M{
+			"mutedWords": 1,
+		}
+
+		var (
+			doc  Profile
+			list []string
+		)
+		err := serverCtx.DB.C("users").Find(query).Select(selector).One(&doc)
+		if err != nil && err != mgo.ErrNotFound {
+			return err
+		}
+		if doc.MutedWords == nil {
+			list = []string{}
+		} else {
+			list = doc.MutedWords
+		}
+
+		// Send the chosen list as a response.
+		ctx.Response().Header().Set(echo.HeaderContentType, "application/json")
+		return json.NewEncoder(ctx.Response().Writer).Encode(list)
+	})
+
+	group.POST("/mutedWords/", func(ctx echo.Context) error {
+		// Read the request body.
+		body, err := ioutil.ReadAll(ctx.Request().Body)
+		if err != nil {
+			return err
+		}
+
+		// Muted words are matched case-insensitively, store them lowercased.
+		word := strings.ToLower(strings.TrimSpace(string(body)))
+		if word == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "empty muted word")
+		}
+
+		// Push to the database.
+		profile := ctx.Get("user").(*users.User)
+
+		selector := bson.M{
+			"_id": bson.ObjectIdHex(profile.Id),
+		}
+
+		update := bson.M{
+			"$addToSet": bson.M{
+				"mutedWords": word,
+			},
+		}
+
+		return serverCtx.PersistConfig(ctx, profile.Id, func() error {
+			return serverCtx.DB.C("users").Update(selector, update)
+		})
+	})
+
+	group.DELETE("/mutedWords/:item/", func(ctx echo.Context) error {
+		profile := ctx.Get("user").(*users.User)
+
+		// The word comes escaped in the path, e.g. with spaces, and it is normalized like in POST.
+		item, err := url.PathUnescape(ctx.Param("item"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid muted word")
+		}
+		word := strings.ToLower(strings.TrimSpace(item))
+
+		selector := bson.M{
+			"_id": bson.ObjectIdHex(profile.Id),
+		}
+
+		update := bson.M{
+			"$pull": bson.M{
+				"mutedWords": word,
+			},
+		}
+
+		return serverCtx.PersistConfig(ctx, profile.Id, func() error {
+			return serverCtx.DB.C("users").Update(selector, update)
+		})
 	})
 }
@@ -0,0 +1,34 @@
+package profile
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// FieldFilter selects the event fields sent to a notifier.
+// Fields are given as dotted paths into the event JSON, e.g. "op.memo" or "content.body",
+// matched case-insensitively. When Allow is set, only the listed fields are sent.
+// The fields listed in Deny are never sent. The removed fields are sent empty.
+type FieldFilter struct {
+	Allow []string `json:"allow,omitempty" bson:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"  bson:"deny,omitempty"`
+}
+
+// Empty returns true when the filter lets all the fields through.
+func (filter *FieldFilter) Empty() bool {
+	return filter == nil || (len(filter.Allow) == 0 && len(filter.Deny) == 0)
+}
+
+func (filter *FieldFilter) Validate() error {
+	if filter == nil {
+		return nil
+	}
+	for _, path := range append(append([]string{}, filter.Allow...), filter.Deny...) {
+		if path == "" || strings.HasPrefix(path, ".") || strings.HasSuffix(path, ".") ||
+			strings.Contains(path, "..") {
+			return errors.Errorf("invalid field path: %q", path)
+		}
+	}
+	return nil
+}
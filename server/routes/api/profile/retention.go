@@ -0,0 +1,49 @@
+package profile
+
+import (
+	"time"
+
+	"github.com/tchap/steemwatch/server/context"
+
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func validateHistoryRetention(serverCtx *context.Context, days *uint) error {
+	if days == nil || *days == 0 || serverCtx.HistoryMaxRetention == 0 {
+		return nil
+	}
+	if max := serverCtx.HistoryMaxRetention; time.Duration(*days)*24*time.Hour > max {
+		return errors.Errorf("historyRetentionDays cannot exceed %v", int(max.Hours()/24))
+	}
+	return nil
+}
+
+// applyHistoryRetention makes a shorter retention take effect for the existing entries.
+// The entries older than the retention are removed right away and the rest expire
+// within the retention from now. A longer retention only applies to the new entries.
+func applyHistoryRetention(serverCtx *context.Context, userId string, retention time.Duration) error {
+	now := time.Now()
+	ownerId := bson.ObjectIdHex(userId)
+
+	selector := bson.M{
+		"ownerId":   ownerId,
+		"createdAt": bson.M{"$lt": now.Add(-retention)},
+	}
+	if _, err := serverCtx.DB.C("history").RemoveAll(selector); err != nil {
+		return errors.Wrapf(err, "failed to remove history entries [select=%+v]", selector)
+	}
+
+	selector = bson.M{
+		"ownerId": ownerId,
+	}
+	update := bson.M{
+		"$min": bson.M{
+			"expiresAt": now.Add(retention),
+		},
+	}
+	if _, err := serverCtx.DB.C("history").UpdateAll(selector, update); err != nil {
+		return errors.Wrapf(err, "failed to update history entries [select=%+v, update=%+v]", selector, update)
+	}
+	return nil
+}
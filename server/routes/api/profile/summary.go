@@ -0,0 +1,70 @@
+package profile
+
+import (
+	"time"
+
+	"github.com/tchap/steemwatch/notifications/events"
+
+	"github.com/pkg/errors"
+)
+
+// DailySummary makes the user receive a report of the day's activity once per day.
+// Time uses the 24-hour HH:MM format in the given time zone, e.g. "08:00".
+// Sections lists the parts of the report, see events.SummarySections, all of them when empty.
+// An empty time disables the summary.
+type DailySummary struct {
+	Time     string   `json:"time"               bson:"time"`
+	Timezone string   `json:"timezone"           bson:"timezone"`
+	Sections []string `json:"sections,omitempty" bson:"sections,omitempty"`
+}
+
+func (summary *DailySummary) Enabled() bool {
+	return summary != nil && summary.Time != ""
+}
+
+func (summary *DailySummary) Validate() error {
+	if !summary.Enabled() {
+		return nil
+	}
+	if _, err := time.Parse(windowTimeLayout, summary.Time); err != nil {
+		return errors.New("dailySummary.time is not a valid HH:MM time")
+	}
+	if _, err := time.LoadLocation(summary.Timezone); err != nil {
+		return errors.New("dailySummary.timezone is not a valid time zone")
+	}
+	for _, section := range summary.Sections {
+		if !knownSummarySection(section) {
+			return errors.Errorf("dailySummary.sections: unknown section %q", section)
+		}
+	}
+	return nil
+}
+
+func knownSummarySection(section string) bool {
+	for _, s := range events.SummarySections {
+		if s == section {
+			return true
+		}
+	}
+	return false
+}
+
+// Due returns the time the last summary was due at t, i.e. today's send time once it has passed,
+// yesterday's send time otherwise. The summary covers the day before that time.
+func (summary *DailySummary) Due(t time.Time) (time.Time, error) {
+	loc, err := time.LoadLocation(summary.Timezone)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "invalid daily summary time zone")
+	}
+	at, err := time.Parse(windowTimeLayout, summary.Time)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "invalid daily summary time")
+	}
+
+	local := t.In(loc)
+	due := time.Date(local.Year(), local.Month(), local.Day(), at.Hour(), at.Minute(), 0, 0, loc)
+	if local.Before(due) {
+		due = due.AddDate(0, 0, -1)
+	}
+	return due, nil
+}
@@ -0,0 +1,73 @@
+package profile
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const windowTimeLayout = "15:04"
+
+// ActiveWindow is the part of the day when the user wants to receive notifications.
+// Start and End use the 24-hour HH:MM format in the given time zone, e.g. "08:00" and "22:30".
+// The window may span midnight. An empty window disables the feature.
+type ActiveWindow struct {
+	Start    string `json:"start"    bson:"start"`
+	End      string `json:"end"      bson:"end"`
+	Timezone string `json:"timezone" bson:"timezone"`
+}
+
+func (window *ActiveWindow) Enabled() bool {
+	return window != nil && window.Start != "" && window.End != ""
+}
+
+func (window *ActiveWindow) Validate() error {
+	if window == nil || (window.Start == "" && window.End == "") {
+		return nil
+	}
+	if _, err := time.Parse(windowTimeLayout, window.Start); err != nil {
+		return errors.New("activeWindow.start is not a valid HH:MM time")
+	}
+	if _, err := time.Parse(windowTimeLayout, window.End); err != nil {
+		return errors.New("activeWindow.end is not a valid HH:MM time")
+	}
+	if window.Start == window.End {
+		return errors.New("activeWindow.start and activeWindow.end must differ, leave both out to disable the window")
+	}
+	if _, err := time.LoadLocation(window.Timezone); err != nil {
+		return errors.New("activeWindow.timezone is not a valid time zone")
+	}
+	return nil
+}
+
+// Contains returns true when t falls into the window.
+// A window that is not enabled or that is invalid contains any time.
+func (window *ActiveWindow) Contains(t time.Time) bool {
+	if !window.Enabled() {
+		return true
+	}
+
+	loc, err := time.LoadLocation(window.Timezone)
+	if err != nil {
+		return true
+	}
+	start, err := time.Parse(windowTimeLayout, window.Start)
+	if err != nil {
+		return true
+	}
+	end, err := time.Parse(windowTimeLayout, window.End)
+	if err != nil {
+		return true
+	}
+
+	var (
+		local    = t.In(loc)
+		minute   = local.Hour()*60 + local.Minute()
+		startMin = start.Hour()*60 + start.Minute()
+		endMin   = end.Hour()*60 + end.Minute()
+	)
+	if startMin <= endMin {
+		return startMin <= minute && minute < endMin
+	}
+	return minute >= startMin || minute < endMin
+}
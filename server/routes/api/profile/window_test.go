@@ -0,0 +1,26 @@
+package profile
+
+import "testing"
+
+func TestActiveWindowValidate(t *testing.T) {
+	testCases := []struct {
+		name   string
+		window *ActiveWindow
+		valid  bool
+	}{
+		{"not set", nil, true},
+		{"disabled", &ActiveWindow{}, true},
+		{"daytime", &ActiveWindow{Start: "08:00", End: "22:30", Timezone: "Europe/Prague"}, true},
+		{"over midnight", &ActiveWindow{Start: "22:00", End: "06:00", Timezone: "UTC"}, true},
+		{"empty window", &ActiveWindow{Start: "08:00", End: "08:00", Timezone: "UTC"}, false},
+		{"start only", &ActiveWindow{Start: "08:00", Timezone: "UTC"}, false},
+		{"invalid time", &ActiveWindow{Start: "8am", End: "22:00", Timezone: "UTC"}, false},
+		{"invalid time zone", &ActiveWindow{Start: "08:00", End: "22:00", Timezone: "Mars/Olympus"}, false},
+	}
+
+	for _, tc := range testCases {
+		if err := tc.window.Validate(); (err == nil) != tc.valid {
+			t.Errorf("%v: got error %v, valid %v", tc.name, err, tc.valid)
+		}
+	}
+}
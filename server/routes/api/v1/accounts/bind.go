@@ -0,0 +1,118 @@
+package accounts
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/tchap/steemwatch/notifications/accounts"
+	"github.com/tchap/steemwatch/server/context"
+	"github.com/tchap/steemwatch/server/users"
+
+	"github.com/labstack/echo"
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// MaxOverviewAccounts caps the number of accounts in a single overview.
+const MaxOverviewAccounts = 200
+
+// accountLists are the watch lists holding account names, unlike e.g. tags.
+var accountLists = []string{
+	"accounts",
+	"witnesses",
+	"from",
+	"to",
+	"users",
+	"authors",
+	"voters",
+	"parentAuthors",
+	"payees",
+}
+
+// OverviewResponse is the initial state of the dashboard.
+type OverviewResponse struct {
+	Accounts []*accounts.Overview `json:"accounts"`
+	// Truncated is set when the user watches more than MaxOverviewAccounts accounts.
+	Truncated bool `json:"truncated"`
+}
+
+func Bind(serverCtx *context.Context, group *echo.Group) {
+	// The snapshot of the user's accounts and the accounts in the watch lists.
+	group.GET("/overview/", func(ctx echo.Context) error {
+		profile := ctx.Get("user").(*users.User)
+
+		names, err := watchedAccounts(serverCtx.DB, profile.Id)
+		if err != nil {
+			return err
+		}
+
+		resp := &OverviewResponse{}
+		if len(names) > MaxOverviewAccounts {
+			names = names[:MaxOverviewAccounts]
+			resp.Truncated = true
+		}
+
+		resp.Accounts, err = serverCtx.AccountOverviews.Get(names)
+		if err != nil {
+			if err == accounts.ErrOverviewsUnavailable {
+				return echo.NewHTTPError(http.StatusServiceUnavailable, err.Error())
+			}
+			return err
+		}
+		if resp.Accounts == nil {
+			resp.Accounts = []*accounts.Overview{}
+		}
+
+		ctx.Response().Header().Set(echo.HeaderContentType, "application/json")
+		return json.NewEncoder(ctx.Response().Writer).Encode(resp)
+	})
+}
+
+// watchedAccounts returns the user's accounts followed by the other accounts in the watch lists, sorted.
+func watchedAccounts(db *mgo.Database, userId string) ([]string, error) {
+	ownerId := bson.ObjectIdHex(userId)
+
+	var profile struct {
+		Accounts []string `bson:"accounts"`
+	}
+	err := db.C("users").FindId(ownerId).Select(bson.M{"accounts": 1}).One(&profile)
+	if err != nil && err != mgo.ErrNotFound {
+		return nil, errors.Wrapf(err, "failed to get accounts of user %v", userId)
+	}
+
+	selector := bson.M{}
+	for _, list := range accountLists {
+		selector[list] = 1
+	}
+
+	var (
+		doc     map[string][]string
+		watched = make(map[string]struct{})
+	)
+	iter := db.C("events").Find(bson.M{"ownerId": ownerId}).Select(selector).Iter()
+	for iter.Next(&doc) {
+		for _, list := range accountLists {
+			for _, account := range doc[list] {
+				watched[account] = struct{}{}
+			}
+		}
+		doc = nil
+	}
+	if err := iter.Err(); err != nil {
+		return nil, errors.Wrapf(err, "failed to get event documents for user %v", userId)
+	}
+
+	names := make([]string, 0, len(profile.Accounts)+len(watched))
+	for _, account := range profile.Accounts {
+		names = append(names, account)
+		delete(watched, account)
+	}
+	others := make([]string, 0, len(watched))
+	for account := range watched {
+		others = append(others, account)
+	}
+	sort.Strings(others)
+	return append(names, others...), nil
+}
@@ -0,0 +1,205 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/tchap/steemwatch/notifications"
+	"github.com/tchap/steemwatch/notifications/faults"
+	"github.com/tchap/steemwatch/server/context"
+	"github.com/tchap/steemwatch/server/maintenance"
+
+	"github.com/labstack/echo"
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// SecretHeader carries the secret required to access the admin API.
+const SecretHeader = "X-Steemwatch-Admin-Secret"
+
+// RequireSecret makes sure the request carries the admin secret.
+func RequireSecret(serverCtx *context.Context, secret string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			req := ctx.Request()
+			given := req.Header.Get(SecretHeader)
+			if subtle.ConstantTimeCompare([]byte(given), []byte(secret)) != 1 {
+				log.Printf("admin API: rejected %v %v from %v",
+					req.Method, req.URL.Path, serverCtx.ClientIP(req))
+				return echo.NewHTTPError(http.StatusUnauthorized)
+			}
+			return next(ctx)
+		}
+	}
+}
+
+type MaintenanceRequest struct {
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message,omitempty"`
+}
+
+func BindMaintenance(serverCtx *context.Context, group *echo.Group) {
+	group.GET("/", func(ctx echo.Context) error {
+		return writeStatus(ctx, serverCtx.Maintenance)
+	})
+
+	group.PUT("/", func(ctx echo.Context) error {
+		var req MaintenanceRequest
+		if err := json.NewDecoder(ctx.Request().Body).Decode(&req); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "failed to decode request body")
+		}
+
+		serverCtx.Maintenance.Set(req.Enabled, req.Message)
+		return writeStatus(ctx, serverCtx.Maintenance)
+	})
+}
+
+type PipelineRequest struct {
+	Paused bool   `json:"paused"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// BindPipeline pauses and resumes the block processing pipeline.
+// The WebSocket connections stay open while paused.
+func BindPipeline(serverCtx *context.Context, group *echo.Group) {
+	writePipelineStatus := func(ctx echo.Context) error {
+		status := serverCtx.Pipeline.Status()
+		ctx.Response().Header().Set(echo.HeaderContentType, "application/json")
+		return json.NewEncoder(ctx.Response().Writer).Encode(&status)
+	}
+
+	group.GET("/", writePipelineStatus)
+
+	group.PUT("/", func(ctx echo.Context) error {
+		var req PipelineRequest
+		if err := json.NewDecoder(ctx.Request().Body).Decode(&req); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "failed to decode request body")
+		}
+
+		if req.Paused {
+			log.Printf("admin API: pausing the pipeline: %v", req.Reason)
+			serverCtx.Pipeline.Pause(req.Reason)
+		} else {
+			log.Println("admin API: resuming the pipeline")
+			serverCtx.Pipeline.Resume()
+		}
+		return writePipelineStatus(ctx)
+	})
+}
+
+// BindFirehose grants the custom_json firehose to users, see notifications.FirehoseGrant.
+func BindFirehose(serverCtx *context.Context, group *echo.Group) {
+	group.GET("/:userId/", func(ctx echo.Context) error {
+		userId := ctx.Param("userId")
+		if !bson.IsObjectIdHex(userId) {
+			return echo.NewHTTPError(http.StatusNotFound)
+		}
+
+		var doc struct {
+			Firehose notifications.FirehoseGrant `bson:"firehose"`
+		}
+		err := serverCtx.DB.C("users").FindId(bson.ObjectIdHex(userId)).Select(bson.M{
+			"firehose": 1,
+		}).One(&doc)
+		if err != nil {
+			if err == mgo.ErrNotFound {
+				return echo.NewHTTPError(http.StatusNotFound)
+			}
+			return errors.Wrapf(err, "failed to get firehose grant for user %v", userId)
+		}
+
+		ctx.Response().Header().Set(echo.HeaderContentType, "application/json")
+		return json.NewEncoder(ctx.Response().Writer).Encode(&doc.Firehose)
+	})
+
+	group.PUT("/:userId/", func(ctx echo.Context) error {
+		userId := ctx.Param("userId")
+		if !bson.IsObjectIdHex(userId) {
+			return echo.NewHTTPError(http.StatusNotFound)
+		}
+
+		var grant notifications.FirehoseGrant
+		if err := json.NewDecoder(ctx.Request().Body).Decode(&grant); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "failed to decode request body")
+		}
+
+		update := bson.M{
+			"$set": bson.M{
+				"firehose": &grant,
+			},
+		}
+		if err := serverCtx.DB.C("users").UpdateId(bson.ObjectIdHex(userId), update); err != nil {
+			if err == mgo.ErrNotFound {
+				return echo.NewHTTPError(http.StatusNotFound)
+			}
+			return errors.Wrapf(err, "failed to update firehose grant for user %v", userId)
+		}
+		log.Printf("admin API: firehose grant for user %v set to %+v", userId, grant)
+		// The grant is cached with the user document by the block processor.
+		serverCtx.ConfigChanges.Changed(userId)
+
+		ctx.Response().Header().Set(echo.HeaderContentType, "application/json")
+		return json.NewEncoder(ctx.Response().Writer).Encode(&grant)
+	})
+}
+
+func writeStatus(ctx echo.Context, mode *maintenance.Mode) error {
+	status := mode.Status()
+	ctx.Response().Header().Set(echo.HeaderContentType, "application/json")
+	return json.NewEncoder(ctx.Response().Writer).Encode(&status)
+}
+
+// BindFaults injects synthetic failures into the deliveries to a notifier so that
+// the circuit breaker, the dead letters and the delivery status can be tested end to end.
+// The fault applies to all the users unless ?userId= is given.
+func BindFaults(serverCtx *context.Context, group *echo.Group) {
+	group.GET("/", func(ctx echo.Context) error {
+		ctx.Response().Header().Set(echo.HeaderContentType, "application/json")
+		return json.NewEncoder(ctx.Response().Writer).Encode(serverCtx.Faults.List())
+	})
+
+	// Inject the fault for ?duration=, faults.DefaultDuration by default.
+	group.PUT("/:notifierId/", func(ctx echo.Context) error {
+		userId := ctx.QueryParam("userId")
+		if userId != "" && !bson.IsObjectIdHex(userId) {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid userId")
+		}
+
+		duration := faults.DefaultDuration
+		if v := ctx.QueryParam("duration"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				return echo.NewHTTPError(http.StatusBadRequest, "invalid duration")
+			}
+			duration = d
+		}
+		if duration > faults.MaxDuration {
+			duration = faults.MaxDuration
+		}
+
+		fault := &faults.Fault{
+			NotifierId: ctx.Param("notifierId"),
+			UserId:     userId,
+			Message:    ctx.QueryParam("message"),
+			Until:      time.Now().Add(duration),
+		}
+		serverCtx.Faults.Set(fault)
+		log.Printf("admin API: injecting fault %+v", fault)
+
+		ctx.Response().Header().Set(echo.HeaderContentType, "application/json")
+		return json.NewEncoder(ctx.Response().Writer).Encode(fault)
+	})
+
+	group.DELETE("/:notifierId/", func(ctx echo.Context) error {
+		notifierId, userId := ctx.Param("notifierId"), ctx.QueryParam("userId")
+		if !serverCtx.Faults.Clear(notifierId, userId) {
+			return echo.NewHTTPError(http.StatusNotFound)
+		}
+		log.Printf("admin API: fault for notifier %v, user %q cleared", notifierId, userId)
+		return ctx.NoContent(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,107 @@
+package digest
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/tchap/steemwatch/notifications"
+	"github.com/tchap/steemwatch/server/context"
+	"github.com/tchap/steemwatch/server/users"
+
+	"github.com/labstack/echo"
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	// FlushLimit is the number of flushes a user can request per FlushWindow.
+	FlushLimit  = 10
+	FlushWindow = time.Hour
+)
+
+const (
+	FlushStatusQueued         = "queued"
+	FlushStatusNothingPending = "nothing pending"
+)
+
+// FlushResponse lists the held events that are going to be sent as the digest.
+type FlushResponse struct {
+	Status string         `json:"status"`
+	Events []*HeldSummary `json:"events"`
+}
+
+type HeldSummary struct {
+	EventKind string    `json:"eventKind" bson:"eventKind"`
+	HeldAt    time.Time `json:"heldAt"    bson:"heldAt"`
+}
+
+func Bind(serverCtx *context.Context, group *echo.Group) {
+	// The flush is only queued here, the block processor sends the digest shortly.
+	group.POST("/flush/", func(ctx echo.Context) error {
+		var (
+			profile = ctx.Get("user").(*users.User)
+			ownerId = bson.ObjectIdHex(profile.Id)
+		)
+
+		query := bson.M{
+			"ownerId": ownerId,
+		}
+		held := []*HeldSummary{}
+		err := serverCtx.DB.C("heldEvents").Find(query).Select(bson.M{
+			"eventKind": 1,
+			"heldAt":    1,
+		}).Sort("heldAt").All(&held)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get held events [query=%+v]", query)
+		}
+
+		if len(held) == 0 {
+			ctx.Response().Header().Set(echo.HeaderContentType, "application/json")
+			return json.NewEncoder(ctx.Response().Writer).Encode(&FlushResponse{
+				Status: FlushStatusNothingPending,
+				Events: held,
+			})
+		}
+
+		// A pending request flushes everything, no need for another one.
+		query = bson.M{
+			"ownerId":     ownerId,
+			"processedAt": bson.M{"$exists": false},
+		}
+		pending, err := serverCtx.DB.C("digestFlushes").Find(query).Count()
+		if err != nil {
+			return errors.Wrapf(err, "failed to count digest flushes [query=%+v]", query)
+		}
+
+		if pending == 0 {
+			// Rate limiting.
+			query = bson.M{
+				"ownerId":     ownerId,
+				"requestedAt": bson.M{"$gt": time.Now().Add(-FlushWindow)},
+			}
+			n, err := serverCtx.DB.C("digestFlushes").Find(query).Count()
+			if err != nil {
+				return errors.Wrapf(err, "failed to count digest flushes [query=%+v]", query)
+			}
+			if n >= FlushLimit {
+				return echo.NewHTTPError(http.StatusTooManyRequests, "too many flush requests")
+			}
+
+			err = serverCtx.DB.C("digestFlushes").Insert(&notifications.DigestFlush{
+				OwnerId:     ownerId,
+				RequestedAt: time.Now(),
+			})
+			if err != nil {
+				return errors.Wrap(err, "failed to queue digest flush")
+			}
+		}
+
+		ctx.Response().Header().Set(echo.HeaderContentType, "application/json")
+		ctx.Response().WriteHeader(http.StatusAccepted)
+		return json.NewEncoder(ctx.Response().Writer).Encode(&FlushResponse{
+			Status: FlushStatusQueued,
+			Events: held,
+		})
+	})
+}
@@ -0,0 +1,113 @@
+package events
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tchap/steemwatch/notifications"
+	"github.com/tchap/steemwatch/server/context"
+	"github.com/tchap/steemwatch/server/users"
+
+	"github.com/labstack/echo"
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	HistoryPageSize = 50
+
+	// RedeliveryLimit is the number of redeliveries a user can request per RedeliveryWindow.
+	RedeliveryLimit  = 10
+	RedeliveryWindow = time.Hour
+)
+
+func Bind(serverCtx *context.Context, group *echo.Group) {
+	// Add ?label= to only get the events caused by the subscriptions with the given label.
+	// Add ?afterSeq= to get the entries following the given seq, oldest first,
+	// so that the client can page through the history without missing any entry.
+	group.GET("/history/", func(ctx echo.Context) error {
+		profile := ctx.Get("user").(*users.User)
+
+		query := bson.M{
+			"ownerId": bson.ObjectIdHex(profile.Id),
+		}
+		if label := ctx.QueryParam("label"); label != "" {
+			query["labels"] = strings.ToLower(strings.TrimSpace(label))
+		}
+
+		sort := []string{"-seq", "-createdAt"}
+		if v := ctx.QueryParam("afterSeq"); v != "" {
+			afterSeq, err := strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "invalid afterSeq")
+			}
+			query["seq"] = bson.M{"$gt": afterSeq}
+			sort = []string{"seq"}
+		}
+
+		entries := []*notifications.HistoryEntry{}
+		err := serverCtx.DB.C("history").Find(query).Sort(sort...).Limit(HistoryPageSize).All(&entries)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get history [query=%+v]", query)
+		}
+
+		ctx.Response().Header().Set(echo.HeaderContentType, "application/json")
+		return json.NewEncoder(ctx.Response().Writer).Encode(entries)
+	})
+
+	// Redelivery is only queued here, the block processor picks it up shortly.
+	// Add ?stream=true to send the event to the event stream as well.
+	group.POST("/:id/redeliver/", func(ctx echo.Context) error {
+		var (
+			profile = ctx.Get("user").(*users.User)
+			ownerId = bson.ObjectIdHex(profile.Id)
+			id      = ctx.Param("id")
+		)
+
+		if !bson.IsObjectIdHex(id) {
+			return echo.NewHTTPError(http.StatusNotFound)
+		}
+
+		// Make sure the event belongs to the user.
+		query := bson.M{
+			"_id":     bson.ObjectIdHex(id),
+			"ownerId": ownerId,
+		}
+		n, err := serverCtx.DB.C("history").Find(query).Count()
+		if err != nil {
+			return errors.Wrapf(err, "failed to get history entry [query=%+v]", query)
+		}
+		if n == 0 {
+			return echo.NewHTTPError(http.StatusNotFound)
+		}
+
+		// Rate limiting.
+		query = bson.M{
+			"ownerId":     ownerId,
+			"requestedAt": bson.M{"$gt": time.Now().Add(-RedeliveryWindow)},
+		}
+		n, err = serverCtx.DB.C("redeliveries").Find(query).Count()
+		if err != nil {
+			return errors.Wrapf(err, "failed to count redeliveries [query=%+v]", query)
+		}
+		if n >= RedeliveryLimit {
+			return echo.NewHTTPError(http.StatusTooManyRequests, "too many redelivery requests")
+		}
+
+		err = serverCtx.DB.C("redeliveries").Insert(&notifications.Redelivery{
+			OwnerId:     ownerId,
+			HistoryId:   bson.ObjectIdHex(id),
+			Stream:      ctx.QueryParam("stream") == "true",
+			RequestedAt: time.Now(),
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to queue redelivery")
+		}
+		return ctx.NoContent(http.StatusAccepted)
+	})
+
+	bindTrace(serverCtx, group)
+}
@@ -0,0 +1,107 @@
+package events
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/tchap/steemwatch/notifications"
+	"github.com/tchap/steemwatch/server/context"
+	"github.com/tchap/steemwatch/server/users"
+
+	"github.com/labstack/echo"
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const TracePageSize = 100
+
+// TraceStatus is returned by the trace endpoint together with the recent trace entries.
+type TraceStatus struct {
+	Until   *time.Time                  `json:"until,omitempty"`
+	Entries []*notifications.TraceEntry `json:"entries"`
+}
+
+// bindTrace binds the trace mode endpoints. Trace mode records how the candidate events
+// are processed for the user, it takes up to notifications.TraceRefreshInterval to kick in.
+func bindTrace(serverCtx *context.Context, group *echo.Group) {
+	group.GET("/trace/", func(ctx echo.Context) error {
+		profile := ctx.Get("user").(*users.User)
+
+		var doc struct {
+			TraceUntil *time.Time `bson:"traceUntil"`
+		}
+		err := serverCtx.DB.C("users").FindId(bson.ObjectIdHex(profile.Id)).Select(bson.M{
+			"traceUntil": 1,
+		}).One(&doc)
+		if err != nil && err != mgo.ErrNotFound {
+			return errors.Wrapf(err, "failed to get trace mode for user %v", profile.Id)
+		}
+
+		status := TraceStatus{
+			Entries: []*notifications.TraceEntry{},
+		}
+		if doc.TraceUntil != nil && doc.TraceUntil.After(time.Now()) {
+			status.Until = doc.TraceUntil
+		}
+
+		query := bson.M{
+			"ownerId": bson.ObjectIdHex(profile.Id),
+		}
+		err = serverCtx.DB.C("traces").Find(query).Sort("-createdAt").Limit(TracePageSize).All(&status.Entries)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get traces [query=%+v]", query)
+		}
+
+		ctx.Response().Header().Set(echo.HeaderContentType, "application/json")
+		return json.NewEncoder(ctx.Response().Writer).Encode(&status)
+	})
+
+	// Turn trace mode on for ?duration=, notifications.DefaultTraceDuration by default.
+	group.PUT("/trace/", func(ctx echo.Context) error {
+		profile := ctx.Get("user").(*users.User)
+
+		duration := notifications.DefaultTraceDuration
+		if v := ctx.QueryParam("duration"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				return echo.NewHTTPError(http.StatusBadRequest, "invalid duration")
+			}
+			duration = d
+		}
+		if duration > notifications.MaxTraceDuration {
+			duration = notifications.MaxTraceDuration
+		}
+
+		until := time.Now().Add(duration)
+		update := bson.M{
+			"$set": bson.M{
+				"traceUntil": until,
+			},
+		}
+		if err := serverCtx.DB.C("users").UpdateId(bson.ObjectIdHex(profile.Id), update); err != nil {
+			return errors.Wrapf(err, "failed to enable trace mode for user %v", profile.Id)
+		}
+
+		ctx.Response().Header().Set(echo.HeaderContentType, "application/json")
+		return json.NewEncoder(ctx.Response().Writer).Encode(&TraceStatus{
+			Until:   &until,
+			Entries: []*notifications.TraceEntry{},
+		})
+	})
+
+	group.DELETE("/trace/", func(ctx echo.Context) error {
+		profile := ctx.Get("user").(*users.User)
+
+		update := bson.M{
+			"$unset": bson.M{
+				"traceUntil": "",
+			},
+		}
+		if err := serverCtx.DB.C("users").UpdateId(bson.ObjectIdHex(profile.Id), update); err != nil {
+			return errors.Wrapf(err, "failed to disable trace mode for user %v", profile.Id)
+		}
+		return ctx.NoContent(http.StatusNoContent)
+	})
+}
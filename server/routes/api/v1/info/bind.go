@@ -9,9 +9,19 @@ import (
 
 	"github.com/labstack/echo"
 	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
 
+// SyncInfo tells how far behind the head block of the node the block processor is.
+type SyncInfo struct {
+	HeadBlockNumber          uint32     `json:"headBlockNumber"`
+	LastProcessedBlockNumber uint32     `json:"lastProcessedBlockNumber"`
+	Lag                      uint32     `json:"lag"`
+	Synced                   bool       `json:"synced"`
+	UpdatedAt                *time.Time `json:"updatedAt,omitempty"`
+}
+
 type Info struct {
 	NextBlockNumber    uint32     `json:"nextBlockNumber"`
 	LastBlockTimestamp *time.Time `json:"lastBlockTimestamp,omitempty"`
@@ -34,4 +44,39 @@ func Bind(serverCtx *context.Context, root *echo.Group) {
 		resp.Header().Set("Content-Type", "application/json")
 		return json.NewEncoder(resp.Writer).Encode(&info)
 	})
+
+	root.GET("/sync/", func(ctx echo.Context) error {
+		var config notifications.BlockProcessorConfig
+		err := serverCtx.DB.C("configuration").Find(bson.M{"_id": "BlockProcessor"}).One(&config)
+		if err != nil {
+			return errors.Wrap(err, "failed to get BlockProcessor config")
+		}
+
+		// The status is missing when the block processor is not running.
+		var status notifications.SyncStatus
+		err = serverCtx.DB.C("configuration").FindId(notifications.SyncStatusId).One(&status)
+		if err != nil && err != mgo.ErrNotFound {
+			return errors.Wrap(err, "failed to get sync status")
+		}
+
+		info := &SyncInfo{
+			HeadBlockNumber: status.HeadBlockNum,
+		}
+		if config.NextBlockNum != 0 {
+			info.LastProcessedBlockNumber = config.NextBlockNum - 1
+		}
+		if info.HeadBlockNumber > info.LastProcessedBlockNumber {
+			info.Lag = info.HeadBlockNumber - info.LastProcessedBlockNumber
+		}
+		if !status.UpdatedAt.IsZero() {
+			info.UpdatedAt = &status.UpdatedAt
+			// An outdated status means the processor is not checking the node any more.
+			fresh := time.Since(status.UpdatedAt) < 3*notifications.SyncStatusInterval
+			info.Synced = fresh && info.Lag <= notifications.SyncedMaxLag
+		}
+
+		resp := ctx.Response()
+		resp.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(resp.Writer).Encode(info)
+	})
 }
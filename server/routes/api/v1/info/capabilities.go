@@ -0,0 +1,33 @@
+package info
+
+import (
+	"encoding/json"
+
+	"github.com/tchap/steemwatch/notifications"
+	"github.com/tchap/steemwatch/server/context"
+
+	"github.com/labstack/echo"
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2"
+)
+
+// BindCapabilities binds the endpoint reporting what this deployment is watching for.
+// The block processor might be disabled, in which case empty capabilities are returned.
+func BindCapabilities(serverCtx *context.Context, root *echo.Group) {
+	root.GET("/", func(ctx echo.Context) error {
+		caps := notifications.Capabilities{
+			OpTypes:    []string{},
+			EventKinds: []string{},
+			Notifiers:  []string{},
+			Features:   map[string]bool{},
+		}
+		err := serverCtx.DB.C("configuration").FindId(notifications.CapabilitiesId).One(&caps)
+		if err != nil && err != mgo.ErrNotFound {
+			return errors.Wrap(err, "failed to get capabilities")
+		}
+
+		resp := ctx.Response()
+		resp.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(resp.Writer).Encode(&caps)
+	})
+}
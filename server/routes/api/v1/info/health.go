@@ -0,0 +1,59 @@
+package info
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/tchap/steemwatch/notifications/dbhealth"
+	"github.com/tchap/steemwatch/notifications/pause"
+	"github.com/tchap/steemwatch/server/context"
+	"github.com/tchap/steemwatch/server/maintenance"
+
+	"github.com/labstack/echo"
+)
+
+const (
+	HealthStatusOK          = "ok"
+	HealthStatusMaintenance = "maintenance"
+	HealthStatusPaused      = "paused"
+	HealthStatusDegraded    = "degraded"
+)
+
+type Health struct {
+	Status      string              `json:"status"`
+	Maintenance *maintenance.Status `json:"maintenance,omitempty"`
+	Pipeline    *pause.Status       `json:"pipeline,omitempty"`
+	Database    *dbhealth.Status    `json:"database,omitempty"`
+}
+
+// BindHealth exposes the health endpoint. It responds with 503 while in maintenance mode
+// so that load balancers can tell the instance is not serving properly.
+// A paused pipeline is reported, but the web server is still serving, so it is a 200.
+// The same goes for the database being unavailable, the events are delivered meanwhile
+// using the cached configuration.
+func BindHealth(serverCtx *context.Context, root *echo.Group) {
+	root.GET("/", func(ctx echo.Context) error {
+		var (
+			health = &Health{Status: HealthStatusOK}
+			code   = http.StatusOK
+		)
+		if status := serverCtx.DBHealth.Status(); status.Degraded {
+			health.Status = HealthStatusDegraded
+			health.Database = &status
+		}
+		if status := serverCtx.Pipeline.Status(); status.Paused {
+			health.Status = HealthStatusPaused
+			health.Pipeline = &status
+		}
+		if status := serverCtx.Maintenance.Status(); status.Enabled {
+			health.Status = HealthStatusMaintenance
+			health.Maintenance = &status
+			code = http.StatusServiceUnavailable
+		}
+
+		resp := ctx.Response()
+		resp.Header().Set(echo.HeaderContentType, "application/json")
+		resp.WriteHeader(code)
+		return json.NewEncoder(resp.Writer).Encode(health)
+	})
+}
@@ -10,23 +10,40 @@ import (
 	"strings"
 
 	"github.com/tchap/steemwatch/config"
+	"github.com/tchap/steemwatch/links"
+	"github.com/tchap/steemwatch/notifications/accounts"
+	"github.com/tchap/steemwatch/notifications/dbhealth"
+	"github.com/tchap/steemwatch/notifications/faults"
+	"github.com/tchap/steemwatch/notifications/pause"
 	"github.com/tchap/steemwatch/server/auth"
 	"github.com/tchap/steemwatch/server/auth/facebook"
 	"github.com/tchap/steemwatch/server/auth/github"
 	"github.com/tchap/steemwatch/server/auth/google"
 	"github.com/tchap/steemwatch/server/auth/reddit"
+	"github.com/tchap/steemwatch/server/changes"
 	"github.com/tchap/steemwatch/server/context"
 	"github.com/tchap/steemwatch/server/db"
+	"github.com/tchap/steemwatch/server/maintenance"
 	"github.com/tchap/steemwatch/server/routes/api/eventstream"
 	"github.com/tchap/steemwatch/server/routes/api/notifiers/discord"
+	"github.com/tchap/steemwatch/server/routes/api/notifiers/irc"
+	"github.com/tchap/steemwatch/server/routes/api/notifiers/matrix"
+	"github.com/tchap/steemwatch/server/routes/api/notifiers/push"
 	"github.com/tchap/steemwatch/server/routes/api/notifiers/slack"
+	"github.com/tchap/steemwatch/server/routes/api/notifiers/status"
 	"github.com/tchap/steemwatch/server/routes/api/notifiers/steemitchat"
 	"github.com/tchap/steemwatch/server/routes/api/notifiers/telegram"
+	"github.com/tchap/steemwatch/server/routes/api/notifiers/xmpp"
 	"github.com/tchap/steemwatch/server/routes/api/profile"
+	apiaccounts "github.com/tchap/steemwatch/server/routes/api/v1/accounts"
+	"github.com/tchap/steemwatch/server/routes/api/v1/admin"
+	"github.com/tchap/steemwatch/server/routes/api/v1/digest"
+	"github.com/tchap/steemwatch/server/routes/api/v1/events"
 	"github.com/tchap/steemwatch/server/routes/api/v1/info"
 	"github.com/tchap/steemwatch/server/routes/home"
 	"github.com/tchap/steemwatch/server/routes/logout"
 	"github.com/tchap/steemwatch/server/sessions"
+	"github.com/tchap/steemwatch/server/subscriptions"
 	"github.com/tchap/steemwatch/server/users/stores/mongodb"
 	"github.com/tchap/steemwatch/server/views"
 
@@ -37,12 +54,20 @@ import (
 	"github.com/labstack/echo-contrib/session"
 	"github.com/labstack/echo/middleware"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/tomb.v2"
 )
 
 type Context struct {
 	EventStreamManager *eventstream.Manager
+	Links              *links.Builder
+	Maintenance        *maintenance.Mode
+	Pipeline           *pause.Switch
+	DBHealth           *dbhealth.Monitor
+	Faults             *faults.Injector
+	ConfigChanges      *changes.Feed
+	AccountOverviews   *accounts.Overviews
 
 	listener net.Listener
 
@@ -91,6 +116,52 @@ func Run(mongo *mgo.Database, cfg *config.Config) (*Context, *discordgo.Session,
 
 	serverCtx.CanonicalURL = canonicalURL
 
+	lb, err := links.NewBuilder(cfg.FrontendURL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serverCtx.Links = lb
+
+	// Trusted proxies.
+	trustedProxies, err := context.ParseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		return nil, nil, err
+	}
+	serverCtx.TrustedProxies = trustedProxies
+
+	serverCtx.HistoryMaxRetention = cfg.HistoryMaxRetention
+
+	// Default subscriptions for the new users.
+	if cfg.DefaultSubscriptionsFile != "" {
+		template, err := subscriptions.Load(cfg.DefaultSubscriptionsFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		serverCtx.DefaultSubscriptions = template
+	}
+
+	// Pipeline pausing, used by the block processor.
+	serverCtx.Pipeline = pause.NewSwitch()
+
+	// Database availability, reported by the block processor.
+	serverCtx.DBHealth = dbhealth.NewMonitor()
+
+	// Configuration changes, used by the block processor to invalidate its cache.
+	serverCtx.ConfigChanges = changes.NewFeed()
+
+	// Fault injection, only available outside of production unless enabled explicitly.
+	if cfg.FaultInjection || serverCtx.Env != context.EnvironmentProduction {
+		serverCtx.Faults = faults.NewInjector()
+	}
+
+	// Account overviews, the steemd client is set once connected.
+	serverCtx.AccountOverviews = accounts.NewOverviews(cfg.AccountOverviewTTL, accounts.DefaultCacheSize)
+
+	// Maintenance mode.
+	serverCtx.Maintenance = maintenance.NewMode()
+	serverCtx.Maintenance.Set(cfg.Maintenance, cfg.MaintenanceMessage)
+
 	// Echo.
 	e := echo.New()
 
@@ -111,21 +182,8 @@ func Run(mongo *mgo.Database, cfg *config.Config) (*Context, *discordgo.Session,
 	e.Static("/assets/bootstrap", "server/app/node_modules/bootstrap/dist")
 
 	// Middleware
-	e.Pre(middleware.AddTrailingSlash())
-	e.Use(middleware.Logger())
-	e.Use(middleware.Recover())
-	e.Use(middleware.Secure())
-	e.Use(session.Middleware(gorillaSessions.NewCookieStore(hashKey, blockKey)))
-
-	// A temporary fix. We need to encode the CSRF header value.
-	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
-		return func(c echo.Context) error {
-			req := c.Request()
-			token := req.Header.Get(echo.HeaderXCSRFToken)
-			req.Header.Set(echo.HeaderXCSRFToken, url.QueryEscape(token))
-			return next(c)
-		}
-	})
+	addTrailingSlash(e, cfg.TrailingSlashRedirect)
+	useMiddleware(e, serverCtx, hashKey, blockKey)
 
 	csrfConfig := middleware.DefaultCSRFConfig
 	csrfConfig.CookieName = "csrf"
@@ -144,6 +202,9 @@ func Run(mongo *mgo.Database, cfg *config.Config) (*Context, *discordgo.Session,
 		middleware.RemoveTrailingSlash(),
 	)
 
+	// Metrics
+	e.GET("/metrics/", echo.WrapHandler(promhttp.Handler()))
+
 	// Web
 	homeHandler := home.NewHandlerFunc(serverCtx)
 
@@ -181,21 +242,89 @@ func Run(mongo *mgo.Database, cfg *config.Config) (*Context, *discordgo.Session,
 	auth.Bind(serverCtx, e.Group("/auth/github", csrf), githubAuth)
 
 	// Public API
-	info.Bind(serverCtx, e.Group("/api/v1/info"))
+	// Private deployments can require a session for the info endpoint or turn it off.
+	switch cfg.InfoAccess {
+	case "", "public":
+		info.Bind(serverCtx, e.Group("/api/v1/info"))
+	case "authenticated":
+		info.Bind(serverCtx, e.Group("/api/v1/info", csrf, auth.Required(serverCtx)))
+	case "disabled":
+	default:
+		return nil, nil, errors.New("invalid info access: " + cfg.InfoAccess)
+	}
+	info.BindHealth(serverCtx, e.Group("/api/v1/health"))
+
+	// Admin API
+	if cfg.AdminSecret != "" {
+		adminAPI := e.Group("/api/v1/admin", admin.RequireSecret(serverCtx, cfg.AdminSecret))
+		admin.BindMaintenance(serverCtx, adminAPI.Group("/maintenance"))
+		admin.BindFirehose(serverCtx, adminAPI.Group("/firehose"))
+		admin.BindPipeline(serverCtx, adminAPI.Group("/pipeline"))
+		if serverCtx.Faults != nil {
+			admin.BindFaults(serverCtx, adminAPI.Group("/faults"))
+		}
+	}
 
 	// API
-	api := e.Group("/api", csrf, auth.Required(serverCtx))
+	api := e.Group("/api", csrf, auth.Required(serverCtx), serverCtx.ConfigChanges.Middleware())
 
 	// API - Events
-	db.BindList(serverCtx, api.Group("/events/:kind/:list"))
+	db.BindSettings(serverCtx, api.Group("/events/:kind/settings"))
+	db.BindList(serverCtx, api.Group("/events/:kind/:list"), &db.ListLimits{
+		MaxListEntries: cfg.MaxListEntries,
+		MaxUserEntries: cfg.MaxUserEntries,
+	})
+	events.Bind(serverCtx, api.Group("/v1/events"))
+	digest.Bind(serverCtx, api.Group("/v1/digest"))
+
+	// API - Accounts
+	apiaccounts.Bind(serverCtx, api.Group("/v1/accounts"))
+
+	// API - Info
+	info.BindCapabilities(serverCtx, api.Group("/v1/info/capabilities"))
 
 	// API - Event Stream
-	manager := eventstream.NewManager()
+	manager := eventstream.NewManager(serverCtx.Links)
 	manager.Bind(serverCtx, api.Group("/eventstream"))
+	// The clients ask for a reload after changing the configuration some other way.
+	manager.AddReloader(func(userId string) error {
+		serverCtx.ConfigChanges.Changed(userId)
+		return nil
+	})
+	// The WebSocket endpoint accepts a stream token as well,
+	// some clients cannot send the session cookie on the upgrade request.
+	// CSRF is skipped, it only sets a cookie on GET, which the hijacked connection drops.
+	manager.BindWebSocket(serverCtx, webSocketGroup(e, serverCtx, manager))
+	if cfg.StreamTokenTTL != 0 {
+		manager.BindStreamTokens(api.Group("/eventstream/token"), cfg.StreamTokenTTL)
+	}
+	if cfg.StreamMaxIdle != 0 {
+		manager.StartReaper(cfg.StreamMaxIdle)
+	}
+	manager.SetReplaceGrace(cfg.StreamReplaceGrace)
+	manager.SetMaxBackfill(cfg.StreamMaxBackfill)
+
+	// Close the streams when entering maintenance mode.
+	serverCtx.Maintenance.OnChange(func(status maintenance.Status) {
+		if status.Enabled {
+			manager.CloseStreams(eventstream.CloseCodeMaintenance, status.Message)
+		}
+	})
+
+	// Ingest - Events forwarded by other instances, authenticated using the shared secret.
+	if cfg.IngestSecret != "" {
+		manager.BindIngest(e.Group("/api/v1/ingest"), cfg.IngestSecret)
+	}
 
 	// API - Notifiers
+	status.Bind(serverCtx, api.Group("/notifiers/status"))
 	slack.Bind(serverCtx, api.Group("/notifiers/slack"))
 	steemitchat.Bind(serverCtx, api.Group("/notifiers/steemit-chat"))
+	matrix.Bind(serverCtx, api.Group("/notifiers/matrix"))
+	irc.Bind(serverCtx, api.Group("/notifiers/irc"))
+	xmpp.Bind(serverCtx, api.Group("/notifiers/xmpp"))
+	push.Bind(serverCtx, api.Group("/notifiers/apns"), push.NotifierIDAPNs)
+	push.Bind(serverCtx, api.Group("/notifiers/fcm"), push.NotifierIDFCM)
 
 	// Telegram
 	botSecret := make([]byte, 256/8)
@@ -232,6 +361,13 @@ func Run(mongo *mgo.Database, cfg *config.Config) (*Context, *discordgo.Session,
 
 	ctx := &Context{
 		EventStreamManager: manager,
+		Links:              serverCtx.Links,
+		Maintenance:        serverCtx.Maintenance,
+		Pipeline:           serverCtx.Pipeline,
+		DBHealth:           serverCtx.DBHealth,
+		Faults:             serverCtx.Faults,
+		ConfigChanges:      serverCtx.ConfigChanges,
+		AccountOverviews:   serverCtx.AccountOverviews,
 		listener:           listener,
 	}
 
@@ -264,3 +400,65 @@ func (ctx *Context) Interrupt() {
 func (ctx *Context) Wait() error {
 	return ctx.t.Wait()
 }
+
+// useMiddleware adds the middleware used by all the routes.
+func useMiddleware(e *echo.Echo, serverCtx *context.Context, hashKey, blockKey []byte) {
+	e.Use(middleware.Logger())
+	e.Use(middleware.Recover())
+	e.Use(middleware.Secure())
+	e.Use(session.Middleware(gorillaSessions.NewCookieStore(hashKey, blockKey)))
+	e.Use(serverCtx.Maintenance.Middleware("maintenance.html", isMaintenanceExempt))
+
+	// A temporary fix. We need to encode the CSRF header value.
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			token := req.Header.Get(echo.HeaderXCSRFToken)
+			req.Header.Set(echo.HeaderXCSRFToken, url.QueryEscape(token))
+			return next(c)
+		}
+	})
+}
+
+// webSocketGroup returns the group of the event stream WebSocket endpoint, see BindWebSocket.
+func webSocketGroup(e *echo.Echo, serverCtx *context.Context, manager *eventstream.Manager) *echo.Group {
+	return e.Group("/api/eventstream/ws", eventstream.RequireUpgrade(), manager.RequireSessionOrToken(serverCtx))
+}
+
+// isMaintenanceExempt returns true for the requests that are served in maintenance mode as usual.
+func isMaintenanceExempt(c echo.Context) bool {
+	path := c.Request().URL.Path
+	for _, prefix := range []string{
+		"/assets/", "/app/", "/modules/", "/debug/", "/api/v1/admin/", "/api/v1/health/",
+	} {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// addTrailingSlash makes the routes match the paths missing the trailing slash.
+//
+// All routes are registered with a trailing slash. API requests are always rewritten
+// internally since a redirect would make some clients drop the body or change the method.
+// Web requests can be redirected to the canonical URL instead when redirect is set.
+func addTrailingSlash(e *echo.Echo, redirect bool) {
+	e.Pre(middleware.AddTrailingSlashWithConfig(middleware.TrailingSlashConfig{
+		Skipper: func(c echo.Context) bool {
+			return !isAPIRequest(c)
+		},
+	}))
+	webTrailingSlash := middleware.TrailingSlashConfig{
+		Skipper: isAPIRequest,
+	}
+	if redirect {
+		webTrailingSlash.RedirectCode = http.StatusMovedPermanently
+	}
+	e.Pre(middleware.AddTrailingSlashWithConfig(webTrailingSlash))
+}
+
+func isAPIRequest(c echo.Context) bool {
+	path := c.Request().URL.Path
+	return path == "/api" || strings.HasPrefix(path, "/api/")
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo"
+)
+
+func TestAddTrailingSlash(t *testing.T) {
+	testCases := []struct {
+		name     string
+		redirect bool
+		method   string
+		path     string
+		code     int
+		location string
+	}{
+		{"api post", false, http.MethodPost, "/api/v1/resource", http.StatusOK, ""},
+		{"api post with slash", false, http.MethodPost, "/api/v1/resource/", http.StatusOK, ""},
+		{"api put", false, http.MethodPut, "/api/v1/resource", http.StatusOK, ""},
+		{"api delete", false, http.MethodDelete, "/api/v1/resource", http.StatusOK, ""},
+		{"api post with redirect", true, http.MethodPost, "/api/v1/resource", http.StatusOK, ""},
+		{"api get with redirect", true, http.MethodGet, "/api/v1/resource", http.StatusOK, ""},
+		{"web get", false, http.MethodGet, "/dashboard", http.StatusOK, ""},
+		{"web get with redirect", true, http.MethodGet, "/dashboard", http.StatusMovedPermanently, "/dashboard/"},
+		{"web get with slash and redirect", true, http.MethodGet, "/dashboard/", http.StatusOK, ""},
+		{"metrics", false, http.MethodGet, "/metrics", http.StatusOK, ""},
+	}
+
+	for _, tc := range testCases {
+		e := echo.New()
+		addTrailingSlash(e, tc.redirect)
+
+		echoBody := func(ctx echo.Context) error {
+			body, err := ioutil.ReadAll(ctx.Request().Body)
+			if err != nil {
+				return err
+			}
+			return ctx.String(http.StatusOK, string(body))
+		}
+		e.Any("/api/v1/resource/", echoBody)
+		e.GET("/dashboard/", echoBody)
+		e.GET("/metrics/", echoBody)
+
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader("body"))
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		if rec.Code != tc.code {
+			t.Errorf("%v: %v %v: got status %v, want %v", tc.name, tc.method, tc.path, rec.Code, tc.code)
+			continue
+		}
+		if location := rec.Header().Get(echo.HeaderLocation); location != tc.location {
+			t.Errorf("%v: %v %v: got location %q, want %q", tc.name, tc.method, tc.path, location, tc.location)
+		}
+		// The body must make it to the handler, it would be lost with a redirect.
+		if tc.code == http.StatusOK && tc.method != http.MethodGet && rec.Body.String() != "body" {
+			t.Errorf("%v: %v %v: got body %q, want %q", tc.name, tc.method, tc.path, rec.Body.String(), "body")
+		}
+	}
+}
@@ -42,11 +42,12 @@ func (manager *SessionManager) GetProfile(ctx echo.Context) (*users.User, error)
 }
 
 func (manager *SessionManager) SetProfile(ctx echo.Context, profile *users.User) error {
-	// Store the profile.
+	// Store the profile. The ID is filled in for the caller.
 	id, err := manager.store.StoreUser(profile)
 	if err != nil {
 		return err
 	}
+	profile.Id = id
 
 	// Get a sessions.
 	s, err := session.Get(SessionName, ctx)
@@ -0,0 +1,118 @@
+package subscriptions
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Entry is the default configuration of a single event kind,
+// i.e. the list entries and the settings that end up in the events document.
+type Entry struct {
+	Kind     string                 `json:"kind"`
+	Lists    map[string][]string    `json:"lists"`
+	Settings map[string]interface{} `json:"settings,omitempty"`
+}
+
+// Template is the set of the subscriptions new users start with, e.g.
+//
+//	[{"kind": "story.published", "lists": {"tags": ["steemwatch"]}}]
+type Template []*Entry
+
+// Load reads the template from the given JSON file.
+func Load(path string) (Template, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open subscription template")
+	}
+	defer file.Close()
+
+	var template Template
+	if err := json.NewDecoder(file).Decode(&template); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode subscription template %v", path)
+	}
+	for _, entry := range template {
+		if entry.Kind == "" {
+			return nil, errors.Errorf("subscription template %v: kind not set", path)
+		}
+		for list, values := range entry.Lists {
+			for i, v := range values {
+				values[i] = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(v), "@"))
+			}
+			entry.Lists[list] = values
+		}
+	}
+	return template, nil
+}
+
+// Apply sets up the subscriptions for the user unless it was done before
+// or the user has some configuration already. It returns true when the template was applied.
+func (template Template) Apply(db *mgo.Database, userId string) (bool, error) {
+	if len(template) == 0 {
+		return false, nil
+	}
+	ownerId := bson.ObjectIdHex(userId)
+
+	// Mark the user first so that the template is only ever applied once,
+	// not again after the user removed the default subscriptions.
+	selector := bson.M{
+		"_id":               ownerId,
+		"defaultsAppliedAt": bson.M{"$exists": false},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"defaultsAppliedAt": time.Now(),
+		},
+	}
+	if err := db.C("users").Update(selector, update); err != nil {
+		if err == mgo.ErrNotFound {
+			return false, nil
+		}
+		return false, errors.Wrapf(err, "failed to mark user %v", userId)
+	}
+
+	n, err := db.C("events").Find(bson.M{"ownerId": ownerId}).Count()
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to get event documents for user %v", userId)
+	}
+	if n != 0 {
+		return false, nil
+	}
+
+	for _, entry := range template {
+		selector := bson.M{
+			"ownerId": ownerId,
+			"kind":    entry.Kind,
+		}
+
+		addToSet := bson.M{}
+		for list, values := range entry.Lists {
+			addToSet[list] = bson.M{"$each": values}
+		}
+		set := bson.M{}
+		for k, v := range entry.Settings {
+			set["settings."+k] = v
+		}
+
+		update := bson.M{}
+		if len(addToSet) != 0 {
+			update["$addToSet"] = addToSet
+		}
+		if len(set) != 0 {
+			update["$set"] = set
+		}
+		if len(update) == 0 {
+			continue
+		}
+
+		if _, err := db.C("events").Upsert(selector, update); err != nil {
+			return false, errors.Wrapf(err, "failed to apply %v defaults for user %v", entry.Kind, userId)
+		}
+	}
+	return true, nil
+}
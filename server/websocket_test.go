@@ -0,0 +1,189 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tchap/steemwatch/server/auth"
+	"github.com/tchap/steemwatch/server/context"
+	"github.com/tchap/steemwatch/server/maintenance"
+	"github.com/tchap/steemwatch/server/routes/api/eventstream"
+	"github.com/tchap/steemwatch/server/sessions"
+	"github.com/tchap/steemwatch/server/users"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo"
+)
+
+// memUserStore keeps the users in memory, the session cookie is the user ID.
+type memUserStore struct {
+	users map[string]*users.User
+}
+
+func (store *memUserStore) LoadUser(sessionCookie string) (*users.User, error) {
+	return store.users[sessionCookie], nil
+}
+
+func (store *memUserStore) StoreUser(user *users.User) (string, error) {
+	store.users[user.Id] = user
+	return user.Id, nil
+}
+
+// newWebSocketServer returns the server with the middleware chain of Run in front of
+// the WebSocket endpoint, which echoes the ID of the authenticated user once upgraded.
+func newWebSocketServer(t *testing.T) *httptest.Server {
+	sessionManager, err := sessions.NewSessionManager(&memUserStore{users: make(map[string]*users.User)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverCtx := &context.Context{
+		SessionManager: sessionManager,
+		Maintenance:    maintenance.NewMode(),
+	}
+
+	e := echo.New()
+	key := []byte(strings.Repeat("k", 32))
+	useMiddleware(e, serverCtx, key, key)
+
+	e.GET("/login/", func(ctx echo.Context) error {
+		if err := serverCtx.SessionManager.SetProfile(ctx, &users.User{Id: "alice"}); err != nil {
+			return err
+		}
+		return ctx.NoContent(http.StatusOK)
+	})
+
+	manager := eventstream.NewManager(serverCtx.Links)
+	manager.BindStreamTokens(e.Group("/api/eventstream/token", auth.Required(serverCtx)), time.Minute)
+
+	upgrader := websocket.Upgrader{}
+	webSocketGroup(e, serverCtx, manager).GET("/", func(ctx echo.Context) error {
+		conn, err := upgrader.Upgrade(ctx.Response().Writer, ctx.Request(), nil)
+		if err != nil {
+			return nil
+		}
+		defer conn.Close()
+		return conn.WriteMessage(websocket.TextMessage, []byte(ctx.Get("user").(*users.User).Id))
+	})
+
+	return httptest.NewServer(e)
+}
+
+func TestWebSocketUpgrade(t *testing.T) {
+	server := newWebSocketServer(t)
+	defer server.Close()
+
+	// Log in to get the session cookie.
+	res, err := http.Get(server.URL + "/login/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	cookie := res.Header.Get("Set-Cookie")
+	if cookie == "" {
+		t.Fatal("session cookie not set")
+	}
+
+	// Get a stream token using the session.
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/api/eventstream/token/", nil)
+	req.Header.Set("Cookie", cookie)
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var token eventstream.StreamToken
+	err = json.NewDecoder(res.Body).Decode(&token)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/eventstream/ws/"
+
+	testCases := []struct {
+		name   string
+		query  string
+		cookie string
+		status int
+	}{
+		{"session", "", cookie, http.StatusSwitchingProtocols},
+		{"stream token", "?" + eventstream.StreamTokenParam + "=" + token.Token, "", http.StatusSwitchingProtocols},
+		{"stream token reused", "?" + eventstream.StreamTokenParam + "=" + token.Token, "", http.StatusForbidden},
+		{"not authenticated", "", "", http.StatusForbidden},
+	}
+
+	for _, tc := range testCases {
+		header := http.Header{}
+		if tc.cookie != "" {
+			header.Set("Cookie", tc.cookie)
+		}
+
+		conn, res, err := websocket.DefaultDialer.Dial(wsURL+tc.query, header)
+		if res == nil {
+			t.Errorf("%v: no response: %v", tc.name, err)
+			continue
+		}
+		if res.StatusCode != tc.status {
+			t.Errorf("%v: got status %v, want %v", tc.name, res.StatusCode, tc.status)
+		}
+		if conn == nil {
+			continue
+		}
+
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			t.Errorf("%v: failed to read the message: %v", tc.name, err)
+		} else if string(msg) != "alice" {
+			t.Errorf("%v: got user %q, want %q", tc.name, msg, "alice")
+		}
+		conn.Close()
+	}
+}
+
+func TestWebSocketUpgradeRejected(t *testing.T) {
+	server := newWebSocketServer(t)
+	defer server.Close()
+
+	handshake := func(header http.Header) {
+		header.Set("Connection", "Upgrade")
+		header.Set("Upgrade", "websocket")
+		header.Set("Sec-WebSocket-Version", "13")
+		header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	}
+
+	testCases := []struct {
+		name   string
+		header func(http.Header)
+		status int
+	}{
+		{"plain GET", func(http.Header) {}, http.StatusBadRequest},
+		{"duplicate key", func(header http.Header) {
+			handshake(header)
+			header.Add("Sec-WebSocket-Key", "YW5vdGhlciBzYW1wbGUgbm9uY2U=")
+		}, http.StatusBadRequest},
+		{"duplicate version", func(header http.Header) {
+			handshake(header)
+			header.Add("Sec-WebSocket-Version", "8")
+		}, http.StatusBadRequest},
+		// The upgrade itself is fine, the authentication is checked next.
+		{"not authenticated", handshake, http.StatusForbidden},
+	}
+
+	for _, tc := range testCases {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/eventstream/ws/", nil)
+		tc.header(req.Header)
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", tc.name, err)
+			continue
+		}
+		res.Body.Close()
+		if res.StatusCode != tc.status {
+			t.Errorf("%v: got status %v, want %v", tc.name, res.StatusCode, tc.status)
+		}
+	}
+}